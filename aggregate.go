@@ -0,0 +1,281 @@
+package ep
+
+import "fmt"
+
+var _ = registerGob(&count{}, &sum{}, &minMax{}, &avg{})
+
+// Aggregator aggregates the rows of every group of GroupBy into a single
+// value. Every group has a state of its own, updated by all of its rows, while
+// the results of all of the groups are returned at once. Aggregators are
+// distributed with their GroupBy, thus they must be registered with gob.
+//
+// The states are also returned as Data by Partial, and read back by
+// PartialState, for GroupBy in MergePartial mode to send them to other nodes,
+// where GroupBy in MergeFinal mode merges them
+type Aggregator interface {
+	// InitState returns the state of a new group, before any of its rows
+	InitState() interface{}
+
+	// Update updates the state of a group by the row-th row of the dataset,
+	// of the input of GroupBy. Returns an error when the dataset can't be
+	// aggregated, e.g. when its aggregated column is of an unsupported type
+	Update(state interface{}, ds Dataset, row int) error
+
+	// Merge merges the state b into the state a, as if all of the rows of b
+	// updated a
+	Merge(a, b interface{})
+
+	// Result returns the results of the states of all of the groups, in their
+	// order, as a Data of Returns
+	Result(states []interface{}) Data
+
+	// Partial returns the states of all of the groups as Data, which can be
+	// distributed
+	Partial(states []interface{}) Data
+
+	// PartialState returns the state of the row-th row of a Data returned by
+	// Partial
+	PartialState(data Data, row int) interface{}
+
+	// Returns is the type of the results, which may be a Wildcard
+	Returns() Type
+}
+
+// Count returns an Aggregator of the number of the non-null values of the
+// col-th column, as Int64s, or of the number of rows when col is negative
+func Count(col int) Aggregator { return &count{Col: col} }
+
+// Sum returns an Aggregator of the sum of the non-null values of the col-th
+// column, of Int64s or Float64s, as the same type. Groups without any values
+// are null
+func Sum(col int) Aggregator { return &sum{Col: col} }
+
+// Min returns an Aggregator of the minimal non-null value of the col-th
+// column, by Compare, which is of any Type. Groups without any values are null
+func Min(col int) Aggregator { return &minMax{Col: col} }
+
+// Max returns an Aggregator of the maximal non-null value of the col-th
+// column, similar to Min
+func Max(col int) Aggregator { return &minMax{Col: col, Max: true} }
+
+// Avg returns an Aggregator of the average of the non-null values of the
+// col-th column, of Int64s or Float64s, as Float64s. Groups without any
+// values are null
+func Avg(col int) Aggregator { return &avg{Col: col} }
+
+type count struct{ Col int }
+
+func (*count) InitState() interface{} { return new(int64) }
+func (a *count) Update(state interface{}, ds Dataset, row int) error {
+	if a.Col < 0 || !ds.At(a.Col).IsNull(row) {
+		*state.(*int64)++
+	}
+	return nil
+}
+func (*count) Merge(a, b interface{}) { *a.(*int64) += *b.(*int64) }
+func (*count) Result(states []interface{}) Data {
+	res := &Int64s{Values: make([]int64, len(states))}
+	for i, state := range states {
+		res.Values[i] = *state.(*int64)
+	}
+	return res
+}
+func (a *count) Partial(states []interface{}) Data { return a.Result(states) }
+func (*count) PartialState(data Data, row int) interface{} {
+	v := data.(*Int64s).Values[row]
+	return &v
+}
+func (*count) Returns() Type { return Int64 }
+
+// numericState is the state of the aggregators of numeric values, of the
+// count of the values and their sums, as integers and as floats, for the sum
+// to be of Float64s once any of the values is
+type numericState struct {
+	Ints   int64
+	Floats float64
+	Float  bool // any of the values is of Float64s
+	N      int64
+}
+
+// add adds the row-th value of the data, unless it's null
+func (s *numericState) add(data Data, row int) error {
+	if c, ok := data.(*Constants); ok {
+		data, row = c.Value, 0
+	}
+
+	if data.IsNull(row) {
+		return nil
+	}
+
+	switch data := data.(type) {
+	case *Int64s:
+		s.Ints += data.Values[row]
+		s.Floats += float64(data.Values[row])
+	case *Float64s:
+		s.Floats += data.Values[row]
+		s.Float = true
+	default:
+		return fmt.Errorf("ep: can't aggregate %s, of neither int64 nor float64", data.Type())
+	}
+	s.N++
+	return nil
+}
+
+func (s *numericState) merge(other *numericState) {
+	s.Ints += other.Ints
+	s.Floats += other.Floats
+	s.Float = s.Float || other.Float
+	s.N += other.N
+}
+
+// partialNumeric returns the numeric states as Structs of their fields
+func partialNumeric(states []interface{}) Data {
+	ints, floats := &Int64s{Values: make([]int64, len(states))}, &Float64s{Values: make([]float64, len(states))}
+	isFloat, n := &Bools{Values: make([]bool, len(states))}, &Int64s{Values: make([]int64, len(states))}
+	for i, state := range states {
+		s := state.(*numericState)
+		ints.Values[i], floats.Values[i], isFloat.Values[i], n.Values[i] = s.Ints, s.Floats, s.Float, s.N
+	}
+	return NewStructs([]string{"ints", "floats", "float", "n"}, ints, floats, isFloat, n)
+}
+
+// partialNumericState returns the numeric state of the row-th row of a Data
+// returned by partialNumeric
+func partialNumericState(data Data, row int) interface{} {
+	s := data.(*Structs)
+	return &numericState{
+		Ints:   s.Fields[0].(*Int64s).Values[row],
+		Floats: s.Fields[1].(*Float64s).Values[row],
+		Float:  s.Fields[2].(*Bools).Values[row],
+		N:      s.Fields[3].(*Int64s).Values[row],
+	}
+}
+
+type sum struct{ Col int }
+
+func (*sum) InitState() interface{} { return &numericState{} }
+func (a *sum) Update(state interface{}, ds Dataset, row int) error {
+	return state.(*numericState).add(ds.At(a.Col), row)
+}
+func (*sum) Merge(a, b interface{}) { a.(*numericState).merge(b.(*numericState)) }
+func (*sum) Result(states []interface{}) Data {
+	isFloat := false
+	for _, state := range states {
+		isFloat = isFloat || state.(*numericState).Float
+	}
+
+	ints, floats := &Int64s{Values: make([]int64, len(states))}, &Float64s{Values: make([]float64, len(states))}
+	for i, state := range states {
+		s := state.(*numericState)
+		ints.Values[i], floats.Values[i] = s.Ints, s.Floats
+		if s.N == 0 {
+			ints.MarkNull(i)
+			floats.MarkNull(i)
+		}
+	}
+
+	if isFloat {
+		return floats
+	}
+	return ints
+}
+func (*sum) Partial(states []interface{}) Data           { return partialNumeric(states) }
+func (*sum) PartialState(data Data, row int) interface{} { return partialNumericState(data, row) }
+func (a *sum) Returns() Type                             { return Wildcard.At(a.Col) }
+
+type avg struct{ Col int }
+
+func (*avg) InitState() interface{} { return &numericState{} }
+func (a *avg) Update(state interface{}, ds Dataset, row int) error {
+	return state.(*numericState).add(ds.At(a.Col), row)
+}
+func (*avg) Merge(a, b interface{}) { a.(*numericState).merge(b.(*numericState)) }
+func (*avg) Result(states []interface{}) Data {
+	res := &Float64s{Values: make([]float64, len(states))}
+	for i, state := range states {
+		s := state.(*numericState)
+		if s.N == 0 {
+			res.MarkNull(i)
+		} else {
+			res.Values[i] = s.Floats / float64(s.N)
+		}
+	}
+	return res
+}
+func (*avg) Partial(states []interface{}) Data           { return partialNumeric(states) }
+func (*avg) PartialState(data Data, row int) interface{} { return partialNumericState(data, row) }
+func (*avg) Returns() Type                               { return Float64 }
+
+// minMaxState is the state of Min and Max, of the minimal or maximal value, as
+// a single row of its own, or nil before any value
+type minMaxState struct{ Value Data }
+
+type minMax struct {
+	Col int
+	Max bool
+}
+
+func (*minMax) InitState() interface{} { return &minMaxState{} }
+func (a *minMax) Update(state interface{}, ds Dataset, row int) error {
+	a.update(state.(*minMaxState), ds.At(a.Col), row)
+	return nil
+}
+func (a *minMax) Merge(x, y interface{}) {
+	if y := y.(*minMaxState); y.Value != nil {
+		a.update(x.(*minMaxState), y.Value, 0)
+	}
+}
+
+// update replaces the value of the state by the row-th value of the data, when
+// it's less, or greater for Max, and isn't null
+func (a *minMax) update(s *minMaxState, data Data, row int) {
+	if data.IsNull(row) {
+		return
+	} else if s.Value != nil {
+		c := Compare(data, row, s.Value, 0)
+		if (a.Max && c <= 0) || (!a.Max && c >= 0) {
+			return
+		}
+	}
+
+	if c, ok := data.(*Constants); ok {
+		data, row = c.Value, 0
+	}
+	if s.Value == nil {
+		s.Value = data.Type().Data(1)
+	}
+	s.Value.Copy(data, row, 0)
+}
+
+func (*minMax) Result(states []interface{}) Data {
+	var res Data
+	for i, state := range states {
+		if v := state.(*minMaxState).Value; v != nil {
+			if res == nil {
+				res = v.Type().Data(len(states))
+			}
+			res.Copy(v, 0, i)
+		}
+	}
+
+	if res == nil {
+		return Null.Data(len(states))
+	}
+	for i, state := range states {
+		if state.(*minMaxState).Value == nil {
+			res.MarkNull(i)
+		}
+	}
+	return res
+}
+func (a *minMax) Partial(states []interface{}) Data { return a.Result(states) }
+func (*minMax) PartialState(data Data, row int) interface{} {
+	if data.IsNull(row) {
+		return &minMaxState{}
+	}
+
+	v := data.Type().Data(1)
+	v.Copy(data, row, 0)
+	return &minMaxState{v}
+}
+func (a *minMax) Returns() Type { return Wildcard.At(a.Col) }
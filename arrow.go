@@ -0,0 +1,615 @@
+package ep
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// ArrowCodec is a Codec encoding every dataset as an Arrow IPC stream, of a
+// schema, a single record batch and the end of the stream, such that peers
+// that aren't written in Go can read and write them with any Arrow library.
+// Columns are named col0, col1, etc. See WriteArrow for the supported types
+var ArrowCodec Codec = arrowCodec{}
+
+// WriteArrow writes the dataset into the writer as an Arrow IPC stream, of a
+// schema, a single record batch and the end of the stream, as described in
+// https://arrow.apache.org/docs/format/Columnar.html. The fields of the schema
+// are named by the names, or col0, col1, etc., and nulls are marked in their
+// validity bitmaps.
+//
+// The built-in types are written as the Arrow types:
+//
+//	NULL         null
+//	int64        int64
+//	float64      double
+//	bool         bool
+//	dict_string  utf8
+//	bytes        binary
+//	timestamp    timestamp[ns, tz=UTC]
+//	date         date32[day]
+//
+// Other types fail, as do timestamps beyond the range of nanoseconds since
+// the epoch, between the years 1678 and 2261
+func WriteArrow(w io.Writer, ds Dataset, names []string) error {
+	fields := make([]fbTable, ds.Width())
+	cols := make([]*arrowColumn, ds.Width())
+	for i := range cols {
+		var err error
+		cols[i], err = newArrowColumn(ds.At(i))
+		if err != nil {
+			return fmt.Errorf("ep: column %d: %s", i, err)
+		}
+
+		name := "col" + strconv.Itoa(i)
+		if i < len(names) {
+			name = names[i]
+		}
+		fields[i] = fbTable{name, true, cols[i].TypeID, cols[i].Type, nil, []fbTable{}}
+	}
+
+	err := writeArrowMessage(w, arrowSchemaMessage, fbTable{nil, fields}, nil)
+	if err != nil {
+		return err
+	}
+
+	var nodes, buffers fbStructs
+	var body []byte
+	for _, col := range cols {
+		nodes = append(nodes, [2]int64{int64(ds.Len()), int64(col.NullCount)})
+		for _, buf := range col.Buffers {
+			buffers = append(buffers, [2]int64{int64(len(body)), int64(len(buf))})
+			body = append(body, buf...)
+			for len(body)%8 != 0 {
+				body = append(body, 0)
+			}
+		}
+	}
+
+	batch := fbTable{int64(ds.Len()), nodes, buffers}
+	err = writeArrowMessage(w, arrowRecordBatchMessage, batch, body)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(arrowEndOfStream)
+	return err
+}
+
+// ReadArrow reads an Arrow IPC stream from the reader, and returns the dataset
+// of all of its record batches, and the names of its fields. It supports the
+// types written by WriteArrow, as well as smaller integers and floats, other
+// units of timestamps and date64. Timestamps are read in UTC. Other types,
+// dictionary-encoded fields and compressed batches fail
+func ReadArrow(r io.Reader) (Dataset, []string, error) {
+	ds, names, err := readArrow(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return ds, names, err
+}
+
+// readArrow is similar to ReadArrow, except that it returns io.EOF when the
+// stream ends before it starts
+func readArrow(r io.Reader) (ds Dataset, names []string, err error) {
+	defer func() {
+		if e, ok := recover().(runtime.Error); ok {
+			ds, names, err = nil, nil, fmt.Errorf("ep: malformed arrow stream: %s", e)
+		} else if e != nil {
+			panic(e)
+		}
+	}()
+
+	kind, schema, _, err := readArrowMessage(r)
+	if err != nil {
+		return nil, nil, err
+	} else if kind != arrowSchemaMessage {
+		return nil, nil, fmt.Errorf("ep: expected an arrow schema, got message %d", kind)
+	}
+
+	fields := schema.tables(1)
+	names = make([]string, len(fields))
+	types := make([]Type, len(fields))
+	for i, field := range fields {
+		names[i] = field.string(0)
+		if field.has(4) {
+			return nil, nil, fmt.Errorf("ep: field %q: dictionary-encoded arrow fields aren't supported", names[i])
+		}
+
+		types[i], err = arrowType(field.uint8(2, 0), field.table(3))
+		if err != nil {
+			return nil, nil, fmt.Errorf("ep: field %q: %s", names[i], err)
+		}
+	}
+
+	var batches []Dataset
+	for {
+		kind, batch, body, err := readArrowMessage(r)
+		if err == io.EOF || err == nil && kind == arrowEndOfStreamMessage {
+			break // the end of the stream is optional
+		} else if err != nil {
+			return nil, nil, err
+		} else if kind != arrowRecordBatchMessage {
+			return nil, nil, fmt.Errorf("ep: unsupported arrow message %d", kind)
+		} else if batch.has(3) {
+			return nil, nil, fmt.Errorf("ep: compressed arrow record batches aren't supported")
+		}
+
+		data, err := readArrowBatch(fields, types, batch, body)
+		if err != nil {
+			return nil, nil, err
+		}
+		batches = append(batches, data)
+	}
+
+	if len(batches) > 0 {
+		ds = ConcatDatasets(batches...)
+	} else {
+		cols := make([]Data, len(types))
+		for i, t := range types {
+			cols[i] = t.Data(0)
+		}
+		ds = NewDataset(cols...)
+	}
+	return ds, names, nil
+}
+
+// readArrowBatch returns the dataset of the record batch
+func readArrowBatch(fields []fbReader, types []Type, batch fbReader, body []byte) (Dataset, error) {
+	n := int(batch.int64(0, 0))
+	nodes, buffers := batch.structs(1), batch.structs(2)
+	if len(nodes) != len(fields) {
+		return nil, fmt.Errorf("ep: arrow record batch of %d fields, expected %d", len(nodes), len(fields))
+	}
+
+	cols := make([]Data, len(fields))
+	for i, field := range fields {
+		if int(nodes[i][0]) != n {
+			return nil, fmt.Errorf("ep: field %q has %d rows, expected %d", field.string(0), nodes[i][0], n)
+		}
+
+		col := &arrowColumn{TypeID: field.uint8(2, 0), NullCount: int(nodes[i][1])}
+		for j := 0; j < arrowBufferCount(col.TypeID); j++ {
+			if len(buffers) == 0 {
+				return nil, fmt.Errorf("ep: field %q is missing buffers", field.string(0))
+			}
+			off, size := buffers[0][0], buffers[0][1]
+			col.Buffers = append(col.Buffers, body[off:off+size])
+			buffers = buffers[1:]
+		}
+
+		cols[i] = col.data(types[i], field.table(3), n)
+	}
+	return NewDataset(cols...), nil
+}
+
+// kinds of Arrow IPC messages, as in their MessageHeader union
+const (
+	arrowEndOfStreamMessage = 0
+	arrowSchemaMessage      = 1
+	arrowRecordBatchMessage = 3
+)
+
+// the ids of the Arrow types, as in their Type union
+const (
+	arrowNull      = 1
+	arrowInt       = 2
+	arrowFloat     = 3
+	arrowBinary    = 4
+	arrowUtf8      = 5
+	arrowBool      = 6
+	arrowDate      = 8
+	arrowTimestamp = 10
+)
+
+// units of the Date and Timestamp types of Arrow
+const (
+	arrowDay         = 0
+	arrowMillisecond = 1
+
+	arrowSecond      = 0
+	arrowMicrosecond = 2
+	arrowNanosecond  = 3
+)
+
+const (
+	arrowContinuation = 0xFFFFFFFF
+	arrowMetadataV5   = 4
+)
+
+var arrowEndOfStream = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0}
+
+// writeArrowMessage writes an encapsulated message of the header, followed by
+// its body, which is padded to 8 bytes
+func writeArrowMessage(w io.Writer, kind uint8, header fbTable, body []byte) error {
+	meta := buildFlatbuffer(fbTable{int16(arrowMetadataV5), kind, header, int64(len(body))})
+	for len(meta)%8 != 0 {
+		meta = append(meta, 0)
+	}
+
+	prefix := make([]byte, 8)
+	binary.LittleEndian.PutUint32(prefix, arrowContinuation)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)))
+	for _, b := range [][]byte{prefix, meta, body} {
+		_, err := w.Write(b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readArrowMessage reads an encapsulated message, and returns its kind,
+// header and body. Messages without the continuation marker, of streams
+// before Arrow 0.15, are supported as well
+func readArrowMessage(r io.Reader) (uint8, fbReader, []byte, error) {
+	prefix := make([]byte, 4)
+	_, err := io.ReadFull(r, prefix)
+	if err != nil {
+		return 0, fbReader{}, nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(prefix)
+	if size == arrowContinuation {
+		_, err = io.ReadFull(r, prefix)
+		if err != nil {
+			return 0, fbReader{}, nil, unexpectedEOF(err)
+		}
+		size = binary.LittleEndian.Uint32(prefix)
+	}
+
+	if size == 0 {
+		return arrowEndOfStreamMessage, fbReader{}, nil, nil
+	}
+
+	meta := make([]byte, size)
+	_, err = io.ReadFull(r, meta)
+	if err != nil {
+		return 0, fbReader{}, nil, unexpectedEOF(err)
+	}
+
+	msg := fbRoot(meta)
+	body := make([]byte, msg.int64(3, 0))
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return 0, fbReader{}, nil, unexpectedEOF(err)
+	}
+	return msg.uint8(1, 0), msg.table(2), body, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// arrowType returns the Type of the Data of the Arrow type
+func arrowType(id uint8, t fbReader) (Type, error) {
+	switch id {
+	case arrowNull:
+		return Null, nil
+	case arrowInt:
+		bits := t.int32(0, 0)
+		if bits != 8 && bits != 16 && bits != 32 && bits != 64 || bits == 64 && !t.bool(1) {
+			return nil, fmt.Errorf("unsupported arrow integer of %d bits", bits)
+		}
+		return Int64, nil
+	case arrowFloat:
+		if t.int16(0, 0) == 0 {
+			return nil, fmt.Errorf("unsupported arrow half float")
+		}
+		return Float64, nil
+	case arrowBinary:
+		return Bytes, nil
+	case arrowUtf8:
+		return DictString, nil
+	case arrowBool:
+		return Bool, nil
+	case arrowDate:
+		return Date, nil
+	case arrowTimestamp:
+		return Timestamp, nil
+	}
+	return nil, fmt.Errorf("unsupported arrow type %d", id)
+}
+
+// arrowBufferCount returns the number of buffers of the Arrow type
+func arrowBufferCount(id uint8) int {
+	switch id {
+	case arrowNull:
+		return 0
+	case arrowBinary, arrowUtf8:
+		return 3 // validity, offsets and values
+	}
+	return 2 // validity and values
+}
+
+// arrowColumn is the layout of a column in Arrow: the id and table of its
+// type, and its buffers, starting with the validity bitmap
+type arrowColumn struct {
+	TypeID    uint8
+	Type      fbTable
+	NullCount int
+	Buffers   [][]byte
+}
+
+// newArrowColumn returns the Arrow layout of the data
+func newArrowColumn(data Data) (*arrowColumn, error) {
+	if c, ok := data.(*Constants); ok {
+		data = c.Materialize()
+	}
+
+	n := data.Len()
+	col := &arrowColumn{}
+	if _, ok := data.(nulls); !ok {
+		col.Buffers = [][]byte{arrowValidity(data, &col.NullCount)}
+	}
+
+	switch data := data.(type) {
+	case nulls:
+		col.TypeID, col.Type, col.NullCount = arrowNull, fbTable{}, n
+	case *Int64s:
+		col.TypeID, col.Type = arrowInt, fbTable{int32(64), true}
+		col.Buffers = append(col.Buffers, arrowInt64s(n, func(i int) int64 { return data.Values[i] }))
+	case *Float64s:
+		col.TypeID, col.Type = arrowFloat, fbTable{int16(2)} // double
+		col.Buffers = append(col.Buffers, arrowInt64s(n, func(i int) int64 {
+			return int64(math.Float64bits(data.Values[i]))
+		}))
+	case *Bools:
+		col.TypeID, col.Type = arrowBool, fbTable{}
+		col.Buffers = append(col.Buffers, arrowBitmap(n, func(i int) bool { return data.Values[i] }))
+	case *DictStrings:
+		col.TypeID, col.Type = arrowUtf8, fbTable{}
+		offsets, values, err := arrowBinaryValues(n, func(i int) []byte {
+			if data.IsNull(i) {
+				return nil
+			}
+			return []byte(data.value(i))
+		})
+		if err != nil {
+			return nil, err
+		}
+		col.Buffers = append(col.Buffers, offsets, values)
+	case *Blobs:
+		col.TypeID, col.Type = arrowBinary, fbTable{}
+		offsets, values, err := arrowBinaryValues(n, func(i int) []byte { return data.Values[i] })
+		if err != nil {
+			return nil, err
+		}
+		col.Buffers = append(col.Buffers, offsets, values)
+	case *Timestamps:
+		for i, v := range data.Values {
+			if !data.IsNull(i) && (v.Before(minArrowTimestamp) || v.After(maxArrowTimestamp)) {
+				return nil, fmt.Errorf("row %d: timestamp %s is out of the range of arrow nanoseconds", i, v.Format(time.RFC3339Nano))
+			}
+		}
+
+		col.TypeID, col.Type = arrowTimestamp, fbTable{int16(arrowNanosecond), "UTC"}
+		col.Buffers = append(col.Buffers, arrowInt64s(n, func(i int) int64 {
+			if data.IsNull(i) {
+				return 0
+			}
+			return data.Values[i].UnixNano()
+		}))
+	case *Dates:
+		col.TypeID, col.Type = arrowDate, fbTable{int16(arrowDay)}
+		values := make([]byte, 4*n)
+		for i, v := range data.Values {
+			if !data.IsNull(i) {
+				y, m, d := v.Date()
+				days := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+				binary.LittleEndian.PutUint32(values[4*i:], uint32(int32(days)))
+			}
+		}
+		col.Buffers = append(col.Buffers, values)
+	default:
+		return nil, fmt.Errorf("arrow doesn't support %s", data.Type())
+	}
+	return col, nil
+}
+
+var (
+	minArrowTimestamp = time.Unix(0, math.MinInt64)
+	maxArrowTimestamp = time.Unix(0, math.MaxInt64)
+)
+
+// arrowValidity returns the validity bitmap of the data, or an empty bitmap
+// when it has no nulls, and counts its nulls
+func arrowValidity(data Data, nullCount *int) []byte {
+	for i := 0; i < data.Len(); i++ {
+		if data.IsNull(i) {
+			*nullCount++
+		}
+	}
+
+	if *nullCount == 0 {
+		return nil
+	}
+	return arrowBitmap(data.Len(), func(i int) bool { return !data.IsNull(i) })
+}
+
+// arrowBitmap returns the bitmap of n bits, least significant first
+func arrowBitmap(n int, bit func(int) bool) []byte {
+	res := make([]byte, (n+7)/8)
+	for i := 0; i < n; i++ {
+		if bit(i) {
+			res[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return res
+}
+
+func arrowInt64s(n int, value func(int) int64) []byte {
+	res := make([]byte, 8*n)
+	for i := 0; i < n; i++ {
+		binary.LittleEndian.PutUint64(res[8*i:], uint64(value(i)))
+	}
+	return res
+}
+
+// arrowBinaryValues returns the 32-bit offsets, and the concatenated values,
+// of the n values
+func arrowBinaryValues(n int, value func(int) []byte) ([]byte, []byte, error) {
+	offsets := make([]byte, 4*(n+1))
+	var values []byte
+	for i := 0; i < n; i++ {
+		values = append(values, value(i)...)
+		if len(values) > math.MaxInt32 {
+			return nil, nil, fmt.Errorf("values of more than %d bytes", math.MaxInt32)
+		}
+		binary.LittleEndian.PutUint32(offsets[4*(i+1):], uint32(len(values)))
+	}
+	return offsets, values, nil
+}
+
+// data returns the Data of the n values of the column, of the type, as
+// returned by arrowType
+func (col *arrowColumn) data(t Type, typ fbReader, n int) Data {
+	if t == Null {
+		return Null.Data(n)
+	}
+
+	var nulls NullMask
+	if validity := col.Buffers[0]; col.NullCount > 0 && len(validity) > 0 {
+		for i := 0; i < n; i++ {
+			if validity[i/8]&(1<<uint(i%8)) == 0 {
+				nulls.Set(i, true)
+			}
+		}
+	}
+
+	values := col.Buffers[1]
+	switch col.TypeID {
+	case arrowInt:
+		bits, signed := typ.int32(0, 0), typ.bool(1)
+		res := &Int64s{Values: make([]int64, n), Null: nulls}
+		for i := range res.Values {
+			res.Values[i] = arrowIntValue(values, i, bits, signed)
+		}
+		return res
+	case arrowFloat:
+		res := &Float64s{Values: make([]float64, n), Null: nulls}
+		for i := range res.Values {
+			if typ.int16(0, 0) == 1 { // single
+				res.Values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(values[4*i:])))
+			} else {
+				res.Values[i] = math.Float64frombits(binary.LittleEndian.Uint64(values[8*i:]))
+			}
+		}
+		return res
+	case arrowBool:
+		res := &Bools{Values: make([]bool, n), Null: nulls}
+		for i := range res.Values {
+			res.Values[i] = values[i/8]&(1<<uint(i%8)) != 0
+		}
+		return res
+	case arrowUtf8:
+		strs := make([]string, n)
+		for i := range strs {
+			strs[i] = string(arrowBinaryValue(values, col.Buffers[2], i))
+		}
+		res := EncodeDict(strs)
+		res.Null = nulls
+		return res
+	case arrowBinary:
+		res := &Blobs{Values: make([][]byte, n), Null: nulls}
+		for i := range res.Values {
+			res.Values[i] = append([]byte{}, arrowBinaryValue(values, col.Buffers[2], i)...)
+		}
+		return res
+	case arrowDate:
+		res := &Dates{Values: make([]time.Time, n), Null: nulls}
+		for i := range res.Values {
+			if typ.int16(0, arrowMillisecond) == arrowDay {
+				days := int64(int32(binary.LittleEndian.Uint32(values[4*i:])))
+				res.Values[i] = time.Unix(days*86400, 0).UTC()
+			} else {
+				ms := int64(binary.LittleEndian.Uint64(values[8*i:]))
+				y, m, d := time.UnixMilli(ms).UTC().Date()
+				res.Values[i] = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+			}
+		}
+		return res
+	}
+
+	// timestamps
+	res := &Timestamps{Values: make([]time.Time, n), Null: nulls}
+	for i := range res.Values {
+		v := int64(binary.LittleEndian.Uint64(values[8*i:]))
+		switch typ.int16(0, arrowSecond) {
+		case arrowSecond:
+			res.Values[i] = time.Unix(v, 0).UTC()
+		case arrowMillisecond:
+			res.Values[i] = time.UnixMilli(v).UTC()
+		case arrowMicrosecond:
+			res.Values[i] = time.UnixMicro(v).UTC()
+		default:
+			res.Values[i] = time.Unix(0, v).UTC()
+		}
+	}
+	return res
+}
+
+// arrowIntValue returns the i-th integer of the values of the bits
+func arrowIntValue(values []byte, i int, bits int32, signed bool) int64 {
+	switch bits {
+	case 8:
+		if signed {
+			return int64(int8(values[i]))
+		}
+		return int64(values[i])
+	case 16:
+		v := binary.LittleEndian.Uint16(values[2*i:])
+		if signed {
+			return int64(int16(v))
+		}
+		return int64(v)
+	case 32:
+		v := binary.LittleEndian.Uint32(values[4*i:])
+		if signed {
+			return int64(int32(v))
+		}
+		return int64(v)
+	}
+	return int64(binary.LittleEndian.Uint64(values[8*i:]))
+}
+
+// arrowBinaryValue returns the i-th value of the 32-bit offsets into the
+// values
+func arrowBinaryValue(offsets, values []byte, i int) []byte {
+	start := binary.LittleEndian.Uint32(offsets[4*i:])
+	end := binary.LittleEndian.Uint32(offsets[4*(i+1):])
+	return values[start:end]
+}
+
+type arrowCodec struct{}
+
+func (arrowCodec) NewEncoder(w io.Writer) Encoder { return arrowEncoder{w} }
+func (arrowCodec) NewDecoder(r io.Reader) Decoder {
+	if _, ok := r.(byteReader); !ok {
+		r = bufio.NewReader(r)
+	}
+	return arrowDecoder{r}
+}
+
+type arrowEncoder struct{ w io.Writer }
+
+func (e arrowEncoder) Encode(data Dataset) error { return WriteArrow(e.w, data, nil) }
+
+type arrowDecoder struct{ r io.Reader }
+
+func (d arrowDecoder) Decode(data *Dataset) error {
+	res, _, err := readArrow(d.r)
+	if err != nil {
+		return err
+	}
+	*data = res
+	return nil
+}
@@ -0,0 +1,132 @@
+package ep
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// arrowGolden are the datasets of the Arrow IPC streams in testdata/arrow,
+// written by pyarrow with generate.py, by their file names, along with the
+// names of their fields
+var arrowGolden = map[string]struct {
+	Names []string
+	Data  Dataset
+}{
+	"types": {
+		[]string{"null", "int64", "double", "bool", "utf8", "binary", "timestamp", "date32"},
+		NewDataset(
+			Null.Data(3),
+			&Int64s{Values: []int64{1, 0, -3}, Null: NullMask{2}},
+			&Float64s{Values: []float64{1.5, 0, -0.25}, Null: NullMask{2}},
+			&Bools{Values: []bool{true, false, false}, Null: NullMask{2}},
+			func() Data {
+				data := EncodeDict([]string{"a", "", "héllo, wörld"})
+				data.MarkNull(1)
+				return data
+			}(),
+			&Blobs{Values: [][]byte{{0, 1, 2}, {}, {}}, Null: NullMask{2}},
+			&Timestamps{Values: []time.Time{time.Unix(0, 1577934245000000006).UTC(), {}, time.Unix(0, 0).UTC()}, Null: NullMask{2}},
+			&Dates{Values: []time.Time{time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), {}, time.Unix(0, 0).UTC()}, Null: NullMask{2}},
+		),
+	},
+	"no_nulls": {
+		[]string{"int64", "bool", "utf8"},
+		NewDataset(
+			&Int64s{Values: []int64{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+			&Bools{Values: []bool{true, false, true, true, false, false, true, false, true}},
+			EncodeDict([]string{"", "a", "bc", "", "def", "g", "", "hi", "j"}),
+		),
+	},
+	"empty": {
+		[]string{"int64", "utf8"},
+		NewDataset(Int64.Data(0), DictString.Data(0)),
+	},
+}
+
+// readArrowGolden returns the golden stream of the name, or skips the test
+// when it wasn't generated
+func readArrowGolden(t *testing.T, name string) []byte {
+	path := filepath.Join("testdata", "arrow", name+".arrows")
+	stream, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Skipf("%s is generated by testdata/arrow/generate.py, with pyarrow", path)
+	}
+	require.NoError(t, err)
+	return stream
+}
+
+func TestReadArrow_golden(t *testing.T) {
+	for name, golden := range arrowGolden {
+		t.Run(name, func(t *testing.T) {
+			res, names, err := ReadArrow(bytes.NewReader(readArrowGolden(t, name)))
+			require.NoError(t, err)
+			require.Equal(t, golden.Names, names)
+			require.Equal(t, golden.Data.Width(), res.Width())
+			require.Equal(t, golden.Data.Len(), res.Len())
+			for i := 0; i < res.Width(); i++ {
+				expected := golden.Data.At(i)
+				require.Equal(t, expected.Type(), res.At(i).Type(), names[i])
+				require.Equal(t, expected.Strings(), res.At(i).Strings(), names[i])
+				require.Equal(t, expected.Nulls(), res.At(i).Nulls(), names[i])
+			}
+		})
+	}
+}
+
+// the messages written are the same as the ones of pyarrow, except for the
+// layout of their flatbuffers: the same fields of the schema, and the same
+// nodes and contents of the buffers of the record batch
+func TestWriteArrow_golden(t *testing.T) {
+	for name, golden := range arrowGolden {
+		t.Run(name, func(t *testing.T) {
+			expected := readArrowGolden(t, name)
+
+			var buf bytes.Buffer
+			require.NoError(t, WriteArrow(&buf, golden.Data, golden.Names))
+			require.Equal(t, arrowMessages(t, expected), arrowMessages(t, buf.Bytes()))
+		})
+	}
+}
+
+// arrowMessages returns the contents of the messages of the stream, which are
+// independent of the layout of their flatbuffers and of the padding of their
+// bodies
+func arrowMessages(t *testing.T, stream []byte) (res []interface{}) {
+	r := bytes.NewReader(stream)
+	for r.Len() > 0 {
+		kind, header, body, err := readArrowMessage(r)
+		require.NoError(t, err)
+
+		switch kind {
+		case arrowSchemaMessage:
+			var fields []interface{}
+			for _, field := range header.tables(1) {
+				id, typ := field.uint8(2, 0), field.table(3)
+				f := []interface{}{field.string(0), field.bool(1), id}
+				switch id {
+				case arrowInt:
+					f = append(f, typ.int32(0, 0), typ.bool(1))
+				case arrowFloat, arrowDate:
+					f = append(f, typ.int16(0, 0))
+				case arrowTimestamp:
+					f = append(f, typ.int16(0, 0), typ.string(1))
+				}
+				fields = append(fields, f)
+			}
+			res = append(res, kind, fields)
+		case arrowRecordBatchMessage:
+			var buffers [][]byte
+			for _, b := range header.structs(2) {
+				buffers = append(buffers, body[b[0]:b[0]+b[1]])
+			}
+			res = append(res, kind, header.int64(0, 0), header.structs(1), buffers)
+		default:
+			res = append(res, kind)
+		}
+	}
+	return res
+}
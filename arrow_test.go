@@ -0,0 +1,138 @@
+package ep_test
+
+import (
+	"bytes"
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWriteArrow_roundTrip(t *testing.T) {
+	for name, newFn := range newData {
+		if name == "strs" || name == "Decimals" || name == "SliceData" || name == "Lists" || name == "Structs" {
+			continue // not supported
+		}
+
+		t.Run(name, func(t *testing.T) {
+			data := newFn()
+			data.MarkNull(1)
+			ds := ep.NewDataset(data, ep.Null.Data(data.Len()), newFn())
+
+			var buf bytes.Buffer
+			require.NoError(t, ep.WriteArrow(&buf, ds, []string{"a"}))
+			require.Equal(t, 0, buf.Len()%8, "messages are aligned")
+			require.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0xFF}, buf.Bytes()[:4])
+			require.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0}, buf.Bytes()[buf.Len()-8:])
+
+			res, names, err := ep.ReadArrow(&buf)
+			require.NoError(t, err)
+			require.Equal(t, []string{"a", "col1", "col2"}, names)
+			require.Equal(t, 3, res.Width())
+			for i := 0; i < res.Width(); i++ {
+				require.Equal(t, ds.At(i).Type(), res.At(i).Type())
+				require.Equal(t, ds.At(i).Strings(), res.At(i).Strings())
+				require.Equal(t, ds.At(i).Nulls(), res.At(i).Nulls())
+			}
+		})
+	}
+}
+
+func TestWriteArrow_values(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 6, time.FixedZone("", 3600))
+	ds := ep.NewDataset(
+		&ep.Timestamps{Values: []time.Time{ts, {}}, Null: ep.NullMask{2}},
+		ep.EncodeDict([]string{"", "héllo, wörld"}),
+		&ep.Blobs{Values: [][]byte{nil, {0, 1, 2}}},
+	)
+
+	var buf bytes.Buffer
+	require.NoError(t, ep.WriteArrow(&buf, ds, nil))
+	res, _, err := ep.ReadArrow(&buf)
+	require.NoError(t, err)
+
+	// timestamps are read in UTC
+	require.True(t, ts.Equal(res.At(0).(*ep.Timestamps).Values[0]))
+	require.Equal(t, []string{"2020-01-02T02:04:05.000000006Z", ""}, res.At(0).Strings())
+	require.Equal(t, []bool{false, true}, res.At(0).Nulls())
+
+	// empty values aren't nulls
+	require.Equal(t, []string{"", "héllo, wörld"}, res.At(1).Strings())
+	require.Equal(t, []bool{false, false}, res.At(1).Nulls())
+	require.Equal(t, [][]byte{{}, {0, 1, 2}}, res.At(2).(*ep.Blobs).Values)
+
+	// without any columns
+	buf.Reset()
+	require.NoError(t, ep.WriteArrow(&buf, ep.NewDataset(), nil))
+	res, names, err := ep.ReadArrow(&buf)
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Width())
+	require.Equal(t, []string{}, names)
+}
+
+func TestWriteArrow_unsupported(t *testing.T) {
+	dec, err := ep.ParseDecimals(10, 2, []string{"1.5"})
+	require.NoError(t, err)
+
+	err = ep.WriteArrow(io.Discard, ep.NewDataset(ep.Null.Data(1), dec), nil)
+	require.Error(t, err)
+	require.Equal(t, "ep: column 1: arrow doesn't support decimal(10,2)", err.Error())
+
+	ts := &ep.Timestamps{Values: []time.Time{time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	err = ep.WriteArrow(io.Discard, ep.NewDataset(ts), nil)
+	require.Error(t, err)
+	require.Equal(t, "ep: column 0: row 0: timestamp 2300-01-01T00:00:00Z is out of the range of arrow nanoseconds", err.Error())
+
+	// nulls aren't out of range
+	ts.MarkNull(0)
+	require.NoError(t, ep.WriteArrow(io.Discard, ep.NewDataset(ts), nil))
+}
+
+func TestReadArrow_malformed(t *testing.T) {
+	var buf bytes.Buffer
+	ds := ep.NewDataset(&ep.Int64s{Values: []int64{1, 2, 3}})
+	require.NoError(t, ep.WriteArrow(&buf, ds, nil))
+	stream := buf.Bytes()
+
+	_, _, err := ep.ReadArrow(bytes.NewReader(stream[:len(stream)/2]))
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, _, err = ep.ReadArrow(bytes.NewReader(nil))
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// the end of the stream is optional
+	res, _, err := ep.ReadArrow(bytes.NewReader(stream[:len(stream)-8]))
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2", "3"}, res.At(0).Strings())
+
+	// metadata pointing outside of itself
+	corrupt := append([]byte{}, stream...)
+	corrupt[8] = 0xF0
+	_, _, err = ep.ReadArrow(bytes.NewReader(corrupt))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "ep: malformed arrow stream: ")
+}
+
+func TestArrowCodec(t *testing.T) {
+	data := ep.NewDataset(&ep.Int64s{Values: []int64{1, 2}, Null: ep.NullMask{1}}, ep.EncodeDict([]string{"a", "b"}))
+	buf := &bytes.Buffer{}
+	enc := ep.ArrowCodec.NewEncoder(buf)
+	require.NoError(t, enc.Encode(data))
+	require.NoError(t, enc.Encode(data.Slice(1, 2).(ep.Dataset)))
+
+	// every dataset is a whole stream
+	var res ep.Dataset
+	dec := ep.ArrowCodec.NewDecoder(buf)
+	require.NoError(t, dec.Decode(&res))
+	require.Equal(t, []string{"", "2"}, res.At(0).Strings())
+	require.Equal(t, []string{"a", "b"}, res.At(1).Strings())
+
+	require.NoError(t, dec.Decode(&res))
+	require.Equal(t, []string{"b"}, res.At(1).Strings())
+	require.Equal(t, io.EOF, dec.Decode(&res))
+
+	err := ep.ArrowCodec.NewEncoder(io.Discard).Encode(ep.NewDataset(strs{"a"}))
+	require.Error(t, err)
+	require.Equal(t, "ep: column 0: arrow doesn't support string", err.Error())
+}
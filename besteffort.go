@@ -0,0 +1,78 @@
+package ep
+
+// BestEffort sets an exchange Runner, returned by Broadcast or AllGather, to
+// keep going when some of its peers fail, instead of failing the whole
+// exchange: failed destinations are skipped by the following sends, and failed
+// sources are removed as if they've completed. The exchange only fails once
+// all of its peers have failed, or when a peer fails with an error of its own.
+// The skipped peers are returned from SkippedPeers
+func BestEffort(r Runner) Runner {
+	ex, ok := r.(*exchange)
+	if !ok || (ex.Type != broadcast && ex.Type != allGather) {
+		panic("ep: BestEffort expects a broadcast exchange")
+	}
+
+	ex.BestEffort = true
+	return ex
+}
+
+// SkippedPeers returns the errors of all of the peers that were skipped by an
+// exchange Runner, by their node address: the destinations that failed when
+// BestEffort, and the sources removed due to errors, e.g. dead peers with
+// SkipDeadPeers. It should be called once Run has returned
+func SkippedPeers(r Runner) map[string]error {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: SkippedPeers expects an exchange")
+	}
+
+	res := ex.deadPeers()
+	for addr, err := range ex.skipped {
+		if res[addr] == nil {
+			res[addr] = err
+		}
+	}
+	return res
+}
+
+// tolerate returns the errors of encoding to failed destinations, unless best
+// effort and at least one of the peers is still alive. When resilient, this
+// node is a live destination as well, as it receives the datasets resent from
+// the failed peers
+func (ex *exchange) tolerate(errs encodeErrors) error {
+	if len(errs) == 0 {
+		return nil
+	} else if !ex.BestEffort && !ex.Resilient {
+		return errs
+	}
+
+	for _, enc := range ex.encs {
+		if ex.dead[enc] == nil && (ex.Resilient || ex.addrOf(enc) != ex.thisNode) {
+			return nil
+		}
+	}
+
+	// all of the peers have failed, including the ones that failed before
+	return encodeErrors(ex.deadPeers())
+}
+
+// skipSource records a source connection that's removed due to an error
+func (ex *exchange) skipSource(dec decoder, err error) {
+	if ex.skipped == nil {
+		ex.skipped = map[string]error{}
+	}
+	ex.skipped[sourceAddr(dec)] = err
+}
+
+// sourceAddr returns the node address of a source decoder
+func sourceAddr(dec decoder) string {
+	switch d := dec.(type) {
+	case *statsDecoder:
+		return sourceAddr(d.decoder)
+	case *ackingDecoder:
+		return sourceAddr(d.decoder)
+	case dbgDecoder:
+		return d.addr
+	}
+	return "unknown" // shouldn't happen, the loopback never fails
+}
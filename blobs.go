@@ -0,0 +1,199 @@
+package ep
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+)
+
+// Bytes is the built-in Type of columns of binary payloads, backed by the
+// Blobs Data implementation
+var Bytes = &bytesType{}
+
+var _ = Types.Register("bytes", Bytes)
+
+type bytesType struct{}
+
+func (t *bytesType) String() string     { return t.Name() }
+func (*bytesType) Name() string         { return "bytes" }
+func (*bytesType) Data(n int) Data      { return &Blobs{Values: make([][]byte, n)} }
+func (*bytesType) DataEmpty(n int) Data { return &Blobs{Values: make([][]byte, 0, n)} }
+
+// Blobs is the Data of the Bytes type. Values are compared lexicographically,
+// byte by byte, and their Strings are hex-encoded. Nulls sort after all values.
+//
+// Unlike Slice, which shares the values, Append, Duplicate and Copy copy them,
+// such that a Clone can be modified without affecting the original
+type Blobs struct {
+	Values [][]byte
+	Null   NullMask
+}
+
+// Type returns the Bytes type
+func (*Blobs) Type() Type { return Bytes }
+
+// Len returns the number of values
+func (vs *Blobs) Len() int { return len(vs.Values) }
+
+// Less reports whether the i-th value sorts before the j-th one
+func (vs *Blobs) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+
+// Swap swaps the i-th and the j-th values, along with their nulls
+func (vs *Blobs) Swap(i, j int) {
+	vs.Values[i], vs.Values[j] = vs.Values[j], vs.Values[i]
+	vs.Null.Swap(i, j)
+}
+
+// LessOther reports whether the thisRow-th value sorts before the
+// otherRow-th value of the other data
+func (vs *Blobs) LessOther(thisRow int, other Data, otherRow int) bool {
+	return vs.Compare(thisRow, other, otherRow) < 0
+}
+
+// Compare compares the thisRow-th value to the otherRow-th value of the
+// other data, see Comparable
+func (vs *Blobs) Compare(thisRow int, other Data, otherRow int) int {
+	data := other.(*Blobs)
+	if c, ok := compareNulls(vs.IsNull(thisRow), data.IsNull(otherRow)); ok {
+		return c
+	}
+	return bytes.Compare(vs.Values[thisRow], data.Values[otherRow])
+}
+
+// Hash hashes the row-th value, see Hashable
+func (vs *Blobs) Hash(row int, h hash.Hash64) { hashBytes(h, vs.Values[row]) }
+
+// Slice returns the values from the start to the end indices
+func (vs *Blobs) Slice(s, e int) Data {
+	return &Blobs{vs.Values[s:e], vs.Null.Slice(s, e)}
+}
+
+// Append returns the values followed by the ones of the other data
+func (vs *Blobs) Append(other Data) Data {
+	data := other.(*Blobs)
+	return &Blobs{copyBlobs(vs.Values, data.Values), vs.Null.Append(vs.Len(), data.Null)}
+}
+
+// AppendAll returns the values followed by the ones of all of the others,
+// allocated at once, see Concatenator
+func (vs *Blobs) AppendAll(others ...Data) Data {
+	values, nulls := appendAll(vs, others, func(data Data) ([][]byte, NullMask) {
+		return data.(*Blobs).Values, data.(*Blobs).Null
+	})
+	return &Blobs{copyBlobs(values), nulls}
+}
+
+// Duplicate returns the values repeated t times
+func (vs *Blobs) Duplicate(t int) Data {
+	values := make([][][]byte, t)
+	for i := range values {
+		values[i] = vs.Values
+	}
+	return &Blobs{copyBlobs(values...), vs.Null.Duplicate(vs.Len(), t)}
+}
+
+// IsNull reports whether the i-th value is null
+func (vs *Blobs) IsNull(i int) bool { return vs.Null.Get(i) }
+
+// MarkNull marks the i-th value as null
+func (vs *Blobs) MarkNull(i int) { vs.Null.Set(i, true) }
+
+// Nulls reports whether each one of the values is null
+func (vs *Blobs) Nulls() []bool { return vs.Null.Nulls(vs.Len()) }
+
+// Equal reports whether the other data has the same values, as with
+// DataEqual
+func (vs *Blobs) Equal(other Data) bool { return DataEqual(vs, other) }
+
+// Same reports whether the other data shares the values, see Sharer
+func (vs *Blobs) Same(other Data) bool {
+	data, ok := other.(*Blobs)
+	return ok && (vs == data || vs.Len() > 0 && data.Len() > 0 && &vs.Values[0] == &data.Values[0])
+}
+
+// Copy copies the fromRow-th value of the other data to the toRow-th value
+func (vs *Blobs) Copy(from Data, fromRow, toRow int) {
+	src := from.(*Blobs)
+	vs.Values[toRow] = append([]byte(nil), src.Values[fromRow]...)
+	vs.Null.Copy(src.Null, fromRow, toRow)
+}
+
+// Clone copies the bytes of the values into a single buffer, as with Append
+func (vs *Blobs) Clone() Data {
+	return &Blobs{copyBlobs(vs.Values), vs.Null.Slice(0, vs.Len())}
+}
+
+// Size returns the number of bytes of the values, see Sized
+func (vs *Blobs) Size() uint64 {
+	res := uint64(vs.Len())*sliceHeaderSize + vs.Null.Size()
+	for _, v := range vs.Values {
+		res += uint64(len(v))
+	}
+	return res
+}
+
+// Strings returns the string representations of the values, which are
+// empty for nulls
+func (vs *Blobs) Strings() []string {
+	res := make([]string, vs.Len())
+	for i, v := range vs.Values {
+		if !vs.IsNull(i) {
+			res[i] = hex.EncodeToString(v)
+		}
+	}
+	return res
+}
+
+// AppendStringAt appends the string representation of the row-th value to
+// dst, see StringerAt
+func (vs *Blobs) AppendStringAt(dst []byte, row int) []byte {
+	if vs.IsNull(row) {
+		return dst
+	}
+
+	n := len(dst)
+	dst = append(dst, make([]byte, hex.EncodedLen(len(vs.Values[row])))...)
+	hex.Encode(dst[n:], vs.Values[row])
+	return dst
+}
+
+// MarshalJSONValue marshals the values as base64 strings, like encoding/json
+// does
+func (vs *Blobs) MarshalJSONValue(row int) ([]byte, error) {
+	return json.Marshal(vs.Values[row])
+}
+
+// UnmarshalJSONValue sets the row-th value to the JSON encoded one, see
+// JSONData
+func (vs *Blobs) UnmarshalJSONValue(row int, b []byte) error {
+	return json.Unmarshal(b, &vs.Values[row])
+}
+
+// copyBlobs returns a copy of all of the values, in a single buffer. Every
+// value is capped, such that appending to one doesn't overwrite the next
+func copyBlobs(values ...[][]byte) [][]byte {
+	n, size := 0, 0
+	for _, vs := range values {
+		n += len(vs)
+		for _, v := range vs {
+			size += len(v)
+		}
+	}
+
+	res := make([][]byte, 0, n)
+	buf := make([]byte, 0, size)
+	for _, vs := range values {
+		for _, v := range vs {
+			if v == nil {
+				res = append(res, nil)
+				continue
+			}
+
+			start := len(buf)
+			buf = append(buf, v...)
+			res = append(res, buf[start:len(buf):len(buf)])
+		}
+	}
+	return res
+}
@@ -0,0 +1,61 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+)
+
+func TestBlobs_sort(t *testing.T) {
+	data := &ep.Blobs{Values: [][]byte{{0x01, 0x00}, {0xff}, {}, {0x01}, nil}}
+	data.MarkNull(4)
+
+	sort.Sort(data)
+	require.Equal(t, []string{"", "01", "0100", "ff", ""}, data.Strings())
+	require.Equal(t, []bool{false, false, false, false, true}, data.Nulls())
+}
+
+// Clones, and the other copies, don't share the bytes of the original
+func TestBlobs_clone(t *testing.T) {
+	data := &ep.Blobs{Values: [][]byte{[]byte("hello"), []byte("world")}}
+
+	clone := ep.Clone(data).(*ep.Blobs)
+	clone.Values[0][0] = 'j'
+	clone.Values[1] = append(clone.Values[1], '!') // mustn't overwrite the next value
+	require.Equal(t, []string{"jello", "world!"}, toStrings(clone.Values))
+	require.Equal(t, []string{"hello", "world"}, toStrings(data.Values))
+
+	duplicated := data.Duplicate(2).(*ep.Blobs)
+	duplicated.Values[0] = append(duplicated.Values[0], '!')
+	duplicated.Values[2][0] = 'j'
+	require.Equal(t, []string{"hello!", "world", "jello", "world"}, toStrings(duplicated.Values))
+	require.Equal(t, []string{"hello", "world"}, toStrings(data.Values))
+
+	copied := ep.Bytes.Data(1).(*ep.Blobs)
+	copied.Copy(data, 1, 0)
+	copied.Values[0][0] = 'b'
+	require.Equal(t, []string{"hello", "world"}, toStrings(data.Values))
+}
+
+// Payloads that aren't valid UTF-8 are sent as they are
+func TestInMemoryCluster_blobs(t *testing.T) {
+	cluster := eptest.InMemoryCluster(2)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	data := &ep.Blobs{Values: [][]byte{{0xff, 0xfe, 0x00}, {0xc3, 0x28}}}
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.Gather()))
+	res, err := eptest.Run(runner, ep.NewDataset(data))
+	require.NoError(t, err)
+	require.Equal(t, data.Values, res.At(0).(*ep.Blobs).Values)
+	require.Equal(t, []string{"fffe00", "c328"}, res.At(0).Strings())
+}
+
+func toStrings(values [][]byte) []string {
+	res := make([]string, len(values))
+	for i, v := range values {
+		res[i] = string(v)
+	}
+	return res
+}
@@ -0,0 +1,341 @@
+package ep
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+)
+
+var _ = registerGob(&castColumn{})
+
+// CastFunc converts all of the values of the from Data into the values of the
+// to Data, a new Data of the same length of the Type cast to. Null values are
+// already marked as nulls in it, and should be skipped. Values that can't be
+// converted are reported to fail, with the reason
+type CastFunc func(from, to Data, fail func(row int, err error))
+
+// casts are the CastFuncs registered with Types.RegisterCast, by the Go types
+// of the Types they cast from and to
+var casts = map[[2]reflect.Type]CastFunc{}
+
+var _ = Types.
+	RegisterCast(Int64, Float64, castInt64sToFloat64s).
+	RegisterCast(Float64, Int64, castFloat64sToInt64s).
+	RegisterCast(Int64, Decimal(38, 9), castInt64sToDecimals).
+	RegisterCast(Decimal(38, 9), Int64, castDecimalsToInt64s).
+	RegisterCast(Float64, Decimal(38, 9), castFloat64sToDecimals).
+	RegisterCast(Decimal(38, 9), Float64, castDecimalsToFloat64s).
+	RegisterCast(Decimal(38, 9), Decimal(38, 9), castDecimalsToDecimals).
+	RegisterCast(Any, Int64, parseInt64s).
+	RegisterCast(Any, Float64, parseFloat64s).
+	RegisterCast(Any, Bool, parseBools).
+	RegisterCast(Any, Decimal(38, 9), parseDecimals).
+	RegisterCast(Any, DictString, castToDictStrings)
+
+// RegisterCast registers the function that casts Data of one Type to another
+// for Cast and CastColumn. Casts are keyed by the Go types of the Types, such
+// that all of the Decimal types share their casts, and a Type can't be cast
+// to another Type of the same Go type, unless a cast is registered for it.
+// Registering Any as the Type cast from registers the cast of all of the
+// Types that have no other cast to the same Type.
+//
+// Int64, Float64 and Decimal values are cast to one another, and Any Data is
+// cast to them, and to Bool, by parsing its Strings, or to DictString by its
+// Strings
+func (reg typesReg) RegisterCast(from, to Type, fn CastFunc) typesReg {
+	casts[castKey(from, to)] = fn
+	return reg
+}
+
+func castKey(from, to Type) [2]reflect.Type {
+	return [2]reflect.Type{reflect.TypeOf(baseType(from)), reflect.TypeOf(baseType(to))}
+}
+
+// baseType returns the type, without its modifiers. See Modify
+func baseType(t Type) Type {
+	for {
+		m, ok := t.(*modifierType)
+		if !ok {
+			return t
+		}
+		t = m.Type
+	}
+}
+
+// CastOption modifies how values that can't be cast are handled by Cast and
+// CastColumn
+type CastOption func(*castOptions)
+
+// CastNulls is a CastOption that casts values that can't be cast into nulls,
+// rather than failing
+func CastNulls() CastOption {
+	return func(opts *castOptions) { opts.Nulls = true }
+}
+
+type castOptions struct {
+	Nulls bool
+}
+
+// Cast returns the values of the data, converted to the Type by the cast
+// registered with Types.RegisterCast. Nulls remain nulls. When any value can't
+// be cast, it fails on the first one of them, with its row and value, unless
+// CastNulls is set. Data that's already of the Type, by its Name, is returned
+// as is
+func Cast(data Data, to Type, opts ...CastOption) (Data, error) {
+	var options castOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return cast(data, to, options)
+}
+
+func cast(data Data, to Type, opts castOptions) (Data, error) {
+	var err error
+	res, castErr := castRows(data, to, func(row int, reason error) {
+		if opts.Nulls {
+			return // marked as null
+		} else if err == nil {
+			v := data.Slice(row, row+1).Strings()[0]
+			err = fmt.Errorf("ep: row %d: can't cast %q to %s: %s", row, v, to, reason)
+		}
+	})
+	if castErr != nil {
+		return nil, castErr
+	} else if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// castRows returns the data cast to the type, with the rows that can't be
+// cast marked as nulls, after reporting them to fail
+func castRows(data Data, to Type, fail func(row int, reason error)) (Data, error) {
+	if data.Type().Name() == to.Name() {
+		return data, nil
+	}
+	if c, ok := data.(*Constants); ok {
+		value, err := castRows(c.Value, to, fail) // only casts the value once
+		if err != nil {
+			return nil, err
+		}
+		return Constant(value, c.N), nil
+	}
+
+	fn, ok := casts[castKey(data.Type(), to)]
+	if !ok {
+		fn, ok = casts[castKey(Any, to)]
+	}
+	if !ok {
+		return nil, fmt.Errorf("ep: no cast from %s to %s", data.Type(), to)
+	}
+
+	res := to.Data(data.Len())
+	for i := 0; i < data.Len(); i++ {
+		if data.IsNull(i) {
+			res.MarkNull(i)
+		}
+	}
+
+	fn(data, res, func(row int, reason error) {
+		res.MarkNull(row)
+		fail(row, reason)
+	})
+	return res, nil
+}
+
+// CastColumn returns a Runner that casts the col-th column of every
+// dataset of its input to the Type, as with Cast, and returns the rest of the
+// columns as they are
+func CastColumn(col int, to Type, opts ...CastOption) Runner {
+	r := &castColumn{Col: col, To: to}
+	for _, opt := range opts {
+		opt(&r.Options)
+	}
+	return r
+}
+
+type castColumn struct {
+	Col     int
+	To      Type
+	Options castOptions
+}
+
+func (*castColumn) Returns() []Type { return []Type{Wildcard} }
+func (r *castColumn) Run(_ context.Context, inp, out chan Dataset) error {
+	for data := range inp {
+		if r.Col < 0 || r.Col >= data.Width() {
+			return fmt.Errorf("ep: cast column %d out of range for %d columns", r.Col, data.Width())
+		}
+
+		res, err := cast(data.At(r.Col), r.To, r.Options)
+		if err != nil {
+			return err
+		}
+
+		cols := make([]Data, data.Width())
+		for i := range cols {
+			cols[i] = data.At(i)
+		}
+		cols[r.Col] = res
+		out <- NewDataset(cols...)
+	}
+	return nil
+}
+
+func castInt64sToFloat64s(from, to Data, _ func(int, error)) {
+	res := to.(*Float64s)
+	for i, v := range from.(*Int64s).Values {
+		res.Values[i] = float64(v)
+	}
+}
+
+// castFloat64sToInt64s truncates the fractions of the values, like Go does
+func castFloat64sToInt64s(from, to Data, fail func(int, error)) {
+	res := to.(*Int64s)
+	for i, v := range from.(*Float64s).Values {
+		if from.IsNull(i) {
+			continue
+		} else if math.IsNaN(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			fail(i, strconv.ErrRange)
+			continue
+		}
+		res.Values[i] = int64(v)
+	}
+}
+
+func castInt64sToDecimals(from, to Data, fail func(int, error)) {
+	res := to.(*Decimals)
+	for i, v := range from.(*Int64s).Values {
+		if from.IsNull(i) {
+			continue
+		}
+		res.Values[i].Set(rescale(big.NewInt(v), res.Scale))
+		if err := res.checkPrecision(i); err != nil {
+			fail(i, err)
+		}
+	}
+}
+
+// castDecimalsToInt64s truncates the fractions of the values
+func castDecimalsToInt64s(from, to Data, fail func(int, error)) {
+	src, res := from.(*Decimals), to.(*Int64s)
+	for i := range src.Values {
+		if src.IsNull(i) {
+			continue
+		}
+
+		v := rescale(&src.Values[i], -src.Scale)
+		if !v.IsInt64() {
+			fail(i, strconv.ErrRange)
+			continue
+		}
+		res.Values[i] = v.Int64()
+	}
+}
+
+// castFloat64sToDecimals rounds the values to the scale
+func castFloat64sToDecimals(from, to Data, fail func(int, error)) {
+	res := to.(*Decimals)
+	for i, v := range from.(*Float64s).Values {
+		if from.IsNull(i) {
+			continue
+		} else if math.IsNaN(v) || math.IsInf(v, 0) {
+			fail(i, strconv.ErrRange)
+		} else if err := res.parse(i, strconv.FormatFloat(v, 'f', res.Scale, 64)); err != nil {
+			fail(i, err)
+		}
+	}
+}
+
+func castDecimalsToFloat64s(from, to Data, fail func(int, error)) {
+	src, res := from.(*Decimals), to.(*Float64s)
+	for i := range src.Values {
+		if !src.IsNull(i) {
+			parseFloat64(res, i, src.format(i), fail)
+		}
+	}
+}
+
+// castDecimalsToDecimals truncates fraction digits beyond the scale, like
+// Decimals.Copy
+func castDecimalsToDecimals(from, to Data, fail func(int, error)) {
+	src, res := from.(*Decimals), to.(*Decimals)
+	for i := range src.Values {
+		if src.IsNull(i) {
+			continue
+		}
+		res.Values[i].Set(rescale(&src.Values[i], res.Scale-src.Scale))
+		if err := res.checkPrecision(i); err != nil {
+			fail(i, err)
+		}
+	}
+}
+
+func parseInt64s(from, to Data, fail func(int, error)) {
+	res := to.(*Int64s)
+	for i, v := range from.Strings() {
+		if !from.IsNull(i) {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				fail(i, err.(*strconv.NumError).Err)
+				continue
+			}
+			res.Values[i] = n
+		}
+	}
+}
+
+func parseFloat64s(from, to Data, fail func(int, error)) {
+	res := to.(*Float64s)
+	for i, v := range from.Strings() {
+		if !from.IsNull(i) {
+			parseFloat64(res, i, v, fail)
+		}
+	}
+}
+
+func parseFloat64(res *Float64s, i int, v string, fail func(int, error)) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		fail(i, err.(*strconv.NumError).Err)
+		return
+	}
+	res.Values[i] = f
+}
+
+func parseBools(from, to Data, fail func(int, error)) {
+	res := to.(*Bools)
+	for i, v := range from.Strings() {
+		if !from.IsNull(i) {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				fail(i, err.(*strconv.NumError).Err)
+				continue
+			}
+			res.Values[i] = b
+		}
+	}
+}
+
+func parseDecimals(from, to Data, fail func(int, error)) {
+	res := to.(*Decimals)
+	for i, v := range from.Strings() {
+		if !from.IsNull(i) {
+			if err := res.parse(i, v); err != nil {
+				fail(i, err)
+			}
+		}
+	}
+}
+
+func castToDictStrings(from, to Data, _ func(int, error)) {
+	res := to.(*DictStrings)
+	for i, v := range from.Strings() {
+		if !from.IsNull(i) {
+			res.Indices[i] = res.Dict.index(v)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package ep_test
+
+import (
+	"fmt"
+	"github.com/panoplyio/ep"
+)
+
+func ExampleCast() {
+	ints, err := ep.Cast(strs{"1", "two", "3"}, ep.Int64, ep.CastNulls())
+	fmt.Println(ints.Strings(), ints.Nulls(), err)
+
+	_, err = ep.Cast(strs{"1", "two", "3"}, ep.Int64)
+	fmt.Println(err)
+
+	// Output:
+	// [1  3] [false true false] <nil>
+	// ep: row 1: can't cast "two" to int64: invalid syntax
+}
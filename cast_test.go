@@ -0,0 +1,150 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+// strs are cast from any Data by its Strings
+var _ = ep.Types.RegisterCast(ep.Any, str, func(from, to ep.Data, _ func(int, error)) {
+	copy(to.(strs), from.Strings())
+})
+
+func TestCast_strings(t *testing.T) {
+	res, err := ep.Cast(strs{"1", "-20", "300"}, ep.Int64)
+	require.NoError(t, err)
+	require.Equal(t, &ep.Int64s{Values: []int64{1, -20, 300}}, res)
+
+	res, err = ep.Cast(res, str)
+	require.NoError(t, err)
+	require.Equal(t, strs{"1", "-20", "300"}, res)
+
+	res, err = ep.Cast(strs{"1.5", "-0.25"}, ep.Decimal(5, 2))
+	require.NoError(t, err)
+	require.Equal(t, []string{"1.50", "-0.25"}, res.Strings())
+
+	res, err = ep.Cast(strs{"true", "0"}, ep.Bool)
+	require.NoError(t, err)
+	require.Equal(t, []bool{true, false}, res.(*ep.Bools).Values)
+
+	res, err = ep.Cast(&ep.Float64s{Values: []float64{0.5, 2}, Null: ep.NullMask{2}}, ep.DictString)
+	require.NoError(t, err)
+	require.Equal(t, []string{"0.5", ""}, res.Strings())
+	require.Equal(t, []bool{false, true}, res.Nulls())
+}
+
+func TestCast_numbers(t *testing.T) {
+	ints := &ep.Int64s{Values: []int64{7, -3, 0}, Null: ep.NullMask{4}}
+
+	res, err := ep.Cast(ints, ep.Float64)
+	require.NoError(t, err)
+	require.Equal(t, []float64{7, -3, 0}, res.(*ep.Float64s).Values)
+	require.Equal(t, ints.Nulls(), res.Nulls())
+
+	res, err = ep.Cast(&ep.Float64s{Values: []float64{2.9, -2.9}}, ep.Int64)
+	require.NoError(t, err)
+	require.Equal(t, []int64{2, -2}, res.(*ep.Int64s).Values) // truncated
+
+	res, err = ep.Cast(ints, ep.Decimal(4, 2))
+	require.NoError(t, err)
+	require.Equal(t, []string{"7.00", "-3.00", ""}, res.Strings())
+
+	res, err = ep.Cast(res, ep.Decimal(10, 5))
+	require.NoError(t, err)
+	require.Equal(t, []string{"7.00000", "-3.00000", ""}, res.Strings())
+
+	dec, err := ep.ParseDecimals(10, 3, []string{"1.999", "-1.5"})
+	require.NoError(t, err)
+	res, err = ep.Cast(dec, ep.Int64)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, -1}, res.(*ep.Int64s).Values)
+
+	res, err = ep.Cast(dec, ep.Float64)
+	require.NoError(t, err)
+	require.Equal(t, []float64{1.999, -1.5}, res.(*ep.Float64s).Values)
+
+	res, err = ep.Cast(dec, ep.Decimal(3, 1))
+	require.NoError(t, err)
+	require.Equal(t, []string{"1.9", "-1.5"}, res.Strings())
+
+	res, err = ep.Cast(&ep.Float64s{Values: []float64{0.126, 2}}, ep.Decimal(3, 2))
+	require.NoError(t, err)
+	require.Equal(t, []string{"0.13", "2.00"}, res.Strings()) // rounded
+}
+
+func TestCast_failures(t *testing.T) {
+	tests := []struct {
+		data     ep.Data
+		to       ep.Type
+		expected string
+	}{
+		{strs{"1", "a"}, ep.Int64, `ep: row 1: can't cast "a" to int64: invalid syntax`},
+		{strs{"99999999999999999999"}, ep.Int64, `ep: row 0: can't cast "99999999999999999999" to int64: value out of range`},
+		{strs{"x"}, ep.Float64, `ep: row 0: can't cast "x" to float64: invalid syntax`},
+		{strs{"yes"}, ep.Bool, `ep: row 0: can't cast "yes" to bool: invalid syntax`},
+		{strs{"1.234"}, ep.Decimal(5, 2), `ep: row 0: can't cast "1.234" to decimal(5,2): 1.234 has more than 2 fraction digits`},
+		{&ep.Float64s{Values: []float64{math.NaN()}}, ep.Int64, `ep: row 0: can't cast "NaN" to int64: value out of range`},
+		{&ep.Float64s{Values: []float64{1e19}}, ep.Int64, `ep: row 0: can't cast "1e+19" to int64: value out of range`},
+		{&ep.Int64s{Values: []int64{0, 100}}, ep.Decimal(3, 2), `ep: row 1: can't cast "100" to decimal(3,2): 100.00 overflows decimal(3,2)`},
+		{&ep.Bools{Values: []bool{true}}, ep.Int64, `ep: row 0: can't cast "true" to int64: invalid syntax`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			_, err := ep.Cast(test.data, test.to)
+			require.Error(t, err)
+			require.Equal(t, test.expected, err.Error())
+
+			res, err := ep.Cast(test.data, test.to, ep.CastNulls())
+			require.NoError(t, err)
+			nulls := res.Nulls()
+			require.True(t, nulls[len(nulls)-1])
+			require.False(t, len(nulls) > 1 && nulls[0])
+		})
+	}
+}
+
+func TestCast_sameType(t *testing.T) {
+	ints := &ep.Int64s{Values: []int64{1}}
+	res, err := ep.Cast(ints, ep.Int64)
+	require.NoError(t, err)
+	require.True(t, ints.Equal(res))
+
+	_, err = ep.Cast(ints, ep.Timestamp)
+	require.Error(t, err)
+	require.Equal(t, "ep: no cast from int64 to timestamp", err.Error())
+
+	// modified types are cast as the types they modify
+	res, err = ep.Cast(strs{"4"}, ep.Modify(ep.Int64, "k", "v"))
+	require.NoError(t, err)
+	require.Equal(t, []int64{4}, res.(*ep.Int64s).Values)
+}
+
+func TestCastColumn(t *testing.T) {
+	cluster := eptest.InMemoryCluster(2)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.CastColumn(1, ep.Int64, ep.CastNulls()), ep.Gather()))
+	data := ep.NewDataset(strs{"a", "b", "c", "d"}, strs{"1", "x", "3", "4"})
+	res, err := eptest.Run(runner, data, data)
+	require.NoError(t, err)
+	require.Equal(t, 2, res.Width())
+	require.Equal(t, ep.Int64, res.At(1).Type())
+
+	counts := map[string]int{}
+	for i, v := range res.At(0).Strings() {
+		counts[v+":"+res.At(1).Strings()[i]]++
+	}
+	require.Equal(t, map[string]int{"a:1": 2, "b:": 2, "c:3": 2, "d:4": 2}, counts)
+
+	_, err = eptest.Run(ep.CastColumn(1, ep.Int64), data)
+	require.Error(t, err)
+	require.Equal(t, `ep: row 1: can't cast "x" to int64: invalid syntax`, err.Error())
+
+	_, err = eptest.Run(ep.CastColumn(2, ep.Int64), data)
+	require.Error(t, err)
+	require.Equal(t, "ep: cast column 2 out of range for 2 columns", err.Error())
+}
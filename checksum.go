@@ -0,0 +1,122 @@
+package ep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// Checksum sets an exchange Runner, returned by Scatter, Gather, Partition,
+// etc., to verify the integrity of its streams: every write is framed with a
+// CRC-32C checksum of its bytes, which is verified by the receiving side before
+// decoding them, such that a corrupted stream fails instead of decoding wrong
+// values. When compressed, the checksums are of the compressed bytes
+func Checksum(r Runner) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: Checksum expects an exchange")
+	}
+
+	ex.Checksums = true
+	return ex
+}
+
+// checksumsFlag is set in the stream header when the stream is framed with
+// checksums
+const checksumsFlag = 0x40
+
+// maxChecksumFrame is the maximum size of a checksummed frame. Larger frames
+// can only result from a corrupted frame header
+const maxChecksumFrame = 1 << 30
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// errChecksumMismatch is returned from reading a corrupted stream. Decoders
+// report it along with the address of the peer
+var errChecksumMismatch = errors.New("ep: checksum mismatch")
+
+// checksumWriter frames every write with its length and checksum
+type checksumWriter struct {
+	w io.Writer
+}
+
+// framePool holds the buffers of the frames being written, as every write is
+// copied into a frame
+var framePool = sync.Pool{New: func() interface{} { return &bytes.Buffer{} }}
+
+func (cw *checksumWriter) Write(b []byte) (int, error) {
+	// a single write of the whole frame, as it might be a message on its own
+	frame := framePool.Get().(*bytes.Buffer)
+	defer framePool.Put(frame)
+
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(b)))
+	binary.BigEndian.PutUint32(header[4:], crc32.Checksum(b, crc32c))
+	frame.Reset()
+	frame.Write(header[:])
+	frame.Write(b)
+
+	_, err := cw.w.Write(frame.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// checksumReader reads the frames written by checksumWriter, verifying their
+// checksums before any of their bytes are read
+type checksumReader struct {
+	r     io.Reader
+	buf   []byte // reused by all frames, as every frame is read before the next
+	frame []byte // the remaining verified bytes of the current frame
+	err   error  // sticky, the rest of the stream can't be trusted
+}
+
+func (cr *checksumReader) Read(b []byte) (int, error) {
+	for len(cr.frame) == 0 && cr.err == nil {
+		cr.err = cr.readFrame()
+	}
+
+	if len(cr.frame) == 0 {
+		return 0, cr.err
+	}
+
+	n := copy(b, cr.frame)
+	cr.frame = cr.frame[n:]
+	return n, nil
+}
+
+func (cr *checksumReader) readFrame() error {
+	var header [8]byte
+	_, err := io.ReadFull(cr.r, header[:])
+	if err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxChecksumFrame {
+		return errChecksumMismatch
+	}
+
+	if cap(cr.buf) < int(size) {
+		cr.buf = make([]byte, size)
+	}
+	frame := cr.buf[:size]
+	_, err = io.ReadFull(cr.r, frame)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+
+	if crc32.Checksum(frame, crc32c) != binary.BigEndian.Uint32(header[4:]) {
+		return errChecksumMismatch
+	}
+
+	cr.frame = frame
+	return nil
+}
@@ -0,0 +1,400 @@
+package ep
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// Encoder encodes datasets into an underlying stream
+type Encoder interface {
+	Encode(Dataset) error
+}
+
+// Decoder decodes datasets, previously encoded by a matching Encoder, from an
+// underlying stream
+type Decoder interface {
+	Decode(*Dataset) error
+}
+
+// Codec creates the Encoders and Decoders used by exchanges to transmit
+// datasets over their connections
+type Codec interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+// GobCodec is the default Codec of exchanges. It supports all of the Data
+// types that are registered with gob, which is done for all registered Types
+var GobCodec Codec = gobCodec{}
+
+// RawCodec is a Codec using a length-prefixed binary representation of the
+// built-in Data types. It's faster than gob, and it isn't Go-specific, but it
+// fails to encode any other Data type
+var RawCodec Codec = rawCodec{}
+
+var exchangeCodec = struct {
+	sync.RWMutex
+	Codec
+}{Codec: GobCodec}
+
+// TypeRegisterer is implemented by Codecs that need the Data types to be
+// registered before encoding them, like gob. All of the Types registered with
+// Types.Register are registered with the exchange Codec, including the ones
+// registered before the Codec was set
+type TypeRegisterer interface {
+	RegisterType(Type)
+}
+
+// SetExchangeCodec sets the Codec used by all exchanges that are started
+// afterwards. The same Codec must be used by all of the nodes, thus it should
+// be set upon initialization, before any exchange is running.
+func SetExchangeCodec(c Codec) {
+	exchangeCodec.Lock()
+	defer exchangeCodec.Unlock()
+	exchangeCodec.Codec = c
+
+	if reg, ok := c.(TypeRegisterer); ok {
+		for _, t := range Types.All() {
+			reg.RegisterType(t)
+		}
+	}
+}
+
+// registerType registers a Type, and its Data, with gob, as runners and their
+// types are always distributed with gob, and with the exchange Codec
+func registerType(t Type) {
+	registerGob(t)
+	GobCodec.(TypeRegisterer).RegisterType(t)
+
+	reg, ok := getExchangeCodec().(TypeRegisterer)
+	if _, isGob := reg.(gobCodec); ok && !isGob {
+		reg.RegisterType(t)
+	}
+}
+
+func getExchangeCodec() Codec {
+	exchangeCodec.RLock()
+	defer exchangeCodec.RUnlock()
+	return exchangeCodec.Codec
+}
+
+// newEncoder returns an encoder of exchange requests over a connection, using
+// the current exchange Codec. The default gob Codec encodes the requests
+// themselves, as is. Other Codecs only encode datasets, thus requests are
+// framed with a header indicating their kind
+func newEncoder(w io.Writer) encoder {
+	c := getExchangeCodec()
+	if _, isGob := c.(gobCodec); isGob {
+		return gobReqEncoder{gob.NewEncoder(w)}
+	}
+
+	bw := bufio.NewWriter(w)
+	return &frameEncoder{bw, c.NewEncoder(bw)}
+}
+
+// newDecoder returns a decoder of exchange requests, encoded by an encoder
+// returned from newEncoder
+func newDecoder(r io.Reader) decoder {
+	c := getExchangeCodec()
+	if _, isGob := c.(gobCodec); isGob {
+		return gob.NewDecoder(r)
+	}
+
+	br := bufio.NewReader(r)
+	return &frameDecoder{br, c.NewDecoder(br)}
+}
+
+// kinds of frames of exchange requests, written before their payload
+const (
+	dataFrame = 'D' // a dataset
+	seqFrame  = 'S' // a sequence number, followed by a dataset
+	errFrame  = 'E' // an error message
+	eosFrame  = 'F' // the end of the stream, followed by the sending node
+	beatFrame = 'H' // a heartbeat
+	stopFrame = 'X' // stop sending, followed by the receiving node
+	ackFrame  = 'A' // an acknowledgement, followed by the number of datasets
+)
+
+type frameEncoder struct {
+	w   *bufio.Writer
+	enc Encoder
+}
+
+func (e *frameEncoder) Encode(v interface{}) (err error) {
+	switch payload := v.(*req).Payload.(type) {
+	case error:
+		e.w.WriteByte(errFrame)
+		err = writeBytes(e.w, []byte(payload.Error()))
+	case *seqBatch:
+		e.w.WriteByte(seqFrame)
+		err = writeUvarint(e.w, uint64(payload.Seq))
+		if err == nil {
+			err = e.enc.Encode(payload.Data)
+		}
+	case *endOfStream:
+		e.w.WriteByte(eosFrame)
+		err = writeBytes(e.w, []byte(payload.Node))
+	case *heartbeat:
+		e.w.WriteByte(beatFrame)
+		err = writeUvarint(e.w, uint64(payload.Sent))
+	case *stopSending:
+		e.w.WriteByte(stopFrame)
+		err = writeBytes(e.w, []byte(payload.Node))
+	case *ack:
+		e.w.WriteByte(ackFrame)
+		err = writeUvarint(e.w, uint64(payload.Batches))
+	case Dataset:
+		e.w.WriteByte(dataFrame)
+		err = e.enc.Encode(payload)
+	default:
+		err = fmt.Errorf("ep: unsupported exchange payload %T", payload)
+	}
+
+	if err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+type frameDecoder struct {
+	r   *bufio.Reader
+	dec Decoder
+}
+
+func (d *frameDecoder) Decode(v interface{}) error {
+	kind, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	req := v.(*req)
+	switch kind {
+	case errFrame:
+		msg, err := readBytes(d.r)
+		if err != nil {
+			return err
+		}
+		req.Payload = &errMsg{string(msg)}
+	case seqFrame:
+		seq, err := binary.ReadUvarint(d.r)
+		if err != nil {
+			return err
+		}
+
+		batch := &seqBatch{Seq: int(seq)}
+		err = d.dec.Decode(&batch.Data)
+		if err != nil {
+			return err
+		}
+		req.Payload = batch
+	case eosFrame:
+		node, err := readBytes(d.r)
+		if err != nil {
+			return err
+		}
+		req.Payload = &endOfStream{string(node)}
+	case beatFrame:
+		sent, err := binary.ReadUvarint(d.r)
+		if err != nil {
+			return err
+		}
+		req.Payload = &heartbeat{int64(sent)}
+	case stopFrame:
+		node, err := readBytes(d.r)
+		if err != nil {
+			return err
+		}
+		req.Payload = &stopSending{string(node)}
+	case ackFrame:
+		batches, err := binary.ReadUvarint(d.r)
+		if err != nil {
+			return err
+		}
+		req.Payload = &ack{int(batches)}
+	case dataFrame:
+		var data Dataset
+		err = d.dec.Decode(&data)
+		if err != nil {
+			return err
+		}
+		req.Payload = data
+	default:
+		return fmt.Errorf("ep: unrecognized exchange frame %q", kind)
+	}
+	return nil
+}
+
+// gobReqEncoder encodes exchange requests with gob, and names the offending
+// column when a dataset fails to encode due to an unregistered Data type
+type gobReqEncoder struct{ enc *gob.Encoder }
+
+func (e gobReqEncoder) Encode(v interface{}) error {
+	err := e.enc.Encode(v)
+	if err != nil && strings.Contains(err.Error(), "type not registered") {
+		return unregisteredColumn(v.(*req), err)
+	}
+	return err
+}
+
+// unregisteredColumn returns the error of encoding a dataset request, which
+// failed with err, naming the first of its columns that fails to encode
+func unregisteredColumn(r *req, err error) error {
+	data, ok := r.Payload.(Dataset)
+	if batch, isSeq := r.Payload.(*seqBatch); isSeq {
+		data, ok = batch.Data, true
+	}
+
+	for i := 0; ok && i < data.Width(); i++ {
+		col := data.At(i)
+		if gob.NewEncoder(ioutil.Discard).Encode(&req{col}) != nil {
+			return fmt.Errorf("ep: column %d of type %s isn't registered with gob, its Data (%T) must be registered with Types.Register: %s", i, col.Type(), col, err)
+		}
+	}
+	return err
+}
+
+type gobCodec struct{}
+
+func (gobCodec) NewEncoder(w io.Writer) Encoder { return gobEncoder{gob.NewEncoder(w)} }
+func (gobCodec) NewDecoder(r io.Reader) Decoder { return gobDecoder{gob.NewDecoder(r)} }
+func (gobCodec) RegisterType(t Type)            { gob.Register(t.Data(0)) }
+
+type gobEncoder struct{ enc *gob.Encoder }
+
+func (e gobEncoder) Encode(data Dataset) error {
+	return e.enc.Encode(&req{data})
+}
+
+type gobDecoder struct{ dec *gob.Decoder }
+
+func (d gobDecoder) Decode(data *Dataset) error {
+	req := &req{}
+	err := d.dec.Decode(req)
+	if err != nil {
+		return err
+	}
+	*data = req.Payload.(Dataset)
+	return nil
+}
+
+// rawCodec encodes every dataset as its width and length, followed by all of
+// its columns. Every column is encoded as its type name, followed by its
+// values in a type-specific representation
+type rawCodec struct{}
+
+func (rawCodec) NewEncoder(w io.Writer) Encoder { return rawEncoder{w} }
+func (rawCodec) NewDecoder(r io.Reader) Decoder {
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &rawDecoder{r: br}
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+type rawEncoder struct{ w io.Writer }
+
+func (e rawEncoder) Encode(data Dataset) error {
+	err := writeUvarint(e.w, uint64(data.Width()))
+	if err == nil {
+		err = writeUvarint(e.w, uint64(data.Len()))
+	}
+
+	for i := 0; err == nil && i < data.Width(); i++ {
+		col := data.At(i)
+		err = writeBytes(e.w, []byte(col.Type().Name()))
+		if err != nil {
+			return err
+		}
+
+		switch col.(type) {
+		case nulls:
+			// nothing to write, all values are null
+		default:
+			return fmt.Errorf("ep: raw codec doesn't support %s", col.Type())
+		}
+	}
+	return err
+}
+
+type rawDecoder struct {
+	r    byteReader
+	name []byte // reused by the type names of all columns
+}
+
+func (d *rawDecoder) Decode(data *Dataset) error {
+	width, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return err
+	}
+
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return err
+	}
+
+	cols := make([]Data, width)
+	for i := range cols {
+		d.name, err = readBytesInto(d.r, d.name)
+		if err != nil {
+			return err
+		}
+
+		switch string(d.name) {
+		case Null.Name():
+			cols[i] = Null.Data(int(n))
+		default:
+			return fmt.Errorf("ep: raw codec doesn't support %s", d.name)
+		}
+	}
+
+	*data = NewDataset(cols...)
+	return nil
+}
+
+func writeUvarint(w io.Writer, v uint64) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	_, err := w.Write(buf[:binary.PutUvarint(buf, v)])
+	return err
+}
+
+// writeBytes writes a length-prefixed byte slice
+func writeBytes(w io.Writer, b []byte) error {
+	err := writeUvarint(w, uint64(len(b)))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// readBytes reads a byte slice, previously written with writeBytes
+func readBytes(r byteReader) ([]byte, error) {
+	return readBytesInto(r, nil)
+}
+
+// readBytesInto is similar to readBytes, except that it reads into buf when
+// it's large enough, instead of allocating a new byte slice
+func readBytesInto(r byteReader, buf []byte) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(cap(buf)) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	_, err = io.ReadFull(r, buf)
+	return buf, err
+}
@@ -0,0 +1,91 @@
+package ep_test
+
+import (
+	"bytes"
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCodec_roundTrip(t *testing.T) {
+	codecs := map[string]ep.Codec{"gob": ep.GobCodec, "raw": ep.RawCodec, "arrow": ep.ArrowCodec}
+	for name, codec := range codecs {
+		data := ep.NewDataset(ep.Null.Data(3), ep.Null.Data(3))
+		buf := &bytes.Buffer{}
+		enc := codec.NewEncoder(buf)
+		require.NoError(t, enc.Encode(data), name)
+		require.NoError(t, enc.Encode(ep.NewDataset()), name)
+
+		var res ep.Dataset
+		dec := codec.NewDecoder(buf)
+		require.NoError(t, dec.Decode(&res), name)
+		require.Equal(t, 2, res.Width(), name)
+		require.Equal(t, 3, res.Len(), name)
+		require.Equal(t, []bool{true, true, true}, res.At(1).Nulls(), name)
+
+		require.NoError(t, dec.Decode(&res), name)
+		require.Equal(t, 0, res.Width(), name)
+	}
+}
+
+func TestRawCodec_unsupportedType(t *testing.T) {
+	err := ep.RawCodec.NewEncoder(ioutil.Discard).Encode(ep.NewDataset(strs{"a"}))
+	require.Error(t, err)
+	require.Equal(t, "ep: raw codec doesn't support string", err.Error())
+}
+
+func BenchmarkCodec(b *testing.B) {
+	b.Run("gob strs", func(b *testing.B) {
+		benchmarkCodec(b, ep.GobCodec, ep.NewDataset(make(strs, 1000000)))
+	})
+	b.Run("gob nulls", func(b *testing.B) {
+		benchmarkCodec(b, ep.GobCodec, ep.NewDataset(ep.Null.Data(1000000)))
+	})
+	b.Run("raw nulls", func(b *testing.B) {
+		benchmarkCodec(b, ep.RawCodec, ep.NewDataset(ep.Null.Data(1000000)))
+	})
+}
+
+// Measures the encoding and decoding of a single dataset, through a new
+// encoder-decoder pair, as types are described again for every new encoder
+func benchmarkCodec(b *testing.B, codec ep.Codec, data ep.Dataset) {
+	buf := &bytes.Buffer{}
+	var res ep.Dataset
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		err := codec.NewEncoder(buf).Encode(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		err = codec.NewDecoder(buf).Decode(&res)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSetExchangeCodec_registersTypes(t *testing.T) {
+	defer ep.SetExchangeCodec(ep.GobCodec)
+
+	c := &registeringCodec{ep.GobCodec, map[string]bool{}}
+	ep.SetExchangeCodec(c)
+	require.True(t, c.types["NULL"], "types registered before the codec was set")
+	require.True(t, c.types["fruit"], "types registered before the codec was set")
+
+	ep.Types.Register("vegetable", &vegetableType{})
+	require.True(t, c.types["vegetable"], "types registered after the codec was set")
+}
+
+// registeringCodec is a Codec that records the types registered with it
+type registeringCodec struct {
+	ep.Codec
+	types map[string]bool
+}
+
+func (c *registeringCodec) RegisterType(t ep.Type) { c.types[t.Name()] = true }
+
+type vegetableType struct{ fruitType }
+
+func (*vegetableType) Name() string { return "vegetable" }
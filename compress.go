@@ -0,0 +1,135 @@
+package ep
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compression is an algorithm used to compress the streams of an exchange
+type Compression byte
+
+const (
+	// NoCompression sends the exchange streams as is
+	NoCompression Compression = iota
+
+	// Gzip compresses the exchange streams with gzip. Every message is
+	// flushed on its own, thus it pays off mostly for large datasets
+	Gzip
+)
+
+// Compress sets the Compression of the streams from every node of an exchange
+// Runner, returned by Scatter, Gather, Partition, etc. Every stream starts with
+// a header indicating its Compression, such that the receiving side always
+// matches the sending side
+func Compress(r Runner, c Compression) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: Compress expects an exchange")
+	}
+
+	ex.Compression = c
+	return ex
+}
+
+// compressWriter returns a writer that compresses the data written to w. The
+// header indicating the Compression, along with the provided flags, is written
+// with the first write, as the peer only starts reading once the exchange runs.
+// When checksummed, the compressed data is framed with checksums
+func compressWriter(w io.Writer, c Compression, flags byte) io.Writer {
+	return &compressedWriter{w: w, c: c, flags: flags}
+}
+
+type compressedWriter struct {
+	w      io.Writer
+	c      Compression
+	flags  byte         // of the stream, set in the header
+	gz     *gzip.Writer // when the stream is compressed with gzip
+	inited bool         // was the header written
+}
+
+func (cw *compressedWriter) Write(b []byte) (int, error) {
+	if !cw.inited {
+		if cw.c != NoCompression && cw.c != Gzip {
+			return 0, fmt.Errorf("ep: unknown compression %d", cw.c)
+		}
+
+		_, err := cw.w.Write([]byte{byte(cw.c) | cw.flags})
+		if err != nil {
+			return 0, err
+		}
+
+		if cw.flags&checksumsFlag != 0 {
+			cw.w = &checksumWriter{cw.w}
+		}
+
+		if cw.c == Gzip {
+			cw.gz = gzip.NewWriter(cw.w)
+		}
+		cw.inited = true
+	}
+
+	if cw.gz == nil {
+		return cw.w.Write(b)
+	}
+
+	// flush every write, as the peer might wait for this message before
+	// anything else is written
+	n, err := cw.gz.Write(b)
+	if err == nil {
+		err = cw.gz.Flush()
+	}
+	return n, err
+}
+
+// decompressReader returns a reader of a stream written by the writer returned
+// from compressWriter. The header is only read upon the first read. When the
+// stream carries heartbeats, the reader starts detecting an idle peer, if it
+// can. When the stream is checksummed, the checksums are verified beneath the
+// decompression
+func decompressReader(r io.Reader) io.Reader {
+	return &decompressedReader{r: r}
+}
+
+type decompressedReader struct {
+	r      io.Reader
+	inited bool
+}
+
+func (dr *decompressedReader) Read(b []byte) (int, error) {
+	if !dr.inited {
+		header := make([]byte, 1)
+		_, err := io.ReadFull(dr.r, header)
+		if err != nil {
+			return 0, err
+		}
+
+		if header[0] == handshakeMagic[0] {
+			return 0, fmt.Errorf("ep: unexpected handshake, the peer speaks protocol v%d while v%d is set", protocolVersion, legacyProtocolVersion)
+		}
+
+		if header[0]&heartbeatsFlag != 0 {
+			if d, ok := dr.r.(idleDetector); ok {
+				d.detectIdle()
+			}
+		}
+
+		if header[0]&checksumsFlag != 0 {
+			dr.r = &checksumReader{r: dr.r}
+		}
+
+		switch Compression(header[0] &^ (heartbeatsFlag | checksumsFlag)) {
+		case NoCompression:
+			// nothing to wrap
+		case Gzip:
+			dr.r, err = gzip.NewReader(dr.r)
+			if err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("ep: unknown compression %d", header[0])
+		}
+		dr.inited = true
+	}
+	return dr.r.Read(b)
+}
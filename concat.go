@@ -0,0 +1,129 @@
+package ep
+
+import "fmt"
+
+// Concatenator is an optional interface of Data, appending many Data at once,
+// where other Data is appended pair by pair, which copies every row several
+// times. It's used by Concat, and implemented by all of the built-in types
+// backed by slices
+type Concatenator interface {
+	Data
+
+	// AppendAll returns a new Data of the values of this data, followed by the
+	// values of all of the other Data, in their order, as with Append
+	AppendAll(others ...Data) Data
+}
+
+// Concat returns a single Data of the values of all of the chunks, in their
+// order, which are all of the same Type, as with appending all of them to the
+// first one, without copying every row more than once. Datasets are
+// concatenated as with ConcatDatasets. Constants of equal values stay
+// constant, while other Constants are materialized, as with Append. A single
+// chunk is returned as it is. It panics when there are no chunks
+func Concat(chunks ...Data) Data {
+	if len(chunks) == 0 {
+		panic("ep: concat of no data")
+	} else if len(chunks) == 1 {
+		return chunks[0]
+	}
+
+	if _, ok := chunks[0].(Dataset); ok {
+		datasets := make([]Dataset, len(chunks))
+		for i, chunk := range chunks {
+			datasets[i] = chunk.(Dataset)
+		}
+		return ConcatDatasets(datasets...)
+	} else if res, ok := concatConstants(chunks); ok {
+		return res
+	}
+
+	materialized := make([]Data, len(chunks))
+	for i, chunk := range chunks {
+		materialized[i] = chunk
+		if c, ok := chunk.(*Constants); ok {
+			materialized[i] = c.Materialize()
+		}
+	}
+
+	if c, ok := materialized[0].(Concatenator); ok {
+		return c.AppendAll(materialized[1:]...)
+	}
+
+	// pair by pair, such that every row is copied once per level of pairs
+	for len(materialized) > 1 {
+		pairs := materialized[:0]
+		for i := 0; i < len(materialized); i += 2 {
+			if i+1 < len(materialized) {
+				pairs = append(pairs, materialized[i].Append(materialized[i+1]))
+			} else {
+				pairs = append(pairs, materialized[i])
+			}
+		}
+		materialized = pairs
+	}
+	return materialized[0]
+}
+
+// ConcatDatasets returns a single Dataset of the rows of all of the datasets,
+// in their order, concatenating every one of their columns as with Concat. All
+// of them must have the same number of columns, of the same types. Without
+// datasets it returns an empty Dataset
+func ConcatDatasets(datasets ...Dataset) Dataset {
+	if len(datasets) == 0 {
+		return NewDataset()
+	} else if len(datasets) == 1 {
+		return datasets[0]
+	}
+
+	cols := make([]Data, datasets[0].Width())
+	for i := range cols {
+		chunks := make([]Data, len(datasets))
+		for j, data := range datasets {
+			if data.Width() != len(cols) {
+				panic(fmt.Sprintf("ep: concat of datasets of %d and %d columns", len(cols), data.Width()))
+			}
+			chunks[j] = data.At(i)
+		}
+		cols[i] = Concat(chunks...)
+	}
+	return NewDataset(cols...)
+}
+
+// concatConstants returns the Constants of the chunks when all of them are
+// Constants of equal values, ignoring the empty ones
+func concatConstants(chunks []Data) (Data, bool) {
+	var res *Constants
+	n := 0
+	for _, chunk := range chunks {
+		c, ok := chunk.(*Constants)
+		if !ok {
+			return nil, false
+		} else if res == nil || res.N == 0 {
+			res = c
+		} else if c.N > 0 && res.Compare(0, c, 0) != 0 {
+			return nil, false
+		}
+		n += c.N
+	}
+	return &Constants{res.Value, n}, true
+}
+
+// appendAll returns the values and the nulls of the data, followed by the ones
+// of all of the other data, as returned by the function, for the AppendAll of
+// Data backed by slices
+func appendAll[T any](data Data, others []Data, values func(Data) ([]T, NullMask)) ([]T, NullMask) {
+	n := data.Len()
+	for _, other := range others {
+		n += other.Len()
+	}
+
+	res, nulls := values(data)
+	res = append(make([]T, 0, n), res...)
+	nulls = nulls.Slice(0, len(res))
+	for _, other := range others {
+		vs, m := values(other)
+		nulls.setAll(len(res), m)
+		res = append(res, vs...)
+	}
+	return res, nulls
+}
@@ -0,0 +1,94 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestConcat(t *testing.T) {
+	for name, newFn := range newData {
+		t.Run(name, func(t *testing.T) {
+			data := newFn()
+			if name != "strs" {
+				data.MarkNull(2)
+			}
+
+			// with its own dictionaries, values of lists and fields of structs
+			n := data.Len()
+			other := ep.Clone(data)
+			res := ep.Concat(data.Slice(0, 1), data.Slice(1, 1), data.Slice(1, 3), data.Slice(3, n), other)
+			require.Equal(t, data.Type(), res.Type())
+			require.Equal(t, append(data.Strings(), data.Strings()...), res.Strings())
+			require.Equal(t, append(data.Nulls(), data.Nulls()...), res.Nulls())
+			require.Equal(t, data.Append(other).Strings(), res.Strings())
+
+			// the result is independent of the chunks
+			strs := data.Strings()
+			res.Swap(0, 1)
+			res.Copy(res, 2*n-1, 3)
+			require.Equal(t, strs, data.Strings())
+			require.Equal(t, strs, other.Strings())
+
+			require.Equal(t, data, ep.Concat(data))
+		})
+	}
+}
+
+func TestConcat_constants(t *testing.T) {
+	x := ep.Constant(ep.EncodeDict([]string{"x"}), 2)
+	res := ep.Concat(x, ep.Constant(ep.EncodeDict([]string{"y"}), 0), x.Slice(0, 1))
+	require.IsType(t, x, res)
+	require.Equal(t, []string{"x", "x", "x"}, res.Strings())
+
+	res = ep.Concat(x, ep.EncodeDict([]string{"a"}), ep.Constant(ep.EncodeDict([]string{"y"}), 1))
+	require.IsType(t, &ep.DictStrings{}, res)
+	require.Equal(t, []string{"x", "x", "a", "y"}, res.Strings())
+
+	require.Panics(t, func() { ep.Concat() })
+}
+
+func TestConcatDatasets(t *testing.T) {
+	a := ep.NewDataset(strs{"a", "b"}, &ep.Int64s{Values: []int64{1, 2}, Null: ep.NullMask{2}})
+	b := ep.NewDataset(strs{"c"}, &ep.Int64s{Values: []int64{3}})
+	res := ep.ConcatDatasets(a, b, a)
+	require.Equal(t, []string{"[a b c a b]", "[1  3 1 ]"}, res.Strings())
+	require.Equal(t, res, ep.Concat(a, b, a))
+
+	require.Equal(t, 0, ep.ConcatDatasets().Width())
+	require.PanicsWithValue(t, "ep: concat of datasets of 2 and 1 columns", func() {
+		ep.ConcatDatasets(a, ep.NewDataset(strs{"d"}))
+	})
+}
+
+// Concatenating all of the batches at once copies every row once, where
+// appending them one by one copies the rows appended before every time
+func BenchmarkConcat(b *testing.B) {
+	batches := benchmarkBatches()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ep.Concat(batches...)
+	}
+}
+
+func BenchmarkConcat_append(b *testing.B) {
+	batches := benchmarkBatches()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := batches[0]
+		for _, batch := range batches[1:] {
+			res = res.Append(batch)
+		}
+	}
+}
+
+// benchmarkBatches returns 1000 batches of 1000 rows
+func benchmarkBatches() []ep.Data {
+	res := make([]ep.Data, 1000)
+	for i := range res {
+		res[i] = &ep.Int64s{Values: make([]int64, 1000)}
+	}
+	return res
+}
@@ -0,0 +1,187 @@
+package ep
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+)
+
+var _ = registerGob(&Constants{})
+
+// Constant returns the Constants of n rows of the single value of the data,
+// like the literals of queries, which are otherwise materialized as n equal
+// values in every batch
+func Constant(value Data, n int) *Constants {
+	if value.Len() != 1 {
+		panic(fmt.Sprintf("ep: constant of %d values, expected 1", value.Len()))
+	}
+	return &Constants{value, n}
+}
+
+// Constants is a run-length encoded Data of a single Value repeated N times,
+// of the Type of the Value. It's sent by exchanges as the value and its count.
+// Appending Constants of an equal value, by Compare, keeps them constant, while
+// appending any other Data materializes them into the Data of the Value, as
+// with Materialize. Constants are immutable, thus MarkNull and Copy panic when
+// they would change the value of a single row.
+//
+// Data of the Type of the Value doesn't know of Constants, thus they're
+// materialized by Clone and when datasets are appended to one another, and
+// they're compared by Compare, but they must be materialized before they're
+// passed to the other methods of such Data
+type Constants struct {
+	Value Data // of a single value
+	N     int
+}
+
+// Materialize returns the Data of the Value repeated N times
+func (vs *Constants) Materialize() Data { return vs.Value.Duplicate(vs.N) }
+
+// Type returns the type of its value
+func (vs *Constants) Type() Type { return vs.Value.Type() }
+
+// Len returns the number of values
+func (vs *Constants) Len() int { return vs.N }
+
+// Less reports false, as all of the values are equal
+func (vs *Constants) Less(i, j int) bool { return false }
+
+// Swap does nothing, as all of the values are equal
+func (vs *Constants) Swap(i, j int) {}
+
+// LessOther reports whether the thisRow-th value sorts before the
+// otherRow-th value of the other data
+func (vs *Constants) LessOther(thisRow int, other Data, otherRow int) bool {
+	return vs.Compare(thisRow, other, otherRow) < 0
+}
+
+// Compare compares the thisRow-th value to the otherRow-th value of the
+// other data, see Comparable
+func (vs *Constants) Compare(thisRow int, other Data, otherRow int) int {
+	if data, ok := other.(*Constants); ok {
+		other, otherRow = data.Value, 0
+	}
+	return Compare(vs.Value, 0, other, otherRow)
+}
+
+// Hash hashes the value as the Data of the Value does, such that Constants are
+// partitioned along with the materialized values
+func (vs *Constants) Hash(row int, h hash.Hash64) {
+	if data, ok := vs.Value.(Hashable); ok {
+		data.Hash(0, h)
+	} else {
+		hashString(h, vs.Value.Strings()[0])
+	}
+}
+
+// Slice returns the values from the start to the end indices
+func (vs *Constants) Slice(s, e int) Data { return &Constants{vs.Value, e - s} }
+
+// Append returns the values followed by the ones of the other data
+func (vs *Constants) Append(other Data) Data {
+	if data, ok := other.(*Constants); ok {
+		switch {
+		case vs.N == 0:
+			return &Constants{data.Value, data.N}
+		case data.N == 0 || vs.Compare(0, data, 0) == 0:
+			return &Constants{vs.Value, vs.N + data.N}
+		}
+	}
+	return appendData(vs.Materialize(), other)
+}
+
+// Duplicate returns the values repeated t times
+func (vs *Constants) Duplicate(t int) Data { return &Constants{vs.Value, vs.N * t} }
+
+// IsNull reports whether the value is null, for any row
+func (vs *Constants) IsNull(int) bool { return vs.Value.IsNull(0) }
+
+// MarkNull panics, unless the value is already null, as the values can't
+// differ
+func (vs *Constants) MarkNull(int) {
+	if !vs.Value.IsNull(0) {
+		panic("ep: can't mark a null in constants")
+	}
+}
+
+// Nulls reports whether each one of the values is null
+func (vs *Constants) Nulls() []bool {
+	res := make([]bool, vs.N)
+	if vs.Value.IsNull(0) {
+		for i := range res {
+			res[i] = true
+		}
+	}
+	return res
+}
+
+// Equal reports whether the other data has the same values, as with
+// DataEqual
+func (vs *Constants) Equal(other Data) bool { return DataEqual(vs, other) }
+
+// Same reports whether the other data shares the values, see Sharer
+func (vs *Constants) Same(other Data) bool {
+	data, ok := other.(*Constants)
+	return ok && (vs == data || Same(vs.Value, data.Value))
+}
+
+// Copy copies the fromRow-th value of the other data to the toRow-th value
+func (vs *Constants) Copy(from Data, fromRow, _ int) {
+	if vs.Compare(0, from, fromRow) != 0 {
+		panic("ep: can't copy another value into constants")
+	}
+}
+
+// Take returns the values at the indices, in their order, see Taker
+func (vs *Constants) Take(indices []int) Data { return &Constants{vs.Value, len(indices)} }
+
+// Clone materializes the constants, as with Materialize
+func (vs *Constants) Clone() Data { return Clone(vs.Materialize()) }
+
+// Size is the size of the single value
+func (vs *Constants) Size() uint64 { return DataSize(vs.Value) }
+
+// Strings returns the string representations of the values, which are
+// empty for nulls
+func (vs *Constants) Strings() []string {
+	res := make([]string, vs.N)
+	s := StringAt(vs.Value, 0)
+	for i := range res {
+		res[i] = s
+	}
+	return res
+}
+
+// AppendStringAt appends the string representation of the row-th value to
+// dst, see StringerAt
+func (vs *Constants) AppendStringAt(dst []byte, _ int) []byte {
+	return AppendStringAt(dst, vs.Value, 0)
+}
+
+// MarshalJSONValue returns the JSON encoding of the row-th value, see
+// JSONData
+func (vs *Constants) MarshalJSONValue(int) ([]byte, error) {
+	values, err := marshalJSONValues(vs.Value)
+	if err != nil {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// UnmarshalJSONValue fails, as JSON is unmarshaled into the Data of the Type
+// of the Value, rather than into Constants
+func (vs *Constants) UnmarshalJSONValue(int, []byte) error {
+	return errors.New("constants are immutable")
+}
+
+// appendData appends the other data to the data, materializing the other
+// Constants unless the data is Constants as well, as other Data doesn't know
+// them
+func appendData(data, other Data) Data {
+	if c, ok := other.(*Constants); ok {
+		if _, ok := data.(*Constants); !ok {
+			other = c.Materialize()
+		}
+	}
+	return data.Append(other)
+}
@@ -0,0 +1,126 @@
+package ep_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestConstant(t *testing.T) {
+	data := ep.Constant(ep.EncodeDict([]string{"x"}), 3)
+	require.Equal(t, ep.DictString, data.Type())
+	require.Equal(t, 3, data.Len())
+	require.Equal(t, []string{"x", "x", "x"}, data.Strings())
+	require.Equal(t, []bool{false, false, false}, data.Nulls())
+	require.Panics(t, func() { ep.Constant(ep.EncodeDict([]string{"x", "y"}), 3) })
+
+	require.Equal(t, 1, data.Slice(1, 2).Len())
+	require.Equal(t, 6, data.Duplicate(2).Len())
+	taken, err := ep.Take(data, []int{2, 2, 0, 1})
+	require.NoError(t, err)
+	require.Equal(t, []string{"x", "x", "x", "x"}, taken.Strings())
+	require.IsType(t, data, taken)
+
+	// the single value is compared, including to other data of its type
+	other := ep.EncodeDict([]string{"a", "x", "y"})
+	require.Equal(t, 1, ep.Compare(data, 2, other, 0))
+	require.Equal(t, 0, ep.Compare(data, 0, other, 1))
+	require.Equal(t, -1, ep.Compare(other, 1, ep.Constant(other.Slice(2, 3), 1), 0))
+	require.True(t, data.LessOther(1, other, 2))
+	require.False(t, data.Less(0, 1))
+
+	// and hashed as its materialized values
+	for i := 0; i < data.Len(); i++ {
+		require.Equal(t, ep.HashRow(other, 1), ep.HashRow(data, i))
+	}
+
+	nulls := ep.Constant(&ep.Int64s{Values: []int64{0}, Null: ep.NullMask{1}}, 2)
+	require.Equal(t, []string{"", ""}, nulls.Strings())
+	require.Equal(t, []bool{true, true}, nulls.Nulls())
+	require.NotPanics(t, func() { nulls.MarkNull(1) })
+	require.Panics(t, func() { data.MarkNull(1) })
+	require.Panics(t, func() { data.Copy(other, 0, 1) })
+}
+
+func TestConstants_Append(t *testing.T) {
+	x := ep.Constant(ep.EncodeDict([]string{"x"}), 2)
+
+	// equal values stay constant
+	res := x.Append(ep.Constant(ep.EncodeDict([]string{"x"}), 3)).Append(x.Slice(0, 0))
+	require.IsType(t, x, res)
+	require.Equal(t, 5, res.Len())
+	require.Equal(t, 2, ep.Constant(ep.EncodeDict([]string{"y"}), 0).Append(x).Len())
+
+	// other values are materialized
+	res = x.Append(ep.Constant(ep.EncodeDict([]string{"y"}), 1))
+	require.IsType(t, &ep.DictStrings{}, res)
+	require.Equal(t, []string{"x", "x", "y"}, res.Strings())
+
+	res = x.Append(ep.EncodeDict([]string{"a", "b"}))
+	require.IsType(t, &ep.DictStrings{}, res)
+	require.Equal(t, []string{"x", "x", "a", "b"}, res.Strings())
+
+	// appended to other data of its type, as datasets or when cloned
+	ds := ep.NewDataset(ep.EncodeDict([]string{"a"}), x.Slice(0, 1))
+	ds = ds.Append(ep.NewDataset(x, ep.EncodeDict([]string{"b", "c"}))).(ep.Dataset)
+	require.Equal(t, []string{"a", "x", "x"}, ds.At(0).Strings())
+	require.Equal(t, []string{"x", "b", "c"}, ds.At(1).Strings())
+
+	clone := ep.Clone(x)
+	require.IsType(t, &ep.DictStrings{}, clone)
+	require.Equal(t, x.Strings(), clone.Strings())
+	require.True(t, ep.Same(x, x.Slice(0, 1)))
+	require.False(t, ep.Same(x, clone))
+	require.True(t, x.Equal(clone))
+}
+
+func TestConstants_cast(t *testing.T) {
+	data := ep.Constant(ep.EncodeDict([]string{"12"}), 3)
+	res, err := ep.Cast(data, ep.Int64)
+	require.NoError(t, err)
+	require.Equal(t, ep.Constant(&ep.Int64s{Values: []int64{12}}, 3), res)
+
+	res, err = ep.Cast(ep.Constant(ep.EncodeDict([]string{"x"}), 2), ep.Int64, ep.CastNulls())
+	require.NoError(t, err)
+	require.Equal(t, []bool{true, true}, res.Nulls())
+}
+
+func TestConstants_json(t *testing.T) {
+	data := ep.NewDataset(ep.Constant(&ep.Int64s{Values: []int64{7}}, 2), ep.Constant(&ep.Int64s{Values: []int64{0}, Null: ep.NullMask{1}}, 2))
+	b, err := json.Marshal(data)
+	require.NoError(t, err)
+	require.Equal(t, `[[7,null],[7,null]]`, string(b))
+	require.Equal(t, []string{"[7 7]", "[ ]"}, data.Strings())
+}
+
+// Constants are encoded as their value once, along with their length
+func TestConstants_gob(t *testing.T) {
+	value := ep.EncodeDict([]string{strings.Repeat("x", 1000)})
+	var data ep.Data = ep.Constant(value, 1000)
+
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(&data))
+	require.True(t, buf.Len() < 2000, "%d bytes", buf.Len())
+
+	var decoded ep.Data
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&decoded))
+	require.Equal(t, data.Strings(), decoded.Strings())
+	require.IsType(t, data, decoded)
+}
+
+func TestInMemoryCluster_constants(t *testing.T) {
+	cluster := eptest.InMemoryCluster(2)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	x := ep.Constant(ep.EncodeDict([]string{"x"}), 2)
+	runner := cluster.Distribute(ep.Pipeline(ep.Broadcast(), ep.Gather()))
+	res, err := eptest.Run(runner, ep.NewDataset(x, ep.EncodeDict([]string{"a", "b"})))
+	require.NoError(t, err)
+	require.Equal(t, []string{"x", "x", "x", "x"}, res.At(0).Strings())
+	require.Equal(t, []string{"a", "b", "a", "b"}, res.At(1).Strings())
+}
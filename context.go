@@ -0,0 +1,86 @@
+package ep
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithNodes returns a copy of the context with the addresses of all of the
+// nodes in the cluster, the main node among them and this node, as expected
+// by exchanges. The Distributer sets them for every runner it distributes,
+// thus it's mostly needed for running exchanges in other settings, e.g. tests
+func WithNodes(ctx context.Context, allNodes []string, masterNode, thisNode string) context.Context {
+	ctx = context.WithValue(ctx, allNodesKey, allNodes)
+	ctx = context.WithValue(ctx, masterNodeKey, masterNode)
+	return context.WithValue(ctx, thisNodeKey, thisNode)
+}
+
+// NodesFromContext returns the addresses of all of the nodes in the cluster,
+// as set in the context by WithNodes
+func NodesFromContext(ctx context.Context) ([]string, error) {
+	v := ctxValue(ctx, allNodesKey)
+	if v == nil {
+		return nil, fmt.Errorf("ep: context missing AllNodes")
+	}
+
+	nodes, ok := v.([]string)
+	if !ok {
+		return nil, fmt.Errorf("ep: context AllNodes is %T, expected []string", v)
+	}
+	return nodes, nil
+}
+
+// MasterNodeFromContext returns the address of the main node, as set in the
+// context by WithNodes
+func MasterNodeFromContext(ctx context.Context) (string, error) {
+	return ctxString(ctx, masterNodeKey, "MasterNode")
+}
+
+// ThisNodeFromContext returns the address of this node, as set in the context
+// by WithNodes. Unlike NodeAddress, it fails when the address is missing
+func ThisNodeFromContext(ctx context.Context) (string, error) {
+	return ctxString(ctx, thisNodeKey, "ThisNode")
+}
+
+// PartitionedBy returns a copy of the context indicating that the input of the
+// runners on every node is already partitioned between the nodes by the
+// provided columns, e.g. by a Partition of the same columns in a previous
+// plan over the same nodes. Partition exchanges of the same columns then let
+// their input through as is, instead of re-shuffling it. The Distributer
+// carries it to all of the nodes
+func PartitionedBy(ctx context.Context, cols ...int) context.Context {
+	return context.WithValue(ctx, partitionedKey, partitionColumns(cols))
+}
+
+// partitionedBy returns the columns by which the input is partitioned, as set
+// in the context by PartitionedBy, or nil when it isn't partitioned
+func partitionedBy(ctx context.Context) []int {
+	cols, _ := ctx.Value(partitionedKey).([]int)
+	return cols
+}
+
+func ctxString(ctx context.Context, key ctxKey, name string) (string, error) {
+	v := ctxValue(ctx, key)
+	if v == nil {
+		return "", fmt.Errorf("ep: context missing %s", name)
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("ep: context %s is %T, expected string", name, v)
+	}
+	return s, nil
+}
+
+// ctxValue returns the value of a key in the context. Values set with the
+// plain string form of the key are still supported, for compatibility with
+// code that set them before the keys were typed.
+//
+// Deprecated: the string keys will be removed in the next release
+func ctxValue(ctx context.Context, key ctxKey) interface{} {
+	v := ctx.Value(key)
+	if v == nil {
+		v = ctx.Value(string(key))
+	}
+	return v
+}
@@ -0,0 +1,70 @@
+package ep_test
+
+import (
+	"context"
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestWithNodes(t *testing.T) {
+	ctx := ep.WithNodes(context.Background(), []string{":5551", ":5552"}, ":5551", ":5552")
+
+	nodes, err := ep.NodesFromContext(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{":5551", ":5552"}, nodes)
+
+	master, err := ep.MasterNodeFromContext(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ":5551", master)
+
+	this, err := ep.ThisNodeFromContext(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ":5552", this)
+	require.Equal(t, ":5552", ep.NodeAddress(ctx))
+}
+
+func TestNodesFromContext_missing(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := ep.NodesFromContext(ctx)
+	require.EqualError(t, err, "ep: context missing AllNodes")
+
+	_, err = ep.MasterNodeFromContext(ctx)
+	require.EqualError(t, err, "ep: context missing MasterNode")
+
+	_, err = ep.ThisNodeFromContext(ctx)
+	require.EqualError(t, err, "ep: context missing ThisNode")
+	require.Equal(t, "", ep.NodeAddress(ctx))
+}
+
+func TestNodesFromContext_mistyped(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "ep.AllNodes", ":5551")
+	ctx = context.WithValue(ctx, "ep.MasterNode", []string{":5551"})
+	ctx = context.WithValue(ctx, "ep.ThisNode", 5551)
+
+	_, err := ep.NodesFromContext(ctx)
+	require.EqualError(t, err, "ep: context AllNodes is string, expected []string")
+
+	_, err = ep.MasterNodeFromContext(ctx)
+	require.EqualError(t, err, "ep: context MasterNode is []string, expected string")
+
+	_, err = ep.ThisNodeFromContext(ctx)
+	require.EqualError(t, err, "ep: context ThisNode is int, expected string")
+}
+
+// the plain string keys are still supported, for compatibility
+func TestNodesFromContext_stringKeys(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "ep.AllNodes", []string{":5551"})
+	ctx = context.WithValue(ctx, "ep.MasterNode", ":5551")
+	ctx = context.WithValue(ctx, "ep.ThisNode", ":5551")
+
+	nodes, err := ep.NodesFromContext(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{":5551"}, nodes)
+
+	master, err := ep.MasterNodeFromContext(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ":5551", master)
+	require.Equal(t, ":5551", ep.NodeAddress(ctx))
+}
@@ -0,0 +1,258 @@
+package ep
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// defaultCSVBatchSize is the number of records of every dataset of CSVScan,
+// unless set in its CSVOptions
+const defaultCSVBatchSize = 1024
+
+// CSVOptions are the options of CSVScan and CSVWrite. The zero value reads and
+// writes comma-separated records without a header
+type CSVOptions struct {
+	Comma         rune     // the delimiter of the fields, or a comma
+	Header        bool     // the first record is a header, skipped by CSVScan and written by CSVWrite
+	Names         []string // the header written by CSVWrite, or col0, col1, etc.
+	BatchSize     int      // the number of records of every dataset of CSVScan, or 1024
+	Nulls         bool     // CSVScan casts the fields that can't be cast into nulls, rather than failing
+	SkipMalformed bool     // CSVScan skips malformed records, like ragged ones, rather than failing
+}
+
+// CSVScan returns a Runner that reads the CSV records of the reader, with a
+// field of every one of the types, and outputs them in datasets of BatchSize
+// records, ignoring its input. Quoted fields are unquoted, as with
+// encoding/csv. Empty fields are nulls, and other fields are cast to the types
+// from strings, as with Cast, failing with the line and value of the first
+// field that can't be cast, unless Nulls is set.
+//
+// Unlike most Runners, it reads from the reader of the node it's created on,
+// thus it can't be distributed to other nodes
+func CSVScan(r io.Reader, types []Type, opts CSVOptions) Runner {
+	return &csvScan{r, types, opts}
+}
+
+type csvScan struct {
+	r     io.Reader
+	types []Type
+	opts  CSVOptions
+}
+
+func (r *csvScan) Returns() []Type { return r.types }
+func (r *csvScan) Run(ctx context.Context, inp, out chan Dataset) error {
+	reader := csv.NewReader(r.r)
+	reader.FieldsPerRecord = len(r.types)
+	if r.opts.Comma != 0 {
+		reader.Comma = r.opts.Comma
+	}
+
+	batchSize := r.opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultCSVBatchSize
+	}
+
+	var batch *csvBatch
+	header := r.opts.Header
+	for {
+		select {
+		case <-ctx.Done():
+			return canceledErr(ctx, ctx.Err())
+		default:
+		}
+
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if _, ok := err.(*csv.ParseError); ok && r.opts.SkipMalformed {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("ep: %s", err)
+		}
+
+		if header {
+			header = false
+			continue
+		}
+
+		if batch == nil {
+			batch = newCSVBatch(len(r.types), batchSize)
+		}
+		line, _ := reader.FieldPos(0)
+		batch.add(line, record)
+		if len(batch.lines) < batchSize {
+			continue
+		}
+
+		err = r.send(ctx, batch, out)
+		if err != nil {
+			return canceledErr(ctx, err)
+		}
+		batch = nil
+	}
+
+	if batch != nil {
+		err := r.send(ctx, batch, out)
+		if err != nil {
+			return canceledErr(ctx, err)
+		}
+	}
+
+	for range inp {
+	}
+	return nil
+}
+
+// send casts the batch to the types, and sends it
+func (r *csvScan) send(ctx context.Context, batch *csvBatch, out chan Dataset) error {
+	cols := make([]Data, len(r.types))
+	for i, t := range r.types {
+		var err error
+		cols[i], err = batch.cast(i, t, r.opts.Nulls)
+		if err != nil {
+			return err
+		}
+	}
+
+	select {
+	case out <- NewDataset(cols...):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// csvBatch are the fields of the records of a single dataset of CSVScan, by
+// their columns
+type csvBatch struct {
+	lines  []int // of every record
+	fields [][]string
+}
+
+func newCSVBatch(width, size int) *csvBatch {
+	batch := &csvBatch{make([]int, 0, size), make([][]string, width)}
+	for i := range batch.fields {
+		batch.fields[i] = make([]string, 0, size)
+	}
+	return batch
+}
+
+func (batch *csvBatch) add(line int, record []string) {
+	batch.lines = append(batch.lines, line)
+	for i, v := range record {
+		batch.fields[i] = append(batch.fields[i], v)
+	}
+}
+
+// cast returns the col-th fields, cast to the type. Fields that can't be cast
+// are nulls when nulls is set, or fail otherwise
+func (batch *csvBatch) cast(col int, t Type, nulls bool) (Data, error) {
+	values := batch.fields[col]
+	data := EncodeDict(values)
+	for i, v := range values {
+		if v == "" {
+			data.MarkNull(i)
+		}
+	}
+
+	var err error
+	res, castErr := castRows(data, t, func(row int, reason error) {
+		if !nulls && err == nil {
+			err = fmt.Errorf("ep: line %d, column %d: can't cast %q to %s: %s", batch.lines[row], col, values[row], t, reason)
+		}
+	})
+	if castErr != nil {
+		return nil, castErr
+	} else if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// CSVWrite returns a Runner that writes the datasets of its input into the
+// writer as CSV records, by the Strings of their columns, rendered one value at
+// a time when they're StringerAt, with empty fields for nulls, and outputs
+// nothing. When Header is set, the Names, or col0, col1, etc., are written
+// before the first record.
+//
+// Unlike most Runners, it writes to the writer of the node it's created on,
+// thus it can't be distributed to other nodes
+func CSVWrite(w io.Writer, opts CSVOptions) Runner {
+	return &csvWrite{w, opts}
+}
+
+type csvWrite struct {
+	w    io.Writer
+	opts CSVOptions
+}
+
+func (*csvWrite) Returns() []Type { return []Type{} }
+func (r *csvWrite) Run(_ context.Context, inp, _ chan Dataset) error {
+	writer := csv.NewWriter(r.w)
+	if r.opts.Comma != 0 {
+		writer.Comma = r.opts.Comma
+	}
+
+	header := r.opts.Header
+	writeHeader := func(width int) error {
+		if !header {
+			return nil
+		}
+
+		header = false
+		names := append([]string(nil), r.opts.Names...)
+		for i := len(names); i < width; i++ {
+			names = append(names, "col"+strconv.Itoa(i))
+		}
+		return writer.Write(names)
+	}
+
+	var buf []byte
+	for data := range inp {
+		err := writeHeader(data.Width())
+		if err != nil {
+			return err
+		}
+
+		// the Strings of the columns that aren't StringerAt
+		cols := make([][]string, data.Width())
+		for i := range cols {
+			if _, ok := data.At(i).(StringerAt); !ok {
+				cols[i] = data.At(i).Strings()
+			}
+		}
+
+		record := make([]string, len(cols))
+		for row := 0; row < data.Len(); row++ {
+			for i, col := range cols {
+				if data.At(i).IsNull(row) {
+					record[i] = ""
+				} else if col != nil {
+					record[i] = col[row]
+				} else {
+					buf = data.At(i).(StringerAt).AppendStringAt(buf[:0], row)
+					record[i] = string(buf)
+				}
+			}
+
+			err := writer.Write(record)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// the header is written even without any input, when it's known
+	if len(r.opts.Names) > 0 {
+		err := writeHeader(len(r.opts.Names))
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
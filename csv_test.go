@@ -0,0 +1,165 @@
+package ep_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCSVScan(t *testing.T) {
+	input := "id;name;score\n" +
+		"1;\"Smith; John\";1.5\n" +
+		"2;\"say \"\"hi\"\"\";\n" +
+		"3;;-2\n"
+
+	types := []ep.Type{ep.Int64, ep.DictString, ep.Float64}
+	runner := ep.CSVScan(strings.NewReader(input), types, ep.CSVOptions{Comma: ';', Header: true, BatchSize: 2})
+	require.Equal(t, types, runner.Returns())
+
+	datasets := runCSVScan(t, runner)
+	require.Equal(t, 2, len(datasets))
+	require.Equal(t, 2, datasets[0].Len())
+	require.Equal(t, 1, datasets[1].Len())
+
+	res := datasets[0].Append(datasets[1]).(ep.Dataset)
+	require.Equal(t, []int64{1, 2, 3}, res.At(0).(*ep.Int64s).Values)
+	require.Equal(t, []string{"Smith; John", `say "hi"`, ""}, res.At(1).Strings())
+	require.Equal(t, []bool{false, false, true}, res.At(1).Nulls())
+	require.Equal(t, []string{"1.5", "", "-2"}, res.At(2).Strings())
+	require.Equal(t, []bool{false, true, false}, res.At(2).Nulls())
+}
+
+func TestCSVScan_malformed(t *testing.T) {
+	input := "1,a\n2\n3,c,extra\n4,\"d\n"
+	types := []ep.Type{ep.Int64, str}
+
+	_, err := eptest.Run(ep.CSVScan(strings.NewReader(input), types, ep.CSVOptions{}))
+	require.Error(t, err)
+	require.Equal(t, "ep: record on line 2: wrong number of fields", err.Error())
+
+	// ragged rows, and unterminated quotes, are skipped
+	datasets := runCSVScan(t, ep.CSVScan(strings.NewReader(input), types, ep.CSVOptions{SkipMalformed: true}))
+	require.Equal(t, 1, len(datasets))
+	require.Equal(t, []string{"1"}, datasets[0].At(0).Strings())
+	require.Equal(t, strs{"a"}, datasets[0].At(1))
+}
+
+func TestCSVScan_castFailure(t *testing.T) {
+	input := "1,true\n2,false\nx,yes\n"
+	types := []ep.Type{ep.Int64, ep.Bool}
+
+	_, err := eptest.Run(ep.CSVScan(strings.NewReader(input), types, ep.CSVOptions{BatchSize: 2}))
+	require.Error(t, err)
+	require.Equal(t, `ep: line 3, column 0: can't cast "x" to int64: invalid syntax`, err.Error())
+
+	res, err := eptest.Run(ep.CSVScan(strings.NewReader(input), types, ep.CSVOptions{Nulls: true}))
+	require.NoError(t, err)
+	require.Equal(t, []bool{false, false, true}, res.At(0).Nulls())
+	require.Equal(t, []bool{false, false, true}, res.At(1).Nulls())
+	require.Equal(t, []string{"true", "false", ""}, res.At(1).Strings())
+
+	_, err = eptest.Run(ep.CSVScan(strings.NewReader(input), []ep.Type{ep.Timestamp, ep.Bool}, ep.CSVOptions{}))
+	require.Error(t, err)
+	require.Equal(t, "ep: no cast from dict_string to timestamp", err.Error())
+}
+
+func TestCSVScan_cancel(t *testing.T) {
+	input := strings.Repeat("1\n", 100)
+	runner := ep.CSVScan(strings.NewReader(input), []ep.Type{ep.Int64}, ep.CSVOptions{BatchSize: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	inp, out := make(chan ep.Dataset), make(chan ep.Dataset)
+	errs := make(chan error)
+	go func() { errs <- runner.Run(ctx, inp, out) }()
+
+	<-out
+	cancel()
+	require.NoError(t, <-errs)
+	close(inp)
+}
+
+func TestCSVWrite(t *testing.T) {
+	var buf bytes.Buffer
+	runner := ep.CSVWrite(&buf, ep.CSVOptions{Header: true, Names: []string{"id"}})
+	data1 := ep.NewDataset(&ep.Int64s{Values: []int64{1, 2}, Null: ep.NullMask{2}}, strs{"a,b", `say "hi"`})
+	data2 := ep.NewDataset(&ep.Int64s{Values: []int64{3}}, strs{""})
+
+	res, err := eptest.Run(runner, data1, data2)
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Width())
+	require.Equal(t, "id,col1\n1,\"a,b\"\n,\"say \"\"hi\"\"\"\n3,\n", buf.String())
+
+	// round trip, with another delimiter
+	buf.Reset()
+	opts := ep.CSVOptions{Comma: '\t'}
+	_, err = eptest.Run(ep.CSVWrite(&buf, opts), data1)
+	require.NoError(t, err)
+
+	res, err = eptest.Run(ep.CSVScan(&buf, []ep.Type{ep.Int64, str}, opts))
+	require.NoError(t, err)
+	require.Equal(t, data1.At(0).Strings(), res.At(0).Strings())
+	require.Equal(t, data1.At(0).Nulls(), res.At(0).Nulls())
+	require.Equal(t, data1.At(1), res.At(1))
+
+	// the header is written without any input, when it's known
+	buf.Reset()
+	_, err = eptest.Run(ep.CSVWrite(&buf, ep.CSVOptions{Header: true, Names: []string{"a", "b"}}))
+	require.NoError(t, err)
+	require.Equal(t, "a,b\n", buf.String())
+}
+
+// runCSVScan runs the CSVScan runner to completion, and returns the datasets
+// it outputs
+func runCSVScan(t *testing.T, runner ep.Runner) []ep.Dataset {
+	inp, out := make(chan ep.Dataset), make(chan ep.Dataset)
+	close(inp)
+
+	errs := make(chan error, 1)
+	go func() {
+		defer close(out)
+		errs <- runner.Run(context.Background(), inp, out)
+	}()
+
+	res := []ep.Dataset{}
+	for data := range out {
+		res = append(res, data)
+	}
+	require.NoError(t, <-errs)
+	return res
+}
+
+// Measures writing a million rows, with and without StringerAt, which doesn't
+// render whole columns
+func BenchmarkCSVWrite(b *testing.B) {
+	ints := &ep.Int64s{Values: make([]int64, 1000000)}
+	floats := &ep.Float64s{Values: make([]float64, 1000000)}
+	for i := range ints.Values {
+		ints.Values[i] = int64(i * 1000)
+		floats.Values[i] = float64(i) / 3
+	}
+
+	b.Run("StringerAt", func(b *testing.B) {
+		benchmarkCSVWrite(b, ep.NewDataset(ints, floats))
+	})
+	b.Run("Strings", func(b *testing.B) {
+		benchmarkCSVWrite(b, ep.NewDataset(stringsOnly{ints}, stringsOnly{floats}))
+	})
+}
+
+func benchmarkCSVWrite(b *testing.B, data ep.Dataset) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := eptest.Run(ep.CSVWrite(io.Discard, ep.CSVOptions{}), data)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// stringsOnly hides the optional interfaces of its Data, like StringerAt
+type stringsOnly struct{ ep.Data }
@@ -1,6 +1,7 @@
 package ep
 
 import (
+	"fmt"
 	"sort"
 )
 
@@ -23,7 +24,9 @@ type Data interface {
 	LessOther(thisRow int, other Data, otherRow int) bool
 
 	// Slice returns a new data object containing only the values from the start
-	// to end indices
+	// to end indices. The built-in types share the values with the new data,
+	// while their nulls are copied, thus MarkNull or Swap of either one isn't
+	// seen by the other, see NullMask
 	Slice(start, end int) Data
 
 	// Append takes another data object and appends it to this one.
@@ -35,7 +38,8 @@ type Data interface {
 	// times. returned value has Len() * t rows
 	Duplicate(t int) Data
 
-	// IsNull checks if the given index contains null
+	// IsNull checks if the given index contains null. See NullMask for
+	// implementing the nulls of a Data
 	IsNull(i int) bool
 
 	// MarkNull sets the value in the given index to null
@@ -44,8 +48,13 @@ type Data interface {
 	// Nulls returns a booleans array indicates whether the i-th value is null
 	Nulls() []bool
 
-	// Equal checks if another data object refer to same underlying data
-	// as this one (shallow comparison)
+	// Equal reports whether the other data has the same values as this one,
+	// as with DataEqual, which the built-in types implement it with.
+	//
+	// NOTE: Equal used to report whether the other data refers to the same
+	// underlying data as this one (shallow comparison), which is now reported
+	// by Same, and by Sharer. Data whose Equal compares values must implement
+	// Sharer as well, otherwise Same relies on its Equal
 	Equal(other Data) bool
 
 	// Copy copies single row from given data at fromRow position to this data,
@@ -57,26 +66,196 @@ type Data interface {
 	Strings() []string
 }
 
-// Clone the contents of the provided Data. Dataset also implements the Data
-// interface is a valid input to this function
+// Comparable is an optional interface of Data, comparing two values at once,
+// where LessOther requires two calls to tell whether they're equal. Compare
+// must agree with LessOther, including about nulls: the built-in types sort
+// nulls last, after all values
+type Comparable interface {
+	Data
+
+	// Compare returns a negative number when the thisRow-th element should
+	// sort before the otherRow-th element in other data object, a positive
+	// one when it should sort after it, and zero when they're equal
+	Compare(thisRow int, other Data, otherRow int) int
+}
+
+// Compare compares the thisRow-th element of the data to the otherRow-th
+// element of the other data, as with Comparable, using its Compare when it's
+// implemented, or two calls to LessOther otherwise. Other Constants are
+// compared by their value
+func Compare(data Data, thisRow int, other Data, otherRow int) int {
+	if c, ok := other.(*Constants); ok {
+		if _, ok := data.(*Constants); !ok {
+			other, otherRow = c.Value, 0
+		}
+	}
+
+	if c, ok := data.(Comparable); ok {
+		return c.Compare(thisRow, other, otherRow)
+	} else if data.LessOther(thisRow, other, otherRow) {
+		return -1
+	} else if other.LessOther(otherRow, data, thisRow) {
+		return 1
+	}
+	return 0
+}
+
+// DataEqual reports whether both Data are of the same Type and length, with
+// nulls at the same rows, and the same values at all of the other rows, by
+// Compare. Values of null rows aren't compared, Constants are equal to their
+// materialized values, and Datasets are equal when all of their columns are.
+// It's how the built-in types implement Equal
+func DataEqual(a, b Data) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	if ds1, ok := a.(Dataset); ok {
+		ds2, ok := b.(Dataset)
+		if !ok || ds1.Width() != ds2.Width() {
+			return false
+		}
+		for i := 0; i < ds1.Width(); i++ {
+			if !DataEqual(ds1.At(i), ds2.At(i)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !isEqualType(a.Type(), b.Type()) || a.Len() != b.Len() {
+		return false
+	}
+	for i := 0; i < a.Len(); i++ {
+		if a.IsNull(i) != b.IsNull(i) {
+			return false
+		} else if !a.IsNull(i) && Compare(a, i, b, i) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Sharer is an optional interface of Data, reporting whether it shares its
+// underlying data with another Data, such that modifying one of them might
+// modify the other. It's used by Same, and implemented by all of the built-in
+// types
+type Sharer interface {
+	Data
+
+	// Same reports whether the other data refers to the same underlying data
+	// as this one (shallow comparison)
+	Same(other Data) bool
+}
+
+// Same reports whether both Data refer to the same underlying data, as Equal
+// used to. It's used for example for sorting
+// datasets whose columns repeat, which mustn't be swapped twice. Data that
+// isn't a Sharer is the same as another when it's Equal to it
+func Same(a, b Data) bool {
+	if s, ok := a.(Sharer); ok {
+		return s.Same(b)
+	}
+	return a.Equal(b)
+}
+
+// Cloner is an optional interface of Data, copying all of its values at once,
+// where other Data is cloned by copying its rows one by one into a new Data of
+// its Type. It's used by Clone, and implemented by all of the built-in types
+type Cloner interface {
+	Data
+
+	// Clone returns a deep copy of the data, as with Clone
+	Clone() Data
+}
+
+// Clone returns a copy of the data that owns all of its values, such that
+// modifying the clone with any of the methods of Data never modifies the data,
+// nor the other way around, including the values nested in Lists and Structs,
+// the bytes of Blobs and the dictionaries of DictStrings. Immutable values,
+// like strings, might still be shared. Datasets are cloned column by column,
+// and Constants are materialized.
+//
+// Data that implements Cloner is cloned by it, while other Data is copied row
+// by row into the Data of its Type, with Copy, which must copy the values
+// rather than share them
 func Clone(data Data) Data {
-	return data.Type().Data(0).Append(data)
+	switch d := data.(type) {
+	case Dataset:
+		cols := make([]Data, d.Width())
+		for i := range cols {
+			cols[i] = Clone(d.At(i))
+		}
+		return NewDataset(cols...)
+	case Cloner:
+		return d.Clone()
+	}
+
+	res := data.Type().Data(data.Len())
+	for i := 0; i < data.Len(); i++ {
+		res.Copy(data, i, i)
+	}
+	return res
 }
 
-// Cut the Data into several sub-segments at the provided cut-point indices. It's
-// effectively the same as calling Data.Slice() multiple times. Dataset also
-// implements the Data interface is a valid input to this function
+// Cut returns a Dataset of the parts of the data between the cut points, as
+// with calling Data.Slice for every part. Dataset also implements the Data
+// interface is a valid input to this function. The cut points are sorted and
+// deduplicated, and the ones at 0 and at the end of the data are ignored, such
+// that none of the parts is empty. It panics when any of the cut points is out
+// of range, while CutSafe fails
 func Cut(data Data, cutpoints ...int) Data {
-	res := []Data{}
-	var last int
+	res, err := CutSafe(data, cutpoints...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return res
+}
+
+// CutSafe returns the parts of the data between the cut points, as with Cut,
+// failing when any of the cut points is out of range [0, Len()]
+func CutSafe(data Data, cutpoints ...int) (Data, error) {
+	n := data.Len()
+	points := make([]int, 0, len(cutpoints)+1)
 	for _, i := range cutpoints {
-		res = append(res, data.Slice(last, i))
-		last = i
+		if i < 0 || i > n {
+			return nil, fmt.Errorf("ep: cut point %d out of range for %d rows", i, n)
+		} else if i > 0 && i < n {
+			points = append(points, i)
+		}
+	}
+	sort.Ints(points)
+	if n > 0 {
+		points = append(points, n)
+	}
+
+	res := []Data{}
+	last := 0
+	for _, i := range points {
+		if i > last { // skips duplicates
+			res = append(res, data.Slice(last, i))
+			last = i
+		}
 	}
+	return NewDataset(res...), nil
+}
 
-	if last < data.Len() {
-		res = append(res, data.Slice(last, data.Len()))
+// CutDataset returns the parts of the dataset between the cut points, as with
+// CutSafe, each of all of the columns of the dataset. All of its columns must
+// have the same length
+func CutDataset(ds Dataset, cutpoints ...int) ([]Dataset, error) {
+	if err := checkLengths(ds); err != nil {
+		return nil, err
 	}
 
-	return NewDataset(res...)
+	parts, err := CutSafe(ds, cutpoints...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Dataset, parts.(Dataset).Width())
+	for i := range res {
+		res[i] = parts.(Dataset).At(i).(Dataset)
+	}
+	return res, nil
 }
@@ -26,8 +26,11 @@ func (vs strs) LessOther(thisRow int, other ep.Data, otherRow int) bool {
 	data := other.(strs)
 	return vs[thisRow] < data[otherRow]
 }
-func (vs strs) Slice(s, e int) ep.Data       { return vs[s:e] }
-func (vs strs) Append(other ep.Data) ep.Data { return append(vs, other.(strs)...) }
+func (vs strs) Slice(s, e int) ep.Data { return vs[s:e] }
+func (vs strs) Append(other ep.Data) ep.Data {
+	// without overwriting the values after slices of the data
+	return append(vs[:len(vs):len(vs)], other.(strs)...)
+}
 func (vs strs) Duplicate(t int) ep.Data {
 	ans := make(strs, 0, vs.Len()*t)
 	for i := 0; i < t; i++ {
@@ -35,10 +38,11 @@ func (vs strs) Duplicate(t int) ep.Data {
 	}
 	return ans
 }
-func (vs strs) IsNull(i int) bool { return false }
-func (vs strs) MarkNull(i int)    {}
-func (vs strs) Nulls() []bool     { return make([]bool, vs.Len()) }
-func (vs strs) Equal(other ep.Data) bool {
+func (vs strs) IsNull(i int) bool        { return false }
+func (vs strs) MarkNull(i int)           {}
+func (vs strs) Nulls() []bool            { return make([]bool, vs.Len()) }
+func (vs strs) Equal(other ep.Data) bool { return ep.DataEqual(vs, other) }
+func (vs strs) Same(other ep.Data) bool {
 	// for efficiency - avoid reflection and check address of underlying arrays
 	return fmt.Sprintf("%p", vs) == fmt.Sprintf("%p", other)
 }
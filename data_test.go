@@ -0,0 +1,156 @@
+package ep_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// Datasets are cloned column by column, by their Clone when they're Cloners,
+// or copied row by row otherwise, like strs
+func TestClone(t *testing.T) {
+	data := ep.NewDataset(strs{"a", "b"}, ep.Constant(ep.EncodeDict([]string{"x"}), 2), ep.EncodeDict([]string{"c", "d"}))
+	expected := data.Strings()
+
+	clone := ep.Clone(data).(ep.Dataset)
+	require.Equal(t, expected, clone.Strings())
+	require.IsType(t, strs{}, clone.At(0))
+	require.IsType(t, &ep.DictStrings{}, clone.At(1))
+
+	clone.At(0).Copy(strs{"z"}, 0, 0)
+	clone.At(1).Copy(ep.EncodeDict([]string{"z"}), 0, 1)
+	clone.At(2).Copy(ep.EncodeDict([]string{"z"}), 0, 1)
+	clone.Swap(0, 1)
+	require.Equal(t, []string{"[b z]", "[z x]", "[z c]"}, clone.Strings())
+	require.Equal(t, expected, data.Strings())
+	require.Equal(t, []string{"c", "d"}, data.At(2).(*ep.DictStrings).Dict.Values)
+}
+
+func TestCut(t *testing.T) {
+	data := strs{"a", "b", "c", "d"}
+	tests := []struct {
+		name      string
+		cutpoints []int
+		expected  []string
+	}{
+		{"none", nil, []string{"[a b c d]"}},
+		{"sorted", []int{1, 3}, []string{"[a]", "[b c]", "[d]"}},
+		{"unsorted", []int{3, 1}, []string{"[a]", "[b c]", "[d]"}},
+		{"duplicates", []int{2, 2, 1, 2}, []string{"[a]", "[b]", "[c d]"}},
+		{"start", []int{0}, []string{"[a b c d]"}},
+		{"end", []int{4}, []string{"[a b c d]"}},
+		{"boundaries", []int{4, 0, 2, 0}, []string{"[a b]", "[c d]"}},
+		{"all", []int{1, 2, 3}, []string{"[a]", "[b]", "[c]", "[d]"}},
+	}
+	for _, test := range tests {
+		res, err := ep.CutSafe(data, test.cutpoints...)
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.expected, res.Strings(), test.name)
+		require.Equal(t, res, ep.Cut(data, test.cutpoints...), test.name)
+	}
+
+	// empty data has no parts
+	res, err := ep.CutSafe(strs{}, 0)
+	require.NoError(t, err)
+	require.Equal(t, 0, res.(ep.Dataset).Width())
+
+	// the first cut point out of range fails
+	errs := []struct {
+		cutpoints []int
+		expected  string
+	}{
+		{[]int{-1}, "ep: cut point -1 out of range for 4 rows"},
+		{[]int{5}, "ep: cut point 5 out of range for 4 rows"},
+		{[]int{1, 5, 2}, "ep: cut point 5 out of range for 4 rows"},
+		{[]int{2, 6, -1}, "ep: cut point 6 out of range for 4 rows"},
+	}
+	for _, test := range errs {
+		_, err := ep.CutSafe(data, test.cutpoints...)
+		require.Error(t, err, "%v", test.cutpoints)
+		require.Equal(t, test.expected, err.Error())
+	}
+	require.PanicsWithValue(t, "ep: cut point -1 out of range for 4 rows", func() { ep.Cut(data, -1) })
+}
+
+func TestCutDataset(t *testing.T) {
+	data := ep.NewDataset(strs{"a", "b", "c"}, &ep.Int64s{Values: []int64{1, 2, 3}})
+	parts, err := ep.CutDataset(data, 2, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, parts, 3)
+	for i, part := range parts {
+		require.Equal(t, 2, part.Width())
+		require.Equal(t, data.At(0).Slice(i, i+1).Strings(), part.At(0).Strings())
+		require.Equal(t, data.At(1).Slice(i, i+1).Strings(), part.At(1).Strings())
+	}
+
+	_, err = ep.CutDataset(data, 4)
+	require.Equal(t, "ep: cut point 4 out of range for 3 rows", err.Error())
+
+	_, err = ep.CutDataset(ep.NewDataset(strs{"a", "b"}, strs{"a"}), 1)
+	require.Error(t, err)
+	require.Equal(t, "ep: column 1 has 1 rows, expected 2", err.Error())
+}
+
+func TestDataEqual(t *testing.T) {
+	a := &ep.Int64s{Values: []int64{1, 2, 3}, Null: ep.NullMask{2}}
+	require.True(t, ep.DataEqual(a, &ep.Int64s{Values: []int64{1, 7, 3}, Null: ep.NullMask{2}})) // values of nulls are ignored
+	require.False(t, ep.DataEqual(a, &ep.Int64s{Values: []int64{1, 2, 3}}))
+	require.False(t, ep.DataEqual(a, &ep.Int64s{Values: []int64{1, 2, 4}, Null: ep.NullMask{2}}))
+	require.False(t, ep.DataEqual(a, a.Slice(0, 2)))
+	require.False(t, ep.DataEqual(a, &ep.Float64s{Values: []float64{1, 2, 3}, Null: ep.NullMask{2}}))
+	require.False(t, ep.DataEqual(a, nil))
+	require.True(t, ep.DataEqual(nil, nil))
+
+	// of parameterized types, by their arguments
+	d1, err := ep.ParseDecimals(10, 2, []string{"1.50"})
+	require.NoError(t, err)
+	d2, err := ep.ParseDecimals(12, 2, []string{"1.50"})
+	require.NoError(t, err)
+	require.False(t, ep.DataEqual(d1, d2))
+	require.True(t, d1.Equal(ep.Clone(d1)))
+
+	// of constants and their materialized values, and of datasets
+	x := ep.Constant(ep.EncodeDict([]string{"x"}), 2)
+	require.True(t, ep.DataEqual(x, ep.EncodeDict([]string{"x", "x"})))
+	require.True(t, ep.DataEqual(ep.EncodeDict([]string{"x", "x"}), x))
+	require.True(t, ep.DataEqual(ep.NewDataset(a, x), ep.NewDataset(ep.Clone(a), ep.Clone(x))))
+	require.False(t, ep.DataEqual(ep.NewDataset(a, x), ep.NewDataset(a)))
+	require.False(t, ep.DataEqual(ep.NewDataset(a), a))
+	require.True(t, ep.NewDataset(a).Equal(ep.NewDataset(a)))
+}
+
+// Data is equal to its copies, including decoded ones, while it's only the
+// same as itself
+func TestData_Equal(t *testing.T) {
+	for name, newFn := range newData {
+		t.Run(name, func(t *testing.T) {
+			data := newFn()
+			if name != "strs" {
+				data.MarkNull(2)
+			}
+
+			var buf bytes.Buffer
+			require.NoError(t, gob.NewEncoder(&buf).Encode(&data))
+			var decoded ep.Data
+			require.NoError(t, gob.NewDecoder(&buf).Decode(&decoded))
+			require.True(t, data.Equal(decoded))
+			require.False(t, ep.Same(data, decoded))
+
+			other := ep.Clone(data)
+			other.Copy(data, 0, 1)
+			require.Equal(t, data.Strings()[0] == data.Strings()[1], data.Equal(other))
+			require.False(t, data.Equal(data.Slice(0, 2)))
+			require.True(t, ep.Same(data, data))
+		})
+	}
+}
+
+// Columns of equal values are swapped once each, unlike repeated columns
+func TestSort_equalColumns(t *testing.T) {
+	a := &ep.Int64s{Values: []int64{3, 1, 2}}
+	data := ep.NewDataset(a, ep.Clone(a), a)
+	ep.Sort(data, []ep.SortingCol{{Index: 0}})
+	require.Equal(t, []string{"[1 2 3]", "[1 2 3]", "[1 2 3]"}, data.Strings())
+}
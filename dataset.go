@@ -158,7 +158,7 @@ func (set dataset) Append(other Data) Data {
 
 	res := make(dataset, set.Width())
 	for i := range set {
-		res[i] = set[i].Append(data[i])
+		res[i] = appendData(set[i], data[i])
 	}
 	return res
 }
@@ -191,9 +191,23 @@ func (set dataset) Nulls() []bool {
 	panic("runtime error: not nullable")
 }
 
-// see Data.Equal
+// see Data.Equal. Compares the values of all of the columns, as with DataEqual
 func (set dataset) Equal(other Data) bool {
-	panic("runtime error: not comparable")
+	return DataEqual(set, other)
+}
+
+// see Sharer. Datasets are the same when all of their columns are
+func (set dataset) Same(other Data) bool {
+	data, ok := other.(dataset)
+	if !ok || len(set) != len(data) {
+		return false
+	}
+	for i, col := range set {
+		if !Same(col, data[i]) {
+			return false
+		}
+	}
+	return true
 }
 
 // see Data.Copy
@@ -207,8 +221,21 @@ func (set dataset) Copy(from Data, fromRow, toRow int) {
 // see Data.Strings
 func (set dataset) Strings() []string {
 	var res []string
+	var buf []byte
 	for _, col := range set {
-		res = append(res, "["+strings.Join(col.Strings(), " ")+"]")
+		if _, ok := col.(StringerAt); !ok {
+			res = append(res, "["+strings.Join(col.Strings(), " ")+"]")
+			continue
+		}
+
+		buf = append(buf[:0], '[')
+		for i := 0; i < col.Len(); i++ {
+			if i > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = AppendStringAt(buf, col, i)
+		}
+		res = append(res, string(append(buf, ']')))
 	}
 	return res
 }
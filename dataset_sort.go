@@ -1,14 +1,83 @@
 package ep
 
 import (
+	"fmt"
 	"sort"
 )
 
-// SortingCol defines single sorting condition, composed of col's index and
-// sort direction (asc/desc)
+// SortingCol defines single sorting condition, composed of col's index, sort
+// direction (asc/desc) and the position of its nulls
 type SortingCol struct {
 	Index int
 	Desc  bool
+	Nulls NullOrder
+}
+
+// NullOrder is the position of the nulls of a SortingCol, before or after all
+// of the values
+type NullOrder int
+
+const (
+	// NullsDefault sorts nulls last when ascending, and first when
+	// descending, as the built-in types sort them last
+	NullsDefault NullOrder = iota
+
+	// NullsFirst sorts nulls first, in both directions
+	NullsFirst
+
+	// NullsLast sorts nulls last, in both directions
+	NullsLast
+)
+
+// compare compares the i-th value of a to the j-th value of b, the data of the
+// sorting column, in its direction and with its nulls in their position
+func (col SortingCol) compare(a Data, i int, b Data, j int) int {
+	if col.Nulls != NullsDefault {
+		if null1, null2 := a.IsNull(i), b.IsNull(j); null1 || null2 {
+			c, _ := compareNulls(null1, null2)
+			if col.Nulls == NullsFirst {
+				return -c
+			}
+			return c
+		}
+	}
+
+	c := Compare(a, i, b, j)
+	if col.Desc {
+		return -c
+	}
+	return c
+}
+
+// SortDataset returns a new Dataset of the rows of the dataset sorted by the
+// sorting columns, keeping the order of the rows that are equal by all of
+// them. Only the sorting columns are compared, and every column is taken once
+// in the sorted order, as with TakeDataset, rather than swapped as by Sort.
+// All of its columns must have the same length
+func SortDataset(ds Dataset, cols []SortingCol) (Dataset, error) {
+	if err := checkLengths(ds); err != nil {
+		return nil, err
+	}
+	for _, col := range cols {
+		if col.Index < 0 || col.Index >= ds.Width() {
+			return nil, fmt.Errorf("ep: sorting column %d out of range for %d columns", col.Index, ds.Width())
+		}
+	}
+
+	indices := make([]int, ds.Len())
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		for _, col := range cols {
+			data := ds.At(col.Index)
+			if c := col.compare(data, indices[i], data, indices[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return take(ds, indices).(Dataset), nil
 }
 
 // Sort sorts given dataset by given sorting conditions
@@ -34,7 +103,7 @@ func newConditionalSortDataset(set dataset, sortingCols []SortingCol) *condition
 		unique := true
 		for j := 0; j < i; j++ {
 			// use shallow comparison in case dataset contains two different columns with the same data
-			if set[i].Equal(set[j]) {
+			if Same(set[i], set[j]) {
 				unique = false
 			}
 		}
@@ -42,37 +111,31 @@ func newConditionalSortDataset(set dataset, sortingCols []SortingCol) *condition
 			uniqueColumns = append(uniqueColumns, col)
 		}
 	}
-	sortingInterfaces := make([]sort.Interface, len(sortingCols))
+	cols := make([]Data, len(sortingCols))
 	for i, col := range sortingCols {
-		// add new sort interface for col.index-th column
-		sortingInterfaces[i] = set.At(col.Index)
-		if col.Desc {
-			sortingInterfaces[i] = sort.Reverse(sortingInterfaces[i])
-		}
+		cols[i] = set.At(col.Index)
 	}
-	return &conditionalSortDataset{uniqueColumns, sortingInterfaces}
+	return &conditionalSortDataset{uniqueColumns, sortingCols, cols}
 }
 
 type conditionalSortDataset struct {
-	uniqueColumns     []Data
-	sortingInterfaces []sort.Interface
+	uniqueColumns []Data
+	sortingCols   []SortingCol
+	cols          []Data // of the sorting columns
 }
 
-// see sort.Interface. Uses pre-defined sorting columns
+// see sort.Interface. Uses pre-defined sorting columns, comparing each one
+// once when it's Comparable, or twice with Less otherwise
 func (set *conditionalSortDataset) Less(i, j int) bool {
-	var iLessThanJ, stop bool
-	for idx := 0; idx < len(set.sortingInterfaces) && !stop; idx++ {
-		currCol := set.sortingInterfaces[idx]
-		if currCol != nil {
-			iLessThanJ = currCol.Less(i, j)
-			// iLessThanJ will be false also for equal values.
-			// if Less(l, j) and Less(j, i) are both false, values are equal. Therefore leave
-			// stop as false and keep checking next sorting columns.
-			// otherwise - values are different, and loop should stop
-			stop = iLessThanJ || currCol.Less(j, i)
+	for idx, col := range set.cols {
+		c := set.sortingCols[idx].compare(col, i, col, j)
+		if c != 0 {
+			// values are different, thus the next sorting columns don't
+			// matter. otherwise they're equal, and the next ones decide
+			return c < 0
 		}
 	}
-	return iLessThanJ
+	return false
 }
 
 // see sort.Interface
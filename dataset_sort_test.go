@@ -120,3 +120,138 @@ func TestDatasetSort_noSortingCols(t *testing.T) {
 	require.Equal(t, "[d a f g b e c]", fmt.Sprintf("%+v", dataset.At(1)))
 	require.Equal(t, "[bar hello a z world bar foo]", fmt.Sprintf("%+v", dataset.At(0)))
 }
+
+func TestDatasetSort_comparable(t *testing.T) {
+	d1 := &ep.Int64s{Values: []int64{2, 1, 2, 1, 3}}
+	d1.MarkNull(4)
+	d2 := ep.EncodeDict([]string{"a", "b", "c", "d", "e"})
+
+	dataset := ep.NewDataset(d1, d2)
+	ep.Sort(dataset, []ep.SortingCol{{Index: 0, Desc: true}, {Index: 1, Desc: false}})
+
+	// descending reverses the nulls too
+	require.Equal(t, []string{"", "2", "2", "1", "1"}, dataset.At(0).Strings())
+	require.Equal(t, []string{"e", "a", "c", "b", "d"}, dataset.At(1).Strings())
+}
+
+// countingData counts the comparisons of the wrapped Data
+type countingData struct {
+	ep.Data
+	n *int
+}
+
+func (d *countingData) Less(i, j int) bool { return d.LessOther(i, d, j) }
+func (d *countingData) LessOther(i int, other ep.Data, j int) bool {
+	*d.n++
+	return d.Data.LessOther(i, other.(*countingData).Data, j)
+}
+
+// countingComparable also counts the three-way comparisons
+type countingComparable struct{ countingData }
+
+func (d *countingComparable) LessOther(i int, other ep.Data, j int) bool {
+	return d.countingData.LessOther(i, &other.(*countingComparable).countingData, j)
+}
+func (d *countingComparable) Compare(i int, other ep.Data, j int) int {
+	*d.n++
+	return ep.Compare(d.Data, i, other.(*countingComparable).Data, j)
+}
+
+// A two-column sort, where the first column has many duplicates that are
+// decided by the second one
+func BenchmarkDatasetSort_twoColumns(b *testing.B) {
+	for _, comparable := range []bool{false, true} {
+		b.Run(fmt.Sprintf("comparable=%v", comparable), func(b *testing.B) {
+			n := 0
+			for i := 0; i < b.N; i++ {
+				cols := []ep.Data{&ep.Int64s{Values: make([]int64, 10000)}, &ep.Int64s{Values: make([]int64, 10000)}}
+				for j := 0; j < 10000; j++ {
+					cols[0].(*ep.Int64s).Values[j] = int64((j * 7919) % 10)
+					cols[1].(*ep.Int64s).Values[j] = int64((j * 104729) % 10000)
+				}
+
+				for j, col := range cols {
+					if comparable {
+						cols[j] = &countingComparable{countingData{col, &n}}
+					} else {
+						cols[j] = &countingData{col, &n}
+					}
+				}
+				ep.Sort(ep.NewDataset(cols...), []ep.SortingCol{{Index: 0}, {Index: 1}})
+			}
+			b.ReportMetric(float64(n)/float64(b.N), "comparisons/op")
+		})
+	}
+}
+
+func TestSortDataset(t *testing.T) {
+	keys := &ep.Int64s{Values: []int64{2, 0, 1, 2, 0, 1}, Null: ep.NullMask{2 | 16}}
+	names := ep.EncodeDict([]string{"b", "a", "b", "a", "c", "a"})
+	ids := strs{"0", "1", "2", "3", "4", "5"}
+	data := ep.NewDataset(keys, names, ids)
+
+	tests := []struct {
+		name     string
+		cols     []ep.SortingCol
+		expected []string
+	}{
+		{"asc", []ep.SortingCol{{Index: 0}}, []string{"[1 1 2 2  ]", "[b a b a a c]", "[2 5 0 3 1 4]"}},
+		{"desc", []ep.SortingCol{{Index: 0, Desc: true}}, []string{"[  2 2 1 1]", "[a c b a b a]", "[1 4 0 3 2 5]"}},
+		{"nulls first", []ep.SortingCol{{Index: 0, Nulls: ep.NullsFirst}}, []string{"[  1 1 2 2]", "[a c b a b a]", "[1 4 2 5 0 3]"}},
+		{"desc nulls last", []ep.SortingCol{{Index: 0, Desc: true, Nulls: ep.NullsLast}}, []string{"[2 2 1 1  ]", "[b a b a a c]", "[0 3 2 5 1 4]"}},
+		{"ties", []ep.SortingCol{{Index: 1}}, []string{"[ 2 1 2 1 ]", "[a a a b b c]", "[1 3 5 0 2 4]"}},
+		{"two keys", []ep.SortingCol{{Index: 1}, {Index: 0}}, []string{"[1 2  1 2 ]", "[a a a b b c]", "[5 3 1 2 0 4]"}},
+		{"none", nil, data.Strings()},
+	}
+	for _, test := range tests {
+		res, err := ep.SortDataset(data, test.cols)
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.expected, res.Strings(), test.name)
+	}
+	require.Equal(t, []string{"0", "1", "2", "3", "4", "5"}, data.At(2).Strings()) // not modified
+
+	_, err := ep.SortDataset(data, []ep.SortingCol{{Index: 3}})
+	require.Error(t, err)
+	require.Equal(t, "ep: sorting column 3 out of range for 3 columns", err.Error())
+
+	_, err = ep.SortDataset(ep.NewDataset(ids, strs{"a"}), []ep.SortingCol{{Index: 0}})
+	require.Error(t, err)
+	require.Equal(t, "ep: column 1 has 1 rows, expected 6", err.Error())
+}
+
+// Nulls are positioned by Sort as well
+func TestDatasetSort_nulls(t *testing.T) {
+	keys := &ep.Int64s{Values: []int64{2, 0, 1}, Null: ep.NullMask{2}}
+	data := ep.NewDataset(keys, strs{"a", "b", "c"})
+	ep.Sort(data, []ep.SortingCol{{Index: 0, Nulls: ep.NullsFirst}})
+	require.Equal(t, []string{"[ 1 2]", "[b c a]"}, data.Strings())
+}
+
+// Sorting by a single column of ten, by taking every column once in the sorted
+// order, or by swapping all of them
+func BenchmarkSortDataset(b *testing.B) {
+	for _, take := range []bool{true, false} {
+		b.Run(fmt.Sprintf("take=%v", take), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				cols := make([]ep.Data, 10)
+				for j := range cols {
+					values := make([]int64, 10000)
+					for k := range values {
+						values[k] = int64((k * 104729) % 10000)
+					}
+					cols[j] = &ep.Int64s{Values: values}
+				}
+				data := ep.NewDataset(cols...)
+				b.StartTimer()
+
+				if take {
+					ep.SortDataset(data, []ep.SortingCol{{Index: 0}})
+				} else {
+					ep.Sort(data, []ep.SortingCol{{Index: 0}})
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package ep
+
+import (
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+)
+
+var _ = Types.
+	Register("decimal", Decimal(38, 9)).
+	RegisterFactory("decimal", decimalFactory)
+
+// Decimal returns the Type of columns of fixed-point decimal numbers, with up
+// to precision digits, scale of which are fraction digits, as in SQL's
+// DECIMAL(precision, scale). Its Data is Decimals. The types of all precisions
+// and scales are registered together in Types, under "decimal", and they're
+// equal to one another only when both parameters match, by their Args
+func Decimal(precision, scale int) Type {
+	if err := checkDecimal(precision, scale); err != nil {
+		panic("ep: " + err.Error())
+	}
+	return &decimalType{precision, scale}
+}
+
+func checkDecimal(precision, scale int) error {
+	if precision < 1 || scale < 0 || scale > precision {
+		return fmt.Errorf("invalid decimal(%d,%d)", precision, scale)
+	}
+	return nil
+}
+
+// decimalFactory returns the Decimal of the precision and scale arguments
+func decimalFactory(args ...interface{}) (Type, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected precision and scale, got %d arguments", len(args))
+	}
+
+	precision, ok1 := args[0].(int)
+	scale, ok2 := args[1].(int)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("expected int precision and scale, got %v", args)
+	} else if err := checkDecimal(precision, scale); err != nil {
+		return nil, err
+	}
+	return Decimal(precision, scale), nil
+}
+
+type decimalType struct {
+	Precision int
+	Scale     int
+}
+
+func (t *decimalType) String() string      { return t.Name() }
+func (t *decimalType) Args() []interface{} { return []interface{}{t.Precision, t.Scale} }
+func (t *decimalType) Name() string {
+	return fmt.Sprintf("decimal(%d,%d)", t.Precision, t.Scale)
+}
+func (t *decimalType) Data(n int) Data {
+	return &Decimals{Precision: t.Precision, Scale: t.Scale, Values: make([]big.Int, n)}
+}
+func (t *decimalType) DataEmpty(n int) Data {
+	return &Decimals{Precision: t.Precision, Scale: t.Scale, Values: make([]big.Int, 0, n)}
+}
+
+// Decimals is the Data of the Decimal types. Every value is kept unscaled, as
+// an integer of its smallest units: 12.34 is 1234 at scale 2. Values are
+// compared numerically, and their Strings have exactly Scale fraction digits.
+// Nulls sort after all values
+type Decimals struct {
+	Precision int
+	Scale     int
+	Values    []big.Int // unscaled
+	Null      NullMask
+}
+
+// ParseDecimals parses the values, like "-12.34", into Decimals of the
+// precision and scale. Values with more fraction digits than the scale, or
+// more digits than the precision, fail rather than losing digits. Empty values
+// are nulls
+func ParseDecimals(precision, scale int, values []string) (*Decimals, error) {
+	res := Decimal(precision, scale).Data(len(values)).(*Decimals)
+	for i, v := range values {
+		if v == "" {
+			res.MarkNull(i)
+			continue
+		}
+
+		err := res.parse(i, v)
+		if err != nil {
+			return nil, fmt.Errorf("ep: row %d: %s", i, err)
+		}
+	}
+	return res, nil
+}
+
+func (vs *Decimals) parse(i int, v string) error {
+	digits := strings.TrimPrefix(strings.TrimPrefix(v, "-"), "+")
+	whole, frac := digits, ""
+	if dot := strings.IndexByte(digits, '.'); dot >= 0 {
+		whole, frac = digits[:dot], digits[dot+1:]
+	}
+
+	if whole+frac == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return fmt.Errorf("%s isn't a decimal number", v)
+	} else if len(frac) > vs.Scale {
+		return fmt.Errorf("%s has more than %d fraction digits", v, vs.Scale)
+	}
+
+	vs.Values[i].SetString(whole+frac+strings.Repeat("0", vs.Scale-len(frac)), 10)
+	if strings.HasPrefix(v, "-") {
+		vs.Values[i].Neg(&vs.Values[i])
+	}
+	return vs.checkPrecision(i)
+}
+
+// checkPrecision fails when the i-th value has more digits than the precision
+func (vs *Decimals) checkPrecision(i int) error {
+	digits := new(big.Int).Abs(&vs.Values[i]).String()
+	if len(digits) > vs.Precision {
+		return fmt.Errorf("%s overflows %s", vs.format(i), vs.Type())
+	}
+	return nil
+}
+
+// Type returns its Decimal type, of its precision and scale
+func (vs *Decimals) Type() Type { return &decimalType{vs.Precision, vs.Scale} }
+
+// Len returns the number of values
+func (vs *Decimals) Len() int { return len(vs.Values) }
+
+// Less reports whether the i-th value sorts before the j-th one
+func (vs *Decimals) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+
+// Swap swaps the i-th and the j-th values, along with their nulls
+func (vs *Decimals) Swap(i, j int) {
+	vs.Values[i], vs.Values[j] = vs.Values[j], vs.Values[i]
+	vs.Null.Swap(i, j)
+}
+
+// LessOther reports whether the thisRow-th value sorts before the
+// otherRow-th value of the other data
+func (vs *Decimals) LessOther(thisRow int, other Data, otherRow int) bool {
+	return vs.Compare(thisRow, other, otherRow) < 0
+}
+
+// Compare compares the values numerically, even when the other Decimals
+// have another scale
+func (vs *Decimals) Compare(thisRow int, other Data, otherRow int) int {
+	data := other.(*Decimals)
+	if c, ok := compareNulls(vs.IsNull(thisRow), data.IsNull(otherRow)); ok {
+		return c
+	}
+	v1, v2 := &vs.Values[thisRow], &data.Values[otherRow]
+	if vs.Scale < data.Scale {
+		v1 = rescale(v1, data.Scale-vs.Scale)
+	} else if vs.Scale > data.Scale {
+		v2 = rescale(v2, vs.Scale-data.Scale)
+	}
+	return v1.Cmp(v2)
+}
+
+// Hash hashes the values without their trailing fraction zeros, such that
+// equal values of Decimals of different scales have the same hash
+func (vs *Decimals) Hash(row int, h hash.Hash64) {
+	v, scale := &vs.Values[row], vs.Scale
+	if v.Sign() != 0 {
+		ten, q, r := big.NewInt(10), new(big.Int), new(big.Int)
+		for ; scale > 0; scale-- {
+			if q.QuoRem(v, ten, r); r.Sign() != 0 {
+				break
+			}
+			v = new(big.Int).Set(q)
+		}
+	} else {
+		scale = 0
+	}
+	h.Write([]byte{byte(v.Sign() + 1)})
+	hashBytes(h, v.Bytes())
+	hashUint64(h, uint64(scale))
+}
+
+// Slice returns the values from the start to the end indices
+func (vs *Decimals) Slice(s, e int) Data {
+	return &Decimals{vs.Precision, vs.Scale, vs.Values[s:e], vs.Null.Slice(s, e)}
+}
+
+// Append copies the values, as big.Ints mustn't share their buffers
+func (vs *Decimals) Append(other Data) Data {
+	data := other.(*Decimals)
+	res := make([]big.Int, vs.Len()+data.Len())
+	copyInts(res, vs.Values)
+	copyInts(res[vs.Len():], data.Values)
+	return &Decimals{vs.Precision, vs.Scale, res, vs.Null.Append(vs.Len(), data.Null)}
+}
+
+// AppendAll copies the digits of the values, as with Append
+func (vs *Decimals) AppendAll(others ...Data) Data {
+	values, nulls := appendAll(vs, others, func(data Data) ([]big.Int, NullMask) {
+		return data.(*Decimals).Values, data.(*Decimals).Null
+	})
+	res := make([]big.Int, len(values))
+	copyInts(res, values)
+	return &Decimals{vs.Precision, vs.Scale, res, nulls}
+}
+
+// Duplicate returns the values repeated t times
+func (vs *Decimals) Duplicate(t int) Data {
+	res := make([]big.Int, vs.Len()*t)
+	for i := 0; i < t; i++ {
+		copyInts(res[i*vs.Len():], vs.Values)
+	}
+	return &Decimals{vs.Precision, vs.Scale, res, vs.Null.Duplicate(vs.Len(), t)}
+}
+
+// IsNull reports whether the i-th value is null
+func (vs *Decimals) IsNull(i int) bool { return vs.Null.Get(i) }
+
+// MarkNull marks the i-th value as null
+func (vs *Decimals) MarkNull(i int) { vs.Null.Set(i, true) }
+
+// Nulls reports whether each one of the values is null
+func (vs *Decimals) Nulls() []bool { return vs.Null.Nulls(vs.Len()) }
+
+// Equal reports whether the other data has the same values, as with
+// DataEqual
+func (vs *Decimals) Equal(other Data) bool { return DataEqual(vs, other) }
+
+// Same reports whether the other data shares the values, see Sharer
+func (vs *Decimals) Same(other Data) bool {
+	data, ok := other.(*Decimals)
+	return ok && (vs == data || vs.Len() > 0 && data.Len() > 0 && &vs.Values[0] == &data.Values[0])
+}
+
+// Copy copies the value at the scale of this Decimals. Fraction digits beyond
+// its scale are truncated
+func (vs *Decimals) Copy(from Data, fromRow, toRow int) {
+	src := from.(*Decimals)
+	vs.Values[toRow].Set(rescale(&src.Values[fromRow], vs.Scale-src.Scale))
+	vs.Null.Copy(src.Null, fromRow, toRow)
+}
+
+// Clone copies the digits of the values, which big.Int shares otherwise
+func (vs *Decimals) Clone() Data {
+	res := make([]big.Int, vs.Len())
+	copyInts(res, vs.Values)
+	return &Decimals{vs.Precision, vs.Scale, res, vs.Null.Slice(0, vs.Len())}
+}
+
+// Size returns the number of bytes of the values, see Sized
+func (vs *Decimals) Size() uint64 {
+	res := uint64(vs.Len())*bigIntSize + vs.Null.Size()
+	for i := range vs.Values {
+		res += uint64(len(vs.Values[i].Bits())) * bigWordSize
+	}
+	return res
+}
+
+// Strings returns the string representations of the values, which are
+// empty for nulls
+func (vs *Decimals) Strings() []string {
+	res := make([]string, vs.Len())
+	for i := range vs.Values {
+		if !vs.IsNull(i) {
+			res[i] = vs.format(i)
+		}
+	}
+	return res
+}
+
+// AppendStringAt appends the string representation of the row-th value to
+// dst, see StringerAt
+func (vs *Decimals) AppendStringAt(dst []byte, row int) []byte {
+	if vs.IsNull(row) {
+		return dst
+	}
+	return vs.appendFormat(dst, row)
+}
+
+// MarshalJSONValue marshals the values as JSON numbers, with all of their
+// digits, even when they're beyond the precision of floats
+func (vs *Decimals) MarshalJSONValue(row int) ([]byte, error) {
+	return vs.appendFormat(nil, row), nil
+}
+
+// UnmarshalJSONValue unmarshals JSON numbers, or strings, as with
+// ParseDecimals
+func (vs *Decimals) UnmarshalJSONValue(row int, b []byte) error {
+	b = unquoteJSON(b)
+	return vs.parse(row, string(b))
+}
+
+// format returns the i-th value with exactly Scale fraction digits
+func (vs *Decimals) format(i int) string { return string(vs.appendFormat(nil, i)) }
+
+// appendFormat appends the i-th value, with a dot before its last Scale
+// digits, as with format
+func (vs *Decimals) appendFormat(dst []byte, i int) []byte {
+	v := &vs.Values[i]
+	start := len(dst)
+	if v.Sign() < 0 {
+		start++ // after the minus sign
+	}
+	dst = v.Append(dst, 10)
+	if vs.Scale == 0 {
+		return dst
+	}
+
+	// at least a single zero before the dot
+	if digits := len(dst) - start; digits <= vs.Scale {
+		zeros := vs.Scale - digits + 1
+		for j := 0; j < zeros; j++ {
+			dst = append(dst, '0')
+		}
+		copy(dst[start+zeros:], dst[start:start+digits])
+		for j := 0; j < zeros; j++ {
+			dst[start+j] = '0'
+		}
+	}
+
+	dot := len(dst) - vs.Scale
+	dst = append(dst, 0)
+	copy(dst[dot+1:], dst[dot:])
+	dst[dot] = '.'
+	return dst
+}
+
+// AddDecimals returns the sums of the values of a and b, row by row, which
+// must be Decimals of the same scale and length. Sums with a null are null.
+// The sums have the larger precision of the two, and fail when they overflow
+// it
+func AddDecimals(a, b Data) (Data, error) {
+	return decimalsOp(a, b, (*big.Int).Add)
+}
+
+// SubDecimals returns the differences of the values of b from the ones of a,
+// row by row, like AddDecimals
+func SubDecimals(a, b Data) (Data, error) {
+	return decimalsOp(a, b, (*big.Int).Sub)
+}
+
+func decimalsOp(a, b Data, op func(z, x, y *big.Int) *big.Int) (Data, error) {
+	x, ok1 := a.(*Decimals)
+	y, ok2 := b.(*Decimals)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("ep: expected decimals, got %s and %s", a.Type(), b.Type())
+	} else if x.Scale != y.Scale {
+		return nil, fmt.Errorf("ep: mismatching decimal scales: %s and %s", x.Type(), y.Type())
+	} else if x.Len() != y.Len() {
+		return nil, fmt.Errorf("ep: mismatching lengths: %d and %d", x.Len(), y.Len())
+	}
+
+	precision := x.Precision
+	if y.Precision > precision {
+		precision = y.Precision
+	}
+
+	res := Decimal(precision, x.Scale).Data(x.Len()).(*Decimals)
+	for i := range res.Values {
+		if x.IsNull(i) || y.IsNull(i) {
+			res.MarkNull(i)
+			continue
+		}
+
+		op(&res.Values[i], &x.Values[i], &y.Values[i])
+		err := res.checkPrecision(i)
+		if err != nil {
+			return nil, fmt.Errorf("ep: row %d: %s", i, err)
+		}
+	}
+	return res, nil
+}
+
+// rescale returns the value multiplied by 10 to the power of n, or divided,
+// truncating, when n is negative
+func rescale(v *big.Int, n int) *big.Int {
+	if n == 0 {
+		return v
+	}
+
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(n))), nil)
+	if n > 0 {
+		return new(big.Int).Mul(v, pow)
+	}
+	return new(big.Int).Quo(v, pow)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// copyInts copies the values of src into dst, without sharing their buffers
+func copyInts(dst, src []big.Int) {
+	for i := range src {
+		dst[i].Set(&src[i])
+	}
+}
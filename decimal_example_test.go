@@ -0,0 +1,16 @@
+package ep_test
+
+import (
+	"fmt"
+	"github.com/panoplyio/ep"
+)
+
+func ExampleAddDecimals() {
+	prices, _ := ep.ParseDecimals(10, 2, []string{"0.10", "19.99"})
+	fees, _ := ep.ParseDecimals(10, 2, []string{"0.20", "0.01"})
+
+	totals, err := ep.AddDecimals(prices, fees)
+	fmt.Println(totals.Strings(), err)
+
+	// Output: [0.30 20.00] <nil>
+}
@@ -0,0 +1,120 @@
+package ep_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+)
+
+func TestDecimals_strings(t *testing.T) {
+	data, err := ep.ParseDecimals(10, 2, []string{"12.34", "-0.05", "7", "+1.5", "0", ""})
+	require.NoError(t, err)
+	require.Equal(t, []string{"12.34", "-0.05", "7.00", "1.50", "0.00", ""}, data.Strings())
+
+	data, err = ep.ParseDecimals(5, 0, []string{"-12", "12345"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"-12", "12345"}, data.Strings())
+}
+
+func TestParseDecimals_errors(t *testing.T) {
+	for v, msg := range map[string]string{
+		"1.234": "ep: row 0: 1.234 has more than 2 fraction digits",
+		"1234":  "ep: row 0: 1234.00 overflows decimal(5,2)",
+		"1e3":   "ep: row 0: 1e3 isn't a decimal number",
+		"--1":   "ep: row 0: --1 isn't a decimal number",
+		".":     "ep: row 0: . isn't a decimal number",
+	} {
+		_, err := ep.ParseDecimals(5, 2, []string{v})
+		require.Error(t, err, v)
+		require.Equal(t, msg, err.Error())
+	}
+}
+
+func TestDecimals_sort(t *testing.T) {
+	data, err := ep.ParseDecimals(38, 9, []string{"10", "-2.5", "", "9.999999999", "-2.25"})
+	require.NoError(t, err)
+
+	sort.Sort(data)
+	require.Equal(t, []string{"-2.500000000", "-2.250000000", "9.999999999", "10.000000000", ""}, data.Strings())
+
+	// numerically, across scales
+	other, err := ep.ParseDecimals(4, 1, []string{"10.0"})
+	require.NoError(t, err)
+	require.True(t, data.LessOther(2, other, 0))
+	require.False(t, data.LessOther(3, other, 0))
+	require.False(t, other.LessOther(0, data, 3))
+}
+
+func TestDecimal_type(t *testing.T) {
+	require.Equal(t, "decimal(38,9)", ep.Decimal(38, 9).Name())
+	require.True(t, ep.AreEqualTypes([]ep.Type{ep.Decimal(10, 2)}, []ep.Type{ep.Decimal(10, 2)}))
+	require.False(t, ep.AreEqualTypes([]ep.Type{ep.Decimal(10, 2)}, []ep.Type{ep.Decimal(10, 3)}))
+	require.Equal(t, ep.Decimal(10, 2), ep.Decimal(10, 2).Data(1).Type())
+	require.Panics(t, func() { ep.Decimal(2, 3) })
+}
+
+// Values beyond int64, and their scale, survive gob exactly
+func TestDecimals_gob(t *testing.T) {
+	var data ep.Data
+	data, err := ep.ParseDecimals(38, 9, []string{"-12345678901234567890123456789.123456789", "0.000000001"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(&data))
+	var decoded ep.Data
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&decoded))
+	require.Equal(t, ep.Decimal(38, 9), decoded.Type())
+	require.Equal(t, data.Strings(), decoded.Strings())
+}
+
+// Clones don't share the values of the original
+func TestDecimals_clone(t *testing.T) {
+	data, err := ep.ParseDecimals(38, 2, []string{"123456789012345678901234.56", "1.00"})
+	require.NoError(t, err)
+
+	clone := ep.Clone(data)
+	clone.Copy(data, 1, 0)
+	require.Equal(t, []string{"1.00", "1.00"}, clone.Strings())
+	require.Equal(t, []string{"123456789012345678901234.56", "1.00"}, data.Strings())
+}
+
+func TestAddDecimals(t *testing.T) {
+	a, err := ep.ParseDecimals(10, 2, []string{"1.10", "", "-5.00"})
+	require.NoError(t, err)
+	b, err := ep.ParseDecimals(12, 2, []string{"2.25", "1.00", "3.50"})
+	require.NoError(t, err)
+
+	sum, err := ep.AddDecimals(a, b)
+	require.NoError(t, err)
+	require.Equal(t, ep.Decimal(12, 2), sum.Type())
+	require.Equal(t, []string{"3.35", "", "-1.50"}, sum.Strings())
+
+	diff, err := ep.SubDecimals(a, b)
+	require.NoError(t, err)
+	require.Equal(t, []string{"-1.15", "", "-8.50"}, diff.Strings())
+}
+
+func TestAddDecimals_errors(t *testing.T) {
+	a, _ := ep.ParseDecimals(3, 2, []string{"9.99"})
+	b, _ := ep.ParseDecimals(3, 1, []string{"9.9"})
+	c, _ := ep.ParseDecimals(3, 2, []string{"0.01", "0.01"})
+
+	_, err := ep.AddDecimals(a, a)
+	require.Error(t, err)
+	require.Equal(t, "ep: row 0: 19.98 overflows decimal(3,2)", err.Error())
+
+	_, err = ep.AddDecimals(a, b)
+	require.Error(t, err)
+	require.Equal(t, "ep: mismatching decimal scales: decimal(3,2) and decimal(3,1)", err.Error())
+
+	_, err = ep.SubDecimals(a, c)
+	require.Error(t, err)
+	require.Equal(t, "ep: mismatching lengths: 1 and 2", err.Error())
+
+	_, err = ep.AddDecimals(a, strs{"1"})
+	require.Error(t, err)
+	require.Equal(t, "ep: expected decimals, got decimal(3,2) and string", err.Error())
+}
@@ -0,0 +1,262 @@
+package ep
+
+import (
+	"cmp"
+	"encoding/json"
+	"hash"
+)
+
+// DictString is the built-in Type of dictionary-encoded string columns, backed
+// by the DictStrings Data implementation. It suits columns of few distinct
+// values, like countries or statuses, which it stores, and sends, only once
+// per batch
+var DictString = &dictStringType{}
+
+var _ = Types.Register("dict_string", DictString)
+
+type dictStringType struct{}
+
+func (t *dictStringType) String() string { return t.Name() }
+func (*dictStringType) Name() string     { return "dict_string" }
+func (*dictStringType) Data(n int) Data {
+	return &DictStrings{Indices: make([]int32, n), Dict: &Dictionary{Values: []string{""}}}
+}
+func (*dictStringType) DataEmpty(n int) Data {
+	return &DictStrings{Indices: make([]int32, 0, n), Dict: &Dictionary{}}
+}
+
+// EncodeDict returns the dictionary-encoded values
+func EncodeDict(values []string) *DictStrings {
+	res := &DictStrings{Indices: make([]int32, len(values)), Dict: &Dictionary{}}
+	for i, v := range values {
+		res.Indices[i] = res.Dict.index(v)
+	}
+	return res
+}
+
+// DecodeDict returns the decoded values of the data, with empty strings for
+// the nulls, like its Strings
+func DecodeDict(data *DictStrings) []string {
+	return data.Strings()
+}
+
+// DictStrings is the Data of the DictString type: the index of every value in
+// the dictionary of the distinct values. Values are compared as strings, and
+// nulls sort after all values.
+//
+// Slice and Duplicate share the dictionary. Append merges the dictionary of
+// the other data into a new one, when they're different. Copy adds the value
+// to the dictionary, which is seen by all of the data that shares it
+type DictStrings struct {
+	Indices []int32
+	Dict    *Dictionary
+	Null    NullMask
+}
+
+// Dictionary is the dictionary of the distinct values of DictStrings, which
+// might be shared by several of them
+type Dictionary struct {
+	Values []string
+	lookup map[string]int32 // indices of the values, built upon the first use
+}
+
+// index returns the index of the value, adding it when it's missing
+func (d *Dictionary) index(v string) int32 {
+	if d.lookup == nil {
+		d.lookup = make(map[string]int32, len(d.Values))
+		for i, v := range d.Values {
+			d.lookup[v] = int32(i)
+		}
+	}
+
+	idx, ok := d.lookup[v]
+	if !ok {
+		idx = int32(len(d.Values))
+		d.Values = append(d.Values, v)
+		d.lookup[v] = idx
+	}
+	return idx
+}
+
+// Type returns the DictString type
+func (*DictStrings) Type() Type { return DictString }
+
+// Len returns the number of values
+func (vs *DictStrings) Len() int { return len(vs.Indices) }
+
+// Less reports whether the i-th value sorts before the j-th one
+func (vs *DictStrings) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+
+// Swap swaps the i-th and the j-th values, along with their nulls
+func (vs *DictStrings) Swap(i, j int) {
+	vs.Indices[i], vs.Indices[j] = vs.Indices[j], vs.Indices[i]
+	vs.Null.Swap(i, j)
+}
+
+// LessOther reports whether the thisRow-th value sorts before the
+// otherRow-th value of the other data
+func (vs *DictStrings) LessOther(thisRow int, other Data, otherRow int) bool {
+	return vs.Compare(thisRow, other, otherRow) < 0
+}
+
+// Compare compares the thisRow-th value to the otherRow-th value of the
+// other data, see Comparable
+func (vs *DictStrings) Compare(thisRow int, other Data, otherRow int) int {
+	data := other.(*DictStrings)
+	if c, ok := compareNulls(vs.IsNull(thisRow), data.IsNull(otherRow)); ok {
+		return c
+	}
+	return cmp.Compare(vs.value(thisRow), data.value(otherRow))
+}
+
+// Hash hashes the strings, rather than their indices, which depend on the
+// dictionary. Equal strings of other Data that isn't Hashable have the same
+// hash
+func (vs *DictStrings) Hash(row int, h hash.Hash64) { hashString(h, vs.value(row)) }
+
+// Slice returns the values from the start to the end indices
+func (vs *DictStrings) Slice(s, e int) Data {
+	return &DictStrings{vs.Indices[s:e], vs.Dict, vs.Null.Slice(s, e)}
+}
+
+// Append returns the values followed by the ones of the other data
+func (vs *DictStrings) Append(other Data) Data {
+	data := other.(*DictStrings)
+	res := &DictStrings{
+		Indices: append(vs.Indices[:vs.Len():vs.Len()], data.Indices...),
+		Dict:    vs.Dict,
+		Null:    vs.Null.Append(vs.Len(), data.Null),
+	}
+
+	if vs.Dict != data.Dict {
+		res.Dict = &Dictionary{Values: append([]string(nil), vs.Dict.Values...)}
+		for i, idx := range data.Indices {
+			res.Indices[vs.Len()+i] = res.Dict.index(data.Dict.Values[idx])
+		}
+	}
+	return res
+}
+
+// AppendAll shares the dictionary when all of the data shares it, and merges
+// the other dictionaries into a new one otherwise, as with Append
+func (vs *DictStrings) AppendAll(others ...Data) Data {
+	indices, nulls := appendAll(vs, others, func(data Data) ([]int32, NullMask) {
+		return data.(*DictStrings).Indices, data.(*DictStrings).Null
+	})
+
+	res := &DictStrings{indices, vs.Dict, nulls}
+	offset := vs.Len()
+	for _, other := range others {
+		data := other.(*DictStrings)
+		if data.Dict != vs.Dict { // whose indices are kept by the new dictionary
+			if res.Dict == vs.Dict {
+				res.Dict = &Dictionary{Values: append([]string(nil), vs.Dict.Values...)}
+			}
+			for i, idx := range data.Indices {
+				res.Indices[offset+i] = res.Dict.index(data.Dict.Values[idx])
+			}
+		}
+		offset += data.Len()
+	}
+	return res
+}
+
+// Duplicate returns the values repeated t times
+func (vs *DictStrings) Duplicate(t int) Data {
+	res := make([]int32, 0, vs.Len()*t)
+	for i := 0; i < t; i++ {
+		res = append(res, vs.Indices...)
+	}
+	return &DictStrings{res, vs.Dict, vs.Null.Duplicate(vs.Len(), t)}
+}
+
+// IsNull reports whether the i-th value is null
+func (vs *DictStrings) IsNull(i int) bool { return vs.Null.Get(i) }
+
+// MarkNull marks the i-th value as null
+func (vs *DictStrings) MarkNull(i int) { vs.Null.Set(i, true) }
+
+// Nulls reports whether each one of the values is null
+func (vs *DictStrings) Nulls() []bool { return vs.Null.Nulls(vs.Len()) }
+
+// Equal reports whether the other data has the same values, as with
+// DataEqual
+func (vs *DictStrings) Equal(other Data) bool { return DataEqual(vs, other) }
+
+// Same reports whether the other data shares the values, see Sharer
+func (vs *DictStrings) Same(other Data) bool {
+	data, ok := other.(*DictStrings)
+	return ok && (vs == data || vs.Len() > 0 && data.Len() > 0 && &vs.Indices[0] == &data.Indices[0])
+}
+
+// Copy copies the fromRow-th value of the other data to the toRow-th value
+func (vs *DictStrings) Copy(from Data, fromRow, toRow int) {
+	src := from.(*DictStrings)
+	if vs.Dict == src.Dict {
+		vs.Indices[toRow] = src.Indices[fromRow]
+	} else {
+		vs.Indices[toRow] = vs.Dict.index(src.value(fromRow))
+	}
+	vs.Null.Copy(src.Null, fromRow, toRow)
+}
+
+// Take shares the dictionary, like Slice
+func (vs *DictStrings) Take(indices []int) Data {
+	return &DictStrings{takeValues(vs.Indices, indices), vs.Dict, vs.Null.Take(indices)}
+}
+
+// Clone copies the dictionary, which is otherwise shared, as it's modified by
+// Copy
+func (vs *DictStrings) Clone() Data {
+	dict := &Dictionary{Values: append([]string(nil), vs.Dict.Values...)}
+	return &DictStrings{append([]int32(nil), vs.Indices...), dict, vs.Null.Slice(0, vs.Len())}
+}
+
+// Size includes the whole dictionary, even when it's shared
+func (vs *DictStrings) Size() uint64 {
+	res := uint64(vs.Len())*4 + vs.Null.Size()
+	for _, v := range vs.Dict.Values {
+		res += stringHeaderSize + uint64(len(v))
+	}
+	return res
+}
+
+// Strings returns the string representations of the values, which are
+// empty for nulls
+func (vs *DictStrings) Strings() []string {
+	res := make([]string, vs.Len())
+	for i := range vs.Indices {
+		if !vs.IsNull(i) {
+			res[i] = vs.value(i)
+		}
+	}
+	return res
+}
+
+// AppendStringAt appends the string representation of the row-th value to
+// dst, see StringerAt
+func (vs *DictStrings) AppendStringAt(dst []byte, row int) []byte {
+	if vs.IsNull(row) {
+		return dst
+	}
+	return append(dst, vs.value(row)...)
+}
+
+// MarshalJSONValue returns the JSON encoding of the row-th value, see
+// JSONData
+func (vs *DictStrings) MarshalJSONValue(row int) ([]byte, error) {
+	return json.Marshal(vs.value(row))
+}
+
+// UnmarshalJSONValue sets the row-th value to the JSON encoded one, see
+// JSONData
+func (vs *DictStrings) UnmarshalJSONValue(row int, b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	vs.Indices[row] = vs.Dict.index(s)
+	return nil
+}
+
+func (vs *DictStrings) value(i int) string { return vs.Dict.Values[vs.Indices[i]] }
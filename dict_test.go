@@ -0,0 +1,129 @@
+package ep_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+)
+
+func TestEncodeDict(t *testing.T) {
+	values := []string{"us", "il", "us", "", "il", "us"}
+	data := ep.EncodeDict(values)
+	require.Equal(t, []string{"us", "il", ""}, data.Dict.Values)
+	require.Equal(t, []int32{0, 1, 0, 2, 1, 0}, data.Indices)
+	require.Equal(t, values, ep.DecodeDict(data))
+
+	data.MarkNull(1)
+	sort.Sort(data)
+	require.Equal(t, []string{"", "il", "us", "us", "us", ""}, ep.DecodeDict(data))
+	require.Equal(t, []bool{false, false, false, false, false, true}, data.Nulls())
+}
+
+// Data of different dictionaries is merged into a new one, leaving both
+// dictionaries intact, while the same one is shared
+func TestDictStrings_merge(t *testing.T) {
+	data1 := ep.EncodeDict([]string{"a", "b"})
+	data2 := ep.EncodeDict([]string{"c", "b", "c"})
+
+	res := data1.Append(data2).(*ep.DictStrings)
+	require.Equal(t, []string{"a", "b", "c", "b", "c"}, res.Strings())
+	require.Equal(t, []string{"a", "b", "c"}, res.Dict.Values)
+	require.Equal(t, []string{"a", "b"}, data1.Dict.Values)
+	require.Equal(t, []string{"c", "b"}, data2.Dict.Values)
+
+	sliced := res.Slice(0, 2).(*ep.DictStrings)
+	appended := sliced.Append(res.Slice(3, 5)).(*ep.DictStrings)
+	require.Equal(t, []string{"a", "b", "b", "c"}, appended.Strings())
+	require.True(t, res.Dict == sliced.Dict && res.Dict == appended.Dict)
+
+	// copying a value of another dictionary into a slice, which is seen by
+	// the data that it was sliced from
+	sliced.Copy(ep.EncodeDict([]string{"z"}), 0, 1)
+	require.Equal(t, []string{"a", "z"}, sliced.Strings())
+	require.Equal(t, []string{"a", "z", "c", "b", "c"}, res.Strings())
+	require.Equal(t, []string{"a", "b", "c", "z"}, res.Dict.Values)
+}
+
+func TestInMemoryCluster_dictStrings(t *testing.T) {
+	cluster := eptest.InMemoryCluster(2)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	values := []string{"us", "il", "us", "fr"}
+	runner := cluster.Distribute(ep.Pipeline(ep.Broadcast(), ep.Gather()))
+	res, err := eptest.Run(runner, ep.NewDataset(ep.EncodeDict(values)))
+	require.NoError(t, err)
+	require.Equal(t, append(values, values...), res.At(0).Strings())
+}
+
+// lowCardinality returns n values out of 50 distinct countries
+func lowCardinality(n int) []string {
+	res := make([]string, n)
+	for i := range res {
+		res[i] = fmt.Sprintf("country-%d", i%50)
+	}
+	return res
+}
+
+func BenchmarkDictStrings_gob(b *testing.B) {
+	benchmarkGob(b, ep.EncodeDict(lowCardinality(100000)))
+}
+
+func BenchmarkStrs_gob(b *testing.B) {
+	benchmarkGob(b, strs(lowCardinality(100000)))
+}
+
+// benchmarkGob encodes the data with gob, as sent by exchanges, and reports
+// the size of the payload
+func benchmarkGob(b *testing.B, data ep.Data) {
+	b.ReportAllocs()
+	var buf bytes.Buffer
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		err := gob.NewEncoder(&buf).Encode(&data)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(buf.Len()), "wire-bytes/op")
+}
+
+// The allocations of cloning the data reflect its size in memory
+func BenchmarkDictStrings_clone(b *testing.B) {
+	benchmarkClone(b, ep.EncodeDict(lowCardinality(100000)))
+}
+
+// The fallback of Clone for Data that isn't a Cloner, copying the rows one by
+// one, which looks every value up in the dictionary of the clone
+func BenchmarkDictStrings_cloneRows(b *testing.B) {
+	data := ep.EncodeDict(lowCardinality(100000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := data.Type().Data(data.Len())
+		for row := 0; row < data.Len(); row++ {
+			res.Copy(data, row, row)
+		}
+	}
+}
+
+// strs aren't Cloners, thus they're copied row by row, unlike SliceData
+func BenchmarkStrs_clone(b *testing.B) {
+	benchmarkClone(b, strs(lowCardinality(100000)))
+}
+
+func BenchmarkSliceData_clone(b *testing.B) {
+	benchmarkClone(b, internStrings.Of(lowCardinality(100000)...))
+}
+
+func benchmarkClone(b *testing.B, data ep.Data) {
+	b.ReportAllocs()
+	b.ResetTimer() // of creating the data
+	for i := 0; i < b.N; i++ {
+		ep.Clone(data)
+	}
+}
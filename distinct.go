@@ -0,0 +1,316 @@
+package ep
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+var _ = registerGob(&distinct{})
+
+// DefaultDistinctMaxBytes is the default memory budget of Distinct, of the
+// keys it retains before spilling
+const DefaultDistinctMaxBytes = 64 << 20
+
+// distinctBatchSize is the number of rows of every dataset spilled, and output
+// out of the spilled rows, by Distinct
+const distinctBatchSize = 1024
+
+// Distinct returns a Runner that outputs the first occurrence of every row of
+// its input, distinct by the values of the provided columns, or by all of the
+// columns when none are provided. Nulls are equal to each other. Rows are
+// output as they're received, while the keys of the rows output before are
+// retained in a hash set, and compared to every row of an equal hash.
+//
+// Once the retained keys exceed the memory budget, of DefaultDistinctMaxBytes
+// unless set by DistinctMaxBytes, the following rows that aren't in the set
+// are buffered instead, up to the budget again. Every buffer is sorted by the
+// keys, deduplicated and spilled to a temporary file, and all of the files are
+// merged once the input is completed. Thus the rows output after exceeding the
+// budget are sorted by their keys, rather than in their order, and memory use
+// is bound by about twice the budget. The files are removed when the Runner
+// completes or fails
+func Distinct(cols ...int) Runner {
+	return &distinct{Cols: cols, MaxBytes: DefaultDistinctMaxBytes}
+}
+
+// DistinctMaxBytes sets the memory budget of a Runner returned by Distinct, in
+// bytes, beyond which it spills. A non-positive budget never spills
+func DistinctMaxBytes(r Runner, bytes int) Runner {
+	d, ok := r.(*distinct)
+	if !ok {
+		panic("ep: DistinctMaxBytes expects a Distinct")
+	}
+
+	d.MaxBytes = bytes
+	return d
+}
+
+type distinct struct {
+	Cols     []int
+	MaxBytes int
+}
+
+func (*distinct) Returns() []Type { return []Type{Wildcard} }
+func (r *distinct) Run(_ context.Context, inp, out chan Dataset) error {
+	set := newKeySet()
+	var runs *distinctRuns
+	defer func() { runs.remove() }()
+
+	for data := range inp {
+		keys, err := r.keys(data)
+		if err != nil {
+			return err
+		}
+
+		if runs != nil {
+			err = runs.add(takeRows(data, set.missing(selectColumns(data, keys))), keys)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, added := set.add(selectColumns(data, keys))
+		if len(added) > 0 {
+			out <- takeRows(data, added)
+		}
+		if r.MaxBytes > 0 && set.size > uint64(r.MaxBytes) {
+			runs = &distinctRuns{maxBytes: uint64(r.MaxBytes)}
+		}
+	}
+
+	if runs == nil {
+		return nil
+	}
+	return runs.merge(out)
+}
+
+// takeRows returns the rows of the data at the indices, which are ascending,
+// or the data itself when they're all of its rows
+func takeRows(data Dataset, indices []int) Dataset {
+	if len(indices) == data.Len() {
+		return data
+	}
+	return take(data, indices).(Dataset)
+}
+
+// keys returns the key columns of the data, at the indices of Cols
+func (r *distinct) keys(data Dataset) ([]int, error) {
+	if len(r.Cols) == 0 {
+		keys := make([]int, data.Width())
+		for i := range keys {
+			keys[i] = i
+		}
+		return keys, nil
+	}
+
+	for _, col := range r.Cols {
+		if col < 0 || col >= data.Width() {
+			return nil, fmt.Errorf("ep: distinct column %d out of range for %d columns", col, data.Width())
+		}
+	}
+	return r.Cols, nil
+}
+
+// distinctRuns are the sorted runs of rows spilled by Distinct, and the rows
+// buffered for the next run
+type distinctRuns struct {
+	maxBytes uint64
+	cols     []int // the key columns, of all of the rows
+	buffered []Dataset
+	size     uint64 // the approximate number of bytes buffered
+	files    []*os.File
+}
+
+// add buffers the rows of the data, spilling all of the buffered rows once
+// they exceed the budget
+func (runs *distinctRuns) add(data Dataset, cols []int) error {
+	runs.cols = cols
+	if data.Len() == 0 {
+		return nil
+	}
+
+	runs.buffered = append(runs.buffered, data)
+	runs.size += DatasetSize(data)
+	if runs.size <= runs.maxBytes {
+		return nil
+	}
+	return runs.spill()
+}
+
+// spill sorts the buffered rows by their keys, deduplicates them and writes
+// them to a new spill file, in datasets of distinctBatchSize rows
+func (runs *distinctRuns) spill() error {
+	run, err := runs.sorted()
+	if err != nil || run == nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(spillDir, "ep-distinct-")
+	if err != nil {
+		return err
+	}
+	runs.files = append(runs.files, f)
+
+	enc := gob.NewEncoder(f)
+	for i := 0; i < run.Len(); i += distinctBatchSize {
+		end := i + distinctBatchSize
+		if end > run.Len() {
+			end = run.Len()
+		}
+
+		err = enc.Encode(&req{run.Slice(i, end).(Dataset)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sorted returns the buffered rows sorted by their keys, with the first
+// occurrence of every key alone, or nil when there are none. The buffer is
+// emptied
+func (runs *distinctRuns) sorted() (Dataset, error) {
+	if len(runs.buffered) == 0 {
+		return nil, nil
+	}
+
+	data := ConcatDatasets(runs.buffered...)
+	runs.buffered, runs.size = nil, 0
+	sortingCols := make([]SortingCol, len(runs.cols))
+	for i, col := range runs.cols {
+		sortingCols[i] = SortingCol{Index: col}
+	}
+
+	// stable, such that the first occurrence of every key is first
+	data, err := SortDataset(data, sortingCols)
+	if err != nil {
+		return nil, err
+	}
+
+	indices := []int{0}
+	for i := 1; i < data.Len(); i++ {
+		if !equalRows(data, indices[len(indices)-1], data, i, runs.cols) {
+			indices = append(indices, i)
+		}
+	}
+	return take(data, indices).(Dataset), nil
+}
+
+// merge outputs the first occurrence of every key out of all of the runs,
+// including the buffered rows, merged by their keys. Rows of equal keys are
+// ordered by their runs, which are in the order of the input
+func (runs *distinctRuns) merge(out chan Dataset) error {
+	if len(runs.files) == 0 {
+		// nothing was spilled, thus the buffered rows are a single run
+		run, err := runs.sorted()
+		if run != nil {
+			out <- run
+		}
+		return err
+	}
+
+	err := runs.spill()
+	if err != nil {
+		return err
+	}
+
+	heads := make([]mergeHead, len(runs.files))
+	decs := make([]*gob.Decoder, len(runs.files))
+	for i, f := range runs.files {
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		decs[i] = gob.NewDecoder(f)
+	}
+
+	var last mergeHead
+	var rows []mergeHead
+	for {
+		// refill the exhausted heads, and remove the drained runs
+		for i := 0; i < len(heads); {
+			if heads[i].data != nil && heads[i].row < heads[i].data.Len() {
+				i++
+				continue
+			}
+
+			req := &req{}
+			err = decs[i].Decode(req)
+			if err == io.EOF {
+				heads = append(heads[:i], heads[i+1:]...)
+				decs = append(decs[:i], decs[i+1:]...)
+				continue
+			} else if err != nil {
+				return err
+			}
+			heads[i] = mergeHead{req.Payload.(Dataset), 0}
+		}
+
+		if len(heads) == 0 || len(rows) == distinctBatchSize {
+			if len(rows) > 0 {
+				out <- copyRows(rows)
+				rows = nil
+			}
+			if len(heads) == 0 {
+				return nil
+			}
+		}
+
+		// the first of the minimal heads, of the earliest run
+		min := 0
+		for i := 1; i < len(heads); i++ {
+			if runs.less(heads[i], heads[min]) {
+				min = i
+			}
+		}
+
+		head := heads[min]
+		if last.data == nil || !equalRows(last.data, last.row, head.data, head.row, runs.cols) {
+			rows = append(rows, head)
+			last = head
+		}
+		heads[min].row++
+	}
+}
+
+// less reports whether the pending row of a is sorted before the pending row
+// of b, by their keys
+func (runs *distinctRuns) less(a, b mergeHead) bool {
+	for _, col := range runs.cols {
+		if c := Compare(a.data.At(col), a.row, b.data.At(col), b.row); c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+// remove closes and removes all of the spill files. It's safe to call it on a
+// nil distinctRuns
+func (runs *distinctRuns) remove() {
+	if runs == nil {
+		return
+	}
+
+	for _, f := range runs.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	runs.files = nil
+}
+
+// copyRows copies the rows, of any number of datasets, into a single dataset
+func copyRows(rows []mergeHead) Dataset {
+	cols := make([]Data, rows[0].data.Width())
+	for i := range cols {
+		cols[i] = rows[0].data.At(i).Type().Data(len(rows))
+		for j, row := range rows {
+			cols[i].Copy(row.data.At(i), row.row, j)
+		}
+	}
+	return NewDataset(cols...)
+}
@@ -0,0 +1,58 @@
+package ep
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+)
+
+// With all of the keys colliding, they're told apart by their values, both in
+// memory and when spilling, and the spill files are removed
+func TestDistinct_collisions(t *testing.T) {
+	defer func(prev func(Dataset, []int) []uint64) { keyHashRows = prev }(keyHashRows)
+	keyHashRows = func(data Dataset, _ []int) []uint64 { return make([]uint64, data.Len()) }
+
+	dir := t.TempDir()
+	defer func(prev string) { spillDir = prev }(spillDir)
+	spillDir = dir
+
+	keys := &Int64s{Values: make([]int64, 300)}
+	for i := range keys.Values {
+		keys.Values[i] = int64(i % 70)
+	}
+	keys.MarkNull(5)
+	keys.MarkNull(250)
+	data := NewDataset(keys)
+
+	for _, maxBytes := range []int{0, 100} {
+		var batches []Dataset
+		for i := 0; i < data.Len(); i += 30 {
+			batches = append(batches, data.Slice(i, i+30).(Dataset))
+		}
+
+		out := make(chan Dataset, 1000)
+		r := DistinctMaxBytes(Distinct(), maxBytes)
+		require.NoError(t, r.Run(context.Background(), closedInput(batches...), out))
+		close(out)
+		var res []Dataset
+		for data := range out {
+			res = append(res, data)
+		}
+
+		// the 70 values, and a single null
+		all := ConcatDatasets(res...)
+		require.Equal(t, 71, all.Len(), "max bytes %d", maxBytes)
+		nulls := 0
+		for i := 0; i < all.Len(); i++ {
+			if all.At(0).IsNull(i) {
+				nulls++
+			}
+		}
+		require.Equal(t, 1, nulls, "max bytes %d", maxBytes)
+
+		files, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		require.Empty(t, files)
+	}
+}
@@ -0,0 +1,75 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestDistinct(t *testing.T) {
+	rnd := rand.New(rand.NewSource(85))
+	const n = 2000
+	a, b, ids := randomInts(rnd, n), randomInts(rnd, n), &ep.Int64s{Values: make([]int64, n)}
+	for i := range ids.Values {
+		ids.Values[i] = int64(i)
+	}
+	data := ep.NewDataset(a, b, ids)
+
+	// the ids of the first occurrences of every pair of a and b
+	var expected []string
+	seen := map[[2]string]bool{}
+	for i, id := range ids.Strings() {
+		key := [2]string{a.Strings()[i], b.Strings()[i]}
+		if !seen[key] {
+			seen[key] = true
+			expected = append(expected, id)
+		}
+	}
+
+	runners := map[string]func() ep.Runner{
+		"memory": func() ep.Runner { return ep.Distinct(1, 0) },
+		"spill":  func() ep.Runner { return ep.DistinctMaxBytes(ep.Distinct(1, 0), 200) },
+	}
+	for name, newRunner := range runners {
+		t.Run(name, func(t *testing.T) {
+			// regardless of the batch boundaries
+			for iter := 0; iter < 10; iter++ {
+				var batches []ep.Dataset
+				for i := 0; i < n; {
+					end := i + rnd.Intn(100)
+					if end > n {
+						end = n
+					}
+					batches = append(batches, data.Slice(i, end).(ep.Dataset))
+					i = end
+				}
+
+				res, err := eptest.Run(newRunner(), batches...)
+				require.NoError(t, err)
+				actual := res.At(2).Strings()
+				if name == "spill" {
+					sort.Slice(actual, func(i, j int) bool {
+						return len(actual[i]) < len(actual[j]) || len(actual[i]) == len(actual[j]) && actual[i] < actual[j]
+					})
+				}
+				require.Equal(t, expected, actual)
+			}
+		})
+	}
+}
+
+func TestDistinct_allColumns(t *testing.T) {
+	data := ep.NewDataset(strs{"a", "b", "a", "a", "b"}, &ep.Int64s{Values: []int64{1, 2, 1, 0, 0}, Null: ep.NullMask{8 | 16}})
+	other := ep.NewDataset(strs{"b", "a", "c"}, &ep.Int64s{Values: []int64{0, 1, 1}, Null: ep.NullMask{1}})
+	res, err := eptest.Run(ep.Distinct(), data, other)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[a b a b c]", "[1 2   1]"}, res.Strings())
+
+	_, err = eptest.Run(ep.Distinct(2), data)
+	require.Error(t, err)
+	require.Equal(t, "ep: distinct column 2 out of range for 2 columns", err.Error())
+	require.Panics(t, func() { ep.DistinctMaxBytes(ep.PassThrough(), 1) })
+}
@@ -2,12 +2,19 @@ package ep
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
 	"encoding/gob"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -42,19 +49,92 @@ type dialer interface {
 //          Dial(network, addr string) (net.Conn, error)
 //      }
 func NewDistributer(addr string, listener net.Listener) Distributer {
+	return NewTLSDistributer(addr, listener, nil)
+}
+
+// NewTLSDistributer creates a Distributer similar to NewDistributer, except that
+// all of its connections, including the ones used by exchanges, are secured
+// with TLS using the provided config. The config must be usable by both sides
+// of the connection: it should include the certificates of this node, and the
+// CAs to verify the certificates of its peers. When the config doesn't set a
+// ServerName, the host of the dialed address is used. A nil config disables TLS
+//
+// The MagicNumber is still sent in plaintext, before the TLS handshake, in
+// order to allow routing connections.
+func NewTLSDistributer(addr string, listener net.Listener, config *tls.Config) Distributer {
 	connsMap := make(map[string]chan net.Conn)
 	closeCh := make(chan error, 1)
-	d := &distributer{listener, addr, connsMap, &sync.Mutex{}, closeCh}
+	d := &distributer{
+		listener: listener,
+		addr:     addr,
+		connsMap: connsMap,
+		l:        &sync.Mutex{},
+		closeCh:  closeCh,
+		tls:      config,
+		sessions: map[string]*muxSession{},
+		ready:    map[string]chan struct{}{},
+		claimed:  map[string]bool{},
+
+		acceptTimeout: 10 * time.Second,
+	}
 	go d.start()
 	return d
 }
 
+// ListenDistributer listens on the address of this node, as with Listen, and
+// returns a Distributer serving the connections of all of the nodes on it. It's
+// the simplest way to start a node: once it's started on all of the nodes,
+// any one of them can distribute Runners to the others. Close stops listening
+func ListenDistributer(addr string) (Distributer, error) {
+	ln, err := Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewDistributer(addr, ln), nil
+}
+
+// Authenticate sets a secret shared by all of the nodes, which is used to
+// authenticate the data connections of exchanges: the connecting side sends an
+// HMAC of the connection uid keyed by the secret, and the accepting side closes
+// connections that fail to provide the same HMAC. All nodes must be configured
+// with the same secret, before any Runner is distributed.
+func Authenticate(d Distributer, secret []byte) Distributer {
+	dist, ok := d.(*distributer)
+	if !ok {
+		panic("ep: Authenticate expects a distributer")
+	}
+
+	dist.l.Lock()
+	defer dist.l.Unlock()
+	dist.secret = secret
+	return dist
+}
+
+// tlsHandshakeTimeout is the maximum duration of a TLS handshake, after which
+// the connection fails instead of hanging
+var tlsHandshakeTimeout = 5 * time.Second
+
 type distributer struct {
 	listener net.Listener
 	addr     string
 	connsMap map[string]chan net.Conn
 	l        sync.Locker
 	closeCh  chan error
+	tls      *tls.Config // secures all connections, when set
+
+	secret       []byte // authenticates data connections, when set
+	authFailures int64  // number of connections that failed to authenticate
+
+	mux      bool                     // multiplex all exchanges over a session per peer
+	muxL     sync.Mutex               // serializes dialing sessions
+	sessions map[string]*muxSession   // by peer address
+	ready    map[string]chan struct{} // closed once there's a session with a peer
+
+	claimed map[string]bool // keys of the open connections of exchanges, by peer and uid
+
+	// maximum duration that an incoming data connection waits for its
+	// exchange, which might start only after the peer has connected
+	acceptTimeout time.Duration
 }
 
 func (d *distributer) start() error {
@@ -77,6 +157,7 @@ func (d *distributer) Close() error {
 	// because while the listener is closed, there's still one pending Accept()
 	// TODO: consider waiting for all served connections/runners?
 	<-d.closeCh
+	d.closeSessions()
 	return err
 }
 
@@ -86,10 +167,11 @@ func (d *distributer) Dial(network, addr string) (conn net.Conn, err error) {
 	}
 
 	dialer, ok := d.listener.(dialer)
+	network, address := splitAddr(network, addr)
 	if ok {
-		conn, err = dialer.Dial(network, addr)
+		conn, err = dialer.Dial(network, address)
 	} else {
-		conn, err = net.Dial(network, addr)
+		conn, err = net.Dial(network, address)
 	}
 
 	if err != nil {
@@ -97,15 +179,73 @@ func (d *distributer) Dial(network, addr string) (conn net.Conn, err error) {
 	}
 
 	_, err = conn.Write(MagicNumber)
+	if err == nil && d.tls != nil {
+		conn, err = d.tlsClient(conn, addr)
+	}
+
 	if err != nil {
 		conn.Close()
+		return nil, err
 	}
 
 	return
 }
 
+// unixScheme is the prefix of node addresses of unix domain sockets, e.g.
+// unix:///var/run/ep.sock, which is useful for nodes on the same host
+const unixScheme = "unix://"
+
+// Listen listens on the address of a node, for creating its Distributer. The
+// address is either a TCP address, or a path of a unix domain socket prefixed
+// with unix://. All of the other nodes must use the same address to reach it
+func Listen(addr string) (net.Listener, error) {
+	return net.Listen(splitAddr("tcp", addr))
+}
+
+// splitAddr returns the network and the address within it of a node address,
+// where nodes without a scheme are on the provided default network
+func splitAddr(network, addr string) (string, string) {
+	if strings.HasPrefix(addr, unixScheme) {
+		return "unix", strings.TrimPrefix(addr, unixScheme)
+	}
+	return network, addr
+}
+
+// tlsClient wraps a dialed connection with TLS, and completes its handshake
+func (d *distributer) tlsClient(conn net.Conn, addr string) (net.Conn, error) {
+	config := d.tls
+	if config.ServerName == "" && !config.InsecureSkipVerify {
+		host, _, err := net.SplitHostPort(addr)
+		if strings.HasPrefix(addr, unixScheme) {
+			host, err = "", nil // on this host
+		} else if err != nil {
+			return conn, err
+		}
+
+		if host == "" {
+			host = "localhost"
+		}
+
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, config)
+	return tlsConn, handshake(tlsConn)
+}
+
+// handshake completes a TLS handshake within the handshake timeout
+func handshake(conn *tls.Conn) error {
+	conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	err := conn.Handshake()
+	if err != nil {
+		return fmt.Errorf("ep: tls handshake failed: %s", err)
+	}
+	return conn.SetDeadline(time.Time{})
+}
+
 func (d *distributer) Distribute(runner Runner, addrs ...string) Runner {
-	return &distRunner{runner, addrs, d.addr, d}
+	return &distRunner{Runner: runner, Addrs: addrs, MasterAddr: d.addr, d: d}
 }
 
 // Connect to a node address for the given uid. Used by the individual exchange
@@ -113,6 +253,32 @@ func (d *distributer) Distribute(runner Runner, addrs ...string) Runner {
 // ensure that both sides of the connection, when used with the same UID,
 // resolve to the same connection
 func (d *distributer) Connect(addr string, uid string) (conn net.Conn, err error) {
+	claim := addr + ":" + uid
+	err = d.claim(claim, uid, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			d.release(claim)
+		} else {
+			conn = &claimedConn{Conn: conn, release: func() { d.release(claim) }}
+		}
+	}()
+
+	d.l.Lock()
+	mux := d.mux
+	d.l.Unlock()
+
+	if mux {
+		s, err := d.session(addr)
+		if err != nil {
+			return nil, err
+		}
+		return s.stream(uid), nil
+	}
+
 	from := d.addr
 	if from < addr {
 		// dial
@@ -126,7 +292,15 @@ func (d *distributer) Connect(addr string, uid string) (conn net.Conn, err error
 			return
 		}
 
-		err = writeStr(conn, d.addr+":"+uid)
+		key := d.addr + ":" + uid
+		err = writeStr(conn, key)
+		if err != nil {
+			return
+		}
+
+		// always sent, even when empty, as the peer reads it regardless of
+		// its own secret
+		err = writeStr(conn, d.authMAC(key))
 		if err != nil {
 			return
 		}
@@ -135,9 +309,11 @@ func (d *distributer) Connect(addr string, uid string) (conn net.Conn, err error
 		timer := time.NewTimer(time.Second)
 		defer timer.Stop()
 
+		k := addr + ":" + uid
 		select {
-		case conn = <-d.connCh(addr + ":" + uid):
+		case conn = <-d.connCh(k):
 			// let it through
+			d.dropConnCh(k)
 		case <-timer.C:
 			err = fmt.Errorf("ep: connect timeout; no incoming conn")
 		}
@@ -157,6 +333,17 @@ func (d *distributer) Serve(conn net.Conn) error {
 		return fmt.Errorf("unrecognized connection. Missing MagicNumber prefix")
 	}
 
+	if d.tls != nil {
+		tlsConn := tls.Server(conn, d.tls)
+		err = handshake(tlsConn)
+		if err != nil {
+			conn.Close()
+			log.Println("ep: distributer error", err)
+			return err
+		}
+		conn = tlsConn
+	}
+
 	typee, err := readStr(conn)
 	if err != nil {
 		return err
@@ -168,8 +355,35 @@ func (d *distributer) Serve(conn net.Conn) error {
 			return err
 		}
 
-		// wait for someone to claim it.
-		d.connCh(key) <- conn
+		mac, err := readStr(conn)
+		if err != nil {
+			return err
+		}
+
+		if !d.authenticate(key, mac) {
+			return d.authFailed(conn, key)
+		}
+
+		// wait for the exchange to claim it, as it might connect only after
+		// the peer did, unless it never does
+		d.l.Lock()
+		timeout := d.acceptTimeout
+		d.l.Unlock()
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case d.connCh(key) <- conn:
+		case <-timer.C:
+			d.dropConnCh(key)
+			conn.Close()
+			err := fmt.Errorf("no exchange claimed connection %s within %s", key, timeout)
+			log.Println("ep: " + err.Error())
+			return err
+		}
+	} else if typee == "M" { // multiplexed connection
+		return d.serveSession(conn)
 	} else if typee == "X" { // execute runner connection
 		defer conn.Close()
 
@@ -217,6 +431,72 @@ func (d *distributer) Serve(conn net.Conn) error {
 	return nil
 }
 
+// authMAC returns the hex-encoded HMAC of a connection key, or an empty string
+// when there's no secret
+func (d *distributer) authMAC(key string) string {
+	d.l.Lock()
+	secret := d.secret
+	d.l.Unlock()
+
+	if secret == nil {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authenticate returns true if the HMAC sent along with a connection key is
+// valid. Without a secret all connections are accepted
+func (d *distributer) authenticate(key, mac string) bool {
+	expected := d.authMAC(key)
+	return expected == "" || hmac.Equal([]byte(mac), []byte(expected))
+}
+
+// authFailed closes a connection that failed to authenticate
+func (d *distributer) authFailed(conn net.Conn, key string) error {
+	conn.Close()
+	atomic.AddInt64(&d.authFailures, 1)
+	err := fmt.Errorf("authentication failed for connection %s", key)
+	log.Println("ep: " + err.Error())
+	return err
+}
+
+// claim registers the connection of an exchange uid to a peer until it's
+// closed. Two exchanges with the same uid would otherwise share connections,
+// and interleave the datasets of one another
+func (d *distributer) claim(key, uid, addr string) error {
+	d.l.Lock()
+	defer d.l.Unlock()
+	if d.claimed[key] {
+		return fmt.Errorf("ep: exchange uid %s is already connected to %s, uids must be unique", uid, addr)
+	}
+	d.claimed[key] = true
+	return nil
+}
+
+func (d *distributer) release(key string) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	delete(d.claimed, key)
+}
+
+// claimedConn is a connection of an exchange, which releases its claim once
+// closed
+type claimedConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *claimedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+func (c *claimedConn) CloseWrite() error { return closeWrite(c.Conn) }
+
 func (d *distributer) connCh(k string) chan net.Conn {
 	d.l.Lock()
 	defer d.l.Unlock()
@@ -226,12 +506,21 @@ func (d *distributer) connCh(k string) chan net.Conn {
 	return d.connsMap[k]
 }
 
+// dropConnCh removes the channel of incoming connections of a key, once it was
+// claimed or timed out, such that the channels of past exchanges don't pile up
+func (d *distributer) dropConnCh(k string) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	delete(d.connsMap, k)
+}
+
 // distRunner wraps around a runner, and upon the initial call to Run, it
 // distributes the runner to all nodes and runs them in parallel.
 type distRunner struct {
 	Runner
 	Addrs      []string // participating node addresses
 	MasterAddr string   // the master node that created the distRunner
+	Partition  []int    // the columns partitioning the input on all nodes, when set
 	d          *distributer
 }
 
@@ -240,6 +529,10 @@ func (r *distRunner) Run(ctx context.Context, inp, out chan Dataset) error {
 
 	decs := []*gob.Decoder{}
 	isMain := r.d.addr == r.MasterAddr
+	if isMain {
+		r.Partition = partitionedBy(ctx)
+	}
+
 	for i := 0; i < len(r.Addrs) && isMain; i++ {
 		addr := r.Addrs[i]
 		if addr == r.d.addr {
@@ -269,10 +562,11 @@ func (r *distRunner) Run(ctx context.Context, inp, out chan Dataset) error {
 		decs = append(decs, gob.NewDecoder(conn))
 	}
 
-	ctx = context.WithValue(ctx, allNodesKey, r.Addrs)
-	ctx = context.WithValue(ctx, masterNodeKey, r.MasterAddr)
-	ctx = context.WithValue(ctx, thisNodeKey, r.d.addr)
+	ctx = WithNodes(ctx, r.Addrs, r.MasterAddr, r.d.addr)
 	ctx = context.WithValue(ctx, distributerKey, r.d)
+	if r.Partition != nil {
+		ctx = PartitionedBy(ctx, r.Partition...)
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -285,7 +579,7 @@ func (r *distRunner) Run(ctx context.Context, inp, out chan Dataset) error {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err := r.Runner.Run(ctx, inp, out)
+			err := runSafe(ctx, r.Runner, inp, out)
 			if err != nil {
 				respErrs <- err
 			}
@@ -325,12 +619,22 @@ func (r *distRunner) Run(ctx context.Context, inp, out chan Dataset) error {
 	if len(errs) > 0 {
 		finalError = errs[0]
 	}
-	// wait for respErrs channel anyway, and select first meaningful error
+	// wait for respErrs channel anyway, and select first meaningful error,
+	// over the errors of the state of projects caused by it
+	var stateErr error
 	for e := range respErrs {
-		if finalError == nil && e != errProjectState {
+		var projectErr *projectStateError
+		if errors.As(e, &projectErr) {
+			if stateErr == nil {
+				stateErr = e
+			}
+		} else if finalError == nil && !errors.Is(e, errProjectState) {
 			finalError = e
 		}
 	}
+	if finalError == nil {
+		finalError = stateErr
+	}
 	return finalError
 }
 
@@ -0,0 +1,37 @@
+package ep_test
+
+import (
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"sort"
+)
+
+func ExampleListenDistributer() {
+	// every node starts a distributer of its own, usually in its own process
+	master, err := ep.ListenDistributer(":5561")
+	if err != nil {
+		panic(err)
+	}
+	defer master.Close()
+
+	peer, err := ep.ListenDistributer(":5562")
+	if err != nil {
+		panic(err)
+	}
+	defer peer.Close()
+
+	// then any one of them distributes the runner to all of them
+	runner := ep.Pipeline(ep.Scatter(), &upper{}, ep.Gather())
+	runner = master.Distribute(runner, ":5561", ":5562")
+
+	data := ep.NewDataset(strs{"hello", "world"})
+	data, err = eptest.Run(runner, data, data)
+
+	res := data.At(0).Strings()
+	sort.Strings(res)
+	fmt.Println(res, err)
+
+	// Output:
+	// [HELLO HELLO WORLD WORLD] <nil>
+}
@@ -0,0 +1,275 @@
+package ep
+
+import (
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAuthenticate(t *testing.T) {
+	dist1, dist2 := newAuthPeers(t, []byte("secret"), []byte("secret"))
+	defer closeAll(t, dist1, dist2)
+
+	conn1, conn2, err1, err2 := connectPeers(dist1, dist2)
+	require.NoError(t, err1)
+	require.NoError(t, err2)
+	defer conn1.Close()
+	defer conn2.Close()
+
+	go conn1.Write([]byte("hello"))
+	b := make([]byte, 5)
+	_, err := conn2.Read(b)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b))
+	require.Equal(t, int64(0), atomic.LoadInt64(&dist2.authFailures))
+}
+
+func TestAuthenticate_wrongSecret(t *testing.T) {
+	dist1, dist2 := newAuthPeers(t, []byte("guess"), []byte("secret"))
+	defer closeAll(t, dist1, dist2)
+
+	conn1, _, err1, err2 := connectPeers(dist1, dist2)
+	require.NoError(t, err1)
+	defer conn1.Close()
+
+	// the accepting side never receives the connection
+	require.Error(t, err2)
+	require.Equal(t, int64(1), atomic.LoadInt64(&dist2.authFailures))
+
+	// and the connecting side finds it closed
+	conn1.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := conn1.Read(make([]byte, 1))
+	require.Error(t, err)
+}
+
+func TestAuthenticate_missingSecret(t *testing.T) {
+	dist1, dist2 := newAuthPeers(t, nil, []byte("secret"))
+	defer closeAll(t, dist1, dist2)
+
+	conn1, _, err1, err2 := connectPeers(dist1, dist2)
+	require.NoError(t, err1)
+	defer conn1.Close()
+
+	require.Error(t, err2)
+	require.Equal(t, int64(1), atomic.LoadInt64(&dist2.authFailures))
+}
+
+// newAuthPeers returns two distributers with the provided secrets, where the
+// first one dials the second one upon Connect
+func newAuthPeers(t *testing.T, secret1, secret2 []byte) (*distributer, *distributer) {
+	dists := []*distributer{}
+	for i, secret := range [][]byte{secret1, secret2} {
+		port := []string{":5551", ":5552"}[i]
+		ln, err := net.Listen("tcp", port)
+		require.NoError(t, err)
+
+		d := NewDistributer(port, ln)
+		if secret != nil {
+			d = Authenticate(d, secret)
+		}
+		dists = append(dists, d.(*distributer))
+	}
+	return dists[0], dists[1]
+}
+
+// connectPeers connects both sides of the same uid concurrently
+func connectPeers(dist1, dist2 *distributer) (conn1, conn2 net.Conn, err1, err2 error) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn2, err2 = dist2.Connect(dist1.addr, "uid")
+	}()
+
+	conn1, err1 = dist1.Connect(dist2.addr, "uid")
+	<-done
+	return
+}
+
+func closeAll(t *testing.T, dists ...*distributer) {
+	for _, d := range dists {
+		require.NoError(t, d.Close())
+	}
+
+	// avoid "bind: address already in use" error in future tests
+	time.Sleep(1 * time.Millisecond)
+}
+
+func TestConnect_uidCollision(t *testing.T) {
+	dist1, dist2 := newAuthPeers(t, nil, nil)
+	defer closeAll(t, dist1, dist2)
+
+	conn1, conn2, err1, err2 := connectPeers(dist1, dist2)
+	require.NoError(t, err1)
+	require.NoError(t, err2)
+	defer conn2.Close()
+
+	// another exchange with the same uid is rejected while the first one is
+	// still connected, on both sides
+	_, err := dist1.Connect(dist2.addr, "uid")
+	require.Error(t, err)
+	require.Equal(t, "ep: exchange uid uid is already connected to :5552, uids must be unique", err.Error())
+
+	_, err = dist2.Connect(dist1.addr, "uid")
+	require.Error(t, err)
+	require.Equal(t, "ep: exchange uid uid is already connected to :5551, uids must be unique", err.Error())
+
+	// other uids, and other peers, are unaffected
+	conn, err := dist1.Connect(dist2.addr, "other")
+	require.NoError(t, err)
+	conn.Close()
+
+	// the uid can be reused once the connection is closed
+	require.NoError(t, conn1.Close())
+	conn, err = dist1.Connect(dist2.addr, "uid")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// closing the first connection again doesn't release the new claim
+	conn1.Close()
+	_, err = dist1.Connect(dist2.addr, "uid")
+	require.Error(t, err)
+}
+
+func TestWithUID(t *testing.T) {
+	require.NotEqual(t, Gather().(*exchange).UID, Gather().(*exchange).UID)
+	require.Equal(t, "uid", WithUID(Scatter(), "uid").(*exchange).UID)
+	require.Panics(t, func() { WithUID(Pipeline(), "uid") })
+}
+
+func TestMuxSession_streams(t *testing.T) {
+	s1, s2 := newTestSessions()
+	defer s1.Close()
+	defer s2.Close()
+
+	// streams of the same key on both sides are connected, and the others are
+	// independent of them
+	a1, a2 := s1.stream("a"), s2.stream("a")
+	b1, b2 := s1.stream("b"), s2.stream("b")
+
+	go func() {
+		b1.Write([]byte("world"))
+		a1.Write([]byte("hello"))
+		a1.Close()
+		b1.Close()
+	}()
+
+	a, err := ioutil.ReadAll(a2)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(a))
+
+	b, err := ioutil.ReadAll(b2)
+	require.NoError(t, err)
+	require.Equal(t, "world", string(b))
+
+	// streams are released once closed on both sides
+	a2.Close()
+	b2.Close()
+	require.Eventually(t, func() bool {
+		s1.l.Lock()
+		defer s1.l.Unlock()
+		return len(s1.streams) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestMuxSession_closeReleasesReads(t *testing.T) {
+	s1, s2 := newTestSessions()
+	defer s1.Close()
+	defer s2.Close()
+
+	st := s1.stream("a")
+	errs := make(chan error)
+	go func() {
+		_, err := st.Read(make([]byte, 1))
+		errs <- err
+	}()
+
+	st.Close()
+	require.Equal(t, io.ErrClosedPipe, <-errs)
+}
+
+func TestMuxSession_readDeadline(t *testing.T) {
+	s1, s2 := newTestSessions()
+	defer s1.Close()
+	defer s2.Close()
+
+	st := s1.stream("a")
+	st.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err := st.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.True(t, err.(net.Error).Timeout())
+}
+
+func TestMuxSession_failsAllStreams(t *testing.T) {
+	s1, s2 := newTestSessions()
+	defer s1.Close()
+
+	a, b := s1.stream("a"), s1.stream("b")
+	s2.Close()
+
+	for _, st := range []*muxStream{a, b} {
+		_, err := st.Read(make([]byte, 1))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "ep: connection to :5552 failed")
+	}
+
+	// new streams of a failed session fail as well
+	_, err := s1.stream("c").Write([]byte("a"))
+	require.Error(t, err)
+}
+
+// newTestSessions returns both sides of a session over a pipe
+func newTestSessions() (*muxSession, *muxSession) {
+	conn1, conn2 := net.Pipe()
+	noop := func(string, *muxSession) {}
+	return newMuxSession(conn1, ":5552", noop), newMuxSession(conn2, ":5551", noop)
+}
+
+// A data connection that no exchange claims is closed after a while, instead
+// of blocking its go-routine, and its channel is dropped
+func TestServe_unclaimedConnection(t *testing.T) {
+	dist1, dist2 := newAuthPeers(t, nil, nil)
+	defer closeAll(t, dist1, dist2)
+
+	dist2.l.Lock()
+	dist2.acceptTimeout = 50 * time.Millisecond
+	dist2.l.Unlock()
+
+	conn, err := dist1.Dial("tcp", dist2.addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	key := dist1.addr + ":uid"
+	require.NoError(t, writeStr(conn, "D"))
+	require.NoError(t, writeStr(conn, key))
+	require.NoError(t, writeStr(conn, ""))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	require.Equal(t, io.EOF, err)
+
+	dist2.l.Lock()
+	defer dist2.l.Unlock()
+	require.Empty(t, dist2.connsMap)
+}
+
+// Claimed connections don't keep their channels around either
+func TestConnect_dropsChannels(t *testing.T) {
+	dist1, dist2 := newAuthPeers(t, nil, nil)
+	defer closeAll(t, dist1, dist2)
+
+	conn1, conn2, err1, err2 := connectPeers(dist1, dist2)
+	require.NoError(t, err1)
+	require.NoError(t, err2)
+	defer conn1.Close()
+	defer conn2.Close()
+
+	for _, d := range []*distributer{dist1, dist2} {
+		d.l.Lock()
+		require.Empty(t, d.connsMap)
+		d.l.Unlock()
+	}
+}
@@ -1,10 +1,22 @@
 package ep_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
 	"github.com/panoplyio/ep"
 	"github.com/panoplyio/ep/eptest"
 	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -35,7 +47,7 @@ func TestDistribute_success(t *testing.T) {
 
 	require.NoError(t, err)
 	require.Equal(t, 1, data.Width())
-	require.Equal(t, "[hello world foo bar]", fmt.Sprintf("%v", data.At(0)))
+	require.ElementsMatch(t, []string{"hello", "world", "foo", "bar"}, data.At(0).Strings())
 }
 
 func TestDistribute_connectionError(t *testing.T) {
@@ -79,3 +91,317 @@ func _TestDistributeErrorFromPeer(t *testing.T) {
 	require.Equal(t, "error :5552", err.Error())
 	require.Equal(t, 0, data.Width())
 }
+
+func TestDistribute_tls(t *testing.T) {
+	// avoid "bind: address already in use" error in future tests
+	defer time.Sleep(1 * time.Millisecond)
+
+	config := newTLSConfig(t)
+	port1 := ":5551"
+	dist1 := newTLSPeer(t, port1, config)
+
+	port2 := ":5552"
+	peer2 := newTLSPeer(t, port2, config)
+	defer func() {
+		require.NoError(t, dist1.Close())
+		require.NoError(t, peer2.Close())
+	}()
+
+	runner := dist1.Distribute(ep.Pipeline(ep.Scatter(), ep.Gather()), port1, port2)
+
+	data1 := ep.NewDataset(strs{"hello", "world"})
+	data2 := ep.NewDataset(strs{"foo", "bar"})
+	data, err := eptest.Run(runner, data1, data2)
+
+	require.NoError(t, err)
+	require.Equal(t, 1, data.Width())
+	require.Equal(t, 4, data.Len())
+}
+
+func TestDistribute_tlsVerificationError(t *testing.T) {
+	// avoid "bind: address already in use" error in future tests
+	defer time.Sleep(1 * time.Millisecond)
+
+	// the peers don't trust each other's certificates
+	port1 := ":5551"
+	dist1 := newTLSPeer(t, port1, newTLSConfig(t))
+
+	port2 := ":5552"
+	peer2 := newTLSPeer(t, port2, newTLSConfig(t))
+	defer func() {
+		require.NoError(t, dist1.Close())
+		require.NoError(t, peer2.Close())
+	}()
+
+	runner := dist1.Distribute(ep.Pipeline(ep.Scatter(), ep.Gather()), port1, port2)
+
+	errs := make(chan error)
+	go func() {
+		_, err := eptest.Run(runner, ep.NewDataset(strs{"hello"}))
+		errs <- err
+	}()
+
+	select {
+	case err := <-errs:
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "tls handshake failed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("verification failure hangs")
+	}
+}
+
+func newTLSPeer(t *testing.T, port string, config *tls.Config) ep.Distributer {
+	ln, err := net.Listen("tcp", port)
+	require.NoError(t, err)
+	return ep.NewTLSDistributer(port, ln, config)
+}
+
+// newTLSConfig returns a config with a new self-signed certificate for
+// localhost, trusted by both clients and servers of the config
+func newTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+func TestDistribute_multiplex(t *testing.T) {
+	// avoid "bind: address already in use" error in future tests
+	defer time.Sleep(1 * time.Millisecond)
+
+	ports := []string{":5551", ":5552", ":5553"}
+	dists := []ep.Distributer{}
+	listeners := []*countingListener{}
+	for _, port := range ports {
+		ln, err := net.Listen("tcp", port)
+		require.NoError(t, err)
+
+		counting := &countingListener{Listener: ln}
+		listeners = append(listeners, counting)
+		dists = append(dists, ep.Multiplex(ep.NewDistributer(port, counting)))
+	}
+	defer func() {
+		for _, d := range dists {
+			require.NoError(t, d.Close())
+		}
+	}()
+
+	runner := ep.Pipeline(ep.Scatter(), ep.Partition(0), ep.Broadcast(), ep.Gather())
+	runner = dists[0].Distribute(runner, ports...)
+
+	data1 := ep.NewDataset(strs{"hello", "world"})
+	data2 := ep.NewDataset(strs{"foo", "bar"})
+	data, err := eptest.Run(runner, data1, data2)
+	require.NoError(t, err)
+	require.Equal(t, 3*4, data.Len()) // broadcasted to all 3 nodes
+
+	// every node accepts one connection from each node with a lower address,
+	// shared by all exchanges, and the master distributes the runner to the
+	// other nodes over their own connections
+	accepts := []int{}
+	for _, ln := range listeners {
+		accepts = append(accepts, int(atomic.LoadInt64(&ln.accepts)))
+	}
+	require.Equal(t, []int{0, 1 + 1, 1 + 2}, accepts)
+}
+
+// countingListener is a listener that counts its accepted connections
+type countingListener struct {
+	net.Listener
+	accepts int64
+}
+
+func (ln *countingListener) Accept() (net.Conn, error) {
+	conn, err := ln.Listener.Accept()
+	if err == nil {
+		atomic.AddInt64(&ln.accepts, 1)
+	}
+	return conn, err
+}
+
+func TestDistribute_unixSockets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ep-unix")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// nodes on unix domain sockets, along with a node on TCP
+	addrs := []string{"unix://" + dir + "/1.sock", "unix://" + dir + "/2.sock", ":5553"}
+	dists := []ep.Distributer{}
+	for _, addr := range addrs {
+		dists = append(dists, eptest.NewPeer(t, addr))
+	}
+	defer func() {
+		for _, d := range dists {
+			require.NoError(t, d.Close())
+		}
+	}()
+
+	runner := ep.Pipeline(ep.Scatter(), ep.Partition(0), ep.Broadcast(), ep.Gather())
+	runner = dists[0].Distribute(runner, addrs...)
+
+	data1 := ep.NewDataset(strs{"hello", "world"})
+	data2 := ep.NewDataset(strs{"foo", "bar"})
+	data, err := eptest.Run(runner, data1, data2)
+	require.NoError(t, err)
+	require.Equal(t, 3*4, data.Len()) // broadcasted to all 3 nodes
+}
+
+// The last batches of the nodes are sent right before their exchanges complete
+// and close their connections, which mustn't lose them on the way
+func TestDistribute_tailBatches(t *testing.T) {
+	addrs := []string{":5551", ":5552", ":5553"}
+	dists := []ep.Distributer{}
+	for _, addr := range addrs {
+		dists = append(dists, eptest.NewPeer(t, addr))
+	}
+	defer func() {
+		for _, d := range dists {
+			require.NoError(t, d.Close())
+		}
+	}()
+
+	// large enough to exceed the socket buffers
+	batch := make(strs, 300000)
+	for i := range batch {
+		batch[i] = fmt.Sprintf("row-%d", i)
+	}
+
+	runner := dists[0].Distribute(ep.Pipeline(ep.Broadcast(), ep.Gather()), addrs...)
+	data, err := eptest.Run(runner, ep.NewDataset(batch))
+	require.NoError(t, err)
+	require.Equal(t, len(addrs)*len(batch), data.Len())
+}
+
+// The nodes run in processes of their own, started with only their address
+func TestDistribute_processes(t *testing.T) {
+	peer := exec.Command(os.Args[0], "-test.run=TestHelperPeer")
+	peer.Env = append(os.Environ(), "EP_TEST_PEER=:5562")
+	peer.Stderr = os.Stderr
+	require.NoError(t, peer.Start())
+	defer func() {
+		peer.Process.Kill()
+		peer.Wait()
+	}()
+
+	master, err := ep.ListenDistributer(":5561")
+	require.NoError(t, err)
+	defer master.Close()
+
+	// wait for the peer process to listen
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", ":5562")
+		if err == nil {
+			conn.Close()
+			break
+		}
+		require.True(t, time.Now().Before(deadline), "peer didn't listen: %s", err)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	runner := ep.Pipeline(ep.Scatter(), &nodeAddr{}, ep.Gather())
+	runner = master.Distribute(runner, ":5561", ":5562")
+
+	data1 := ep.NewDataset(strs{"hello", "world"})
+	data2 := ep.NewDataset(strs{"foo", "bar"})
+	data, err := eptest.Run(runner, data1, data2)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"hello", "world", "foo", "bar"}, data.At(0).Strings())
+	require.ElementsMatch(t, []string{":5561", ":5562"}, unique(data.At(1).Strings()))
+}
+
+// TestHelperPeer isn't a test, it's the peer process of
+// TestDistribute_processes, which serves until it's killed
+func TestHelperPeer(t *testing.T) {
+	addr := os.Getenv("EP_TEST_PEER")
+	if addr == "" {
+		return
+	}
+
+	_, err := ep.ListenDistributer(addr)
+	require.NoError(t, err)
+	select {}
+}
+
+func unique(vals []string) []string {
+	seen := map[string]bool{}
+	res := []string{}
+	for _, s := range vals {
+		if !seen[s] {
+			seen[s] = true
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func BenchmarkDistribute_scatter(b *testing.B) {
+	dir, err := ioutil.TempDir("", "ep-unix")
+	require.NoError(b, err)
+	defer os.RemoveAll(dir)
+
+	// 100k rows, in batches of 1000
+	var datasets []ep.Dataset
+	for i := 0; i < 100; i++ {
+		batch := make(strs, 1000)
+		for j := range batch {
+			batch[j] = fmt.Sprintf("row-%d-%d", i, j)
+		}
+		datasets = append(datasets, ep.NewDataset(batch))
+	}
+
+	networks := map[string][]string{
+		"tcp":  {":5551", ":5552"},
+		"unix": {"unix://" + dir + "/1.sock", "unix://" + dir + "/2.sock"},
+	}
+	for _, network := range []string{"tcp", "unix"} {
+		addrs := networks[network]
+		b.Run(network, func(b *testing.B) {
+			dists := []ep.Distributer{}
+			for _, addr := range addrs {
+				ln, err := ep.Listen(addr)
+				require.NoError(b, err)
+				dists = append(dists, ep.NewDistributer(addr, ln))
+			}
+			defer func() {
+				for _, d := range dists {
+					require.NoError(b, d.Close())
+				}
+			}()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runner := dists[0].Distribute(ep.Pipeline(ep.Scatter(), ep.Gather()), addrs...)
+				data, err := eptest.Run(runner, datasets...)
+				require.NoError(b, err)
+				require.Equal(b, 100*1000, data.Len())
+			}
+		})
+	}
+}
@@ -44,7 +44,7 @@
 //      Runners.Register(k interface{}, r Runners) Runners
 //      Runners.Get(k interface{}) []Runner
 //
-//      Types.Register(k interface{}, t Type) Types
+//      Types.Register(k interface{}, t Type, opts ...RegisterOption) Types
 //      Types.Get(k interface{}) []Type
 //
 // It's comparable to a global key-value registry of runners and types with
@@ -54,6 +54,10 @@
 // land on the same key. This is useful for planning, where we want to match
 // based on instances of that struct. See Planning below.
 //
+// Unlike Runners, the names of Types are unique: registering another Type of a
+// registered name panics, unless the Override option is passed. Types are also
+// looked up by their names with Types.Resolve, which fails on unknown names.
+//
 // Planning
 //
 // Planning is the process of constructing Runners based on some configuration
@@ -122,10 +126,12 @@ const (
 	masterNodeKey  ctxKey = "ep.MasterNode"
 	thisNodeKey    ctxKey = "ep.ThisNode"
 	distributerKey ctxKey = "ep.Distributer"
+	partitionedKey ctxKey = "ep.PartitionedBy"
+	progressKey    ctxKey = "ep.Progress"
 )
 
 // NodeAddress returns the current node address as saved in given context
 func NodeAddress(ctx context.Context) string {
-	thisAddress, _ := ctx.Value(thisNodeKey).(string)
+	thisAddress, _ := ctxValue(ctx, thisNodeKey).(string)
 	return thisAddress
 }
@@ -15,7 +15,8 @@ var _ = ep.Runners.
 	Register("nodeAddr", &nodeAddr{}).
 	Register("count", &count{}).
 	Register("upper", &upper{}).
-	Register("question", &question{})
+	Register("question", &question{}).
+	Register("panicker", &panicker{})
 
 // errRunner is a Runner that returns an error upon first input or inp closing
 type errRunner struct {
@@ -36,6 +37,23 @@ func (r *errRunner) Run(ctx context.Context, inp, out chan ep.Dataset) error {
 	return r.error
 }
 
+// panicker is a Runner that forwards its first After datasets, and panics upon
+// the following one, with an out of range column
+type panicker struct{ After int }
+
+func (*panicker) Returns() []ep.Type { return []ep.Type{str} }
+func (r *panicker) Run(ctx context.Context, inp, out chan ep.Dataset) error {
+	n := 0
+	for data := range inp {
+		if n == r.After {
+			data.At(data.Width())
+		}
+		n++
+		out <- data
+	}
+	return nil
+}
+
 // infinityRunner infinitely emits data until it's canceled
 type infinityRunner struct {
 	isRunningLock sync.Mutex
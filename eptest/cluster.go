@@ -10,9 +10,10 @@ import (
 	"testing"
 )
 
-// NewPeer returns distributer that listens on the given port
+// NewPeer returns distributer that listens on the given port, or the path of a
+// unix domain socket, prefixed with unix://
 func NewPeer(t *testing.T, port string) ep.Distributer {
-	ln, err := net.Listen("tcp", port)
+	ln, err := ep.Listen(port)
 	require.NoError(t, err)
 	return ep.NewDistributer(port, ln)
 }
@@ -1,9 +1,13 @@
 package eptest
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
 	"github.com/panoplyio/ep"
 	"github.com/stretchr/testify/require"
+	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -186,3 +190,333 @@ func VerifyDataNullsHandling(t *testing.T, data ep.Data, expectedNullString stri
 		require.True(t, strings[nullIdx] == expectedNullString)
 	})
 }
+
+// VerifyDataInvariants verifies the invariants of the Data of a Type that the
+// package relies on, property-style, for users implementing Data of their own
+// Types: Slice and Append reconstruct the data, without modifying it, Duplicate
+// multiplies its length, Copy moves exactly one row, Clones are isolated from
+// the data, sorting is consistent with LessOther, nulls survive all of the
+// above, gob round-trips it, and Cut splits it at its boundaries. Every
+// invariant is verified in a subtest of its name, failing with the violation.
+//
+// The sample must be Data of the Type of at least 3 rows. Null checks are
+// skipped when MarkNull doesn't mark any nulls, for Data that isn't nullable
+func VerifyDataInvariants(t *testing.T, typ ep.Type, sample ep.Data) {
+	require.Equal(t, typ.Name(), sample.Type().Name(), "the sample isn't of the type")
+	require.True(t, sample.Len() >= 3, "the sample must have at least 3 rows")
+
+	for _, inv := range dataInvariants {
+		t.Run(inv.name, func(t *testing.T) {
+			require.NoError(t, verifyInvariant(inv, typ, sample))
+		})
+	}
+}
+
+// dataInvariant is an invariant of Data, verified by VerifyDataInvariants. Its
+// check returns the violation, if any, and may panic on broken Data
+type dataInvariant struct {
+	name  string
+	check func(typ ep.Type, sample ep.Data) error
+}
+
+// verifyInvariant returns the violation of the invariant, prefixed by its name
+func verifyInvariant(inv dataInvariant, typ ep.Type, sample ep.Data) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: panicked: %v", inv.name, r)
+		}
+	}()
+
+	if err = inv.check(typ, sample); err != nil {
+		return fmt.Errorf("%s: %s", inv.name, err)
+	}
+	return nil
+}
+
+var dataInvariants = []dataInvariant{
+	{"Type", checkType},
+	{"SliceAppend", checkSliceAppend},
+	{"Duplicate", checkDuplicate},
+	{"Copy", checkCopy},
+	{"Clone", checkClone},
+	{"Sort", checkSort},
+	{"Nulls", checkNulls},
+	{"Gob", checkGob},
+	{"Cut", checkCut},
+}
+
+func checkType(typ ep.Type, sample ep.Data) error {
+	if n := typ.Data(3).Len(); n != 3 {
+		return fmt.Errorf("Data(3) has %d rows", n)
+	} else if n := typ.DataEmpty(3).Len(); n != 0 {
+		return fmt.Errorf("DataEmpty(3) has %d rows", n)
+	} else if name := typ.Data(3).Type().Name(); name != typ.Name() {
+		return fmt.Errorf("Data(3) is of type %s, expected %s", name, typ.Name())
+	}
+	return nil
+}
+
+func checkSliceAppend(_ ep.Type, sample ep.Data) error {
+	n := sample.Len()
+	for k := 0; k <= n; k++ {
+		if err := sameValues(sample.Slice(0, k), sample.Strings()[:k], sample.Nulls()[:k]); err != nil {
+			return fmt.Errorf("Slice(0, %d): %s", k, err)
+		}
+
+		res := sample.Slice(0, k).Append(sample.Slice(k, n))
+		if err := sameValues(res, sample.Strings(), sample.Nulls()); err != nil {
+			return fmt.Errorf("Slice(0, %d).Append(Slice(%d, %d)) doesn't reconstruct the data: %s", k, k, n, err)
+		}
+	}
+
+	// appending other values to a slice doesn't overwrite the rows after it
+	strs, nulls := snapshot(sample)
+	sample.Slice(0, 1).Append(sample.Slice(2, 3))
+	if err := sameValues(sample, strs, nulls); err != nil {
+		return fmt.Errorf("Slice(0, 1).Append(Slice(2, 3)) modifies the data: %s", err)
+	}
+	return nil
+}
+
+func checkDuplicate(_ ep.Type, sample ep.Data) error {
+	strs, nulls := snapshot(sample)
+	for _, times := range []int{0, 1, 3} {
+		var expected []string
+		var expectedNulls []bool
+		for i := 0; i < times; i++ {
+			expected = append(expected, strs...)
+			expectedNulls = append(expectedNulls, nulls...)
+		}
+
+		if err := sameValues(sample.Duplicate(times), expected, expectedNulls); err != nil {
+			return fmt.Errorf("Duplicate(%d): %s", times, err)
+		}
+	}
+	return nil
+}
+
+func checkCopy(typ ep.Type, sample ep.Data) error {
+	n := sample.Len()
+	for from := 0; from < n; from++ {
+		for to := 0; to < n; to++ {
+			res := ep.Clone(sample)
+			res.Copy(sample, from, to)
+
+			strs, nulls := snapshot(sample)
+			strs[to], nulls[to] = strs[from], nulls[from]
+			if err := sameValues(res, strs, nulls); err != nil {
+				return fmt.Errorf("Copy(data, %d, %d) doesn't copy exactly one row: %s", from, to, err)
+			}
+		}
+	}
+
+	// into new Data of the Type, in reverse
+	res := typ.Data(n)
+	for i := 0; i < n; i++ {
+		res.Copy(sample, n-1-i, i)
+	}
+	strs, nulls := snapshot(sample)
+	for i := 0; i < n/2; i++ {
+		strs[i], strs[n-1-i] = strs[n-1-i], strs[i]
+		nulls[i], nulls[n-1-i] = nulls[n-1-i], nulls[i]
+	}
+	if err := sameValues(res, strs, nulls); err != nil {
+		return fmt.Errorf("Copy into Data(%d) of the type: %s", n, err)
+	}
+	return nil
+}
+
+func checkClone(_ ep.Type, sample ep.Data) error {
+	strs, nulls := snapshot(sample)
+	clone := ep.Clone(sample)
+	if err := sameValues(clone, strs, nulls); err != nil {
+		return err
+	} else if !sample.Equal(sample) {
+		return fmt.Errorf("the data isn't Equal to itself")
+	} else if !ep.Same(sample, sample) {
+		return fmt.Errorf("the data isn't the Same as itself")
+	} else if ep.Same(sample, clone) {
+		return fmt.Errorf("the data is the Same as its clone, which doesn't share it")
+	}
+
+	// modifying the clone doesn't modify the data
+	n := clone.Len()
+	clone.Swap(0, n-1)
+	clone.Copy(clone, 1, 0)
+	clone.MarkNull(1)
+	if err := sameValues(sample, strs, nulls); err != nil {
+		return fmt.Errorf("modifying the clone modifies the data: %s", err)
+	}
+	return nil
+}
+
+func checkSort(_ ep.Type, sample ep.Data) error {
+	data := ep.Clone(sample)
+	sort.Sort(data)
+	n := data.Len()
+	for i := 1; i < n; i++ {
+		if data.Less(i, i-1) {
+			return fmt.Errorf("rows %d and %d aren't sorted after sorting", i-1, i)
+		}
+	}
+
+	expected, _ := snapshot(sample)
+	actual, _ := snapshot(data)
+	sort.Strings(expected)
+	sort.Strings(actual)
+	if !reflect.DeepEqual(expected, actual) {
+		return fmt.Errorf("sorting changes the values to %v, expected %v", actual, expected)
+	}
+
+	other := ep.Clone(data)
+	for i := 0; i < n; i++ {
+		if data.Less(i, i) {
+			return fmt.Errorf("row %d is Less than itself", i)
+		}
+		for j := 0; j < n; j++ {
+			if data.Less(i, j) != data.LessOther(i, other, j) {
+				return fmt.Errorf("Less(%d, %d) is %v, but LessOther of a clone isn't", i, j, data.Less(i, j))
+			} else if data.Less(i, j) && data.Less(j, i) {
+				return fmt.Errorf("rows %d and %d are Less than one another", i, j)
+			} else if c := ep.Compare(data, i, other, j); c != cmpLess(data, i, j) {
+				return fmt.Errorf("Compare(%d, %d) is %d, inconsistent with Less", i, j, c)
+			}
+		}
+	}
+
+	// the stable sort is consistent with the unstable one
+	stable := ep.Clone(sample)
+	sort.Stable(stable)
+	if !reflect.DeepEqual(stable.Strings(), data.Strings()) {
+		return fmt.Errorf("stable sort %v differs from %v", stable.Strings(), data.Strings())
+	}
+	return nil
+}
+
+func cmpLess(data ep.Data, i, j int) int {
+	if data.Less(i, j) {
+		return -1
+	} else if data.Less(j, i) {
+		return 1
+	}
+	return 0
+}
+
+func checkNulls(_ ep.Type, sample ep.Data) error {
+	data := ep.Clone(sample)
+	data.MarkNull(1)
+	if !data.IsNull(1) {
+		return nil // not nullable
+	}
+
+	n := data.Len()
+	checks := []struct {
+		name string
+		data ep.Data
+		row  int
+	}{
+		{"Nulls", data, 1},
+		{"Slice(1, 2)", data.Slice(1, 2), 0},
+		{"Append", data.Append(data), n + 1},
+		{"Duplicate(2)", data.Duplicate(2), n + 1},
+		{"Clone", ep.Clone(data), 1},
+	}
+	for _, c := range checks {
+		if !c.data.IsNull(c.row) || !c.data.Nulls()[c.row] {
+			return fmt.Errorf("%s loses the null of row %d", c.name, c.row)
+		}
+		if c.row > 0 && c.data.Nulls()[c.row-1] != data.IsNull((c.row-1)%n) {
+			return fmt.Errorf("%s marks row %d null", c.name, c.row-1)
+		}
+	}
+
+	res := ep.Clone(sample)
+	res.Copy(data, 1, 0)
+	if !res.IsNull(0) {
+		return fmt.Errorf("Copy of a null over a value loses the null")
+	}
+	res.Copy(sample, 2, 0)
+	if res.IsNull(0) != sample.IsNull(2) {
+		return fmt.Errorf("Copy of a value over a null keeps the null")
+	}
+	return mustGob(data)
+}
+
+func checkGob(_ ep.Type, sample ep.Data) error {
+	return mustGob(sample)
+}
+
+// mustGob returns an error unless the data is decoded by gob into the same
+// values, as it's sent by exchanges
+func mustGob(data ep.Data) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&data); err != nil {
+		return fmt.Errorf("gob can't encode the data, its Type should be registered with ep.Types.Register: %s", err)
+	}
+
+	var decoded ep.Data
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		return fmt.Errorf("gob can't decode the data: %s", err)
+	} else if decoded.Type().Name() != data.Type().Name() {
+		return fmt.Errorf("gob decodes the data as %s", decoded.Type())
+	} else if err := sameValues(decoded, data.Strings(), data.Nulls()); err != nil {
+		return fmt.Errorf("gob doesn't round-trip the data: %s", err)
+	}
+	return nil
+}
+
+func checkCut(_ ep.Type, sample ep.Data) error {
+	n := sample.Len()
+	cuts := map[string][]int{"0": {0}, "the end": {n}, "1, 2": {1, 2}, "2, 1, 1": {2, 1, 1}, "0, 1, the end": {0, 1, n}}
+	// the ends of the parts, which are never empty
+	ends := map[string][]int{"0": {n}, "the end": {n}, "1, 2": {1, 2, n}, "2, 1, 1": {1, 2, n}, "0, 1, the end": {1, n}}
+	for name, cutpoints := range cuts {
+		res := ep.Cut(sample, cutpoints...).(ep.Dataset)
+		if res.Width() != len(ends[name]) {
+			return fmt.Errorf("Cut at %s returns %d parts, expected %d", name, res.Width(), len(ends[name]))
+		}
+
+		last := 0
+		var strs []string
+		for i, end := range ends[name] {
+			if res.At(i).Len() != end-last {
+				return fmt.Errorf("Cut at %s returns %d rows in part %d, expected %d", name, res.At(i).Len(), i, end-last)
+			}
+			strs = append(strs, res.At(i).Strings()...)
+			last = end
+		}
+
+		if !equalStrings(strs, sample.Strings()) {
+			return fmt.Errorf("Cut at %s returns %v, expected %v", name, strs, sample.Strings())
+		}
+	}
+	return nil
+}
+
+// snapshot returns copies of the strings and nulls of the data, as Strings may
+// return the values of the data itself
+func snapshot(data ep.Data) ([]string, []bool) {
+	return append([]string(nil), data.Strings()...), data.Nulls()
+}
+
+// sameValues returns an error unless the data has the strings and nulls
+func sameValues(data ep.Data, strs []string, nulls []bool) error {
+	if data.Len() != len(strs) {
+		return fmt.Errorf("%d rows, expected %d", data.Len(), len(strs))
+	} else if !equalStrings(data.Strings(), strs) {
+		return fmt.Errorf("values %q, expected %q", data.Strings(), strs)
+	}
+
+	actual := data.Nulls()
+	for i := range nulls {
+		if actual[i] != nulls[i] || data.IsNull(i) != nulls[i] {
+			return fmt.Errorf("nulls %v, expected %v", actual, nulls)
+		}
+	}
+	return nil
+}
+
+// equalStrings compares the strings, where nil and empty ones are equal
+func equalStrings(a, b []string) bool {
+	return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+}
@@ -0,0 +1,155 @@
+package eptest
+
+import (
+	"encoding/gob"
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+)
+
+var _ = ep.Types.Register("eptest_ints", &intsType{})
+
+func TestVerifyDataInvariants(t *testing.T) {
+	VerifyDataInvariants(t, &intsType{}, newInts(""))
+}
+
+// Broken implementations fail with the invariant they violate
+func TestVerifyDataInvariants_broken(t *testing.T) {
+	bugs := map[string]string{
+		"slice":     "SliceAppend: Slice(0, 1).Append(Slice(1, 5)) doesn't reconstruct the data",
+		"overwrite": "SliceAppend: Slice(0, 1).Append(Slice(2, 3)) modifies the data: values [\"3\" \"4\" \"4\" \"1\" \"5\"]",
+		"duplicate": "Duplicate: Duplicate(0): 5 rows, expected 0",
+		"copy":      "Copy: Copy(data, 0, 0) doesn't copy exactly one row",
+		"share":     "Clone: the data is the Same as its clone, which doesn't share it",
+		"less":      "Sort: rows 0 and 1 aren't sorted after sorting",
+		"nulls":     "Nulls: Append loses the null of row 6",
+		"panic":     "Type: panicked: not implemented",
+	}
+
+	for bug, expected := range bugs {
+		t.Run(bug, func(t *testing.T) {
+			var violations []string
+			for _, inv := range dataInvariants {
+				if err := verifyInvariant(inv, &intsType{bug}, newInts(bug)); err != nil {
+					violations = append(violations, err.Error())
+				}
+			}
+			require.NotEmpty(t, violations)
+			require.Contains(t, violations[0], expected)
+		})
+	}
+
+	// Data that isn't registered with gob
+	err := verifyInvariant(dataInvariants[len(dataInvariants)-2], &intsType{}, &unregisteredInts{*newInts("")})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Gob: gob can't encode the data, its Type should be registered with ep.Types.Register: ")
+}
+
+func newInts(bug string) *ints {
+	return &ints{[]int64{3, 1, 4, 1, 5}, make([]bool, 5), bug}
+}
+
+// intsType is the Type of ints, with the bug of its Data, if any
+type intsType struct{ Bug string }
+
+func (t *intsType) String() string { return t.Name() }
+func (*intsType) Name() string     { return "eptest_ints" }
+func (t *intsType) Data(n int) ep.Data {
+	if t.Bug == "panic" {
+		panic("not implemented")
+	}
+	return &ints{make([]int64, n), make([]bool, n), t.Bug}
+}
+func (t *intsType) DataEmpty(n int) ep.Data {
+	return &ints{make([]int64, 0, n), make([]bool, 0, n), t.Bug}
+}
+
+// ints is Data implemented from scratch, as by users, with one of several bugs
+type ints struct {
+	Values []int64
+	Null   []bool
+	Bug    string
+}
+
+type unregisteredInts struct{ ints }
+
+func (vs *ints) Type() ep.Type      { return &intsType{vs.Bug} }
+func (vs *ints) Len() int           { return len(vs.Values) }
+func (vs *ints) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+func (vs *ints) Swap(i, j int) {
+	vs.Values[i], vs.Values[j] = vs.Values[j], vs.Values[i]
+	vs.Null[i], vs.Null[j] = vs.Null[j], vs.Null[i]
+}
+func (vs *ints) LessOther(thisRow int, other ep.Data, otherRow int) bool {
+	data := other.(*ints)
+	if vs.Null[thisRow] || data.Null[otherRow] {
+		return !vs.Null[thisRow] && data.Null[otherRow]
+	} else if vs.Bug == "less" {
+		return vs.Values[thisRow] <= data.Values[otherRow]
+	}
+	return vs.Values[thisRow] < data.Values[otherRow]
+}
+func (vs *ints) Slice(s, e int) ep.Data {
+	if vs.Bug == "slice" {
+		s, e = 0, e-s
+	}
+	return &ints{vs.Values[s:e], vs.Null[s:e], vs.Bug}
+}
+func (vs *ints) Append(other ep.Data) ep.Data {
+	data := other.(*ints)
+	n := vs.Len()
+	if vs.Bug == "overwrite" {
+		n = cap(vs.Values)
+	}
+	res := &ints{append(vs.Values[:vs.Len():n], data.Values...), append(vs.Null[:vs.Len():n], data.Null...), vs.Bug}
+	if vs.Bug == "nulls" {
+		res.Null = append(vs.Null[:vs.Len():vs.Len()], make([]bool, data.Len())...)
+	}
+	return res
+}
+func (vs *ints) Duplicate(t int) ep.Data {
+	if vs.Bug == "duplicate" {
+		return vs
+	}
+
+	res := &ints{Bug: vs.Bug}
+	for i := 0; i < t; i++ {
+		res.Values = append(res.Values, vs.Values...)
+		res.Null = append(res.Null, vs.Null...)
+	}
+	return res
+}
+func (vs *ints) IsNull(i int) bool { return vs.Null[i] }
+func (vs *ints) MarkNull(i int)    { vs.Null[i] = true }
+func (vs *ints) Nulls() []bool     { return append([]bool(nil), vs.Null...) }
+func (vs *ints) Equal(other ep.Data) bool {
+	data, ok := other.(*ints)
+	return ok && (vs == data || vs.Len() > 0 && data.Len() > 0 && &vs.Values[0] == &data.Values[0])
+}
+func (vs *ints) Copy(from ep.Data, fromRow, toRow int) {
+	src := from.(*ints)
+	vs.Values[toRow], vs.Null[toRow] = src.Values[fromRow], src.Null[fromRow]
+	if vs.Bug == "copy" && toRow+1 < vs.Len() {
+		vs.Values[toRow+1], vs.Null[toRow+1] = src.Values[fromRow], src.Null[fromRow]
+	}
+}
+func (vs *ints) Clone() ep.Data {
+	if vs.Bug == "share" {
+		return &ints{vs.Values, vs.Null, vs.Bug}
+	}
+	return &ints{append([]int64(nil), vs.Values...), append([]bool(nil), vs.Null...), vs.Bug}
+}
+func (vs *ints) Strings() []string {
+	res := make([]string, vs.Len())
+	for i, v := range vs.Values {
+		if !vs.Null[i] {
+			res[i] = strconv.FormatInt(v, 10)
+		}
+	}
+	return res
+}
+
+func init() {
+	gob.Register(&ints{})
+}
@@ -1,4 +1,5 @@
-// Package eptest contains only tests utilities (without actual tests).
+// Package eptest contains only tests utilities (without actual tests), e.g. for
+// running Runners on clusters of in-process nodes with InMemoryCluster.
 package eptest
 
 import (
@@ -29,9 +30,9 @@ func RunWithContext(ctx context.Context, r ep.Runner, datasets ...ep.Dataset) (r
 		close(inp)
 	}()
 
-	res = ep.NewDataset()
+	var outs []ep.Dataset
 	for data := range out {
-		res = res.Append(data).(ep.Dataset)
+		outs = append(outs, data)
 	}
-	return res, err
+	return ep.ConcatDatasets(outs...), err
 }
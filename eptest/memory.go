@@ -0,0 +1,123 @@
+package eptest
+
+// memory.go contains an in-process transport for running clusters of virtual
+// nodes within a single binary
+
+import (
+	"fmt"
+	"github.com/panoplyio/ep"
+	"net"
+	"sync"
+)
+
+// Cluster is a cluster of virtual nodes in this process, created by
+// InMemoryCluster
+type Cluster struct {
+	Nodes []string         // the addresses of the nodes, the first is the main node
+	Peers []ep.Distributer // the Distributers of the nodes, by the order of Nodes
+}
+
+// InMemoryCluster returns a cluster of n virtual nodes, each with its own
+// Distributer, that are connected to each other with in-memory connections
+// instead of listening on ports. Runners distributed by the cluster are run by
+// every one of the nodes in its own go-routines, with the cluster information
+// in their contexts, exactly as they would in a real cluster. Thus it's useful
+// for testing and prototyping distributed plans without any deployment.
+// The cluster must be closed once done
+func InMemoryCluster(n int) *Cluster {
+	network := &memNetwork{listeners: map[string]*memListener{}}
+	c := &Cluster{}
+	for i := 0; i < n; i++ {
+		addr := fmt.Sprintf("mem:%d", i+1)
+		c.Nodes = append(c.Nodes, addr)
+		c.Peers = append(c.Peers, ep.NewDistributer(addr, network.listen(addr)))
+	}
+	return c
+}
+
+// Distribute distributes a Runner to all of the nodes of the cluster, with the
+// first node as the main node
+func (c *Cluster) Distribute(r ep.Runner) ep.Runner {
+	return c.Peers[0].Distribute(r, c.Nodes...)
+}
+
+// Close closes all of the nodes of the cluster
+func (c *Cluster) Close() (err error) {
+	for _, peer := range c.Peers {
+		closeErr := peer.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// memNetwork routes the dialed connections to the listeners by their address
+type memNetwork struct {
+	sync.Mutex
+	listeners map[string]*memListener
+}
+
+func (network *memNetwork) listen(addr string) *memListener {
+	ln := &memListener{
+		network: network,
+		addr:    memAddr(addr),
+		conns:   make(chan net.Conn),
+		closed:  make(chan struct{}),
+	}
+
+	network.Lock()
+	defer network.Unlock()
+	network.listeners[addr] = ln
+	return ln
+}
+
+// memListener is a listener of in-memory connections. It also implements the
+// dialer expected by the Distributer, thus it's used to connect to the other
+// listeners of the network as well
+type memListener struct {
+	network   *memNetwork
+	addr      memAddr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (ln *memListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-ln.conns:
+		return conn, nil
+	case <-ln.closed:
+		return nil, fmt.Errorf("eptest: listener %s closed", ln.addr)
+	}
+}
+
+func (ln *memListener) Close() error {
+	ln.closeOnce.Do(func() { close(ln.closed) })
+	return nil
+}
+
+func (ln *memListener) Addr() net.Addr { return ln.addr }
+
+func (ln *memListener) Dial(network, addr string) (net.Conn, error) {
+	ln.network.Lock()
+	target := ln.network.listeners[addr]
+	ln.network.Unlock()
+
+	if target == nil {
+		return nil, fmt.Errorf("eptest: no node %s", addr)
+	}
+
+	conn, peerConn := net.Pipe()
+	select {
+	case target.conns <- peerConn:
+		return conn, nil
+	case <-target.closed:
+		return nil, fmt.Errorf("eptest: connection refused by %s", addr)
+	}
+}
+
+type memAddr string
+
+func (addr memAddr) Network() string { return "memory" }
+func (addr memAddr) String() string  { return string(addr) }
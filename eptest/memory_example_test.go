@@ -0,0 +1,21 @@
+package eptest_test
+
+import (
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+)
+
+// Runs a distributed plan on a cluster of 3 virtual nodes within this process
+func ExampleInMemoryCluster() {
+	cluster := eptest.InMemoryCluster(3)
+	defer cluster.Close()
+
+	// every node broadcasts its input to all of the nodes, and the results
+	// are gathered by the main node
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.Broadcast(), ep.Gather()))
+	data, err := eptest.Run(runner, ep.NewDataset(ep.Null.Data(2)), ep.NewDataset(ep.Null.Data(1)))
+	fmt.Println(cluster.Nodes, data.Len(), err)
+
+	// Output: [mem:1 mem:2 mem:3] 9 <nil>
+}
@@ -2,15 +2,21 @@ package ep
 
 import (
 	"context"
-	"encoding/gob"
+	"crypto/sha256"
 	"fmt"
 	"github.com/satori/go.uuid"
 	"io"
+	"io/ioutil"
 	"net"
+	"sort"
 	"stathat.com/c/consistent"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-var _ = registerGob(&exchange{}, &req{}, &errMsg{})
+var _ = registerGob(&exchange{}, &req{}, &errMsg{}, &seqBatch{}, &endOfStream{})
 
 type exchangeType int
 
@@ -20,55 +26,349 @@ const (
 	scatter
 	broadcast
 	partition
+	sortGather
+	orderedGather
+	allGather
 )
 
 // Gather returns an exchange Runner that gathers all of its input into a
 // single node. In all other nodes it will produce no output, but on the main
-// node it will be passthrough from all of the other nodes
+// node it will be passthrough from all of the other nodes. Datasets from every
+// node are received in the order they were sent from that node, and the nodes
+// are interleaved in a round robin
 func Gather() Runner {
-	uid, _ := uuid.NewV4()
-	return &exchange{UID: uid.String(), Type: gather}
+	return &exchange{UID: newUID(), Type: gather}
+}
+
+// GatherTo returns an exchange Runner similar to Gather, except that it gathers
+// all of its input into the node at the provided address, instead of the main
+// node, e.g. into the node that owns the output. The address must be one of
+// the nodes running the exchange, and all of the other nodes, including the
+// main node, produce no output.
+func GatherTo(addr string) Runner {
+	return &exchange{UID: newUID(), Type: gather, Target: addr}
+}
+
+// OrderedGather returns an exchange Runner similar to Gather, except that it
+// explicitly enforces the per-node order: every dataset is tagged with a
+// sequence number by its sender, and datasets are reordered by these numbers
+// on the main node in case they arrive out of order.
+func OrderedGather() Runner {
+	return &exchange{UID: newUID(), Type: orderedGather}
+}
+
+// SortGather returns an exchange Runner that gathers all of its input into a
+// single node, similar to Gather. It expects the input on every node to be
+// sorted by the provided columns, and merges these streams on the main node such
+// that the output is sorted as well.
+func SortGather(cols ...SortingCol) Runner {
+	return &exchange{UID: newUID(), Type: sortGather, SortingCols: cols}
 }
 
 // Scatter returns an exchange Runner that scatters its input uniformly to
 // all other nodes such that the received datasets are dispatched in a round-
 // robin to the nodes.
 func Scatter() Runner {
-	uid, _ := uuid.NewV4()
-	return &exchange{UID: uid.String(), Type: scatter}
+	return &exchange{UID: newUID(), Type: scatter}
+}
+
+// ScatterWeighted returns an exchange Runner similar to Scatter, except that
+// the round-robin is weighted: a node with weight 3 receives three consecutive
+// datasets in every cycle. Nodes missing from weights default to a weight of
+// 1, and nodes with a weight of 0 receive nothing.
+func ScatterWeighted(weights map[string]int) Runner {
+	return &exchange{UID: newUID(), Type: scatter, Weights: weights}
+}
+
+// ScatterBySize returns an exchange Runner similar to Scatter, except that every
+// dataset is sent to the node that received the fewest rows so far, instead of
+// the next one in a round-robin. It balances the nodes better when the sizes
+// of the input datasets vary wildly.
+func ScatterBySize() Runner {
+	return &exchange{UID: newUID(), Type: scatter, BySize: true}
+}
+
+// ScatterByKey returns an exchange Runner similar to Scatter, except that every
+// dataset is routed as a whole by a hash of the first value of the provided
+// column, such that datasets with the same key consistently land on the same
+// node. Unlike Partition, rows aren't split, thus it assumes that the upstream
+// already groups the rows by the key within every dataset. Empty datasets are
+// sent in a round-robin, and null keys are all sent to the same node.
+func ScatterByKey(col int) Runner {
+	return &exchange{UID: newUID(), Type: scatter, KeyCols: []int{col}}
 }
 
 // Broadcast returns an exchange Runner that duplicates its input to all
 // other nodes. The output will be effectively a union of all of the inputs from
 // all nodes (order not guaranteed)
 func Broadcast() Runner {
-	uid, _ := uuid.NewV4()
-	return &exchange{UID: uid.String(), Type: broadcast}
+	return &exchange{UID: newUID(), Type: broadcast}
+}
+
+// BroadcastDistinct returns an exchange Runner similar to Broadcast, except that
+// duplicate datasets are dropped on the receiving side, such that when every
+// node broadcasts the same datasets, every node outputs a single copy of them.
+// Datasets are duplicates when all of their column types and values are
+// equal, thus batching might prevent it as the batches depend on the timing.
+func BroadcastDistinct() Runner {
+	return &exchange{UID: newUID(), Type: broadcast, Distinct: true}
+}
+
+// AllGather returns an exchange Runner that gathers all of its input into every
+// node, such that every node outputs the union of the inputs from all nodes
+// (order not guaranteed). It's the symmetric form of Broadcast, where every
+// node is a receiver regardless of which node is the main one, e.g. for
+// building the replicated side of a join on every node
+func AllGather() Runner {
+	return &exchange{UID: newUID(), Type: allGather}
 }
 
 // Partition returns an exchange Runner that routes the data between nodes using
-// consistent hashing algorithm. The provided column of an incoming dataset
-// will be used to find an appropriate endpoint for this data.
+// consistent hashing algorithm. The values of the provided columns of an
+// incoming dataset are hashed, row by row, to find an appropriate endpoint for
+// each row, such that the same key always lands on the same node. When no
+// columns are provided, the first column is used.
 // The output will not necessarily be in the same order as the input.
-func Partition(column int) Runner {
-	uid, _ := uuid.NewV4()
-	return &exchange{UID: uid.String(), Type: partition, partitionCol: column}
+func Partition(columns ...int) Runner {
+	return &exchange{UID: newUID(), Type: partition, PartitionCols: columns}
+}
+
+// Shuffle returns an exchange Runner that partitions its input by the values of
+// the provided columns, like Partition, as the building block of distributed
+// hash joins: both sides of the join are shuffled by their key columns, and
+// every node joins the rows that it receives. The node of every key depends
+// only on the key and on the nodes in the context, thus separate Shuffle (and
+// Partition) exchanges route equal keys to the same node, which is returned
+// by ShuffleNodes. Keys are compared by the HashDataset of their columns,
+// thus the key columns of both sides should be of the same types.
+func Shuffle(cols ...int) Runner {
+	return Partition(cols...)
+}
+
+// ShuffleNodes returns the nodes, out of the provided nodes, that Shuffle and
+// Partition route the rows of data to by the provided columns, e.g. for joins
+// to verify that both of their sides are compatibly partitioned. The nodes
+// are the ones participating in the exchanges, as set in the context
+func ShuffleNodes(nodes []string, data Dataset, cols ...int) ([]string, error) {
+	ring := consistent.New()
+	for _, node := range nodes {
+		ring.Add(node)
+	}
+
+	keys, err := partitionKeys(data, partitionColumns(cols))
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, len(keys))
+	for i, key := range keys {
+		res[i], err = ring.Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find a target node: %s", err)
+		}
+	}
+	return res, nil
+}
+
+// BatchSize sets an exchange Runner, returned by Scatter, Gather, Partition,
+// etc., to coalesce the datasets of its input into batches of at least n rows
+// before sending them. Batches are also sent once the input is exhausted, and
+// a short while after their first dataset was received, such that the latency
+// stays bounded.
+func BatchSize(r Runner, n int) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: BatchSize expects an exchange")
+	}
+
+	ex.BatchSize = n
+	return ex
+}
+
+// BatchBytes sets an exchange Runner, returned by Scatter, Gather, Partition,
+// etc., to coalesce the datasets of its input into batches of at least n
+// bytes, by their DatasetSize, before sending them, like BatchSize. When both
+// are set, a batch is sent once either one of them is reached
+func BatchBytes(r Runner, n int) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: BatchBytes expects an exchange")
+	}
+
+	ex.BatchBytes = n
+	return ex
+}
+
+// MaxRows sets an exchange Runner, returned by Scatter, Gather, Partition, etc.,
+// to split the datasets it receives into datasets of at most n rows, such that
+// downstream runners see bounded batches regardless of what peers send.
+func MaxRows(r Runner, n int) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: MaxRows expects an exchange")
+	}
+
+	ex.MaxRows = n
+	return ex
+}
+
+// WithUID sets the UID of an exchange Runner, returned by Scatter, Gather,
+// Partition, etc., instead of its random one, e.g. for deterministic UIDs when
+// debugging. The UID identifies the connections of the exchange, thus all of
+// the exchanges that run at the same time on a Distributer must have distinct
+// UIDs, otherwise they fail to connect.
+func WithUID(r Runner, uid string) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: WithUID expects an exchange")
+	}
+
+	ex.UID = uid
+	return ex
+}
+
+// ReceiveQueue sets the capacity of the queue of an exchange Runner, returned
+// by Scatter, Gather, Partition, etc., between receiving from its sources and
+// its output, in datasets. Once it's full, receiving blocks until the consumer
+// catches up, which in turn blocks the sending peers, such that the memory held
+// by a slow consumer is bounded. Nothing is dropped. The default capacity is
+// small, and the queue isn't used when receiving in a RoundRobin.
+func ReceiveQueue(r Runner, n int) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: ReceiveQueue expects an exchange")
+	}
+
+	ex.ReceiveQueue = n
+	return ex
 }
 
+// newUID returns a random UID for a new exchange, such that the exchanges of
+// concurrent plans never share connections
+func newUID() string {
+	uid, err := uuid.NewV4()
+	if err != nil {
+		// the zero uuid would collide with all of the others
+		panic("ep: failed to generate an exchange uid: " + err.Error())
+	}
+	return uid.String()
+}
+
+// RoundRobin sets an exchange Runner, returned by Scatter, Gather, Partition,
+// etc., to receive from its source nodes in a strict round robin, instead of
+// receiving from whichever node sent first. The datasets are then received in
+// a deterministic order, at the pace of the slowest node.
+func RoundRobin(r Runner) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: RoundRobin expects an exchange")
+	}
+
+	ex.RoundRobin = true
+	return ex
+}
+
+// Retry sets the number of attempts an exchange Runner, returned by Scatter,
+// Gather, Partition, etc., makes to connect to every one of its peers before
+// failing, and the backoff before the second attempt. The backoff doubles after
+// every failed attempt, such that peers that are still starting up get the time
+// to bind their listeners. Any other Runner is retried with RetryBatches
+func Retry(r Runner, attempts int, backoff time.Duration) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: Retry expects an exchange")
+	}
+
+	ex.ConnectAttempts = attempts
+	ex.ConnectBackoff = backoff
+	return ex
+}
+
+// peerErrorGrace is the time to wait for an error sent by a peer, after failing
+// to encode to it
+var peerErrorGrace = 100 * time.Millisecond
+
+// batchLatency is the longest time datasets are held for batching
+var batchLatency = 10 * time.Millisecond
+
+// the default number of connection attempts to every peer, and the backoff
+// before the second attempt, unless set with Retry
+var (
+	connectAttempts = 3
+	connectBackoff  = 10 * time.Millisecond
+)
+
 // exchange is a Runner that exchanges data between peer nodes
 type exchange struct {
-	UID  string
-	Type exchangeType
-
-	encs         []encoder              // encoders to all destination connections
-	decs         []decoder              // decoders from all source connections
-	conns        []io.Closer            // all open connections (used for closing)
-	encsNext     int                    // Encoders Round Robin next index
-	decsNext     int                    // Decoders Round Robin next index
-	hashRing     *consistent.Consistent // hash ring for consistent hashing
-	encsByKey    map[string]encoder     // encoders mapped by key (node address)
-	partitionCol int                    // column index to use for partitioning
-	inited       bool                   // was this runner initialized
+	UID           string
+	Type          exchangeType
+	PartitionCols []int          // column indices to use for partitioning
+	Partitioner   Partitioner    // when set, used for partitioning instead of hashing
+	SortingCols   []SortingCol   // columns by which the gathered streams are sorted
+	Target        string         // the node gathered into instead of the main node, when set
+	Compression   Compression    // compression of the streams sent from this node
+	BatchSize     int            // minimum number of rows to send at once, when batching
+	BatchBytes    int            // minimum number of bytes to send at once, when batching
+	MaxRows       int            // maximum number of rows per received dataset, when set
+	Weights       map[string]int // scatter weights by node address, when set
+	BySize        bool           // scatter to the least loaded node
+	KeyCols       []int          // scatter whole datasets by their first key, when set
+	Timeout       time.Duration  // maximum duration of a read or write, when set
+	RateLimit     int            // maximum bytes per second sent from this node, when set
+	SpillRows     int            // rows received ahead of the consumer before spilling to disk, when set
+	Distinct      bool           // drop duplicate datasets upon receiving
+	Limit         int            // maximum number of rows received, when set
+	BestEffort    bool           // skip failed peers, unless all of them failed
+	Checksums     bool           // verify the checksums of the streams
+	RoundRobin    bool           // receive from the sources in a strict round robin
+	ReceiveQueue  int            // datasets received ahead of the consumer, when set
+	Resilient     bool           // re-send the unacknowledged datasets of failed peers
+	AckWindow     int            // unacknowledged datasets kept per peer, when resilient
+
+	ConnectAttempts int           // number of attempts to connect to every peer, when set
+	ConnectBackoff  time.Duration // backoff before the second connection attempt, when set
+
+	HeartbeatInterval time.Duration // idle time before sending a heartbeat, when set
+	HeartbeatTimeout  time.Duration // idle time before a peer is dead, when set
+	PeerDeath         PeerDeath     // what to do once a peer is dead
+
+	thisNode    string                 // the address of this node
+	stats       map[string]*peerStats  // transfer statistics by peer address
+	progress    *progressConfig        // set by Progress, not distributed
+	reporter    *progressReporter      // while reporting the progress
+	statsL      sync.Mutex             // guards stats
+	limiter     *byteLimiter           // shared by all connections, when rate limited
+	spill       *spillQueue            // the received datasets not yet read, when spilling
+	received    map[string]bool        // hashes of the datasets received, when distinct
+	limited     int                    // number of rows received, when limited
+	sources     []net.Conn             // connections from all remote source nodes
+	stopped     chan struct{}          // closed once sending is stopped, when limited
+	stopOnce    sync.Once              // sending is stopped only once
+	skipped     map[string]error       // sources removed due to errors, by address
+	decoded     req                    // reused by all decodes from the sources, unless fanned-in
+	windows     map[encoder]*ackWindow // unacknowledged datasets by destination, when resilient
+	ackEncs     map[string]encoder     // acknowledgements by source address, when resilient
+	legacy      bool                   // speaking the legacy protocol, without handshakes
+	encs        []encoder              // encoders to all destination connections
+	decs        []decoder              // decoders from all source connections
+	conns       []io.Closer            // all open connections (used for closing)
+	encsNext    int                    // Encoders Round Robin next index
+	encsLeft    int                    // datasets left to encode to encsNext in this cycle
+	encsRows    map[encoder]int        // number of rows encoded to every encoder
+	fanIn       chan decodeResult      // decoded by the readers of all decoders, once started
+	decsNext    int                    // Decoders Round Robin next index, when round robin
+	closing     chan struct{}          // closed upon Close, stopping the readers
+	closingOnce sync.Once              // closing is created only once
+	hashRing    *consistent.Consistent // hash ring for consistent hashing
+	encsByKey   map[string]encoder     // encoders mapped by key (node address)
+	dead        map[encoder]error      // encoders that failed, with their errors
+	heads       []mergeHead            // the pending data from every decoder, when merging
+	queueFailed chan struct{}          // notified when any of the queued encoders fails
+	seq         int                    // sequence number of the last dataset sent
+	seqs        map[decoder]*seqState  // the received sequences by decoder, when round robin
+	inited      bool                   // was this runner initialized
+	closeOnce   sync.Once              // connections are closed only once
+	closeErr    error                  // the error from closing the connections
 }
 
 func (ex *exchange) Returns() []Type { return []Type{Wildcard} }
@@ -82,221 +382,1124 @@ func (ex *exchange) Run(ctx context.Context, inp, out chan Dataset) (err error)
 		return fmt.Errorf("exhcnage cannot be Run() more than once")
 	}
 
-	ex.inited = true
-	defer func() {
-		closeErr := ex.Close()
-		// prefer real existing error over close error
-		if err == nil {
-			err = closeErr
+	ex.inited = true
+	if ex.coPartitioned(ctx) {
+		// re-shuffling would route every row back to the node it's on
+		return PassThrough().Run(ctx, inp, out)
+	}
+
+	sndDone := false  // EOF was sent to all peers, thus the input was consumed
+	draining := false // still receiving from peers, after Run has returned
+	defer func() {
+		if !sndDone {
+			// exiting early, before the input was exhausted. Drain it, to
+			// allow the upstream runner to complete instead of blocking on
+			// writing to inp
+			go func() {
+				for range inp {
+				}
+			}()
+		}
+
+		if draining {
+			return // the connections are closed once draining is done
+		}
+
+		var closeErr error
+		if err == nil {
+			closeErr = ex.shutdown()
+		} else {
+			closeErr = ex.Close()
+		}
+		// prefer real existing error over close error
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	if cfg := ex.progressOf(ctx); cfg != nil {
+		stopProgress := ex.reportProgress(cfg)
+		defer stopProgress()
+	}
+
+	err = ex.init(ctx)
+	if err != nil {
+		return err
+	}
+
+	// done is closed when Run exits, to stop the sending and receiving
+	// go-routines below in case they're still running
+	done := make(chan struct{})
+
+	// receive remote data from peers in a go-routine. Write the final error (or
+	// nil) to the channel when done.
+	rcvErrs := make(chan error, 1)
+	var outLock sync.Mutex
+	go func() {
+		defer close(rcvErrs)
+		rcvErrs <- ex.receiveAll(done, &outLock, out)
+	}()
+
+	// send the local data to the peers in a go-routine, until completion or
+	// error. Write the final error (or nil) to the channel when done.
+	sndErrs := make(chan error, 1)
+	go func() {
+		defer close(sndErrs)
+		sndErrs <- ex.sendAll(done, inp)
+	}()
+
+	// wait for both sending and receiving to complete. Upon the first error,
+	// from either side, exit early and stop the other side.
+	failed := false                  // either side failed
+	rcvCh, sndCh := rcvErrs, sndErrs // nil-ified below once resolved
+	defer func() {
+		close(done)
+		outLock.Lock() // wait for the receiver to stop writing to out
+		outLock.Unlock()
+
+		if failed && sndCh == nil && !sndDone {
+			// the sender has failed, so the encoders are free and the peers
+			// are still waiting for data from us. Tell them why this exchange
+			// stops, instead of leaving them to find out from the closed
+			// connections below. This is a best effort, as some of the
+			// connections might be broken
+			ex.encodeAll(&errMsg{err.Error()})
+		}
+
+		if failed {
+			// the other side might be blocked on encoding to, or decoding from,
+			// peers that stopped reading or writing. Close the connections in
+			// order to release it (peers will also see these connections as
+			// closed)
+			ex.Close()
+		}
+
+		// wait for the sender to exit. Unless it failed, it has sent EOF to
+		// all peers, thus they aren't waiting for more data from us
+		for range sndErrs {
+		}
+
+		if failed || rcvCh == nil {
+			for range rcvErrs {
+			}
+			return
+		}
+
+		// cancelled while the peers might still be sending. Closing the
+		// connections now would fail them, and these failures would mask the
+		// actual reason for the cancellation (usually an error in another
+		// runner). Instead, keep receiving (and discarding) in the background
+		// until all of the peers are done, and only then close the connections
+		draining = true
+		go func() {
+			for range rcvErrs {
+			}
+			ex.Close()
+		}()
+	}()
+	for err == nil && (rcvCh != nil || sndCh != nil) {
+		select {
+		case err = <-sndCh:
+			sndCh = nil
+			sndDone = err == nil
+			failed = err != nil
+
+			if _, isEncErr := err.(encodeErrors); isEncErr && rcvCh != nil {
+				// encoding usually fails because a failing peer has closed
+				// its connections, right after sending us the reason. Prefer
+				// that reason, if it arrives shortly
+				select {
+				case rcvErr := <-rcvCh:
+					rcvCh = nil
+					if _, isPeerErr := rcvErr.(*errMsg); isPeerErr {
+						err = rcvErr
+					}
+				case <-time.After(peerErrorGrace):
+				}
+			}
+		case err = <-rcvCh:
+			rcvCh = nil
+			failed = err != nil
+		case <-ctx.Done(): // context timeout or cancel
+			err = ctx.Err()
+			// as all other runners - in case of cancellation, runner should stop
+			// without effecting final error
+			if err == context.Canceled {
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+// sendAll sends all of the local input data to the peers, and notifies them
+// once the input is exhausted, or when done is closed before that. When
+// batching, small datasets are coalesced before sending
+func (ex *exchange) sendAll(done chan struct{}, inp chan Dataset) (err error) {
+	// every destination is encoded in its own go-routine. Wait for all of them
+	// to complete before returning, as encoding errors might be still pending
+	defer func() {
+		flushErr := ex.flushQueues()
+		if err == nil {
+			err = flushErr
+		}
+	}()
+
+	// when best effort or resilient, failed destinations are skipped instead
+	// of stopping
+	queueFailed := ex.queueFailed
+	if ex.BestEffort || ex.Resilient {
+		queueFailed = nil
+	}
+
+	var pending []Dataset // datasets to be coalesced into the next batch
+	var rows int          // number of rows pending
+	var size uint64       // number of bytes pending, when batching by bytes
+	var timeout <-chan time.Time
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+
+		data := ConcatDatasets(pending...)
+		pending, rows, size, timeout = nil, 0, 0, nil
+		return ex.send(data)
+	}
+
+	for {
+		select {
+		case <-done:
+			// stopped early. Notify peers that we're done sending data, as
+			// they might still be waiting for it
+			return ex.encodeAll(&endOfStream{ex.thisNode})
+		case <-queueFailed:
+			return nil // the error is returned from flushing the queues
+		case <-timeout:
+			err := flush()
+			if err != nil {
+				return err
+			}
+		case data, ok := <-inp:
+			select {
+			case <-ex.stopped:
+				// the receivers need no more data, discard the input
+				pending, rows, size, timeout = nil, 0, 0, nil
+				if ok {
+					continue
+				}
+				return ex.encodeAll(&endOfStream{ex.thisNode})
+			default: // not stopped, or not limited at all
+			}
+
+			if !ok {
+				// the input is exhausted. Notify peers that we're done sending
+				// data (they will use it to stop listening to data from us).
+				err := flush()
+				if err == nil && ex.Resilient {
+					err = ex.awaitAcks()
+				}
+				if err != nil {
+					return err
+				}
+				return ex.encodeAll(&endOfStream{ex.thisNode})
+			}
+
+			if ex.BatchSize <= 0 && ex.BatchBytes <= 0 {
+				err := ex.send(data)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			// datasets of different types can't be coalesced
+			if len(pending) > 0 && !sameTypes(pending[0], data) {
+				err := flush()
+				if err != nil {
+					return err
+				}
+			}
+
+			pending = append(pending, data)
+			rows += data.Len()
+			if ex.BatchBytes > 0 {
+				size += DatasetSize(data)
+			}
+			if ex.BatchSize > 0 && rows >= ex.BatchSize || ex.BatchBytes > 0 && size >= uint64(ex.BatchBytes) {
+				err := flush()
+				if err != nil {
+					return err
+				}
+			} else if timeout == nil {
+				// bound the latency of the rows pending
+				timeout = time.After(batchLatency)
+			}
+		}
+	}
+}
+
+// sameTypes reports whether the columns of both datasets are of the same types
+func sameTypes(a, b Dataset) bool {
+	if a.Width() != b.Width() {
+		return false
+	}
+
+	for i := 0; i < a.Width(); i++ {
+		if a.At(i).Type().Name() != b.At(i).Type().Name() {
+			return false
+		}
+	}
+	return true
+}
+
+// receiveAll receives the remote data from all peers into out, until all of
+// them are done sending. Once done is closed the data is discarded, as the
+// consumer of out might no longer be reading it. outLock is held while writing
+// to out, and Run locks it after closing done, to make sure out isn't written
+// after Run has returned, even though receiving might continue afterwards
+func (ex *exchange) receiveAll(done chan struct{}, outLock *sync.Mutex, out chan Dataset) error {
+	if ex.spill != nil {
+		return ex.receiveSpilling(done, outLock, out)
+	}
+
+	for {
+		data, err := ex.receive()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		ex.output(done, outLock, out, data)
+	}
+}
+
+// output writes a received dataset to out, unless done is closed
+func (ex *exchange) output(done chan struct{}, outLock *sync.Mutex, out chan Dataset, data Dataset) {
+	// split oversized datasets, such that downstream runners see bounded
+	// batches
+	for rest := data; rest != nil; {
+		data, rest = rest, nil
+		if ex.MaxRows > 0 && data.Len() > ex.MaxRows {
+			rest = data.Slice(ex.MaxRows, data.Len()).(Dataset)
+			data = data.Slice(0, ex.MaxRows).(Dataset)
+		}
+
+		outLock.Lock()
+		select {
+		case <-done:
+			// Run has exited, discard
+		default:
+			select {
+			case <-done:
+			case out <- data:
+			}
+		}
+		outLock.Unlock()
+	}
+}
+
+// send sends a dataset to destination nodes
+func (ex *exchange) send(data Dataset) error {
+	switch ex.Type {
+	case scatter:
+		if ex.Resilient {
+			return ex.encodeResilient(data)
+		}
+		if len(ex.KeyCols) > 0 && data.Len() > 0 {
+			return ex.encodeByKey(data)
+		}
+		if ex.BySize {
+			return ex.encodeLeastLoaded(data)
+		}
+		return ex.encodeNext(data)
+	case partition:
+		return ex.encodePartition(data)
+	case orderedGather:
+		ex.seq++
+		return ex.encodeAll(&seqBatch{ex.seq, data})
+	default:
+		return ex.encodeAll(data)
+	}
+}
+
+// receive receives a dataset from next source node, skipping duplicates when
+// distinct, and anything beyond the limit when limited
+func (ex *exchange) receive() (data Dataset, err error) {
+	for {
+		if ex.Type == sortGather {
+			data, err = ex.mergeNext()
+		} else {
+			data, err = ex.decodeNext()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if ex.Distinct && ex.isDuplicate(data) {
+			continue
+		}
+
+		if ex.Limit > 0 {
+			data = ex.limit(data)
+			if data == nil {
+				continue // keep receiving until all of the senders are done
+			}
+		}
+		return data, nil
+	}
+}
+
+// isDuplicate reports whether a dataset with the same content was received
+// before, by the hash of all of its column types and values
+func (ex *exchange) isDuplicate(data Dataset) bool {
+	h := sha256.New()
+	for i := 0; i < data.Width(); i++ {
+		col := data.At(i)
+		fmt.Fprintf(h, "%d:%s", len(col.Type().Name()), col.Type().Name())
+
+		nulls := col.Nulls()
+		for j, v := range col.Strings() {
+			if nulls[j] {
+				h.Write([]byte{'-'})
+				continue
+			}
+			fmt.Fprintf(h, "%d:%s", len(v), v)
+		}
+		h.Write([]byte{';'}) // end of column
+	}
+
+	sum := string(h.Sum(nil))
+	if ex.received[sum] {
+		return true
+	}
+
+	if ex.received == nil {
+		ex.received = map[string]bool{}
+	}
+	ex.received[sum] = true
+	return false
+}
+
+// Close closes all open connections. It's safe to call it more than once, as
+// Run closes the connections early upon errors
+func (ex *exchange) Close() error {
+	ex.closeOnce.Do(func() {
+		close(ex.closingCh())
+		if ex.spill != nil {
+			ex.spill.remove()
+		}
+
+		for _, conn := range ex.conns {
+			err := conn.Close()
+			if err != nil {
+				ex.closeErr = err
+			}
+		}
+	})
+	return ex.closeErr
+}
+
+// closeTimeout bounds the wait for the peers to close their connections, once
+// the exchange has completed
+var closeTimeout = 5 * time.Second
+
+// shutdown closes the connections once the exchange has completed. Closing
+// them right away might reset connections with unread data, losing the tail
+// of the streams that the peers didn't read yet. Instead, the write side of
+// every connection is closed first, and the connection itself is closed once
+// the peer has closed it too, which it does once it has completed as well.
+// Connections that can't be half-closed are closed right away
+func (ex *exchange) shutdown() error {
+	var wg sync.WaitGroup
+	for _, c := range ex.conns {
+		conn, ok := c.(net.Conn)
+		if !ok || closeWrite(conn) != nil {
+			continue
+		}
+
+		// nothing is expected after the end of the stream, discard anything
+		// until the peer closes its side
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			io.Copy(ioutil.Discard, conn)
+		}()
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(closeTimeout):
+	}
+	return ex.Close()
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+var errNoHalfClose = fmt.Errorf("ep: connection can't be half-closed")
+
+// closeWrite closes the write side of a connection, like TCP connections do,
+// or fails when the connection doesn't support it
+func closeWrite(conn net.Conn) error {
+	if cw, ok := conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return errNoHalfClose
+}
+
+// encodeAll encodes an object to all destination connections
+// expecting e to be either dataset or EOF error. Destinations that failed
+// before are skipped. Returns encodeErrors naming all of the destinations that
+// failed now, unless tolerated when best effort
+func (ex *exchange) encodeAll(e interface{}) error {
+	req := &req{e}
+	errs := encodeErrors{}
+	for _, enc := range ex.encs {
+		if ex.dead[enc] != nil {
+			continue
+		}
+
+		err := ex.encode(enc, req)
+		if err != nil {
+			errs[ex.addrOf(enc)] = ex.dead[enc]
+		}
+	}
+	return ex.tolerate(errs)
+}
+
+// encodeNext encodes an object to the next live destination connection in a
+// (weighted) round robin
+func (ex *exchange) encodeNext(e interface{}) error {
+	if len(ex.encs) == 0 {
+		return io.ErrClosedPipe
+	}
+
+	req := &req{e}
+	for i := 0; i <= len(ex.encs); i++ {
+		// keep encoding to the current destination, as long as its weight
+		// permits. Then move to the next one
+		if ex.encsLeft > 0 {
+			enc := ex.encs[ex.encsNext]
+			if ex.dead[enc] == nil {
+				ex.encsLeft--
+				return ex.encode(enc, req)
+			}
+		}
+
+		ex.encsNext = (ex.encsNext + 1) % len(ex.encs)
+		ex.encsLeft = ex.weight(ex.encs[ex.encsNext])
+	}
+
+	if len(ex.dead) == 0 {
+		return fmt.Errorf("no destination to scatter to, all weights are zero")
+	}
+
+	// all of the destinations have failed
+	return encodeErrors(ex.deadPeers())
+}
+
+// encodeLeastLoaded encodes a dataset to the live destination that received
+// the fewest rows so far, relative to its weight
+func (ex *exchange) encodeLeastLoaded(data Dataset) error {
+	if len(ex.encs) == 0 {
+		return io.ErrClosedPipe
+	}
+
+	if ex.encsRows == nil {
+		ex.encsRows = make(map[encoder]int)
+	}
+
+	var least encoder
+	var leastRows, leastWeight int
+	for _, enc := range ex.encs {
+		w := ex.weight(enc)
+		if w <= 0 || ex.dead[enc] != nil {
+			continue
+		}
+
+		// compare rows/w < leastRows/leastWeight without dividing
+		rows := ex.encsRows[enc]
+		if least == nil || rows*leastWeight < leastRows*w {
+			least, leastRows, leastWeight = enc, rows, w
+		}
+	}
+
+	if least == nil {
+		if len(ex.dead) > 0 {
+			return encodeErrors(ex.deadPeers())
+		}
+		return fmt.Errorf("no destination to scatter to, all weights are zero")
+	}
+
+	ex.encsRows[least] += data.Len()
+	return ex.encode(least, &req{data})
+}
+
+// encodeByKey encodes a dataset to the destination selected by the hash of the
+// key in its first row
+func (ex *exchange) encodeByKey(data Dataset) error {
+	if len(ex.encs) == 0 {
+		return io.ErrClosedPipe
+	}
+
+	idx := (&hashPartitioner{ex.KeyCols}).Partition(data, 0, len(ex.encs))
+	if idx < 0 {
+		return fmt.Errorf("scatter key columns %v out of range for %d columns", ex.KeyCols, data.Width())
+	}
+	return ex.encode(ex.encs[idx], &req{data})
+}
+
+// rowsSent returns the number of rows encoded to every destination by address,
+// when scattering by size
+func (ex *exchange) rowsSent() map[string]int {
+	res := make(map[string]int, len(ex.encsRows))
+	for enc, rows := range ex.encsRows {
+		res[ex.addrOf(enc)] = rows
+	}
+	return res
+}
+
+// weight returns the number of consecutive datasets to send to the destination
+// in every cycle of the round robin. Destinations with no explicit weight
+// default to 1
+func (ex *exchange) weight(enc encoder) int {
+	w, ok := ex.Weights[ex.addrOf(enc)]
+	if !ok {
+		return 1
+	}
+	return w
+}
+
+// encode encodes a request to a single destination. Upon failure the
+// destination is marked as dead, and any later attempt to encode to it fails
+// with the original error, without writing anything
+func (ex *exchange) encode(enc encoder, req *req) error {
+	if err := ex.dead[enc]; err != nil {
+		return err
+	}
+
+	if w := ex.windows[enc]; w != nil {
+		if data, isData := req.Payload.(Dataset); isData {
+			err := w.push(data)
+			if err != nil {
+				return ex.markDead(enc, err)
+			}
+		}
+	}
+
+	err := enc.Encode(req)
+	if err != nil {
+		err = ex.markDead(enc, err)
+	}
+	return err
+}
+
+// markDead marks a destination encoder as dead, due to the provided error.
+// Returns the error, naming the destination
+func (ex *exchange) markDead(enc encoder, err error) error {
+	if ex.dead == nil {
+		ex.dead = map[encoder]error{}
+	}
+	err = fmt.Errorf("ep: encode to %s failed: %s", ex.addrOf(enc), err)
+	ex.dead[enc] = err
+	return err
+}
+
+// flushQueues waits for all of the queued encoders to encode everything queued
+// so far, and stops their go-routines. Later encodes are done synchronously.
+// Returns encodeErrors naming all of the destinations that failed, unless
+// tolerated when best effort
+func (ex *exchange) flushQueues() error {
+	errs := encodeErrors{}
+	for _, enc := range ex.encs {
+		q, ok := enc.(*queuedEncoder)
+		if !ok {
+			continue
+		}
+
+		err := q.Flush()
+		if err != nil && ex.dead[enc] == nil {
+			errs[ex.addrOf(enc)] = ex.markDead(enc, err)
+		}
+	}
+	return ex.tolerate(errs)
+}
+
+// addrOf returns the node address of a destination encoder
+func (ex *exchange) addrOf(enc encoder) string {
+	for addr, enc1 := range ex.encsByKey {
+		if enc1 == enc {
+			return addr
+		}
+	}
+	return "unknown" // shouldn't happen
+}
+
+// deadPeers returns the errors of all of the destinations that failed during
+// this exchange, by their node address
+func (ex *exchange) deadPeers() map[string]error {
+	res := map[string]error{}
+	for enc, err := range ex.dead {
+		res[ex.addrOf(enc)] = err
+	}
+	return res
+}
+
+// encodeErrors is an error of encoding to several destinations, mapping the
+// node address of every failed destination to its error
+type encodeErrors map[string]error
+
+func (errs encodeErrors) Error() string {
+	addrs := make([]string, 0, len(errs))
+	for addr := range errs {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	msgs := make([]string, len(addrs))
+	for i, addr := range addrs {
+		msgs[i] = errs[addr].Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// encodePartition encodes an object to a destination connection selected by partitioning
+func (ex *exchange) encodePartition(e interface{}) error {
+	data, ok := e.(Dataset)
+	if !ok {
+		return fmt.Errorf("encodePartition called without a dataset")
+	}
+
+	if data.Len() == 0 {
+		return nil // nothing to route
+	}
+
+	dests, err := ex.partitionEncoders(data)
+	if err != nil {
+		return err
+	}
+
+	// rowsByEncoder holds the indices of the rows assigned to every encoder.
+	// The rows are then copied into a dataset per encoder, and every dataset
+	// is sent to a corresponding node
+	rowsByEncoder := make(map[encoder][]int)
+	encs := []encoder{} // preserve the order in which encoders were found
+	for i, enc := range dests {
+		rows, ok := rowsByEncoder[enc]
+		if !ok {
+			encs = append(encs, enc)
+		}
+		rowsByEncoder[enc] = append(rows, i)
+	}
+
+	// at this point partitioning is complete, and datasets are ready to be sent
+	for _, enc := range encs {
+		rows := rowsByEncoder[enc]
+		d := data
+		if len(rows) != data.Len() {
+			d = take(data, rows).(Dataset)
+		}
+
+		err := ex.encode(enc, &req{d})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// partitionEncoders returns the destination encoder of every row of the data,
+// selected either by the Partitioner, or by consistent hashing of the
+// partitioning columns
+func (ex *exchange) partitionEncoders(data Dataset) ([]encoder, error) {
+	if len(ex.encs) == 0 {
+		return nil, io.ErrClosedPipe
+	}
+
+	res := make([]encoder, data.Len())
+	if ex.Partitioner != nil {
+		for i := range res {
+			idx := ex.Partitioner.Partition(data, i, len(ex.encs))
+			if idx < 0 || idx >= len(ex.encs) {
+				return nil, fmt.Errorf("partitioner returned node %d out of range for %d nodes", idx, len(ex.encs))
+			}
+			res[i] = ex.encs[idx]
+		}
+		return res, nil
+	}
+
+	keys, err := ex.partitionKeys(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// with a single destination there's nothing to decide. Skip the hashing
+	if len(ex.encs) == 1 {
+		for i := range res {
+			res[i] = ex.encs[0]
+		}
+		return res, nil
+	}
+
+	for i, key := range keys {
+		res[i], err = ex.getPartitionEncoder(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// partitionColumns returns the columns used for partitioning by the provided
+// columns of Partition
+func partitionColumns(cols []int) []int {
+	if len(cols) == 0 {
+		return []int{0} // by default partition by the first column
+	}
+	return cols
+}
+
+// coPartitioned reports whether the input of a partition exchange is already
+// partitioned by the same columns, as set in the context by PartitionedBy.
+// Partitioners might route the rows differently, thus they always re-shuffle
+func (ex *exchange) coPartitioned(ctx context.Context) bool {
+	current := partitionedBy(ctx)
+	if ex.Type != partition || ex.Partitioner != nil || current == nil {
+		return false
+	}
+
+	cols := partitionColumns(ex.PartitionCols)
+	if len(cols) != len(current) {
+		return false
+	}
+	for i := range cols {
+		if cols[i] != current[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// partitionKeys returns the values used for partitioning every row of the
+// data. Based on these values the data will be spread between nodes. Every
+// value is the HashDataset of the row, formatted in hex
+func (ex *exchange) partitionKeys(data Dataset) ([]string, error) {
+	return partitionKeys(data, partitionColumns(ex.PartitionCols))
+}
+
+func partitionKeys(data Dataset, cols []int) ([]string, error) {
+	for _, col := range cols {
+		if col < 0 || col >= data.Width() {
+			return nil, fmt.Errorf("partition column %d out of range for %d columns", col, data.Width())
+		}
+	}
+
+	hashes := hashRows(data, cols)
+	keys := make([]string, len(hashes))
+	for i, h := range hashes {
+		keys[i] = strconv.FormatUint(h, 16)
+	}
+	return keys, nil
+}
+
+// getPartitionEncoder uses a hash ring to find a node that should handle
+// a provided key. This function returns an encoder that handles data
+// transmission to the matched node.
+func (ex *exchange) getPartitionEncoder(key string) (encoder, error) {
+	endpoint, err := ex.hashRing.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find a target node: %s", err)
+	}
+
+	enc, ok := ex.encsByKey[endpoint]
+	if !ok {
+		return nil, fmt.Errorf("no matching node found")
+	}
+
+	return enc, nil
+}
+
+// decodeNext decodes an object from whichever source connection has one
+// first, such that a silent peer doesn't delay the data sent by the others.
+// Every source connection is read by its own reader, and it's removed once
+// exhausted, until there are none left
+func (ex *exchange) decodeNext() (Dataset, error) {
+	if ex.RoundRobin {
+		return ex.decodeRoundRobin()
+	}
+
+	if ex.fanIn == nil {
+		size := receiveQueueSize
+		if ex.ReceiveQueue > 0 {
+			size = ex.ReceiveQueue
 		}
-	}()
 
-	err = ex.init(ctx)
-	if err != nil {
-		return err
+		ex.fanIn = make(chan decodeResult, size)
+		for _, dec := range ex.decs {
+			go ex.read(dec)
+		}
 	}
 
-	// receive remote data from peers in a go-routine. Write the final error (or
-	// nil) to the channel when done.
-	errs := make(chan error)
-	go func() {
-		defer close(errs)
-		for {
-			data, recErr := ex.receive()
-			if recErr == io.EOF {
-				errs <- nil
-				break
-			} else if recErr != nil {
-				errs <- recErr
-				return
-			}
-			out <- data
+	for len(ex.decs) > 0 {
+		var res decodeResult
+		select {
+		case res = <-ex.fanIn:
+			statsOf(res.dec).dequeue(res.err)
+		case <-ex.closingCh():
+			// the readers are stopped, as Run closes the exchange early upon
+			// errors from either side
+			return nil, errClosed
 		}
-	}()
 
-	// send the local data to the peers, until completion or error. Also listen
-	// for the completion of the received go-routine above. When both sending
-	// and receiving is complete, exit. Upon error, exit early.
-	rcvDone := false
-	sndDone := false
-	defer func() {
-		// in case of cancellation, select below stops without sending EOF message
-		// to all peers. Therefore other peers will not close connections, hence ex.receive
-		// will be blocked forever. This will lead to deadlock as current exchange waits on
-		// errs channel that will not be closed
-		if !sndDone {
-			eofMsg := &errMsg{io.EOF.Error()}
-			ex.encodeAll(eofMsg)
+		if ex.exhausted(res.dec, res.err) {
+			ex.removeDecoder(res.dec)
+			continue
+		} else if res.err != nil {
+			return nil, res.err
 		}
+		return res.data, nil
+	}
+	return nil, io.EOF
+}
 
-		// wait for all receivers to finish
-		for range errs {
-		}
-	}()
-	for err == nil && (!rcvDone || !sndDone) {
-		select {
-		case data, ok := <-inp:
-			if !ok {
-				// the input is exhausted. Notify peers that we're done sending
-				// data (they will use it to stop listening to data from us).
-				eofMsg := &errMsg{io.EOF.Error()}
-				ex.encodeAll(eofMsg)
-				sndDone = true
-
-				// inp is closed. If we keep iterating, it will infinitely
-				// resolve to (nil, true). Nill-ify it to block it on the next
-				// iteration.
-				inp = nil
-				continue
-			}
+// errClosed is returned when receiving after the exchange is closed
+var errClosed = fmt.Errorf("ep: exchange closed")
 
-			err = ex.send(data)
-		case err = <-errs:
-			rcvDone = true // errors (or nil) from the receive go-routine
-		case <-ctx.Done(): // context timeout or cancel
-			err = ctx.Err()
-			// as all other runners - in case of cancellation, runner should stop
-			// without effecting final error
-			if err == context.Canceled {
-				return nil
-			}
+// receiveQueueSize is the default number of datasets that can be decoded by
+// the readers of all source connections, ahead of receiving them
+var receiveQueueSize = 16
+
+// decodeRoundRobin decodes an object from the next source connection in a
+// round robin. Source connections that reached EOF are removed, until there
+// are none left
+func (ex *exchange) decodeRoundRobin() (Dataset, error) {
+	for len(ex.decs) > 0 {
+		i := (ex.decsNext + 1) % len(ex.decs)
+
+		data, err := ex.decode(ex.decs[i])
+		if ex.exhausted(ex.decs[i], err) {
+			// remove the current decoder and try again. The following decoder
+			// is shifted into i, thus it's the next one in the round robin
+			ex.decs = append(ex.decs[:i], ex.decs[i+1:]...)
+			ex.decsNext = i - 1
+			continue
+		} else if err != nil {
+			return nil, err
 		}
+
+		ex.decsNext = i
+		return data, nil
 	}
-	return err
+	return nil, io.EOF
 }
 
-// send sends a dataset to destination nodes
-func (ex *exchange) send(data Dataset) error {
-	switch ex.Type {
-	case scatter:
-		return ex.encodeNext(data)
-	case partition:
-		return ex.encodePartition(data)
-	default:
-		return ex.encodeAll(data)
+// decode decodes the next dataset from a source connection, when decoding in
+// a round robin
+func (ex *exchange) decode(dec decoder) (Dataset, error) {
+	if ex.Type != orderedGather {
+		return decode(dec, &ex.decoded)
+	}
+
+	if ex.seqs == nil {
+		ex.seqs = map[decoder]*seqState{}
+	}
+	st := ex.seqs[dec]
+	if st == nil {
+		st = &seqState{pending: map[int]Dataset{}}
+		ex.seqs[dec] = st
 	}
+	return st.decode(dec, &ex.decoded)
 }
 
-// receive receives a dataset from next source node
-func (ex *exchange) receive() (Dataset, error) {
-	return ex.decodeNext()
+// decodeResult is a single result of a reader of a source connection
+type decodeResult struct {
+	dec  decoder
+	data Dataset
+	err  error
 }
 
-// Close closes all open connections
-func (ex *exchange) Close() (err error) {
-	for _, conn := range ex.conns {
-		err1 := conn.Close()
-		if err1 != nil {
-			err = err1
+// read decodes all of the datasets from a source connection, in the order
+// they were sent by the peer, into the fan-in of the exchange. It stops after
+// the first error, including EOF, or once the exchange is closed
+func (ex *exchange) read(dec decoder) {
+	req := &req{}
+	var seqs *seqState
+	if ex.Type == orderedGather {
+		seqs = &seqState{pending: map[int]Dataset{}}
+	}
+
+	for {
+		var data Dataset
+		var err error
+		if seqs != nil {
+			data, err = seqs.decode(dec, req)
+		} else {
+			data, err = decode(dec, req)
+		}
+
+		st := statsOf(dec)
+		st.enqueue(err)
+		select {
+		case ex.fanIn <- decodeResult{dec, data, err}:
+		case <-ex.closingCh():
+			st.dequeue(err)
+			return
+		}
+
+		if err != nil {
+			return
 		}
 	}
-	return err
 }
 
-// encodeAll encodes an object to all destination connections
-// expecting e to be either dataset or EOF error
-func (ex *exchange) encodeAll(e interface{}) (err error) {
-	req := &req{e}
-	for _, enc := range ex.encs {
-		err1 := enc.Encode(req)
-		if err1 != nil {
-			err = err1
+// removeDecoder removes an exhausted decoder from the source decoders
+func (ex *exchange) removeDecoder(dec decoder) {
+	for i := range ex.decs {
+		if ex.decs[i] == dec {
+			ex.decs = append(ex.decs[:i], ex.decs[i+1:]...)
+			return
 		}
 	}
-	return err
 }
 
-// encodeNext encodes an object to the next destination connection in a round robin
-func (ex *exchange) encodeNext(e interface{}) error {
-	if len(ex.encs) == 0 {
-		return io.ErrClosedPipe
-	}
+// closingCh returns a channel that's closed once the exchange is closed
+func (ex *exchange) closingCh() chan struct{} {
+	ex.closingOnce.Do(func() { ex.closing = make(chan struct{}) })
+	return ex.closing
+}
 
-	req := &req{e}
-	ex.encsNext = (ex.encsNext + 1) % len(ex.encs)
-	return ex.encs[ex.encsNext].Encode(req)
+// mergeHead is the pending dataset decoded from a source connection, and the
+// next row to merge out of it
+type mergeHead struct {
+	data Dataset
+	row  int
 }
 
-// encodePartition encodes an object to a destination connection selected by partitioning
-func (ex *exchange) encodePartition(e interface{}) error {
-	data, ok := e.(Dataset)
-	if !ok {
-		return fmt.Errorf("encodePartition called without a dataset")
+// mergeNext merges the pre-sorted streams from all source connections, and
+// returns the next sorted rows. It keeps a pending dataset from every one of
+// them, and emits rows in order until one of the pending datasets is
+// exhausted, as it must be refilled before any other row can be emitted.
+// Source connections that reached EOF are removed, until there are none left
+func (ex *exchange) mergeNext() (Dataset, error) {
+	if ex.heads == nil {
+		ex.heads = make([]mergeHead, len(ex.decs))
 	}
 
-	// dataByEncoder holds datasets grouped by encoders that were assigned these
-	// datasets using consistent hashing algorithm. Datasets are partitioned
-	// in memory using this map, and then every dataset is sent to a
-	// corresponding node
-	dataByEncoder := make(map[encoder]Dataset)
-
-	// ids are values that are used for partitioning.
-	// Based on these values the data will be spread between nodes
-	ids := data.At(ex.partitionCol).Strings()
-	for i, key := range ids {
-		enc, err := ex.getPartitionEncoder(key)
-		if err != nil {
-			return err
+	// refill the exhausted pending datasets
+	for i := 0; i < len(ex.decs); {
+		if ex.heads[i].data != nil && ex.heads[i].row < ex.heads[i].data.Len() {
+			i++
+			continue
 		}
 
-		d, ok := dataByEncoder[enc]
-		if !ok {
-			d = NewDataset()
+		data, err := decode(ex.decs[i], &ex.decoded)
+		if ex.exhausted(ex.decs[i], err) {
+			ex.decs = append(ex.decs[:i], ex.decs[i+1:]...)
+			ex.heads = append(ex.heads[:i], ex.heads[i+1:]...)
+			continue
+		} else if err != nil {
+			return nil, err
 		}
 
-		dataByEncoder[enc] = d.Append(data.Slice(i, i+1)).(Dataset)
+		ex.heads[i] = mergeHead{data, 0} // empty datasets are refilled again
 	}
 
-	// at this point partitioning is complete, and datasets are ready to be sent
-	for enc, data := range dataByEncoder {
-		req := &req{data}
-		err := enc.Encode(req)
-		if err != nil {
-			return err
+	if len(ex.decs) == 0 {
+		return nil, io.EOF
+	}
+
+	rows := []mergeHead{}
+	for {
+		min := 0
+		for i := 1; i < len(ex.heads); i++ {
+			if ex.lessRow(ex.heads[i], ex.heads[min]) {
+				min = i
+			}
+		}
+
+		rows = append(rows, ex.heads[min])
+		ex.heads[min].row++
+		if ex.heads[min].row == ex.heads[min].data.Len() {
+			break
 		}
 	}
 
-	return nil
+	// copy the merged rows, from all of their datasets, into a single one
+	return copyRows(rows), nil
 }
 
-// getPartitionEncoder uses a hash ring to find a node that should handle
-// a provided key. This function returns an encoder that handles data
-// transmission to the matched node.
-func (ex *exchange) getPartitionEncoder(key string) (encoder, error) {
-	endpoint, err := ex.hashRing.Get(key)
-	if err != nil {
-		return nil, fmt.Errorf("cannot find a target node: %s", err)
+// lessRow reports whether the pending row of a should be merged before the
+// pending row of b, by the sorting columns
+func (ex *exchange) lessRow(a, b mergeHead) bool {
+	for _, col := range ex.SortingCols {
+		c := col.compare(a.data.At(col.Index), a.row, b.data.At(col.Index), b.row)
+		if c != 0 {
+			return c < 0
+		}
 	}
+	return false
+}
 
-	enc, ok := ex.encsByKey[endpoint]
-	if !ok {
-		return nil, fmt.Errorf("no matching node found")
-	}
+// decode decodes the next dataset from a source connection of an ordered
+// gather, in the order it was sent by the peer
+func (st *seqState) decode(dec decoder, req *req) (Dataset, error) {
+	for {
+		if data, ok := st.pending[st.last+1]; ok {
+			delete(st.pending, st.last+1)
+			st.last++
+			return data, nil
+		}
 
-	return enc, nil
-}
+		payload, err := decodePayload(dec, req)
+		if err == io.EOF && len(st.pending) > 0 {
+			return nil, fmt.Errorf("missing dataset %d from peer", st.last+1)
+		} else if err != nil {
+			return nil, err
+		}
 
-// decodeNext decodes an object from the next source connection in a round robin
-func (ex *exchange) decodeNext() (Dataset, error) {
-	if len(ex.decs) == 0 {
-		return nil, io.EOF
+		batch, ok := payload.(*seqBatch)
+		if !ok {
+			return nil, fmt.Errorf("dataset received without a sequence number")
+		}
+		st.pending[batch.Seq] = batch.Data
 	}
+}
 
-	i := (ex.decsNext + 1) % len(ex.decs)
+// decode decodes a single dataset from a source connection. When the peer
+// sends an error instead, it's returned as the error
+func decode(dec decoder, req *req) (Dataset, error) {
+	payload, err := decodePayload(dec, req)
+	if err != nil {
+		return nil, err
+	}
+	return payload.(Dataset), nil
+}
 
-	req := &req{}
-	err := ex.decs[i].Decode(req)
+// decodePayload decodes a single request from a source connection into req,
+// and returns its payload. When the peer sends an error instead, it's returned
+// as the error. The request is only used for decoding, thus it's reused
+func decodePayload(dec decoder, req *req) (interface{}, error) {
+	req.Payload = nil
+	err := dec.Decode(req)
 	if err != nil {
-		if err == io.EOF {
-			// remove the current decoder and try again
-			ex.decs = append(ex.decs[:i], ex.decs[i+1:]...)
-			return ex.decodeNext()
-		}
 		return nil, err
 	}
 
-	ex.decsNext = i
-	return req.Payload.(Dataset), nil
+	if err, isErr := req.Payload.(error); isErr {
+		// the peer has failed, and sent its error instead of data
+		return nil, err
+	}
+	return req.Payload, nil
 }
 
 // init initializes the connections, encoders & decoders
@@ -309,62 +1512,124 @@ func (ex *exchange) init(ctx context.Context) (err error) {
 	// By using a map we can find an encoder for every address
 	ex.encsByKey = make(map[string]encoder)
 
-	dist, _ := ctx.Value(distributerKey).(interface {
-		Connect(addr, uid string) (net.Conn, error)
-	})
+	dist, _ := ctxValue(ctx, distributerKey).(connector)
 
 	if dist == nil {
 		return fmt.Errorf("exhcnage started without a distributer")
 	}
 
-	allNodes := ctx.Value(allNodesKey).([]string)
-	thisNode := ctx.Value(thisNodeKey).(string)
-	masterNode := ctx.Value(masterNodeKey).(string)
+	allNodes, err := NodesFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	thisNode, err := ThisNodeFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	masterNode, err := MasterNodeFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	ex.thisNode = thisNode
+	ex.legacy = isLegacyProtocol()
+
+	// every node sends to all of the targets, and only the targets receive,
+	// from all of the nodes. Thus when gathering, the other nodes open a
+	// single connection to the main node, which opens one to every one of
+	// them, while the loopback short-circuits the main node's own data
+	targetNodes, err := ex.targets(allNodes, masterNode)
+	if err != nil {
+		return err
+	}
+
+	if p, ok := ex.Partitioner.(nodesPartitioner); ok {
+		p.setNodes(targetNodes)
+	}
 
-	targetNodes := allNodes
-	if ex.Type == gather {
-		targetNodes = []string{masterNode}
+	if ex.SpillRows > 0 {
+		ex.spill = newSpillQueue(ex.SpillRows)
+	}
+
+	if ex.Limit > 0 {
+		ex.stopped = make(chan struct{})
 	}
 
 	// open a connection to all target nodes
 	connsMap := map[string]net.Conn{}
 	var shortCircuit *shortCircuit
+	ex.queueFailed = make(chan struct{}, len(targetNodes))
 	defer func() {
 		if err != nil {
 			// in case of error in one connection. close all other connections
 			ex.Close()
+			ex.flushQueues()
 		}
 	}()
 	var conn net.Conn
 	for _, node := range targetNodes {
+		st := ex.peerStats(node)
 		if node == thisNode {
 			shortCircuit = newShortCircuit()
+			enc := &statsEncoder{shortCircuit, st}
 			ex.conns = append(ex.conns, shortCircuit)
-			ex.encs = append(ex.encs, shortCircuit)
+			ex.encs = append(ex.encs, enc)
 			ex.hashRing.Add(node)
-			ex.encsByKey[node] = shortCircuit
+			ex.encsByKey[node] = enc
 			continue
 		}
 
-		conn, err = dist.Connect(node, ex.UID)
+		conn, err = ex.connect(dist, node)
+		if err != nil {
+			return err
+		}
+
+		err = ex.handshake(conn, node)
 		if err != nil {
+			conn.Close()
 			return err
 		}
 
+		conn = ex.wrapConn(conn, node)
 		connsMap[node] = conn
 		ex.conns = append(ex.conns, conn)
-		enc := gob.NewEncoder(conn)
-		ex.encs = append(ex.encs, enc)
+		var enc encoder = &statsEncoder{newEncoder(compressWriter(conn, ex.Compression, ex.streamFlags())), st}
+
+		var w *ackWindow
+		if ex.Resilient {
+			w, err = ex.connectAcks(dist, node)
+			if err != nil {
+				return err
+			}
+			enc = &ackedEncoder{enc, w}
+		}
+		if ex.stopped != nil {
+			// limited exchanges are gathers, thus the target is the node that
+			// stops the senders
+			enc = &stoppableEncoder{enc, ex.stopped}
+			ex.listenForStop(conn)
+		}
+		encQueued := newQueuedEncoder(enc, ex.queueFailed, ex.HeartbeatInterval)
+		if w != nil {
+			if ex.windows == nil {
+				ex.windows = map[encoder]*ackWindow{}
+			}
+			ex.windows[encQueued] = w
+		}
+		ex.encs = append(ex.encs, encQueued)
 		ex.hashRing.Add(node)
-		ex.encsByKey[node] = enc
+		ex.encsByKey[node] = encQueued
 	}
 
 	// if we're also a destination, listen to all nodes
-	for i := 0; shortCircuit != nil && i < len(allNodes); i++ {
+	receiving := ex.isTarget(thisNode, targetNodes)
+	for i := 0; receiving && i < len(allNodes); i++ {
 		n := allNodes[i]
 
+		st := ex.peerStats(n)
 		if n == thisNode {
-			ex.decs = append(ex.decs, shortCircuit)
+			ex.decs = append(ex.decs, &statsDecoder{shortCircuit, st})
 			continue
 		}
 
@@ -373,22 +1638,120 @@ func (ex *exchange) init(ctx context.Context) (err error) {
 		// if we already established a connection to this node from the targets,
 		// re-use it. We don't need 2 uni-directional connections.
 		if connsMap[n] != nil {
-			ex.decs = append(ex.decs, dbgDecoder{gob.NewDecoder(connsMap[n]), msg})
+			ex.sources = append(ex.sources, connsMap[n])
+			var dec decoder = dbgDecoder{newDecoder(decompressReader(connsMap[n])), msg, n}
+			if ack := ex.ackEncs[n]; ack != nil {
+				dec = &ackingDecoder{decoder: dec, enc: ack}
+			}
+			ex.decs = append(ex.decs, &statsDecoder{dec, st})
 			continue
 		}
 
-		conn, err = dist.Connect(n, ex.UID)
+		conn, err = ex.connect(dist, n)
+		if err != nil {
+			return err
+		}
+
+		err = ex.handshake(conn, n)
 		if err != nil {
+			conn.Close()
 			return err
 		}
 
+		conn = ex.wrapConn(conn, n)
 		ex.conns = append(ex.conns, conn)
-		ex.decs = append(ex.decs, dbgDecoder{gob.NewDecoder(conn), msg})
+		ex.sources = append(ex.sources, conn)
+		dec := dbgDecoder{newDecoder(decompressReader(conn)), msg, n}
+		ex.decs = append(ex.decs, &statsDecoder{dec, st})
 	}
 
 	return nil
 }
 
+// targets returns the nodes that receive the data sent from every node: the
+// main node, or the target node, when gathering into it, or all of the nodes
+// otherwise. Fails when the target node isn't one of the nodes
+func (ex *exchange) targets(allNodes []string, masterNode string) ([]string, error) {
+	switch ex.Type {
+	case gather, sortGather, orderedGather:
+		if ex.Target == "" {
+			return []string{masterNode}, nil
+		}
+
+		for _, node := range allNodes {
+			if node == ex.Target {
+				return []string{node}, nil
+			}
+		}
+		return nil, fmt.Errorf("ep: gather target %s isn't one of the nodes %v", ex.Target, allNodes)
+	default:
+		// every node receives, regardless of the main node
+		return allNodes, nil
+	}
+}
+
+// isTarget reports whether a node receives data from all of the nodes
+func (ex *exchange) isTarget(node string, targetNodes []string) bool {
+	for _, target := range targetNodes {
+		if target == node {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapConn wraps a connection to a peer in order to collect its statistics, to
+// throttle it and to time it out, according to the exchange options
+func (ex *exchange) wrapConn(conn net.Conn, addr string) net.Conn {
+	conn = &statsConn{ex.throttled(conn), ex.peerStats(addr)}
+	return ex.withTimeout(conn, addr)
+}
+
+// connect connects to a peer node, retrying with an exponential backoff upon
+// transient failures
+func (ex *exchange) connect(dist connector, addr string) (net.Conn, error) {
+	return ex.connectUID(dist, addr, ex.UID)
+}
+
+// connectUID is similar to connect, except that the connection is identified
+// by the provided uid, instead of the UID of the exchange
+func (ex *exchange) connectUID(dist connector, addr, uid string) (net.Conn, error) {
+	attempts, backoff := connectAttempts, connectBackoff
+	if ex.ConnectAttempts > 0 {
+		attempts, backoff = ex.ConnectAttempts, ex.ConnectBackoff
+	}
+
+	var err error
+	for i := 1; i <= attempts; i++ {
+		var conn net.Conn
+		conn, err = dist.Connect(addr, uid)
+		if err == nil {
+			return conn, nil
+		}
+
+		// the connection might be open, even though it failed to set up
+		if conn != nil {
+			conn.Close()
+		}
+
+		// only network errors (refused connections, resets, etc.) are
+		// transient. Connect already waits for incoming connections
+		if _, isNetErr := err.(net.Error); !isNetErr || i == attempts {
+			return nil, fmt.Errorf("ep: connect to %s failed on attempt %d: %s", addr, i, err)
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return nil, fmt.Errorf("ep: connect to %s failed, no attempts", addr)
+}
+
+// connector is the interface of distributers used by exchanges to connect to
+// their peers
+type connector interface {
+	Connect(addr, uid string) (net.Conn, error)
+}
+
 // interfaces for gob.Encoder/Decoder. Used to also implement the short-circuit.
 type encoder interface {
 	Encode(interface{}) error
@@ -399,52 +1762,196 @@ type decoder interface {
 
 type dbgDecoder struct {
 	decoder
-	msg string
+	msg  string
+	addr string // of the peer
 }
 
 func (dec dbgDecoder) Decode(e interface{}) error {
 	// fmt.Println("DECODE", dec.msg)
 	err := dec.decoder.Decode(e)
-	if err == nil && isEOFError(e) {
+	for err == nil && isHeartbeat(e) {
+		err = dec.decoder.Decode(e)
+	}
+
+	if err == nil && isEOS(e) {
 		return io.EOF
+	} else if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// the stream has ended without an end-of-stream message, thus the
+		// peer has crashed or closed the connection before completing
+		return fmt.Errorf("ep: peer %s disconnected unexpectedly", dec.addr)
+	} else if err == errChecksumMismatch {
+		return fmt.Errorf("ep: checksum mismatch from %s", dec.addr)
 	}
 	// fmt.Println("DECODE DONE", dec.msg, e, err)
 	return err
 }
 
+// sendQueueSize is the number of requests that can be queued for every
+// destination, before encoding to it blocks
+var sendQueueSize = 16
+
+// queuedEncoder is an encoder that queues the objects and encodes them in its
+// own go-routine, such that a slow destination doesn't block encoding to other
+// destinations until its queue is full. Errors are returned from the following
+// calls to Encode, and from Flush
+type queuedEncoder struct {
+	enc    encoder
+	queue  chan interface{}
+	done   chan struct{}   // closed once the go-routine exits
+	failed chan<- struct{} // notified upon the first error
+	l      sync.Mutex
+	err    error
+	closed bool
+}
+
+func newQueuedEncoder(enc encoder, failed chan<- struct{}, heartbeatInterval time.Duration) *queuedEncoder {
+	q := &queuedEncoder{
+		enc:    enc,
+		queue:  make(chan interface{}, sendQueueSize),
+		done:   make(chan struct{}),
+		failed: failed,
+	}
+
+	go func() {
+		defer close(q.done)
+
+		// heartbeats are sent whenever nothing was encoded for the interval
+		var beat <-chan time.Time
+		var timer *time.Timer
+		if heartbeatInterval > 0 {
+			timer = time.NewTimer(heartbeatInterval)
+			defer timer.Stop()
+			beat = timer.C
+		}
+
+		for {
+			var e interface{}
+			select {
+			case item, ok := <-q.queue:
+				if !ok {
+					return
+				}
+
+				e = item
+				if _, isErr := e.(*req).Payload.(error); isErr || isEOS(e) {
+					beat = nil // the stream has ended, the peer stops reading
+				}
+
+				if beat != nil && !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+			case <-beat:
+				e = &req{&heartbeat{time.Now().UnixNano()}}
+			}
+
+			if beat != nil {
+				timer.Reset(heartbeatInterval)
+			}
+
+			if q.getErr() != nil {
+				continue // discard everything after the first error
+			}
+
+			err := q.enc.Encode(e)
+			if err != nil {
+				q.l.Lock()
+				q.err = err
+				q.l.Unlock()
+
+				select {
+				case q.failed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return q
+}
+
+func (q *queuedEncoder) getErr() error {
+	q.l.Lock()
+	defer q.l.Unlock()
+	return q.err
+}
+
+func (q *queuedEncoder) Encode(e interface{}) error {
+	if q.closed {
+		// flushed, thus the go-routine has exited and it's safe to encode
+		// synchronously
+		if err := q.getErr(); err != nil {
+			return err
+		}
+		return q.enc.Encode(e)
+	}
+
+	if err := q.getErr(); err != nil {
+		return err
+	}
+	q.queue <- e
+	return nil
+}
+
+// Flush waits for all of the queued objects to be encoded, and stops the
+// go-routine. Returns the error, if any of the objects failed to encode
+func (q *queuedEncoder) Flush() error {
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	<-q.done
+	return q.getErr()
+}
+
 // shortCircuit implements io.Closer, encoder and decoder and provides the
 // means to short-circuit internal communications within the same node. This is
-// in order to not complicate the generic nature of the exchange code
+// in order to not complicate the generic nature of the exchange code.
+// Upon errors, Run closes it while the sending and receiving go-routines might
+// still be using it, thus closing releases blocked calls rather than closing
+// the underlying channel
 type shortCircuit struct {
-	C      chan interface{}
-	closed bool
-	all    []interface{}
+	C         chan interface{}
+	closing   chan struct{} // closed upon Close()
+	closeOnce sync.Once
 }
 
 func (sc *shortCircuit) Close() error {
-	if sc.closed {
-		return nil
-	}
-
-	sc.closed = true
-	close(sc.C)
-	// fmt.Println("SC: Closed")
+	sc.closeOnce.Do(func() {
+		close(sc.closing)
+	})
 	return nil
 }
 
 func (sc *shortCircuit) Encode(e interface{}) error {
-	if sc.closed {
+	// prefer failing over sending to a closed short-circuit; select doesn't
+	// guarantee it when both cases are ready
+	select {
+	case <-sc.closing:
 		return io.ErrClosedPipe
+	default:
 	}
 
-	sc.C <- e
-	// fmt.Println("SC: Encoded", e)
-	return nil
+	select {
+	case sc.C <- e:
+		return nil
+	case <-sc.closing:
+		return io.ErrClosedPipe
+	}
 }
 
 func (sc *shortCircuit) Decode(e interface{}) error {
-	v, ok := <-sc.C
-	if !ok || isEOFError(v) {
+	var v interface{}
+	select {
+	case v = <-sc.C:
+	case <-sc.closing:
+		// closed before an explicit EOF message arrived; it's not a normal end
+		// of stream
+		return io.ErrClosedPipe
+	}
+
+	if isEOS(v) {
 		return io.EOF
 	}
 	*e.(*req) = *v.(*req)
@@ -452,15 +1959,34 @@ func (sc *shortCircuit) Decode(e interface{}) error {
 }
 
 func newShortCircuit() *shortCircuit {
-	return &shortCircuit{C: make(chan interface{}, 1000)}
+	return &shortCircuit{C: make(chan interface{}, 1000), closing: make(chan struct{})}
 }
 
 type req struct{ Payload interface{} }
+
+// seqBatch is a dataset tagged by its sender with a sequence number
+type seqBatch struct {
+	Seq  int
+	Data Dataset
+}
+
+// seqState is the state of the sequence received from a single peer: the last
+// sequence number received in order, and datasets that arrived early
+type seqState struct {
+	last    int
+	pending map[int]Dataset
+}
 type errMsg struct{ Msg string }
 
 func (err *errMsg) Error() string { return err.Msg }
 
-func isEOFError(data interface{}) bool {
-	err, isErr := data.(*req).Payload.(error)
-	return isErr && err.Error() == io.EOF.Error()
+// endOfStream is sent by every node once it's done sending, such that its
+// peers can tell it apart from a connection that was closed unexpectedly
+type endOfStream struct {
+	Node string // the sending node
+}
+
+func isEOS(data interface{}) bool {
+	_, ok := data.(*req).Payload.(*endOfStream)
+	return ok
 }
@@ -1,15 +1,95 @@
 package ep
 
 import (
+	"bytes"
 	"context"
+	"encoding/gob"
 	"fmt"
 	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"net"
+	"os"
+	"runtime"
+	"sort"
+	"stathat.com/c/consistent"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
+func TestExchange_connect_retriesTransientFailures(t *testing.T) {
+	dist := &flakyConnector{failures: 2}
+	ex := Retry(Scatter(), 3, time.Millisecond).(*exchange)
+
+	conn, err := ex.connect(dist, ":5552")
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	require.Equal(t, 3, dist.calls)
+	conn.Close()
+}
+
+func TestExchange_connect_exhaustsAttempts(t *testing.T) {
+	dist := &flakyConnector{failures: 5}
+	ex := Retry(Scatter(), 3, time.Millisecond).(*exchange)
+
+	_, err := ex.connect(dist, ":5552")
+	require.Error(t, err)
+	require.Equal(t, 3, dist.calls)
+	require.Equal(t, "ep: connect to :5552 failed on attempt 3: dial tcp: connection refused", err.Error())
+
+	// connections that failed to set up are closed
+	for _, conn := range dist.opened {
+		require.True(t, conn.closed, "open connections leak")
+	}
+
+	// other errors aren't transient
+	dist = &flakyConnector{failures: 5, err: fmt.Errorf("bad uid")}
+	_, err = ex.connect(dist, ":5552")
+	require.Error(t, err)
+	require.Equal(t, 1, dist.calls)
+}
+
+// closingConn is a connection that records whether it was closed
+type closingConn struct {
+	net.Conn
+	closed bool
+}
+
+func (c *closingConn) Close() error {
+	c.closed = true
+	return c.Conn.Close()
+}
+
+// flakyConnector fails the first Connect calls, with a refused connection by
+// default, after opening a connection
+type flakyConnector struct {
+	failures int
+	err      error
+	calls    int
+	opened   []*closingConn
+}
+
+func (d *flakyConnector) Connect(addr, uid string) (net.Conn, error) {
+	d.calls++
+	c, other := net.Pipe()
+	other.Close()
+	conn := &closingConn{Conn: c}
+	d.opened = append(d.opened, conn)
+	if d.calls <= d.failures {
+		err := d.err
+		if err == nil {
+			err = &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}
+		}
+		return conn, err
+	}
+	return conn, nil
+}
+
 // Tests the scattering when there's just one node - the whole thing should
 // be short-circuited to act as a pass-through
 func TestExchange_init_closeAllConnectionsUponError(t *testing.T) {
@@ -29,10 +109,10 @@ func TestExchange_init_closeAllConnectionsUponError(t *testing.T) {
 	err = exchange.init(ctx)
 
 	require.Error(t, err)
-	require.Equal(t, "dial tcp :5552: connect: connection refused", err.Error())
+	require.Equal(t, "ep: connect to :5552 failed on attempt 3: dial tcp :5552: connect: connection refused", err.Error())
 	require.Equal(t, 1, len(exchange.conns))
 	require.IsType(t, &shortCircuit{}, exchange.conns[0])
-	require.True(t, (exchange.conns[0]).(*shortCircuit).closed, "open connections leak")
+	require.True(t, isClosed(exchange.conns[0].(*shortCircuit)), "open connections leak")
 	require.NoError(t, dist.Close())
 }
 
@@ -73,6 +153,10 @@ func TestPartition_addsMembersToHashRing(t *testing.T) {
 	ctx = context.WithValue(ctx, masterNodeKey, port1)
 	ctx = context.WithValue(ctx, thisNodeKey, port1)
 
+	// the other nodes never run the exchange, thus they can't handshake
+	SetLegacyProtocol(true)
+	defer SetLegacyProtocol(false)
+
 	partition := Partition(0).(*exchange)
 	partition.init(ctx)
 
@@ -107,6 +191,10 @@ func TestExchange_encodePartition_failsWithoutDataset(t *testing.T) {
 	ctx = context.WithValue(ctx, masterNodeKey, port1)
 	ctx = context.WithValue(ctx, thisNodeKey, port1)
 
+	// the other nodes never run the exchange, thus they can't handshake
+	SetLegacyProtocol(true)
+	defer SetLegacyProtocol(false)
+
 	partition := Partition(0).(*exchange)
 	partition.init(ctx)
 
@@ -145,6 +233,10 @@ func TestExchange_getPartitionEncoder_consistent(t *testing.T) {
 	ctx = context.WithValue(ctx, masterNodeKey, port1)
 	ctx = context.WithValue(ctx, thisNodeKey, port1)
 
+	// the other nodes never run the exchange, thus they can't handshake
+	SetLegacyProtocol(true)
+	defer SetLegacyProtocol(false)
+
 	partition := Partition(0).(*exchange)
 	partition.init(ctx)
 
@@ -159,3 +251,2909 @@ func TestExchange_getPartitionEncoder_consistent(t *testing.T) {
 		require.Equal(t, enc, nextEncoder)
 	}
 }
+
+func TestExchange_encodePartition_emptyDataset(t *testing.T) {
+	enc1, enc2 := &recordingEncoder{}, &recordingEncoder{}
+	partition := newTestPartition([]int{0}, enc1, enc2)
+
+	err := partition.encodePartition(NewDataset(Null.Data(0)))
+	require.NoError(t, err)
+	require.Equal(t, 0, len(enc1.reqs))
+	require.Equal(t, 0, len(enc2.reqs))
+}
+
+func TestExchange_encodePartition_singleDestination(t *testing.T) {
+	enc := &recordingEncoder{}
+	partition := newTestPartition([]int{0}, enc)
+
+	data := NewDataset(Null.Data(5))
+	err := partition.encodePartition(data)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(enc.reqs))
+	require.Equal(t, data, enc.reqs[0].Payload)
+}
+
+func TestExchange_partitionKeys_multipleColumns(t *testing.T) {
+	partition := newTestPartition([]int{0, 1})
+	keys, err := partition.partitionKeys(NewDataset(
+		testStrs{"a\x00b", "a", ""},
+		testStrs{"c", "b\x00c", ""},
+	))
+	require.NoError(t, err)
+	require.Equal(t, 3, len(keys))
+	require.NotEqual(t, keys[0], keys[1])
+
+	// keys are the hashes of the rows
+	data := NewDataset(testStrs{"a", "b"}, &Int64s{Values: []int64{1, 2}, Null: NullMask{1}})
+	keys, err = newTestPartition([]int{1, 0}).partitionKeys(data)
+	require.NoError(t, err)
+	for i, key := range keys {
+		require.Equal(t, strconv.FormatUint(HashDataset(data, i, []int{1, 0}), 16), key)
+	}
+
+	// nulls don't collide with values that render the same way
+	keys, err = partition.partitionKeys(NewDataset(Null.Data(1), testStrs{""}))
+	require.NoError(t, err)
+	other, err := partition.partitionKeys(NewDataset(testStrs{""}, testStrs{""}))
+	require.NoError(t, err)
+	require.NotEqual(t, keys, other)
+}
+
+func TestExchange_encodePartition_columnOutOfRange(t *testing.T) {
+	enc1, enc2 := &recordingEncoder{}, &recordingEncoder{}
+	partition := newTestPartition([]int{5}, enc1, enc2)
+
+	err := partition.encodePartition(NewDataset(testStrs{"a"}, testStrs{"b"}))
+	require.Error(t, err)
+	require.Equal(t, "partition column 5 out of range for 2 columns", err.Error())
+}
+
+func TestExchange_encodePartition_splitsRows(t *testing.T) {
+	enc1, enc2 := &recordingEncoder{}, &recordingEncoder{}
+	partition := newTestPartition([]int{0}, enc1, enc2)
+
+	keys := testStrs{}
+	for i := 0; i < 20; i++ {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+	values := make(testStrs, len(keys))
+	for i := range keys {
+		values[i] = fmt.Sprintf("value-%d", i)
+	}
+
+	err := partition.encodePartition(NewDataset(keys, values))
+	require.NoError(t, err)
+
+	// expected rows, per encoder, in the order of the input
+	expected := map[encoder][]string{}
+	for i, key := range keys {
+		k, err := partition.partitionKeys(NewDataset(testStrs{key}))
+		require.NoError(t, err)
+		enc, err := partition.getPartitionEncoder(k[0])
+		require.NoError(t, err)
+		expected[enc] = append(expected[enc], values[i])
+	}
+	require.Equal(t, 2, len(expected), "all keys routed to one encoder")
+
+	for _, enc := range []*recordingEncoder{enc1, enc2} {
+		require.Equal(t, 1, len(enc.reqs))
+		data := enc.reqs[0].Payload.(Dataset)
+		require.Equal(t, 2, data.Width())
+		require.Equal(t, expected[enc], data.At(1).Strings())
+		for i, key := range data.At(0).Strings() {
+			require.Equal(t, "key-"+data.At(1).Strings()[i][len("value-"):], key)
+		}
+	}
+}
+
+// newTestPartition returns a partition exchange with the provided encoders,
+// each assigned to a fake node address, without opening any connections
+func TestExchange_decodeNext_removesExhaustedDecoders(t *testing.T) {
+	// the first two decoders are exhausted early
+	ex := &exchange{decs: []decoder{
+		newScriptedDecoder("a1"),
+		newScriptedDecoder("b1"),
+		newScriptedDecoder("c1", "c2", "c3"),
+	}}
+	expected := map[byte][]string{'a': {"a1"}, 'b': {"b1"}, 'c': {"c1", "c2", "c3"}}
+	require.Equal(t, expected, bySource(decodeAll(t, ex)))
+	require.Equal(t, 0, len(ex.decs))
+}
+
+func TestExchange_decodeNext_doesntSkipAfterRemoval(t *testing.T) {
+	// the first decoder is removed right away, while the others are still
+	// being read
+	ex := &exchange{decs: []decoder{
+		newScriptedDecoder(),
+		newScriptedDecoder("b1", "b2"),
+		newScriptedDecoder("c1", "c2"),
+	}}
+	expected := map[byte][]string{'b': {"b1", "b2"}, 'c': {"c1", "c2"}}
+	require.Equal(t, expected, bySource(decodeAll(t, ex)))
+}
+
+func TestExchange_decodeRoundRobin(t *testing.T) {
+	// the first two decoders are exhausted back-to-back
+	ex := &exchange{RoundRobin: true, decs: []decoder{
+		newScriptedDecoder("a1"),
+		newScriptedDecoder("b1"),
+		newScriptedDecoder("c1", "c2", "c3"),
+	}}
+	require.Equal(t, []string{"b1", "c1", "a1", "c2", "c3"}, decodeAll(t, ex))
+
+	// the first decoder is removed after a wrap-around of the round robin, the
+	// second decoder is the next one
+	ex = &exchange{RoundRobin: true, decs: []decoder{
+		newScriptedDecoder(),
+		newScriptedDecoder("b1", "b2"),
+		newScriptedDecoder("c1", "c2"),
+	}}
+	require.Equal(t, []string{"b1", "c1", "b2", "c2"}, decodeAll(t, ex))
+
+	require.Panics(t, func() { RoundRobin(Pipeline()) })
+	require.True(t, RoundRobin(Gather()).(*exchange).RoundRobin)
+}
+
+func TestExchange_decodeNext_mutePeer(t *testing.T) {
+	// a round robin would start from the second decoder, which is mute
+	mute := &muteDecoder{closed: make(chan struct{})}
+	ex := &exchange{decs: []decoder{
+		newScriptedDecoder("a1", "a2"),
+		mute,
+		newScriptedDecoder("c1", "c2"),
+	}}
+
+	received := make(chan string)
+	go func() {
+		defer close(received)
+		for i := 0; i < 4; i++ {
+			data, err := ex.decodeNext()
+			if err != nil {
+				return
+			}
+			received <- data.At(0).Strings()[0]
+		}
+	}()
+
+	res := []string{}
+	timeout := time.After(time.Second)
+	for len(res) < 4 {
+		select {
+		case v := <-received:
+			res = append(res, v)
+		case <-timeout:
+			require.FailNow(t, "the mute peer delays the other peers", "received %v", res)
+		}
+	}
+	expected := map[byte][]string{'a': {"a1", "a2"}, 'c': {"c1", "c2"}}
+	require.Equal(t, expected, bySource(res))
+
+	// the reader of the mute peer stops once closed, even though its result
+	// is never received
+	require.NoError(t, ex.Close())
+	close(mute.closed)
+	select {
+	case <-mute.returned():
+	case <-time.After(time.Second):
+		require.FailNow(t, "the mute peer is still decoded")
+	}
+}
+
+// muteDecoder is a decoder that blocks until closed, and then fails
+type muteDecoder struct {
+	closed chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (d *muteDecoder) Decode(e interface{}) error {
+	<-d.closed
+	close(d.returned())
+	return io.ErrClosedPipe
+}
+
+// returned returns a channel that's closed once Decode returns
+func (d *muteDecoder) returned() chan struct{} {
+	d.once.Do(func() { d.done = make(chan struct{}) })
+	return d.done
+}
+
+// bySource groups the values received by the source that sent them, which is
+// indicated by their first letter, in the order they were received
+func bySource(values []string) map[byte][]string {
+	res := map[byte][]string{}
+	for _, v := range values {
+		res[v[0]] = append(res[v[0]], v)
+	}
+	return res
+}
+
+func TestOrderedGather_reordersBySequence(t *testing.T) {
+	seq := func(n int, v string) *seqBatch {
+		return &seqBatch{n, NewDataset(testStrs{v})}
+	}
+
+	ex := &exchange{Type: orderedGather, decs: []decoder{
+		&scriptedDecoder{[]interface{}{seq(2, "a2"), seq(1, "a1"), seq(3, "a3")}},
+		&scriptedDecoder{[]interface{}{seq(1, "b1"), seq(3, "b3"), seq(2, "b2")}},
+	}}
+	expected := map[byte][]string{'a': {"a1", "a2", "a3"}, 'b': {"b1", "b2", "b3"}}
+	require.Equal(t, expected, bySource(decodeAll(t, ex)))
+
+	ex = &exchange{Type: orderedGather, RoundRobin: true, decs: []decoder{
+		&scriptedDecoder{[]interface{}{seq(2, "a2"), seq(1, "a1"), seq(3, "a3")}},
+		&scriptedDecoder{[]interface{}{seq(1, "b1"), seq(3, "b3"), seq(2, "b2")}},
+	}}
+	require.Equal(t, []string{"b1", "a1", "b2", "a2", "b3", "a3"}, decodeAll(t, ex))
+}
+
+func TestOrderedGather_missingSequence(t *testing.T) {
+	ex := &exchange{Type: orderedGather, decs: []decoder{
+		&scriptedDecoder{[]interface{}{&seqBatch{2, NewDataset(testStrs{"a2"})}}},
+	}}
+	_, err := ex.decodeNext()
+	require.Error(t, err)
+	require.Equal(t, "missing dataset 1 from peer", err.Error())
+}
+
+func TestGather_preservesSenderOrder(t *testing.T) {
+	nodes := []string{":5551", ":5552", ":5553"}
+	for _, newRunner := range []func() Runner{Gather, OrderedGather} {
+		cluster := newPipeCluster()
+
+		// randomly delay the writes, to shuffle the delivery timing
+		cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+			return &delayingConn{conn}
+		}
+
+		inps := map[string]chan Dataset{}
+		for _, node := range nodes {
+			data := []Dataset{}
+			for i := 0; i < 10; i++ {
+				data = append(data, NewDataset(testStrs{fmt.Sprintf("%s %d", node, i)}))
+			}
+			inps[node] = closedInput(data...)
+		}
+
+		ex := newRunner().(*exchange)
+		errs := cluster.runWithTimeout(t, nodes, func() Runner {
+			return &exchange{UID: ex.UID, Type: ex.Type}
+		}, inps)
+		for _, node := range nodes {
+			require.NoError(t, errs[node])
+		}
+
+		// datasets from every node are received in the order they were sent
+		next := map[string]int{}
+		for _, data := range cluster.outs[nodes[0]] {
+			var node string
+			var i int
+			_, err := fmt.Sscanf(data.At(0).Strings()[0], "%s %d", &node, &i)
+			require.NoError(t, err)
+			require.Equal(t, next[node], i, "out of order from %s", node)
+			next[node]++
+		}
+		require.Equal(t, map[string]int{nodes[0]: 10, nodes[1]: 10, nodes[2]: 10}, next)
+	}
+}
+
+// delayingConn is a connection that delays every write by up to 1ms
+type delayingConn struct{ net.Conn }
+
+func (c *delayingConn) Write(b []byte) (int, error) {
+	time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+	return c.Conn.Write(b)
+}
+
+// decodeAll decodes all of the data from the exchange until EOF. Returns the
+// first value of every dataset received
+func decodeAll(t *testing.T, ex *exchange) []string {
+	res := []string{}
+	for {
+		data, err := ex.decodeNext()
+		if err == io.EOF {
+			return res
+		}
+		require.NoError(t, err)
+		res = append(res, data.At(0).Strings()[0])
+	}
+}
+
+// scriptedDecoder decodes all of its payloads in order, and EOF afterwards
+type scriptedDecoder struct{ payloads []interface{} }
+
+// newScriptedDecoder returns a scriptedDecoder that decodes a dataset for every
+// one of the values
+func newScriptedDecoder(vals ...string) *scriptedDecoder {
+	dec := &scriptedDecoder{}
+	for _, v := range vals {
+		dec.payloads = append(dec.payloads, NewDataset(testStrs{v}))
+	}
+	return dec
+}
+
+func (dec *scriptedDecoder) Decode(e interface{}) error {
+	if len(dec.payloads) == 0 {
+		return io.EOF
+	}
+
+	e.(*req).Payload = dec.payloads[0]
+	dec.payloads = dec.payloads[1:]
+	return nil
+}
+
+func TestExchange_encodeAll_skipsDeadDestinations(t *testing.T) {
+	encs := []encoder{}
+	conns := []net.Conn{}
+	for i := 0; i < 3; i++ {
+		conn, other := net.Pipe()
+		go io.Copy(ioutil.Discard, other)
+		defer other.Close()
+		conns = append(conns, conn)
+		encs = append(encs, gob.NewEncoder(conn))
+	}
+
+	// the write side of the second destination is closed
+	conns[1].Close()
+	ex := newTestPartition(nil, encs...)
+	data := NewDataset(Null.Data(1))
+
+	err := ex.encodeAll(data)
+	require.Error(t, err)
+	errs, ok := err.(encodeErrors)
+	require.True(t, ok)
+	require.Equal(t, 1, len(errs))
+	require.Contains(t, errs[":5001"].Error(), ":5001")
+	require.Contains(t, errs[":5001"].Error(), io.ErrClosedPipe.Error())
+	require.Equal(t, map[string]error(errs), ex.deadPeers())
+
+	// dead destinations are skipped by later sends
+	require.NoError(t, ex.encodeAll(data))
+	ex.Type = scatter
+	for i := 0; i < 4; i++ {
+		require.NoError(t, ex.send(data))
+		require.NotEqual(t, 1, ex.encsNext)
+	}
+	require.Equal(t, 1, len(ex.deadPeers()))
+}
+
+func TestExchange_encodePartition_partitioner(t *testing.T) {
+	encs := []*recordingEncoder{{}, {}, {}}
+	ex := newTestPartition(nil, encs[0], encs[1], encs[2])
+	ex.Partitioner = moduloPartitioner{}
+
+	err := ex.encodePartition(NewDataset(testStrs{"a", "b", "c", "d"}))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(encs[0].reqs))
+	require.Equal(t, []string{"a", "d"}, encs[0].reqs[0].Payload.(Dataset).At(0).Strings())
+	require.Equal(t, 1, len(encs[1].reqs))
+	require.Equal(t, []string{"b"}, encs[1].reqs[0].Payload.(Dataset).At(0).Strings())
+	require.Equal(t, 1, len(encs[2].reqs))
+	require.Equal(t, []string{"c"}, encs[2].reqs[0].Payload.(Dataset).At(0).Strings())
+}
+
+func TestExchange_encodePartition_partitionerOutOfRange(t *testing.T) {
+	encs := []*recordingEncoder{{}, {}}
+	ex := newTestPartition(nil, encs[0], encs[1])
+	ex.Partitioner = constPartitioner(2)
+
+	err := ex.encodePartition(NewDataset(testStrs{"a"}))
+	require.Error(t, err)
+	require.Equal(t, "partitioner returned node 2 out of range for 2 nodes", err.Error())
+	require.Equal(t, 0, len(encs[0].reqs))
+	require.Equal(t, 0, len(encs[1].reqs))
+}
+
+// moduloPartitioner routes every row to the node at its index modulo the
+// number of nodes
+type moduloPartitioner struct{}
+
+func (moduloPartitioner) Partition(data Dataset, row int, numNodes int) int {
+	return row % numNodes
+}
+
+// constPartitioner routes all rows to the same node index
+type constPartitioner int
+
+func (p constPartitioner) Partition(data Dataset, row int, numNodes int) int {
+	return int(p)
+}
+
+func TestExchange_encodeAll_slowDestination(t *testing.T) {
+	gate := make(chan struct{}) // the slow reader is blocked until it's closed
+	received := make(chan Dataset)
+	failed := make(chan struct{}, 2)
+
+	fast, fastOther := net.Pipe()
+	defer fast.Close()
+	go func() {
+		dec := newDecoder(fastOther)
+		for {
+			data, err := decode(dec, &req{})
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- data
+		}
+	}()
+
+	slow, slowOther := net.Pipe()
+	defer slow.Close()
+	go func() {
+		<-gate
+		io.Copy(ioutil.Discard, slowOther)
+	}()
+
+	ex := newTestPartition(nil,
+		newQueuedEncoder(newEncoder(fast), failed, 0),
+		newQueuedEncoder(newEncoder(slow), failed, 0),
+	)
+
+	// the fast destination receives all of the data while the slow one
+	// doesn't read anything
+	n := sendQueueSize - 1
+	for i := 0; i < n; i++ {
+		require.NoError(t, ex.encodeAll(NewDataset(Null.Data(i+1))))
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case data := <-received:
+			require.Equal(t, i+1, data.Len())
+		case <-time.After(time.Second):
+			require.FailNow(t, "fast destination is blocked by the slow one")
+		}
+	}
+
+	close(gate)
+	require.NoError(t, ex.flushQueues())
+	require.Equal(t, 0, len(failed))
+}
+
+func TestExchange_flushQueues_returnsErrors(t *testing.T) {
+	failed := make(chan struct{}, 1)
+	conn, other := net.Pipe()
+	other.Close()
+
+	ex := newTestPartition(nil, newQueuedEncoder(newEncoder(conn), failed, 0))
+	require.NoError(t, ex.encodeAll(NewDataset(Null.Data(1))))
+
+	// the failure is notified, and returned once the queue is flushed
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		require.FailNow(t, "failure wasn't notified")
+	}
+	err := ex.flushQueues()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "ep: encode to :5000 failed")
+	require.Equal(t, 1, len(ex.deadPeers()))
+}
+
+func TestScatterWeighted(t *testing.T) {
+	encs := []*recordingEncoder{{}, {}, {}, {}}
+	ex := newTestPartition(nil, encs[0], encs[1], encs[2], encs[3])
+	ex.Type = scatter
+	ex.Weights = map[string]int{":5000": 3, ":5001": 1, ":5002": 0}
+
+	data := NewDataset(Null.Data(1))
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, ex.send(data))
+	}
+
+	// :5003 has no explicit weight, thus defaults to 1
+	require.Equal(t, 200, len(encs[1].reqs))
+	require.Equal(t, 0, len(encs[2].reqs))
+	require.Equal(t, 200, len(encs[3].reqs))
+	require.Equal(t, 3*len(encs[1].reqs), len(encs[0].reqs))
+
+	// all of the destinations with a weight of zero
+	ex = newTestPartition(nil, &recordingEncoder{})
+	ex.Type = scatter
+	ex.Weights = map[string]int{":5000": 0}
+	require.Error(t, ex.send(data))
+}
+
+func TestScatterWeighted_consecutiveBatches(t *testing.T) {
+	order := []int{}
+	encs := []encoder{}
+	for i := 0; i < 2; i++ {
+		encs = append(encs, &orderEncoder{i, &order})
+	}
+
+	ex := newTestPartition(nil, encs...)
+	ex.Type = scatter
+	ex.Weights = map[string]int{":5000": 3, ":5001": 2}
+
+	data := NewDataset(Null.Data(1))
+	for i := 0; i < 10; i++ {
+		require.NoError(t, ex.send(data))
+	}
+	require.Equal(t, []int{1, 1, 0, 0, 0, 1, 1, 0, 0, 0}, order)
+}
+
+func TestScatterBySize(t *testing.T) {
+	encs := []*recordingEncoder{{}, {}, {}}
+	ex := newTestPartition(nil, encs[0], encs[1], encs[2])
+	ex.Type = scatter
+	ex.BySize = true
+
+	small := NewDataset(Null.Data(1))
+	large := NewDataset(Null.Data(10000))
+	for i := 0; i < 100; i++ {
+		require.NoError(t, ex.send(small))
+		require.NoError(t, ex.send(large))
+	}
+
+	total := 0
+	for _, enc := range encs {
+		rows := 0
+		for _, req := range enc.reqs {
+			rows += req.Payload.(Dataset).Len()
+		}
+		require.Equal(t, rows, ex.rowsSent()[ex.addrOf(enc)])
+		total += rows
+	}
+
+	avg := total / len(encs)
+	for addr, rows := range ex.rowsSent() {
+		require.InDelta(t, avg, rows, float64(avg)/10, addr)
+	}
+}
+
+func TestScatterByKey(t *testing.T) {
+	encs := []*recordingEncoder{{}, {}, {}}
+	ex := newTestPartition(nil, encs[0], encs[1], encs[2])
+	ex.Type = scatter
+	ex.KeyCols = []int{1}
+
+	keys := map[string]encoder{}
+	for i := 0; i < 30; i++ {
+		key := strconv.Itoa(i % 7)
+		data := NewDataset(testStrs{"x", "y"}, testStrs{key, "other"})
+		before := []int{len(encs[0].reqs), len(encs[1].reqs), len(encs[2].reqs)}
+		require.NoError(t, ex.send(data))
+
+		// find the destination of the last dataset
+		var dest encoder
+		for j, enc := range encs {
+			if len(enc.reqs) > before[j] {
+				dest = enc
+			}
+		}
+		require.NotNil(t, dest)
+
+		if prev, ok := keys[key]; ok {
+			require.Equal(t, prev, dest, key)
+		}
+		keys[key] = dest
+	}
+
+	// keys are hashed, rather than routed in a round-robin
+	used := map[encoder]bool{}
+	for _, enc := range keys {
+		used[enc] = true
+	}
+	require.True(t, len(used) > 1)
+}
+
+func TestScatterByKey_edgeCases(t *testing.T) {
+	encs := []*recordingEncoder{{}, {}, {}}
+	ex := newTestPartition(nil, encs[0], encs[1], encs[2])
+	ex.Type = scatter
+	ex.KeyCols = []int{0}
+
+	// null keys all map to the same destination
+	for i := 0; i < 3; i++ {
+		require.NoError(t, ex.send(NewDataset(Null.Data(i+1))))
+	}
+	counts := []int{}
+	for _, enc := range encs {
+		counts = append(counts, len(enc.reqs))
+	}
+	sort.Ints(counts)
+	require.Equal(t, []int{0, 0, 3}, counts)
+
+	// empty datasets are sent in a round-robin
+	for i := 0; i < 3; i++ {
+		require.NoError(t, ex.send(NewDataset(Null.Data(0))))
+	}
+	for _, enc := range encs {
+		require.True(t, len(enc.reqs) > 0)
+	}
+
+	ex.KeyCols = []int{5}
+	err := ex.send(NewDataset(Null.Data(1)))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "out of range")
+}
+
+func TestConsistentHashPartitioner_nodeAddresses(t *testing.T) {
+	keys := make(testStrs, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	data := NewDataset(keys)
+
+	nodes := []string{":5000", ":5001", ":5002"}
+	p := ConsistentHashPartitioner(0).(*consistentPartitioner)
+	p.setNodes(nodes)
+	before := map[int]string{}
+	for i := 0; i < data.Len(); i++ {
+		before[i] = nodes[p.Partition(data, i, len(nodes))]
+	}
+
+	// a node is added in the middle of the nodes, shifting their indices
+	nodes = []string{":5000", ":4999", ":5001", ":5002"}
+	p.setNodes(nodes)
+	for i := 0; i < data.Len(); i++ {
+		node := nodes[p.Partition(data, i, len(nodes))]
+		if node != before[i] {
+			require.Equal(t, ":4999", node)
+		}
+	}
+}
+
+// orderEncoder is an encoder that appends its index to a shared order of
+// encodes
+type orderEncoder struct {
+	i     int
+	order *[]int
+}
+
+func (enc *orderEncoder) Encode(interface{}) error {
+	*enc.order = append(*enc.order, enc.i)
+	return nil
+}
+
+func newTestPartition(cols []int, encs ...encoder) *exchange {
+	ex := Partition(cols...).(*exchange)
+	ex.hashRing = consistent.New()
+	ex.encsByKey = make(map[string]encoder)
+	for i, enc := range encs {
+		node := fmt.Sprintf(":%d", 5000+i)
+		ex.encs = append(ex.encs, enc)
+		ex.hashRing.Add(node)
+		ex.encsByKey[node] = enc
+	}
+	return ex
+}
+
+// recordingEncoder is an encoder that records all of the encoded requests
+type recordingEncoder struct {
+	reqs []*req
+}
+
+func (enc *recordingEncoder) Encode(e interface{}) error {
+	enc.reqs = append(enc.reqs, e.(*req))
+	return nil
+}
+
+func TestExchange_Run_sendErrorSurfaces(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+
+	// fail after the first few writes from the master, mid-stream
+	errWrite := fmt.Errorf("something bad happened")
+	cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+		if from == nodes[0] {
+			return &failingConn{Conn: conn, WritesLeft: 3, ReadsLeft: -1, Err: errWrite}
+		}
+		return conn
+	}
+
+	data := []Dataset{}
+	for i := 0; i < 10; i++ {
+		data = append(data, NewDataset(Null.Data(i+1)))
+	}
+
+	uid := Scatter().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: scatter}
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(data...),
+		nodes[1]: closedInput(),
+	})
+
+	// both nodes completed, and the failure surfaced on the failing node
+	require.Equal(t, 2, len(errs))
+	require.Error(t, errs[nodes[0]])
+	require.Contains(t, errs[nodes[0]].Error(), errWrite.Error())
+}
+
+func TestExchange_Run_receiveErrorSurfaces(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+
+	// fail the master's reads from the peer, mid-stream
+	errRead := fmt.Errorf("something bad happened")
+	cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+		if from == nodes[0] {
+			return &failingConn{Conn: conn, WritesLeft: -1, ReadsLeft: 2, Err: errRead}
+		}
+		return conn
+	}
+
+	data := []Dataset{}
+	for i := 0; i < 10; i++ {
+		data = append(data, NewDataset(Null.Data(i+1)))
+	}
+
+	// the master's input is never closed: the sending side must be stopped
+	// when the receiving side fails
+	inp := make(chan Dataset)
+	defer close(inp)
+
+	uid := Broadcast().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: broadcast}
+	}, map[string]chan Dataset{
+		nodes[0]: inp,
+		nodes[1]: closedInput(data...),
+	})
+
+	// both nodes completed, and the failure surfaced on the failing node
+	require.Equal(t, 2, len(errs))
+	require.Error(t, errs[nodes[0]])
+	require.Contains(t, errs[nodes[0]].Error(), errRead.Error())
+}
+
+func TestExchange_Run_errorPropagatesToPeers(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+
+	// partitioning by a missing column fails the master's sending side, while
+	// its connections are all intact
+	uid := Partition(5).(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: partition, PartitionCols: []int{5}}
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(NewDataset(testStrs{"a", "b"})),
+		nodes[1]: closedInput(),
+	})
+
+	require.Equal(t, 2, len(errs))
+	require.Error(t, errs[nodes[0]])
+	require.Error(t, errs[nodes[1]])
+	require.Equal(t, "partition column 5 out of range for 1 columns", errs[nodes[0]].Error())
+	require.Equal(t, errs[nodes[0]].Error(), errs[nodes[1]].Error())
+}
+
+func TestExchange_Run_readTimeout(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+
+	// the peer hangs without sending anything, until long after the timeout
+	hung := make(chan Dataset)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		close(hung)
+	}()
+
+	uid := Gather().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return Timeout(&exchange{UID: uid, Type: gather}, 50*time.Millisecond)
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(NewDataset(testStrs{"a"})),
+		nodes[1]: hung,
+	})
+
+	require.Error(t, errs[nodes[0]])
+	require.Contains(t, errs[nodes[0]].Error(), "read from :5552 timed out")
+}
+
+func TestTimeout_writeNeverRead(t *testing.T) {
+	conn, other := net.Pipe()
+	defer other.Close()
+	defer conn.Close()
+
+	ex := Timeout(Gather(), 10*time.Millisecond).(*exchange)
+	enc := newEncoder(ex.withTimeout(conn, ":5552"))
+
+	errs := make(chan error, 1)
+	go func() { errs <- enc.Encode(&req{NewDataset(testStrs{"a"})}) }()
+
+	select {
+	case err := <-errs:
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "write to :5552 timed out after 10ms")
+	case <-time.After(5 * time.Second):
+		t.Fatal("write to a peer that never reads hangs")
+	}
+}
+
+func TestHeartbeat_keepsIdlePeersAlive(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+
+	// the peer is idle for much longer than the heartbeat timeout
+	idle := make(chan Dataset, 1)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		idle <- NewDataset(testStrs{"b"})
+		close(idle)
+	}()
+
+	uid := Gather().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		ex := &exchange{UID: uid, Type: gather}
+		return Heartbeat(ex, 5*time.Millisecond, 50*time.Millisecond, AbortOnPeerDeath)
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(NewDataset(testStrs{"a"})),
+		nodes[1]: idle,
+	})
+
+	require.NoError(t, errs[nodes[0]])
+	require.NoError(t, errs[nodes[1]])
+	require.Equal(t, 2, len(cluster.outs[nodes[0]]))
+}
+
+func TestHeartbeat_deadPeer(t *testing.T) {
+	for _, mode := range []PeerDeath{AbortOnPeerDeath, SkipDeadPeers} {
+		nodes := []string{":5551", ":5552"}
+		cluster := newPipeCluster()
+
+		// nothing sent by the peer arrives after the handshake and the stream
+		// header, and the connection is never closed, as if its process hangs
+		cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+			if from == nodes[1] {
+				return &blackholeConn{Conn: conn}
+			}
+			return conn
+		}
+
+		uid := Gather().(*exchange).UID
+		errs := cluster.runWithTimeout(t, nodes, func() Runner {
+			ex := &exchange{UID: uid, Type: gather}
+			return Heartbeat(ex, 5*time.Millisecond, 50*time.Millisecond, mode)
+		}, map[string]chan Dataset{
+			nodes[0]: closedInput(NewDataset(testStrs{"a"})),
+			nodes[1]: closedInput(NewDataset(testStrs{"b"})),
+		})
+
+		if mode == AbortOnPeerDeath {
+			require.Error(t, errs[nodes[0]])
+			require.Equal(t, "ep: peer :5552 is dead, nothing received for 50ms", errs[nodes[0]].Error())
+		} else {
+			require.NoError(t, errs[nodes[0]])
+			require.Equal(t, 1, len(cluster.outs[nodes[0]]))
+		}
+	}
+}
+
+func TestHeartbeat_negotiatedByStreamHeader(t *testing.T) {
+	for _, flags := range []byte{0, heartbeatsFlag} {
+		conn, other := net.Pipe()
+		ex := Heartbeat(Gather(), time.Millisecond, 10*time.Millisecond, AbortOnPeerDeath).(*exchange)
+		dc := ex.withTimeout(conn, ":5552").(*deadlineConn)
+
+		go compressWriter(other, NoCompression, flags).Write([]byte("a"))
+		_, err := decompressReader(dc).Read(make([]byte, 1))
+		require.NoError(t, err)
+		require.Equal(t, flags != 0, dc.detecting)
+
+		conn.Close()
+		other.Close()
+	}
+}
+
+func TestHeartbeat_discardedByDecoders(t *testing.T) {
+	for _, codec := range []Codec{GobCodec, RawCodec, ArrowCodec} {
+		SetExchangeCodec(codec)
+		buf := &bytes.Buffer{}
+		enc := newEncoder(buf)
+		require.NoError(t, enc.Encode(&req{&heartbeat{1}}))
+		require.NoError(t, enc.Encode(&req{NewDataset(Null.Data(3))}))
+		require.NoError(t, enc.Encode(&req{&heartbeat{2}}))
+		require.NoError(t, enc.Encode(&req{&endOfStream{":5552"}}))
+
+		dec := dbgDecoder{newDecoder(buf), "", ":5552"}
+		data, err := decode(dec, &req{})
+		SetExchangeCodec(GobCodec)
+		require.NoError(t, err)
+		require.Equal(t, 3, data.Len())
+
+		_, err = decode(dec, &req{})
+		require.Equal(t, io.EOF, err)
+	}
+}
+
+func TestExchange_decode_endOfStream(t *testing.T) {
+	for _, codec := range []Codec{GobCodec, RawCodec, ArrowCodec} {
+		SetExchangeCodec(codec)
+		buf := &bytes.Buffer{}
+		enc := newEncoder(buf)
+		require.NoError(t, enc.Encode(&req{NewDataset(Null.Data(1))}))
+		require.NoError(t, enc.Encode(&req{&endOfStream{":5552"}}))
+		truncated := bytes.NewBuffer(buf.Bytes()[:buf.Len()/2])
+
+		// a clean completion
+		ex := &exchange{decs: []decoder{dbgDecoder{newDecoder(buf), "", ":5552"}}}
+		_, err := ex.decodeNext()
+		require.NoError(t, err)
+		_, err = ex.decodeNext()
+		require.Equal(t, io.EOF, err)
+
+		// the connection ends without an end-of-stream
+		dec := dbgDecoder{newDecoder(truncated), "", ":5552"}
+		ex = &exchange{decs: []decoder{dec}}
+		_, err = ex.decodeNext()
+		if err == nil {
+			_, err = ex.decodeNext() // the dataset fits in the truncated stream
+		}
+		SetExchangeCodec(GobCodec)
+		require.Error(t, err)
+		require.Equal(t, "ep: peer :5552 disconnected unexpectedly", err.Error())
+	}
+}
+
+// blackholeConn is a connection that discards all writes after the first one,
+// and ignores Close
+type blackholeConn struct {
+	net.Conn
+	writes int
+}
+
+func (c *blackholeConn) Write(b []byte) (int, error) {
+	// the handshake and the stream header arrive
+	if c.writes == 2 {
+		return len(b), nil
+	}
+	c.writes++
+	return c.Conn.Write(b)
+}
+
+func (c *blackholeConn) Close() error { return nil }
+
+func TestStats(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+
+	var l sync.Mutex
+	runners := map[string]Runner{}
+	uid := Gather().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		l.Lock()
+		defer l.Unlock()
+		r := &exchange{UID: uid, Type: gather}
+		runners[nodes[len(runners)]] = r
+		return r
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(NewDataset(testStrs{"a"})),
+		nodes[1]: closedInput(NewDataset(testStrs{"b", "c"}), NewDataset(testStrs{"d"})),
+	})
+	require.NoError(t, errs[nodes[0]])
+	require.NoError(t, errs[nodes[1]])
+
+	// the runners are created in order, but run concurrently, thus the master
+	// is the one that received all of the rows
+	master, peer := Stats(runners[nodes[0]]), Stats(runners[nodes[1]])
+	if master[nodes[1]].RowsReceived == 0 {
+		master, peer = peer, master
+	}
+
+	require.Equal(t, int64(1), master[nodes[0]].RowsSent)
+	require.Equal(t, int64(1), master[nodes[0]].RowsReceived)
+	require.Equal(t, int64(0), master[nodes[0]].BytesSent) // loopback
+	require.Equal(t, int64(3), master[nodes[1]].RowsReceived)
+	require.Equal(t, int64(2), master[nodes[1]].BatchesReceived)
+	require.True(t, master[nodes[1]].BytesReceived > 0)
+	require.True(t, master[nodes[1]].DecodeTime > 0)
+
+	require.Equal(t, int64(3), peer[nodes[0]].RowsSent)
+	require.Equal(t, int64(2), peer[nodes[0]].BatchesSent)
+	require.Equal(t, master[nodes[1]].BytesReceived, peer[nodes[0]].BytesSent)
+	require.Equal(t, 1, len(peer))
+
+	// testStrs isn't Sized, it's estimated by its rows
+	require.Equal(t, int64(3*16), peer[nodes[0]].SizeSent)
+	require.Equal(t, int64(3*16), master[nodes[1]].SizeReceived)
+}
+
+func TestExchange_Run_drainsInputUponError(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+	goroutines := runtime.NumGoroutine()
+
+	// keep feeding the master after its exchange fails on the first dataset
+	inp := make(chan Dataset)
+	fed := make(chan struct{})
+	go func() {
+		defer close(fed)
+		defer close(inp)
+		for i := 0; i < 10; i++ {
+			inp <- NewDataset(testStrs{"a", "b"})
+		}
+	}()
+
+	uid := Partition(5).(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: partition, PartitionCols: []int{5}}
+	}, map[string]chan Dataset{
+		nodes[0]: inp,
+		nodes[1]: closedInput(),
+	})
+	require.Error(t, errs[nodes[0]])
+
+	select {
+	case <-fed:
+	case <-time.After(time.Second):
+		require.FailNow(t, "the input wasn't drained")
+	}
+
+	// all go-routines, including the draining one, have exited. Leftovers
+	// from previous tests might exit meanwhile, thus allow fewer of them
+	for i := 0; i < 100 && runtime.NumGoroutine() > goroutines; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	n := runtime.NumGoroutine()
+	require.True(t, n <= goroutines, "%d go-routines leaked", n-goroutines)
+}
+
+func TestExchange_Run_cancel(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cluster := newPipeCluster()
+	cluster.ctx = ctx
+
+	// nobody reads the outputs, and the inputs are never closed. Without
+	// cancellation all nodes would be blocked forever
+	cluster.noReads = true
+	inps := map[string]chan Dataset{}
+	for _, node := range nodes {
+		inp := make(chan Dataset)
+		inps[node] = inp
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case inp <- NewDataset(Null.Data(1)):
+				}
+			}
+		}()
+	}
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	uid := Broadcast().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: broadcast}
+	}, inps)
+
+	// cancellation isn't an error
+	require.Equal(t, 2, len(errs))
+	require.NoError(t, errs[nodes[0]])
+	require.NoError(t, errs[nodes[1]])
+}
+
+func TestExchange_Run_deadlineExceeded(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	cluster := newPipeCluster()
+	cluster.ctx = ctx
+
+	// the peer's input is never closed, so the master keeps waiting for it
+	inp := make(chan Dataset)
+	defer close(inp)
+
+	uid := Gather().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: gather}
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(),
+		nodes[1]: inp,
+	})
+
+	require.Equal(t, 2, len(errs))
+	require.Equal(t, context.DeadlineExceeded, errs[nodes[0]])
+	require.Equal(t, context.DeadlineExceeded, errs[nodes[1]])
+}
+
+// Measures the number of datasets (ops) per second going through a single
+// node Broadcast. Data to the local node goes through the short-circuit, thus
+// it isn't serialized, and the size of the datasets barely matters.
+func BenchmarkExchange_loopback(b *testing.B) {
+	data := NewDataset(Null.Data(1000))
+	inp := make(chan Dataset)
+	out := make(chan Dataset)
+
+	nodes := []string{":5551"}
+	ctx := context.WithValue(context.Background(), distributerKey, newPipeCluster().peer(nodes[0]))
+	ctx = context.WithValue(ctx, allNodesKey, nodes)
+	ctx = context.WithValue(ctx, masterNodeKey, nodes[0])
+	ctx = context.WithValue(ctx, thisNodeKey, nodes[0])
+
+	errs := make(chan error, 1)
+	go func() {
+		defer close(out)
+		errs <- Broadcast().Run(ctx, inp, out)
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		inp <- data
+		<-out
+	}
+
+	close(inp)
+	for range out {
+	}
+	require.NoError(b, <-errs)
+}
+
+func TestSortGather(t *testing.T) {
+	nodes := []string{":5551", ":5552", ":5553"}
+	cluster := newPipeCluster()
+
+	// every node sends sorted data, in several batches. The last node sends
+	// all of its data before the others
+	uid := SortGather().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: sortGather, SortingCols: []SortingCol{{Index: 0, Desc: true}}}
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(NewDataset(testStrs{"y", "t"}), NewDataset(testStrs{"s", "m", "a"})),
+		nodes[1]: closedInput(NewDataset(testStrs{"z"}), NewDataset(testStrs{}), NewDataset(testStrs{"n", "l", "b"})),
+		nodes[2]: closedInput(NewDataset(testStrs{"c", "b"})),
+	})
+
+	for _, node := range nodes {
+		require.NoError(t, errs[node])
+	}
+
+	res := []string{}
+	for _, data := range cluster.outs[nodes[0]] {
+		res = append(res, data.At(0).Strings()...)
+	}
+	require.Equal(t, []string{"z", "y", "t", "s", "n", "m", "l", "c", "b", "b", "a"}, res)
+	require.Equal(t, 0, len(cluster.outs[nodes[1]]))
+	require.Equal(t, 0, len(cluster.outs[nodes[2]]))
+}
+
+func TestExchange_Run_rawCodec(t *testing.T) {
+	SetExchangeCodec(RawCodec)
+	defer SetExchangeCodec(GobCodec)
+
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+	uid := OrderedGather().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: orderedGather}
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(NewDataset(Null.Data(1))),
+		nodes[1]: closedInput(NewDataset(Null.Data(2)), NewDataset(Null.Data(3))),
+	})
+	require.NoError(t, errs[nodes[0]])
+	require.NoError(t, errs[nodes[1]])
+
+	rows := 0
+	for _, data := range cluster.outs[nodes[0]] {
+		rows += data.Len()
+	}
+	require.Equal(t, 6, rows)
+
+	// errors are framed as well
+	cluster = newPipeCluster()
+	uid = Partition(5).(*exchange).UID
+	errs = cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: partition, PartitionCols: []int{5}}
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(NewDataset(Null.Data(1))),
+		nodes[1]: closedInput(),
+	})
+	require.Error(t, errs[nodes[1]])
+	require.Equal(t, errs[nodes[0]].Error(), errs[nodes[1]].Error())
+}
+
+func TestExchange_Run_compression(t *testing.T) {
+	nodes := []string{":5551", ":5552", ":5553"}
+	cluster := newPipeCluster()
+
+	inps := map[string]chan Dataset{}
+	for _, node := range nodes {
+		inps[node] = closedInput(NewDataset(testStrs{node + " a", node + " b"}))
+	}
+
+	uid := Broadcast().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return Compress(&exchange{UID: uid, Type: broadcast}, Gzip)
+	}, inps)
+
+	// every node received the data of all nodes, including its own (through
+	// the short-circuit)
+	for _, node := range nodes {
+		require.NoError(t, errs[node])
+
+		res := []string{}
+		for _, data := range cluster.outs[node] {
+			res = append(res, data.At(0).Strings()...)
+		}
+		sort.Strings(res)
+		require.Equal(t, []string{
+			":5551 a", ":5551 b", ":5552 a", ":5552 b", ":5553 a", ":5553 b",
+		}, res)
+	}
+}
+
+func TestCompress_unknownCompression(t *testing.T) {
+	_, err := compressWriter(ioutil.Discard, Compression(9), 0).Write([]byte("a"))
+	require.Error(t, err)
+
+	buf := bytes.NewBuffer([]byte{9})
+	_, err = decompressReader(buf).Read(make([]byte, 1))
+	require.Error(t, err)
+	require.Equal(t, "ep: unknown compression 9", err.Error())
+}
+
+// Measures the bytes written on the wire when partitioning repetitive string
+// columns between two nodes, with and without compression
+func BenchmarkExchange_compression(b *testing.B) {
+	for _, c := range []Compression{NoCompression, Gzip} {
+		c := c
+		b.Run(fmt.Sprintf("compression %d", c), func(b *testing.B) {
+			data := make(testStrs, 10000)
+			for i := range data {
+				data[i] = fmt.Sprintf("some repetitive value %d", i%10)
+			}
+
+			nodes := []string{":5551", ":5552"}
+			cluster := newPipeCluster()
+			var written int64
+			cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+				if from == nodes[0] {
+					return &countingConn{conn, &written}
+				}
+				return conn
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				uid := Partition().(*exchange).UID
+				errs := cluster.run(nodes, func() Runner {
+					return Compress(&exchange{UID: uid, Type: partition}, c)
+				}, map[string]chan Dataset{
+					nodes[0]: closedInput(NewDataset(data)),
+					nodes[1]: closedInput(),
+				})
+				require.NoError(b, errs[nodes[0]])
+			}
+			b.Logf("%d bytes on the wire per op", atomic.LoadInt64(&written)/int64(b.N))
+		})
+	}
+}
+
+// countingConn is a connection that counts the bytes written to it into n
+type countingConn struct {
+	net.Conn
+	n *int64
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+func TestExchange_Run_batching(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+
+	// 12 single-row datasets are sent in batches of 5, 5 and the remaining 2
+	data := []Dataset{}
+	expected := []string{}
+	for i := 0; i < 12; i++ {
+		v := fmt.Sprintf("%02d", i)
+		data = append(data, NewDataset(testStrs{v}))
+		expected = append(expected, v)
+	}
+
+	uid := Gather().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return BatchSize(&exchange{UID: uid, Type: gather}, 5)
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(),
+		nodes[1]: closedInput(data...),
+	})
+	require.NoError(t, errs[nodes[0]])
+	require.NoError(t, errs[nodes[1]])
+
+	lens := []int{}
+	res := []string{}
+	for _, data := range cluster.outs[nodes[0]] {
+		lens = append(lens, data.Len())
+		res = append(res, data.At(0).Strings()...)
+	}
+	require.Equal(t, []int{5, 5, 2}, lens)
+	require.Equal(t, expected, res)
+}
+
+func TestExchange_sendAll_batchLatency(t *testing.T) {
+	enc := &recordingEncoder{}
+	ex := newTestPartition(nil, enc)
+	ex.Type = broadcast
+	ex.BatchSize = 100
+
+	// the first two datasets wait no longer than the batching latency
+	inp := make(chan Dataset)
+	errs := make(chan error)
+	go func() {
+		errs <- ex.sendAll(make(chan struct{}), inp)
+	}()
+	inp <- NewDataset(testStrs{"a"})
+	inp <- NewDataset(testStrs{"b"})
+	time.Sleep(5 * batchLatency)
+	inp <- NewDataset(testStrs{"c"})
+	close(inp)
+	require.NoError(t, <-errs)
+
+	require.Equal(t, 3, len(enc.reqs))
+	require.Equal(t, []string{"a", "b"}, enc.reqs[0].Payload.(Dataset).At(0).Strings())
+	require.Equal(t, []string{"c"}, enc.reqs[1].Payload.(Dataset).At(0).Strings())
+	require.True(t, isEOS(enc.reqs[2]))
+}
+
+func TestExchange_sendAll_batchMixedTypes(t *testing.T) {
+	enc := &recordingEncoder{}
+	ex := newTestPartition(nil, enc)
+	ex.Type = broadcast
+	ex.BatchSize = 100
+
+	// datasets of different types are sent in separate batches
+	err := ex.sendAll(make(chan struct{}), closedInput(
+		NewDataset(testStrs{"a"}),
+		NewDataset(testStrs{"b"}),
+		NewDataset(Null.Data(2)),
+		NewDataset(testStrs{"c"}, testStrs{"d"}),
+	))
+	require.NoError(t, err)
+
+	require.Equal(t, 4, len(enc.reqs))
+	require.Equal(t, 2, enc.reqs[0].Payload.(Dataset).Len())
+	require.Equal(t, Null, enc.reqs[1].Payload.(Dataset).At(0).Type())
+	require.Equal(t, 2, enc.reqs[2].Payload.(Dataset).Width())
+	require.True(t, isEOS(enc.reqs[3]))
+}
+
+func TestExchange_sendAll_batchBytes(t *testing.T) {
+	enc := &recordingEncoder{}
+	ex := newTestPartition(nil, enc)
+	ex.Type = broadcast
+	BatchBytes(ex, 20)
+
+	// batches of at least 20 bytes, of 8 bytes per row
+	inp := []Dataset{}
+	for i := 0; i < 7; i++ {
+		inp = append(inp, NewDataset(&Int64s{Values: []int64{int64(i)}}))
+	}
+	err := ex.sendAll(make(chan struct{}), closedInput(inp...))
+	require.NoError(t, err)
+
+	require.Equal(t, 4, len(enc.reqs))
+	require.Equal(t, []string{"0", "1", "2"}, enc.reqs[0].Payload.(Dataset).At(0).Strings())
+	require.Equal(t, []string{"3", "4", "5"}, enc.reqs[1].Payload.(Dataset).At(0).Strings())
+	require.Equal(t, []string{"6"}, enc.reqs[2].Payload.(Dataset).At(0).Strings())
+	require.True(t, isEOS(enc.reqs[3]))
+
+	// whichever of the rows and bytes is reached first
+	enc.reqs = nil
+	ex.BatchSize = 2
+	err = ex.sendAll(make(chan struct{}), closedInput(inp[:3]...))
+	require.NoError(t, err)
+	require.Equal(t, 3, len(enc.reqs))
+	require.Equal(t, 2, enc.reqs[0].Payload.(Dataset).Len())
+}
+
+func TestExchange_Run_maxRows(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+
+	data := make(testStrs, 1000000)
+	for i := range data {
+		data[i] = strconv.Itoa(i)
+	}
+
+	uid := Gather().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return MaxRows(&exchange{UID: uid, Type: gather}, 4096)
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(),
+		nodes[1]: closedInput(NewDataset(data)),
+	})
+	require.NoError(t, errs[nodes[0]])
+	require.NoError(t, errs[nodes[1]])
+
+	res := testStrs{}
+	for _, data := range cluster.outs[nodes[0]] {
+		require.True(t, data.Len() <= 4096, "%d rows received", data.Len())
+		res = append(res, data.At(0).(testStrs)...)
+	}
+	require.Equal(t, data, res)
+}
+
+// isClosed reports whether the short-circuit was closed
+func isClosed(sc *shortCircuit) bool {
+	select {
+	case <-sc.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// pipeCluster connects exchanges within the same process, using in-memory
+// net.Pipe() connections instead of real network connections
+type pipeCluster struct {
+	sync.Mutex
+	pending map[string]net.Conn  // the other ends of connections not yet claimed
+	ctx     context.Context      // the context to run the nodes with
+	noReads bool                 // never read the outputs of the nodes
+	outs    map[string][]Dataset // the outputs of the nodes, when read
+
+	// wrap, when set, is used to wrap every connection end opened by from to
+	// the to node address
+	wrap func(from, to string, conn net.Conn) net.Conn
+}
+
+func newPipeCluster() *pipeCluster {
+	return &pipeCluster{
+		pending: map[string]net.Conn{},
+		ctx:     context.Background(),
+		outs:    map[string][]Dataset{},
+	}
+}
+
+// peer returns a distributer-like object for the provided node address
+func (c *pipeCluster) peer(addr string) *pipePeer {
+	return &pipePeer{c, addr}
+}
+
+// run runs a new runner (created by newRunner) on every one of the nodes
+// until completion, with the given inputs per node. Returns the errors
+// returned by every node
+func (c *pipeCluster) run(nodes []string, newRunner func() Runner, inps map[string]chan Dataset) map[string]error {
+	errs := map[string]error{}
+	var l sync.Mutex
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		ctx := context.WithValue(c.ctx, distributerKey, c.peer(node))
+		ctx = context.WithValue(ctx, allNodesKey, nodes)
+		ctx = context.WithValue(ctx, masterNodeKey, nodes[0])
+		ctx = context.WithValue(ctx, thisNodeKey, node)
+
+		out := make(chan Dataset)
+		if !c.noReads {
+			wg.Add(1)
+			go func(node string) {
+				defer wg.Done()
+				for data := range out {
+					l.Lock()
+					c.outs[node] = append(c.outs[node], data)
+					l.Unlock()
+				}
+			}(node)
+		}
+
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			defer close(out)
+			err := newRunner().Run(ctx, inps[node], out)
+
+			l.Lock()
+			defer l.Unlock()
+			errs[node] = err
+		}(node)
+	}
+	wg.Wait()
+	return errs
+}
+
+// runWithTimeout is similar to run, except that it fails the test if any of
+// the nodes didn't complete within a few seconds
+func (c *pipeCluster) runWithTimeout(t *testing.T, nodes []string, newRunner func() Runner, inps map[string]chan Dataset) map[string]error {
+	res := make(chan map[string]error, 1)
+	go func() {
+		res <- c.run(nodes, newRunner, inps)
+	}()
+
+	select {
+	case errs := <-res:
+		return errs
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "exchange didn't complete on all nodes")
+		return nil
+	}
+}
+
+// closedInput returns a closed input channel buffered with the datasets
+func closedInput(datasets ...Dataset) chan Dataset {
+	inp := make(chan Dataset, len(datasets))
+	for _, data := range datasets {
+		inp <- data
+	}
+	close(inp)
+	return inp
+}
+
+type pipePeer struct {
+	cluster *pipeCluster
+	addr    string
+}
+
+func (p *pipePeer) Connect(addr, uid string) (net.Conn, error) {
+	c := p.cluster
+	c.Lock()
+	defer c.Unlock()
+
+	// both sides of the connection resolve to the same key
+	key := p.addr + " " + addr + " " + uid
+	if addr < p.addr {
+		key = addr + " " + p.addr + " " + uid
+	}
+
+	conn, ok := c.pending[key]
+	if ok {
+		delete(c.pending, key)
+	} else {
+		conn, c.pending[key] = net.Pipe()
+	}
+
+	if c.wrap != nil {
+		conn = c.wrap(p.addr, addr, conn)
+	}
+	return conn, nil
+}
+
+// failingConn is a connection that fails all writes after WritesLeft writes,
+// and all reads after ReadsLeft reads. Negative values never fail
+type failingConn struct {
+	net.Conn
+	WritesLeft int
+	ReadsLeft  int
+	Err        error
+}
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	if c.WritesLeft == 0 {
+		return 0, c.Err
+	}
+	c.WritesLeft--
+	return c.Conn.Write(b)
+}
+
+func (c *failingConn) Read(b []byte) (int, error) {
+	if c.ReadsLeft == 0 {
+		return 0, c.Err
+	}
+	c.ReadsLeft--
+	return c.Conn.Read(b)
+}
+
+var _ = registerGob(testStrs{}, &testStrsType{})
+
+// testStrs is a minimal Data implementation of strings, used for testing
+// internals of the package with distinct values
+type testStrs []string
+
+type testStrsType struct{}
+
+func (t *testStrsType) String() string     { return t.Name() }
+func (*testStrsType) Name() string         { return "testStrs" }
+func (*testStrsType) Data(n int) Data      { return make(testStrs, n) }
+func (*testStrsType) DataEmpty(n int) Data { return make(testStrs, 0, n) }
+
+func (testStrs) Type() Type            { return &testStrsType{} }
+func (vs testStrs) Len() int           { return len(vs) }
+func (vs testStrs) Less(i, j int) bool { return vs[i] < vs[j] }
+func (vs testStrs) Swap(i, j int)      { vs[i], vs[j] = vs[j], vs[i] }
+func (vs testStrs) LessOther(i int, other Data, j int) bool {
+	return vs[i] < other.(testStrs)[j]
+}
+func (vs testStrs) Slice(s, e int) Data      { return vs[s:e] }
+func (vs testStrs) Append(other Data) Data   { return append(vs, other.(testStrs)...) }
+func (vs testStrs) Duplicate(t int) Data     { panic("not implemented") }
+func (vs testStrs) IsNull(int) bool          { return false }
+func (vs testStrs) MarkNull(int)             {}
+func (vs testStrs) Nulls() []bool            { return make([]bool, len(vs)) }
+func (vs testStrs) Equal(other Data) bool    { return false }
+func (vs testStrs) Copy(from Data, i, j int) { vs[j] = from.(testStrs)[i] }
+func (vs testStrs) Strings() []string        { return vs }
+
+func TestRateLimit_sharedByAllConnections(t *testing.T) {
+	var l sync.Mutex
+	var clock time.Time
+	var slept time.Duration
+	lim := newByteLimiter(1024)
+	lim.last = clock
+	lim.now = func() time.Time {
+		l.Lock()
+		defer l.Unlock()
+		return clock
+	}
+	lim.sleep = func(d time.Duration) {
+		l.Lock()
+		defer l.Unlock()
+		clock = clock.Add(d)
+		slept += d
+	}
+
+	// 10KB over two connections at 1KB/s, of which the first KB is the burst
+	payload := make([]byte, 5*1024)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	for i := 0; i < 2; i++ {
+		w, r := net.Pipe()
+		received := make(chan []byte)
+		go func() {
+			b, _ := ioutil.ReadAll(r)
+			received <- b
+		}()
+
+		conn := &throttledConn{w, lim}
+		for off := 0; off < len(payload); off += 700 {
+			end := off + 700
+			if end > len(payload) {
+				end = len(payload)
+			}
+			n, err := conn.Write(payload[off:end])
+			require.NoError(t, err)
+			require.Equal(t, end-off, n)
+		}
+		require.NoError(t, w.Close())
+		require.Equal(t, payload, <-received)
+	}
+
+	require.Equal(t, 9*time.Second, slept.Round(time.Millisecond))
+}
+
+func TestRateLimit_splitsLargeWrites(t *testing.T) {
+	lim := newByteLimiter(100)
+	var writes []int
+	lim.sleep = func(time.Duration) {}
+	w, r := net.Pipe()
+	go ioutil.ReadAll(r)
+	defer w.Close()
+
+	conn := &throttledConn{&recordingConn{w, &writes}, lim}
+	n, err := conn.Write(make([]byte, 250))
+	require.NoError(t, err)
+	require.Equal(t, 250, n)
+	require.Equal(t, []int{100, 100, 50}, writes)
+}
+
+func TestRateLimit_exchange(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+
+	strs := make(testStrs, 1000)
+	for i := range strs {
+		strs[i] = fmt.Sprintf("%05d", i)
+	}
+
+	const rate = 4 * 1024
+	var l sync.Mutex
+	runners := []Runner{}
+	uid := Gather().(*exchange).UID
+	start := time.Now()
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		l.Lock()
+		defer l.Unlock()
+		r := RateLimit(&exchange{UID: uid, Type: gather}, rate)
+		runners = append(runners, r)
+		return r
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(),
+		nodes[1]: closedInput(NewDataset(strs)),
+	})
+	elapsed := time.Since(start)
+	require.NoError(t, errs[nodes[0]])
+	require.NoError(t, errs[nodes[1]])
+
+	var sent, received int64
+	for _, r := range runners {
+		for _, st := range Stats(r) {
+			sent += st.BytesSent
+			received += st.RowsReceived
+		}
+	}
+
+	// the first second's worth of bytes is the burst
+	require.Equal(t, int64(len(strs)), received)
+	require.True(t, sent > rate, "sent only %d bytes", sent)
+	expected := time.Duration(float64(sent-rate) / rate * float64(time.Second))
+	require.True(t, elapsed >= expected*9/10, "%s elapsed, expected %s", elapsed, expected)
+}
+
+// recordingConn records the sizes of the writes to its connection
+type recordingConn struct {
+	net.Conn
+	writes *[]int
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	*c.writes = append(*c.writes, len(b))
+	return c.Conn.Write(b)
+}
+
+func TestSpillQueue(t *testing.T) {
+	dir := setSpillDir(t)
+	defer dir.restore()
+
+	q := newSpillQueue(2)
+	for i := 0; i < 6; i++ {
+		require.NoError(t, q.push(NewDataset(testStrs{strconv.Itoa(i)})))
+	}
+	require.Equal(t, 4, q.spills)
+	require.Equal(t, 1, dir.files(t))
+
+	done := make(chan struct{})
+	for i := 0; i < 6; i++ {
+		data, err := q.pop(done)
+		require.NoError(t, err)
+		require.Equal(t, []string{strconv.Itoa(i)}, data.At(0).Strings())
+
+		// pushed after some of the datasets are spilled, thus spilled as well
+		if i == 2 {
+			require.NoError(t, q.push(NewDataset(testStrs{"6"})))
+		}
+	}
+
+	data, err := q.pop(done)
+	require.NoError(t, err)
+	require.Equal(t, []string{"6"}, data.At(0).Strings())
+	require.Equal(t, 0, dir.files(t))
+
+	// drained, thus back in memory
+	require.NoError(t, q.push(NewDataset(testStrs{"7"})))
+	require.Equal(t, 5, q.spills)
+
+	q.closeInput()
+	data, err = q.pop(done)
+	require.NoError(t, err)
+	require.Equal(t, []string{"7"}, data.At(0).Strings())
+
+	_, err = q.pop(done)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestSpillQueue_remove(t *testing.T) {
+	dir := setSpillDir(t)
+	defer dir.restore()
+
+	q := newSpillQueue(1)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, q.push(NewDataset(testStrs{strconv.Itoa(i)})))
+	}
+	require.Equal(t, 1, dir.files(t))
+
+	done := make(chan struct{})
+	q.remove()
+	require.Equal(t, 0, dir.files(t))
+
+	// discarded
+	require.NoError(t, q.push(NewDataset(testStrs{"3"})))
+	_, err := q.pop(done)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 0, dir.files(t))
+}
+
+func TestSpill_slowConsumer(t *testing.T) {
+	dir := setSpillDir(t)
+	defer dir.restore()
+
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+
+	var expected []string
+	var datasets []Dataset
+	for i := 0; i < 30; i++ {
+		expected = append(expected, strconv.Itoa(i))
+		datasets = append(datasets, NewDataset(testStrs{strconv.Itoa(i)}))
+	}
+
+	var l sync.Mutex
+	var exchanges []*exchange
+	uid := Gather().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		l.Lock()
+		defer l.Unlock()
+		ex := Spill(&exchange{UID: uid, Type: gather}, 3).(*exchange)
+		exchanges = append(exchanges, ex)
+		return &slowConsumer{ex, 2 * time.Millisecond}
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(),
+		nodes[1]: closedInput(datasets...),
+	})
+	require.NoError(t, errs[nodes[0]])
+	require.NoError(t, errs[nodes[1]])
+
+	var received []string
+	for _, data := range cluster.outs[nodes[0]] {
+		received = append(received, data.At(0).Strings()...)
+	}
+	require.Equal(t, expected, received)
+	require.True(t, exchanges[0].spill.spills+exchanges[1].spill.spills > 0)
+	require.Equal(t, 0, dir.files(t))
+}
+
+func TestSpill_removedUponError(t *testing.T) {
+	dir := setSpillDir(t)
+	defer dir.restore()
+
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+
+	// the connection from the peer fails after enough datasets were received
+	// to be spilled
+	cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+		if from != nodes[0] {
+			return conn
+		}
+		return &failingConn{conn, -1, 40, fmt.Errorf("bad connection")}
+	}
+
+	var datasets []Dataset
+	for i := 0; i < 100; i++ {
+		datasets = append(datasets, NewDataset(testStrs{strconv.Itoa(i)}))
+	}
+
+	var l sync.Mutex
+	var exchanges []*exchange
+	uid := Gather().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		l.Lock()
+		defer l.Unlock()
+		ex := Spill(&exchange{UID: uid, Type: gather}, 1).(*exchange)
+		exchanges = append(exchanges, ex)
+		return &slowConsumer{ex, 10 * time.Millisecond}
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(),
+		nodes[1]: closedInput(datasets...),
+	})
+	require.Error(t, errs[nodes[0]])
+	require.True(t, exchanges[0].spill.spills+exchanges[1].spill.spills > 0)
+	require.Equal(t, 0, dir.files(t))
+}
+
+// slowConsumer runs an exchange, and reads its output with a delay before
+// every dataset
+type slowConsumer struct {
+	Runner
+	delay time.Duration
+}
+
+func (r *slowConsumer) Run(ctx context.Context, inp, out chan Dataset) error {
+	exOut := make(chan Dataset)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(exOut)
+		errs <- r.Runner.Run(ctx, inp, exOut)
+	}()
+
+	for data := range exOut {
+		time.Sleep(r.delay)
+		out <- data
+	}
+	return <-errs
+}
+
+type testSpillDir struct {
+	path string
+	prev string
+}
+
+// setSpillDir sets the spill files directory to a new temporary directory
+func setSpillDir(t *testing.T) *testSpillDir {
+	path, err := ioutil.TempDir("", "ep-spill-test")
+	require.NoError(t, err)
+
+	dir := &testSpillDir{path, spillDir}
+	spillDir = path
+	return dir
+}
+
+// files returns the number of spill files in the directory
+func (dir *testSpillDir) files(t *testing.T) int {
+	infos, err := ioutil.ReadDir(dir.path)
+	require.NoError(t, err)
+	return len(infos)
+}
+
+func (dir *testSpillDir) restore() {
+	spillDir = dir.prev
+	os.RemoveAll(dir.path)
+}
+
+func TestBroadcastDistinct(t *testing.T) {
+	nodes := []string{":5551", ":5552", ":5553"}
+	cluster := newPipeCluster()
+
+	// every node broadcasts the same lookup table, along with its own data
+	lookup := func() Dataset { return NewDataset(testStrs{"a", "b"}, testStrs{"1", "2"}) }
+	uid := BroadcastDistinct().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: broadcast, Distinct: true}
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(lookup(), NewDataset(testStrs{"x"}, testStrs{"0"})),
+		nodes[1]: closedInput(lookup(), NewDataset(testStrs{"y"}, testStrs{"1"})),
+		nodes[2]: closedInput(NewDataset(testStrs{"z"}, testStrs{"2"}), lookup()),
+	})
+
+	for _, node := range nodes {
+		require.NoError(t, errs[node])
+
+		var received []string
+		for _, data := range cluster.outs[node] {
+			received = append(received, strings.Join(data.At(0).Strings(), ","))
+		}
+		sort.Strings(received)
+		require.Equal(t, []string{"a,b", "x", "y", "z"}, received, node)
+	}
+}
+
+func TestExchange_isDuplicate(t *testing.T) {
+	ex := &exchange{Distinct: true}
+	require.False(t, ex.isDuplicate(NewDataset(testStrs{"ab", "c"})))
+	require.True(t, ex.isDuplicate(NewDataset(testStrs{"ab", "c"})))
+
+	// same values, split differently between rows or columns
+	require.False(t, ex.isDuplicate(NewDataset(testStrs{"a", "bc"})))
+	require.False(t, ex.isDuplicate(NewDataset(testStrs{"ab"}, testStrs{"c"})))
+	require.False(t, ex.isDuplicate(NewDataset(testStrs{"abc"})))
+
+	// same values of different types
+	require.False(t, ex.isDuplicate(NewDataset(Null.Data(2))))
+	require.True(t, ex.isDuplicate(NewDataset(Null.Data(2))))
+	require.False(t, ex.isDuplicate(NewDataset(Null.Data(3))))
+	require.False(t, ex.isDuplicate(NewDataset()))
+	require.True(t, ex.isDuplicate(NewDataset()))
+}
+
+func TestGatherLimit(t *testing.T) {
+	nodes := []string{":5551", ":5552", ":5553"}
+	cluster := newPipeCluster()
+
+	// every node produces far more than the limit, and it's all consumed even
+	// though most of it is never sent
+	var produced sync.WaitGroup
+	inps := map[string]chan Dataset{}
+	for _, node := range nodes {
+		inp := make(chan Dataset)
+		inps[node] = inp
+		produced.Add(1)
+		go func() {
+			defer produced.Done()
+			defer close(inp)
+			for i := 0; i < 100; i++ {
+				inp <- NewDataset(make(testStrs, 10))
+			}
+		}()
+	}
+
+	var l sync.Mutex
+	var exchanges []*exchange
+	uid := GatherLimit(25).(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		l.Lock()
+		defer l.Unlock()
+		ex := &exchange{UID: uid, Type: gather, Limit: 25}
+		exchanges = append(exchanges, ex)
+		return ex
+	}, inps)
+	produced.Wait()
+
+	var rows int
+	for _, node := range nodes {
+		require.NoError(t, errs[node])
+		for _, data := range cluster.outs[node] {
+			rows += data.Len()
+		}
+	}
+	require.Equal(t, 25, rows)
+
+	// the limit was reached after 3 datasets. By then, the remote senders
+	// might have encoded a couple of additional batches before seeing the
+	// stop, beyond the ones read ahead into the receive queue (the local one
+	// is buffered in memory, thus it's unbounded)
+	for _, ex := range exchanges {
+		for addr, st := range Stats(ex) {
+			if addr == ex.thisNode {
+				continue
+			}
+			max := int64(5 + receiveQueueSize)
+			require.True(t, st.BatchesSent <= max, "%s sent %d batches to %s", ex.thisNode, st.BatchesSent, addr)
+		}
+	}
+}
+
+func TestGatherLimit_codec(t *testing.T) {
+	defer SetExchangeCodec(GobCodec)
+	for _, c := range []Codec{GobCodec, RawCodec, ArrowCodec} {
+		SetExchangeCodec(c)
+		var buf bytes.Buffer
+		require.NoError(t, newEncoder(&buf).Encode(&req{&stopSending{":5551"}}))
+
+		req := &req{}
+		require.NoError(t, newDecoder(&buf).Decode(req))
+		require.Equal(t, &stopSending{":5551"}, req.Payload)
+	}
+}
+
+func TestAllGather(t *testing.T) {
+	nodes := []string{":5551", ":5552", ":5553", ":5554"}
+	cluster := newPipeCluster()
+
+	inps := map[string]chan Dataset{}
+	for i, node := range nodes {
+		var datasets []Dataset
+		for j := 0; j <= i; j++ {
+			datasets = append(datasets, NewDataset(testStrs{node, strconv.Itoa(j)}))
+		}
+		inps[node] = closedInput(datasets...)
+	}
+
+	uid := AllGather().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: allGather}
+	}, inps)
+
+	// 1 + 2 + 3 + 4 datasets of 2 rows, on every node
+	for _, node := range nodes {
+		require.NoError(t, errs[node])
+
+		var rows int
+		received := map[string]int{}
+		for _, data := range cluster.outs[node] {
+			rows += data.Len()
+			received[data.At(0).Strings()[0]]++
+		}
+		require.Equal(t, 20, rows, node)
+		require.Equal(t, map[string]int{":5551": 1, ":5552": 2, ":5553": 3, ":5554": 4}, received, node)
+	}
+}
+
+func TestGatherTo(t *testing.T) {
+	nodes := []string{":5551", ":5552", ":5553"}
+	cluster := newPipeCluster()
+
+	inps := map[string]chan Dataset{}
+	for _, node := range nodes {
+		inps[node] = closedInput(NewDataset(testStrs{node}))
+	}
+
+	uid := GatherTo(nodes[2]).(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: gather, Target: nodes[2]}
+	}, inps)
+
+	// the output appears only on the target node, not on the main node
+	for _, node := range nodes {
+		require.NoError(t, errs[node])
+	}
+	require.Equal(t, 0, len(cluster.outs[nodes[0]]))
+	require.Equal(t, 0, len(cluster.outs[nodes[1]]))
+
+	received := []string{}
+	for _, data := range cluster.outs[nodes[2]] {
+		received = append(received, data.At(0).Strings()...)
+	}
+	require.ElementsMatch(t, nodes, received)
+
+	// the target must be one of the nodes
+	cluster = newPipeCluster()
+	uid = GatherTo(":5554").(*exchange).UID
+	errs = cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: gather, Target: ":5554"}
+	}, map[string]chan Dataset{})
+	for _, node := range nodes {
+		require.Error(t, errs[node])
+		require.Equal(t, "ep: gather target :5554 isn't one of the nodes [:5551 :5552 :5553]", errs[node].Error())
+	}
+}
+
+func TestPartition_coPartitioned(t *testing.T) {
+	nodes := []string{":5551", ":5552", ":5553"}
+	tests := []struct {
+		partitioned []int // the columns of PartitionedBy, the first one by default
+		cols        []int // the columns of the partition exchange
+		elided      bool
+	}{
+		{[]int{0}, nil, true},
+		{nil, []int{0}, true},
+		{[]int{1, 0}, []int{1, 0}, true},
+		{[]int{0, 1}, []int{1, 0}, false},
+		{[]int{1}, []int{0}, false},
+		{[]int{0}, []int{0, 1}, false},
+	}
+	for _, test := range tests {
+		cluster := newPipeCluster()
+		cluster.ctx = PartitionedBy(context.Background(), test.partitioned...)
+
+		var connects int64
+		cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+			atomic.AddInt64(&connects, 1)
+			return conn
+		}
+
+		inps := map[string]chan Dataset{}
+		for _, node := range nodes {
+			inps[node] = closedInput(NewDataset(testStrs{node}, testStrs{node}))
+		}
+
+		uid := Partition(test.cols...).(*exchange).UID
+		errs := cluster.runWithTimeout(t, nodes, func() Runner {
+			return &exchange{UID: uid, Type: partition, PartitionCols: test.cols}
+		}, inps)
+
+		var rows int
+		for _, node := range nodes {
+			require.NoError(t, errs[node])
+			for _, data := range cluster.outs[node] {
+				rows += data.Len()
+				if test.elided {
+					// every node keeps its own input
+					require.Equal(t, []string{node}, data.At(0).Strings())
+				}
+			}
+		}
+		require.Equal(t, 3, rows)
+
+		if test.elided {
+			require.Equal(t, int64(0), atomic.LoadInt64(&connects), "%v", test)
+		} else {
+			require.NotEqual(t, int64(0), atomic.LoadInt64(&connects), "%v", test)
+		}
+	}
+
+	// custom partitioners might route the rows differently
+	ex := &exchange{Type: partition, Partitioner: moduloPartitioner{}}
+	require.False(t, ex.coPartitioned(PartitionedBy(context.Background(), 0)))
+	require.False(t, Partition(0).(*exchange).coPartitioned(context.Background()))
+}
+
+func TestGather_connectionsByRole(t *testing.T) {
+	nodes := []string{":5551", ":5552", ":5553"}
+	for _, typ := range []exchangeType{gather, sortGather, orderedGather, broadcast} {
+		cluster := newPipeCluster()
+
+		var l sync.Mutex
+		connects := map[string][]string{} // the nodes connected from every node
+		cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+			l.Lock()
+			defer l.Unlock()
+			connects[from] = append(connects[from], to)
+			return conn
+		}
+
+		var exchanges []*exchange
+		uid := Gather().(*exchange).UID
+		errs := cluster.runWithTimeout(t, nodes, func() Runner {
+			l.Lock()
+			defer l.Unlock()
+			ex := &exchange{UID: uid, Type: typ}
+			exchanges = append(exchanges, ex)
+			return ex
+		}, map[string]chan Dataset{
+			nodes[0]: closedInput(NewDataset(testStrs{"a"})),
+			nodes[1]: closedInput(NewDataset(testStrs{"b"})),
+			nodes[2]: closedInput(NewDataset(testStrs{"c"})),
+		})
+
+		for _, node := range nodes {
+			require.NoError(t, errs[node])
+			sort.Strings(connects[node])
+		}
+
+		if typ == broadcast {
+			// every node sends to, and receives from, every other node over a
+			// single connection
+			require.Equal(t, []string{":5552", ":5553"}, connects[nodes[0]])
+			require.Equal(t, []string{":5551", ":5553"}, connects[nodes[1]])
+			require.Equal(t, []string{":5551", ":5552"}, connects[nodes[2]])
+			continue
+		}
+
+		// the main node only receives from the others, which only send to it
+		require.Equal(t, []string{":5552", ":5553"}, connects[nodes[0]], typ)
+		require.Equal(t, []string{":5551"}, connects[nodes[1]], typ)
+		require.Equal(t, []string{":5551"}, connects[nodes[2]], typ)
+		for _, ex := range exchanges {
+			require.Equal(t, 1, len(ex.encs), typ)
+		}
+		require.Equal(t, 3, len(cluster.outs[nodes[0]]), typ)
+		require.Equal(t, 0, len(cluster.outs[nodes[1]]), typ)
+		require.Equal(t, 0, len(cluster.outs[nodes[2]]), typ)
+	}
+}
+
+func TestExchange_Run_missingNodes(t *testing.T) {
+	cluster := newPipeCluster()
+	ctx := context.WithValue(context.Background(), distributerKey, cluster.peer(":5551"))
+	ctx = context.WithValue(ctx, allNodesKey, []string{":5551"})
+	ctx = context.WithValue(ctx, masterNodeKey, ":5551")
+
+	out := make(chan Dataset, 1)
+	err := Gather().Run(ctx, closedInput(), out)
+	require.EqualError(t, err, "ep: context missing ThisNode")
+
+	ctx = context.WithValue(ctx, thisNodeKey, 5551)
+	err = Gather().Run(ctx, closedInput(), out)
+	require.EqualError(t, err, "ep: context ThisNode is int, expected string")
+}
+
+func TestBestEffort_deadPeer(t *testing.T) {
+	nodes := []string{":5551", ":5552", ":5553"}
+	for _, bestEffort := range []bool{true, false} {
+		cluster := newPipeCluster()
+
+		// all of the connections to and from the last node fail after the
+		// handshake, which is written at once and read in 2 parts
+		cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+			if from != nodes[2] && to != nodes[2] {
+				return conn
+			}
+			return &failingConn{conn, 1, 2, fmt.Errorf("node is down")}
+		}
+
+		var l sync.Mutex
+		var exchanges []*exchange
+		uid := Broadcast().(*exchange).UID
+		errs := cluster.runWithTimeout(t, nodes, func() Runner {
+			l.Lock()
+			defer l.Unlock()
+			ex := &exchange{UID: uid, Type: broadcast, BestEffort: bestEffort}
+			exchanges = append(exchanges, ex)
+			return ex
+		}, map[string]chan Dataset{
+			nodes[0]: closedInput(NewDataset(testStrs{"a"})),
+			nodes[1]: closedInput(NewDataset(testStrs{"b"})),
+			nodes[2]: closedInput(NewDataset(testStrs{"c"})),
+		})
+
+		if !bestEffort {
+			// strict by default
+			require.Error(t, errs[nodes[0]])
+			require.Error(t, errs[nodes[1]])
+			continue
+		}
+
+		// the dead node lost all of its peers
+		require.Error(t, errs[nodes[2]])
+		require.Contains(t, errs[nodes[2]].Error(), "node is down")
+
+		for _, node := range nodes[:2] {
+			require.NoError(t, errs[node])
+
+			var received []string
+			for _, data := range cluster.outs[node] {
+				received = append(received, data.At(0).Strings()...)
+			}
+			sort.Strings(received)
+			require.Equal(t, []string{"a", "b"}, received, node)
+		}
+
+		for _, ex := range exchanges {
+			if ex.thisNode == nodes[2] {
+				continue
+			}
+
+			skipped := SkippedPeers(ex)
+			require.Equal(t, 1, len(skipped), ex.thisNode)
+			require.Contains(t, skipped[nodes[2]].Error(), "node is down")
+		}
+	}
+}
+
+func TestBestEffort_allPeersDead(t *testing.T) {
+	nodes := []string{":5551", ":5552", ":5553"}
+	cluster := newPipeCluster()
+	cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+		return &failingConn{conn, 1, 2, fmt.Errorf("network is down")}
+	}
+
+	uid := Broadcast().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return BestEffort(&exchange{UID: uid, Type: broadcast})
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(NewDataset(testStrs{"a"})),
+		nodes[1]: closedInput(NewDataset(testStrs{"b"})),
+		nodes[2]: closedInput(NewDataset(testStrs{"c"})),
+	})
+
+	for _, node := range nodes {
+		require.Error(t, errs[node], node)
+		require.Contains(t, errs[node].Error(), "network is down", node)
+	}
+}
+
+func TestBestEffort_broadcastOnly(t *testing.T) {
+	require.Panics(t, func() { BestEffort(Scatter()) })
+	require.Panics(t, func() { BestEffort(Gather()) })
+	require.NotPanics(t, func() { BestEffort(AllGather()) })
+}
+
+func TestChecksum_roundTrip(t *testing.T) {
+	defer SetExchangeCodec(GobCodec)
+	for _, codec := range []Codec{GobCodec, RawCodec, ArrowCodec} {
+		for _, c := range []Compression{NoCompression, Gzip} {
+			SetExchangeCodec(codec)
+			var buf bytes.Buffer
+			enc := newEncoder(compressWriter(&buf, c, checksumsFlag))
+			require.NoError(t, enc.Encode(&req{NewDataset(Null.Data(3))}))
+			require.NoError(t, enc.Encode(&req{&endOfStream{":5551"}}))
+
+			dec := newDecoder(decompressReader(&buf))
+			req := &req{}
+			require.NoError(t, dec.Decode(req))
+			require.Equal(t, 3, req.Payload.(Dataset).Len())
+			require.NoError(t, dec.Decode(req))
+			require.Equal(t, &endOfStream{":5551"}, req.Payload)
+		}
+	}
+}
+
+func TestChecksum_corruption(t *testing.T) {
+	nodes := []string{":5551", ":5552"}
+	for _, c := range []Compression{NoCompression, Gzip} {
+		cluster := newPipeCluster()
+
+		// a single bit is flipped in the stream from the peer to the master
+		cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+			if from == nodes[1] {
+				return &manglingConn{Conn: conn, at: 3}
+			}
+			return conn
+		}
+
+		var datasets []Dataset
+		for i := 0; i < 10; i++ {
+			datasets = append(datasets, NewDataset(testStrs{"hello", "world"}))
+		}
+
+		uid := Gather().(*exchange).UID
+		errs := cluster.runWithTimeout(t, nodes, func() Runner {
+			return Compress(Checksum(&exchange{UID: uid, Type: gather}), c)
+		}, map[string]chan Dataset{
+			nodes[0]: closedInput(),
+			nodes[1]: closedInput(datasets...),
+		})
+
+		require.Error(t, errs[nodes[0]])
+		require.Equal(t, "ep: checksum mismatch from :5552", errs[nodes[0]].Error())
+	}
+}
+
+func TestChecksumReader_sticky(t *testing.T) {
+	var buf bytes.Buffer
+	cw := &checksumWriter{&buf}
+	_, err := cw.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = cw.Write([]byte("world"))
+	require.NoError(t, err)
+
+	b := buf.Bytes()
+	b[len(b)-1] ^= 1
+
+	cr := &checksumReader{r: &buf}
+	res, err := ioutil.ReadAll(cr)
+	require.Equal(t, errChecksumMismatch, err)
+	require.Equal(t, "hello", string(res)) // the verified frames only
+
+	_, err = cr.Read(make([]byte, 10))
+	require.Equal(t, errChecksumMismatch, err)
+}
+
+// manglingConn is a connection that flips a bit in the last byte of its at-th
+// write, or the first write after it that's longer than a frame header
+type manglingConn struct {
+	net.Conn
+	at      int
+	writes  int
+	mangled bool
+}
+
+func (c *manglingConn) Write(b []byte) (int, error) {
+	c.writes++
+	if !c.mangled && c.writes >= c.at && len(b) > 8 {
+		c.mangled = true
+		b = append([]byte{}, b...)
+		b[len(b)-1] ^= 1
+	}
+	return c.Conn.Write(b)
+}
+
+func TestHandshake_versions(t *testing.T) {
+	legacyStream := func(w io.Writer) error {
+		enc := newEncoder(compressWriter(w, NoCompression, 0))
+		return enc.Encode(&req{&endOfStream{":5552"}})
+	}
+
+	tests := map[string]func(io.Writer) error{
+		"": func(w io.Writer) error { return writeHello(w, protocolVersion, supportedFeatures) },
+		"ep: peer :5552 speaks protocol v3, we require v2": func(w io.Writer) error { return writeHello(w, 3, supportedFeatures) },
+		"ep: peer :5552 speaks protocol v1, we require v2": legacyStream,
+	}
+	for expected, peer := range tests {
+		conn, other := net.Pipe()
+		go io.Copy(ioutil.Discard, other)
+		go peer(other)
+
+		err := Gather().(*exchange).handshake(conn, ":5552")
+		if expected == "" {
+			require.NoError(t, err)
+		} else {
+			require.Error(t, err)
+			require.Equal(t, expected, err.Error())
+		}
+
+		conn.Close()
+		other.Close()
+	}
+}
+
+func TestHandshake_features(t *testing.T) {
+	for _, checksums := range []bool{false, true} {
+		conn, other := net.Pipe()
+		go io.Copy(ioutil.Discard, other)
+		go writeHello(other, protocolVersion, supportedFeatures&^featureChecksums)
+
+		ex := Gather()
+		if checksums {
+			ex = Checksum(ex)
+		}
+
+		// only the features used by the exchange are required
+		err := ex.(*exchange).handshake(conn, ":5552")
+		if checksums {
+			require.Error(t, err)
+			require.Equal(t, "ep: peer :5552 doesn't support checksums", err.Error())
+		} else {
+			require.NoError(t, err)
+		}
+
+		conn.Close()
+		other.Close()
+	}
+}
+
+func TestHandshake_mutePeer(t *testing.T) {
+	defer func(timeout time.Duration) { handshakeTimeout = timeout }(handshakeTimeout)
+	handshakeTimeout = 10 * time.Millisecond
+
+	// a legacy peer that only reads the connection never writes anything
+	conn, other := net.Pipe()
+	defer conn.Close()
+	defer other.Close()
+	go io.Copy(ioutil.Discard, other)
+
+	err := Gather().(*exchange).handshake(conn, ":5552")
+	require.Error(t, err)
+	require.Equal(t, "ep: handshake with :5552 timed out, it might speak protocol v1", err.Error())
+}
+
+func TestLegacyProtocol(t *testing.T) {
+	SetLegacyProtocol(true)
+	defer SetLegacyProtocol(false)
+
+	nodes := []string{":5551", ":5552"}
+	cluster := newPipeCluster()
+	written := make(chan byte, 2)
+	cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+		return &firstByteConn{Conn: conn, first: written}
+	}
+
+	uid := Gather().(*exchange).UID
+	errs := cluster.runWithTimeout(t, nodes, func() Runner {
+		return &exchange{UID: uid, Type: gather}
+	}, map[string]chan Dataset{
+		nodes[0]: closedInput(NewDataset(testStrs{"a"})),
+		nodes[1]: closedInput(NewDataset(testStrs{"b"})),
+	})
+	require.NoError(t, errs[nodes[0]])
+	require.NoError(t, errs[nodes[1]])
+	require.Equal(t, 2, len(cluster.outs[nodes[0]]))
+
+	// the stream starts right away with its header
+	require.Equal(t, byte(NoCompression), <-written)
+
+	// peers speaking the current protocol are detected by their handshake
+	var buf bytes.Buffer
+	require.NoError(t, writeHello(&buf, protocolVersion, supportedFeatures))
+	_, err := decompressReader(&buf).Read(make([]byte, 1))
+	require.Error(t, err)
+	require.Equal(t, "ep: unexpected handshake, the peer speaks protocol v2 while v1 is set", err.Error())
+}
+
+// firstByteConn is a connection that reports the first byte written to it
+type firstByteConn struct {
+	net.Conn
+	first   chan<- byte
+	written bool
+}
+
+func (c *firstByteConn) Write(b []byte) (int, error) {
+	if !c.written && len(b) > 0 {
+		c.written = true
+		c.first <- b[0]
+	}
+	return c.Conn.Write(b)
+}
+
+// Measures the sending side of a scatter of narrow datasets to two peers,
+// whose connections discard everything, with and without checksums
+func BenchmarkScatterSend(b *testing.B) {
+	for _, flags := range []byte{0, checksumsFlag} {
+		b.Run(fmt.Sprintf("flags %x", flags), func(b *testing.B) {
+			data := NewDataset(make(testStrs, 10))
+			ex := &exchange{Type: scatter, encsByKey: map[string]encoder{}}
+			ex.queueFailed = make(chan struct{}, 2)
+			for _, addr := range []string{":5552", ":5553"} {
+				conn := &statsConn{discardConn{}, ex.peerStats(addr)}
+				enc := &statsEncoder{newEncoder(compressWriter(conn, NoCompression, flags)), ex.peerStats(addr)}
+				q := newQueuedEncoder(enc, ex.queueFailed, 0)
+				ex.encs = append(ex.encs, q)
+				ex.encsByKey[addr] = q
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, ex.send(data))
+			}
+			require.NoError(b, ex.flushQueues())
+		})
+	}
+}
+
+// discardConn is a connection that discards all writes
+type discardConn struct{ net.Conn }
+
+func (discardConn) Write(b []byte) (int, error) { return len(b), nil }
+
+// Measures the receiving side of a gather of narrow datasets from a peer
+func BenchmarkGatherReceive(b *testing.B) {
+	defer SetExchangeCodec(GobCodec)
+	for _, codec := range []Codec{GobCodec, RawCodec, ArrowCodec} {
+		b.Run(fmt.Sprintf("%T", codec), func(b *testing.B) {
+			SetExchangeCodec(codec)
+			data := NewDataset(Null.Data(10), Null.Data(10))
+			var buf bytes.Buffer
+			enc := newEncoder(compressWriter(&buf, NoCompression, 0))
+			for i := 0; i < 10000; i++ {
+				require.NoError(b, enc.Encode(&req{data}))
+			}
+			require.NoError(b, enc.Encode(&req{&endOfStream{":5552"}}))
+			stream := buf.Bytes()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				dec := dbgDecoder{newDecoder(decompressReader(bytes.NewReader(stream))), "", ":5552"}
+				ex := &exchange{Type: gather, decs: []decoder{dec}}
+				for {
+					_, err := ex.receive()
+					if err == io.EOF {
+						break
+					}
+					require.NoError(b, err)
+				}
+			}
+		})
+	}
+}
+
+// Measures receiving as many batches as sent by two fast senders, along with a
+// slow sender, which sleeps before every one of its batches
+func BenchmarkReceive_slowSender(b *testing.B) {
+	for _, roundRobin := range []bool{false, true} {
+		b.Run(fmt.Sprintf("roundRobin=%v", roundRobin), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				vals := make([]string, 100)
+				for j := range vals {
+					vals[j] = fmt.Sprintf("%d", j)
+				}
+
+				slow := &sleepingDecoder{newScriptedDecoder(vals...), 100 * time.Microsecond}
+				ex := &exchange{RoundRobin: roundRobin, decs: []decoder{
+					newScriptedDecoder(vals...),
+					slow,
+					newScriptedDecoder(vals...),
+				}}
+
+				// as many batches as sent by the fast senders
+				for j := 0; j < 2*len(vals); j++ {
+					_, err := ex.decodeNext()
+					require.NoError(b, err)
+				}
+				ex.Close()
+			}
+		})
+	}
+}
+
+// sleepingDecoder is a decoder that sleeps before every decode
+type sleepingDecoder struct {
+	decoder
+	d time.Duration
+}
+
+func (dec *sleepingDecoder) Decode(e interface{}) error {
+	time.Sleep(dec.d)
+	return dec.decoder.Decode(e)
+}
+
+func TestExchange_shutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	peer, err := ln.Accept()
+	require.NoError(t, err)
+	defer peer.Close()
+
+	// wrapped like all of the connections of exchanges
+	wrapped := &statsConn{&deadlineConn{Conn: conn}, &peerStats{}}
+	ex := &exchange{conns: []io.Closer{newShortCircuit(), wrapped}}
+
+	_, err = wrapped.Write([]byte("tail"))
+	require.NoError(t, err)
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- ex.shutdown() }()
+
+	// the peer reads the tail, followed by the end of the stream, while the
+	// connection is still open
+	tail, err := ioutil.ReadAll(peer)
+	require.NoError(t, err)
+	require.Equal(t, "tail", string(tail))
+
+	select {
+	case err = <-shutdown:
+		t.Fatalf("shut down before the peer has closed the connection: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, peer.Close())
+	select {
+	case err = <-shutdown:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("didn't shut down once the peer has closed the connection")
+	}
+
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err, "connection is still open")
+}
+
+func TestExchange_shutdown_timeout(t *testing.T) {
+	defer func(d time.Duration) { closeTimeout = d }(closeTimeout)
+	closeTimeout = 10 * time.Millisecond
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	peer, err := ln.Accept()
+	require.NoError(t, err)
+	defer peer.Close()
+
+	// the peer never closes its side, and connections that can't be
+	// half-closed are closed right away
+	pipe, _ := net.Pipe()
+	ex := &exchange{conns: []io.Closer{conn, pipe}}
+	require.NoError(t, ex.shutdown())
+
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err, "connection is still open")
+}
+
+func TestExchange_reportProgress(t *testing.T) {
+	reports := int64(0)
+	ex := &exchange{UID: "uid"}
+	stop := ex.reportProgress(&progressConfig{0, time.Millisecond, func(uid string, stats map[string]PeerStats) {
+		require.Equal(t, "uid", uid)
+		atomic.AddInt64(&reports, 1)
+	}})
+
+	time.Sleep(20 * time.Millisecond)
+	stop()
+	reported := atomic.LoadInt64(&reports)
+	require.True(t, reported > 1, "expected reports every interval, got %d", reported)
+
+	time.Sleep(5 * time.Millisecond)
+	require.Equal(t, reported, atomic.LoadInt64(&reports), "reported after stopping")
+}
+
+func TestReceiveQueue_stalledConsumer(t *testing.T) {
+	vals := make([]string, 1000)
+	for i := range vals {
+		vals[i] = strconv.Itoa(i)
+	}
+
+	decoded := int64(0)
+	ex := ReceiveQueue(Gather(), 4).(*exchange)
+	for i := 0; i < 3; i++ {
+		st := ex.peerStats(strconv.Itoa(i))
+		ex.decs = append(ex.decs, &statsDecoder{&countingDecoder{newScriptedDecoder(vals...), &decoded}, st})
+	}
+	defer ex.Close()
+
+	// the consumer stalls after the first dataset
+	_, err := ex.decodeNext()
+	require.NoError(t, err)
+	for start := time.Now(); atomic.LoadInt64(&decoded) < 1+4+3 && time.Since(start) < time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// the queue is full, and each reader is blocked on one more
+	require.Equal(t, int64(1+4+3), atomic.LoadInt64(&decoded))
+	queued := int64(0)
+	for _, st := range Stats(ex) {
+		queued += st.Queued
+	}
+	require.Equal(t, int64(4+3), queued)
+
+	// nothing is dropped once it catches up
+	for i := 1; i < 3*len(vals); i++ {
+		_, err = ex.decodeNext()
+		require.NoError(t, err)
+	}
+	_, err = ex.decodeNext()
+	require.Equal(t, io.EOF, err)
+	for _, st := range Stats(ex) {
+		require.Equal(t, int64(0), st.Queued)
+	}
+}
+
+// countingDecoder is a decoder that counts its decodes
+type countingDecoder struct {
+	decoder
+	n *int64
+}
+
+func (dec *countingDecoder) Decode(e interface{}) error {
+	atomic.AddInt64(dec.n, 1)
+	return dec.decoder.Decode(e)
+}
+
+func TestScatterResilient_peerFailure(t *testing.T) {
+	// c stops reading after a while, such that its window fills up with
+	// unacknowledged datasets, and then it crashes
+	crash := &crashingNode{frozen: make(chan struct{}), crashed: make(chan struct{})}
+	cluster := newPipeCluster()
+	cluster.wrap = func(from, to string, conn net.Conn) net.Conn {
+		if from != "c" {
+			return conn
+		}
+		return crash.wrap(conn)
+	}
+
+	sent := []string{}
+	inp := make(chan Dataset)
+	go func() {
+		defer close(inp)
+		for i := 0; i < 40; i++ {
+			if i == 10 {
+				time.Sleep(20 * time.Millisecond)
+				close(crash.frozen)
+				time.AfterFunc(50*time.Millisecond, crash.crash)
+			}
+
+			v := strconv.Itoa(i)
+			sent = append(sent, v)
+			inp <- NewDataset(testStrs{v})
+		}
+	}()
+
+	nodes := []string{"a", "b", "c"}
+	inps := map[string]chan Dataset{"a": inp, "b": closedInput(), "c": closedInput()}
+	uid := newUID()
+	errs := cluster.runWithTimeout(t, nodes, func() Runner { return WithUID(ScatterResilient(2), uid) }, inps)
+	require.NoError(t, errs["a"])
+	require.NoError(t, errs["b"])
+
+	// at least once, thus c might have received some of the datasets that
+	// were sent again to the others
+	received := map[string]bool{}
+	for _, node := range nodes {
+		for _, data := range cluster.outs[node] {
+			for _, v := range data.At(0).Strings() {
+				received[v] = true
+			}
+		}
+	}
+	require.Len(t, received, len(sent))
+
+	survived := 0
+	for _, node := range []string{"a", "b"} {
+		for _, data := range cluster.outs[node] {
+			survived += data.Len()
+		}
+	}
+	require.True(t, survived > 40*2/3, "the datasets of c weren't sent again to the others")
+}
+
+func TestAckWindow(t *testing.T) {
+	w := newAckWindow(2)
+	require.NoError(t, w.push(NewDataset(testStrs{"1"})))
+	require.NoError(t, w.push(NewDataset(testStrs{"2"})))
+
+	// full, until the first one is acknowledged
+	pushed := make(chan error, 1)
+	go func() { pushed <- w.push(NewDataset(testStrs{"3"})) }()
+	select {
+	case <-pushed:
+		t.Fatal("pushed into a full window")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	w.ack(1)
+	require.NoError(t, <-pushed)
+
+	data, err := w.unacked()
+	require.NoError(t, err)
+	require.Nil(t, data, "unacknowledged datasets of a live peer")
+
+	// the unacknowledged datasets are returned once, after the failure
+	w.fail(fmt.Errorf("failed"))
+	require.EqualError(t, w.push(NewDataset(testStrs{"4"})), "failed")
+	require.EqualError(t, w.wait(), "failed")
+
+	data, err = w.unacked()
+	require.EqualError(t, err, "failed")
+	require.Len(t, data, 2)
+	require.Equal(t, []string{"2"}, data[0].At(0).Strings())
+	require.Equal(t, []string{"3"}, data[1].At(0).Strings())
+
+	data, _ = w.unacked()
+	require.Nil(t, data)
+}
+
+// crashingNode wraps the connections of a node, such that its reads block
+// once frozen, until all of its connections are closed once it's crashed
+type crashingNode struct {
+	sync.Mutex
+	conns   []net.Conn
+	frozen  chan struct{}
+	crashed chan struct{}
+}
+
+func (n *crashingNode) wrap(conn net.Conn) net.Conn {
+	n.Lock()
+	defer n.Unlock()
+	n.conns = append(n.conns, conn)
+	return &crashingConn{conn, n}
+}
+
+func (n *crashingNode) crash() {
+	n.Lock()
+	defer n.Unlock()
+	for _, conn := range n.conns {
+		conn.Close()
+	}
+	close(n.crashed)
+}
+
+type crashingConn struct {
+	net.Conn
+	node *crashingNode
+}
+
+func (c *crashingConn) Read(b []byte) (int, error) {
+	select {
+	case <-c.node.frozen:
+		<-c.node.crashed
+		return 0, io.ErrClosedPipe
+	default:
+		return c.Conn.Read(b)
+	}
+}
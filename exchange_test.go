@@ -1,6 +1,7 @@
 package ep_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/panoplyio/ep"
 	"github.com/panoplyio/ep/eptest"
@@ -8,7 +9,9 @@ import (
 	"math/rand"
 	"net"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -65,14 +68,17 @@ func TestExchange_dialingError(t *testing.T) {
 		"write tcp",
 		"read tcp",
 
+		"ep: peer :5552 disconnected unexpectedly",
+
 		"bad connection from port :5552",        // reported by 5552, when dialing to :5553
 		"ep: connect timeout; no incoming conn", // reported by 5553, when waiting to :5552
 	}
 	errMsg := err.Error()
 	isExpectedError := strings.Contains(errMsg, possibleErrors[0]) ||
 		strings.Contains(errMsg, possibleErrors[1]) ||
-		errMsg == possibleErrors[2] ||
-		errMsg == possibleErrors[3]
+		strings.Contains(errMsg, possibleErrors[2]) ||
+		strings.HasSuffix(errMsg, possibleErrors[3]) ||
+		strings.HasSuffix(errMsg, possibleErrors[4])
 	require.True(t, isExpectedError, "expected \"%s\" to appear in %s", err.Error(), possibleErrors)
 	require.Nil(t, data)
 }
@@ -116,7 +122,14 @@ func TestScatter_and_Gather(t *testing.T) {
 
 	require.NoError(t, err)
 	require.NotNil(t, data)
-	require.Equal(t, "[[hello world foo bar] [:5552 :5552 :5551 :5551]]", fmt.Sprintf("%v", data))
+
+	// the datasets are received from both nodes in any order
+	rows := []string{}
+	for i := 0; i < data.Len(); i++ {
+		rows = append(rows, data.At(0).Strings()[i]+" "+data.At(1).Strings()[i])
+	}
+	expected := []string{"hello :5552", "world :5552", "foo :5551", "bar :5551"}
+	require.ElementsMatch(t, expected, rows)
 }
 
 func TestPartition_and_Gather(t *testing.T) {
@@ -165,8 +178,8 @@ func TestPartition_usesProvidedColumn(t *testing.T) {
 
 	// to the exact opposite
 	// deliberately opposite values: column switch has to change to output
-	firstColumn := strs{"one", "two"}
-	secondColumn := strs{"two", "one"}
+	firstColumn := strs{"x", "y"}
+	secondColumn := strs{"y", "x"}
 
 	data := ep.NewDataset(firstColumn, secondColumn)
 
@@ -186,8 +199,8 @@ func TestPartition_usesProvidedColumn(t *testing.T) {
 
 	/*
 		Expected output similar to:
-		[[one two] [two one] [:5552 :5551]]
-		[[two one] [one two] [:5552 :5551]]
+		[[x y] [y x] [:5552 :5551]]
+		[[y x] [x y] [:5552 :5551]]
 	*/
 
 	firstResAt0 := firstRes.At(0)
@@ -217,7 +230,7 @@ func TestPartition_sendsCompleteDatasets(t *testing.T) {
 	}()
 
 	firstColumn := strs{"foo", "bar", "meh", "nya", "shtoot", "a", "few", "more", "things"}
-	secondColumn := strs{"f", "s", "f", "f", "s", "f", "f", "f", "s"}
+	secondColumn := strs{"x", "y", "x", "x", "y", "x", "x", "x", "y"}
 
 	data := ep.NewDataset(firstColumn, secondColumn)
 	runner := ep.Pipeline(ep.Partition(1), &count{}, ep.Gather())
@@ -226,10 +239,325 @@ func TestPartition_sendsCompleteDatasets(t *testing.T) {
 	res, err := eptest.Run(runner, data)
 	require.NoError(t, err)
 
-	// there are 6 "f" and 3 "s" in second column which is used for partitioning
+	// there are 6 "x" and 3 "y" in second column which is used for partitioning
 	expected := []string{"6", "3"}
 	sizes := res.At(0)
 
 	require.Equal(t, 2, sizes.Len())
 	require.ElementsMatch(t, expected, sizes.Strings())
 }
+
+func TestPartition_multipleColumns(t *testing.T) {
+	port1 := fmt.Sprintf(":%d", 5551)
+	peer1 := eptest.NewPeer(t, port1)
+
+	port2 := fmt.Sprintf(":%d", 5552)
+	peer2 := eptest.NewPeer(t, port2)
+	defer func() {
+		require.NoError(t, peer1.Close())
+		require.NoError(t, peer2.Close())
+	}()
+
+	firstColumn := strs{"a", "a", "a", "b", "a", "b", "c", "c"}
+	secondColumn := strs{"x", "y", "x", "x", "y", "x", "y", "z"}
+
+	data := ep.NewDataset(firstColumn, secondColumn)
+	runner := ep.Pipeline(ep.Partition(0, 1), &nodeAddr{}, ep.Gather())
+	runner = peer1.Distribute(runner, port1, port2)
+
+	res, err := eptest.Run(runner, data)
+	require.NoError(t, err)
+	require.Equal(t, data.Len(), res.Len())
+
+	// rows with the same values in both columns must land on the same node
+	nodes := map[[2]string]string{}
+	first, second, addrs := res.At(0).Strings(), res.At(1).Strings(), res.At(2).Strings()
+	for i := range addrs {
+		key := [2]string{first[i], second[i]}
+		if node, ok := nodes[key]; ok {
+			require.Equal(t, node, addrs[i], "key %s routed to several nodes", key)
+		}
+		nodes[key] = addrs[i]
+	}
+	require.Equal(t, 5, len(nodes))
+}
+
+func TestPartitionBy_rangePartitioner(t *testing.T) {
+	port1 := fmt.Sprintf(":%d", 5551)
+	peer1 := eptest.NewPeer(t, port1)
+
+	port2 := fmt.Sprintf(":%d", 5552)
+	peer2 := eptest.NewPeer(t, port2)
+	defer func() {
+		require.NoError(t, peer1.Close())
+		require.NoError(t, peer2.Close())
+	}()
+
+	// everything before "m" goes to the first node, the rest to the second
+	data := ep.NewDataset(strs{"a", "z", "l", "m", "b", "x"})
+	partitioner := ep.RangePartitioner(strs{"m"})
+	runner := ep.Pipeline(ep.PartitionBy(partitioner), &nodeAddr{}, ep.Gather())
+	runner = peer1.Distribute(runner, port1, port2)
+
+	res, err := eptest.Run(runner, data)
+	require.NoError(t, err)
+	require.Equal(t, data.Len(), res.Len())
+
+	vals, addrs := res.At(0).Strings(), res.At(1).Strings()
+	for i := range vals {
+		expected := port1
+		if vals[i] >= "m" {
+			expected = port2
+		}
+		require.Equal(t, expected, addrs[i], "%s routed to the wrong node", vals[i])
+	}
+}
+
+func TestInMemoryCluster_scatter(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	// every node reports the rows it received from the scatter
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), &nodeAddr{}, ep.Gather()))
+	data, err := eptest.Run(runner, ep.NewDataset(strs{"a"}), ep.NewDataset(strs{"b"}), ep.NewDataset(strs{"c"}))
+	require.NoError(t, err)
+	require.Equal(t, 3, data.Len())
+
+	nodes := data.At(1).Strings()
+	sort.Strings(nodes)
+	require.Equal(t, cluster.Nodes, nodes)
+}
+
+func TestInMemoryCluster_scatterResilient(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	var datasets []ep.Dataset
+	expected := []string{}
+	for i := 0; i < 50; i++ {
+		v := fmt.Sprintf("%d", i)
+		datasets = append(datasets, ep.NewDataset(strs{v}))
+		expected = append(expected, v)
+	}
+
+	// without failures, every dataset is delivered exactly once
+	runner := cluster.Distribute(ep.Pipeline(ep.ScatterResilient(2), &nodeAddr{}, ep.Gather()))
+	data, err := eptest.Run(runner, datasets...)
+	require.NoError(t, err)
+	require.ElementsMatch(t, expected, data.At(0).Strings())
+}
+
+func TestInMemoryCluster_gather(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.Gather()))
+	data, err := eptest.Run(runner, ep.NewDataset(strs{"a", "b"}), ep.NewDataset(strs{"c"}))
+	require.NoError(t, err)
+
+	values := data.At(0).Strings()
+	sort.Strings(values)
+	require.Equal(t, []string{"a", "b", "c"}, values)
+}
+
+// no-op runners are distributed as any other runner
+func TestInMemoryCluster_passThroughAndDiscard(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	datasets := []ep.Dataset{ep.NewDataset(strs{"a", "b"}), ep.NewDataset(strs{"c"})}
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.Discard(), ep.Gather()))
+	data, err := eptest.Run(runner, datasets...)
+	require.NoError(t, err)
+	require.Equal(t, 0, data.Len())
+
+	runner = cluster.Distribute(ep.Pipeline(
+		ep.Scatter(),
+		ep.Tee(ep.Discard()),
+		ep.Project(ep.PassThrough(), &upper{}),
+		ep.Gather(),
+	))
+	data, err = eptest.Run(runner, datasets...)
+	require.NoError(t, err)
+	data, err = ep.SortDataset(data, []ep.SortingCol{{Index: 0}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"[a b c]", "[A B C]"}, data.Strings())
+}
+
+func TestInMemoryCluster_broadcast(t *testing.T) {
+	cluster := eptest.InMemoryCluster(4)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.Broadcast(), ep.Gather()))
+	data, err := eptest.Run(runner, ep.NewDataset(strs{"a", "b"}), ep.NewDataset(strs{"c"}))
+	require.NoError(t, err)
+	require.Equal(t, 4*3, data.Len())
+}
+
+func TestInMemoryCluster_shuffle(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	keys := strs{}
+	for i := 0; i < 100; i++ {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+
+	// both sides of a join, with their keys in different columns, are
+	// shuffled by separate exchanges
+	left, err := eptest.Run(
+		cluster.Distribute(ep.Pipeline(ep.Shuffle(0), &nodeAddr{}, ep.Gather())),
+		ep.NewDataset(keys, keys),
+	)
+	require.NoError(t, err)
+
+	right, err := eptest.Run(
+		cluster.Distribute(ep.Pipeline(ep.Shuffle(1), &nodeAddr{}, ep.Gather())),
+		ep.NewDataset(strs(make([]string, len(keys))), keys),
+	)
+	require.NoError(t, err)
+
+	nodes := map[string]string{}
+	used := map[string]bool{}
+	for i, key := range left.At(0).Strings() {
+		nodes[key] = left.At(2).Strings()[i]
+		used[nodes[key]] = true
+	}
+	require.Len(t, nodes, len(keys))
+	require.Len(t, used, len(cluster.Nodes), "not spread between all of the nodes")
+
+	for i, key := range right.At(1).Strings() {
+		require.Equal(t, nodes[key], right.At(2).Strings()[i], "key %s landed on different nodes", key)
+	}
+
+	expected, err := ep.ShuffleNodes(cluster.Nodes, ep.NewDataset(keys), 0)
+	require.NoError(t, err)
+	for i, key := range keys {
+		require.Equal(t, expected[i], nodes[key])
+	}
+}
+
+func TestInMemoryCluster_partitionedBy(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	// the input is on the main node, and it stays there as the partitioning
+	// is carried to all of the nodes, which don't wait for each other
+	runner := cluster.Distribute(ep.Pipeline(ep.Partition(0), &nodeAddr{}, ep.Gather()))
+	ctx := ep.PartitionedBy(context.Background(), 0)
+	data, err := eptest.RunWithContext(ctx, runner, ep.NewDataset(strs{"a", "b", "c"}))
+	require.NoError(t, err)
+	main := cluster.Nodes[0]
+	require.Equal(t, []string{main, main, main}, data.At(1).Strings())
+}
+
+func TestProgress(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	var datasets []ep.Dataset
+	for i := 0; i < 20; i++ {
+		datasets = append(datasets, ep.NewDataset(strs{"a", "b"}))
+	}
+
+	var l sync.Mutex
+	reports := []map[string]ep.PeerStats{}
+	counting := func(uid string, stats map[string]ep.PeerStats) {
+		l.Lock()
+		defer l.Unlock()
+		reports = append(reports, stats)
+	}
+
+	t.Run("option", func(t *testing.T) {
+		reports = nil
+		runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.Progress(ep.Gather(), 1, 0, counting)))
+		_, err := eptest.Run(runner, datasets...)
+		require.NoError(t, err)
+
+		// every batch is due, but they're coalesced while reporting
+		require.True(t, len(reports) > 1, "expected reports along the way, got %d", len(reports))
+		received := int64(0)
+		for _, st := range reports[len(reports)-1] {
+			received += st.RowsReceived
+		}
+		require.Equal(t, int64(2*len(datasets)), received, "the last report isn't final")
+	})
+
+	t.Run("context", func(t *testing.T) {
+		reports = nil
+		ctx := ep.WithProgress(context.Background(), 0, 0, counting)
+		runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.Gather()))
+		_, err := eptest.RunWithContext(ctx, runner, datasets...)
+		require.NoError(t, err)
+
+		// only the final reports, of both exchanges on the main node
+		require.Len(t, reports, 2)
+	})
+
+	t.Run("slow", func(t *testing.T) {
+		slow := func(uid string, stats map[string]ep.PeerStats) {
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		start := time.Now()
+		runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.Progress(ep.Gather(), 1, 0, slow)))
+		_, err := eptest.Run(runner, datasets...)
+		require.NoError(t, err)
+
+		// a report per batch would take a second
+		require.True(t, time.Since(start) < 500*time.Millisecond, "blocked on the slow callback for %s", time.Since(start))
+	})
+}
+
+// fruits is a Data type that's only registered with Types.Register, and not
+// with gob directly
+type fruits []string
+type fruitType struct{}
+
+var fruit = ep.Types.Register("fruit", &fruitType{}).Get("fruit")[0]
+
+func (*fruitType) String() string              { return "fruit" }
+func (*fruitType) Name() string                { return "fruit" }
+func (*fruitType) Data(n int) ep.Data          { return make(fruits, n) }
+func (*fruitType) DataEmpty(n int) ep.Data     { return make(fruits, 0, n) }
+func (fruits) Type() ep.Type                   { return fruit }
+func (vs fruits) Len() int                     { return len(vs) }
+func (vs fruits) Less(i, j int) bool           { return vs[i] < vs[j] }
+func (vs fruits) Swap(i, j int)                { vs[i], vs[j] = vs[j], vs[i] }
+func (vs fruits) Slice(s, e int) ep.Data       { return vs[s:e] }
+func (vs fruits) Append(other ep.Data) ep.Data { return append(vs, other.(fruits)...) }
+func (vs fruits) Duplicate(t int) ep.Data      { panic("not implemented") }
+func (vs fruits) IsNull(int) bool              { return false }
+func (vs fruits) MarkNull(int)                 {}
+func (vs fruits) Nulls() []bool                { return make([]bool, len(vs)) }
+func (vs fruits) Equal(other ep.Data) bool     { return reflect.DeepEqual(vs, other) }
+func (vs fruits) Copy(from ep.Data, i, j int)  { vs[j] = from.(fruits)[i] }
+func (vs fruits) Strings() []string            { return vs }
+func (vs fruits) LessOther(i int, other ep.Data, j int) bool {
+	return vs[i] < other.(fruits)[j]
+}
+
+// unregistered is a Data type that isn't registered at all
+type unregistered struct{ strs }
+
+func TestExchange_registeredType(t *testing.T) {
+	cluster := eptest.InMemoryCluster(2)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	// scattered to the other node, and gathered back
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.Gather()))
+	data, err := eptest.Run(runner, ep.NewDataset(fruits{"apple"}), ep.NewDataset(fruits{"banana"}))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"apple", "banana"}, data.At(0).Strings())
+}
+
+func TestExchange_unregisteredType(t *testing.T) {
+	cluster := eptest.InMemoryCluster(2)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.Gather()))
+	data := ep.NewDataset(fruits{"apple"}, unregistered{strs{"a"}})
+	_, err := eptest.Run(runner, data, data)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "column 1 of type string isn't registered with gob, its Data (ep_test.unregistered) must be registered with Types.Register")
+}
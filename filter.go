@@ -0,0 +1,62 @@
+package ep
+
+import "context"
+
+// FilterRows returns a Runner that outputs the rows of its input for which the
+// predicate is true, as with FilterMask, where the mask of every dataset is of
+// the predicate of all of its rows
+func FilterRows(pred func(ds Dataset, row int) bool) Runner {
+	return FilterMask(func(ds Dataset) []bool {
+		mask := make([]bool, ds.Len())
+		for i := range mask {
+			mask[i] = pred(ds, i)
+		}
+		return mask
+	})
+}
+
+// FilterMask returns a Runner that outputs the rows of every dataset of its
+// input whose booleans in its mask are true, as with FilterDataset. The mask
+// function returns the mask of every dataset, which must have a boolean for
+// every row. Datasets are filtered one by one, without re-batching them, such
+// that datasets of all of their rows are output as is, without copying them,
+// while datasets of none of them are skipped.
+//
+// NOTE that the mask function can't be distributed, thus the Runner can only
+// run on the node that constructed it, e.g. before Scatter or after Gather
+func FilterMask(mask func(ds Dataset) []bool) Runner {
+	return &filter{mask}
+}
+
+type filter struct{ mask func(Dataset) []bool }
+
+func (*filter) Returns() []Type { return []Type{Wildcard} }
+func (r *filter) Run(_ context.Context, inp, out chan Dataset) error {
+	for data := range inp {
+		mask := r.mask(data)
+		if len(mask) == data.Len() && allTrue(mask) {
+			if data.Len() > 0 {
+				out <- data
+			}
+			continue
+		}
+
+		res, err := FilterDataset(data, mask)
+		if err != nil {
+			return err
+		} else if res.Len() > 0 {
+			out <- res
+		}
+	}
+	return nil
+}
+
+// allTrue reports whether all of the booleans of the mask are true
+func allTrue(mask []bool) bool {
+	for _, v := range mask {
+		if !v {
+			return false
+		}
+	}
+	return true
+}
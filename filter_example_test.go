@@ -0,0 +1,21 @@
+package ep_test
+
+import (
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"strings"
+)
+
+func ExampleFilterRows() {
+	runner := ep.FilterRows(func(ds ep.Dataset, row int) bool {
+		return strings.HasPrefix(string(ds.At(0).(strs)[row]), "wo")
+	})
+
+	data := ep.NewDataset(strs([]string{"hello", "world", "wonder"}))
+	data, err := eptest.Run(runner, data)
+	fmt.Println(data.Strings(), err)
+
+	// Output:
+	// [[world wonder]] <nil>
+}
@@ -0,0 +1,60 @@
+package ep_test
+
+import (
+	"context"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestFilterRows(t *testing.T) {
+	even := ep.FilterRows(func(ds ep.Dataset, row int) bool {
+		return ds.At(0).(*ep.Int64s).Values[row]%2 == 0
+	})
+
+	res, err := eptest.Run(even,
+		ep.NewDataset(ints(1, 2, 3, 4), strs{"a", "b", "c", "d"}),
+		ep.NewDataset(ints(5, 7), strs{"e", "f"}),
+		ep.NewDataset(ints(6), strs{"g"}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[2 4 6]", "[b d g]"}, res.Strings())
+}
+
+func TestFilterMask(t *testing.T) {
+	// datasets are filtered one by one, skipping the ones of no rows
+	r := ep.FilterMask(func(ds ep.Dataset) []bool {
+		mask := make([]bool, ds.Len())
+		for i, v := range ds.At(0).Strings() {
+			mask[i] = v != "x"
+		}
+		return mask
+	})
+
+	all := ep.NewDataset(strs{"a", "b"})
+	inp, out := make(chan ep.Dataset, 4), make(chan ep.Dataset, 4)
+	inp <- ep.NewDataset(strs{"x", "c", "x"})
+	inp <- ep.NewDataset(strs{"x", "x"})
+	inp <- all
+	inp <- ep.NewDataset(strs{})
+	close(inp)
+	require.NoError(t, r.Run(context.Background(), inp, out))
+	close(out)
+
+	var res []ep.Dataset
+	for data := range out {
+		res = append(res, data)
+	}
+	require.Len(t, res, 2)
+	require.Equal(t, []string{"[c]"}, res[0].Strings())
+
+	// datasets of all of their rows are output as is
+	require.True(t, ep.Same(all, res[1]))
+}
+
+func TestFilterMask_mismatch(t *testing.T) {
+	r := ep.FilterMask(func(ds ep.Dataset) []bool { return []bool{true} })
+	_, err := eptest.Run(r, ep.NewDataset(strs{"a", "b"}))
+	require.EqualError(t, err, "ep: mask of 1 values for 2 rows")
+}
@@ -0,0 +1,259 @@
+package ep
+
+import (
+	"encoding/binary"
+)
+
+// The minimal subset of FlatBuffers needed by the metadata of Arrow IPC
+// streams: tables of scalars, strings, tables, vectors of tables and vectors
+// of 16-byte structs. See https://flatbuffers.dev/internals/
+//
+// Unlike the official builders, which build buffers backwards, fbBuilder
+// writes every table followed by the objects it refers to, as offsets must
+// point forward. Every vtable is written right before its table.
+
+// fbTable is a table to build, with the values of its fields by their ids, or
+// nil for absent fields. Values are bool, uint8, int16, int32, int64, string,
+// fbTable, []fbTable or fbStructs
+type fbTable []interface{}
+
+// fbStructs is a vector of structs of two int64 values, like the FieldNode
+// and Buffer structs of Arrow
+type fbStructs [][2]int64
+
+type fbBuilder struct{ buf []byte }
+
+// buildFlatbuffer returns the flatbuffer of the root table
+func buildFlatbuffer(root fbTable) []byte {
+	b := &fbBuilder{make([]byte, 4, 256)}
+	pos := b.table(root)
+	binary.LittleEndian.PutUint32(b.buf, uint32(pos))
+	return b.buf
+}
+
+func (b *fbBuilder) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *fbBuilder) uint16(v uint16) { b.buf = binary.LittleEndian.AppendUint16(b.buf, v) }
+func (b *fbBuilder) uint32(v uint32) { b.buf = binary.LittleEndian.AppendUint32(b.buf, v) }
+
+// table writes the table, and then the objects it refers to, and returns its
+// position
+func (b *fbBuilder) table(t fbTable) int {
+	// inline fields follow the offset of the vtable, aligned to their size
+	offsets := make([]int, len(t))
+	size := 4
+	for i, v := range t {
+		if v == nil {
+			continue
+		}
+
+		n := fbInlineSize(v)
+		for size%n != 0 {
+			size++
+		}
+		offsets[i] = size
+		size += n
+	}
+
+	b.align(2)
+	vtable := len(b.buf)
+	b.uint16(uint16(4 + 2*len(t)))
+	b.uint16(uint16(size))
+	for _, off := range offsets {
+		b.uint16(uint16(off))
+	}
+
+	b.align(8)
+	pos := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(pos-vtable))
+
+	for i, v := range t {
+		at := pos + offsets[i]
+		switch v := v.(type) {
+		case nil:
+		case bool:
+			if v {
+				b.buf[at] = 1
+			}
+		case uint8:
+			b.buf[at] = v
+		case int16:
+			binary.LittleEndian.PutUint16(b.buf[at:], uint16(v))
+		case int32:
+			binary.LittleEndian.PutUint32(b.buf[at:], uint32(v))
+		case int64:
+			binary.LittleEndian.PutUint64(b.buf[at:], uint64(v))
+		default:
+			ref := b.object(v)
+			binary.LittleEndian.PutUint32(b.buf[at:], uint32(ref-at))
+		}
+	}
+	return pos
+}
+
+// object writes a string, table or vector, and returns its position
+func (b *fbBuilder) object(v interface{}) int {
+	switch v := v.(type) {
+	case string:
+		b.align(4)
+		pos := len(b.buf)
+		b.uint32(uint32(len(v)))
+		b.buf = append(append(b.buf, v...), 0)
+		return pos
+	case fbTable:
+		return b.table(v)
+	case []fbTable:
+		b.align(4)
+		pos := len(b.buf)
+		b.uint32(uint32(len(v)))
+		b.buf = append(b.buf, make([]byte, 4*len(v))...)
+		for i, t := range v {
+			at := pos + 4 + 4*i
+			ref := b.table(t) // before slicing the buffer, which it grows
+			binary.LittleEndian.PutUint32(b.buf[at:], uint32(ref-at))
+		}
+		return pos
+	case fbStructs:
+		// the structs are aligned to 8 bytes, right after the length
+		b.align(4)
+		if len(b.buf)%8 == 0 {
+			b.uint32(0)
+		}
+		pos := len(b.buf)
+		b.uint32(uint32(len(v)))
+		for _, s := range v {
+			b.buf = binary.LittleEndian.AppendUint64(b.buf, uint64(s[0]))
+			b.buf = binary.LittleEndian.AppendUint64(b.buf, uint64(s[1]))
+		}
+		return pos
+	}
+	panic("ep: unsupported flatbuffers value")
+}
+
+// fbInlineSize returns the size of the value inside of its table
+func fbInlineSize(v interface{}) int {
+	switch v.(type) {
+	case bool, uint8:
+		return 1
+	case int16:
+		return 2
+	case int64:
+		return 8
+	}
+	return 4 // int32, and offsets to other objects
+}
+
+// fbReader reads a table of a flatbuffer. It doesn't verify the buffer, thus
+// it panics when reading malformed buffers, which its callers recover from
+type fbReader struct {
+	buf []byte
+	pos int
+}
+
+// fbRoot returns the root table of the buffer
+func fbRoot(buf []byte) fbReader {
+	return fbReader{buf, int(binary.LittleEndian.Uint32(buf))}
+}
+
+// field returns the position of the id-th field, or zero when it's absent
+func (t fbReader) field(id int) int {
+	vtable := t.pos - int(int32(binary.LittleEndian.Uint32(t.buf[t.pos:])))
+	entry := 4 + 2*id
+	if entry+2 > int(binary.LittleEndian.Uint16(t.buf[vtable:])) {
+		return 0
+	}
+
+	off := int(binary.LittleEndian.Uint16(t.buf[vtable+entry:]))
+	if off == 0 {
+		return 0
+	}
+	return t.pos + off
+}
+
+func (t fbReader) bool(id int) bool { return t.uint8(id, 0) != 0 }
+func (t fbReader) uint8(id int, def uint8) uint8 {
+	if at := t.field(id); at != 0 {
+		return t.buf[at]
+	}
+	return def
+}
+func (t fbReader) int16(id int, def int16) int16 {
+	if at := t.field(id); at != 0 {
+		return int16(binary.LittleEndian.Uint16(t.buf[at:]))
+	}
+	return def
+}
+func (t fbReader) int32(id int, def int32) int32 {
+	if at := t.field(id); at != 0 {
+		return int32(binary.LittleEndian.Uint32(t.buf[at:]))
+	}
+	return def
+}
+func (t fbReader) int64(id int, def int64) int64 {
+	if at := t.field(id); at != 0 {
+		return int64(binary.LittleEndian.Uint64(t.buf[at:]))
+	}
+	return def
+}
+
+// ref returns the position of the object the id-th field refers to, or zero
+// when it's absent
+func (t fbReader) ref(id int) int {
+	at := t.field(id)
+	if at == 0 {
+		return 0
+	}
+	return at + int(binary.LittleEndian.Uint32(t.buf[at:]))
+}
+
+func (t fbReader) has(id int) bool { return t.field(id) != 0 }
+func (t fbReader) table(id int) fbReader {
+	return fbReader{t.buf, t.ref(id)}
+}
+
+func (t fbReader) string(id int) string {
+	pos := t.ref(id)
+	if pos == 0 {
+		return ""
+	}
+	n := int(binary.LittleEndian.Uint32(t.buf[pos:]))
+	return string(t.buf[pos+4 : pos+4+n])
+}
+
+// vector returns the position of the elements of the id-th vector, and their
+// number
+func (t fbReader) vector(id int) (int, int) {
+	pos := t.ref(id)
+	if pos == 0 {
+		return 0, 0
+	}
+	return pos + 4, int(binary.LittleEndian.Uint32(t.buf[pos:]))
+}
+
+// tables returns the tables of the id-th vector
+func (t fbReader) tables(id int) []fbReader {
+	pos, n := t.vector(id)
+	res := make([]fbReader, n)
+	for i := range res {
+		at := pos + 4*i
+		res[i] = fbReader{t.buf, at + int(binary.LittleEndian.Uint32(t.buf[at:]))}
+	}
+	return res
+}
+
+// structs returns the structs of two int64 values of the id-th vector
+func (t fbReader) structs(id int) fbStructs {
+	pos, n := t.vector(id)
+	res := make(fbStructs, n)
+	for i := range res {
+		at := pos + 16*i
+		res[i][0] = int64(binary.LittleEndian.Uint64(t.buf[at:]))
+		res[i][1] = int64(binary.LittleEndian.Uint64(t.buf[at+8:]))
+	}
+	return res
+}
@@ -0,0 +1,56 @@
+package ep
+
+// forkInput returns n inputs, of all of the datasets of the input each, which
+// are buffered, such that every one of them is received independently of the
+// others. Every one of them is closed once the input is closed.
+//
+// The buffers are unbounded, as the runners of Project, Union and MergeJoin may receive
+// all of their input before outputting anything, like Sort does, while the
+// others wait for their output to be received. Thus while one runner falls
+// behind the others, the datasets it didn't receive yet are held in memory,
+// up to all of the input. Bounding them would deadlock such runners instead
+func forkInput(inp chan Dataset, n int) []chan Dataset {
+	queues := make([]chan Dataset, n)
+	res := make([]chan Dataset, n)
+	for i := range res {
+		queues[i], res[i] = make(chan Dataset), make(chan Dataset)
+		go bufferInput(queues[i], res[i])
+	}
+
+	go func() {
+		for data := range inp {
+			for _, q := range queues {
+				q <- data
+			}
+		}
+		for _, q := range queues {
+			close(q)
+		}
+	}()
+	return res
+}
+
+// bufferInput forwards all of the datasets of inp to out, buffering them in
+// memory while out isn't received, and closes out once inp is closed
+func bufferInput(inp, out chan Dataset) {
+	defer close(out)
+	var queue []Dataset
+	for inp != nil || len(queue) > 0 {
+		var send chan Dataset
+		var next Dataset
+		if len(queue) > 0 {
+			send, next = out, queue[0]
+		}
+
+		select {
+		case data, ok := <-inp:
+			if !ok {
+				inp = nil
+				continue
+			}
+			queue = append(queue, data)
+		case send <- next:
+			queue = queue[1:]
+		}
+	}
+}
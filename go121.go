@@ -0,0 +1,9 @@
+//go:build !go1.21
+// +build !go1.21
+
+package ep
+
+// ep requires Go 1.21 or later, for generics, the cmp package and the min and
+// max builtins. This file is built only by older versions, and fails them with
+// an undefined requiresGo121, rather than with the errors of the other files
+var _ = requiresGo121
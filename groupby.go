@@ -0,0 +1,172 @@
+package ep
+
+import (
+	"context"
+	"fmt"
+)
+
+var _ = registerGob(&groupBy{})
+
+// MergeMode is the phase of a GroupBy in a two-phase aggregation, where every
+// node aggregates its own input partially, before partitioning the partial
+// results by their keys, for every node to merge the ones of its keys
+type MergeMode int
+
+const (
+	// MergeNone aggregates the input into the results, in a single phase
+	MergeNone MergeMode = iota
+
+	// MergePartial aggregates the input into the states of the aggregators,
+	// as returned by their Partial, following the keys
+	MergePartial
+
+	// MergeFinal merges the output of GroupBy in MergePartial mode into the
+	// results, as with MergeNone. The keys are the first columns of its input,
+	// in their order, followed by the states of all of the aggregators, thus
+	// the GroupBy of both phases is constructed with the same arguments
+	MergeFinal
+)
+
+// GroupBy returns a Runner that groups all of the rows of its input by the
+// values of the key columns, where nulls are equal to each other, and outputs
+// a single row per group once its input is completed. Every row has the keys
+// of its group, followed by the results of all of the aggregators, and the
+// groups are in the order of their first rows. Without key columns, all of
+// the rows are a single group, which is output even when there are no rows.
+//
+// For distributed aggregations, GroupBy is placed before and after Partition,
+// in MergePartial and MergeFinal modes, set with WithMergeMode:
+//
+//	Pipeline(
+//		WithMergeMode(GroupBy(keys, aggs...), MergePartial),
+//		Partition(0, 1),
+//		WithMergeMode(GroupBy(keys, aggs...), MergeFinal),
+//	)
+func GroupBy(keyCols []int, aggs ...Aggregator) Runner {
+	return &groupBy{KeyCols: keyCols, Aggs: aggs}
+}
+
+// WithMergeMode sets the MergeMode of a Runner returned by GroupBy
+func WithMergeMode(r Runner, mode MergeMode) Runner {
+	g, ok := r.(*groupBy)
+	if !ok {
+		panic("ep: WithMergeMode expects a GroupBy")
+	}
+
+	g.Mode = mode
+	return g
+}
+
+type groupBy struct {
+	KeyCols []int
+	Aggs    []Aggregator
+	Mode    MergeMode
+}
+
+func (r *groupBy) Returns() []Type {
+	types := make([]Type, 0, len(r.KeyCols)+len(r.Aggs))
+	for _, col := range r.KeyCols {
+		types = append(types, Wildcard.At(col))
+	}
+	for _, agg := range r.Aggs {
+		if r.Mode == MergePartial {
+			types = append(types, Wildcard)
+		} else {
+			types = append(types, agg.Returns())
+		}
+	}
+	return types
+}
+
+func (r *groupBy) Run(_ context.Context, inp, out chan Dataset) error {
+	keyCols := r.KeyCols
+	if r.Mode == MergeFinal {
+		keyCols = make([]int, len(r.KeyCols))
+		for i := range keyCols {
+			keyCols[i] = i
+		}
+	}
+
+	set := newKeySet()
+	var states [][]interface{} // of every aggregator, by the numbers of the keys
+	if len(keyCols) == 0 {
+		states = [][]interface{}{r.initStates()}
+	}
+
+	for data := range inp {
+		err := r.check(data, keyCols)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int, data.Len())
+		if len(keyCols) > 0 {
+			ids, _ = set.add(selectColumns(data, keyCols))
+		}
+
+		for row, id := range ids {
+			if id == len(states) {
+				states = append(states, r.initStates())
+			}
+
+			for i, agg := range r.Aggs {
+				if r.Mode == MergeFinal {
+					agg.Merge(states[id][i], agg.PartialState(data.At(len(keyCols)+i), row))
+				} else if err = agg.Update(states[id][i], data, row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if len(states) == 0 {
+		return nil
+	}
+
+	var cols []Data
+	if keys := set.keys(); keys != nil {
+		for i := 0; i < keys.Width(); i++ {
+			cols = append(cols, keys.At(i))
+		}
+	}
+
+	aggStates := make([]interface{}, len(states))
+	for i, agg := range r.Aggs {
+		for id := range states {
+			aggStates[id] = states[id][i]
+		}
+
+		if r.Mode == MergePartial {
+			cols = append(cols, agg.Partial(aggStates))
+		} else {
+			cols = append(cols, agg.Result(aggStates))
+		}
+	}
+	out <- NewDataset(cols...)
+	return nil
+}
+
+// initStates returns the initial states of all of the aggregators, of a new
+// group
+func (r *groupBy) initStates() []interface{} {
+	res := make([]interface{}, len(r.Aggs))
+	for i, agg := range r.Aggs {
+		res[i] = agg.InitState()
+	}
+	return res
+}
+
+// check verifies that the key columns are within the width of the data, and
+// that it has the states of all of the aggregators in MergeFinal mode
+func (r *groupBy) check(data Dataset, keyCols []int) error {
+	for _, col := range keyCols {
+		if col < 0 || col >= data.Width() {
+			return fmt.Errorf("ep: group by column %d out of range for %d columns", col, data.Width())
+		}
+	}
+
+	if r.Mode == MergeFinal && data.Width() != len(keyCols)+len(r.Aggs) {
+		return fmt.Errorf("ep: merging %d columns, of %d keys and %d aggregators", data.Width(), len(keyCols), len(r.Aggs))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+)
+
+func TestGroupBy(t *testing.T) {
+	keys := &ep.Int64s{Values: []int64{1, 2, 1, 0, 2, 0}, Null: ep.NullMask{8 | 32}}
+	ints := &ep.Int64s{Values: []int64{10, 20, 30, 40, 0, 60}, Null: ep.NullMask{16}}
+	floats := &ep.Float64s{Values: []float64{1.5, 2, 0, 4, 5, 6}, Null: ep.NullMask{4}}
+	data := ep.NewDataset(keys, ints, floats)
+
+	// in batches of 2 rows, with null keys as a group of their own
+	r := ep.GroupBy([]int{0}, ep.Count(-1), ep.Count(1), ep.Sum(1), ep.Min(1), ep.Max(2), ep.Avg(2), ep.Sum(2))
+	res, err := eptest.Run(r, data.Slice(0, 2).(ep.Dataset), data.Slice(2, 4).(ep.Dataset), data.Slice(4, 6).(ep.Dataset))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[1 2 ]", "[2 2 2]", "[2 1 2]", "[40 20 100]", "[10 20 40]", "[1.5 5 6]", "[1.5 3.5 5]", "[1.5 7 10]"}, res.Strings())
+	require.Equal(t, ep.Int64, res.At(2).Type())
+	require.Equal(t, ep.Float64, res.At(6).Type())
+
+	// a single group
+	res, err = eptest.Run(ep.GroupBy(nil, ep.Count(-1), ep.Sum(1), ep.Min(2)), data)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[6]", "[160]", "[1.5]"}, res.Strings())
+
+	// by several keys, of all of the rows
+	res, err = eptest.Run(ep.GroupBy([]int{2, 0}, ep.Count(1)), ep.NewDataset(strs{"a", "b", "a", "a"}, ep.Constant(&ep.Int64s{Values: []int64{1}}, 4), strs{"x", "x", "x", "y"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[x x y]", "[a b a]", "[2 1 1]"}, res.Strings())
+}
+
+func TestGroupBy_empty(t *testing.T) {
+	res, err := eptest.Run(ep.GroupBy([]int{0}, ep.Count(-1)))
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Len())
+
+	// without keys, a single group of no rows
+	res, err = eptest.Run(ep.GroupBy(nil, ep.Count(-1), ep.Sum(0), ep.Max(0), ep.Avg(0)))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[0]", "[]", "[]", "[]"}, res.Strings())
+}
+
+func TestGroupBy_errors(t *testing.T) {
+	_, err := eptest.Run(ep.GroupBy([]int{0}, ep.Sum(1)), ep.NewDataset(strs{"a"}, strs{"b"}))
+	require.Error(t, err)
+	require.Equal(t, "ep: can't aggregate string, of neither int64 nor float64", err.Error())
+
+	_, err = eptest.Run(ep.GroupBy([]int{1}, ep.Count(-1)), ep.NewDataset(strs{"a"}))
+	require.Error(t, err)
+	require.Equal(t, "ep: group by column 1 out of range for 1 columns", err.Error())
+
+	_, err = eptest.Run(ep.WithMergeMode(ep.GroupBy([]int{0}, ep.Count(-1)), ep.MergeFinal), ep.NewDataset(strs{"a"}))
+	require.Error(t, err)
+	require.Equal(t, "ep: merging 1 columns, of 1 keys and 1 aggregators", err.Error())
+	require.Panics(t, func() { ep.WithMergeMode(ep.PassThrough(), ep.MergeFinal) })
+}
+
+// Aggregating partially on every node, and merging the partial results by
+// their keys, equals aggregating all of the input at once
+func TestGroupBy_distributed(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	rnd := rand.New(rand.NewSource(86))
+	var datasets []ep.Dataset
+	for i := 0; i < 30; i++ {
+		floats := &ep.Float64s{Values: make([]float64, 100)}
+		for j := range floats.Values {
+			floats.Values[j] = float64(rnd.Intn(1000)) / 4
+		}
+		datasets = append(datasets, ep.NewDataset(randomInts(rnd, 100), randomInts(rnd, 100), floats))
+	}
+
+	keys := []int{0}
+	aggs := func() []ep.Aggregator {
+		return []ep.Aggregator{ep.Count(-1), ep.Count(1), ep.Sum(1), ep.Min(1), ep.Max(2), ep.Avg(2), ep.Sum(2)}
+	}
+	runner := cluster.Distribute(ep.Pipeline(
+		ep.Scatter(),
+		ep.WithMergeMode(ep.GroupBy(keys, aggs()...), ep.MergePartial),
+		ep.Partition(0),
+		ep.WithMergeMode(ep.GroupBy(keys, aggs()...), ep.MergeFinal),
+		ep.Gather(),
+	))
+	res, err := eptest.Run(runner, datasets...)
+	require.NoError(t, err)
+
+	expected, err := eptest.Run(ep.GroupBy(keys, aggs()...), datasets...)
+	require.NoError(t, err)
+	require.Equal(t, 11, expected.Len())
+
+	// by the order of the keys, as the groups of every node are in their order
+	cols := []ep.SortingCol{{Index: 0}}
+	expected, err = ep.SortDataset(expected, cols)
+	require.NoError(t, err)
+	res, err = ep.SortDataset(res, cols)
+	require.NoError(t, err)
+	require.Equal(t, expected.Strings(), res.Strings())
+}
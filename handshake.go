@@ -0,0 +1,171 @@
+package ep
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// versions of the protocol spoken over the connections of exchanges. The
+// legacy protocol, v1, has no handshakes: the streams start right away
+const (
+	legacyProtocolVersion = 1
+	protocolVersion       = 2
+)
+
+// handshakeMagic prefixes the handshakes of exchange connections. Its first
+// byte isn't a valid stream header, thus legacy peers fail to read it, and
+// legacy peers are detected by its absence
+var handshakeMagic = []byte{0xe9, 'e', 'p', 'x'}
+
+// handshakeTimeout bounds the handshake, as a legacy peer might never write
+// anything to detect it with
+var handshakeTimeout = 5 * time.Second
+
+// features of the protocol, announced by both sides of every connection
+const (
+	featureHeartbeats uint32 = 1 << iota
+	featureChecksums
+	featureGzip
+	featureStopSending
+	featureAcks
+)
+
+var featureNames = []string{"heartbeats", "checksums", "gzip", "stop sending", "acknowledgements"}
+
+// supportedFeatures is the bitmask of the features supported by this node
+var supportedFeatures = featureHeartbeats | featureChecksums | featureGzip | featureStopSending | featureAcks
+
+var legacyProtocol = struct {
+	sync.RWMutex
+	enabled bool
+}{}
+
+// SetLegacyProtocol sets whether the exchanges started afterwards speak the
+// legacy protocol, without handshakes, for clusters that still contain nodes
+// with earlier versions of ep. Like the Codec, all of the nodes must speak the
+// same protocol, thus it should be set upon initialization. Mismatched peers
+// are detected, and fail the exchange, instead of misreading its streams
+func SetLegacyProtocol(enabled bool) {
+	legacyProtocol.Lock()
+	defer legacyProtocol.Unlock()
+	legacyProtocol.enabled = enabled
+}
+
+func isLegacyProtocol() bool {
+	legacyProtocol.RLock()
+	defer legacyProtocol.RUnlock()
+	return legacyProtocol.enabled
+}
+
+// handshake exchanges the protocol version and the supported features with a
+// peer, over a new connection to it. The connection settles on the features
+// supported by both sides, and fails when the peer speaks another protocol,
+// or when it lacks any of the features required by the exchange
+func (ex *exchange) handshake(conn net.Conn, addr string) error {
+	if ex.legacy {
+		return nil
+	}
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	// the write doesn't wait for the read, as on unbuffered connections it
+	// blocks until the peer reads it
+	written := make(chan error, 1)
+	go func() {
+		written <- writeHello(conn, protocolVersion, supportedFeatures)
+	}()
+
+	version, features, err := readHello(conn)
+	if err == nil {
+		err = <-written
+	}
+
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return fmt.Errorf("ep: handshake with %s timed out, it might speak protocol v%d", addr, legacyProtocolVersion)
+	} else if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("ep: peer %s disconnected during the handshake", addr)
+	} else if err != nil {
+		return fmt.Errorf("ep: handshake with %s failed: %s", addr, err)
+	}
+
+	if version != protocolVersion {
+		return fmt.Errorf("ep: peer %s speaks protocol v%d, we require v%d", addr, version, protocolVersion)
+	}
+
+	missing := ex.requiredFeatures() &^ (features & supportedFeatures)
+	if missing != 0 {
+		return fmt.Errorf("ep: peer %s doesn't support %s", addr, describeFeatures(missing))
+	}
+
+	return conn.SetDeadline(time.Time{})
+}
+
+// requiredFeatures returns the bitmask of the features used by the exchange,
+// according to its options
+func (ex *exchange) requiredFeatures() (features uint32) {
+	if ex.HeartbeatInterval > 0 {
+		features |= featureHeartbeats
+	}
+	if ex.Checksums {
+		features |= featureChecksums
+	}
+	if ex.Compression == Gzip {
+		features |= featureGzip
+	}
+	if ex.Limit > 0 {
+		features |= featureStopSending
+	}
+	if ex.Resilient {
+		features |= featureAcks
+	}
+	return features
+}
+
+func describeFeatures(features uint32) string {
+	names := []string{}
+	for i, name := range featureNames {
+		if features&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// writeHello writes the handshake of one side of a connection: the magic
+// number, followed by the protocol version and the bitmask of features
+func writeHello(w io.Writer, version byte, features uint32) error {
+	hello := make([]byte, len(handshakeMagic)+5)
+	copy(hello, handshakeMagic)
+	hello[len(handshakeMagic)] = version
+	binary.BigEndian.PutUint32(hello[len(handshakeMagic)+1:], features)
+	_, err := w.Write(hello)
+	return err
+}
+
+// readHello reads the handshake written by writeHello. Legacy peers are
+// detected by the first byte, which is their stream header instead of the
+// magic number
+func readHello(r io.Reader) (version byte, features uint32, err error) {
+	hello := make([]byte, len(handshakeMagic)+5)
+	_, err = io.ReadFull(r, hello[:1])
+	if err != nil {
+		return 0, 0, err
+	} else if hello[0] != handshakeMagic[0] {
+		return legacyProtocolVersion, 0, nil
+	}
+
+	_, err = io.ReadFull(r, hello[1:])
+	if err != nil {
+		return 0, 0, err
+	} else if string(hello[:len(handshakeMagic)]) != string(handshakeMagic) {
+		return 0, 0, fmt.Errorf("unrecognized handshake %q", hello[:len(handshakeMagic)])
+	}
+
+	features = binary.BigEndian.Uint32(hello[len(handshakeMagic)+1:])
+	return hello[len(handshakeMagic)], features, nil
+}
@@ -0,0 +1,99 @@
+package ep
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+)
+
+// Hashable is an optional interface of Data, hashing its values directly,
+// where other Data is hashed by the values of its Strings, which is slower
+// and might be lossy. It's used by HashRow and HashDataset, and by the
+// exchanges and Partitioners hashing rows, like Partition and
+// HashPartitioner. All of the built-in types implement it
+type Hashable interface {
+	Data
+
+	// Hash writes the row-th value into the hash, which is never null. Values
+	// of variable lengths must write their length before their content, such
+	// that values of several columns written one after the other can't
+	// collide. Equal values, by Less, must be written the same way
+	Hash(row int, h hash.Hash64)
+}
+
+// HashRow returns the hash of the row-th value of the data. See HashDataset
+func HashRow(data Data, row int) uint64 {
+	h := fnv.New64a()
+	writeValue(h, data, row, nil)
+	return h.Sum64()
+}
+
+// HashDataset returns the hash of the values of the provided columns of the
+// row-th row of the dataset, which must be within its width. Hashes are FNV-1a
+// without a seed, thus they're stable across processes and nodes, as long as
+// the Hash methods and Strings of the types don't change
+func HashDataset(ds Dataset, row int, cols []int) uint64 {
+	h := fnv.New64a()
+	for _, col := range cols {
+		writeValue(h, ds.At(col), row, nil)
+	}
+	return h.Sum64()
+}
+
+// hashRows returns the hashes of all of the rows of the data, as with
+// HashDataset, rendering the Strings of the columns that aren't Hashable once
+func hashRows(data Dataset, cols []int) []uint64 {
+	strs := make([][]string, len(cols))
+	for i, col := range cols {
+		if _, ok := data.At(col).(Hashable); !ok {
+			strs[i] = data.At(col).Strings()
+		}
+	}
+
+	res := make([]uint64, data.Len())
+	h := fnv.New64a()
+	for row := range res {
+		h.Reset()
+		for i, col := range cols {
+			writeValue(h, data.At(col), row, strs[i])
+		}
+		res[row] = h.Sum64()
+	}
+	return res
+}
+
+// writeValue writes the row-th value of the data into the hash, marking nulls
+// explicitly. Values of Data that isn't Hashable are written as strings, out
+// of strs when set or rendered otherwise
+func writeValue(h hash.Hash64, data Data, row int, strs []string) {
+	if data.IsNull(row) {
+		h.Write([]byte{0})
+		return
+	}
+
+	h.Write([]byte{1})
+	if d, ok := data.(Hashable); ok {
+		d.Hash(row, h)
+	} else if strs != nil {
+		hashString(h, strs[row])
+	} else {
+		hashString(h, data.Slice(row, row+1).Strings()[0])
+	}
+}
+
+func hashUint64(h hash.Hash64, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	h.Write(b[:])
+}
+
+// hashBytes writes the bytes into the hash, prefixed by their length
+func hashBytes(h hash.Hash64, b []byte) {
+	hashUint64(h, uint64(len(b)))
+	h.Write(b)
+}
+
+func hashString(h hash.Hash64, s string) {
+	hashUint64(h, uint64(len(s)))
+	h.Write([]byte(s))
+}
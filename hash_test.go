@@ -0,0 +1,140 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHashRow_equalValues(t *testing.T) {
+	for name, newFn := range newData {
+		t.Run(name, func(t *testing.T) {
+			data := newFn()
+			for i := 0; i < data.Len(); i++ {
+				for j := 0; j < data.Len(); j++ {
+					equal := ep.Compare(data, i, data, j) == 0
+					require.Equal(t, equal, ep.HashRow(data, i) == ep.HashRow(data, j), "rows %d and %d", i, j)
+				}
+			}
+
+			// the hashes don't depend on the position of the values
+			clone := data.Duplicate(2)
+			for i := 0; i < data.Len(); i++ {
+				require.Equal(t, ep.HashRow(data, i), ep.HashRow(clone, data.Len()+i))
+				require.Equal(t, ep.HashRow(data, i), ep.HashRow(data.Slice(i, i+1), 0))
+			}
+
+			hashes := map[uint64]bool{}
+			for i := 0; i < data.Len(); i++ {
+				hashes[ep.HashRow(data, i)] = true
+			}
+			if name != "strs" {
+				data.MarkNull(0)
+				require.False(t, hashes[ep.HashRow(data, 0)], "null collides with a value")
+			}
+		})
+	}
+}
+
+func TestHashRow_equalRepresentations(t *testing.T) {
+	t.Run("Float64s", func(t *testing.T) {
+		data := &ep.Float64s{Values: []float64{0, math.Copysign(0, -1), math.NaN(), -math.NaN()}}
+		require.Equal(t, ep.HashRow(data, 0), ep.HashRow(data, 1))
+		require.Equal(t, ep.HashRow(data, 2), ep.HashRow(data, 3))
+	})
+
+	t.Run("Timestamps", func(t *testing.T) {
+		v := epoch(1000)
+		data := &ep.Timestamps{Values: []time.Time{v, v.In(time.FixedZone("EDT", -4*60*60))}}
+		require.Equal(t, ep.HashRow(data, 0), ep.HashRow(data, 1))
+	})
+
+	t.Run("Dates", func(t *testing.T) {
+		data := &ep.Dates{Values: []time.Time{epoch(60), epoch(23 * 60 * 60)}}
+		require.Equal(t, ep.HashRow(data, 0), ep.HashRow(data, 1))
+	})
+
+	t.Run("Decimals", func(t *testing.T) {
+		d1, err := ep.ParseDecimals(10, 1, []string{"1.5", "-20", "0"})
+		require.NoError(t, err)
+		d2, err := ep.ParseDecimals(12, 4, []string{"1.5000", "-20.0000", "0.0000"})
+		require.NoError(t, err)
+		for i := 0; i < d1.Len(); i++ {
+			require.Equal(t, 0, ep.Compare(d1, i, d2, i))
+			require.Equal(t, ep.HashRow(d1, i), ep.HashRow(d2, i), d1.Strings()[i])
+		}
+
+		d3, err := ep.ParseDecimals(10, 1, []string{"-1.5", "15", "0.2", "2"})
+		require.NoError(t, err)
+		require.NotEqual(t, ep.HashRow(d1, 0), ep.HashRow(d3, 0))
+		require.NotEqual(t, ep.HashRow(d1, 0), ep.HashRow(d3, 1))
+		require.NotEqual(t, ep.HashRow(d3, 2), ep.HashRow(d3, 3))
+	})
+
+	t.Run("DictStrings", func(t *testing.T) {
+		d1, d2 := ep.EncodeDict([]string{"a", "b"}), ep.EncodeDict([]string{"b", "a"})
+		require.Equal(t, ep.HashRow(d1, 0), ep.HashRow(d2, 1))
+		require.Equal(t, ep.HashRow(d1, 0), ep.HashRow(strs{"a"}, 0), "differs from strings")
+	})
+}
+
+func TestHashDataset_columnCollisions(t *testing.T) {
+	tests := map[string][2]ep.Dataset{
+		"strs": {
+			ep.NewDataset(strs{"ab"}, strs{"c"}),
+			ep.NewDataset(strs{"a"}, strs{"bc"}),
+		},
+		"null and empty string": {
+			ep.NewDataset(ep.Null.Data(1), strs{""}),
+			ep.NewDataset(strs{""}, strs{""}),
+		},
+		"Blobs": {
+			ep.NewDataset(&ep.Blobs{Values: [][]byte{{1, 2}}}, &ep.Blobs{Values: [][]byte{{3}}}),
+			ep.NewDataset(&ep.Blobs{Values: [][]byte{{1}}}, &ep.Blobs{Values: [][]byte{{2, 3}}}),
+		},
+		"DictStrings": {
+			ep.NewDataset(ep.EncodeDict([]string{"ab"}), ep.EncodeDict([]string{"c"})),
+			ep.NewDataset(ep.EncodeDict([]string{"a"}), ep.EncodeDict([]string{"bc"})),
+		},
+		"swapped columns": {
+			ep.NewDataset(&ep.Int64s{Values: []int64{1}}, &ep.Int64s{Values: []int64{2}}),
+			ep.NewDataset(&ep.Int64s{Values: []int64{2}}, &ep.Int64s{Values: []int64{1}}),
+		},
+		"null columns": {
+			ep.NewDataset(ep.Null.Data(1), &ep.Int64s{Values: []int64{0}}),
+			ep.NewDataset(&ep.Int64s{Values: []int64{0}}, ep.Null.Data(1)),
+		},
+		"mixed types": {
+			ep.NewDataset(&ep.Bools{Values: []bool{true}}, strs{"a"}),
+			ep.NewDataset(strs{"a"}, &ep.Bools{Values: []bool{true}}),
+		},
+	}
+
+	for name, datasets := range tests {
+		t.Run(name, func(t *testing.T) {
+			h1 := ep.HashDataset(datasets[0], 0, []int{0, 1})
+			h2 := ep.HashDataset(datasets[1], 0, []int{0, 1})
+			require.NotEqual(t, h1, h2)
+		})
+	}
+}
+
+func TestHashDataset_columns(t *testing.T) {
+	data := ep.NewDataset(strs{"a", "b"}, &ep.Int64s{Values: []int64{1, 1}})
+
+	// rows are hashed only by the provided columns, in their order
+	require.Equal(t, ep.HashDataset(data, 0, []int{1}), ep.HashDataset(data, 1, []int{1}))
+	require.NotEqual(t, ep.HashDataset(data, 0, []int{0, 1}), ep.HashDataset(data, 1, []int{0, 1}))
+	require.NotEqual(t, ep.HashDataset(data, 0, []int{0, 1}), ep.HashDataset(data, 0, []int{1, 0}))
+	require.Equal(t, ep.HashRow(data.At(0), 1), ep.HashDataset(data, 1, []int{0}))
+}
+
+// Hashes are stable across processes and nodes, as they route rows between
+// them. Changing them changes the partitioning of existing clients
+func TestHashDataset_stable(t *testing.T) {
+	data := ep.NewDataset(strs{"a", ""}, &ep.Int64s{Values: []int64{42, 0}, Null: ep.NullMask{2}})
+	require.Equal(t, uint64(0x3ac29efa8ff91963), ep.HashDataset(data, 0, []int{0, 1}))
+	require.Equal(t, uint64(0x512de6c89da6cd44), ep.HashDataset(data, 1, []int{0, 1}))
+}
@@ -0,0 +1,104 @@
+package ep
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+var _ = registerGob(&heartbeat{})
+
+// PeerDeath is the behavior of an exchange upon detecting a dead peer, see
+// Heartbeat
+type PeerDeath byte
+
+const (
+	// AbortOnPeerDeath fails the exchange once any of its peers is dead
+	AbortOnPeerDeath PeerDeath = iota
+
+	// SkipDeadPeers stops receiving from dead peers, as if they've completed,
+	// while the exchange keeps receiving from all other peers
+	SkipDeadPeers
+)
+
+// Heartbeat sets an exchange Runner, returned by Scatter, Gather, Partition,
+// etc., to send a heartbeat over every one of its connections whenever it was
+// idle for the interval, and to consider peers dead once nothing was received
+// from them for the timeout.
+//
+// All nodes run the same exchange, but they might not all support heartbeats,
+// thus every stream declares whether it carries heartbeats in its header, and
+// dead peers are only detected on streams that do.
+func Heartbeat(r Runner, interval, timeout time.Duration, mode PeerDeath) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: Heartbeat expects an exchange")
+	}
+
+	ex.HeartbeatInterval = interval
+	ex.HeartbeatTimeout = timeout
+	ex.PeerDeath = mode
+	return ex
+}
+
+// heartbeatsFlag is set in the stream header when the stream carries
+// heartbeats
+const heartbeatsFlag = 0x80
+
+// streamFlags returns the flags of the stream header of all streams sent by the
+// exchange
+func (ex *exchange) streamFlags() (flags byte) {
+	if ex.HeartbeatInterval > 0 {
+		flags |= heartbeatsFlag
+	}
+	if ex.Checksums {
+		flags |= checksumsFlag
+	}
+	return flags
+}
+
+// heartbeat is a control message sent over idle connections, and discarded by
+// the receiving side
+type heartbeat struct {
+	Sent int64 // unix time in nanoseconds
+}
+
+func isHeartbeat(e interface{}) bool {
+	_, ok := e.(*req).Payload.(*heartbeat)
+	return ok
+}
+
+// idleDetector is implemented by connections that can detect when their peer
+// was idle for too long, once they're known to carry heartbeats
+type idleDetector interface {
+	detectIdle()
+}
+
+// peerDeadError is returned from reads of connections that didn't receive
+// anything, not even a heartbeat, for too long
+type peerDeadError struct {
+	addr string
+	idle time.Duration
+}
+
+func (err *peerDeadError) Error() string {
+	return fmt.Sprintf("ep: peer %s is dead, nothing received for %s", err.addr, err.idle)
+}
+
+// exhausted returns true if a source connection that failed to decode with err
+// should be removed, and the exchange should keep receiving from the others.
+// Sources removed due to other errors than EOF are recorded as skipped
+func (ex *exchange) exhausted(dec decoder, err error) bool {
+	if err == io.EOF {
+		return true
+	}
+
+	_, isDead := err.(*peerDeadError)
+	_, isPeerErr := err.(*errMsg)
+	skip := isDead && ex.PeerDeath == SkipDeadPeers
+	skip = skip || (ex.BestEffort || ex.Resilient) && err != nil && !isPeerErr
+	if skip {
+		ex.skipSource(dec, err)
+	}
+	return skip
+}
@@ -0,0 +1,96 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"testing"
+	"unsafe"
+)
+
+var internStrings = ep.NewSliceType[string]("test_intern_string")
+
+func TestIntern(t *testing.T) {
+	values := lowCardinality(100)
+	data := internStrings.Of(values...)
+	data.MarkNull(3)
+	all := []ep.Data{
+		data,
+		ep.EncodeDict(values),
+		ep.Constant(internStrings.Of(values[0]), 4),
+		ep.NewLists(data, 5, 0, 95),
+		ep.NewStructs([]string{"a", "b"}, data, ep.EncodeDict(values)),
+		ep.NewDataset(data, ep.EncodeDict(values)),
+		&ep.Int64s{Values: []int64{1, 2}}, // returned as is
+	}
+
+	for _, data := range all {
+		res := ep.Intern(data)
+		require.Equal(t, data.Type(), res.Type())
+		require.Equal(t, data.Strings(), res.Strings())
+		if _, ok := data.(ep.Dataset); ok {
+			continue // compared by its Strings, of the columns
+		}
+
+		require.Equal(t, data.Nulls(), res.Nulls())
+		for i := 0; i < data.Len(); i++ {
+			require.Equal(t, 0, ep.Compare(data, i, res, i), "%s row %d", data.Type(), i)
+		}
+	}
+
+	res := ep.Intern(data).(*ep.SliceData[string])
+	require.Same(t, unsafe.StringData(res.Values[0]), unsafe.StringData(res.Values[50]))
+	require.NotSame(t, unsafe.StringData(data.Values[0]), unsafe.StringData(data.Values[50]))
+}
+
+func TestIntern_memory(t *testing.T) {
+	const n = 100000
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	data := ep.Data(internStrings.Of(lowCardinality(n)...))
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	raw := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+
+	data = ep.Intern(data)
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	interned := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+	runtime.KeepAlive(data)
+
+	t.Logf("%d strings retain %d bytes, and %d bytes once interned", n, raw, interned)
+	require.True(t, interned < raw/2, "%d bytes interned, %d bytes before", interned, raw)
+}
+
+func TestInternRunner(t *testing.T) {
+	cluster := eptest.InMemoryCluster(2)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	values := lowCardinality(4)
+	data := ep.NewDataset(ep.EncodeDict(values), internStrings.Of(values...))
+	runner := cluster.Distribute(ep.Pipeline(ep.Broadcast(), ep.Gather(), ep.InternRunner(1)))
+	res, err := eptest.Run(runner, data)
+	require.NoError(t, err)
+	require.Equal(t, append(values, values...), res.At(1).Strings())
+	require.Equal(t, res.At(0).Strings(), res.At(1).Strings())
+
+	// the strings of the batches of both nodes are shared
+	interned := res.At(1).(*ep.SliceData[string]).Values
+	require.Same(t, unsafe.StringData(interned[0]), unsafe.StringData(interned[4]))
+
+	// up to the max size
+	limited := ep.Pipeline(ep.InternRunner(1, ep.InternMaxSize(1)))
+	other := ep.NewDataset(ep.EncodeDict(values), internStrings.Of(lowCardinality(4)...))
+	res, err = eptest.Run(limited, data, other)
+	require.NoError(t, err)
+	interned = res.At(1).(*ep.SliceData[string]).Values
+	require.Same(t, unsafe.StringData(interned[0]), unsafe.StringData(interned[4]))
+	require.NotSame(t, unsafe.StringData(interned[1]), unsafe.StringData(interned[5]))
+
+	_, err = eptest.Run(ep.InternRunner(2), data)
+	require.Error(t, err)
+	require.Equal(t, "ep: intern column 2 out of range for 2 columns", err.Error())
+}
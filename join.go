@@ -0,0 +1,339 @@
+package ep
+
+import (
+	"context"
+	"fmt"
+)
+
+var _ = registerGob(&join{})
+
+// DefaultJoinMaxRows is the default maximum number of rows of the build side
+// of Join, retained in its hash table
+const DefaultJoinMaxRows = 1 << 22
+
+// JoinType is the type of Join, by the rows output for probe rows without any
+// matching build rows
+type JoinType int
+
+const (
+	// InnerJoin outputs the matching rows alone
+	InnerJoin JoinType = iota
+
+	// LeftJoin also outputs every probe row without any matching build rows,
+	// followed by nulls in the place of the build columns
+	LeftJoin
+)
+
+// Join returns a Runner of the equi-join of the outputs of the left and right
+// runners, by the values of their leftCols and rightCols, respectively, which
+// must be of the same types. Both runners receive the input of the Join, as
+// with Union. The right runner is the build side, which runs to completion
+// into a hash table of its key columns, before the left runner runs as the
+// probe side, thus the input is retained until then. Every probe row is output
+// once for every one of the build rows of its key, with the columns of the
+// left runner followed by the ones of the right runner, while the unmatched
+// probe rows of a LeftJoin follow the matched ones of their dataset. Null
+// keys, of nulls in any of their columns, don't match any rows.
+//
+// The build side is limited to DefaultJoinMaxRows rows, unless set with
+// JoinMaxRows, and the Join fails once it's exceeded. When both runners end
+// with a Shuffle of their key columns, every node joins the rows of its keys,
+// into a distributed join
+func Join(left, right Runner, leftCols, rightCols []int, joinType JoinType) (Runner, error) {
+	if len(leftCols) == 0 || len(leftCols) != len(rightCols) {
+		return nil, fmt.Errorf("ep: join of %d and %d key columns", len(leftCols), len(rightCols))
+	}
+
+	return &join{
+		Left:      left,
+		Right:     right,
+		LeftCols:  leftCols,
+		RightCols: rightCols,
+		Type:      joinType,
+		MaxRows:   DefaultJoinMaxRows,
+	}, nil
+}
+
+// JoinMaxRows sets the maximum number of rows of the build side of a Runner
+// returned by Join. A non-positive number doesn't limit it
+func JoinMaxRows(r Runner, rows int) Runner {
+	j, ok := r.(*join)
+	if !ok {
+		panic("ep: JoinMaxRows expects a Join")
+	}
+
+	j.MaxRows = rows
+	return j
+}
+
+type join struct {
+	Left      Runner
+	Right     Runner
+	LeftCols  []int
+	RightCols []int
+	Type      JoinType
+	MaxRows   int
+}
+
+func (r *join) Returns() []Type {
+	return append(append([]Type{}, r.Left.Returns()...), r.Right.Returns()...)
+}
+
+func (r *join) Run(ctx context.Context, inp, out chan Dataset) (err error) {
+	defer func() {
+		// in case of error - drain input
+		for range inp {
+		}
+	}()
+
+	// forward the input to the build side, and retain it for the probe side
+	var retained []Dataset
+	buildInp, buildOut := make(chan Dataset), make(chan Dataset)
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		defer close(buildInp)
+		for data := range inp {
+			retained = append(retained, data)
+			buildInp <- data
+		}
+	}()
+
+	var buildErr error
+	go func() {
+		defer close(buildOut)
+		buildErr = runSafe(ctx, r.Right, buildInp, buildOut)
+	}()
+
+	table := newJoinTable()
+	for data := range buildOut {
+		if err == nil {
+			err = table.add(data, r.RightCols, r.MaxRows)
+		}
+	}
+
+	// the build side might have returned before its input was completed
+	go func() {
+		for range buildInp {
+		}
+	}()
+	<-forwarded
+	if buildErr != nil {
+		return buildErr
+	} else if err != nil {
+		return err
+	}
+
+	probeInp, probeOut := make(chan Dataset, len(retained)), make(chan Dataset)
+	for _, data := range retained {
+		probeInp <- data
+	}
+	close(probeInp)
+
+	var probeErr error
+	go func() {
+		defer close(probeOut)
+		probeErr = runSafe(ctx, r.Left, probeInp, probeOut)
+	}()
+
+	table.build()
+	for data := range probeOut {
+		if err != nil {
+			continue // drain
+		}
+
+		var res Dataset
+		res, err = r.probe(table, data)
+		if err == nil && res.Len() > 0 {
+			out <- res
+		}
+	}
+
+	if probeErr != nil {
+		return probeErr
+	}
+	return err
+}
+
+// probe returns the joined rows of the data, of the probe side
+func (r *join) probe(table *joinTable, data Dataset) (Dataset, error) {
+	if err := checkJoinColumns(data, r.LeftCols); err != nil {
+		return nil, err
+	}
+
+	keys := selectColumns(data, r.LeftCols)
+	var matched, rows, unmatched []int
+	if table.rows != nil {
+		for i := range r.LeftCols {
+			t1, t2 := keys.At(i).Type(), table.rows.At(r.RightCols[i]).Type()
+			if !isEqualType(t1, t2) {
+				return nil, fmt.Errorf("ep: join of key columns of %s and %s", t1, t2)
+			}
+		}
+
+		for i, id := range table.keys.lookup(keys) {
+			if id < 0 {
+				unmatched = append(unmatched, i)
+				continue
+			}
+
+			for _, row := range table.matches[id] {
+				matched, rows = append(matched, i), append(rows, row)
+			}
+		}
+	} else {
+		unmatched = allRows(data.Len())
+	}
+
+	var res []Dataset
+	if len(matched) > 0 {
+		res = append(res, concatColumns(take(data, matched).(Dataset), take(table.rows, rows).(Dataset)))
+	}
+	if r.Type == LeftJoin && len(unmatched) > 0 {
+		res = append(res, concatColumns(take(data, unmatched).(Dataset), r.nulls(table, len(unmatched))))
+	}
+
+	if len(res) == 0 {
+		return take(data, nil).(Dataset), nil
+	}
+	return ConcatDatasets(res...), nil
+}
+
+// nulls returns a dataset of n rows of nulls in all of the columns of the build
+// side, of their types, or of the types of its Returns when it had no rows
+func (r *join) nulls(table *joinTable, n int) Dataset {
+	if table.rows != nil {
+		return nullColumns(datasetTypes(table.rows), n)
+	}
+	return nullColumns(r.Right.Returns(), n)
+}
+
+// nullColumns returns a dataset of n rows of nulls in columns of the types,
+// where wildcards are of the Null type
+func nullColumns(types []Type, n int) Dataset {
+	cols := make([]Data, len(types))
+	for i, t := range types {
+		if _, ok := t.(*wildcardType); ok || isAny(t) {
+			cols[i] = Null.Data(n)
+			continue
+		}
+
+		cols[i] = t.Data(n)
+		for row := 0; row < n; row++ {
+			cols[i].MarkNull(row)
+		}
+	}
+	return NewDataset(cols...)
+}
+
+// datasetTypes returns the types of the columns of the dataset
+func datasetTypes(ds Dataset) []Type {
+	types := make([]Type, ds.Width())
+	for i := range types {
+		types[i] = ds.At(i).Type()
+	}
+	return types
+}
+
+// joinTable is the hash table of the build side of Join, of the numbers of its
+// keys, and the indices of the rows of every one of them
+type joinTable struct {
+	keys    *keySet
+	matches [][]int   // the rows of every key, by its number
+	batches []Dataset // the datasets of the rows, until the table is built
+	n       int       // the number of rows
+	rows    Dataset   // of all of the batches, once built, or nil without them
+}
+
+func newJoinTable() *joinTable {
+	return &joinTable{keys: newKeySet()}
+}
+
+// add adds the rows of the data to the table, except for the ones of null keys,
+// failing when the number of the rows exceeds the max rows, when positive.
+// Empty datasets are ignored
+func (t *joinTable) add(data Dataset, cols []int, maxRows int) error {
+	if data.Len() == 0 {
+		return nil
+	}
+
+	if err := checkJoinColumns(data, cols); err != nil {
+		return err
+	}
+
+	keys := selectColumns(data, cols)
+	var valid []int
+	for i := 0; i < keys.Len(); i++ {
+		if !hasNulls(keys, i) {
+			valid = append(valid, i)
+		}
+	}
+
+	if maxRows > 0 && t.n+len(valid) > maxRows {
+		return fmt.Errorf("ep: join build side exceeds the limit of %d rows", maxRows)
+	}
+
+	ids, _ := t.keys.add(takeRows(keys, valid))
+	for i, id := range ids {
+		if id == len(t.matches) {
+			t.matches = append(t.matches, nil)
+		}
+		t.matches[id] = append(t.matches[id], t.n+i)
+	}
+
+	t.n += len(valid)
+	t.batches = append(t.batches, takeRows(data, valid))
+	return nil
+}
+
+// build concatenates the batches of the rows into a single dataset
+func (t *joinTable) build() {
+	if len(t.batches) > 0 {
+		t.rows = ConcatDatasets(t.batches...)
+		t.batches = nil
+	}
+}
+
+// checkJoinColumns verifies that the key columns are within the width of the
+// data
+func checkJoinColumns(data Dataset, cols []int) error {
+	for _, col := range cols {
+		if col < 0 || col >= data.Width() {
+			return fmt.Errorf("ep: join column %d out of range for %d columns", col, data.Width())
+		}
+	}
+	return nil
+}
+
+// hasNulls reports whether any of the columns of the row-th row of the dataset
+// is null
+func hasNulls(ds Dataset, row int) bool {
+	for i := 0; i < ds.Width(); i++ {
+		if ds.At(i).IsNull(row) {
+			return true
+		}
+	}
+	return false
+}
+
+// concatColumns returns a dataset of the columns of a followed by the ones of
+// b, which are of the same length
+func concatColumns(a, b Dataset) Dataset {
+	cols := make([]Data, 0, a.Width()+b.Width())
+	for i := 0; i < a.Width(); i++ {
+		cols = append(cols, a.At(i))
+	}
+	for i := 0; i < b.Width(); i++ {
+		cols = append(cols, b.At(i))
+	}
+	return NewDataset(cols...)
+}
+
+// allRows returns the indices of all of the n rows
+func allRows(n int) []int {
+	res := make([]int, n)
+	for i := range res {
+		res[i] = i
+	}
+	return res
+}
@@ -0,0 +1,128 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+)
+
+func TestJoin(t *testing.T) {
+	// duplicate keys on both sides, and null keys on both sides
+	data := ep.NewDataset(
+		&ep.Int64s{Values: []int64{1, 2, 2, 3, 0}, Null: ep.NullMask{16}},
+		strs{"a", "b", "c", "d", "e"},
+		&ep.Int64s{Values: []int64{2, 2, 1, 0, 4}, Null: ep.NullMask{8}},
+		&ep.Int64s{Values: []int64{10, 20, 30, 40, 50}},
+	)
+
+	inner, err := ep.Join(ep.Pick(0, 1), ep.Pick(2, 3), []int{0}, []int{0}, ep.InnerJoin)
+	require.NoError(t, err)
+	res, err := eptest.Run(inner, data)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[1 2 2 2 2]", "[a b b c c]", "[1 2 2 2 2]", "[30 10 20 10 20]"}, res.Strings())
+
+	left, err := ep.Join(ep.Pick(0, 1), ep.Pick(2, 3), []int{0}, []int{0}, ep.LeftJoin)
+	require.NoError(t, err)
+	res, err = eptest.Run(left, data.Slice(0, 2).(ep.Dataset), data.Slice(2, 5).(ep.Dataset))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[1 2 2 2 2 3 ]", "[a b b c c d e]", "[1 2 2 2 2  ]", "[30 10 20 10 20  ]"}, res.Strings())
+
+	// by several columns
+	multi, err := ep.Join(ep.PassThrough(), ep.Pick(2, 3, 1), []int{1, 0}, []int{2, 0}, ep.InnerJoin)
+	require.NoError(t, err)
+	res, err = eptest.Run(multi, ep.NewDataset(
+		&ep.Int64s{Values: []int64{1, 2, 2}}, strs{"a", "b", "c"}, &ep.Int64s{Values: []int64{2, 1, 2}}, &ep.Int64s{Values: []int64{7, 8, 9}},
+	))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[2]", "[c]", "[2]", "[9]", "[2]", "[9]", "[c]"}, res.Strings())
+}
+
+func TestJoin_empty(t *testing.T) {
+	left, err := ep.Join(ep.PassThrough(), &dataRunner{Dataset: ep.NewDataset()}, []int{0}, []int{0}, ep.LeftJoin)
+	require.NoError(t, err)
+	res, err := eptest.Run(left, ep.NewDataset(strs{"a", "b"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[a b]"}, res.Strings())
+
+	inner, err := ep.Join(ep.Pick(0), ep.Pick(0), []int{0}, []int{0}, ep.InnerJoin)
+	require.NoError(t, err)
+	res, err = eptest.Run(inner)
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Len())
+}
+
+func TestJoin_errors(t *testing.T) {
+	_, err := ep.Join(ep.Pick(0), ep.Pick(0), []int{0}, []int{0, 1}, ep.InnerJoin)
+	require.Error(t, err)
+	require.Equal(t, "ep: join of 1 and 2 key columns", err.Error())
+
+	data := ep.NewDataset(strs{"a", "b", "c"}, &ep.Int64s{Values: []int64{1, 2, 0}, Null: ep.NullMask{4}})
+	j, err := ep.Join(ep.Pick(0), ep.Pick(1), []int{0}, []int{0}, ep.InnerJoin)
+	require.NoError(t, err)
+	_, err = eptest.Run(j, data)
+	require.Error(t, err)
+	require.Equal(t, "ep: join of key columns of string and int64", err.Error())
+
+	// the null key isn't retained, thus it isn't counted
+	_, err = eptest.Run(ep.JoinMaxRows(j, 1), data)
+	require.Error(t, err)
+	require.Equal(t, "ep: join build side exceeds the limit of 1 rows", err.Error())
+
+	j, err = ep.Join(ep.Pick(1), ep.Pick(1), []int{0}, []int{0}, ep.InnerJoin)
+	require.NoError(t, err)
+	res, err := eptest.Run(ep.JoinMaxRows(j, 2), data)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[1 2]", "[1 2]"}, res.Strings())
+
+	j, err = ep.Join(ep.Pick(0), ep.Pick(1), []int{0}, []int{1}, ep.InnerJoin)
+	require.NoError(t, err)
+	_, err = eptest.Run(j, data)
+	require.Error(t, err)
+	require.Equal(t, "ep: join column 1 out of range for 1 columns", err.Error())
+
+	j, err = ep.Join(ep.Pick(0), ep.Pick(0), []int{1}, []int{0}, ep.InnerJoin)
+	require.NoError(t, err)
+	_, err = eptest.Run(j, data)
+	require.Error(t, err)
+	require.Equal(t, "ep: join column 1 out of range for 1 columns", err.Error())
+	require.Panics(t, func() { ep.JoinMaxRows(ep.PassThrough(), 1) })
+}
+
+// Shuffling both sides by their keys joins the rows of every key on its node,
+// as a single node joins all of them
+func TestJoin_distributed(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	rnd := rand.New(rand.NewSource(87))
+	var datasets []ep.Dataset
+	for i := 0; i < 10; i++ {
+		datasets = append(datasets, ep.NewDataset(randomInts(rnd, 50), randomInts(rnd, 50), randomInts(rnd, 50), randomInts(rnd, 50)))
+	}
+
+	newJoin := func(shuffle bool) ep.Runner {
+		left, right := ep.Pick(0, 1), ep.Pick(2, 3)
+		if shuffle {
+			left, right = ep.Pipeline(left, ep.Shuffle(0)), ep.Pipeline(right, ep.Shuffle(0))
+		}
+		j, err := ep.Join(left, right, []int{0}, []int{0}, ep.LeftJoin)
+		require.NoError(t, err)
+		return j
+	}
+
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), newJoin(true), ep.Gather()))
+	res, err := eptest.Run(runner, datasets...)
+	require.NoError(t, err)
+	expected, err := eptest.Run(newJoin(false), datasets...)
+	require.NoError(t, err)
+	require.True(t, expected.Len() > 500, "%d rows", expected.Len())
+
+	cols := []ep.SortingCol{{Index: 0}, {Index: 1}, {Index: 3}}
+	expected, err = ep.SortDataset(expected, cols)
+	require.NoError(t, err)
+	res, err = ep.SortDataset(res, cols)
+	require.NoError(t, err)
+	require.Equal(t, expected.Strings(), res.Strings())
+}
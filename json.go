@@ -0,0 +1,228 @@
+package ep
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONData is an optional interface of Data, marshaling its values into JSON
+// natively, like numbers as JSON numbers. Other Data is marshaled by its
+// Strings, as JSON strings, and unmarshaled by casting them, as with Cast. All
+// of the built-in types implement it
+type JSONData interface {
+	Data
+
+	// MarshalJSONValue returns the JSON of the row-th value, which isn't null
+	MarshalJSONValue(row int) ([]byte, error)
+
+	// UnmarshalJSONValue sets the row-th value to the JSON value, which isn't
+	// null, as returned by MarshalJSONValue
+	UnmarshalJSONValue(row int, b []byte) error
+}
+
+// JSONOptions are the options of the JSON of datasets. The zero value is the
+// row-oriented JSON, used by the MarshalJSON of datasets:
+//
+//	[[1,"a"],[2,null]]
+//
+// Column-oriented JSON is an object of the values of every column, by its
+// name, in the order of the columns:
+//
+//	{"col0":[1,2],"col1":["a",null]}
+type JSONOptions struct {
+	Columns bool     // column-oriented, rather than row-oriented
+	Names   []string // names of the columns when column-oriented, or col0, col1, etc.
+}
+
+func (opts JSONOptions) name(col int) string {
+	if col < len(opts.Names) {
+		return opts.Names[col]
+	}
+	return "col" + strconv.Itoa(col)
+}
+
+// MarshalDatasetJSON returns the JSON of the dataset, as set by the options.
+// Nulls are JSON nulls
+func MarshalDatasetJSON(ds Dataset, opts JSONOptions) ([]byte, error) {
+	cols := make([][][]byte, ds.Width())
+	for i := range cols {
+		var err error
+		cols[i], err = marshalJSONValues(ds.At(i))
+		if err != nil {
+			return nil, fmt.Errorf("ep: column %d: %s", i, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if opts.Columns {
+		buf.WriteByte('{')
+		for i, values := range cols {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			name, _ := json.Marshal(opts.name(i))
+			buf.Write(name)
+			buf.WriteByte(':')
+			writeJSONArray(&buf, values)
+		}
+		buf.WriteByte('}')
+		return buf.Bytes(), nil
+	}
+
+	buf.WriteByte('[')
+	for row := 0; row < ds.Len(); row++ {
+		if row > 0 {
+			buf.WriteByte(',')
+		}
+
+		values := make([][]byte, len(cols))
+		for i := range cols {
+			values[i] = cols[i][row]
+		}
+		writeJSONArray(&buf, values)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalDatasetJSON returns the dataset of the JSON, as set by the options,
+// with columns of the types. Column-oriented JSON must have all of the columns,
+// by their names, and row-oriented JSON must have a value of every column in
+// every row
+func UnmarshalDatasetJSON(b []byte, types []Type, opts JSONOptions) (Dataset, error) {
+	cols := make([][]json.RawMessage, len(types))
+	if opts.Columns {
+		var obj map[string][]json.RawMessage
+		if err := json.Unmarshal(b, &obj); err != nil {
+			return nil, fmt.Errorf("ep: %s", err)
+		}
+
+		for i := range cols {
+			values, ok := obj[opts.name(i)]
+			if !ok {
+				return nil, fmt.Errorf("ep: missing column %q", opts.name(i))
+			} else if i > 0 && len(values) != len(cols[0]) {
+				return nil, fmt.Errorf("ep: column %q has %d rows, expected %d", opts.name(i), len(values), len(cols[0]))
+			}
+			cols[i] = values
+		}
+	} else {
+		var rows [][]json.RawMessage
+		if err := json.Unmarshal(b, &rows); err != nil {
+			return nil, fmt.Errorf("ep: %s", err)
+		}
+
+		for i := range cols {
+			cols[i] = make([]json.RawMessage, len(rows))
+		}
+		for row, values := range rows {
+			if len(values) != len(types) {
+				return nil, fmt.Errorf("ep: row %d has %d values, expected %d", row, len(values), len(types))
+			}
+			for i, v := range values {
+				cols[i][row] = v
+			}
+		}
+	}
+
+	res := make([]Data, len(types))
+	for i, t := range types {
+		var err error
+		res[i], err = unmarshalJSONValues(cols[i], t)
+		if err != nil {
+			return nil, fmt.Errorf("ep: column %d: %s", i, err)
+		}
+	}
+	return NewDataset(res...), nil
+}
+
+// MarshalJSON returns the row-oriented JSON of the dataset. See JSONOptions
+func (set dataset) MarshalJSON() ([]byte, error) {
+	return MarshalDatasetJSON(set, JSONOptions{})
+}
+
+var jsonNull = []byte("null")
+
+// marshalJSONValues returns the JSON of every value of the data
+func marshalJSONValues(data Data) ([][]byte, error) {
+	res := make([][]byte, data.Len())
+	d, ok := data.(JSONData)
+	var strs []string
+	if !ok {
+		strs = data.Strings()
+	}
+
+	for i := range res {
+		var err error
+		if data.IsNull(i) {
+			res[i] = jsonNull
+		} else if ok {
+			res[i], err = d.MarshalJSONValue(i)
+		} else {
+			res[i], err = json.Marshal(strs[i])
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %s", i, err)
+		}
+	}
+	return res, nil
+}
+
+// unmarshalJSONValues returns the Data of the type of the JSON values
+func unmarshalJSONValues(values []json.RawMessage, t Type) (Data, error) {
+	res := t.Data(len(values))
+	if d, ok := res.(JSONData); ok {
+		for i, v := range values {
+			if bytes.Equal(v, jsonNull) {
+				res.MarkNull(i)
+			} else if err := d.UnmarshalJSONValue(i, v); err != nil {
+				return nil, fmt.Errorf("row %d: %s", i, err)
+			}
+		}
+		return res, nil
+	}
+
+	// cast the strings into the type
+	strs := make([]string, len(values))
+	var nulls NullMask
+	for i, v := range values {
+		if bytes.Equal(v, jsonNull) {
+			nulls.Set(i, true)
+		} else if err := json.Unmarshal(v, &strs[i]); err != nil {
+			return nil, fmt.Errorf("row %d: %s", i, err)
+		}
+	}
+
+	data := EncodeDict(strs)
+	data.Null = nulls
+	res, err := Cast(data, t)
+	if err != nil {
+		return nil, errors.New(strings.TrimPrefix(err.Error(), "ep: "))
+	}
+	return res, nil
+}
+
+func writeJSONArray(buf *bytes.Buffer, values [][]byte) {
+	buf.WriteByte('[')
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte(']')
+}
+
+// unquoteJSON returns the string of a JSON string, or the JSON otherwise
+func unquoteJSON(b []byte) []byte {
+	var s string
+	if len(b) > 0 && b[0] == '"' && json.Unmarshal(b, &s) == nil {
+		return []byte(s)
+	}
+	return b
+}
@@ -0,0 +1,114 @@
+package ep_test
+
+import (
+	"encoding/json"
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+func TestMarshalDatasetJSON(t *testing.T) {
+	dec, err := ep.ParseDecimals(30, 2, []string{"12345678901234567890.25", ""})
+	require.NoError(t, err)
+	data := ep.NewDataset(
+		&ep.Int64s{Values: []int64{1, 2}, Null: ep.NullMask{2}},
+		&ep.Float64s{Values: []float64{0.5, math.Inf(-1)}},
+		&ep.Bools{Values: []bool{true, false}},
+		dec,
+		strs{"a", `"b"`},
+		ep.Null.Data(2),
+	)
+
+	b, err := json.Marshal(data)
+	require.NoError(t, err)
+	require.Equal(t, `[[1,0.5,true,12345678901234567890.25,"a",null],[null,"-Inf",false,null,"\"b\"",null]]`, string(b))
+
+	b, err = ep.MarshalDatasetJSON(data, ep.JSONOptions{Columns: true, Names: []string{"id", "score"}})
+	require.NoError(t, err)
+	expected := `{"id":[1,null],"score":[0.5,"-Inf"],"col2":[true,false],` +
+		`"col3":[12345678901234567890.25,null],"col4":["a","\"b\""],"col5":[null,null]}`
+	require.Equal(t, expected, string(b))
+
+	b, err = json.Marshal(ep.NewDataset())
+	require.NoError(t, err)
+	require.Equal(t, `[]`, string(b))
+}
+
+func TestUnmarshalDatasetJSON_roundTrip(t *testing.T) {
+	for name, newFn := range newData {
+		for _, opts := range []ep.JSONOptions{{}, {Columns: true}} {
+			t.Run(name, func(t *testing.T) {
+				data := newFn()
+				if name != "strs" {
+					data.MarkNull(1)
+				}
+				ds := ep.NewDataset(data, ep.Null.Data(data.Len()), data)
+
+				b, err := ep.MarshalDatasetJSON(ds, opts)
+				require.NoError(t, err)
+				require.True(t, json.Valid(b), string(b))
+
+				types := []ep.Type{data.Type(), ep.Null, data.Type()}
+				res, err := ep.UnmarshalDatasetJSON(b, types, opts)
+				require.NoError(t, err)
+				require.Equal(t, 3, res.Width())
+				for i := 0; i < res.Width(); i++ {
+					require.Equal(t, ds.At(i).Type(), res.At(i).Type())
+					require.Equal(t, ds.At(i).Strings(), res.At(i).Strings())
+					require.Equal(t, ds.At(i).Nulls(), res.At(i).Nulls())
+				}
+				for i := 0; i < data.Len(); i++ {
+					require.Equal(t, 0, ep.Compare(data, i, res.At(0), i))
+				}
+			})
+		}
+	}
+}
+
+func TestUnmarshalDatasetJSON_values(t *testing.T) {
+	types := []ep.Type{ep.Float64, ep.Decimal(10, 2), ep.Timestamp, ep.Date, ep.Bytes}
+	b := `[["NaN","1.5","2020-01-02T03:04:05.5+02:00","2020-01-02","AAE="],[1e3,-3,null,null,""]]`
+	res, err := ep.UnmarshalDatasetJSON([]byte(b), types, ep.JSONOptions{})
+	require.NoError(t, err)
+
+	require.True(t, math.IsNaN(res.At(0).(*ep.Float64s).Values[0]))
+	require.Equal(t, []string{"NaN", "1000"}, res.At(0).Strings())
+	require.Equal(t, []string{"1.50", "-3.00"}, res.At(1).Strings())
+	require.Equal(t, []string{"2020-01-02T03:04:05.5+02:00", ""}, res.At(2).Strings())
+	require.Equal(t, []string{"2020-01-02", ""}, res.At(3).Strings())
+	require.Equal(t, [][]byte{{0, 1}, {}}, res.At(4).(*ep.Blobs).Values)
+}
+
+func TestUnmarshalDatasetJSON_errors(t *testing.T) {
+	types := []ep.Type{ep.Int64, ep.Bool}
+	tests := []struct {
+		json     string
+		opts     ep.JSONOptions
+		expected string
+	}{
+		{`[[1,true],[2]]`, ep.JSONOptions{}, "ep: row 1 has 1 values, expected 2"},
+		{`[[1,true],["a",false]]`, ep.JSONOptions{}, `ep: column 0: row 1: strconv.ParseInt: parsing "\"a\"": invalid syntax`},
+		{`[[1,1]]`, ep.JSONOptions{}, "ep: column 1: row 0: json: cannot unmarshal number into Go value of type bool"},
+		{`{"col0":[1]}`, ep.JSONOptions{Columns: true}, `ep: missing column "col1"`},
+		{`{"a":[1],"b":[true,false]}`, ep.JSONOptions{Columns: true, Names: []string{"a", "b"}}, `ep: column "b" has 2 rows, expected 1`},
+		{`{`, ep.JSONOptions{}, "ep: unexpected end of JSON input"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			_, err := ep.UnmarshalDatasetJSON([]byte(test.json), types, test.opts)
+			require.Error(t, err)
+			require.Equal(t, test.expected, err.Error())
+		})
+	}
+
+	// Data that isn't JSONData is cast from strings
+	_, err := ep.UnmarshalDatasetJSON([]byte(`[[1]]`), []ep.Type{str}, ep.JSONOptions{})
+	require.Error(t, err)
+	require.Equal(t, "ep: column 0: row 0: json: cannot unmarshal number into Go value of type string", err.Error())
+
+	_, err = ep.UnmarshalDatasetJSON([]byte(`[["a"]]`), []ep.Type{int32s}, ep.JSONOptions{})
+	require.Error(t, err)
+	require.Equal(t, "ep: column 0: row 0: json: cannot unmarshal string into Go value of type int32", err.Error())
+}
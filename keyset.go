@@ -0,0 +1,150 @@
+package ep
+
+// keyRowSize is the estimated number of bytes of every key retained by a
+// keySet, beyond the size of its values, for its entry in the hash table
+const keyRowSize = 32
+
+// keyHashRows hashes the keys of a keySet, replaced by tests to force
+// collisions
+var keyHashRows = hashRows
+
+// keySet is a hash set of the keys of rows, of any number of columns, which
+// are numbered in the order they're added. Keys of equal hashes are told apart
+// by their values, and nulls are equal to each other. The keys are retained as
+// datasets of the rows added, one per batch. It's used by Distinct, GroupBy
+// and Join
+type keySet struct {
+	sets []Dataset        // the retained keys
+	refs []keyRef         // of every key, by its number
+	ids  map[uint64][]int // the numbers of the keys, by their hashes
+	size uint64           // the approximate number of bytes retained
+
+	// the keys of the batch being added, and the indices of its rows added
+	// so far, which are retained once the batch is added
+	pending        Dataset
+	pendingIndices []int
+}
+
+// keyRef is the index of a retained key in its dataset. For a pending key,
+// it's the index of its row within the pending indices
+type keyRef struct{ set, row int }
+
+func newKeySet() *keySet {
+	return &keySet{ids: make(map[uint64][]int)}
+}
+
+// len returns the number of keys in the set
+func (s *keySet) len() int { return len(s.refs) }
+
+// add adds the rows of the keys to the set, and returns the number of the key
+// of every row, along with the indices of the rows of the keys that weren't in
+// the set before, nor earlier in the keys
+func (s *keySet) add(keys Dataset) (ids []int, added []int) {
+	s.pending, s.pendingIndices = keys, nil
+	cur, all := len(s.sets), allColumns(keys)
+	ids = make([]int, keys.Len())
+	for i, h := range keyHashRows(keys, all) {
+		ids[i] = s.find(h, keys, i, all)
+		if ids[i] < 0 {
+			ids[i] = len(s.refs)
+			s.ids[h] = append(s.ids[h], len(s.refs))
+			s.refs = append(s.refs, keyRef{cur, len(s.pendingIndices)})
+			s.pendingIndices = append(s.pendingIndices, i)
+		}
+	}
+
+	added = s.pendingIndices
+	s.pending, s.pendingIndices = nil, nil
+	if len(added) > 0 {
+		keys = takeRows(keys, added)
+		s.sets = append(s.sets, keys)
+		s.size += DatasetSize(keys) + uint64(len(added))*keyRowSize
+	}
+	return ids, added
+}
+
+// missing returns the indices of the rows of the keys that aren't in the set,
+// without adding them to it
+func (s *keySet) missing(keys Dataset) []int {
+	var res []int
+	for i, id := range s.lookup(keys) {
+		if id < 0 {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// lookup returns the number of the key of every row of the keys, or -1 for the
+// rows that aren't in the set, without adding them to it
+func (s *keySet) lookup(keys Dataset) []int {
+	all := allColumns(keys)
+	hashes := keyHashRows(keys, all)
+	res := make([]int, len(hashes))
+	for i, h := range hashes {
+		res[i] = s.find(h, keys, i, all)
+	}
+	return res
+}
+
+// find returns the number of the key equal to the i-th row of the keys, of the
+// hash h, including the pending keys, or -1 when there's none
+func (s *keySet) find(h uint64, keys Dataset, i int, all []int) int {
+	for _, id := range s.ids[h] {
+		r := s.refs[id]
+		set, row := s.pending, 0
+		if r.set < len(s.sets) {
+			set, row = s.sets[r.set], r.row
+		} else {
+			row = s.pendingIndices[r.row]
+		}
+
+		if equalRows(set, row, keys, i, all) {
+			return id
+		}
+	}
+	return -1
+}
+
+// keys returns all of the keys of the set, in the order of their numbers, or
+// nil when there are none
+func (s *keySet) keys() Dataset {
+	if len(s.sets) == 0 {
+		return nil
+	}
+	return ConcatDatasets(s.sets...)
+}
+
+// equalRows reports whether the values of the columns of the i-th row of a are
+// equal to the ones of the j-th row of b, where nulls are equal to each other
+func equalRows(a Dataset, i int, b Dataset, j int, cols []int) bool {
+	for _, col := range cols {
+		x, y := a.At(col), b.At(col)
+		if null1, null2 := x.IsNull(i), y.IsNull(j); null1 || null2 {
+			if null1 != null2 {
+				return false
+			}
+		} else if Compare(x, i, y, j) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// selectColumns returns a dataset of the columns of the data, at the indices
+func selectColumns(data Dataset, cols []int) Dataset {
+	res := make([]Data, len(cols))
+	for i, col := range cols {
+		res[i] = data.At(col)
+	}
+	return NewDataset(res...)
+}
+
+// allColumns returns the indices of all of the columns of the data
+func allColumns(data Dataset) []int {
+	res := make([]int, data.Width())
+	for i := range res {
+		res[i] = i
+	}
+	return res
+}
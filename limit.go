@@ -0,0 +1,165 @@
+package ep
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+var _ = registerGob(&stopSending{}, &limitRows{}, &offsetRows{})
+
+// Limit returns a Runner that outputs the first n rows of its input, across
+// its datasets, slicing the one of the n-th row. Once n rows were output, it
+// returns without waiting for the rest of its input, which is left for the
+// Pipeline it's in to drain. The Pipeline then cancels the runners before it,
+// such that it completes early, even when its input never does. In a
+// distributed plan, every node limits its own rows before GatherLimit of the
+// same n, which stops the other nodes from sending more rows than needed:
+//
+//	Pipeline(Scatter(), r, Limit(n), GatherLimit(n))
+func Limit(n int) Runner { return &limitRows{n} }
+
+// Offset returns a Runner that skips the first n rows of its input, across its
+// datasets, and outputs the rest of them. In a distributed plan, it follows
+// the gathering of the rows, as with GatherLimit(offset + n), followed by
+// Offset(offset) and Limit(n)
+func Offset(n int) Runner { return &offsetRows{n} }
+
+type limitRows struct{ N int }
+
+func (*limitRows) Returns() []Type { return []Type{Wildcard} }
+func (r *limitRows) Run(ctx context.Context, inp, out chan Dataset) error {
+	left := r.N
+	for left > 0 {
+		data, ok := <-inp
+		if !ok {
+			return nil
+		}
+
+		if data.Len() > left {
+			data = data.Slice(0, left).(Dataset)
+		}
+		left -= data.Len()
+		if data.Len() == 0 {
+			continue
+		}
+
+		select {
+		case out <- data:
+		case <-ctx.Done():
+			return canceledErr(ctx, ctx.Err())
+		}
+	}
+	return nil
+}
+
+type offsetRows struct{ N int }
+
+func (*offsetRows) Returns() []Type { return []Type{Wildcard} }
+func (r *offsetRows) Run(_ context.Context, inp, out chan Dataset) error {
+	left := r.N
+	for data := range inp {
+		if left >= data.Len() {
+			left -= data.Len()
+			continue
+		}
+
+		if left > 0 {
+			data = data.Slice(left, data.Len()).(Dataset)
+			left = 0
+		}
+		out <- data
+	}
+	return nil
+}
+
+// GatherLimit returns an exchange Runner similar to Gather, except that the
+// main node outputs at most k rows. Once k rows were received, the main node
+// tells all of the other nodes to stop sending, and they discard the rest of
+// their input instead of encoding it. A non-positive k doesn't limit the rows
+func GatherLimit(k int) Runner {
+	return &exchange{UID: newUID(), Type: gather, Limit: k}
+}
+
+// stopSending is sent back from a receiving node to its senders once it
+// doesn't need any more data from them
+type stopSending struct {
+	Node string // the receiving node
+}
+
+// limit returns the part of a received dataset within the limit of rows, and
+// tells the senders to stop once the limit is reached. Returns nil once the
+// limit was reached before
+func (ex *exchange) limit(data Dataset) Dataset {
+	left := ex.Limit - ex.limited
+	if left <= 0 {
+		return nil
+	}
+
+	if data.Len() >= left {
+		data = data.Slice(0, left).(Dataset)
+		ex.stopSenders()
+	}
+
+	ex.limited += data.Len()
+	return data
+}
+
+// stopSenders tells all of the senders to stop sending, and waits until they
+// were told, such that they don't keep sending while we discard their data.
+// It's a best effort, as some of them might have already completed
+func (ex *exchange) stopSenders() {
+	ex.stop()
+
+	var wg sync.WaitGroup
+	for _, conn := range ex.sources {
+		wg.Add(1)
+		go func(conn net.Conn) {
+			defer wg.Done()
+			enc := newEncoder(compressWriter(conn, ex.Compression, 0))
+			enc.Encode(&req{&stopSending{ex.thisNode}})
+		}(conn)
+	}
+	wg.Wait()
+}
+
+// listenForStop waits in the background for the receiving node to tell this
+// node to stop sending. The receiving node writes nothing else to conn
+func (ex *exchange) listenForStop(conn net.Conn) {
+	go func() {
+		dec := newDecoder(decompressReader(conn))
+		req := &req{}
+		if dec.Decode(req) != nil {
+			return // completed, or failed
+		}
+
+		if _, ok := req.Payload.(*stopSending); ok {
+			ex.stop()
+		}
+	}()
+}
+
+// stop stops sending the input. Nothing is sent afterwards, except for the
+// end of the stream. It's safe to call it more than once, and concurrently
+func (ex *exchange) stop() {
+	ex.stopOnce.Do(func() { close(ex.stopped) })
+}
+
+// stoppableEncoder is an encoder that discards all datasets once stopped,
+// including the ones already queued before that
+type stoppableEncoder struct {
+	encoder
+	stopped chan struct{}
+}
+
+func (enc *stoppableEncoder) Encode(e interface{}) error {
+	select {
+	case <-enc.stopped:
+		switch e.(*req).Payload.(type) {
+		case Dataset, *seqBatch:
+			return nil
+		}
+	default:
+	}
+	return enc.encoder.Encode(e)
+}
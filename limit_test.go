@@ -0,0 +1,132 @@
+package ep_test
+
+import (
+	"context"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLimit(t *testing.T) {
+	datasets := []ep.Dataset{
+		ep.NewDataset(ints(1, 2, 3), strs{"a", "b", "c"}),
+		ep.NewDataset(ints(), strs{}),
+		ep.NewDataset(ints(4, 5), strs{"d", "e"}),
+		ep.NewDataset(ints(6), strs{"f"}),
+	}
+
+	for n, expected := range map[int][]string{
+		0:  nil,
+		1:  {"[1]", "[a]"},
+		3:  {"[1 2 3]", "[a b c]"}, // on the edge of a dataset
+		4:  {"[1 2 3 4]", "[a b c d]"},
+		5:  {"[1 2 3 4 5]", "[a b c d e]"},
+		6:  {"[1 2 3 4 5 6]", "[a b c d e f]"},
+		10: {"[1 2 3 4 5 6]", "[a b c d e f]"},
+	} {
+		res, err := eptest.Run(ep.Pipeline(ep.Source(datasets...), ep.Limit(n)))
+		require.NoError(t, err)
+		require.Equal(t, expected, res.Strings(), "limit %d", n)
+	}
+}
+
+func TestOffset(t *testing.T) {
+	datasets := []ep.Dataset{
+		ep.NewDataset(ints(1, 2, 3), strs{"a", "b", "c"}),
+		ep.NewDataset(ints(), strs{}),
+		ep.NewDataset(ints(4, 5), strs{"d", "e"}),
+		ep.NewDataset(ints(6), strs{"f"}),
+	}
+
+	for n, expected := range map[int][]string{
+		0:  {"[1 2 3 4 5 6]", "[a b c d e f]"},
+		1:  {"[2 3 4 5 6]", "[b c d e f]"},
+		3:  {"[4 5 6]", "[d e f]"}, // on the edge of a dataset
+		4:  {"[5 6]", "[e f]"},
+		6:  nil,
+		10: nil,
+	} {
+		res, err := eptest.Run(ep.Offset(n), datasets...)
+		require.NoError(t, err)
+		require.Equal(t, expected, res.Strings(), "offset %d", n)
+	}
+}
+
+// the pipeline completes once the limit is reached, even when its input never
+// does
+func TestLimit_earlyReturn(t *testing.T) {
+	res, err := eptest.Run(ep.Pipeline(&producer{}, ep.Limit(3), &upper{}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[DATA DATA DATA]"}, res.Strings())
+
+	res, err = eptest.Run(ep.Pipeline(&producer{}, ep.Offset(2), ep.Limit(0)))
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Width())
+}
+
+// stopped is a Runner that receives all of its input, and waits for the
+// runners before it in a Pipeline to return, by the closing of Stopped, before
+// outputting it
+type stopped struct{ Stopped chan struct{} }
+
+func (*stopped) Returns() []ep.Type { return []ep.Type{ep.Wildcard} }
+func (r *stopped) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	var res []ep.Dataset
+	for data := range inp {
+		res = append(res, data)
+	}
+
+	<-r.Stopped
+	for _, data := range res {
+		out <- data
+	}
+	return nil
+}
+
+// the runners before the limit are canceled once it's reached, rather than
+// once the pipeline completes
+func TestLimit_cancelsUpstream(t *testing.T) {
+	r := &stopped{make(chan struct{})}
+	producer := ep.Generate(func(ctx context.Context, emit func(ep.Dataset) error) error {
+		defer close(r.Stopped)
+		for emit(ep.NewDataset(strs{"data"})) == nil {
+		}
+		return ctx.Err()
+	})
+
+	res, err := eptest.Run(ep.Pipeline(producer, ep.Limit(2), r))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[data data]"}, res.Strings())
+}
+
+// the output isn't waited for once canceled
+func TestLimit_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	inp := make(chan ep.Dataset, 1)
+	inp <- ep.NewDataset(strs{"a"})
+	err := ep.Limit(1).Run(ctx, inp, make(chan ep.Dataset))
+	require.NoError(t, err)
+}
+
+func TestLimit_distributed(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	var datasets []ep.Dataset
+	for i := 0; i < 100; i++ {
+		datasets = append(datasets, ep.NewDataset(ints(int64(i), int64(i))))
+	}
+
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.Limit(5), ep.GatherLimit(5)))
+	res, err := eptest.Run(runner, datasets...)
+	require.NoError(t, err)
+	require.Equal(t, 5, res.Len())
+
+	runner = cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.GatherLimit(15), ep.Offset(10), ep.Limit(10)))
+	res, err = eptest.Run(runner, datasets...)
+	require.NoError(t, err)
+	require.Equal(t, 5, res.Len())
+}
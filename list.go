@@ -0,0 +1,317 @@
+package ep
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"hash"
+)
+
+var _ = Types.
+	Register("list", List(Null)).
+	RegisterFactory("list", listFactory)
+
+// List returns the Type of columns of variable-length lists of values of the
+// element Type, like the tags of events, backed by Lists. The lists of all of
+// the element types are registered together in Types, under "list", and
+// they're equal to one another only when their element types are
+func List(elem Type) Type {
+	return &listType{elem}
+}
+
+// listFactory returns the List of the element type argument
+func listFactory(args ...interface{}) (Type, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected an element type, got %d arguments", len(args))
+	}
+
+	elem, ok := args[0].(Type)
+	if !ok {
+		return nil, fmt.Errorf("expected an element type, got %v", args[0])
+	}
+	return List(elem), nil
+}
+
+type listType struct {
+	Elem Type
+}
+
+func (t *listType) String() string      { return t.Name() }
+func (t *listType) Name() string        { return "list(" + t.Elem.Name() + ")" }
+func (t *listType) Args() []interface{} { return []interface{}{t.Elem} }
+func (t *listType) Data(n int) Data {
+	return &Lists{Offsets: make([]int, n), Lengths: make([]int, n), Values: t.Elem.Data(0)}
+}
+func (t *listType) DataEmpty(n int) Data {
+	return &Lists{Offsets: make([]int, 0, n), Lengths: make([]int, 0, n), Values: t.Elem.Data(0)}
+}
+
+// NewLists returns the Lists of the values, split into lists of the lengths,
+// one after the other. The lengths must sum to the length of the values
+func NewLists(values Data, lengths ...int) *Lists {
+	res := &Lists{Offsets: make([]int, len(lengths)), Lengths: lengths, Values: values}
+	offset := 0
+	for i, n := range lengths {
+		res.Offsets[i] = offset
+		offset += n
+	}
+	if offset != values.Len() {
+		panic(fmt.Sprintf("ep: lists of %d values, expected %d", offset, values.Len()))
+	}
+	return res
+}
+
+// Lists is the Data of the List types: the offset and length of every list in
+// the Values, the Data of the elements of all of the lists. Nulls are whole
+// lists, independent of the nulls of their elements. Lists are compared
+// element by element, as with Compare, and shorter lists sort before the
+// longer ones they start. Null lists sort after all lists, and their Strings
+// are empty, while other lists are rendered as "[a b c]".
+//
+// Lists may share their elements, and needn't follow one another, such that
+// Swap and Duplicate don't move any elements. Copy appends the elements of
+// the copied list to the Values, thus replacing lists leaves their previous
+// elements behind, until they're sliced, taken or cloned
+type Lists struct {
+	Offsets []int
+	Lengths []int
+	Values  Data
+	Null    NullMask
+}
+
+// Type returns its List type, of the type of its elements
+func (vs *Lists) Type() Type { return List(vs.Values.Type()) }
+
+// Len returns the number of values
+func (vs *Lists) Len() int { return len(vs.Offsets) }
+
+// Less reports whether the i-th value sorts before the j-th one
+func (vs *Lists) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+
+// Swap swaps the i-th and the j-th values, along with their nulls
+func (vs *Lists) Swap(i, j int) {
+	vs.Offsets[i], vs.Offsets[j] = vs.Offsets[j], vs.Offsets[i]
+	vs.Lengths[i], vs.Lengths[j] = vs.Lengths[j], vs.Lengths[i]
+	vs.Null.Swap(i, j)
+}
+
+// LessOther reports whether the thisRow-th value sorts before the
+// otherRow-th value of the other data
+func (vs *Lists) LessOther(thisRow int, other Data, otherRow int) bool {
+	return vs.Compare(thisRow, other, otherRow) < 0
+}
+
+// Compare compares the thisRow-th value to the otherRow-th value of the
+// other data, see Comparable
+func (vs *Lists) Compare(thisRow int, other Data, otherRow int) int {
+	data := other.(*Lists)
+	if c, ok := compareNulls(vs.IsNull(thisRow), data.IsNull(otherRow)); ok {
+		return c
+	}
+
+	n1, n2 := vs.Lengths[thisRow], data.Lengths[otherRow]
+	for k := 0; k < n1 && k < n2; k++ {
+		c := Compare(vs.Values, vs.Offsets[thisRow]+k, data.Values, data.Offsets[otherRow]+k)
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(n1, n2)
+}
+
+// Hash hashes the length of the list, followed by its elements
+func (vs *Lists) Hash(row int, h hash.Hash64) {
+	hashUint64(h, uint64(vs.Lengths[row]))
+	for k := 0; k < vs.Lengths[row]; k++ {
+		writeValue(h, vs.Values, vs.Offsets[row]+k, nil)
+	}
+}
+
+// Slice slices the elements of the lists as well, from the first to the last
+// of them, such that the slice doesn't hold on to the elements of other lists
+func (vs *Lists) Slice(s, e int) Data {
+	start, end := vs.Values.Len(), 0
+	for i := s; i < e; i++ {
+		if vs.Lengths[i] > 0 {
+			start = min(start, vs.Offsets[i])
+			end = max(end, vs.Offsets[i]+vs.Lengths[i])
+		}
+	}
+	if start > end {
+		start, end = 0, 0 // all of the lists are empty
+	}
+
+	offsets := make([]int, e-s)
+	lengths := append([]int(nil), vs.Lengths[s:e]...)
+	for i, n := range lengths {
+		if n > 0 {
+			offsets[i] = vs.Offsets[s+i] - start
+		}
+	}
+	return &Lists{offsets, lengths, vs.Values.Slice(start, end), vs.Null.Slice(s, e)}
+}
+
+// Append returns the values followed by the ones of the other data
+func (vs *Lists) Append(other Data) Data {
+	data := other.(*Lists)
+	offsets := append(vs.Offsets[:len(vs.Offsets):len(vs.Offsets)], data.Offsets...)
+	for i := vs.Len(); i < len(offsets); i++ {
+		offsets[i] += vs.Values.Len()
+	}
+
+	return &Lists{
+		offsets,
+		append(vs.Lengths[:len(vs.Lengths):len(vs.Lengths)], data.Lengths...),
+		vs.Values.Append(data.Values),
+		vs.Null.Append(vs.Len(), data.Null),
+	}
+}
+
+// AppendAll concatenates the elements of the lists as well, as with Concat
+func (vs *Lists) AppendAll(others ...Data) Data {
+	lengths, nulls := appendAll(vs, others, func(data Data) ([]int, NullMask) {
+		return data.(*Lists).Lengths, data.(*Lists).Null
+	})
+
+	offsets := make([]int, 0, len(lengths))
+	values := make([]Data, 0, len(others)+1)
+	n := 0
+	for _, data := range append([]Data{vs}, others...) {
+		lists := data.(*Lists)
+		for _, offset := range lists.Offsets {
+			offsets = append(offsets, n+offset)
+		}
+		values = append(values, lists.Values)
+		n += lists.Values.Len()
+	}
+	return &Lists{offsets, lengths, Concat(values...), nulls}
+}
+
+// Duplicate shares the elements of the duplicated lists
+func (vs *Lists) Duplicate(t int) Data {
+	offsets := make([]int, 0, vs.Len()*t)
+	lengths := make([]int, 0, vs.Len()*t)
+	for i := 0; i < t; i++ {
+		offsets = append(offsets, vs.Offsets...)
+		lengths = append(lengths, vs.Lengths...)
+	}
+	return &Lists{offsets, lengths, vs.Values, vs.Null.Duplicate(vs.Len(), t)}
+}
+
+// IsNull reports whether the i-th value is null
+func (vs *Lists) IsNull(i int) bool { return vs.Null.Get(i) }
+
+// MarkNull marks the i-th value as null
+func (vs *Lists) MarkNull(i int) { vs.Null.Set(i, true) }
+
+// Nulls reports whether each one of the values is null
+func (vs *Lists) Nulls() []bool { return vs.Null.Nulls(vs.Len()) }
+
+// Equal reports whether the other data has the same values, as with
+// DataEqual
+func (vs *Lists) Equal(other Data) bool { return DataEqual(vs, other) }
+
+// Same reports whether the other data shares the values, see Sharer
+func (vs *Lists) Same(other Data) bool {
+	data, ok := other.(*Lists)
+	return ok && (vs == data || vs.Len() > 0 && data.Len() > 0 && &vs.Offsets[0] == &data.Offsets[0])
+}
+
+// Copy copies the fromRow-th value of the other data to the toRow-th value
+func (vs *Lists) Copy(from Data, fromRow, toRow int) {
+	src := from.(*Lists)
+	offset, n := src.Offsets[fromRow], src.Lengths[fromRow]
+	vs.Offsets[toRow], vs.Lengths[toRow] = vs.Values.Len(), n
+	vs.Values = vs.Values.Append(src.Values.Slice(offset, offset+n))
+	vs.Null.Copy(src.Null, fromRow, toRow)
+}
+
+// Take takes the elements of the lists as well, one list after the other
+func (vs *Lists) Take(indices []int) Data {
+	res := &Lists{Offsets: make([]int, len(indices)), Lengths: make([]int, len(indices))}
+	var elems []int
+	for j, i := range indices {
+		res.Offsets[j], res.Lengths[j] = len(elems), vs.Lengths[i]
+		for k := 0; k < vs.Lengths[i]; k++ {
+			elems = append(elems, vs.Offsets[i]+k)
+		}
+	}
+
+	res.Values = take(vs.Values, elems)
+	res.Null = vs.Null.Take(indices)
+	return res
+}
+
+// Clone clones the elements of the lists as well, as with Clone
+func (vs *Lists) Clone() Data {
+	return &Lists{append([]int(nil), vs.Offsets...), append([]int(nil), vs.Lengths...), Clone(vs.Values), vs.Null.Slice(0, vs.Len())}
+}
+
+// Size includes all of the Values, even when they're shared
+func (vs *Lists) Size() uint64 {
+	return uint64(vs.Len())*16 + DataSize(vs.Values) + vs.Null.Size()
+}
+
+// Strings returns the string representations of the values, which are
+// empty for nulls
+func (vs *Lists) Strings() []string {
+	res := make([]string, vs.Len())
+	var buf []byte
+	for i := range res {
+		if !vs.IsNull(i) {
+			buf = vs.AppendStringAt(buf[:0], i)
+			res[i] = string(buf)
+		}
+	}
+	return res
+}
+
+// AppendStringAt appends the string representation of the row-th value to
+// dst, see StringerAt
+func (vs *Lists) AppendStringAt(dst []byte, row int) []byte {
+	if vs.IsNull(row) {
+		return dst
+	}
+
+	dst = append(dst, '[')
+	for k := 0; k < vs.Lengths[row]; k++ {
+		if k > 0 {
+			dst = append(dst, ' ')
+		}
+		dst = AppendStringAt(dst, vs.Values, vs.Offsets[row]+k)
+	}
+	return append(dst, ']')
+}
+
+// MarshalJSONValue marshals the list as a JSON array of its elements, as in
+// MarshalDatasetJSON
+func (vs *Lists) MarshalJSONValue(row int) ([]byte, error) {
+	offset := vs.Offsets[row]
+	values, err := marshalJSONValues(vs.Values.Slice(offset, offset+vs.Lengths[row]))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeJSONArray(&buf, values)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSONValue appends the elements of the JSON array to the Values, as
+// with Copy
+func (vs *Lists) UnmarshalJSONValue(row int, b []byte) error {
+	var values []json.RawMessage
+	if err := json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+
+	elems, err := unmarshalJSONValues(values, vs.Values.Type())
+	if err != nil {
+		return err
+	}
+
+	vs.Offsets[row], vs.Lengths[row] = vs.Values.Len(), len(values)
+	vs.Values = vs.Values.Append(elems)
+	return nil
+}
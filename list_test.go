@@ -0,0 +1,129 @@
+package ep_test
+
+import (
+	"encoding/json"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+)
+
+var _ = ep.Types.Register("list", ep.List(ep.Int64))
+
+func TestList(t *testing.T) {
+	require.Equal(t, "list(dict_string)", ep.List(ep.DictString).Name())
+	require.Equal(t, ep.List(ep.DictString), ep.NewLists(ep.EncodeDict(nil)).Type())
+	require.True(t, ep.AreEqualTypes([]ep.Type{ep.List(ep.Int64)}, []ep.Type{ep.List(ep.Int64)}))
+	require.False(t, ep.AreEqualTypes([]ep.Type{ep.List(ep.Int64)}, []ep.Type{ep.List(ep.Float64)}))
+
+	require.Panics(t, func() { ep.NewLists(ep.EncodeDict([]string{"a"}), 2) })
+}
+
+func TestLists(t *testing.T) {
+	tags := ep.EncodeDict([]string{"b", "a", "", "c", "a", "b"})
+	tags.MarkNull(2)
+	data := ep.NewLists(tags, 2, 0, 1, 3)
+	data.MarkNull(1)
+	require.Equal(t, []string{"[b a]", "", "[]", "[c a b]"}, data.Strings()) // of a null element
+	require.Equal(t, []bool{false, true, false, false}, data.Nulls())
+
+	// shorter lists first, then lists of null elements, and null lists last
+	empty := ep.NewLists(ep.EncodeDict([]string{"b", "a", "b"}), 0, 2, 1)
+	all := data.Append(empty).Append(data.Slice(3, 4))
+	sort.Sort(all)
+	require.Equal(t, []string{"[]", "[b]", "[b a]", "[b a]", "[c a b]", "[c a b]", "[]", ""}, all.Strings())
+	require.Equal(t, 0, ep.Compare(all, 5, data, 3))
+	require.Equal(t, -1, ep.Compare(all, 1, data, 0))
+	require.Equal(t, 1, ep.Compare(all, 6, data, 3))
+
+	// slices hold on to the elements of their own lists only
+	sliced := data.Slice(2, 4).(*ep.Lists)
+	require.Equal(t, []string{"[]", "[c a b]"}, sliced.Strings())
+	require.Equal(t, 4, sliced.Values.Len())
+	require.Equal(t, 0, data.Slice(1, 2).(*ep.Lists).Values.Len())
+
+	// copied over a longer list, and taken
+	data.Copy(empty, 2, 3)
+	require.Equal(t, []string{"[b a]", "", "[]", "[b]"}, data.Strings())
+	taken, err := ep.Take(data, []int{3, 0})
+	require.NoError(t, err)
+	require.Equal(t, []string{"[b]", "[b a]"}, taken.Strings())
+	require.Equal(t, 3, taken.(*ep.Lists).Values.Len())
+}
+
+func TestLists_cutAndClone(t *testing.T) {
+	data := ep.NewLists(&ep.Int64s{Values: []int64{1, 2, 3, 4, 5, 6}}, 1, 2, 0, 3)
+	data.MarkNull(2)
+
+	clone := ep.Clone(data)
+	require.Equal(t, data.Type(), clone.Type())
+	require.Equal(t, data.Strings(), clone.Strings())
+	require.Equal(t, data.Nulls(), clone.Nulls())
+
+	// the clone is independent of the data
+	clone.Swap(0, 3)
+	clone.Copy(clone, 1, 2)
+	require.Equal(t, []string{"[1]", "[2 3]", "", "[4 5 6]"}, data.Strings())
+	require.Equal(t, []string{"[4 5 6]", "[2 3]", "[2 3]", "[1]"}, clone.Strings())
+
+	cut := ep.Cut(data, 1, 3).(ep.Dataset)
+	require.Equal(t, 3, cut.Width())
+	require.Equal(t, []string{"[1]"}, cut.At(0).Strings())
+	require.Equal(t, []string{"[2 3]", ""}, cut.At(1).Strings())
+	require.Equal(t, []string{"[4 5 6]"}, cut.At(2).Strings())
+	require.Equal(t, []int64{4, 5, 6}, cut.At(2).(*ep.Lists).Values.(*ep.Int64s).Values)
+}
+
+// Clones own the values nested in them, like the bytes of blobs and the
+// dictionaries of strings, which are otherwise modified in place
+func TestLists_cloneNested(t *testing.T) {
+	blobs := ep.NewLists(&ep.Blobs{Values: [][]byte{[]byte("ab"), []byte("cd")}}, 2, 0)
+	clone := ep.Clone(blobs).(*ep.Lists)
+	clone.Values.(*ep.Blobs).Values[0][0] = 'x'
+	clone.Copy(ep.NewLists(&ep.Blobs{Values: [][]byte{[]byte("ef")}}, 1), 0, 1)
+	require.Equal(t, []string{"[6162 6364]", "[]"}, blobs.Strings())
+	require.Equal(t, []string{"[7862 6364]", "[6566]"}, clone.Strings())
+
+	dicts := ep.NewLists(ep.EncodeDict([]string{"a", "b"}), 1, 1)
+	clone = ep.Clone(dicts).(*ep.Lists)
+	clone.Values.Copy(ep.EncodeDict([]string{"c"}), 0, 1)
+	require.Equal(t, []string{"[a]", "[b]"}, dicts.Strings())
+	require.Equal(t, []string{"a", "b"}, dicts.Values.(*ep.DictStrings).Dict.Values)
+	require.Equal(t, []string{"[a]", "[c]"}, clone.Strings())
+}
+
+func TestLists_json(t *testing.T) {
+	data := ep.NewLists(&ep.Float64s{Values: []float64{0.5, 1, 2}, Null: ep.NullMask{2}}, 1, 0, 2)
+	data.MarkNull(1)
+	ds := ep.NewDataset(data)
+
+	b, err := json.Marshal(ds)
+	require.NoError(t, err)
+	require.Equal(t, `[[[0.5]],[null],[[null,2]]]`, string(b))
+
+	res, err := ep.UnmarshalDatasetJSON([]byte(`[[[0.5]],[null],[[]],[[null,2]]]`), []ep.Type{data.Type()}, ep.JSONOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"[0.5]", "", "[]", "[ 2]"}, res.At(0).Strings())
+
+	_, err = ep.UnmarshalDatasetJSON([]byte(`[[["a"]]]`), []ep.Type{data.Type()}, ep.JSONOptions{})
+	require.Error(t, err)
+	require.Equal(t, `ep: column 0: row 0: row 0: strconv.ParseFloat: parsing "a": invalid syntax`, err.Error())
+}
+
+// Lists of all of the element types are sent by exchanges
+func TestInMemoryCluster_lists(t *testing.T) {
+	cluster := eptest.InMemoryCluster(2)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	tags := ep.NewLists(ep.EncodeDict([]string{"a", "b", "c"}), 2, 0, 1)
+	tags.MarkNull(1)
+	nested := ep.NewLists(ep.NewLists(&ep.Bools{Values: []bool{true, false}}, 1, 0, 1), 2, 1, 0)
+
+	runner := cluster.Distribute(ep.Pipeline(ep.Broadcast(), ep.Gather()))
+	res, err := eptest.Run(runner, ep.NewDataset(tags, nested))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[a b]", "", "[c]", "[a b]", "", "[c]"}, res.At(0).Strings())
+	require.Equal(t, []string{"[[true] []]", "[[false]]", "[]", "[[true] []]", "[[false]]", "[]"}, res.At(1).Strings())
+	require.Equal(t, "list(list(bool))", res.At(1).Type().Name())
+}
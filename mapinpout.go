@@ -64,7 +64,7 @@ func (r *mapInpToOut) Run(ctx context.Context, inp, out chan Dataset) error {
 			// any guarantee on the number or size of batches being processed.
 			go func() {
 				defer close(innerOut)
-				err = r.Runner.Run(ctx, innerInp, innerOut)
+				err = runSafe(ctx, r.Runner, innerInp, innerOut)
 			}()
 
 			for res := range innerOut {
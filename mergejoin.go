@@ -0,0 +1,295 @@
+package ep
+
+import (
+	"context"
+	"fmt"
+)
+
+var _ = registerGob(&mergeJoin{})
+
+// mergeJoinBatchSize is the minimal number of rows of every dataset output by
+// MergeJoin, except for its last one
+const mergeJoinBatchSize = 1024
+
+// MergeJoin returns a Runner of the equi-join of the outputs of the left and
+// right runners, similar to Join, for outputs that are both sorted by the
+// sorting columns, of the key columns of both of them, e.g. by SortGather.
+// Rather than building a hash table, it merges both streams, and retains only
+// the rows of the current key of every side, which may span any number of
+// their datasets. Both runners run concurrently, and receive the input of the
+// MergeJoin, which is buffered in memory for the runner that falls behind, as
+// with Project.
+//
+// The output is the same as with Join, of the same types, in the order of the
+// keys of the left runner, thus callers can switch between both by the order
+// of their inputs. Unmatched left rows of a LeftJoin are in their order too,
+// rather than following the matched ones
+func MergeJoin(left, right Runner, cols []SortingCol, joinType JoinType) (Runner, error) {
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("ep: merge join of no key columns")
+	}
+	return &mergeJoin{Left: left, Right: right, SortingCols: cols, Type: joinType}, nil
+}
+
+type mergeJoin struct {
+	Left        Runner
+	Right       Runner
+	SortingCols []SortingCol
+	Type        JoinType
+}
+
+func (r *mergeJoin) Returns() []Type {
+	return append(append([]Type{}, r.Left.Returns()...), r.Right.Returns()...)
+}
+
+func (r *mergeJoin) Run(ctx context.Context, inp, out chan Dataset) error {
+	runners := []Runner{r.Left, r.Right}
+	inputs := forkInput(inp, len(runners))
+	outputs := make([]chan Dataset, len(runners))
+	errs := make([]error, len(runners))
+	for i := range runners {
+		outputs[i] = make(chan Dataset)
+		go func(i int) {
+			defer close(outputs[i])
+			errs[i] = runSafe(ctx, runners[i], inputs[i], outputs[i])
+
+			// the runner might have returned before its input was completed
+			for range inputs[i] {
+			}
+		}(i)
+	}
+
+	left := &mergeCursor{ch: outputs[0], check: r.check}
+	right := &mergeCursor{ch: outputs[1], check: r.check}
+	err := r.merge(left, right, &mergeJoinOutput{out: out})
+
+	// drain both runners, such that they complete
+	for _, ch := range outputs {
+		for range ch {
+		}
+	}
+	for _, runErr := range errs {
+		if runErr != nil {
+			return runErr
+		}
+	}
+	return err
+}
+
+// merge merges the rows of both cursors into the output, by their keys
+func (r *mergeJoin) merge(left, right *mergeCursor, out *mergeJoinOutput) error {
+	out.nulls = func(n int) Dataset {
+		if right.types != nil {
+			return nullColumns(right.types, n)
+		}
+		return nullColumns(r.Right.Returns(), n)
+	}
+
+	typesChecked := false
+	for left.next() {
+		if !right.next() {
+			if right.err != nil {
+				return right.err
+			}
+
+			// the right side completed, thus none of the rest of the left
+			// rows is matched
+			if r.Type == LeftJoin {
+				out.unmatched(left.data, left.row, left.data.Len())
+			}
+			left.row = left.data.Len()
+			continue
+		} else if !typesChecked {
+			if err := r.checkTypes(left.data, right.data); err != nil {
+				return err
+			}
+			typesChecked = true
+		}
+
+		c := r.compare(left.data, left.row, right.data, right.row)
+		switch {
+		case c < 0:
+			if r.Type == LeftJoin {
+				out.unmatched(left.data, left.row, left.row+1)
+			}
+			left.row++
+		case c > 0:
+			right.row++
+		default:
+			leftRun, rightRun := left.run(r.compare), right.run(r.compare)
+			if !hasNulls(selectColumns(leftRun, r.keyCols()), 0) {
+				out.matched(leftRun, rightRun)
+			} else if r.Type == LeftJoin {
+				// null keys don't match, even though they're equal
+				out.unmatched(leftRun, 0, leftRun.Len())
+			}
+		}
+		out.flush(false)
+	}
+
+	if left.err != nil {
+		return left.err
+	} else if right.err != nil {
+		return right.err
+	}
+	out.flush(true)
+	return nil
+}
+
+// compare compares the keys of the i-th row of a and the j-th row of b, by
+// all of the sorting columns
+func (r *mergeJoin) compare(a Dataset, i int, b Dataset, j int) int {
+	for _, col := range r.SortingCols {
+		if c := col.compare(a.At(col.Index), i, b.At(col.Index), j); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (r *mergeJoin) keyCols() []int {
+	cols := make([]int, len(r.SortingCols))
+	for i, col := range r.SortingCols {
+		cols[i] = col.Index
+	}
+	return cols
+}
+
+// check verifies that the key columns are within the width of the data
+func (r *mergeJoin) check(data Dataset) error {
+	return checkJoinColumns(data, r.keyCols())
+}
+
+// checkTypes verifies that the key columns of both sides are of the same types
+func (r *mergeJoin) checkTypes(left, right Dataset) error {
+	for _, col := range r.SortingCols {
+		t1, t2 := left.At(col.Index).Type(), right.At(col.Index).Type()
+		if !isEqualType(t1, t2) {
+			return fmt.Errorf("ep: join of key columns of %s and %s", t1, t2)
+		}
+	}
+	return nil
+}
+
+// mergeCursor is the current row of the sorted output of a runner
+type mergeCursor struct {
+	ch    chan Dataset
+	check func(Dataset) error // of every dataset received
+	data  Dataset
+	row   int
+	types []Type // of the first dataset, once received
+	err   error  // of checking the datasets
+}
+
+// next makes sure that there's a current row, receiving the following
+// datasets as needed. Returns false once all of them were received, or when
+// any of them fails the check
+func (c *mergeCursor) next() bool {
+	for c.data == nil || c.row >= c.data.Len() {
+		data, ok := <-c.ch
+		if ok && c.err == nil {
+			c.err = c.check(data)
+		}
+		if !ok || c.err != nil {
+			c.data, c.row = nil, 0
+			return false
+		}
+
+		c.data, c.row = data, 0
+		if c.types == nil {
+			c.types = datasetTypes(data)
+		}
+	}
+	return true
+}
+
+// run returns the rows of the key of the current row, which is the first of
+// them, including the rows of the following datasets, and advances past them.
+// Only the datasets of the rows of the key are retained
+func (c *mergeCursor) run(compare func(Dataset, int, Dataset, int) int) Dataset {
+	first, firstRow := c.data, c.row
+	var parts []Dataset
+	for {
+		start := c.row
+		for c.row < c.data.Len() && compare(first, firstRow, c.data, c.row) == 0 {
+			c.row++
+		}
+		if c.row > start {
+			parts = append(parts, c.data.Slice(start, c.row).(Dataset))
+		}
+
+		if c.row < c.data.Len() || !c.next() {
+			return ConcatDatasets(parts...)
+		} else if compare(first, firstRow, c.data, c.row) != 0 {
+			return ConcatDatasets(parts...)
+		}
+	}
+}
+
+// mergeJoinOutput buffers the joined rows of MergeJoin, in their order, into
+// datasets of mergeJoinBatchSize rows. Consecutive unmatched rows of the same
+// dataset are joined with the nulls at once
+type mergeJoinOutput struct {
+	out   chan Dataset
+	nulls func(n int) Dataset // of the columns of the right side
+
+	parts []Dataset
+	n     int // the number of rows of the parts
+
+	// the pending unmatched rows
+	unmatchedData                Dataset
+	unmatchedStart, unmatchedEnd int
+}
+
+// matched adds the rows of every pair of the rows of both sides
+func (o *mergeJoinOutput) matched(left, right Dataset) {
+	o.closeUnmatched()
+	li, ri := make([]int, 0, left.Len()*right.Len()), make([]int, 0, left.Len()*right.Len())
+	for i := 0; i < left.Len(); i++ {
+		for j := 0; j < right.Len(); j++ {
+			li, ri = append(li, i), append(ri, j)
+		}
+	}
+	o.add(concatColumns(take(left, li).(Dataset), take(right, ri).(Dataset)))
+}
+
+// unmatched adds the rows of the data between start and end, followed by nulls
+func (o *mergeJoinOutput) unmatched(data Dataset, start, end int) {
+	if o.unmatchedData != nil && Same(o.unmatchedData, data) && o.unmatchedEnd == start {
+		o.unmatchedEnd = end
+		return
+	}
+
+	o.closeUnmatched()
+	o.unmatchedData, o.unmatchedStart, o.unmatchedEnd = data, start, end
+}
+
+// closeUnmatched adds the pending unmatched rows
+func (o *mergeJoinOutput) closeUnmatched() {
+	if o.unmatchedData == nil {
+		return
+	}
+
+	n := o.unmatchedEnd - o.unmatchedStart
+	o.add(concatColumns(o.unmatchedData.Slice(o.unmatchedStart, o.unmatchedEnd).(Dataset), o.nulls(n)))
+	o.unmatchedData = nil
+}
+
+func (o *mergeJoinOutput) add(data Dataset) {
+	o.parts = append(o.parts, data)
+	o.n += data.Len()
+}
+
+// flush outputs the buffered rows once there are enough of them, or when it's
+// the last flush
+func (o *mergeJoinOutput) flush(last bool) {
+	if last {
+		o.closeUnmatched()
+	}
+	if o.n == 0 || (!last && o.n < mergeJoinBatchSize) {
+		return
+	}
+
+	o.out <- ConcatDatasets(o.parts...)
+	o.parts, o.n = nil, 0
+}
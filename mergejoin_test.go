@@ -0,0 +1,164 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+)
+
+func ints(values ...int64) *ep.Int64s { return &ep.Int64s{Values: values} }
+
+func TestMergeJoin(t *testing.T) {
+	// runs of keys spanning datasets on both sides
+	left := ep.Source(
+		ep.NewDataset(ints(1, 2), strs{"a", "b"}),
+		ep.NewDataset(ints(2, 2), strs{"c", "d"}),
+		ep.NewDataset(ints(2, 3), strs{"e", "f"}),
+		ep.NewDataset(ints(5), strs{"g"}),
+	)
+	right := ep.Source(
+		ep.NewDataset(ints(0, 2), ints(10, 20)),
+		ep.NewDataset(ints(2), ints(30)),
+		ep.NewDataset(ints(2, 4, 5), ints(40, 50, 60)),
+	)
+	cols := []ep.SortingCol{{Index: 0}}
+
+	inner, err := ep.MergeJoin(left, right, cols, ep.InnerJoin)
+	require.NoError(t, err)
+	res, err := eptest.Run(inner)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"[2 2 2 2 2 2 2 2 2 2 2 2 5]",
+		"[b b b c c c d d d e e e g]",
+		"[2 2 2 2 2 2 2 2 2 2 2 2 5]",
+		"[20 30 40 20 30 40 20 30 40 20 30 40 60]",
+	}, res.Strings())
+
+	// in the order of the left keys, as Join outputs the same rows
+	outer, err := ep.MergeJoin(left, right, cols, ep.LeftJoin)
+	require.NoError(t, err)
+	res, err = eptest.Run(outer)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"[1 2 2 2 2 2 2 2 2 2 2 2 2 3 5]",
+		"[a b b b c c c d d d e e e f g]",
+		"[ 2 2 2 2 2 2 2 2 2 2 2 2  5]",
+		"[ 20 30 40 20 30 40 20 30 40 20 30 40  60]",
+	}, res.Strings())
+	requireSameJoin(t, left, right, res, ep.LeftJoin)
+}
+
+// Either side may complete before the other one
+func TestMergeJoin_completedEarly(t *testing.T) {
+	left := ep.Source(ep.NewDataset(ints(1, 2), strs{"a", "b"}), ep.NewDataset(ints(3, 4), strs{"c", "d"}))
+	right := ep.Source(ep.NewDataset(ints(1), ints(10)), ep.NewDataset(ints(2), ints(20)))
+	cols := []ep.SortingCol{{Index: 0}}
+
+	outer, err := ep.MergeJoin(left, right, cols, ep.LeftJoin)
+	require.NoError(t, err)
+	res, err := eptest.Run(outer)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[1 2 3 4]", "[a b c d]", "[1 2  ]", "[10 20  ]"}, res.Strings())
+
+	// the rest of the right side is drained
+	inner, err := ep.MergeJoin(right, left, cols, ep.InnerJoin)
+	require.NoError(t, err)
+	res, err = eptest.Run(inner)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[1 2]", "[10 20]", "[1 2]", "[a b]"}, res.Strings())
+
+	// without any right rows
+	outer, err = ep.MergeJoin(left, ep.Source(ep.NewDataset(ints(), ints())), cols, ep.LeftJoin)
+	require.NoError(t, err)
+	res, err = eptest.Run(outer)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[1 2 3 4]", "[a b c d]", "[   ]", "[   ]"}, res.Strings())
+}
+
+func TestMergeJoin_nulls(t *testing.T) {
+	// sorted last, by both keys
+	left := ep.Source(ep.NewDataset(&ep.Int64s{Values: []int64{1, 1, 0, 0}, Null: ep.NullMask{4 | 8}}, strs{"a", "b", "c", "d"}))
+	right := ep.Source(ep.NewDataset(&ep.Int64s{Values: []int64{1, 0}, Null: ep.NullMask{2}}, ints(10, 20)))
+	outer, err := ep.MergeJoin(left, right, []ep.SortingCol{{Index: 0}}, ep.LeftJoin)
+	require.NoError(t, err)
+	res, err := eptest.Run(outer)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[1 1  ]", "[a b c d]", "[1 1  ]", "[10 10  ]"}, res.Strings())
+	requireSameJoin(t, left, right, res, ep.LeftJoin)
+}
+
+func TestMergeJoin_errors(t *testing.T) {
+	_, err := ep.MergeJoin(ep.PassThrough(), ep.PassThrough(), nil, ep.InnerJoin)
+	require.Error(t, err)
+	require.Equal(t, "ep: merge join of no key columns", err.Error())
+
+	j, err := ep.MergeJoin(ep.Source(ep.NewDataset(strs{"a"})), ep.Source(ep.NewDataset(ints(1))), []ep.SortingCol{{Index: 0}}, ep.InnerJoin)
+	require.NoError(t, err)
+	_, err = eptest.Run(j)
+	require.Error(t, err)
+	require.Equal(t, "ep: join of key columns of string and int64", err.Error())
+
+	j, err = ep.MergeJoin(ep.Source(ep.NewDataset(ints(1))), ep.Source(ep.NewDataset(ints(1))), []ep.SortingCol{{Index: 1}}, ep.InnerJoin)
+	require.NoError(t, err)
+	_, err = eptest.Run(j)
+	require.Error(t, err)
+	require.Equal(t, "ep: join column 1 out of range for 1 columns", err.Error())
+}
+
+// Random sorted sides, in random datasets, in every direction, are joined into
+// the same rows as by Join
+func TestMergeJoin_random(t *testing.T) {
+	rnd := rand.New(rand.NewSource(88))
+	for iter := 0; iter < 50; iter++ {
+		cols := []ep.SortingCol{{Index: 0, Desc: rnd.Intn(2) == 0}}
+		left, right := randomSorted(t, rnd, cols), randomSorted(t, rnd, cols)
+		for _, joinType := range []ep.JoinType{ep.InnerJoin, ep.LeftJoin} {
+			j, err := ep.MergeJoin(left, right, cols, joinType)
+			require.NoError(t, err)
+			res, err := eptest.Run(j)
+			require.NoError(t, err)
+			requireSameJoin(t, left, right, res, joinType)
+		}
+	}
+}
+
+// randomSorted returns random rows of a key and a value, sorted by the key, in
+// datasets of random lengths
+func randomSorted(t *testing.T, rnd *rand.Rand, cols []ep.SortingCol) ep.Runner {
+	n := 1 + rnd.Intn(40)
+	data, err := ep.SortDataset(ep.NewDataset(randomInts(rnd, n), randomInts(rnd, n)), cols)
+	require.NoError(t, err)
+
+	var res []ep.Dataset
+	for i := 0; i < n; {
+		end := i + 1 + rnd.Intn(5)
+		if end > n {
+			end = n
+		}
+		res = append(res, data.Slice(i, end).(ep.Dataset))
+		i = end
+	}
+	return ep.Source(res...)
+}
+
+// requireSameJoin requires the rows of the merge join of both sides to be the
+// same as the ones of their Join, in any order
+func requireSameJoin(t *testing.T, left, right ep.Runner, res ep.Dataset, joinType ep.JoinType) {
+	j, err := ep.Join(left, right, []int{0}, []int{0}, joinType)
+	require.NoError(t, err)
+	expected, err := eptest.Run(j)
+	require.NoError(t, err)
+
+	cols := []ep.SortingCol{{Index: 0}, {Index: 1}, {Index: 2}, {Index: 3}}
+	if expected.Len() == 0 {
+		require.Equal(t, 0, res.Len())
+		return
+	}
+	expected, err = ep.SortDataset(expected, cols)
+	require.NoError(t, err)
+	res, err = ep.SortDataset(res, cols)
+	require.NoError(t, err)
+	require.Equal(t, expected.Strings(), res.Strings())
+}
@@ -0,0 +1,435 @@
+package ep
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Multiplex sets a Distributer to open a single persistent connection to every
+// one of its peers, shared by all of the exchanges between them, rather than a
+// connection for every exchange. Every exchange uses its own logical stream,
+// identified by its UID, within that connection. All nodes must be configured
+// the same, before any Runner is distributed.
+//
+// Streams are buffered by the receiving side without bound, such that an
+// exchange that doesn't read can't block other exchanges sharing the same
+// connection.
+func Multiplex(d Distributer) Distributer {
+	dist, ok := d.(*distributer)
+	if !ok {
+		panic("ep: Multiplex expects a distributer")
+	}
+
+	dist.l.Lock()
+	defer dist.l.Unlock()
+	dist.mux = true
+	return dist
+}
+
+// session returns the multiplexed session with a peer node, connecting to it
+// when there's none. Similar to Connect, the node with the lower address dials,
+// while the other waits for the incoming connection
+func (d *distributer) session(addr string) (*muxSession, error) {
+	if d.addr < addr {
+		// dial once, even when several exchanges connect at the same time
+		d.muxL.Lock()
+		defer d.muxL.Unlock()
+		if s := d.getSession(addr); s != nil {
+			return s, nil
+		}
+
+		conn, err := d.Dial("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+
+		err = writeStr(conn, "M") // Multiplexed connection
+		if err == nil {
+			err = writeStr(conn, d.addr)
+		}
+		if err == nil {
+			err = writeStr(conn, d.authMAC(d.addr))
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		s := newMuxSession(conn, addr, d.removeSession)
+		d.putSession(addr, s)
+		return s, nil
+	}
+
+	// listen, timeout after 1 second
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+
+	select {
+	case <-d.sessionReady(addr):
+		if s := d.getSession(addr); s != nil {
+			return s, nil
+		}
+		return nil, fmt.Errorf("ep: connection to %s failed", addr)
+	case <-timer.C:
+		return nil, fmt.Errorf("ep: connect timeout; no incoming conn")
+	}
+}
+
+// serveSession serves an incoming multiplexed connection
+func (d *distributer) serveSession(conn net.Conn) error {
+	from, err := readStr(conn)
+	if err != nil {
+		return err
+	}
+
+	mac, err := readStr(conn)
+	if err != nil {
+		return err
+	}
+
+	if !d.authenticate(from, mac) {
+		return d.authFailed(conn, from)
+	}
+
+	d.putSession(from, newMuxSession(conn, from, d.removeSession))
+	return nil
+}
+
+func (d *distributer) getSession(addr string) *muxSession {
+	d.l.Lock()
+	defer d.l.Unlock()
+	return d.sessions[addr]
+}
+
+// sessionReady returns a channel that's closed once there's a session with the
+// peer node
+func (d *distributer) sessionReady(addr string) chan struct{} {
+	d.l.Lock()
+	defer d.l.Unlock()
+	if d.ready[addr] == nil {
+		d.ready[addr] = make(chan struct{})
+	}
+	return d.ready[addr]
+}
+
+func (d *distributer) putSession(addr string, s *muxSession) {
+	ready := d.sessionReady(addr)
+
+	d.l.Lock()
+	defer d.l.Unlock()
+	if prev := d.sessions[addr]; prev != nil {
+		// the peer has reconnected, the previous session is stale
+		go prev.Close()
+	}
+	d.sessions[addr] = s
+
+	select {
+	case <-ready:
+	default:
+		close(ready)
+	}
+}
+
+// removeSession removes a session that has failed, such that the following
+// connections to the peer open a new one
+func (d *distributer) removeSession(addr string, s *muxSession) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	if d.sessions[addr] == s {
+		delete(d.sessions, addr)
+		delete(d.ready, addr)
+	}
+}
+
+// closeSessions closes all of the multiplexed sessions
+func (d *distributer) closeSessions() {
+	d.l.Lock()
+	sessions := d.sessions
+	d.sessions = map[string]*muxSession{}
+	d.ready = map[string]chan struct{}{}
+	d.l.Unlock()
+
+	for _, s := range sessions {
+		s.Close()
+	}
+}
+
+// muxSession multiplexes logical streams over a single connection to a peer.
+// Every frame is the key of its stream, followed by a length-prefixed payload.
+// An empty payload ends the stream
+type muxSession struct {
+	conn    net.Conn
+	addr    string // of the peer
+	onClose func(addr string, s *muxSession)
+	wl      sync.Mutex // serializes writing frames
+
+	l       sync.Mutex
+	streams map[string]*muxStream
+	err     error // set once the session has failed
+}
+
+func newMuxSession(conn net.Conn, addr string, onClose func(string, *muxSession)) *muxSession {
+	s := &muxSession{
+		conn:    conn,
+		addr:    addr,
+		onClose: onClose,
+		streams: map[string]*muxStream{},
+	}
+	go s.readLoop()
+	return s
+}
+
+// stream returns the stream with the provided key, creating it if it doesn't
+// exist yet. Either side can create it, by connecting or by sending to it
+func (s *muxSession) stream(key string) *muxStream {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	st := s.streams[key]
+	if st == nil {
+		st = &muxStream{s: s, key: key, notify: make(chan struct{}, 1), err: s.err}
+		if s.err == nil {
+			s.streams[key] = st
+		}
+	}
+	return st
+}
+
+func (s *muxSession) readLoop() {
+	r := bufio.NewReader(s.conn)
+	for {
+		key, err := readBytes(r)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+
+		payload, err := readBytes(r)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+
+		st := s.stream(string(key))
+		if len(payload) == 0 {
+			st.remoteEOS()
+		} else {
+			st.push(payload)
+		}
+	}
+}
+
+func (s *muxSession) writeFrame(key string, payload []byte) error {
+	// a single write per frame, as frames of different streams interleave
+	frame := &bytes.Buffer{}
+	writeBytes(frame, []byte(key))
+	writeBytes(frame, payload)
+
+	s.wl.Lock()
+	defer s.wl.Unlock()
+	_, err := s.conn.Write(frame.Bytes())
+	if err != nil {
+		s.fail(err)
+	}
+	return err
+}
+
+// fail fails all of the streams of the session, and closes its connection
+func (s *muxSession) fail(err error) {
+	s.l.Lock()
+	if s.err != nil {
+		s.l.Unlock()
+		return
+	}
+
+	s.err = fmt.Errorf("ep: connection to %s failed: %s", s.addr, err)
+	streams := s.streams
+	s.streams = map[string]*muxStream{}
+	s.l.Unlock()
+
+	for _, st := range streams {
+		st.fail(s.err)
+	}
+	s.conn.Close()
+	s.onClose(s.addr, s)
+}
+
+// Close closes the session, along with all of its streams
+func (s *muxSession) Close() error {
+	s.fail(io.ErrClosedPipe)
+	return nil
+}
+
+func (s *muxSession) release(st *muxStream) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.streams[st.key] == st {
+		delete(s.streams, st.key)
+	}
+}
+
+// muxStream is a logical stream within a muxSession, usable as a connection
+type muxStream struct {
+	s      *muxSession
+	key    string
+	notify chan struct{} // signaled upon every change
+
+	l        sync.Mutex
+	chunks   [][]byte // received, not yet read
+	eos      bool     // the peer has ended the stream
+	closed   bool     // this side has closed the stream
+	err      error    // the session has failed
+	deadline time.Time
+}
+
+func (st *muxStream) wake() {
+	select {
+	case st.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (st *muxStream) push(payload []byte) {
+	st.l.Lock()
+	defer st.l.Unlock()
+	if !st.closed {
+		st.chunks = append(st.chunks, payload)
+		st.wake()
+	}
+}
+
+func (st *muxStream) remoteEOS() {
+	st.l.Lock()
+	defer st.l.Unlock()
+	st.eos = true
+	st.wake()
+	if st.closed {
+		st.s.release(st)
+	}
+}
+
+func (st *muxStream) fail(err error) {
+	st.l.Lock()
+	defer st.l.Unlock()
+	st.err = err
+	st.wake()
+}
+
+func (st *muxStream) Read(b []byte) (int, error) {
+	for {
+		st.l.Lock()
+		switch {
+		case st.closed:
+			st.l.Unlock()
+			return 0, io.ErrClosedPipe
+		case len(st.chunks) > 0:
+			n := copy(b, st.chunks[0])
+			st.chunks[0] = st.chunks[0][n:]
+			if len(st.chunks[0]) == 0 {
+				st.chunks = st.chunks[1:]
+			}
+			st.l.Unlock()
+			return n, nil
+		case st.err != nil:
+			st.l.Unlock()
+			return 0, st.err
+		case st.eos:
+			st.l.Unlock()
+			return 0, io.EOF
+		}
+		deadline := st.deadline
+		st.l.Unlock()
+
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, muxTimeoutError{}
+			}
+
+			timer := time.NewTimer(d)
+			timeout = timer.C
+			defer timer.Stop()
+		}
+
+		select {
+		case <-st.notify:
+		case <-timeout:
+			return 0, muxTimeoutError{}
+		}
+	}
+}
+
+func (st *muxStream) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil // empty payloads end the stream
+	}
+
+	st.l.Lock()
+	closed, err := st.closed, st.err
+	st.l.Unlock()
+	if closed {
+		return 0, io.ErrClosedPipe
+	} else if err != nil {
+		return 0, err
+	}
+
+	err = st.s.writeFrame(st.key, b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close ends the stream, without closing the session
+func (st *muxStream) Close() error {
+	st.l.Lock()
+	if st.closed {
+		st.l.Unlock()
+		return nil
+	}
+	st.closed = true
+	eos, err := st.eos, st.err
+	st.chunks = nil
+	st.wake()
+	st.l.Unlock()
+
+	if err != nil {
+		return nil // the session has already failed
+	}
+
+	if eos {
+		st.s.release(st)
+	}
+	return st.s.writeFrame(st.key, nil)
+}
+
+func (st *muxStream) LocalAddr() net.Addr  { return st.s.conn.LocalAddr() }
+func (st *muxStream) RemoteAddr() net.Addr { return st.s.conn.RemoteAddr() }
+
+func (st *muxStream) SetDeadline(t time.Time) error {
+	return st.SetReadDeadline(t)
+}
+
+func (st *muxStream) SetReadDeadline(t time.Time) error {
+	st.l.Lock()
+	defer st.l.Unlock()
+	st.deadline = t
+	st.wake()
+	return nil
+}
+
+// SetWriteDeadline is a no-op: the connection of the session is shared by all
+// of its streams, thus its deadline can't be set per stream
+func (st *muxStream) SetWriteDeadline(t time.Time) error { return nil }
+
+type muxTimeoutError struct{}
+
+func (muxTimeoutError) Error() string   { return "ep: stream read timeout" }
+func (muxTimeoutError) Timeout() bool   { return true }
+func (muxTimeoutError) Temporary() bool { return true }
@@ -0,0 +1,182 @@
+package ep
+
+// NullMask is a bitset of the null values of a Data implementation, for
+// embedding as an exported field, such that it's sent along by exchanges. Its
+// methods mirror the ones of Data that involve nulls, and the built-in types
+// implement them with it, for example:
+//
+//	type ints struct {
+//		Values []int
+//		Null   ep.NullMask
+//	}
+//
+//	func (vs *ints) IsNull(i int) bool { return vs.Null.Get(i) }
+//	func (vs *ints) MarkNull(i int)    { vs.Null.Set(i, true) }
+//	func (vs *ints) Nulls() []bool     { return vs.Null.Nulls(len(vs.Values)) }
+//	func (vs *ints) Slice(s, e int) ep.Data {
+//		return &ints{vs.Values[s:e], vs.Null.Slice(s, e)}
+//	}
+//
+// The zero value has no nulls, and it's only allocated once a value is set to
+// be null. It doesn't know its length: bits beyond it aren't null.
+//
+// Unlike the values, the mask is copied by Slice, as the nulls of a slice
+// rarely start on a word of the mask, thus the nulls of a sliced Data are
+// independent of the ones of the Data it was sliced from: MarkNull, or Swap,
+// of either one aren't seen by the other one, while changes to the values are
+type NullMask []uint64
+
+// Get reports whether the i-th value is null
+func (m NullMask) Get(i int) bool {
+	w := i / 64
+	return w < len(m) && m[w]&(1<<uint(i%64)) != 0
+}
+
+// Set sets the i-th value to be null, or not
+func (m *NullMask) Set(i int, null bool) {
+	w := i / 64
+	if w >= len(*m) {
+		if !null {
+			return
+		}
+		*m = append(*m, make(NullMask, w-len(*m)+1)...)
+	}
+
+	if null {
+		(*m)[w] |= 1 << uint(i%64)
+	} else {
+		(*m)[w] &^= 1 << uint(i%64)
+	}
+}
+
+// Nulls returns the booleans of the first n values, as with Data.Nulls
+func (m NullMask) Nulls(n int) []bool {
+	res := make([]bool, n)
+	if m != nil {
+		for i := range res {
+			res[i] = m.Get(i)
+		}
+	}
+	return res
+}
+
+// Swap swaps the i-th and j-th values
+func (m *NullMask) Swap(i, j int) {
+	null1, null2 := m.Get(i), m.Get(j)
+	if null1 != null2 {
+		m.Set(i, null2)
+		m.Set(j, null1)
+	}
+}
+
+// Slice returns a new mask of the values from start to end, as with
+// Data.Slice. Unlike the values, it's a copy, see NullMask
+func (m NullMask) Slice(start, end int) NullMask {
+	end = min(end, len(m)*64)
+	if start >= end {
+		return nil
+	}
+
+	// every word is shifted from the pair of words it overlaps
+	res := make(NullMask, (end-start+63)/64)
+	w, shift := start/64, uint(start%64)
+	for i := range res {
+		res[i] = m[w+i] >> shift
+		if shift > 0 && w+i+1 < len(m) {
+			res[i] |= m[w+i+1] << (64 - shift)
+		}
+	}
+
+	if n := uint((end - start) % 64); n > 0 {
+		res[len(res)-1] &= 1<<n - 1 // the bits beyond the end
+	}
+	return res.trim()
+}
+
+// Append returns a new mask of n values of this mask, followed by the values of
+// the other mask, as with Data.Append
+func (m NullMask) Append(n int, other NullMask) NullMask {
+	res := m.Slice(0, n)
+	res.setAll(n, other)
+	return res
+}
+
+// setAll sets the values from the offset to be null as the values of the other
+// mask, for appending many masks at once
+func (m *NullMask) setAll(offset int, other NullMask) {
+	other = other.trim()
+	if len(other) == 0 {
+		return
+	}
+
+	// every word is split between the pair of words it overlaps
+	w, shift := offset/64, uint(offset%64)
+	if size := w + len(other) + 1; size > len(*m) {
+		*m = append(*m, make(NullMask, size-len(*m))...)
+	}
+	for i, word := range other {
+		(*m)[w+i] |= word << shift
+		if shift > 0 {
+			(*m)[w+i+1] |= word >> (64 - shift)
+		}
+	}
+	*m = m.trim()
+}
+
+// Duplicate returns a new mask of the n values of this mask, repeated t times,
+// as with Data.Duplicate
+func (m NullMask) Duplicate(n, t int) NullMask {
+	m = m.Slice(0, n)
+	if len(m) == 0 {
+		return nil
+	}
+
+	res := make(NullMask, 0, (n*t+63)/64+1)
+	for i := 0; i < t; i++ {
+		res.setAll(i*n, m)
+	}
+	return res
+}
+
+// trim returns the mask without its trailing words of no nulls, thus nil
+// without any nulls, as if they were never set
+func (m NullMask) trim() NullMask {
+	for len(m) > 0 && m[len(m)-1] == 0 {
+		m = m[:len(m)-1]
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// Take returns a new mask of the values at the indices, as with Taker
+func (m NullMask) Take(indices []int) NullMask {
+	var res NullMask
+	for j, i := range indices {
+		if m.Get(i) {
+			res.Set(j, true)
+		}
+	}
+	return res
+}
+
+// Copy sets the toRow-th value to be null, or not, as the fromRow-th value of
+// the other mask, as with Data.Copy
+func (m *NullMask) Copy(from NullMask, fromRow, toRow int) {
+	m.Set(toRow, from.Get(fromRow))
+}
+
+// Size returns the number of bytes of the mask, as with Sized
+func (m NullMask) Size() uint64 { return uint64(len(m)) * 8 }
+
+// compareNulls compares a pair of values with at least one null, reporting
+// whether either one is null. Nulls sort last
+func compareNulls(null1, null2 bool) (c int, ok bool) {
+	if null1 == null2 {
+		return 0, null1
+	} else if null1 {
+		return 1, true
+	}
+	return -1, true
+}
@@ -0,0 +1,113 @@
+package ep_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+)
+
+func TestNullMask(t *testing.T) {
+	var m ep.NullMask
+	require.False(t, m.Get(3))
+	require.Equal(t, []bool{false, false}, m.Nulls(2))
+
+	// unsetting isn't allocated
+	m.Set(100, false)
+	require.Nil(t, m)
+
+	m.Set(1, true)
+	m.Set(65, true)
+	require.True(t, m.Get(1))
+	require.True(t, m.Get(65))
+	require.False(t, m.Get(64))
+	require.False(t, m.Get(1000))
+
+	m.Set(1, false)
+	require.False(t, m.Get(1))
+
+	m.Swap(65, 2)
+	require.True(t, m.Get(2))
+	require.False(t, m.Get(65))
+
+	m.Copy(m, 2, 70)
+	require.True(t, m.Get(70))
+	m.Copy(m, 3, 70)
+	require.False(t, m.Get(70))
+
+	require.Equal(t, []bool{false, true, true}, m.Take([]int{3, 2, 2}).Nulls(3))
+	require.Nil(t, m.Take([]int{0, 1}))
+}
+
+// The nulls are kept by the operations of Data, across the boundaries of
+// the words of the bitset
+func TestNullMask_data(t *testing.T) {
+	var m ep.NullMask
+	m.Set(0, true)
+	m.Set(63, true)
+	m.Set(64, true)
+	m.Set(99, true)
+
+	nulls := m.Nulls(100)
+	require.Equal(t, nulls[62:66], m.Slice(62, 66).Nulls(4))
+	require.Nil(t, m.Slice(1, 63))
+
+	appended := m.Slice(0, 64).Append(64, m.Slice(64, 100))
+	require.Equal(t, nulls, appended.Nulls(100))
+
+	// appended after values that aren't null
+	appended = ep.NullMask(nil).Append(3, m)
+	require.Equal(t, append(make([]bool, 3), nulls...), appended.Nulls(103))
+
+	duplicated := m.Duplicate(100, 3)
+	require.Equal(t, append(append(nulls, nulls...), nulls...), duplicated.Nulls(300))
+	require.Nil(t, ep.NullMask(nil).Duplicate(100, 3))
+
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(m))
+	var decoded ep.NullMask
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&decoded))
+	require.Equal(t, nulls, decoded.Nulls(100))
+}
+
+// The operations of whole words are the same as the ones of every bit, for
+// any alignment of the values
+func TestNullMask_words(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for k := 0; k < 100; k++ {
+		n := r.Intn(300)
+		var m ep.NullMask
+		nulls := make([]bool, n)
+		for i := range nulls {
+			nulls[i] = r.Intn(3) == 0
+			m.Set(i, nulls[i])
+		}
+
+		start := r.Intn(n + 1)
+		end := start + r.Intn(n-start+1)
+		require.Equal(t, nulls[start:end], m.Slice(start, end).Nulls(end-start))
+
+		appended := m.Slice(start, end).Append(end-start, m)
+		require.Equal(t, append(append([]bool{}, nulls[start:end]...), nulls...), appended.Nulls(end-start+n))
+
+		duplicated := m.Slice(start, end).Duplicate(end-start, 3)
+		expected := append(append(append([]bool{}, nulls[start:end]...), nulls[start:end]...), nulls[start:end]...)
+		require.Equal(t, append(expected, make([]bool, 64)...), duplicated.Nulls(len(expected)+64))
+	}
+}
+
+// The nulls of a slice are independent of the ones of the data it was sliced
+// from, unlike its values
+func TestNullMask_sliceCopies(t *testing.T) {
+	data := &ep.Int64s{Values: []int64{1, 2, 3, 4}}
+	data.MarkNull(0)
+	slice := data.Slice(1, 4).(*ep.Int64s)
+	slice.MarkNull(0)
+	slice.Values[1] = 5
+
+	require.Equal(t, []bool{true, false, false, false}, data.Nulls())
+	require.Equal(t, []bool{true, false, false}, slice.Nulls())
+	require.Equal(t, []int64{1, 2, 5, 4}, data.Values)
+}
@@ -1,5 +1,7 @@
 package ep
 
+import "errors"
+
 // Null is a Type representing NULL values. Use Null.Data(n) to create Data
 // instances of `n` nulls
 var Null = &nullType{}
@@ -27,6 +29,7 @@ func (vs nulls) Len() int                   { return int(vs) }
 func (nulls) Less(int, int) bool            { return false }
 func (nulls) Swap(int, int)                 {}
 func (nulls) LessOther(int, Data, int) bool { return false }
+func (nulls) Compare(int, Data, int) int    { return 0 }
 func (nulls) Slice(i, j int) Data           { return nulls(j - i) }
 func (vs nulls) Append(data Data) Data      { return vs + data.(nulls) }
 func (vs nulls) Duplicate(t int) Data       { return vs * nulls(t) }
@@ -39,7 +42,8 @@ func (vs nulls) Nulls() []bool {
 	}
 	return res
 }
-func (vs nulls) Equal(data Data) bool {
+func (vs nulls) Equal(other Data) bool { return DataEqual(vs, other) }
+func (vs nulls) Same(data Data) bool {
 	d, ok := data.(nulls)
 	if !ok {
 		return false
@@ -48,6 +52,17 @@ func (vs nulls) Equal(data Data) bool {
 }
 func (vs nulls) Copy(Data, int, int) {}
 func (vs nulls) Strings() []string   { return make([]string, vs) }
+func (nulls) Size() uint64           { return 0 }
+
+// all of the values are nulls, which are rendered as empty strings
+func (nulls) AppendStringAt(dst []byte, _ int) []byte { return dst }
+
+// all of the values are nulls, which are marshaled as JSON nulls without
+// calling MarshalJSONValue
+func (nulls) MarshalJSONValue(int) ([]byte, error) { return jsonNull, nil }
+func (nulls) UnmarshalJSONValue(int, []byte) error {
+	return errors.New("expected null")
+}
 
 // variadicNulls inherits nulls to allow nulls with flexible length
 type variadicNulls struct{ nulls }
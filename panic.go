@@ -0,0 +1,66 @@
+package ep
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+var _ = registerGob(&safe{})
+
+// RepanicNonErrors makes the recovery of panics of Runners re-panic with the
+// panic values that aren't errors, e.g. of explicit panics with strings, while
+// runtime errors, like out of range indices, are still returned as errors.
+// It's false by default, such that all panics are recovered
+var RepanicNonErrors = false
+
+// Safe returns a Runner that runs r, and recovers from panics within its Run,
+// returning them as a PanicError, such that they're propagated as any other
+// error, including to the peers of a distributed Runner. Pipeline, Project and
+// the other composite Runners already run all of their runners this way, as
+// does the Distributer, thus Safe is needed only for Runners that run on their
+// own. Panics within go-routines started by r can't be recovered
+func Safe(r Runner) Runner { return &safe{r} }
+
+type safe struct{ Runner Runner }
+
+func (r *safe) Returns() []Type { return r.Runner.Returns() }
+func (r *safe) Run(ctx context.Context, inp, out chan Dataset) error {
+	return runSafe(ctx, r.Runner, inp, out)
+}
+
+// PanicError is the error of a Runner that panicked, of the value it panicked
+// with, and of the stack trace of the panic. Its message contains both, along
+// with the type of the Runner. When the value is an error, it's wrapped by the
+// PanicError, for errors.Is and errors.As
+type PanicError struct {
+	Runner Runner
+	Value  interface{}
+	Stack  []byte
+}
+
+// Error returns a message of the runner, the panic value and the stack trace
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("ep: runner %T panicked: %v\n%s", err.Runner, err.Value, err.Stack)
+}
+
+// Unwrap returns the panic value when it's an error, or nil otherwise
+func (err *PanicError) Unwrap() error {
+	e, _ := err.Value.(error)
+	return e
+}
+
+// runSafe runs the runner, returning a PanicError once it panics, unless
+// RepanicNonErrors is set and the panic isn't of an error
+func runSafe(ctx context.Context, r Runner, inp, out chan Dataset) (err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		} else if _, ok := v.(error); !ok && RepanicNonErrors {
+			panic(v)
+		}
+		err = &PanicError{r, v, debug.Stack()}
+	}()
+	return r.Run(ctx, inp, out)
+}
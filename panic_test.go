@@ -0,0 +1,90 @@
+package ep_test
+
+import (
+	"context"
+	"errors"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSafe(t *testing.T) {
+	inp := make(chan ep.Dataset, 3)
+	out := make(chan ep.Dataset, 3)
+	inp <- ep.NewDataset(strs{"a"})
+	inp <- ep.NewDataset(strs{"b"})
+	inp <- ep.NewDataset(strs{"c"})
+	close(inp)
+
+	// the panic mid-stream is returned, after the preceding output
+	r := &panicker{After: 1}
+	err := ep.Safe(r).Run(context.Background(), inp, out)
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), "ep: runner *ep_test.panicker panicked: runtime error"), err.Error())
+	require.Contains(t, err.Error(), "panic_test.go")
+	require.Equal(t, 1, len(out))
+
+	var panicErr *ep.PanicError
+	require.True(t, errors.As(err, &panicErr))
+	require.Equal(t, r, panicErr.Runner)
+
+	var runtimeErr runtime.Error
+	require.True(t, errors.As(err, &runtimeErr))
+}
+
+func TestSafe_repanicNonErrors(t *testing.T) {
+	r := ep.RunnerFunc(func(context.Context, ep.Dataset) (ep.Dataset, error) {
+		panic("bad")
+	})
+
+	_, err := eptest.Run(ep.Safe(r), ep.NewDataset(strs{"a"}))
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), "ep: runner *ep.flatMap panicked: bad"), err.Error())
+
+	ep.RepanicNonErrors = true
+	defer func() { ep.RepanicNonErrors = false }()
+	inp := make(chan ep.Dataset, 1)
+	inp <- ep.NewDataset(strs{"a"})
+	close(inp)
+	require.PanicsWithValue(t, "bad", func() {
+		ep.Safe(r).Run(context.Background(), inp, make(chan ep.Dataset, 1))
+	})
+
+	// errors are still recovered
+	_, err = eptest.Run(ep.Safe(&panicker{}), ep.NewDataset(strs{"a"}))
+	require.Error(t, err)
+}
+
+// Pipeline and Project recover the panics of their runners, which are run in
+// go-routines of their own
+func TestPipeline_panic(t *testing.T) {
+	r := ep.Pipeline(&upper{}, ep.Project(ep.PassThrough(), &panicker{After: 1}), &upper{})
+	_, err := eptest.Run(r, ep.NewDataset(strs{"a"}), ep.NewDataset(strs{"b"}), ep.NewDataset(strs{"c"}))
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), "ep: runner *ep_test.panicker panicked"), err.Error())
+
+	var stageErr *ep.StageError
+	require.True(t, errors.As(err, &stageErr))
+	require.Equal(t, 1, stageErr.Stage)
+}
+
+// A panic on any of the nodes, or on all of them, fails the distributed runner
+// cleanly, rather than crashing or hanging the others
+func TestInMemoryCluster_panic(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	datasets := []ep.Dataset{ep.NewDataset(strs{"a"}), ep.NewDataset(strs{"b"}), ep.NewDataset(strs{"c"})}
+	for _, r := range []ep.Runner{
+		ep.Pipeline(ep.Scatter(), &panicker{After: 0}, ep.Gather()),
+		ep.Pipeline(ep.Scatter(), ep.Broadcast(), &panicker{After: 0}, ep.Gather()),
+		ep.Pipeline(ep.Scatter(), ep.Broadcast(), &panicker{After: 2}, ep.Gather()),
+	} {
+		_, err := eptest.Run(cluster.Distribute(r), datasets...)
+		require.Error(t, err)
+		require.True(t, strings.HasPrefix(err.Error(), "ep: runner *ep_test.panicker panicked: runtime error"), err.Error())
+	}
+}
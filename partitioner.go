@@ -0,0 +1,163 @@
+package ep
+
+import (
+	"sort"
+	"stathat.com/c/consistent"
+	"strconv"
+)
+
+var _ = registerGob(&hashPartitioner{}, &rangePartitioner{}, &consistentPartitioner{})
+
+// Partitioner decides the destination node of every row routed by a
+// PartitionBy exchange. Partitioners are distributed to all of the nodes along
+// with the exchange, thus they must be gob-encodable and deterministic: all
+// nodes must route the same row to the same destination
+type Partitioner interface {
+	// Partition returns the index of the destination node, out of numNodes,
+	// for the row at the provided index of data. Nodes are indexed in the
+	// order of the AllNodes of the exchange. A negative index indicates that
+	// the row can't be partitioned
+	Partition(data Dataset, row int, numNodes int) int
+}
+
+// PartitionBy returns an exchange Runner that routes every row of its input
+// to the node selected by the provided Partitioner.
+// The output will not necessarily be in the same order as the input.
+func PartitionBy(p Partitioner) Runner {
+	ex := Partition().(*exchange)
+	ex.Partitioner = p
+	return ex
+}
+
+// HashPartitioner returns a Partitioner that hashes the values of the provided
+// columns of every row, modulo the number of nodes. When no columns are
+// provided, the first column is used. Unlike Partition, which uses consistent
+// hashing, adding a node moves most of the rows to other nodes
+func HashPartitioner(columns ...int) Partitioner {
+	return &hashPartitioner{columns}
+}
+
+type hashPartitioner struct {
+	Columns []int
+}
+
+func (p *hashPartitioner) Partition(data Dataset, row int, numNodes int) int {
+	cols := p.Columns
+	if len(cols) == 0 {
+		cols = []int{0}
+	}
+
+	if !validColumns(data, cols) {
+		return -1
+	}
+	return int(HashDataset(data, row, cols) % uint64(numNodes))
+}
+
+// validColumns reports whether all of the columns are within the width of the
+// data
+func validColumns(data Dataset, cols []int) bool {
+	for _, col := range cols {
+		if col < 0 || col >= data.Width() {
+			return false
+		}
+	}
+	return true
+}
+
+// PartitionConsistent returns an exchange Runner that routes every row of its
+// input by the consistent hash of the provided columns, using a
+// ConsistentHashPartitioner with the default number of virtual nodes.
+// The output will not necessarily be in the same order as the input.
+func PartitionConsistent(columns ...int) Runner {
+	return PartitionBy(ConsistentHashPartitioner(0, columns...))
+}
+
+// ConsistentHashPartitioner returns a Partitioner that places the addresses of
+// all of the nodes on a hash ring, with the provided number of virtual nodes
+// (replicas) each, and routes every row to the node following the hash of its
+// columns on the ring. Thus adding or removing a node only remaps about 1/n of
+// the keys. When no columns are provided, the first column is used. When
+// replicas isn't positive, it defaults to 20
+func ConsistentHashPartitioner(replicas int, columns ...int) Partitioner {
+	return &consistentPartitioner{Columns: columns, Replicas: replicas}
+}
+
+// nodesPartitioner is implemented by Partitioners that route rows by the
+// addresses of the nodes, rather than by their number alone. Exchanges set the
+// addresses of their target nodes before partitioning
+type nodesPartitioner interface {
+	setNodes(nodes []string)
+}
+
+type consistentPartitioner struct {
+	Columns  []int
+	Replicas int
+
+	ring  *consistent.Consistent
+	index map[string]int // node index by its address
+}
+
+func (p *consistentPartitioner) setNodes(nodes []string) {
+	p.ring = consistent.New()
+	if p.Replicas > 0 {
+		p.ring.NumberOfReplicas = p.Replicas
+	}
+
+	p.index = make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		p.ring.Add(node)
+		p.index[node] = i
+	}
+}
+
+func (p *consistentPartitioner) Partition(data Dataset, row int, numNodes int) int {
+	if p.ring == nil || len(p.index) != numNodes {
+		// the addresses are unknown, use the indices of the nodes instead
+		nodes := make([]string, numNodes)
+		for i := range nodes {
+			nodes[i] = strconv.Itoa(i)
+		}
+		p.setNodes(nodes)
+	}
+
+	cols := p.Columns
+	if len(cols) == 0 {
+		cols = []int{0}
+	}
+
+	if !validColumns(data, cols) {
+		return -1
+	}
+
+	node, err := p.ring.Get(strconv.FormatUint(HashDataset(data, row, cols), 16))
+	if err != nil {
+		return -1
+	}
+	return p.index[node]
+}
+
+// RangePartitioner returns a Partitioner that routes every row by the range
+// its value in the first column falls into. boundaries are the sorted lower
+// bounds of all ranges, except for the first one: rows lower than the first
+// boundary go to the first node, rows between the first and second boundaries
+// go to the second node, etc. Thus it expects one boundary less than the
+// number of nodes.
+func RangePartitioner(boundaries Data) Partitioner {
+	return &rangePartitioner{boundaries}
+}
+
+type rangePartitioner struct {
+	Boundaries Data
+}
+
+func (p *rangePartitioner) Partition(data Dataset, row int, numNodes int) int {
+	if data.Width() == 0 {
+		return -1
+	}
+
+	// find the first boundary that's greater than the value
+	col := data.At(0)
+	return sort.Search(p.Boundaries.Len(), func(i int) bool {
+		return col.LessOther(row, p.Boundaries, i)
+	})
+}
@@ -0,0 +1,64 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+)
+
+func TestHashPartitioner(t *testing.T) {
+	data := ep.NewDataset(strs{"a", "b", "a", "c"}, strs{"x", "x", "x", "y"})
+	p := ep.HashPartitioner(0, 1)
+
+	nodes := make([]int, data.Len())
+	for i := range nodes {
+		nodes[i] = p.Partition(data, i, 3)
+		require.True(t, nodes[i] >= 0 && nodes[i] < 3, "node %d out of range", nodes[i])
+	}
+	require.Equal(t, nodes[0], nodes[2])
+}
+
+func TestHashPartitioner_columnOutOfRange(t *testing.T) {
+	data := ep.NewDataset(strs{"a"})
+	require.Equal(t, -1, ep.HashPartitioner(1).Partition(data, 0, 3))
+}
+
+func TestRangePartitioner(t *testing.T) {
+	data := ep.NewDataset(strs{"a", "f", "g", "m", "z"})
+	p := ep.RangePartitioner(strs{"f", "m"})
+
+	nodes := []int{}
+	for i := 0; i < data.Len(); i++ {
+		nodes = append(nodes, p.Partition(data, i, 3))
+	}
+	require.Equal(t, []int{0, 1, 1, 2, 2}, nodes)
+}
+
+func TestConsistentHashPartitioner(t *testing.T) {
+	keys := make(strs, 10000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	data := ep.NewDataset(keys)
+
+	n := 5
+	p := ep.ConsistentHashPartitioner(100)
+	before := make([]int, data.Len())
+	for i := range before {
+		before[i] = p.Partition(data, i, n)
+		require.True(t, before[i] >= 0 && before[i] < n, "node %d out of range", before[i])
+	}
+
+	// with an additional node, only the keys moved to it can be remapped
+	moved := 0
+	for i := range before {
+		node := p.Partition(data, i, n+1)
+		if node != before[i] {
+			require.Equal(t, n, node)
+			moved++
+		}
+	}
+	require.True(t, moved > 0)
+	require.True(t, moved < 2*data.Len()/n, "%d of %d keys moved", moved, data.Len())
+}
@@ -46,19 +46,63 @@ func Pipeline(runners ...Runner) Runner {
 
 type pipeline []Runner
 
-func (rs pipeline) Run(ctx context.Context, inp, out chan Dataset) (err error) {
-	// choose first error out from all errors
-	errs := make([]error, len(rs))
-	var wg sync.WaitGroup
+// StageError is the error returned by a Pipeline, of the first of its runners
+// that failed, which is its Stage-th runner. Its message is the one of the
+// error of the Runner, such that errors are reported the same way both within
+// and without pipelines, e.g. by the peers of a distributed Runner, while the
+// Stage is found with errors.As
+type StageError struct {
+	Stage  int
+	Runner Runner
+	Err    error
+}
 
+// Error returns the message of the error of the runner
+func (err *StageError) Error() string { return err.Err.Error() }
+
+// Unwrap returns the error of the runner
+func (err *StageError) Unwrap() error { return err.Err }
+
+// Run runs all of the runners concurrently, each of them in a go-routine of
+// its own except for the last one, and closes the output of every one of them
+// once it returns. A runner that returns before its input is completed, like
+// Limit, cancels all of the runners before it, as their output is no longer
+// received, and the rest of its input is drained. The first runner to fail
+// cancels all of the others, and its error is returned, as a StageError. Run
+// returns only once all of the runners have returned
+func (rs pipeline) Run(origCtx context.Context, inp, out chan Dataset) (err error) {
+	ctx, cancel := context.WithCancel(origCtx)
+
+	// the first error of all of the runners, which cancels the others
+	var l sync.Mutex
+	var first *StageError
+	fail := func(i int, err error) {
+		l.Lock()
+		defer l.Unlock()
+		if err == nil || first != nil {
+			return
+		}
+
+		first = &StageError{i, rs[i], err}
+		cancel()
+	}
+
+	var wg sync.WaitGroup
 	defer func() {
 		wg.Wait()
-		for i := 0; err == nil && i < len(rs); i++ {
-			err = errs[i]
+		if first != nil {
+			err = first
 		}
 	}()
 
-	ctx, cancel := context.WithCancel(ctx)
+	// the context of every runner, canceled once any of the runners after it
+	// returns, while the context of the last one is the one of the pipeline
+	ctxs := make([]context.Context, len(rs))
+	cancels := make([]context.CancelFunc, len(rs)-1)
+	ctxs[len(rs)-1] = ctx
+	for i := len(rs) - 2; i >= 0; i-- {
+		ctxs[i], cancels[i] = context.WithCancel(ctxs[i+1])
+	}
 
 	// run all of the internal runners (all except the very last one), piping
 	// the output from each runner to the next.
@@ -81,7 +125,14 @@ func (rs pipeline) Run(ctx context.Context, inp, out chan Dataset) (err error) {
 		go func(i int, inp, middle chan Dataset) {
 			defer wg.Done()
 			defer close(middle)
-			errs[i] = rs[i].Run(ctx, inp, middle)
+			fail(i, runSafe(ctxs[i], rs[i], inp, middle))
+			if i > 0 {
+				// the runner might have returned before its input was
+				// completed, thus the runners before it are stopped
+				cancels[i-1]()
+				for range inp {
+				}
+			}
 		}(i, inp, middle)
 
 		// input to the next channel is the output from the current one.
@@ -94,7 +145,8 @@ func (rs pipeline) Run(ctx context.Context, inp, out chan Dataset) (err error) {
 	defer cancel()
 
 	// block run the last runner until completed
-	return rs[len(rs)-1].Run(ctx, inp, out)
+	fail(len(rs)-1, runSafe(ctxs[len(rs)-1], rs[len(rs)-1], inp, out))
+	return nil
 }
 
 // The implementation isn't trivial because it has to account for Wildcard types
@@ -2,17 +2,21 @@ package ep_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/panoplyio/ep"
 	"github.com/panoplyio/ep/eptest"
 	"github.com/stretchr/testify/require"
+	"runtime"
+	"sort"
 	"testing"
+	"time"
 )
 
 func ExamplePipeline() {
-	runner := ep.Pipeline(&upper{}, &question{})
 	data := ep.NewDataset(strs([]string{"hello", "world"}))
-	data, err := eptest.Run(runner, data)
+	runner := ep.Pipeline(ep.Source(data), &upper{}, &question{})
+	data, err := eptest.Run(runner)
 	fmt.Println(data.Strings(), err)
 
 	// Output:
@@ -30,6 +34,24 @@ func ExamplePipeline_reverse() {
 	// [[IS HELLO? IS WORLD?]] <nil>
 }
 
+func ExamplePipeline_distributed() {
+	cluster := eptest.InMemoryCluster(2)
+	defer cluster.Close()
+
+	// the datasets are scattered between the nodes, transformed by each of
+	// them, and gathered back by the node that distributed the pipeline
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), &upper{}, ep.Gather()))
+	data := ep.NewDataset(strs([]string{"hello", "world"}))
+	data, err := eptest.Run(runner, data, data)
+
+	res := data.At(0).Strings()
+	sort.Strings(res)
+	fmt.Println(res, err)
+
+	// Output:
+	// [HELLO HELLO WORLD WORLD] <nil>
+}
+
 // test that upon an error, the producing (infinity) runners are canceled.
 // Otherwise - this test will block indefinitely
 func TestPipeline_errInFirstRunner(t *testing.T) {
@@ -182,3 +204,104 @@ func (*tailCutter) Run(_ context.Context, inp, out chan ep.Dataset) error {
 	}
 	return nil
 }
+
+// producer is a Runner that ignores its input, and outputs datasets until it's
+// canceled
+type producer struct{}
+
+func (*producer) Returns() []ep.Type { return []ep.Type{str} }
+func (*producer) Run(ctx context.Context, inp, out chan ep.Dataset) error {
+	for {
+		select {
+		case out <- ep.NewDataset(strs{"data"}):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// failAfter is a Runner that passes through n datasets, and then fails
+type failAfter struct{ n int }
+
+func (*failAfter) Returns() []ep.Type { return []ep.Type{ep.Wildcard} }
+func (r *failAfter) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	i := 0
+	for data := range inp {
+		if i == r.n {
+			return fmt.Errorf("failed after %d", r.n)
+		}
+		out <- data
+		i++
+	}
+	return nil
+}
+
+func TestPipeline_StageError(t *testing.T) {
+	errRunner := NewErrRunner(fmt.Errorf("something bad happened"))
+	runner := ep.Pipeline(&upper{}, errRunner, &question{})
+	_, err := eptest.Run(runner, ep.NewDataset(strs{"hello"}))
+	require.EqualError(t, err, "something bad happened")
+
+	var stageErr *ep.StageError
+	require.True(t, errors.As(err, &stageErr))
+	require.Equal(t, 1, stageErr.Stage)
+	require.Equal(t, errRunner, stageErr.Runner)
+}
+
+// the first error to occur is returned, rather than the ones of the runners
+// that it canceled, even when they precede it
+func TestPipeline_firstError(t *testing.T) {
+	runner := ep.Pipeline(&producer{}, &failAfter{3}, &upper{})
+	_, err := eptest.Run(runner)
+	require.EqualError(t, err, "failed after 3")
+
+	var stageErr *ep.StageError
+	require.True(t, errors.As(err, &stageErr))
+	require.Equal(t, 1, stageErr.Stage)
+}
+
+// runners canceled once the last runner completed don't fail the pipeline
+func TestPipeline_canceledByLastRunner(t *testing.T) {
+	res, err := eptest.Run(ep.Pipeline(&producer{}, &upper{}, &first{}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[DATA]"}, res.Strings())
+}
+
+func TestPipeline_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the canceled pipeline stops, without failing
+	_, err := eptest.RunWithContext(ctx, ep.Pipeline(&producer{}, &upper{}))
+	require.NoError(t, err)
+}
+
+// no go-routines are leaked when a middle runner fails while the first one is
+// still producing
+func TestPipeline_noLeaks(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		runner := ep.Pipeline(&producer{}, &upper{}, &failAfter{i}, &question{}, &upper{})
+		_, err := eptest.Run(runner)
+		require.EqualError(t, err, fmt.Sprintf("failed after %d", i))
+	}
+
+	// leftovers from previous tests might exit meanwhile, thus allow fewer
+	for i := 0; i < 100 && runtime.NumGoroutine() > goroutines; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	n := runtime.NumGoroutine()
+	require.True(t, n <= goroutines, "%d go-routines leaked", n-goroutines)
+}
+
+// first is a Runner that outputs the first dataset of its input, and returns
+type first struct{}
+
+func (*first) Returns() []ep.Type { return []ep.Type{ep.Wildcard} }
+func (*first) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	for data := range inp {
+		out <- data
+		return nil
+	}
+	return nil
+}
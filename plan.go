@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
 )
 
 // Runners registry. See Registries in the main doc.
@@ -89,15 +90,91 @@ func (reg runnersReg) GetWithArgs(k interface{}, args []Type) []Runner {
 // registry of types
 type typesReg map[interface{}][]Type
 
+// RegisterOption modifies how Types.Register handles a Type of the name of an
+// already registered Type
+type RegisterOption func(*registerOptions)
+
+type registerOptions struct {
+	Override bool
+}
+
+// Override is a RegisterOption that replaces the registered Type of the same
+// name, under all of its keys, rather than panicking
+func Override() RegisterOption {
+	return func(opts *registerOptions) { opts.Override = true }
+}
+
 // Register a key-type pair to be globally accessible via the Get() function
-// using the same key.
-func (reg typesReg) Register(k interface{}, t Type) typesReg {
-	registerGob(t, t.Data(0))
+// using the same key. Names of Types are unique: registering another Type of
+// the name of a registered Type panics, unless Override is set, while
+// registering an equal Type again only adds it under the key.
+func (reg typesReg) Register(k interface{}, t Type, opts ...RegisterOption) typesReg {
+	var options registerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if prev := reg.named(t.Name()); prev != nil && !reflect.DeepEqual(prev, t) {
+		if !options.Override {
+			panic(fmt.Sprintf("ep: type %q is already registered, as %T, use Override to replace it", t.Name(), prev))
+		}
+		reg.remove(t.Name())
+	}
+
+	registerType(t)
 	k = registryKey(k)
+	for _, other := range reg[k] {
+		if reflect.DeepEqual(other, t) {
+			return reg
+		}
+	}
 	reg[k] = append(reg[k], t)
 	return reg
 }
 
+// named returns the registered Type of the name, or nil
+func (reg typesReg) named(name string) Type {
+	for _, list := range reg {
+		for _, t := range list {
+			if t.Name() == name {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// remove removes the Types of the name from all of the keys
+func (reg typesReg) remove(name string) {
+	for k, list := range reg {
+		res := list[:0:0]
+		for _, t := range list {
+			if t.Name() != name {
+				res = append(res, t)
+			}
+		}
+		reg[k] = res
+	}
+}
+
+// unknown returns the error of an unknown type name, listing the names of the
+// registered Types, to spot typos
+func (reg typesReg) unknown(name string) error {
+	set := map[string]bool{}
+	for _, list := range reg {
+		for _, t := range list {
+			set[t.Name()] = true
+		}
+	}
+
+	names := make([]string, 0, len(set))
+	for n := range set {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("ep: unknown type %q; registered types are %v", name, names)
+}
+
 // Get a list of Types that were previously registered to the provided key
 // via the Register() function.
 func (reg typesReg) Get(k interface{}) []Type {
@@ -0,0 +1,144 @@
+package ep
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressFunc receives the progress of an exchange, by its UID, while it
+// runs: the statistics so far by peer address, as returned by Stats. It's
+// called from a go-routine of the exchange, thus it should return quickly.
+// A slow ProgressFunc doesn't block the exchange, instead the reports that
+// are due while it's still running are skipped
+type ProgressFunc func(uid string, stats map[string]PeerStats)
+
+// Progress sets an exchange Runner, returned by Scatter, Gather, Partition,
+// etc., to report its progress to fn while it runs: every n batches sent or
+// received, when n is positive, and every interval, when it's positive. A
+// final report follows once it completes. Unlike the other options, fn isn't
+// distributed, thus only this node reports its progress. See WithProgress for
+// the exchanges that aren't set directly.
+func Progress(r Runner, n int, interval time.Duration, fn ProgressFunc) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: Progress expects an exchange")
+	}
+
+	ex.progress = &progressConfig{n, interval, fn}
+	return ex
+}
+
+// WithProgress returns a copy of the context, under which exchanges report
+// their progress to fn like with Progress, unless they're set with Progress
+// themselves. Contexts aren't distributed, thus it only covers the exchanges
+// that run on this node
+func WithProgress(ctx context.Context, n int, interval time.Duration, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey, &progressConfig{n, interval, fn})
+}
+
+// LogProgress returns a ProgressFunc that logs the progress of exchanges to
+// the logger, a line per peer
+func LogProgress(logger *log.Logger) ProgressFunc {
+	return func(uid string, stats map[string]PeerStats) {
+		addrs := make([]string, 0, len(stats))
+		for addr := range stats {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+
+		for _, addr := range addrs {
+			st := stats[addr]
+			logger.Printf(
+				"ep: exchange %s with %s: sent %d rows in %d batches (%d bytes), received %d rows in %d batches (%d bytes)",
+				uid, addr,
+				st.RowsSent, st.BatchesSent, st.BytesSent,
+				st.RowsReceived, st.BatchesReceived, st.BytesReceived,
+			)
+		}
+	}
+}
+
+type progressConfig struct {
+	n        int
+	interval time.Duration
+	fn       ProgressFunc
+}
+
+// progressOf returns the progress configuration of an exchange, set directly
+// or in the context, or nil when it doesn't report its progress
+func (ex *exchange) progressOf(ctx context.Context) *progressConfig {
+	if ex.progress != nil {
+		return ex.progress
+	}
+
+	cfg, _ := ctx.Value(progressKey).(*progressConfig)
+	return cfg
+}
+
+// progressReporter calls the ProgressFunc of an exchange from its own
+// go-routine, such that the encoders and decoders that count the batches only
+// notify it, without waiting
+type progressReporter struct {
+	*progressConfig
+	batches int64         // sent and received so far
+	due     chan struct{} // a report is due, buffered by one
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// reportProgress starts reporting the progress of the exchange, until the
+// returned function is called, which waits for the final report
+func (ex *exchange) reportProgress(cfg *progressConfig) func() {
+	p := &progressReporter{
+		progressConfig: cfg,
+		due:            make(chan struct{}, 1),
+		stop:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+
+	ex.reporter = p
+	go func() {
+		defer close(p.stopped)
+
+		var tick <-chan time.Time
+		if p.interval > 0 {
+			ticker := time.NewTicker(p.interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-tick:
+			case <-p.due:
+			case <-p.stop:
+				p.fn(ex.UID, Stats(ex))
+				return
+			}
+			p.fn(ex.UID, Stats(ex))
+		}
+	}()
+
+	return func() {
+		close(p.stop)
+		<-p.stopped
+	}
+}
+
+// batch counts a batch sent or received, and notifies the reporter once a
+// report is due. Notifications are dropped while it's still reporting
+func (p *progressReporter) batch() {
+	if p == nil || p.n <= 0 {
+		return
+	}
+
+	if atomic.AddInt64(&p.batches, 1)%int64(p.n) == 0 {
+		select {
+		case p.due <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package ep_test
+
+import (
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"log"
+	"os"
+)
+
+func ExampleLogProgress() {
+	cluster := eptest.InMemoryCluster(1)
+	defer cluster.Close()
+
+	logger := log.New(os.Stdout, "", 0)
+	gather := ep.Progress(ep.WithUID(ep.Gather(), "gather"), 0, 0, ep.LogProgress(logger))
+
+	data, err := eptest.Run(cluster.Distribute(gather), ep.NewDataset(strs{"hello", "world"}))
+	fmt.Println(data.Strings(), err)
+
+	// Output:
+	// ep: exchange gather with mem:1: sent 2 rows in 1 batches (0 bytes), received 2 rows in 1 batches (0 bytes)
+	// [[hello world]] <nil>
+}
@@ -10,10 +10,21 @@ var _ = registerGob(project([]Runner{}), &dummyRunner{})
 
 var errProjectState = fmt.Errorf("mismatched runners state")
 
+// projectStateError is the error of a runner of Project that returned a
+// different number of datasets than its input. It might be caused by an error
+// elsewhere, e.g. of another node that canceled an exchange, thus it's
+// returned by a distributed Run only when there are no other errors
+type projectStateError struct{ error }
+
 // Project returns a horizontal composite projection runner that dispatches
 // its input to all of the internal runners, and joins the result into a single
 // dataset to return. It is required that all runners produce Datasets of the
 // same length.
+//
+// Every runner receives the input independently of the others, thus the
+// datasets that one of them didn't receive yet are buffered in memory. When a
+// runner receives all of its input before outputting anything, like Sort, all
+// of the input is held in memory until it does
 func Project(runners ...Runner) Runner {
 	// flatten nested projects. note we should examine only first level, as any
 	// pre-created project was already flatten during its creation
@@ -66,129 +77,161 @@ func (rs project) Filter(keep []bool) {
 }
 
 // Run dispatches the same input to all inner runners, then collects and
-// joins their results into a single dataset output
+// joins their results into a single dataset output, of a single dataset of
+// every runner per input dataset. The input is buffered for every runner,
+// such that runners that read ahead don't block the others
 func (rs project) Run(origCtx context.Context, inp, out chan Dataset) (err error) {
 	rs.useDummySingleton()
-	// set up the left and right channels
-	inps := make([]chan Dataset, len(rs))
-	outs := make([]chan Dataset, len(rs))
-	errs := make([]error, len(rs))
-	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(origCtx)
+	defer cancel()
 
-	defer func() {
-		wg.Wait()
-		// choose first error out from all errors, that isn't project internal error
-		for _, errI := range errs {
-			if errI != nil && errI.Error() != errProjectState.Error() {
-				err = errI
-				break
-			}
+	var runners []int // the indices of the non-dummy runners
+	for i, r := range rs {
+		if r != dummyRunnerSingleton {
+			runners = append(runners, i)
 		}
-	}()
+	}
 
-	ctx, cancel := context.WithCancel(origCtx)
+	if len(runners) == 0 {
+		for range inp {
+		}
 
-	// run all runners in go-routines
-	for i := range rs {
-		inps[i] = make(chan Dataset)
+		result := NewDataset()
+		for range rs {
+			result, _ = result.Expand(variadicNullBatch)
+		}
+		out <- result
+		return nil
+	}
+
+	// count the input datasets, to verify the number of the outputs
+	counted := make(chan Dataset)
+	inputsCounted := make(chan struct{})
+	inputs := 0
+	go func() {
+		defer close(inputsCounted)
+		defer close(counted)
+		for data := range inp {
+			inputs++
+			counted <- data
+		}
+	}()
+
+	forks := forkInput(counted, len(runners))
+	outs := make([]chan Dataset, len(rs))
+	errs := make([]error, len(rs))
+	var wg sync.WaitGroup
+	for j, i := range runners {
 		outs[i] = make(chan Dataset)
+		input := forks[j]
+		if m, ok := rs[i].(MutatingRunner); ok && m.MutatesInput() {
+			input = cloneInput(input)
+		}
+
 		wg.Add(1)
-		go func(idx int) {
+		go func(i int, input chan Dataset) {
 			defer wg.Done()
-			errs[idx] = rs[idx].Run(ctx, inps[idx], outs[idx])
-			close(outs[idx])
-			// in case of error - drain inps[idx] to allow project keep
-			// duplicating data
-			if errs[idx] != nil {
+			defer close(outs[i])
+			errs[i] = runSafe(ctx, rs[i], input, outs[i])
+			if errs[i] != nil {
 				cancel()
 			}
-			go func() {
-				for range inps[idx] {
-				}
-			}()
-		}(i)
-	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+			// the runner might have returned before its input was completed
+			for range input {
+			}
+		}(i, input)
+	}
 
-		for i := range rs {
-			defer close(inps[i])
+	counts := make([]int, len(rs)) // the number of the outputs of every runner
+	completed := make([]bool, len(rs))
+	defer func() {
+		// cancel all runners, and drain their output to allow them complete
+		cancel()
+		for _, i := range runners {
+			for range outs[i] {
+				counts[i]++
+			}
 		}
+		wg.Wait()
+		<-inputsCounted
 
-		for {
-			select {
-			case <-origCtx.Done():
-				cancel()
-				return
-			case <-ctx.Done():
+		// choose first error out from all errors, over the ones of project
+		for _, runErr := range errs {
+			if runErr != nil {
+				err = runErr
 				return
-			case data, ok := <-inp:
-				if !ok {
-					return
-				}
-				// dispatch (duplicate) input to all runners
-				for i := range rs {
-					inps[i] <- data
-				}
 			}
 		}
-	}()
-
-	// cancel all runners when we're done - just in case few still running
-	// NOTE: cancel must be first defer to be called, to allow internal runners to finish
-	defer func() {
-		if err != nil {
-			cancel()
-			for i := range rs {
-				// drain all runners' output to allow them catch cancellation
-				go func(i int) {
-					for range outs[i] {
-					}
-				}(i)
-			}
+		if err == errProjectState && origCtx.Err() == nil {
+			err = rs.countsErr(counts, completed, inputs)
 		}
 	}()
 
 	// collect & join the output from all runners, in order
 	for {
 		result := NewDataset()
-		allOpen, allDummies := true, true
+		first, firstLen, open := -1, 0, 0
 		for i := range rs {
-			curr, open := <-outs[i]
-
 			if rs[i] == dummyRunnerSingleton {
-				// dummy runners shouldn't affect state check
-				curr, open = variadicNullBatch, allOpen
-			} else if allDummies {
-				allDummies = false
-				// init allOpen according to first out channel of non dummy runner
-				allOpen = open
-			} else if allOpen != open { // verify all still open or all closed
-				return errProjectState
+				result, _ = result.Expand(variadicNullBatch)
+				continue
 			}
 
-			if open {
-				result, err = result.Expand(curr)
-				if err != nil {
-					return err
-				}
+			curr, ok := <-outs[i]
+			if !ok {
+				completed[i] = true
+				continue
 			}
-		}
+			counts[i]++
+			open++
 
-		if !allOpen {
-			return // all done
+			if first < 0 {
+				first, firstLen = i, curr.Len()
+			} else if curr.Len() != firstLen {
+				return fmt.Errorf("ep: project runner %d returned %d rows, while runner %d returned %d", i, curr.Len(), first, firstLen)
+			}
+			result, _ = result.Expand(curr)
 		}
 
-		if err == nil {
-			out <- result
+		if open == 0 {
+			return nil // all done
+		} else if open != len(runners) {
+			// some of the runners completed before the others
+			return errProjectState
 		}
+		out <- result
+	}
+}
 
-		if allDummies {
-			return
+// countsErr returns the error of the first runner of which the number of
+// outputs isn't the number of inputs, when the runners completed at different
+// times. The number of outputs is exact for the runners that completed first,
+// while the others were canceled, thus returned at least as many
+func (rs project) countsErr(counts []int, completed []bool, inputs int) error {
+	for i, r := range rs {
+		if r != dummyRunnerSingleton && completed[i] && counts[i] != inputs {
+			return &projectStateError{fmt.Errorf("ep: project runner %d returned %d datasets for %d inputs, rather than one per input", i, counts[i], inputs)}
 		}
 	}
+	for i, r := range rs {
+		if r != dummyRunnerSingleton && counts[i] > inputs {
+			return &projectStateError{fmt.Errorf("ep: project runner %d returned %d datasets for %d inputs, rather than one per input", i, counts[i], inputs)}
+		}
+	}
+	return errProjectState
+}
+
+// cloneInput returns an input of clones of all of the datasets of the input
+func cloneInput(inp chan Dataset) chan Dataset {
+	res := make(chan Dataset)
+	go func() {
+		defer close(res)
+		for data := range inp {
+			res <- Clone(data).(Dataset)
+		}
+	}()
+	return res
 }
 
 // useDummySingleton replaces all dummies with pre-defined singleton to allow addresses comparison
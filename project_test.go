@@ -1,6 +1,7 @@
 package ep_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/panoplyio/ep"
 	"github.com/panoplyio/ep/eptest"
@@ -71,6 +72,21 @@ func TestProject_errorInThirdRunner(t *testing.T) {
 	require.Equal(t, false, infinityRunner2.IsRunning(), "Infinity 2 go-routine leak")
 }
 
+// The runners canceled by the project, once the other one failed, return the
+// error of the cancellation, which isn't the one returned by the project
+func TestProject_errorAfterCanceledRunner(t *testing.T) {
+	gen := ep.Generate(func(ctx context.Context, emit func(ep.Dataset) error) error {
+		for {
+			if err := emit(ep.NewDataset(strs{"data"})); err != nil {
+				return err
+			}
+		}
+	})
+	runner := ep.Project(gen, NewErrRunner(fmt.Errorf("something bad happened")))
+	_, err := eptest.Run(runner, ep.NewDataset(ep.Null.Data(1)))
+	require.EqualError(t, err, "something bad happened")
+}
+
 func TestProject_errorInPipeline(t *testing.T) {
 	err := fmt.Errorf("something bad happened")
 	infinityRunner1 := &infinityRunner{}
@@ -166,7 +182,7 @@ func TestProject_errorMismatchRows(t *testing.T) {
 	data := ep.NewDataset(strs([]string{"hello", "world"}))
 	_, err := eptest.Run(runner, data)
 	require.Error(t, err)
-	require.Equal(t, "mismatched number of rows", err.Error())
+	require.Equal(t, "ep: project runner 1 returned 1 rows, while runner 0 returned 2", err.Error())
 }
 
 func TestProject_Filter(t *testing.T) {
@@ -260,3 +276,99 @@ func TestProject_Filter_nestedWithInternalAll(t *testing.T) {
 	require.True(t, q2.called)
 	require.Equal(t, "[[] [] [is hello? is world?]]", fmt.Sprintf("%+v", data.Strings()))
 }
+
+// twice is a Runner that outputs every dataset of its input twice
+type twice struct{}
+
+func (*twice) Returns() []ep.Type { return []ep.Type{ep.Wildcard} }
+func (*twice) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	for data := range inp {
+		out <- data
+		out <- data
+	}
+	return nil
+}
+
+// skipOdd is a Runner that outputs the even datasets of its input alone
+type skipOdd struct{}
+
+func (*skipOdd) Returns() []ep.Type { return []ep.Type{ep.Wildcard} }
+func (*skipOdd) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	i := 0
+	for data := range inp {
+		if i%2 == 0 {
+			out <- data
+		}
+		i++
+	}
+	return nil
+}
+
+// sorter is a MutatingRunner that sorts every dataset of its input in place
+type sorter struct{}
+
+func (*sorter) Returns() []ep.Type { return []ep.Type{ep.Wildcard} }
+func (*sorter) MutatesInput() bool { return true }
+func (*sorter) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	for data := range inp {
+		ep.Sort(data, []ep.SortingCol{{Index: 0}})
+		out <- data
+	}
+	return nil
+}
+
+// datasets are zipped by their order, even when runners read ahead
+func TestProject_manyInputs(t *testing.T) {
+	runner := ep.Project(ep.Pipeline(&upper{}, &question{}), &count{}, &upper{})
+	var datasets []ep.Dataset
+	for i := 0; i < 100; i++ {
+		datasets = append(datasets, ep.NewDataset(strs{fmt.Sprintf("v%d", i)}))
+	}
+
+	res, err := eptest.Run(runner, datasets...)
+	require.NoError(t, err)
+	require.Equal(t, 100, res.Len())
+	for i := 0; i < 100; i++ {
+		require.Equal(t, fmt.Sprintf("is V%d?", i), res.At(0).Strings()[i])
+		require.Equal(t, "1", res.At(1).Strings()[i])
+		require.Equal(t, fmt.Sprintf("V%d", i), res.At(2).Strings()[i])
+	}
+}
+
+func TestProject_noInput(t *testing.T) {
+	res, err := eptest.Run(ep.Project(&upper{}, &question{}))
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Width())
+}
+
+func TestProject_errorTwoDatasetsPerInput(t *testing.T) {
+	runner := ep.Project(&upper{}, &twice{})
+	data := ep.NewDataset(strs{"hello"})
+	_, err := eptest.Run(runner, data, data)
+	require.EqualError(t, err, "ep: project runner 1 returned 4 datasets for 2 inputs, rather than one per input")
+}
+
+func TestProject_errorNoDatasetsPerInput(t *testing.T) {
+	runner := ep.Project(&skipOdd{}, &upper{}, &question{})
+	data := ep.NewDataset(strs{"hello"})
+	_, err := eptest.Run(runner, data, data, data)
+	require.EqualError(t, err, "ep: project runner 0 returned 2 datasets for 3 inputs, rather than one per input")
+
+	// the runners of a single output never output the datasets of the others
+	runner = ep.Project(&upper{}, &dataRunner{ep.NewDataset(strs{"x"}), ""})
+	_, err = eptest.Run(runner, data, data)
+	require.EqualError(t, err, "ep: project runner 1 returned 1 datasets for 2 inputs, rather than one per input")
+}
+
+func TestProject_mutatingRunner(t *testing.T) {
+	runner := ep.Project(&upper{}, &sorter{}, &question{})
+	for i := 0; i < 10; i++ {
+		data := ep.NewDataset(strs{"c", "a", "b"})
+		res, err := eptest.Run(runner, data)
+		require.NoError(t, err)
+		require.Equal(t, []string{"[C A B]", "[a b c]", "[is c? is a? is b?]"}, res.Strings())
+
+		// the input itself isn't modified
+		require.Equal(t, []string{"[c a b]"}, data.Strings())
+	}
+}
@@ -0,0 +1,262 @@
+package ep
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+var _ = registerGob(&ack{})
+
+// ScatterResilient returns an exchange Runner similar to Scatter, except that
+// it's delivered at least once: when a peer fails, the datasets that were
+// sent to it but not yet acknowledged are sent again to the remaining peers,
+// instead of failing the exchange. Every peer acknowledges the datasets that
+// it receives, and every node keeps up to window datasets per peer until
+// they're acknowledged, blocking once the window is full.
+//
+// A peer might fail after acknowledging, or even outputting, datasets which
+// are nonetheless sent again to other peers, thus the datasets might be
+// processed more than once. It should only be used when the downstream work
+// is idempotent. The part of the input that the failed peer didn't send yet is
+// lost, as it's on that peer.
+func ScatterResilient(window int) Runner {
+	if window <= 0 {
+		window = defaultAckWindow
+	}
+	return &exchange{UID: newUID(), Type: scatter, Resilient: true, AckWindow: window}
+}
+
+// defaultAckWindow is the number of unacknowledged datasets kept per peer,
+// when not provided
+var defaultAckWindow = 8
+
+// ack is sent back from a receiving node to a resilient sender, over a
+// connection of its own, acknowledging all of the datasets received so far
+type ack struct {
+	Batches int // number of datasets received so far
+}
+
+// ackWindow holds the datasets sent to a peer until they're acknowledged
+type ackWindow struct {
+	size    int
+	l       sync.Mutex
+	cond    *sync.Cond
+	pending []Dataset // sent, not yet acknowledged
+	sent    int       // number of datasets sent so far
+	err     error     // once the peer has failed
+	retried bool      // the pending datasets were sent to other peers
+}
+
+func newAckWindow(size int) *ackWindow {
+	w := &ackWindow{size: size}
+	w.cond = sync.NewCond(&w.l)
+	return w
+}
+
+// push adds a dataset that's about to be sent, waiting while the window is
+// full. Fails once the peer has failed
+func (w *ackWindow) push(data Dataset) error {
+	w.l.Lock()
+	defer w.l.Unlock()
+	for len(w.pending) >= w.size && w.err == nil {
+		w.cond.Wait()
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+
+	w.pending = append(w.pending, data)
+	w.sent++
+	return nil
+}
+
+// ack drops the datasets acknowledged by the peer, out of the ones received
+// so far
+func (w *ackWindow) ack(received int) {
+	w.l.Lock()
+	defer w.l.Unlock()
+	acked := w.sent - len(w.pending)
+	if drop := received - acked; drop > 0 && drop <= len(w.pending) {
+		w.pending = w.pending[drop:]
+	}
+	w.cond.Broadcast()
+}
+
+// fail records the failure of the peer, keeping the first error
+func (w *ackWindow) fail(err error) {
+	w.l.Lock()
+	defer w.l.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.cond.Broadcast()
+}
+
+// wait waits until all of the pending datasets are acknowledged, or until the
+// peer fails
+func (w *ackWindow) wait() error {
+	w.l.Lock()
+	defer w.l.Unlock()
+	for len(w.pending) > 0 && w.err == nil {
+		w.cond.Wait()
+	}
+	return w.err
+}
+
+// unacked returns the pending datasets of a failed peer, only once, or nil
+// when the peer hasn't failed
+func (w *ackWindow) unacked() ([]Dataset, error) {
+	w.l.Lock()
+	defer w.l.Unlock()
+	if w.err == nil || w.retried {
+		return nil, nil
+	}
+
+	w.retried = true
+	pending := w.pending
+	w.pending = nil
+	return pending, w.err
+}
+
+// connectAcks opens the connection of the acknowledgements to and from a
+// peer, and listens in the background for the acknowledgements of the
+// datasets sent to it. Returns the window of the datasets sent to the peer
+func (ex *exchange) connectAcks(dist connector, addr string) (*ackWindow, error) {
+	conn, err := ex.connectUID(dist, addr, ex.UID+"/acks")
+	if err != nil {
+		return nil, err
+	}
+
+	ex.conns = append(ex.conns, conn)
+	if ex.ackEncs == nil {
+		ex.ackEncs = map[string]encoder{}
+	}
+	ex.ackEncs[addr] = newEncoder(conn)
+
+	w := newAckWindow(ex.AckWindow)
+	go listenForAcks(conn, addr, w)
+	return w, nil
+}
+
+// listenForAcks reads the acknowledgements from a peer, until the connection
+// is closed, which fails the window unless everything was acknowledged
+func listenForAcks(conn net.Conn, addr string, w *ackWindow) {
+	dec := newDecoder(conn)
+	req := &req{}
+	for {
+		err := dec.Decode(req)
+		if err != nil {
+			w.fail(fmt.Errorf("ep: peer %s stopped acknowledging: %s", addr, err))
+			return
+		}
+
+		if a, ok := req.Payload.(*ack); ok {
+			w.ack(a.Batches)
+		}
+	}
+}
+
+// encodeResilient encodes a dataset to the next live destination, like
+// encodeNext, sending it again to the next one when the destination fails.
+// The unacknowledged datasets of the destinations that failed before are
+// sent again first
+func (ex *exchange) encodeResilient(data Dataset) error {
+	for {
+		err := ex.resendUnacked()
+		if err != nil {
+			return err
+		}
+
+		dead := len(ex.dead)
+		err = ex.encodeNext(data)
+		if err == nil || len(ex.dead) == dead {
+			return err // succeeded, or failed for another reason
+		} else if _, allDead := err.(encodeErrors); allDead {
+			return err
+		}
+	}
+}
+
+// resendUnacked sends the unacknowledged datasets of the failed destinations
+// to the live ones, and marks the failed destinations as dead
+func (ex *exchange) resendUnacked() error {
+	for enc, w := range ex.windows {
+		pending, err := w.unacked()
+		if err == nil {
+			continue
+		}
+
+		if ex.dead[enc] == nil {
+			ex.markDead(enc, err)
+		}
+
+		for _, data := range pending {
+			err = ex.encodeResilient(data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// awaitAcks waits until all of the live destinations have acknowledged all
+// of the datasets sent to them, sending the unacknowledged datasets of the
+// ones failing meanwhile to the others
+func (ex *exchange) awaitAcks() error {
+	for {
+		failed := false
+		for _, enc := range ex.encs {
+			w := ex.windows[enc]
+			if w != nil && ex.dead[enc] == nil && w.wait() != nil {
+				failed = true
+			}
+		}
+
+		if !failed {
+			return nil
+		}
+
+		err := ex.resendUnacked()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ackedEncoder is the encoder of a destination of a resilient exchange, which
+// fails its window once encoding fails, as the peer won't acknowledge
+type ackedEncoder struct {
+	encoder
+	w *ackWindow
+}
+
+func (enc *ackedEncoder) Encode(e interface{}) error {
+	err := enc.encoder.Encode(e)
+	if err != nil {
+		enc.w.fail(err)
+	}
+	return err
+}
+
+// ackingDecoder is the decoder of a source of a resilient exchange, which
+// acknowledges every dataset once it's decoded
+type ackingDecoder struct {
+	decoder
+	enc      encoder // of the acknowledgements to the source
+	received int
+}
+
+func (dec *ackingDecoder) Decode(e interface{}) error {
+	err := dec.decoder.Decode(e)
+	if err == nil && payloadRows(e) >= 0 {
+		dec.received++
+
+		// a failed acknowledgement means that the source has failed, which
+		// the following decodes find out
+		dec.enc.Encode(&req{&ack{dec.received}})
+	}
+	return err
+}
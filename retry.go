@@ -0,0 +1,151 @@
+package ep
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var _ = registerGob(&retry{})
+
+// RetryBatches returns a Runner that runs r once for every dataset of its
+// input, rather than once for all of them, and re-runs it for the same dataset
+// while it fails, up to the number of attempts. The backoff before the second
+// attempt doubles after every failed attempt, as with Retry. The outputs of
+// every dataset are buffered, and emitted once its invocation succeeds, before
+// moving on to the next one, thus the outputs of failed attempts are
+// discarded. Once all of the attempts of a dataset fail, the error of the last
+// one is returned.
+//
+// It fails for runners that contain exchanges, as every invocation would
+// re-run the exchange, while its peers on the other nodes don't. The
+// connection attempts of exchanges are set with Retry instead.
+//
+// NOTE: This changes the granularity of the wrapped runner to a single dataset
+// per invocation, thus it must not depend on receiving all of the input at
+// once, like Sort or Distinct do. Any side effects of the wrapped runner, like
+// writes to external systems, may repeat for the datasets that are retried
+func RetryBatches(r Runner, attempts int, backoff time.Duration) (Runner, error) {
+	if hasExchange(r) {
+		return nil, fmt.Errorf("ep: retry of batches of %T, which contains an exchange", r)
+	}
+	return &retry{Runner: r, Attempts: attempts, Backoff: backoff}, nil
+}
+
+// hasExchange reports whether the runner is an exchange, or is composed of
+// runners that contain one
+func hasExchange(r Runner) bool {
+	var runners []Runner
+	switch r := r.(type) {
+	case *exchange:
+		return true
+	case pipeline:
+		runners = r
+	case project:
+		runners = r
+	case *union:
+		runners = r.Runners
+	case *join:
+		runners = []Runner{r.Left, r.Right}
+	case *mergeJoin:
+		runners = []Runner{r.Left, r.Right}
+	case *tee:
+		runners = []Runner{r.Sink}
+	case *retry:
+		runners = []Runner{r.Runner}
+	case *timeoutRunner:
+		runners = []Runner{r.Runner}
+	case *safe:
+		runners = []Runner{r.Runner}
+	case *mapInpToOut:
+		runners = []Runner{r.Runner}
+	case *alias:
+		runners = []Runner{r.Runner}
+	case *scope:
+		runners = []Runner{r.Runner}
+	case *distRunner:
+		runners = []Runner{r.Runner}
+	}
+
+	for _, r := range runners {
+		if hasExchange(r) {
+			return true
+		}
+	}
+	return false
+}
+
+type retry struct {
+	Runner   Runner
+	Attempts int
+	Backoff  time.Duration
+}
+
+func (r *retry) Returns() []Type { return r.Runner.Returns() }
+func (r *retry) Run(ctx context.Context, inp, out chan Dataset) error {
+	defer drainInput(inp)
+	for data := range inp {
+		res, err := r.attempt(ctx, data)
+		if err != nil {
+			return canceledErr(ctx, err)
+		}
+
+		for _, d := range res {
+			select {
+			case out <- d:
+			case <-ctx.Done():
+				return canceledErr(ctx, ctx.Err())
+			}
+		}
+	}
+	return nil
+}
+
+// attempt runs the wrapped runner for the data, until it succeeds or all of
+// the attempts fail, and returns the outputs of the successful invocation
+func (r *retry) attempt(ctx context.Context, data Dataset) ([]Dataset, error) {
+	var err error
+	backoff := r.Backoff
+	for i := 0; i == 0 || i < r.Attempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(backoff)
+			backoff *= 2
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+		}
+
+		var res []Dataset
+		res, err = r.runOnce(ctx, data)
+		if err == nil {
+			return res, nil
+		} else if ctx.Err() != nil {
+			// the failure is of the cancellation, rather than of the runner
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// runOnce runs the wrapped runner with an input of only the data, and returns
+// all of its outputs
+func (r *retry) runOnce(ctx context.Context, data Dataset) ([]Dataset, error) {
+	inp, out := make(chan Dataset, 1), make(chan Dataset)
+	inp <- data
+	close(inp)
+
+	var err error
+	go func() {
+		defer close(out)
+		err = runSafe(ctx, r.Runner, inp, out)
+	}()
+
+	var res []Dataset
+	for d := range out {
+		res = append(res, d)
+	}
+	return res, err
+}
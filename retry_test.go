@@ -0,0 +1,113 @@
+package ep_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// flaky is a Runner that forwards its input, except that it fails the first
+// Failures invocations that receive the Fail value, after outputting it
+type flaky struct {
+	Fail     string
+	Failures int
+	calls    map[string]int // invocations by the first value of the input
+}
+
+func (*flaky) Returns() []ep.Type { return []ep.Type{str} }
+func (r *flaky) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	for data := range inp {
+		v := data.At(0).(strs)[0]
+		r.calls[v]++
+		out <- data
+		if v == r.Fail && r.calls[v] <= r.Failures {
+			return fmt.Errorf("attempt %d of %s failed", r.calls[v], v)
+		}
+	}
+	return nil
+}
+
+func TestRetryBatches(t *testing.T) {
+	r := &flaky{Fail: "b", Failures: 2, calls: map[string]int{}}
+	retry, err := ep.RetryBatches(r, 3, time.Millisecond)
+	require.NoError(t, err)
+
+	res, err := eptest.Run(retry,
+		ep.NewDataset(strs{"a"}),
+		ep.NewDataset(strs{"b"}),
+		ep.NewDataset(strs{"c"}),
+	)
+	require.NoError(t, err)
+
+	// only the failed dataset was retried, and the outputs of its failed
+	// attempts were discarded
+	require.Equal(t, []string{"[a b c]"}, res.Strings())
+	require.Equal(t, map[string]int{"a": 1, "b": 3, "c": 1}, r.calls)
+}
+
+func TestRetryBatches_exhausted(t *testing.T) {
+	r := &flaky{Fail: "b", Failures: 2, calls: map[string]int{}}
+	out := make(chan ep.Dataset, 3)
+	inp := make(chan ep.Dataset, 3)
+	inp <- ep.NewDataset(strs{"a"})
+	inp <- ep.NewDataset(strs{"b"})
+	inp <- ep.NewDataset(strs{"c"})
+	close(inp)
+
+	retry, err := ep.RetryBatches(r, 2, time.Millisecond)
+	require.NoError(t, err)
+
+	err = retry.Run(context.Background(), inp, out)
+	require.EqualError(t, err, "attempt 2 of b failed")
+	require.Equal(t, map[string]int{"a": 1, "b": 2}, r.calls)
+
+	// the output of the preceding dataset was emitted, and the rest of the
+	// input is drained
+	close(out)
+	var res []string
+	for data := range out {
+		res = append(res, data.Strings()...)
+	}
+	require.Equal(t, []string{"[a]"}, res)
+	require.Equal(t, 0, len(inp))
+}
+
+func TestRetryBatches_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &flaky{Fail: "a", Failures: 1, calls: map[string]int{}}
+	inp := make(chan ep.Dataset, 1)
+	inp <- ep.NewDataset(strs{"a"})
+	close(inp)
+
+	// canceled during the backoff, rather than waiting for it
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	retry, err := ep.RetryBatches(r, 2, time.Hour)
+	require.NoError(t, err)
+
+	err = retry.Run(ctx, inp, make(chan ep.Dataset))
+	require.NoError(t, err)
+	require.True(t, time.Since(start) < time.Minute)
+	require.Equal(t, map[string]int{"a": 1}, r.calls)
+}
+
+// exchanges can't be re-run, as their peers aren't re-run with them
+func TestRetryBatches_exchange(t *testing.T) {
+	r := &flaky{calls: map[string]int{}}
+	for _, runner := range []ep.Runner{
+		ep.Gather(),
+		ep.Pipeline(r, ep.Gather()),
+		ep.Project(ep.PassThrough(), ep.Pipeline(r, ep.Scatter())),
+		ep.Safe(ep.Pipeline(r, ep.Broadcast())),
+	} {
+		_, err := ep.RetryBatches(runner, 3, time.Millisecond)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "contains an exchange")
+	}
+
+	require.Panics(t, func() { ep.Retry(r, 3, time.Millisecond) })
+}
@@ -35,7 +35,7 @@ func (r *rows) Run(ctx context.Context, inp, out chan Dataset) error {
 		r.Out = out // save it for Next()
 	}
 	r.Ctx, r.CancelFunc = context.WithCancel(ctx) // for Close()
-	return r.Runner.Run(r.Ctx, inp, out)
+	return runSafe(r.Ctx, r.Runner, inp, out)
 }
 
 // see driver.Rows
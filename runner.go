@@ -4,7 +4,7 @@ import (
 	"context"
 )
 
-var _ = registerGob(&passthrough{}, &pick{})
+var _ = registerGob(&passthrough{}, &pick{}, &discard{})
 
 // Runner represents objects that can receive a stream of input datasets,
 // manipulate them in some way (filter, mapping, reduction, expansion, etc.) and
@@ -29,7 +29,10 @@ type Runner interface {
 	// from file, etc.), you should receive from the context's Done() channel to
 	// know to break early in case of cancellation or an error to avoid doing
 	// extra work. For most Runners, this is not as critical, because their
-	// input will just close early.
+	// input will just close early. Once canceled, Run should return nil rather
+	// than the error of the context, as the cancellation isn't a failure of the
+	// Runner: the error that caused it, if any, is returned by whoever canceled
+	// it. The expiry of a deadline of the context is still returned as an error
 	Run(ctx context.Context, inp, out chan Dataset) error
 
 	// Returns the constant list of data types that are produced by this Runner.
@@ -81,6 +84,17 @@ type FilterRunner interface {
 	Filter(keep []bool)
 }
 
+// MutatingRunner is an optional interface of Runner, of runners that modify
+// the datasets of their input in place, e.g. with Sort. Project clones the
+// input of such runners, as the same datasets are dispatched to all of its
+// runners
+type MutatingRunner interface {
+	Runner // it's a Runner
+
+	// MutatesInput reports whether the Runner modifies its input
+	MutatesInput() bool
+}
+
 // PassThrough returns a runner that lets all of its input through as-is
 func PassThrough() Runner { return passThroughSingleton }
 
@@ -90,13 +104,41 @@ type passthrough struct{}
 
 func (*passthrough) Args() []Type    { return []Type{Wildcard} }
 func (*passthrough) Returns() []Type { return []Type{Wildcard} }
-func (*passthrough) Run(_ context.Context, inp, out chan Dataset) error {
+func (*passthrough) Run(ctx context.Context, inp, out chan Dataset) error {
+	defer drainInput(inp)
 	for data := range inp {
-		out <- data
+		select {
+		case out <- data:
+		case <-ctx.Done():
+			return canceledErr(ctx, ctx.Err())
+		}
 	}
 	return nil
 }
 
+// Discard returns a runner that drains all of its input, and outputs nothing,
+// e.g. for the sink of a Tee, or for measuring the throughput of the runners
+// before it. Once the context is canceled, it returns, while still draining
+// its input
+func Discard() Runner { return &discard{} }
+
+type discard struct{}
+
+func (*discard) Returns() []Type { return []Type{} }
+func (*discard) Run(ctx context.Context, inp, out chan Dataset) error {
+	defer drainInput(inp)
+	for ctx.Err() == nil {
+		select {
+		case _, ok := <-inp:
+			if !ok {
+				return nil
+			}
+		case <-ctx.Done():
+		}
+	}
+	return canceledErr(ctx, ctx.Err())
+}
+
 // Pick returns a new runner similar to PassThrough except that it picks and
 // returns just the data at the provided indices
 func Pick(indices ...int) Runner { return &pick{indices} }
@@ -128,3 +170,22 @@ func (r *pick) Run(_ context.Context, inp, out chan Dataset) error {
 	}
 	return nil
 }
+
+// canceledErr returns nil instead of the error of a Runner that was canceled,
+// see Runner. Any other error, including the expiry of the deadline of the
+// context, is returned as is
+func canceledErr(ctx context.Context, err error) error {
+	if err == context.Canceled && ctx.Err() == context.Canceled {
+		return nil
+	}
+	return err
+}
+
+// drainInput drains the input of a source, unless it's nil
+func drainInput(inp chan Dataset) {
+	if inp == nil {
+		return
+	}
+	for range inp {
+	}
+}
@@ -1,6 +1,7 @@
 package ep_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/panoplyio/ep"
 	"github.com/panoplyio/ep/eptest"
@@ -27,3 +28,58 @@ func ExampleFilterRunner_Filter() {
 	// Output:
 	// [[] [HELLO WORLD] []] <nil>
 }
+
+func ExampleRunnerFunc() {
+	data := ep.NewDataset(strs([]string{"hello", "world"}))
+	runner := ep.Pipeline(ep.Source(data), ep.RunnerFunc(func(_ context.Context, ds ep.Dataset) (ep.Dataset, error) {
+		return ep.NewDataset(ds.At(0), ds.At(0)), nil
+	}))
+
+	data, err := eptest.Run(runner)
+	fmt.Println(data.Strings(), err)
+
+	// Output:
+	// [[hello world] [hello world]] <nil>
+}
+
+func ExampleFlatMapRunner() {
+	runner := ep.FlatMapRunner(func(_ context.Context, ds ep.Dataset) ([]ep.Dataset, error) {
+		return []ep.Dataset{ds, ds}, nil
+	})
+
+	data := ep.NewDataset(strs([]string{"hello", "world"}))
+	data, err := eptest.Run(runner, data)
+	fmt.Println(data.Strings(), err)
+
+	// Output:
+	// [[hello world hello world]] <nil>
+}
+
+func ExampleSource() {
+	data := ep.NewDataset(strs([]string{"hello", "world"}))
+	runner := ep.Pipeline(ep.Source(data, data), &upper{})
+	data, err := eptest.Run(runner)
+	fmt.Println(data.Strings(), err)
+
+	// Output:
+	// [[HELLO WORLD HELLO WORLD]] <nil>
+}
+
+func ExampleGenerate() {
+	// a scan of the numbers up to 5, in datasets of 2 of them
+	scan := ep.Generate(func(ctx context.Context, emit func(ep.Dataset) error) error {
+		for i := int64(1); i <= 5; i += 2 {
+			err := emit(ep.NewDataset(&ep.Int64s{Values: []int64{i, i + 1}}))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	data, err := eptest.Run(ep.Pipeline(scan, ep.Limit(5)))
+	fmt.Println(data.Strings(), err)
+
+	// Output:
+	// [[1 2 3 4 5]] <nil>
+}
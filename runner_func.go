@@ -0,0 +1,82 @@
+package ep
+
+import (
+	"context"
+	"sync"
+)
+
+// RunnerFunc returns a Runner that applies the function to every dataset of
+// its input, and outputs its results, except for nil ones, for transformations
+// that don't need to implement a Runner of their own. It stops once the
+// function fails, returning its error, or once the context is canceled, and
+// drains the rest of the input. The function is never called concurrently by the
+// same Runner, even when it runs more than once at the same time.
+//
+// NOTE that the function can't be distributed, thus the Runner can only run
+// on the node that constructed it, as with FilterMask
+func RunnerFunc(fn func(ctx context.Context, ds Dataset) (Dataset, error)) Runner {
+	return FlatMapRunner(func(ctx context.Context, ds Dataset) ([]Dataset, error) {
+		res, err := fn(ctx, ds)
+		if err != nil || res == nil {
+			return nil, err
+		}
+		return []Dataset{res}, nil
+	})
+}
+
+// FlatMapRunner returns a Runner similar to RunnerFunc, where the function
+// returns any number of datasets for every dataset of the input, which are
+// output in their order
+func FlatMapRunner(fn func(ctx context.Context, ds Dataset) ([]Dataset, error)) Runner {
+	return &flatMap{fn: fn}
+}
+
+type flatMap struct {
+	l  sync.Mutex // guards the calls of fn
+	fn func(context.Context, Dataset) ([]Dataset, error)
+}
+
+func (*flatMap) Returns() []Type { return []Type{Wildcard} }
+func (r *flatMap) Run(ctx context.Context, inp, out chan Dataset) error {
+	defer func() {
+		// in case of error - drain input
+		for range inp {
+		}
+	}()
+
+	for {
+		var data Dataset
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return canceledErr(ctx, ctx.Err())
+		case data, ok = <-inp:
+			if !ok {
+				return nil
+			}
+		}
+
+		res, err := r.call(ctx, data)
+		if err != nil {
+			return err
+		}
+
+		for _, ds := range res {
+			if ds == nil {
+				continue
+			}
+
+			select {
+			case out <- ds:
+			case <-ctx.Done():
+				return canceledErr(ctx, ctx.Err())
+			}
+		}
+	}
+}
+
+func (r *flatMap) call(ctx context.Context, data Dataset) ([]Dataset, error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return r.fn(ctx, data)
+}
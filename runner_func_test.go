@@ -0,0 +1,118 @@
+package ep_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunnerFunc(t *testing.T) {
+	// nil results aren't output
+	r := ep.RunnerFunc(func(_ context.Context, ds ep.Dataset) (ep.Dataset, error) {
+		if ds.Len() == 1 {
+			return nil, nil
+		}
+		return ds.Slice(1, ds.Len()).(ep.Dataset), nil
+	})
+
+	res, err := eptest.Run(r,
+		ep.NewDataset(strs{"a", "b", "c"}),
+		ep.NewDataset(strs{"d"}),
+		ep.NewDataset(strs{"e", "f"}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[b c f]"}, res.Strings())
+}
+
+func TestRunnerFunc_error(t *testing.T) {
+	calls := 0
+	r := ep.RunnerFunc(func(_ context.Context, ds ep.Dataset) (ep.Dataset, error) {
+		calls++
+		return nil, fmt.Errorf("bad")
+	})
+
+	// the rest of the input is drained
+	inp := make(chan ep.Dataset)
+	go func() {
+		for i := 0; i < 3; i++ {
+			inp <- ep.NewDataset(strs{"a"})
+		}
+		close(inp)
+	}()
+	err := r.Run(context.Background(), inp, make(chan ep.Dataset))
+	require.EqualError(t, err, "bad")
+	require.Equal(t, 1, calls)
+}
+
+func TestRunnerFunc_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := ep.RunnerFunc(func(_ context.Context, ds ep.Dataset) (ep.Dataset, error) {
+		cancel()
+		return ds, nil
+	})
+
+	// the output is never received
+	inp := make(chan ep.Dataset, 1)
+	inp <- ep.NewDataset(strs{"a"})
+	close(inp)
+	err := r.Run(ctx, inp, make(chan ep.Dataset))
+	require.NoError(t, err)
+}
+
+func TestRunnerFunc_notConcurrent(t *testing.T) {
+	var running, overlaps int32
+	r := ep.RunnerFunc(func(_ context.Context, ds ep.Dataset) (ep.Dataset, error) {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		defer atomic.AddInt32(&running, -1)
+		return ds, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			datasets := make([]ep.Dataset, 100)
+			for j := range datasets {
+				datasets[j] = ep.NewDataset(strs{"a"})
+			}
+			res, err := eptest.Run(r, datasets...)
+			require.NoError(t, err)
+			require.Equal(t, 100, res.Len())
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(0), overlaps)
+}
+
+func TestFlatMapRunner(t *testing.T) {
+	// every dataset is split into its rows, skipping nil datasets
+	r := ep.FlatMapRunner(func(_ context.Context, ds ep.Dataset) ([]ep.Dataset, error) {
+		res := []ep.Dataset{nil}
+		for i := 0; i < ds.Len(); i++ {
+			res = append(res, ds.Slice(i, i+1).(ep.Dataset))
+		}
+		return res, nil
+	})
+
+	inp, out := make(chan ep.Dataset, 2), make(chan ep.Dataset, 4)
+	inp <- ep.NewDataset(strs{"a", "b"})
+	inp <- ep.NewDataset(strs{"c"})
+	close(inp)
+	require.NoError(t, r.Run(context.Background(), inp, out))
+	close(out)
+
+	var values []string
+	for data := range out {
+		require.Equal(t, 1, data.Len())
+		values = append(values, data.At(0).Strings()...)
+	}
+	require.Equal(t, []string{"a", "b", "c"}, values)
+}
@@ -0,0 +1,55 @@
+package ep_test
+
+import (
+	"context"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPassThrough(t *testing.T) {
+	data := ep.NewDataset(strs{"a", "b"})
+	res, err := eptest.Run(ep.PassThrough(), data, data)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[a b a b]"}, res.Strings())
+}
+
+func TestPassThrough_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the output is never received, while the input is drained
+	inp := make(chan ep.Dataset, 2)
+	inp <- ep.NewDataset(strs{"a"})
+	inp <- ep.NewDataset(strs{"b"})
+	close(inp)
+	err := ep.PassThrough().Run(ctx, inp, make(chan ep.Dataset))
+	require.NoError(t, err)
+	require.Len(t, inp, 0)
+}
+
+func TestDiscard(t *testing.T) {
+	data := ep.NewDataset(strs{"a", "b"})
+	res, err := eptest.Run(ep.Discard(), data, data)
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Width())
+	require.Equal(t, []ep.Type{}, ep.Discard().Returns())
+
+	// the upstream runners complete, even without input
+	res, err = eptest.Run(ep.Pipeline(&producer{}, ep.Limit(3), ep.Discard()))
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Width())
+}
+
+func TestDiscard_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	inp := make(chan ep.Dataset, 1)
+	inp <- ep.NewDataset(strs{"a"})
+	close(inp)
+	err := ep.Discard().Run(ctx, inp, nil)
+	require.NoError(t, err)
+	require.Len(t, inp, 0)
+}
@@ -0,0 +1,164 @@
+package ep
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var _ = registerGob(&timeoutRunner{})
+
+// TimeoutMode is the window measured by a Runner returned by WithTimeout
+type TimeoutMode int
+
+const (
+	// TimeoutIdle fails once the runner neither receives nor outputs any
+	// dataset, nor completes, for longer than the timeout. The window is reset
+	// on every dataset, thus it bounds the time between them
+	TimeoutIdle TimeoutMode = iota
+
+	// TimeoutTotal fails once the runner doesn't complete within the timeout,
+	// regardless of its progress
+	TimeoutTotal
+)
+
+// WithTimeout returns a Runner that runs r with a context of its own, and fails
+// with a TimeoutError once it makes no progress for longer than d, by the
+// TimeoutMode set with WithTimeoutMode, which is TimeoutIdle by default. The
+// input is forwarded to r, thus the idle window includes the time waiting for
+// the input, while the time waiting for the output to be received doesn't
+// count. A non-positive duration doesn't time out.
+//
+// Once timed out, the context of r is canceled and it's no longer waited for:
+// its output is drained in the background, and the rest of the input is
+// drained, such that a runner that ignores the cancellation doesn't block the
+// others, though it keeps running until it returns
+func WithTimeout(r Runner, d time.Duration) Runner {
+	return &timeoutRunner{Runner: r, Timeout: d}
+}
+
+// WithTimeoutMode sets the TimeoutMode of a Runner returned by WithTimeout
+func WithTimeoutMode(r Runner, mode TimeoutMode) Runner {
+	t, ok := r.(*timeoutRunner)
+	if !ok {
+		panic("ep: WithTimeoutMode expects a WithTimeout")
+	}
+
+	t.Mode = mode
+	return t
+}
+
+// TimeoutError is the error of a Runner returned by WithTimeout, once its
+// runner timed out. It wraps context.DeadlineExceeded, which is found with
+// errors.Is
+type TimeoutError struct {
+	Runner  Runner
+	Timeout time.Duration
+}
+
+// Error returns a message of the runner and the timeout it exceeded
+func (err *TimeoutError) Error() string {
+	return fmt.Sprintf("ep: runner %T timed out after %s", err.Runner, err.Timeout)
+}
+
+// Unwrap returns context.DeadlineExceeded
+func (err *TimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+type timeoutRunner struct {
+	Runner  Runner
+	Timeout time.Duration
+	Mode    TimeoutMode
+}
+
+func (r *timeoutRunner) Returns() []Type { return r.Runner.Returns() }
+func (r *timeoutRunner) Run(ctx context.Context, inp, out chan Dataset) error {
+	defer drainInput(inp)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runInp, runOut := make(chan Dataset), make(chan Dataset)
+	var runErr error
+	go func() {
+		defer close(runOut)
+		runErr = runSafe(ctx, r.Runner, runInp, runOut)
+	}()
+
+	var expired <-chan time.Time
+	var timer *time.Timer
+	if r.Timeout > 0 {
+		timer = time.NewTimer(r.Timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	progress := func() {
+		if timer == nil || r.Mode == TimeoutTotal {
+			return
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(r.Timeout)
+	}
+
+	// abandon the runner, once it timed out or was canceled
+	abandon := func() {
+		cancel()
+		if inp != nil {
+			close(runInp)
+		}
+		go func() {
+			for range runOut {
+			}
+		}()
+	}
+
+	var pending Dataset
+	for runOut != nil {
+		var recv, send chan Dataset
+		if pending == nil {
+			recv = inp
+		} else {
+			send = runInp
+		}
+
+		select {
+		case data, ok := <-recv:
+			if !ok {
+				inp = nil
+				close(runInp)
+				continue
+			}
+			pending = data
+		case send <- pending:
+			pending = nil
+			progress()
+		case data, ok := <-runOut:
+			if !ok {
+				runOut = nil
+				continue
+			}
+			select {
+			case out <- data:
+			case <-ctx.Done():
+				abandon()
+				return canceledErr(ctx, ctx.Err())
+			}
+			progress()
+		case <-expired:
+			abandon()
+			return &TimeoutError{r.Runner, r.Timeout}
+		case <-ctx.Done():
+			abandon()
+			return canceledErr(ctx, ctx.Err())
+		}
+	}
+
+	// the runner might have returned before its input was completed
+	if inp != nil {
+		close(runInp)
+	}
+	return runErr
+}
@@ -0,0 +1,79 @@
+package ep_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// sleeper is a Runner that ignores its input and its context, and returns only
+// once woken up
+type sleeper struct{ wake chan struct{} }
+
+func (*sleeper) Returns() []ep.Type { return []ep.Type{str} }
+func (r *sleeper) Run(_ context.Context, _, _ chan ep.Dataset) error {
+	<-r.wake
+	return nil
+}
+
+// slow is a Runner that forwards its input, after a delay for every dataset
+type slow struct{ delay time.Duration }
+
+func (*slow) Returns() []ep.Type { return []ep.Type{str} }
+func (r *slow) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	for data := range inp {
+		time.Sleep(r.delay)
+		out <- data
+	}
+	return nil
+}
+
+func TestWithTimeout_sleepsForever(t *testing.T) {
+	r := &sleeper{make(chan struct{})}
+	defer close(r.wake)
+
+	start := time.Now()
+	_, err := eptest.Run(ep.WithTimeout(r, 50*time.Millisecond), ep.NewDataset(strs{"a"}), ep.NewDataset(strs{"b"}))
+	require.Error(t, err)
+	require.Equal(t, "ep: runner *ep_test.sleeper timed out after 50ms", err.Error())
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	var timeoutErr *ep.TimeoutError
+	require.True(t, errors.As(err, &timeoutErr))
+	require.Equal(t, r, timeoutErr.Runner)
+	require.True(t, time.Since(start) < 5*time.Second)
+}
+
+// The idle timeout is reset on every dataset, while the total one isn't
+func TestWithTimeout_slow(t *testing.T) {
+	var inp []ep.Dataset
+	for i := 0; i < 10; i++ {
+		inp = append(inp, ep.NewDataset(strs{fmt.Sprint(i)}))
+	}
+
+	r := ep.WithTimeout(&slow{20 * time.Millisecond}, 100*time.Millisecond)
+	res, err := eptest.Run(r, inp...)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[0 1 2 3 4 5 6 7 8 9]"}, res.Strings())
+
+	r = ep.WithTimeoutMode(ep.WithTimeout(&slow{20 * time.Millisecond}, 100*time.Millisecond), ep.TimeoutTotal)
+	_, err = eptest.Run(r, inp...)
+	require.Error(t, err)
+	require.Equal(t, "ep: runner *ep_test.slow timed out after 100ms", err.Error())
+}
+
+func TestWithTimeout_passThrough(t *testing.T) {
+	res, err := eptest.Run(ep.WithTimeout(ep.PassThrough(), 0), ep.NewDataset(strs{"a"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[a]"}, res.Strings())
+
+	_, err = eptest.Run(ep.WithTimeout(NewErrRunner(fmt.Errorf("bad")), time.Second), ep.NewDataset(strs{"a"}))
+	require.EqualError(t, err, "bad")
+
+	require.Panics(t, func() { ep.WithTimeoutMode(ep.PassThrough(), ep.TimeoutTotal) })
+}
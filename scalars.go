@@ -0,0 +1,506 @@
+package ep
+
+import (
+	"cmp"
+	"encoding/json"
+	"hash"
+	"math"
+	"strconv"
+)
+
+// Int64, Float64 and Bool are the built-in Types of columns of int64, float64
+// and bool values, backed by the Int64s, Float64s and Bools Data
+// implementations. Their Data is nullable, and nulls sort after all values
+var (
+	Int64   = &int64Type{}
+	Float64 = &float64Type{}
+	Bool    = &boolType{}
+)
+
+var _ = Types.
+	Register("int64", Int64).
+	Register("float64", Float64).
+	Register("bool", Bool)
+
+type int64Type struct{}
+
+func (t *int64Type) String() string     { return t.Name() }
+func (*int64Type) Name() string         { return "int64" }
+func (*int64Type) Data(n int) Data      { return &Int64s{Values: make([]int64, n)} }
+func (*int64Type) DataEmpty(n int) Data { return &Int64s{Values: make([]int64, 0, n)} }
+
+type float64Type struct{}
+
+func (t *float64Type) String() string     { return t.Name() }
+func (*float64Type) Name() string         { return "float64" }
+func (*float64Type) Data(n int) Data      { return &Float64s{Values: make([]float64, n)} }
+func (*float64Type) DataEmpty(n int) Data { return &Float64s{Values: make([]float64, 0, n)} }
+
+type boolType struct{}
+
+func (t *boolType) String() string     { return t.Name() }
+func (*boolType) Name() string         { return "bool" }
+func (*boolType) Data(n int) Data      { return &Bools{Values: make([]bool, n)} }
+func (*boolType) DataEmpty(n int) Data { return &Bools{Values: make([]bool, 0, n)} }
+
+// Int64s is the Data of the Int64 type
+type Int64s struct {
+	Values []int64
+	Null   NullMask
+}
+
+// Type returns the Int64 type
+func (*Int64s) Type() Type { return Int64 }
+
+// Len returns the number of values
+func (vs *Int64s) Len() int { return len(vs.Values) }
+
+// Less reports whether the i-th value sorts before the j-th one
+func (vs *Int64s) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+
+// Swap swaps the i-th and the j-th values, along with their nulls
+func (vs *Int64s) Swap(i, j int) {
+	vs.Values[i], vs.Values[j] = vs.Values[j], vs.Values[i]
+	vs.Null.Swap(i, j)
+}
+
+// LessOther reports whether the thisRow-th value sorts before the
+// otherRow-th value of the other data
+func (vs *Int64s) LessOther(thisRow int, other Data, otherRow int) bool {
+	return vs.Compare(thisRow, other, otherRow) < 0
+}
+
+// Compare compares the thisRow-th value to the otherRow-th value of the
+// other data numerically, with nulls last, see Comparable
+func (vs *Int64s) Compare(thisRow int, other Data, otherRow int) int {
+	data := other.(*Int64s)
+	if c, ok := compareNulls(vs.IsNull(thisRow), data.IsNull(otherRow)); ok {
+		return c
+	}
+	return cmp.Compare(vs.Values[thisRow], data.Values[otherRow])
+}
+
+// Hash hashes the row-th value, see Hashable
+func (vs *Int64s) Hash(row int, h hash.Hash64) { hashUint64(h, uint64(vs.Values[row])) }
+
+// Slice returns the values from the start to the end indices
+func (vs *Int64s) Slice(s, e int) Data {
+	return &Int64s{vs.Values[s:e], vs.Null.Slice(s, e)}
+}
+
+// Append returns the values followed by the ones of the other data
+func (vs *Int64s) Append(other Data) Data {
+	data := other.(*Int64s)
+	return &Int64s{
+		append(vs.Values[:len(vs.Values):len(vs.Values)], data.Values...),
+		vs.Null.Append(vs.Len(), data.Null),
+	}
+}
+
+// AppendAll returns the values followed by the ones of all of the others,
+// allocated at once, see Concatenator
+func (vs *Int64s) AppendAll(others ...Data) Data {
+	values, nulls := appendAll(vs, others, func(data Data) ([]int64, NullMask) {
+		return data.(*Int64s).Values, data.(*Int64s).Null
+	})
+	return &Int64s{values, nulls}
+}
+
+// Duplicate returns the values repeated t times
+func (vs *Int64s) Duplicate(t int) Data {
+	res := make([]int64, 0, vs.Len()*t)
+	for i := 0; i < t; i++ {
+		res = append(res, vs.Values...)
+	}
+	return &Int64s{res, vs.Null.Duplicate(vs.Len(), t)}
+}
+
+// IsNull reports whether the i-th value is null
+func (vs *Int64s) IsNull(i int) bool { return vs.Null.Get(i) }
+
+// MarkNull marks the i-th value as null
+func (vs *Int64s) MarkNull(i int) { vs.Null.Set(i, true) }
+
+// Nulls reports whether each one of the values is null
+func (vs *Int64s) Nulls() []bool { return vs.Null.Nulls(vs.Len()) }
+
+// Equal reports whether the other data has the same values, as with
+// DataEqual
+func (vs *Int64s) Equal(other Data) bool { return DataEqual(vs, other) }
+
+// Same reports whether the other data shares the values, see Sharer
+func (vs *Int64s) Same(other Data) bool {
+	data, ok := other.(*Int64s)
+	return ok && (vs == data || vs.Len() > 0 && data.Len() > 0 && &vs.Values[0] == &data.Values[0])
+}
+
+// Copy copies the fromRow-th value of the other data to the toRow-th value
+func (vs *Int64s) Copy(from Data, fromRow, toRow int) {
+	src := from.(*Int64s)
+	vs.Values[toRow] = src.Values[fromRow]
+	vs.Null.Copy(src.Null, fromRow, toRow)
+}
+
+// Take returns the values at the indices, in their order, see Taker
+func (vs *Int64s) Take(indices []int) Data {
+	return &Int64s{takeValues(vs.Values, indices), vs.Null.Take(indices)}
+}
+
+// Clone returns a copy of the values, see Cloner
+func (vs *Int64s) Clone() Data {
+	return &Int64s{append([]int64(nil), vs.Values...), vs.Null.Slice(0, vs.Len())}
+}
+
+// Size returns the number of bytes of the values, 8 per value, and of the
+// nulls
+func (vs *Int64s) Size() uint64 { return uint64(vs.Len())*8 + vs.Null.Size() }
+
+// Strings returns the values in base 10, and empty strings for nulls
+func (vs *Int64s) Strings() []string {
+	res := make([]string, vs.Len())
+	for i, v := range vs.Values {
+		if !vs.IsNull(i) {
+			res[i] = strconv.FormatInt(v, 10)
+		}
+	}
+	return res
+}
+
+// AppendStringAt appends the string representation of the row-th value to
+// dst, see StringerAt
+func (vs *Int64s) AppendStringAt(dst []byte, row int) []byte {
+	if vs.IsNull(row) {
+		return dst
+	}
+	return strconv.AppendInt(dst, vs.Values[row], 10)
+}
+
+// MarshalJSONValue returns the JSON encoding of the row-th value, see
+// JSONData
+func (vs *Int64s) MarshalJSONValue(row int) ([]byte, error) {
+	return strconv.AppendInt(nil, vs.Values[row], 10), nil
+}
+
+// UnmarshalJSONValue sets the row-th value to the JSON encoded one, see
+// JSONData
+func (vs *Int64s) UnmarshalJSONValue(row int, b []byte) (err error) {
+	vs.Values[row], err = strconv.ParseInt(string(b), 10, 64)
+	return err
+}
+
+// Float64s is the Data of the Float64 type. NaNs sort before all other values,
+// as in sort.Float64Slice
+type Float64s struct {
+	Values []float64
+	Null   NullMask
+}
+
+// Type returns the Float64 type
+func (*Float64s) Type() Type { return Float64 }
+
+// Len returns the number of values
+func (vs *Float64s) Len() int { return len(vs.Values) }
+
+// Less reports whether the i-th value sorts before the j-th one
+func (vs *Float64s) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+
+// Swap swaps the i-th and the j-th values, along with their nulls
+func (vs *Float64s) Swap(i, j int) {
+	vs.Values[i], vs.Values[j] = vs.Values[j], vs.Values[i]
+	vs.Null.Swap(i, j)
+}
+
+// LessOther reports whether the thisRow-th value sorts before the
+// otherRow-th value of the other data
+func (vs *Float64s) LessOther(thisRow int, other Data, otherRow int) bool {
+	return vs.Compare(thisRow, other, otherRow) < 0
+}
+
+// Compare compares the thisRow-th value to the otherRow-th value of the
+// other data, as with cmp.Compare: NaNs sort first, and nulls last
+func (vs *Float64s) Compare(thisRow int, other Data, otherRow int) int {
+	data := other.(*Float64s)
+	if c, ok := compareNulls(vs.IsNull(thisRow), data.IsNull(otherRow)); ok {
+		return c
+	}
+	return cmp.Compare(vs.Values[thisRow], data.Values[otherRow])
+}
+
+// Hash hashes the values the way they're compared: zeros of both signs are
+// equal, as are all NaNs
+func (vs *Float64s) Hash(row int, h hash.Hash64) {
+	v := vs.Values[row]
+	if v == 0 {
+		v = 0
+	} else if math.IsNaN(v) {
+		v = math.NaN()
+	}
+	hashUint64(h, math.Float64bits(v))
+}
+
+// Slice returns the values from the start to the end indices
+func (vs *Float64s) Slice(s, e int) Data {
+	return &Float64s{vs.Values[s:e], vs.Null.Slice(s, e)}
+}
+
+// Append returns the values followed by the ones of the other data
+func (vs *Float64s) Append(other Data) Data {
+	data := other.(*Float64s)
+	return &Float64s{
+		append(vs.Values[:len(vs.Values):len(vs.Values)], data.Values...),
+		vs.Null.Append(vs.Len(), data.Null),
+	}
+}
+
+// AppendAll returns the values followed by the ones of all of the others,
+// allocated at once, see Concatenator
+func (vs *Float64s) AppendAll(others ...Data) Data {
+	values, nulls := appendAll(vs, others, func(data Data) ([]float64, NullMask) {
+		return data.(*Float64s).Values, data.(*Float64s).Null
+	})
+	return &Float64s{values, nulls}
+}
+
+// Duplicate returns the values repeated t times
+func (vs *Float64s) Duplicate(t int) Data {
+	res := make([]float64, 0, vs.Len()*t)
+	for i := 0; i < t; i++ {
+		res = append(res, vs.Values...)
+	}
+	return &Float64s{res, vs.Null.Duplicate(vs.Len(), t)}
+}
+
+// IsNull reports whether the i-th value is null
+func (vs *Float64s) IsNull(i int) bool { return vs.Null.Get(i) }
+
+// MarkNull marks the i-th value as null
+func (vs *Float64s) MarkNull(i int) { vs.Null.Set(i, true) }
+
+// Nulls reports whether each one of the values is null
+func (vs *Float64s) Nulls() []bool { return vs.Null.Nulls(vs.Len()) }
+
+// Equal reports whether the other data has the same values, as with
+// DataEqual
+func (vs *Float64s) Equal(other Data) bool { return DataEqual(vs, other) }
+
+// Same reports whether the other data shares the values, see Sharer
+func (vs *Float64s) Same(other Data) bool {
+	data, ok := other.(*Float64s)
+	return ok && (vs == data || vs.Len() > 0 && data.Len() > 0 && &vs.Values[0] == &data.Values[0])
+}
+
+// Copy copies the fromRow-th value of the other data to the toRow-th value
+func (vs *Float64s) Copy(from Data, fromRow, toRow int) {
+	src := from.(*Float64s)
+	vs.Values[toRow] = src.Values[fromRow]
+	vs.Null.Copy(src.Null, fromRow, toRow)
+}
+
+// Take returns the values at the indices, in their order, see Taker
+func (vs *Float64s) Take(indices []int) Data {
+	return &Float64s{takeValues(vs.Values, indices), vs.Null.Take(indices)}
+}
+
+// Clone returns a copy of the values, see Cloner
+func (vs *Float64s) Clone() Data {
+	return &Float64s{append([]float64(nil), vs.Values...), vs.Null.Slice(0, vs.Len())}
+}
+
+// Size returns the number of bytes of the values, 8 per value, and of the
+// nulls
+func (vs *Float64s) Size() uint64 { return uint64(vs.Len())*8 + vs.Null.Size() }
+
+// Strings returns the values in the shortest 'g' format that parses back
+// into the same values, and empty strings for nulls
+func (vs *Float64s) Strings() []string {
+	res := make([]string, vs.Len())
+	for i, v := range vs.Values {
+		if !vs.IsNull(i) {
+			res[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	}
+	return res
+}
+
+// AppendStringAt appends the string representation of the row-th value to
+// dst, see StringerAt
+func (vs *Float64s) AppendStringAt(dst []byte, row int) []byte {
+	if vs.IsNull(row) {
+		return dst
+	}
+	return strconv.AppendFloat(dst, vs.Values[row], 'g', -1, 64)
+}
+
+// MarshalJSONValue marshals NaN and infinities, which JSON doesn't have, as
+// the strings "NaN", "+Inf" and "-Inf"
+func (vs *Float64s) MarshalJSONValue(row int) ([]byte, error) {
+	v := vs.Values[row]
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.AppendQuote(nil, strconv.FormatFloat(v, 'g', -1, 64)), nil
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSONValue sets the row-th value to the JSON encoded one, which
+// may also be one of the strings of MarshalJSONValue, see JSONData
+func (vs *Float64s) UnmarshalJSONValue(row int, b []byte) (err error) {
+	b = unquoteJSON(b)
+	vs.Values[row], err = strconv.ParseFloat(string(b), 64)
+	return err
+}
+
+// Bools is the Data of the Bool type. false sorts before true
+type Bools struct {
+	Values []bool
+	Null   NullMask
+}
+
+// Type returns the Bool type
+func (*Bools) Type() Type { return Bool }
+
+// Len returns the number of values
+func (vs *Bools) Len() int { return len(vs.Values) }
+
+// Less reports whether the i-th value sorts before the j-th one
+func (vs *Bools) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+
+// Swap swaps the i-th and the j-th values, along with their nulls
+func (vs *Bools) Swap(i, j int) {
+	vs.Values[i], vs.Values[j] = vs.Values[j], vs.Values[i]
+	vs.Null.Swap(i, j)
+}
+
+// LessOther reports whether the thisRow-th value sorts before the
+// otherRow-th value of the other data
+func (vs *Bools) LessOther(thisRow int, other Data, otherRow int) bool {
+	return vs.Compare(thisRow, other, otherRow) < 0
+}
+
+// Compare compares the thisRow-th value to the otherRow-th value of the
+// other data, where false sorts before true, and nulls last
+func (vs *Bools) Compare(thisRow int, other Data, otherRow int) int {
+	data := other.(*Bools)
+	if c, ok := compareNulls(vs.IsNull(thisRow), data.IsNull(otherRow)); ok {
+		return c
+	}
+	v1, v2 := vs.Values[thisRow], data.Values[otherRow]
+	if v1 == v2 {
+		return 0
+	} else if v2 {
+		return -1
+	}
+	return 1
+}
+
+// Hash hashes the row-th value, see Hashable
+func (vs *Bools) Hash(row int, h hash.Hash64) {
+	if vs.Values[row] {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+}
+
+// Slice returns the values from the start to the end indices
+func (vs *Bools) Slice(s, e int) Data {
+	return &Bools{vs.Values[s:e], vs.Null.Slice(s, e)}
+}
+
+// Append returns the values followed by the ones of the other data
+func (vs *Bools) Append(other Data) Data {
+	data := other.(*Bools)
+	return &Bools{
+		append(vs.Values[:len(vs.Values):len(vs.Values)], data.Values...),
+		vs.Null.Append(vs.Len(), data.Null),
+	}
+}
+
+// AppendAll returns the values followed by the ones of all of the others,
+// allocated at once, see Concatenator
+func (vs *Bools) AppendAll(others ...Data) Data {
+	values, nulls := appendAll(vs, others, func(data Data) ([]bool, NullMask) {
+		return data.(*Bools).Values, data.(*Bools).Null
+	})
+	return &Bools{values, nulls}
+}
+
+// Duplicate returns the values repeated t times
+func (vs *Bools) Duplicate(t int) Data {
+	res := make([]bool, 0, vs.Len()*t)
+	for i := 0; i < t; i++ {
+		res = append(res, vs.Values...)
+	}
+	return &Bools{res, vs.Null.Duplicate(vs.Len(), t)}
+}
+
+// IsNull reports whether the i-th value is null
+func (vs *Bools) IsNull(i int) bool { return vs.Null.Get(i) }
+
+// MarkNull marks the i-th value as null
+func (vs *Bools) MarkNull(i int) { vs.Null.Set(i, true) }
+
+// Nulls reports whether each one of the values is null
+func (vs *Bools) Nulls() []bool { return vs.Null.Nulls(vs.Len()) }
+
+// Equal reports whether the other data has the same values, as with
+// DataEqual
+func (vs *Bools) Equal(other Data) bool { return DataEqual(vs, other) }
+
+// Same reports whether the other data shares the values, see Sharer
+func (vs *Bools) Same(other Data) bool {
+	data, ok := other.(*Bools)
+	return ok && (vs == data || vs.Len() > 0 && data.Len() > 0 && &vs.Values[0] == &data.Values[0])
+}
+
+// Copy copies the fromRow-th value of the other data to the toRow-th value
+func (vs *Bools) Copy(from Data, fromRow, toRow int) {
+	src := from.(*Bools)
+	vs.Values[toRow] = src.Values[fromRow]
+	vs.Null.Copy(src.Null, fromRow, toRow)
+}
+
+// Take returns the values at the indices, in their order, see Taker
+func (vs *Bools) Take(indices []int) Data {
+	return &Bools{takeValues(vs.Values, indices), vs.Null.Take(indices)}
+}
+
+// Clone returns a copy of the values, see Cloner
+func (vs *Bools) Clone() Data {
+	return &Bools{append([]bool(nil), vs.Values...), vs.Null.Slice(0, vs.Len())}
+}
+
+// Size returns the number of bytes of the values, see Sized
+func (vs *Bools) Size() uint64 { return uint64(vs.Len())*1 + vs.Null.Size() }
+
+// Strings returns the values as "true" and "false", and empty strings for
+// nulls
+func (vs *Bools) Strings() []string {
+	res := make([]string, vs.Len())
+	for i, v := range vs.Values {
+		if !vs.IsNull(i) {
+			res[i] = strconv.FormatBool(v)
+		}
+	}
+	return res
+}
+
+// AppendStringAt appends the string representation of the row-th value to
+// dst, see StringerAt
+func (vs *Bools) AppendStringAt(dst []byte, row int) []byte {
+	if vs.IsNull(row) {
+		return dst
+	}
+	return strconv.AppendBool(dst, vs.Values[row])
+}
+
+// MarshalJSONValue returns the JSON encoding of the row-th value, see
+// JSONData
+func (vs *Bools) MarshalJSONValue(row int) ([]byte, error) {
+	return strconv.AppendBool(nil, vs.Values[row]), nil
+}
+
+// UnmarshalJSONValue sets the row-th value to the JSON encoded one, see
+// JSONData
+func (vs *Bools) UnmarshalJSONValue(row int, b []byte) error {
+	return json.Unmarshal(b, &vs.Values[row])
+}
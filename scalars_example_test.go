@@ -0,0 +1,35 @@
+package ep_test
+
+import (
+	"fmt"
+	"github.com/panoplyio/ep"
+	"sort"
+)
+
+func ExampleInt64s() {
+	var ints ep.Data = &ep.Int64s{Values: []int64{3, 1, 4, 1, 5}}
+	ints.MarkNull(2)
+	sort.Sort(ints)
+	ints = ints.Slice(0, 3)
+	fmt.Printf("%q\n", ints.Strings())
+
+	// Output: ["1" "1" "3"]
+}
+
+func ExampleFloat64s() {
+	var floats ep.Data = &ep.Float64s{Values: []float64{2.5, -1, 0.125}}
+	sort.Sort(floats)
+	fmt.Println(floats.Strings())
+
+	// Output: [-1 0.125 2.5]
+}
+
+func ExampleBools() {
+	var bools ep.Data = ep.Bool.Data(3)
+	bools.Copy(&ep.Bools{Values: []bool{true}}, 0, 0)
+	bools.MarkNull(1)
+	sort.Sort(bools)
+	fmt.Printf("%q\n", bools.Strings())
+
+	// Output: ["false" "true" ""]
+}
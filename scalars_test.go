@@ -0,0 +1,176 @@
+package ep_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"math"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newData returns new Data objects of every type, the strs example along with
+// the built-in types, with distinct values in no particular order
+var newData = map[string]func() ep.Data{
+	"strs":     func() ep.Data { return strs{"c", "a", "d", "b", "e"} },
+	"Int64s":   func() ep.Data { return &ep.Int64s{Values: []int64{3, -1, 4, 0, 5}} },
+	"Float64s": func() ep.Data { return &ep.Float64s{Values: []float64{3.5, -1, 4, 0, 0.5}} },
+	"Bools":    func() ep.Data { return &ep.Bools{Values: []bool{true, false, true, false, true}} },
+	"Timestamps": func() ep.Data {
+		return &ep.Timestamps{Values: []time.Time{epoch(3), epoch(-1), epoch(4), epoch(0), epoch(5)}}
+	},
+	"Decimals": func() ep.Data {
+		data, _ := ep.ParseDecimals(38, 9, []string{"3.5", "-1", "12345678901234567890123456789.000000001", "0", "0.000000005"})
+		return data
+	},
+	"Blobs": func() ep.Data {
+		return &ep.Blobs{Values: [][]byte{{0xff, 0xfe}, {}, {0x01, 0x00}, {0x01}, {0xff}}}
+	},
+	"DictStrings": func() ep.Data { return ep.EncodeDict([]string{"c", "a", "d", "b", "e"}) },
+	"SliceData":   func() ep.Data { return int32s.Of(3, -1, 4, 0, 5) },
+	"Dates": func() ep.Data {
+		day := 24 * 60 * 60
+		return &ep.Dates{Values: []time.Time{epoch(3 * day), epoch(-day), epoch(4 * day), epoch(0), epoch(5 * day)}}
+	},
+	"Lists": func() ep.Data {
+		return ep.NewLists(&ep.Int64s{Values: []int64{3, 1, -1, 4, 5, 0}}, 2, 1, 1, 0, 2)
+	},
+	"Structs": func() ep.Data {
+		return ep.NewStructs([]string{"n", "ok"}, &ep.Int64s{Values: []int64{3, 3, 4, 0, 5}}, &ep.Bools{Values: []bool{true, false, true, false, true}})
+	},
+}
+
+// epoch returns the time of the seconds since the unix epoch, in UTC
+func epoch(sec int) time.Time { return time.Unix(int64(sec), 0).UTC() }
+
+func TestData_conformance(t *testing.T) {
+	for name, newData := range newData {
+		t.Run(name, func(t *testing.T) {
+			eptest.VerifyDataInterfaceInvariant(t, newData())
+			eptest.VerifyDataInvariants(t, newData().Type(), newData())
+
+			data := newData()
+			n := data.Len()
+			typ := data.Type()
+			require.Contains(t, ep.Types.All(), typ)
+			require.Equal(t, n, typ.Data(n).Len())
+			require.Equal(t, 0, typ.DataEmpty(n).Len())
+
+			values := data.Strings()
+			require.Equal(t, values[1:3], data.Slice(1, 3).Strings())
+			require.Equal(t, values, data.Slice(0, 2).Append(data.Slice(2, n)).Strings())
+			require.Equal(t, append(values, values...), data.Duplicate(2).Strings())
+
+			// copy the values in reverse
+			reversed := typ.Data(n)
+			for i := 0; i < n; i++ {
+				reversed.Copy(data, n-1-i, i)
+			}
+			for i, v := range reversed.Strings() {
+				require.Equal(t, values[n-1-i], v)
+			}
+
+			clone := ep.Clone(data)
+			require.True(t, ep.Same(data, data))
+			require.False(t, ep.Same(data, clone))
+			require.True(t, data.Equal(clone))
+			require.Equal(t, values, clone.Strings())
+
+			// sorted, and consistent with another data object
+			sort.Sort(data)
+			for i := 1; i < n; i++ {
+				require.False(t, data.Less(i, i-1))
+			}
+			other := ep.Clone(data)
+			for i := 0; i < n; i++ {
+				for j := 0; j < n; j++ {
+					require.Equal(t, data.Less(i, j), data.LessOther(i, other, j))
+					require.Equal(t, data.Less(i, j), ep.Compare(data, i, other, j) < 0)
+					require.Equal(t, data.Less(j, i), ep.Compare(data, i, other, j) > 0)
+				}
+			}
+
+			// gob-encoded, as it's sent by exchanges
+			var buf bytes.Buffer
+			require.NoError(t, gob.NewEncoder(&buf).Encode(&data))
+			var decoded ep.Data
+			require.NoError(t, gob.NewDecoder(&buf).Decode(&decoded))
+			require.Equal(t, typ, decoded.Type())
+			require.Equal(t, data.Strings(), decoded.Strings())
+		})
+	}
+}
+
+func TestData_nulls(t *testing.T) {
+	for name, newData := range newData {
+		if name == "strs" {
+			continue // not nullable
+		}
+
+		t.Run(name, func(t *testing.T) {
+			eptest.VerifyDataNullsHandling(t, newData(), "")
+
+			data := newData()
+			data.MarkNull(0)
+			data.MarkNull(3)
+			require.Equal(t, []bool{true, false, false, true, false}, data.Nulls())
+
+			// nulls sort last
+			sort.Sort(data)
+			require.Equal(t, []bool{false, false, false, true, true}, data.Nulls())
+			require.Equal(t, 0, ep.Compare(data, 3, data, 4))
+			require.Equal(t, 1, ep.Compare(data, 3, data, 0))
+			require.Equal(t, -1, ep.Compare(data, 0, data, 3))
+
+			var buf bytes.Buffer
+			require.NoError(t, gob.NewEncoder(&buf).Encode(&data))
+			var decoded ep.Data
+			require.NoError(t, gob.NewDecoder(&buf).Decode(&decoded))
+			require.Equal(t, data.Nulls(), decoded.Nulls())
+
+			// through an exchange, after being sliced, appended, duplicated
+			// and copied
+			data = data.Slice(2, 5).Append(data.Slice(0, 2)).Duplicate(2)
+			data.Copy(data, 1, 0) // a null, over a value
+			data.Copy(data, 3, 1) // a value, over a null
+			expected := []bool{true, false, true, false, false, false, true, true, false, false}
+			require.Equal(t, expected, data.Nulls())
+
+			cluster := eptest.InMemoryCluster(2)
+			defer func() { require.NoError(t, cluster.Close()) }()
+
+			runner := cluster.Distribute(ep.Pipeline(ep.Broadcast(), ep.Gather()))
+			res, err := eptest.Run(runner, ep.NewDataset(data))
+			require.NoError(t, err)
+			require.Equal(t, append(expected, expected...), res.At(0).Nulls())
+		})
+	}
+}
+
+func TestFloat64s_nan(t *testing.T) {
+	data := &ep.Float64s{Values: []float64{1, math.NaN(), -1}}
+	data.MarkNull(0)
+	sort.Sort(data)
+	require.Equal(t, []string{"NaN", "-1", ""}, data.Strings())
+}
+
+// The built-in types are sent by exchanges without any registration
+func TestInMemoryCluster_builtinTypes(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	ints := &ep.Int64s{Values: []int64{1, 2, 3}}
+	ints.MarkNull(1)
+	floats := &ep.Float64s{Values: []float64{0.5, 1.5, 2.5}}
+	bools := &ep.Bools{Values: []bool{true, false, true}}
+
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.Gather()))
+	data, err := eptest.Run(runner, ep.NewDataset(ints, floats, bools))
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "", "3"}, data.At(0).Strings())
+	require.Equal(t, []string{"0.5", "1.5", "2.5"}, data.At(1).Strings())
+	require.Equal(t, []string{"true", "false", "true"}, data.At(2).Strings())
+}
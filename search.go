@@ -0,0 +1,32 @@
+package ep
+
+import "sort"
+
+// SearchData returns the index of the first row of the data which isn't less
+// than the otherRow-th value of other, by LessOther, in data sorted in
+// ascending order, or the length of the data when all of its rows are less,
+// including when it's empty. As the built-in types sort nulls last, a null
+// value is searched as greater than all of the other values, and is found at
+// the first null row
+func SearchData(data Data, other Data, otherRow int) int {
+	return sort.Search(data.Len(), func(i int) bool {
+		return !data.LessOther(i, other, otherRow)
+	})
+}
+
+// SearchDataset returns the index of the first row of the dataset, sorted by
+// the sorting columns as with SortDataset, which isn't sorted before the
+// keysRow-th row of the keys, or the length of the dataset when all of its
+// rows are. The keys have a column for every sorting column, in their order,
+// compared in its direction and with its nulls in their position, such that a
+// composite key is searched at once
+func SearchDataset(ds Dataset, cols []SortingCol, keys Dataset, keysRow int) int {
+	return sort.Search(ds.Len(), func(i int) bool {
+		for j, col := range cols {
+			if c := col.compare(ds.At(col.Index), i, keys.At(j), keysRow); c != 0 {
+				return c > 0
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,116 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSearchData(t *testing.T) {
+	data := &ep.Int64s{Values: []int64{1, 3, 3, 5, 0, 0}, Null: ep.NullMask{16 | 32}}
+	keys := &ep.Int64s{Values: []int64{0, 1, 3, 4, 5, 6, 0}, Null: ep.NullMask{64}}
+	expected := []int{0, 0, 1, 3, 3, 4, 4}
+	for i, idx := range expected {
+		require.Equal(t, idx, ep.SearchData(data, keys, i), "key %d", i)
+	}
+
+	require.Equal(t, 0, ep.SearchData(ep.Int64.Data(0), keys, 2))
+	require.Equal(t, 2, ep.SearchData(strs{"a", "b", "c"}, strs{"bb"}, 0))
+}
+
+// Random sorted data, with nulls and duplicates, agrees with a linear scan
+func TestSearchData_random(t *testing.T) {
+	rnd := rand.New(rand.NewSource(84))
+	for iter := 0; iter < 100; iter++ {
+		data := randomInts(rnd, rnd.Intn(50))
+		sort.Sort(data)
+		keys := randomInts(rnd, 20)
+		for i := 0; i < keys.Len(); i++ {
+			expected := 0
+			for expected < data.Len() && data.LessOther(expected, keys, i) {
+				expected++
+			}
+			require.Equal(t, expected, ep.SearchData(data, keys, i), "%v in %v", keys.Strings()[i], data.Strings())
+		}
+	}
+}
+
+func TestSearchDataset(t *testing.T) {
+	names := strs{"c", "c", "b", "b", "b", "a"}
+	nums := &ep.Int64s{Values: []int64{0, 0, 0, 2, 5, 9}, Null: ep.NullMask{1 | 4}}
+	ds := ep.NewDataset(nums, names)
+	cols := []ep.SortingCol{{Index: 1, Desc: true}, {Index: 0, Nulls: ep.NullsFirst}}
+
+	keys := ep.NewDataset(strs{"d", "c", "c", "b", "b", "b", "a"}, &ep.Int64s{Values: []int64{0, 0, 0, 0, 2, 3, 10}, Null: ep.NullMask{4}})
+	expected := []int{0, 1, 0, 3, 3, 4, 6}
+	for i, idx := range expected {
+		require.Equal(t, idx, ep.SearchDataset(ds, cols, keys, i), "key %d", i)
+	}
+	require.Equal(t, 0, ep.SearchDataset(ep.NewDataset(strs{}, ep.Int64.Data(0)), cols, keys, 0))
+}
+
+// Random datasets sorted by two columns, in every direction and null order,
+// agree with a linear scan
+func TestSearchDataset_random(t *testing.T) {
+	rnd := rand.New(rand.NewSource(84))
+	orders := []ep.NullOrder{ep.NullsDefault, ep.NullsFirst, ep.NullsLast}
+	for iter := 0; iter < 100; iter++ {
+		n := rnd.Intn(50)
+		ds := ep.NewDataset(randomInts(rnd, n), randomInts(rnd, n))
+		cols := []ep.SortingCol{
+			{Index: 1, Desc: rnd.Intn(2) == 0, Nulls: orders[rnd.Intn(3)]},
+			{Index: 0, Desc: rnd.Intn(2) == 0, Nulls: orders[rnd.Intn(3)]},
+		}
+		ds, err := ep.SortDataset(ds, cols)
+		require.NoError(t, err)
+
+		keys := ep.NewDataset(randomInts(rnd, 20), randomInts(rnd, 20))
+		for i := 0; i < keys.Len(); i++ {
+			expected := 0
+			for expected < ds.Len() && sortedBefore(cols, ds, expected, keys, i) {
+				expected++
+			}
+			require.Equal(t, expected, ep.SearchDataset(ds, cols, keys, i), "row %d of %v in %v by %v", i, keys.Strings(), ds.Strings(), cols)
+		}
+	}
+}
+
+// sortedBefore reports whether the i-th row of the dataset is sorted before the
+// j-th row of the keys, comparing the nulls and the values of every sorting
+// column separately
+func sortedBefore(cols []ep.SortingCol, ds ep.Dataset, i int, keys ep.Dataset, j int) bool {
+	for k, col := range cols {
+		a, b := ds.At(col.Index), keys.At(k)
+		null1, null2 := a.IsNull(i), b.IsNull(j)
+		if null1 && null2 {
+			continue
+		} else if null1 || null2 {
+			nullsFirst := col.Nulls == ep.NullsFirst || (col.Nulls == ep.NullsDefault && col.Desc)
+			return null1 == nullsFirst
+		}
+
+		c := ep.Compare(a, i, b, j)
+		if col.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+// randomInts returns n random values of up to 10 distinct values, about a
+// fifth of them nulls
+func randomInts(rnd *rand.Rand, n int) *ep.Int64s {
+	res := &ep.Int64s{Values: make([]int64, n)}
+	for i := range res.Values {
+		res.Values[i] = int64(rnd.Intn(10))
+		if rnd.Intn(5) == 0 {
+			res.MarkNull(i)
+		}
+	}
+	return res
+}
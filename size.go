@@ -0,0 +1,59 @@
+package ep
+
+import (
+	"math/big"
+	"time"
+	"unsafe"
+)
+
+// Sized is an optional interface of Data, reporting the approximate number of
+// bytes its values take in memory, for memory-bound operators like batching by
+// bytes. It's used by DataSize and DatasetSize, and implemented by all of the
+// built-in types
+type Sized interface {
+	Data
+
+	// Size returns the number of bytes of the values, including their nulls
+	Size() uint64
+}
+
+// unsizedRowSize is the estimated number of bytes of every value of Data that
+// isn't Sized
+const unsizedRowSize = 16
+
+// DataSize returns the approximate number of bytes of the data: its Size when
+// it's Sized, the sum of the sizes of its columns when it's a Dataset, or an
+// estimate of 16 bytes per value otherwise
+func DataSize(data Data) uint64 {
+	switch d := data.(type) {
+	case Sized:
+		return d.Size()
+	case Dataset:
+		return DatasetSize(d)
+	}
+
+	if data.Len() < 0 {
+		return 0 // variadic
+	}
+	return uint64(data.Len()) * unsizedRowSize
+}
+
+// DatasetSize returns the approximate number of bytes of all of the columns
+// of the dataset, as with DataSize
+func DatasetSize(ds Dataset) uint64 {
+	var res uint64
+	for i := 0; i < ds.Width(); i++ {
+		res += DataSize(ds.At(i))
+	}
+	return res
+}
+
+// the sizes of the values of the built-in types, or of their headers, for
+// values of variable lengths
+const (
+	sliceHeaderSize  = uint64(unsafe.Sizeof([]byte(nil)))
+	stringHeaderSize = uint64(unsafe.Sizeof(""))
+	timeSize         = uint64(unsafe.Sizeof(time.Time{}))
+	bigIntSize       = uint64(unsafe.Sizeof(big.Int{}))
+	bigWordSize      = uint64(unsafe.Sizeof(big.Word(0)))
+)
@@ -0,0 +1,83 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestDataSize(t *testing.T) {
+	// bytes per value, at least and at most
+	bounds := map[string][2]uint64{
+		"strs":        {16, 16}, // not Sized
+		"Int64s":      {8, 8},
+		"Float64s":    {8, 8},
+		"Bools":       {1, 1},
+		"Timestamps":  {16, 32},
+		"Dates":       {16, 32},
+		"Decimals":    {24, 64},
+		"Blobs":       {24, 32},
+		"DictStrings": {4, 32},
+		"SliceData":   {4, 4},
+		"Lists":       {16, 32},
+		"Structs":     {9, 16},
+	}
+
+	for name, newFn := range newData {
+		t.Run(name, func(t *testing.T) {
+			data := newFn()
+			_, sized := data.(ep.Sized)
+			require.Equal(t, name != "strs", sized)
+
+			size := ep.DataSize(data)
+			n := uint64(data.Len())
+			require.True(t, size >= n*bounds[name][0], "%d bytes", size)
+			require.True(t, size <= n*bounds[name][1], "%d bytes", size)
+
+			// grows with the number of values
+			require.True(t, ep.DataSize(data.Duplicate(3)) > size)
+			if name != "DictStrings" { // slices share the whole dictionary
+				require.Equal(t, uint64(0), ep.DataSize(data.Slice(0, 0)))
+			}
+
+			if name != "strs" {
+				data.MarkNull(0)
+				require.True(t, ep.DataSize(data) > size, "nulls aren't counted")
+			}
+		})
+	}
+}
+
+func TestDataSize_contents(t *testing.T) {
+	long := strings.Repeat("x", 1000)
+
+	size := ep.DataSize(&ep.Blobs{Values: [][]byte{[]byte(long), nil}})
+	require.True(t, size > 1000 && size < 1100, "%d bytes", size)
+
+	size = ep.DataSize(ep.EncodeDict([]string{long, long, long}))
+	require.True(t, size > 1000 && size < 1100, "%d bytes", size) // once
+
+	size = ep.DataSize(ep.NewSliceType[string]("test_string").Of(long, "a"))
+	require.True(t, size > 1001 && size < 1100, "%d bytes", size)
+
+	big, err := ep.ParseDecimals(38, 0, []string{strings.Repeat("9", 38)})
+	require.NoError(t, err)
+	small, err := ep.ParseDecimals(38, 0, []string{"9"})
+	require.NoError(t, err)
+	require.True(t, ep.DataSize(big) > ep.DataSize(small))
+
+	require.Equal(t, uint64(0), ep.DataSize(ep.Null.Data(100)))
+	require.Equal(t, uint64(0), ep.DataSize(ep.Null.Data(-1)))
+}
+
+func TestDatasetSize(t *testing.T) {
+	ints := &ep.Int64s{Values: []int64{1, 2, 3}}
+	data := ep.NewDataset(ints, strs{"a", "b", "c"}, ep.Null.Data(3))
+	require.Equal(t, uint64(3*8+3*16), ep.DatasetSize(data))
+
+	// nested datasets are summed as well
+	require.Equal(t, uint64(2*3*8+3*16), ep.DatasetSize(ep.NewDataset(ints, data)))
+	require.Equal(t, ep.DatasetSize(data), ep.DataSize(data))
+	require.Equal(t, uint64(0), ep.DatasetSize(ep.NewDataset()))
+}
@@ -0,0 +1,173 @@
+package ep
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"reflect"
+	"unsafe"
+)
+
+// SliceData is the Data of a SliceType
+type SliceData[T cmp.Ordered] struct {
+	TypeName string // of its SliceType
+	Values   []T
+	Null     NullMask
+}
+
+// Type returns its SliceType
+func (vs *SliceData[T]) Type() Type { return &SliceType[T]{vs.TypeName} }
+
+// Len returns the number of values
+func (vs *SliceData[T]) Len() int { return len(vs.Values) }
+
+// Less reports whether the i-th value sorts before the j-th one
+func (vs *SliceData[T]) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+
+// Swap swaps the i-th and the j-th values, along with their nulls
+func (vs *SliceData[T]) Swap(i, j int) {
+	vs.Values[i], vs.Values[j] = vs.Values[j], vs.Values[i]
+	vs.Null.Swap(i, j)
+}
+
+// LessOther reports whether the thisRow-th value sorts before the
+// otherRow-th value of the other data
+func (vs *SliceData[T]) LessOther(thisRow int, other Data, otherRow int) bool {
+	return vs.Compare(thisRow, other, otherRow) < 0
+}
+
+// Compare compares the thisRow-th value to the otherRow-th value of the
+// other data, see Comparable
+func (vs *SliceData[T]) Compare(thisRow int, other Data, otherRow int) int {
+	data := other.(*SliceData[T])
+	if c, ok := compareNulls(vs.IsNull(thisRow), data.IsNull(otherRow)); ok {
+		return c
+	}
+	return cmp.Compare(vs.Values[thisRow], data.Values[otherRow])
+}
+
+// Hash hashes the values by their Strings, except for zeros which all have the
+// same hash, even for floats of both signs
+func (vs *SliceData[T]) Hash(row int, h hash.Hash64) {
+	var zero T
+	if v := vs.Values[row]; v != zero {
+		hashString(h, fmt.Sprint(v))
+	} else {
+		hashString(h, fmt.Sprint(zero))
+	}
+}
+
+// Slice returns the values from the start to the end indices
+func (vs *SliceData[T]) Slice(s, e int) Data {
+	return &SliceData[T]{vs.TypeName, vs.Values[s:e], vs.Null.Slice(s, e)}
+}
+
+// Append returns the values followed by the ones of the other data
+func (vs *SliceData[T]) Append(other Data) Data {
+	data := other.(*SliceData[T])
+	return &SliceData[T]{
+		vs.TypeName,
+		append(vs.Values[:len(vs.Values):len(vs.Values)], data.Values...),
+		vs.Null.Append(vs.Len(), data.Null),
+	}
+}
+
+// AppendAll returns the values followed by the ones of all of the others,
+// allocated at once, see Concatenator
+func (vs *SliceData[T]) AppendAll(others ...Data) Data {
+	values, nulls := appendAll(vs, others, func(data Data) ([]T, NullMask) {
+		return data.(*SliceData[T]).Values, data.(*SliceData[T]).Null
+	})
+	return &SliceData[T]{vs.TypeName, values, nulls}
+}
+
+// Duplicate returns the values repeated t times
+func (vs *SliceData[T]) Duplicate(t int) Data {
+	res := make([]T, 0, vs.Len()*t)
+	for i := 0; i < t; i++ {
+		res = append(res, vs.Values...)
+	}
+	return &SliceData[T]{vs.TypeName, res, vs.Null.Duplicate(vs.Len(), t)}
+}
+
+// IsNull reports whether the i-th value is null
+func (vs *SliceData[T]) IsNull(i int) bool { return vs.Null.Get(i) }
+
+// MarkNull marks the i-th value as null
+func (vs *SliceData[T]) MarkNull(i int) { vs.Null.Set(i, true) }
+
+// Nulls reports whether each one of the values is null
+func (vs *SliceData[T]) Nulls() []bool { return vs.Null.Nulls(vs.Len()) }
+
+// Equal reports whether the other data has the same values, as with
+// DataEqual
+func (vs *SliceData[T]) Equal(other Data) bool { return DataEqual(vs, other) }
+
+// Same reports whether the other data shares the values, see Sharer
+func (vs *SliceData[T]) Same(other Data) bool {
+	data, ok := other.(*SliceData[T])
+	return ok && (vs == data || vs.Len() > 0 && data.Len() > 0 && &vs.Values[0] == &data.Values[0])
+}
+
+// Copy copies the fromRow-th value of the other data to the toRow-th value
+func (vs *SliceData[T]) Copy(from Data, fromRow, toRow int) {
+	src := from.(*SliceData[T])
+	vs.Values[toRow] = src.Values[fromRow]
+	vs.Null.Copy(src.Null, fromRow, toRow)
+}
+
+// Take returns the values at the indices, in their order, see Taker
+func (vs *SliceData[T]) Take(indices []int) Data {
+	return &SliceData[T]{vs.TypeName, takeValues(vs.Values, indices), vs.Null.Take(indices)}
+}
+
+// Clone returns a copy of the values, see Cloner
+func (vs *SliceData[T]) Clone() Data {
+	return &SliceData[T]{vs.TypeName, append([]T(nil), vs.Values...), vs.Null.Slice(0, vs.Len())}
+}
+
+// Size includes the contents of strings
+func (vs *SliceData[T]) Size() uint64 {
+	var zero T
+	res := uint64(vs.Len())*uint64(unsafe.Sizeof(zero)) + vs.Null.Size()
+	if reflect.TypeOf(zero).Kind() == reflect.String {
+		for _, v := range vs.Values {
+			res += uint64(reflect.ValueOf(v).Len())
+		}
+	}
+	return res
+}
+
+// Strings returns the string representations of the values, which are
+// empty for nulls
+func (vs *SliceData[T]) Strings() []string {
+	res := make([]string, vs.Len())
+	for i, v := range vs.Values {
+		if !vs.IsNull(i) {
+			res[i] = fmt.Sprint(v)
+		}
+	}
+	return res
+}
+
+// AppendStringAt appends the string representation of the row-th value to
+// dst, see StringerAt
+func (vs *SliceData[T]) AppendStringAt(dst []byte, row int) []byte {
+	if vs.IsNull(row) {
+		return dst
+	}
+	return fmt.Append(dst, vs.Values[row])
+}
+
+// MarshalJSONValue returns the JSON encoding of the row-th value, see
+// JSONData
+func (vs *SliceData[T]) MarshalJSONValue(row int) ([]byte, error) {
+	return json.Marshal(vs.Values[row])
+}
+
+// UnmarshalJSONValue sets the row-th value to the JSON encoded one, see
+// JSONData
+func (vs *SliceData[T]) UnmarshalJSONValue(row int, b []byte) error {
+	return json.Unmarshal(b, &vs.Values[row])
+}
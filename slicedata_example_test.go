@@ -0,0 +1,17 @@
+package ep_test
+
+import (
+	"fmt"
+	"github.com/panoplyio/ep"
+	"sort"
+)
+
+var uints = ep.NewSliceType[uint16]("uint16")
+
+func ExampleNewSliceType() {
+	var data ep.Data = uints.Of(3, 1, 2)
+	sort.Sort(data)
+	fmt.Println(data.Type(), data.Strings())
+
+	// Output: uint16 [1 2 3]
+}
@@ -0,0 +1,45 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+)
+
+type celsius float32
+
+var (
+	int32s  = ep.NewSliceType[int32]("int32")
+	degrees = ep.NewSliceType[celsius]("celsius")
+)
+
+func TestNewSliceType(t *testing.T) {
+	require.Equal(t, []ep.Type{int32s}, ep.Types.Get("int32"))
+	require.Equal(t, "celsius", degrees.Name())
+
+	data := degrees.Of(21.5, -3, 40)
+	data.MarkNull(1)
+	require.Equal(t, "celsius", data.Type().Name())
+	require.True(t, ep.AreEqualTypes([]ep.Type{degrees}, []ep.Type{data.Type()}))
+
+	sort.Sort(data)
+	require.Equal(t, []string{"21.5", "40", ""}, data.Strings())
+}
+
+// The instantiations are sent by exchanges, as they're registered at init
+func TestInMemoryCluster_sliceData(t *testing.T) {
+	cluster := eptest.InMemoryCluster(2)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	ints := int32s.Of(1, 2, 3)
+	ints.MarkNull(2)
+
+	runner := cluster.Distribute(ep.Pipeline(ep.Broadcast(), ep.Gather()))
+	res, err := eptest.Run(runner, ep.NewDataset(ints, degrees.Of(1.5, 2.5, 3.5)))
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2", "", "1", "2", ""}, res.At(0).Strings())
+	require.Equal(t, []string{"1.5", "2.5", "3.5", "1.5", "2.5", "3.5"}, res.At(1).Strings())
+	require.Equal(t, "celsius", res.At(1).Type().Name())
+}
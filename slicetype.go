@@ -0,0 +1,46 @@
+package ep
+
+import "cmp"
+
+// NewSliceType returns a new Type of columns of any ordered Go type, backed by
+// SliceData, and registers it in Types under the name, which also registers it
+// with gob. It saves implementing Data for every scalar type:
+//
+//	var Int32 = ep.NewSliceType[int32]("int32")
+//
+//	data := Int32.Of(3, 1, 2)
+//
+// Like other Types, it should be created at init on all of the nodes, for the
+// exchanges to send it. Its values are ordered as with cmp.Less, nulls sort
+// after all values, and their Strings are formatted with fmt.Sprint
+func NewSliceType[T cmp.Ordered](name string) *SliceType[T] {
+	t := &SliceType[T]{TypeName: name}
+	Types.Register(name, t)
+	return t
+}
+
+// SliceType is a Type returned by NewSliceType
+type SliceType[T cmp.Ordered] struct {
+	TypeName string
+}
+
+// String returns the name of the type
+func (t *SliceType[T]) String() string { return t.Name() }
+
+// Name returns the name the type was registered with
+func (t *SliceType[T]) Name() string { return t.TypeName }
+
+// Data returns a SliceData of n zero values
+func (t *SliceType[T]) Data(n int) Data {
+	return &SliceData[T]{TypeName: t.TypeName, Values: make([]T, n)}
+}
+
+// DataEmpty returns an empty SliceData, with a capacity of n values
+func (t *SliceType[T]) DataEmpty(n int) Data {
+	return &SliceData[T]{TypeName: t.TypeName, Values: make([]T, 0, n)}
+}
+
+// Of returns the Data of the values
+func (t *SliceType[T]) Of(values ...T) *SliceData[T] {
+	return &SliceData[T]{TypeName: t.TypeName, Values: values}
+}
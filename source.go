@@ -0,0 +1,69 @@
+package ep
+
+import "context"
+
+var _ = registerGob(&source{})
+
+// Source returns a Runner that outputs the datasets, in their order, and
+// returns, for starting a pipeline from in-memory data. The datasets are
+// distributed along with the Runner, thus all of its nodes output all of them.
+//
+// Like all of the sources, of runners that ignore their input, it still
+// drains its input, when it isn't nil, such that the runners before it
+// complete
+func Source(datasets ...Dataset) Runner {
+	return &source{datasets}
+}
+
+// Generate returns a Runner of a source of the datasets emitted by the
+// function, e.g. of a table scan, which returns once all of them were emitted.
+// Emitting waits until the dataset is received by the next runner, or until
+// the context is canceled, returning its error, which the function is expected
+// to return. That error is ignored, as the cancellation of other Runners is,
+// see Runner. As with Source, the input is drained once the function returns.
+//
+// NOTE that the function can't be distributed, thus the Runner can only run
+// on the node that constructed it, as with FilterMask
+func Generate(fn func(ctx context.Context, emit func(Dataset) error) error) Runner {
+	return &generate{fn}
+}
+
+type source struct{ Datasets []Dataset }
+
+// Returns the types of the first dataset, or no types without datasets
+func (r *source) Returns() []Type {
+	if len(r.Datasets) == 0 {
+		return []Type{}
+	}
+	return datasetTypes(r.Datasets[0])
+}
+
+func (r *source) Run(ctx context.Context, inp, out chan Dataset) error {
+	defer drainInput(inp)
+	for _, data := range r.Datasets {
+		select {
+		case out <- data:
+		case <-ctx.Done():
+			return canceledErr(ctx, ctx.Err())
+		}
+	}
+	return nil
+}
+
+type generate struct {
+	fn func(context.Context, func(Dataset) error) error
+}
+
+func (*generate) Returns() []Type { return []Type{Wildcard} }
+func (r *generate) Run(ctx context.Context, inp, out chan Dataset) error {
+	defer drainInput(inp)
+	err := r.fn(ctx, func(data Dataset) error {
+		select {
+		case out <- data:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	return canceledErr(ctx, err)
+}
@@ -0,0 +1,80 @@
+package ep_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	r := ep.Source(ep.NewDataset(ints(1, 2), strs{"a", "b"}), ep.NewDataset(ints(3), strs{"c"}))
+	require.Equal(t, []ep.Type{ep.Int64, str}, r.Returns())
+
+	// the input is ignored, but drained
+	res, err := eptest.Run(r, ep.NewDataset(strs{"x"}), ep.NewDataset(strs{"y"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[1 2 3]", "[a b c]"}, res.Strings())
+
+	// without input
+	out := make(chan ep.Dataset, 2)
+	require.NoError(t, r.Run(context.Background(), nil, out))
+	require.Len(t, out, 2)
+
+	require.Equal(t, []ep.Type{}, ep.Source().Returns())
+}
+
+func TestSource_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the output is never received
+	err := ep.Source(ep.NewDataset(strs{"a"})).Run(ctx, nil, make(chan ep.Dataset))
+	require.NoError(t, err)
+}
+
+func TestSource_distributed(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	// every node outputs all of the datasets
+	runner := cluster.Distribute(ep.Pipeline(ep.Source(ep.NewDataset(ints(1, 2))), ep.Gather()))
+	res, err := eptest.Run(runner)
+	require.NoError(t, err)
+	require.Equal(t, 6, res.Len())
+}
+
+func TestGenerate(t *testing.T) {
+	i := int64(0)
+	r := ep.Generate(func(ctx context.Context, emit func(ep.Dataset) error) error {
+		for ; ; i++ {
+			if err := emit(ep.NewDataset(ints(i))); err != nil {
+				return err
+			}
+		}
+	})
+
+	// emitting stops once the limit returns, which cancels it, as every emit
+	// waits for the dataset to be received or for the cancellation. The
+	// pipeline drains the rest of the input of the limit in the meantime, thus
+	// the number of the datasets emitted isn't deterministic
+	res, err := eptest.Run(ep.Pipeline(r, ep.Limit(3)), ep.NewDataset(strs{"x"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"[0 1 2]"}, res.Strings())
+	require.True(t, i >= 3, "%d datasets emitted", i)
+}
+
+func TestGenerate_error(t *testing.T) {
+	r := ep.Generate(func(ctx context.Context, emit func(ep.Dataset) error) error {
+		if err := emit(ep.NewDataset(ints(1))); err != nil {
+			return err
+		}
+		return fmt.Errorf("scan failed")
+	})
+
+	res, err := eptest.Run(r)
+	require.EqualError(t, err, "scan failed")
+	require.Equal(t, []string{"[1]"}, res.Strings())
+}
@@ -0,0 +1,260 @@
+package ep
+
+import (
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// spillDir is the directory of the spill files, defaults to the os temporary
+// directory
+var spillDir = ""
+
+// Spill sets an exchange Runner, returned by Scatter, Gather, Partition, etc.,
+// to buffer the received datasets when its consumer is slower than its peers,
+// instead of blocking them. Up to rows rows are buffered in memory, beyond
+// which the datasets are spilled to a temporary file on disk, and read back in
+// order once the consumer catches up. The files are removed when the exchange
+// completes or fails
+func Spill(r Runner, rows int) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: Spill expects an exchange")
+	}
+
+	ex.SpillRows = rows
+	return ex
+}
+
+// receiveSpilling is similar to receiveAll, except that receiving from the
+// peers doesn't wait for out to be read, as the received datasets are queued
+// in a spillQueue
+func (ex *exchange) receiveSpilling(done chan struct{}, outLock *sync.Mutex, out chan Dataset) error {
+	defer ex.spill.remove()
+
+	// forward the queued datasets to out in the background, until all of the
+	// received datasets were forwarded, or done is closed
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		for {
+			data, err := ex.spill.pop(done)
+			if err != nil {
+				// failing to read back a spilled dataset is returned from the
+				// following push, or from the wait for forwarding below
+				return
+			}
+			ex.output(done, outLock, out, data)
+		}
+	}()
+
+	for {
+		data, err := ex.receive()
+		if err == io.EOF {
+			ex.spill.closeInput()
+			<-forwarded
+			return ex.spill.getErr()
+		} else if err != nil {
+			return err
+		}
+
+		err = ex.spill.push(data)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// spillQueue is an unbounded FIFO queue of datasets, buffered in memory up to a
+// limit of rows. Beyond it the datasets are appended to a spill file, from
+// which they're read in order after all of the datasets in memory. Pushing
+// moves back to memory once the spill file is drained
+type spillQueue struct {
+	limit  int
+	notify chan struct{} // notified upon push, closing the input and removal
+
+	l       sync.Mutex
+	mem     []Dataset    // the datasets in memory, before the spilled ones
+	memRows int          // number of rows in memory
+	w       *os.File     // the spill file, when spilling
+	r       *os.File     // the spill file, opened for reading
+	enc     *gob.Encoder // of the spill file
+	dec     *gob.Decoder // of the spill file
+	spilled int          // number of datasets spilled but not read yet
+	spills  int          // total number of datasets spilled
+	closed  bool         // no more datasets are pushed
+	removed bool         // the queue was removed, and all pushes are discarded
+	err     error        // the first error of reading or writing a spill file
+}
+
+func newSpillQueue(limit int) *spillQueue {
+	return &spillQueue{limit: limit, notify: make(chan struct{}, 1)}
+}
+
+// push appends a dataset to the queue, spilling it to disk when the datasets in
+// memory exceed the limit, or when there are previously spilled datasets
+func (q *spillQueue) push(data Dataset) (err error) {
+	q.l.Lock()
+	defer q.l.Unlock()
+	defer q.wake()
+
+	if q.removed || q.err != nil {
+		return q.err
+	}
+
+	if q.spilled == 0 && q.memRows+data.Len() <= q.limit {
+		q.mem = append(q.mem, data)
+		q.memRows += data.Len()
+		return nil
+	}
+
+	if q.w == nil {
+		err = q.create()
+		if err != nil {
+			q.err = err
+			return err
+		}
+	}
+
+	err = q.enc.Encode(&req{data})
+	if err != nil {
+		q.err = err
+		return err
+	}
+
+	q.spilled++
+	q.spills++
+	return nil
+}
+
+// pop removes the first dataset from the queue, waiting for it when the queue
+// is empty. Returns io.EOF when the input was closed and all of its datasets
+// were popped, or when done was closed
+func (q *spillQueue) pop(done chan struct{}) (Dataset, error) {
+	for {
+		data, ok, err := q.tryPop()
+		if ok {
+			return data, err
+		}
+
+		select {
+		case <-q.notify:
+		case <-done:
+			q.remove()
+			return nil, io.EOF
+		}
+	}
+}
+
+func (q *spillQueue) tryPop() (Dataset, bool, error) {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	switch {
+	case q.err != nil:
+		return nil, true, q.err
+	case q.removed:
+		return nil, true, io.EOF
+	case len(q.mem) > 0:
+		data := q.mem[0]
+		q.mem = q.mem[1:]
+		q.memRows -= data.Len()
+		return data, true, nil
+	case q.spilled > 0:
+		req := &req{}
+		err := q.dec.Decode(req)
+		if err != nil {
+			q.err = err
+			return nil, true, err
+		}
+
+		q.spilled--
+		if q.spilled == 0 {
+			// drained, move back to memory
+			q.err = q.close()
+		}
+		return req.Payload.(Dataset), true, q.err
+	case q.closed:
+		return nil, true, io.EOF
+	}
+	return nil, false, nil
+}
+
+// closeInput marks the input of the queue as closed, such that it's drained
+// and then popping returns io.EOF
+func (q *spillQueue) closeInput() {
+	q.l.Lock()
+	defer q.l.Unlock()
+	q.closed = true
+	q.wake()
+}
+
+// remove discards all of the queued datasets, along with the spill file. It's
+// safe to call it more than once
+func (q *spillQueue) remove() {
+	q.l.Lock()
+	defer q.l.Unlock()
+	if q.removed {
+		return
+	}
+
+	q.removed = true
+	q.mem, q.memRows, q.spilled = nil, 0, 0
+	err := q.close()
+	if q.err == nil {
+		q.err = err
+	}
+	q.wake()
+}
+
+func (q *spillQueue) getErr() error {
+	q.l.Lock()
+	defer q.l.Unlock()
+	return q.err
+}
+
+func (q *spillQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default: // already notified
+	}
+}
+
+// create creates the spill file, opened for both writing and reading
+func (q *spillQueue) create() (err error) {
+	q.w, err = ioutil.TempFile(spillDir, "ep-spill-")
+	if err != nil {
+		return err
+	}
+
+	q.r, err = os.Open(q.w.Name())
+	if err != nil {
+		q.close()
+		return err
+	}
+
+	q.enc, q.dec = gob.NewEncoder(q.w), gob.NewDecoder(q.r)
+	return nil
+}
+
+// close closes and removes the spill file, if any
+func (q *spillQueue) close() error {
+	if q.w == nil {
+		return nil
+	}
+
+	err := q.w.Close()
+	if q.r != nil {
+		q.r.Close()
+	}
+
+	rmErr := os.Remove(q.w.Name())
+	if err == nil {
+		err = rmErr
+	}
+
+	q.w, q.r, q.enc, q.dec = nil, nil, nil, nil
+	return err
+}
@@ -0,0 +1,195 @@
+package ep
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// PeerStats are the statistics of the data transferred by an exchange between
+// this node and one of its peers (or itself)
+type PeerStats struct {
+	RowsSent        int64
+	RowsReceived    int64
+	BatchesSent     int64 // number of datasets sent
+	BatchesReceived int64 // number of datasets received
+	BytesSent       int64 // over the network, after compression
+	BytesReceived   int64 // over the network, before decompression
+	SizeSent        int64 // in memory, by the DatasetSize of the datasets sent
+	SizeReceived    int64 // in memory, by the DatasetSize of the datasets received
+
+	EncodeTime time.Duration // spent blocked on encoding to the peer
+	DecodeTime time.Duration // spent blocked on decoding from the peer
+
+	Queued int64 // datasets decoded from the peer, waiting for the consumer
+}
+
+// Stats returns the statistics of an exchange Runner, returned by Scatter,
+// Gather, Partition, etc., by peer address. The statistics are updated while
+// the exchange runs, and are final once Run returns. They only cover the
+// exchange on this node, every other node has its own statistics
+func Stats(r Runner) map[string]PeerStats {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: Stats expects an exchange")
+	}
+
+	ex.statsL.Lock()
+	defer ex.statsL.Unlock()
+	res := make(map[string]PeerStats, len(ex.stats))
+	for addr, st := range ex.stats {
+		res[addr] = st.snapshot()
+	}
+	return res
+}
+
+// peerStats are the PeerStats of a single peer, updated atomically
+type peerStats struct {
+	rowsSent, rowsReceived       int64
+	batchesSent, batchesReceived int64
+	bytesSent, bytesReceived     int64
+	sizeSent, sizeReceived       int64
+	encodeTime, decodeTime       int64 // nanoseconds
+	queued                       int64
+
+	progress *progressReporter // notified of every batch, when reporting
+}
+
+func (st *peerStats) snapshot() PeerStats {
+	return PeerStats{
+		RowsSent:        atomic.LoadInt64(&st.rowsSent),
+		RowsReceived:    atomic.LoadInt64(&st.rowsReceived),
+		BatchesSent:     atomic.LoadInt64(&st.batchesSent),
+		BatchesReceived: atomic.LoadInt64(&st.batchesReceived),
+		BytesSent:       atomic.LoadInt64(&st.bytesSent),
+		BytesReceived:   atomic.LoadInt64(&st.bytesReceived),
+		SizeSent:        atomic.LoadInt64(&st.sizeSent),
+		SizeReceived:    atomic.LoadInt64(&st.sizeReceived),
+		EncodeTime:      time.Duration(atomic.LoadInt64(&st.encodeTime)),
+		DecodeTime:      time.Duration(atomic.LoadInt64(&st.decodeTime)),
+		Queued:          atomic.LoadInt64(&st.queued),
+	}
+}
+
+// statsOf returns the statistics updated by a decoder, or nil when it doesn't
+// update any
+func statsOf(dec decoder) *peerStats {
+	if sd, ok := dec.(*statsDecoder); ok {
+		return sd.st
+	}
+	return nil
+}
+
+// enqueue counts a dataset that's queued for receiving, unless it's an error
+func (st *peerStats) enqueue(err error) {
+	if st != nil && err == nil {
+		atomic.AddInt64(&st.queued, 1)
+	}
+}
+
+// dequeue counts a dataset that left the queue, as counted by enqueue
+func (st *peerStats) dequeue(err error) {
+	if st != nil && err == nil {
+		atomic.AddInt64(&st.queued, -1)
+	}
+}
+
+// peerStats returns the statistics of a peer, creating them if needed
+func (ex *exchange) peerStats(addr string) *peerStats {
+	ex.statsL.Lock()
+	defer ex.statsL.Unlock()
+	if ex.stats == nil {
+		ex.stats = map[string]*peerStats{}
+	}
+
+	st := ex.stats[addr]
+	if st == nil {
+		st = &peerStats{progress: ex.reporter}
+		ex.stats[addr] = st
+	}
+	return st
+}
+
+// payloadRows returns the number of rows of a dataset request, or -1 for
+// control requests
+func payloadRows(e interface{}) int {
+	if data := payloadData(e); data != nil {
+		return data.Len()
+	}
+	return -1
+}
+
+// payloadData returns the dataset of a dataset request, or nil for control
+// requests
+func payloadData(e interface{}) Dataset {
+	switch payload := e.(*req).Payload.(type) {
+	case Dataset:
+		return payload
+	case *seqBatch:
+		return payload.Data
+	default:
+		return nil
+	}
+}
+
+// statsEncoder is an encoder that updates the statistics of its peer
+type statsEncoder struct {
+	encoder
+	st *peerStats
+}
+
+func (enc *statsEncoder) Encode(e interface{}) error {
+	start := time.Now()
+	err := enc.encoder.Encode(e)
+	atomic.AddInt64(&enc.st.encodeTime, int64(time.Since(start)))
+
+	if data := payloadData(e); err == nil && data != nil {
+		atomic.AddInt64(&enc.st.rowsSent, int64(data.Len()))
+		atomic.AddInt64(&enc.st.sizeSent, int64(DatasetSize(data)))
+		atomic.AddInt64(&enc.st.batchesSent, 1)
+		enc.st.progress.batch()
+	}
+	return err
+}
+
+// statsDecoder is a decoder that updates the statistics of its peer
+type statsDecoder struct {
+	decoder
+	st *peerStats
+}
+
+func (dec *statsDecoder) Decode(e interface{}) error {
+	start := time.Now()
+	err := dec.decoder.Decode(e)
+	atomic.AddInt64(&dec.st.decodeTime, int64(time.Since(start)))
+
+	if err == nil {
+		if data := payloadData(e); data != nil {
+			atomic.AddInt64(&dec.st.rowsReceived, int64(data.Len()))
+			atomic.AddInt64(&dec.st.sizeReceived, int64(DatasetSize(data)))
+			atomic.AddInt64(&dec.st.batchesReceived, 1)
+			dec.st.progress.batch()
+		}
+	}
+	return err
+}
+
+// statsConn is a connection that counts the bytes transferred to its peer
+type statsConn struct {
+	net.Conn
+	st *peerStats
+}
+
+func (c *statsConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.st.bytesReceived, int64(n))
+	return n, err
+}
+
+func (c *statsConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.st.bytesSent, int64(n))
+	return n, err
+}
+
+func (c *statsConn) CloseWrite() error { return closeWrite(c.Conn) }
@@ -0,0 +1,34 @@
+package ep
+
+// StringerAt is an optional interface of Data, rendering its values one at a
+// time, where Strings renders all of them at once, which doubles the memory of
+// large columns when only a few of their values are needed, or when they're
+// written out one by one. It's used by AppendStringAt and StringAt, and by
+// the Strings of datasets and CSVWrite. All of the built-in types implement
+// it
+type StringerAt interface {
+	Data
+
+	// AppendStringAt appends the row-th of the Strings of the data to the
+	// buffer, and returns it. Nulls append nothing
+	AppendStringAt(dst []byte, row int) []byte
+}
+
+// AppendStringAt appends the row-th of the Strings of the data to the buffer,
+// and returns it, using its AppendStringAt when it's a StringerAt, or the
+// Strings of the single row otherwise
+func AppendStringAt(dst []byte, data Data, row int) []byte {
+	if data, ok := data.(StringerAt); ok {
+		return data.AppendStringAt(dst, row)
+	}
+	return append(dst, data.Slice(row, row+1).Strings()[0]...)
+}
+
+// StringAt returns the row-th of the Strings of the data, as with
+// AppendStringAt
+func StringAt(data Data, row int) string {
+	if _, ok := data.(StringerAt); !ok {
+		return data.Slice(row, row+1).Strings()[0]
+	}
+	return string(AppendStringAt(nil, data, row))
+}
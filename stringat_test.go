@@ -0,0 +1,49 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAppendStringAt(t *testing.T) {
+	for name, newFn := range newData {
+		t.Run(name, func(t *testing.T) {
+			data := newFn()
+			_, ok := data.(ep.StringerAt)
+			require.Equal(t, name != "strs", ok)
+
+			if name != "strs" {
+				data.MarkNull(1)
+			}
+
+			buf := []byte("prefix")
+			for i, s := range data.Strings() {
+				require.Equal(t, s, ep.StringAt(data, i))
+				require.Equal(t, "prefix"+s, string(ep.AppendStringAt(buf, data, i)))
+			}
+		})
+	}
+}
+
+func TestAppendStringAt_decimals(t *testing.T) {
+	values := []string{"0.000000001", "-0.500000000", "-12.345000000", "0.000000000", "123456789.000000000"}
+	data, err := ep.ParseDecimals(18, 9, values)
+	require.NoError(t, err)
+	require.Equal(t, values, data.Strings())
+	for i, v := range values {
+		require.Equal(t, v, ep.StringAt(data, i))
+	}
+
+	data, err = ep.ParseDecimals(5, 0, []string{"-3", "0"})
+	require.NoError(t, err)
+	require.Equal(t, "-3", ep.StringAt(data, 0))
+	require.Equal(t, "0", ep.StringAt(data, 1))
+
+	require.Equal(t, "", ep.StringAt(ep.Null.Data(2), 1))
+}
+
+func TestDataset_Strings(t *testing.T) {
+	data := ep.NewDataset(&ep.Int64s{Values: []int64{1, 2}, Null: ep.NullMask{1}}, strs{"a", "b"})
+	require.Equal(t, []string{"[ 2]", "[a b]"}, data.Strings())
+}
@@ -0,0 +1,376 @@
+package ep
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+var _ = Types.
+	Register("struct", Struct([]string{"value"}, []Type{Null})).
+	RegisterFactory("struct", structFactory)
+
+// Struct returns the Type of columns of records of the named fields of the
+// types, like the latitude and longitude of locations, backed by Structs. The
+// struct types are registered together in Types, under "struct", and they're
+// equal to one another only when their fields are. It panics
+// when there are no fields, or their names repeat
+func Struct(names []string, types []Type) Type {
+	if len(names) != len(types) {
+		panic(fmt.Sprintf("ep: struct of %d names and %d types", len(names), len(types)))
+	}
+	if err := checkStructNames(names); err != nil {
+		panic("ep: " + err.Error())
+	}
+	return &structType{names, types}
+}
+
+func checkStructNames(names []string) error {
+	if len(names) == 0 {
+		return errors.New("struct without fields")
+	}
+
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			return fmt.Errorf("duplicate struct field %q", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// structFactory returns the Struct of the arguments, the names of the fields,
+// each followed by its type
+func structFactory(args ...interface{}) (Type, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, fmt.Errorf("expected field names and types, got %d arguments", len(args))
+	}
+
+	names := make([]string, len(args)/2)
+	types := make([]Type, len(args)/2)
+	for i := range names {
+		var ok1, ok2 bool
+		names[i], ok1 = args[2*i].(string)
+		types[i], ok2 = args[2*i+1].(Type)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("expected a field name and type, got %v and %v", args[2*i], args[2*i+1])
+		}
+	}
+
+	if err := checkStructNames(names); err != nil {
+		return nil, err
+	}
+	return Struct(names, types), nil
+}
+
+type structType struct {
+	Names []string
+	Types []Type
+}
+
+func (t *structType) String() string { return t.Name() }
+
+// Args are the names of the fields, each followed by its type
+func (t *structType) Args() []interface{} {
+	res := make([]interface{}, 0, 2*len(t.Names))
+	for i, name := range t.Names {
+		res = append(res, name, t.Types[i])
+	}
+	return res
+}
+func (t *structType) Name() string {
+	fields := make([]string, len(t.Names))
+	for i, name := range t.Names {
+		fields[i] = name + ":" + t.Types[i].Name()
+	}
+	return "struct(" + strings.Join(fields, ",") + ")"
+}
+func (t *structType) Data(n int) Data {
+	fields := make([]Data, len(t.Types))
+	for i, typ := range t.Types {
+		fields[i] = typ.Data(n)
+	}
+	return &Structs{Names: t.Names, Fields: fields}
+}
+func (t *structType) DataEmpty(n int) Data {
+	fields := make([]Data, len(t.Types))
+	for i, typ := range t.Types {
+		fields[i] = typ.DataEmpty(n)
+	}
+	return &Structs{Names: t.Names, Fields: fields}
+}
+
+// NewStructs returns the Structs of the fields, by their names. The fields
+// must be of the same length
+func NewStructs(names []string, fields ...Data) *Structs {
+	if len(names) != len(fields) {
+		panic(fmt.Sprintf("ep: struct of %d names and %d fields", len(names), len(fields)))
+	} else if err := checkStructNames(names); err != nil {
+		panic("ep: " + err.Error())
+	}
+	for i, field := range fields {
+		if field.Len() != fields[0].Len() {
+			panic(fmt.Sprintf("ep: field %q has %d rows, expected %d", names[i], field.Len(), fields[0].Len()))
+		}
+	}
+	return &Structs{Names: names, Fields: fields}
+}
+
+// Structs is the Data of the Struct types: the Data of every one of its
+// fields, by their Names, all of the same length. Nulls are whole structs,
+// independent of the nulls of their fields. Structs are compared field by
+// field, in their order, as with Compare. Null structs sort after all structs,
+// and their Strings are empty, while other structs are rendered as
+// "{lat:1.2 lon:3.4}"
+type Structs struct {
+	Names  []string
+	Fields []Data
+	Null   NullMask
+}
+
+// Field returns the Data of the named field, or nil when there's no such
+// field, for projecting the fields of structs into columns of their own
+func (vs *Structs) Field(name string) Data {
+	for i, n := range vs.Names {
+		if n == name {
+			return vs.Fields[i]
+		}
+	}
+	return nil
+}
+
+// Type returns its Struct type, of the names and types of its fields
+func (vs *Structs) Type() Type {
+	types := make([]Type, len(vs.Fields))
+	for i, field := range vs.Fields {
+		types[i] = field.Type()
+	}
+	return &structType{vs.Names, types}
+}
+
+// Len returns the number of values
+func (vs *Structs) Len() int { return vs.Fields[0].Len() }
+
+// Less reports whether the i-th value sorts before the j-th one
+func (vs *Structs) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+
+// Swap swaps the i-th and the j-th values, along with their nulls
+func (vs *Structs) Swap(i, j int) {
+	for _, field := range vs.Fields {
+		field.Swap(i, j)
+	}
+	vs.Null.Swap(i, j)
+}
+
+// LessOther reports whether the thisRow-th value sorts before the
+// otherRow-th value of the other data
+func (vs *Structs) LessOther(thisRow int, other Data, otherRow int) bool {
+	return vs.Compare(thisRow, other, otherRow) < 0
+}
+
+// Compare compares the thisRow-th value to the otherRow-th value of the
+// other data, see Comparable
+func (vs *Structs) Compare(thisRow int, other Data, otherRow int) int {
+	data := other.(*Structs)
+	if c, ok := compareNulls(vs.IsNull(thisRow), data.IsNull(otherRow)); ok {
+		return c
+	}
+
+	for i, field := range vs.Fields {
+		if c := Compare(field, thisRow, data.Fields[i], otherRow); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Hash hashes the fields of the struct, in their order
+func (vs *Structs) Hash(row int, h hash.Hash64) {
+	for _, field := range vs.Fields {
+		writeValue(h, field, row, nil)
+	}
+}
+
+// Slice returns the values from the start to the end indices
+func (vs *Structs) Slice(s, e int) Data {
+	return vs.each(func(i int, field Data) Data { return field.Slice(s, e) }, vs.Null.Slice(s, e))
+}
+
+// Append returns the values followed by the ones of the other data
+func (vs *Structs) Append(other Data) Data {
+	data := other.(*Structs)
+	return vs.each(func(i int, field Data) Data { return field.Append(data.Fields[i]) }, vs.Null.Append(vs.Len(), data.Null))
+}
+
+// AppendAll returns the values followed by the ones of all of the others,
+// allocated at once, see Concatenator
+func (vs *Structs) AppendAll(others ...Data) Data {
+	nulls := vs.Null.Slice(0, vs.Len())
+	n := vs.Len()
+	for _, other := range others {
+		nulls.setAll(n, other.(*Structs).Null)
+		n += other.Len()
+	}
+
+	return vs.each(func(i int, field Data) Data {
+		chunks := []Data{field}
+		for _, other := range others {
+			chunks = append(chunks, other.(*Structs).Fields[i])
+		}
+		return Concat(chunks...)
+	}, nulls)
+}
+
+// Duplicate returns the values repeated t times
+func (vs *Structs) Duplicate(t int) Data {
+	return vs.each(func(i int, field Data) Data { return field.Duplicate(t) }, vs.Null.Duplicate(vs.Len(), t))
+}
+
+// IsNull reports whether the i-th value is null
+func (vs *Structs) IsNull(i int) bool { return vs.Null.Get(i) }
+
+// MarkNull marks the i-th value as null
+func (vs *Structs) MarkNull(i int) { vs.Null.Set(i, true) }
+
+// Nulls reports whether each one of the values is null
+func (vs *Structs) Nulls() []bool { return vs.Null.Nulls(vs.Len()) }
+
+// Equal reports whether the other data has the same values, as with
+// DataEqual
+func (vs *Structs) Equal(other Data) bool { return DataEqual(vs, other) }
+
+// Same reports whether the other data shares the values, see Sharer
+func (vs *Structs) Same(other Data) bool {
+	data, ok := other.(*Structs)
+	if !ok || len(vs.Fields) != len(data.Fields) {
+		return false
+	}
+	for i, field := range vs.Fields {
+		if !Same(field, data.Fields[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Copy copies the fields of the struct, even when it's null
+func (vs *Structs) Copy(from Data, fromRow, toRow int) {
+	src := from.(*Structs)
+	for i, field := range vs.Fields {
+		field.Copy(src.Fields[i], fromRow, toRow)
+	}
+	vs.Null.Copy(src.Null, fromRow, toRow)
+}
+
+// Take returns the values at the indices, in their order, see Taker
+func (vs *Structs) Take(indices []int) Data {
+	return vs.each(func(i int, field Data) Data { return take(field, indices) }, vs.Null.Take(indices))
+}
+
+// Clone returns a copy of the values, see Cloner
+func (vs *Structs) Clone() Data {
+	return vs.each(func(i int, field Data) Data { return Clone(field) }, vs.Null.Slice(0, vs.Len()))
+}
+
+// Size returns the number of bytes of the values, see Sized
+func (vs *Structs) Size() uint64 {
+	res := vs.Null.Size()
+	for _, field := range vs.Fields {
+		res += DataSize(field)
+	}
+	return res
+}
+
+// Strings returns the string representations of the values, which are
+// empty for nulls
+func (vs *Structs) Strings() []string {
+	res := make([]string, vs.Len())
+	var buf []byte
+	for i := range res {
+		if !vs.IsNull(i) {
+			buf = vs.AppendStringAt(buf[:0], i)
+			res[i] = string(buf)
+		}
+	}
+	return res
+}
+
+// AppendStringAt appends the string representation of the row-th value to
+// dst, see StringerAt
+func (vs *Structs) AppendStringAt(dst []byte, row int) []byte {
+	if vs.IsNull(row) {
+		return dst
+	}
+
+	dst = append(dst, '{')
+	for i, field := range vs.Fields {
+		if i > 0 {
+			dst = append(dst, ' ')
+		}
+		dst = append(append(dst, vs.Names[i]...), ':')
+		dst = AppendStringAt(dst, field, row)
+	}
+	return append(dst, '}')
+}
+
+// MarshalJSONValue marshals the struct as a JSON object of its fields, by
+// their names, as in MarshalDatasetJSON
+func (vs *Structs) MarshalJSONValue(row int) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range vs.Fields {
+		values, err := marshalJSONValues(field.Slice(row, row+1))
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %s", vs.Names[i], err)
+		}
+
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(vs.Names[i])
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(values[0])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSONValue sets the fields of the struct to the values of the JSON
+// object, by their names. Missing fields are nulls, and unknown ones are
+// ignored
+func (vs *Structs) UnmarshalJSONValue(row int, b []byte) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return err
+	}
+
+	for i, field := range vs.Fields {
+		v, ok := obj[vs.Names[i]]
+		if !ok {
+			field.MarkNull(row)
+			continue
+		}
+
+		value, err := unmarshalJSONValues([]json.RawMessage{v}, field.Type())
+		if err != nil {
+			return fmt.Errorf("field %q: %s", vs.Names[i], err)
+		}
+		field.Copy(value, 0, row)
+	}
+	return nil
+}
+
+// each returns the Structs of the results of the function of every field, and
+// of the nulls
+func (vs *Structs) each(fn func(i int, field Data) Data, nulls NullMask) *Structs {
+	fields := make([]Data, len(vs.Fields))
+	for i, field := range vs.Fields {
+		fields[i] = fn(i, field)
+	}
+	return &Structs{vs.Names, fields, nulls}
+}
@@ -0,0 +1,128 @@
+package ep_test
+
+import (
+	"encoding/json"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+)
+
+var _ = ep.Types.Register("struct", ep.Struct([]string{"n", "ok"}, []ep.Type{ep.Int64, ep.Bool}))
+
+var location = ep.Struct([]string{"lat", "lon"}, []ep.Type{ep.Float64, ep.Float64})
+
+func TestStruct(t *testing.T) {
+	require.Equal(t, "struct(lat:float64,lon:float64)", location.Name())
+	require.Equal(t, location, ep.NewStructs([]string{"lat", "lon"}, &ep.Float64s{}, &ep.Float64s{}).Type())
+	require.True(t, ep.AreEqualTypes([]ep.Type{location}, []ep.Type{ep.Struct([]string{"lat", "lon"}, []ep.Type{ep.Float64, ep.Float64})}))
+	require.False(t, ep.AreEqualTypes([]ep.Type{location}, []ep.Type{ep.Struct([]string{"lon", "lat"}, []ep.Type{ep.Float64, ep.Float64})}))
+
+	require.Panics(t, func() { ep.Struct(nil, nil) })
+	require.Panics(t, func() { ep.Struct([]string{"a"}, nil) })
+	require.Panics(t, func() { ep.Struct([]string{"a", "a"}, []ep.Type{ep.Int64, ep.Int64}) })
+	require.Panics(t, func() { ep.NewStructs([]string{"a", "b"}, &ep.Int64s{Values: []int64{1}}, &ep.Int64s{}) })
+}
+
+func TestStructs(t *testing.T) {
+	lat := &ep.Float64s{Values: []float64{1.2, 0, 5, 1.2}, Null: ep.NullMask{4}}
+	lon := &ep.Float64s{Values: []float64{3.4, 0, -1, 0.5}}
+	data := ep.NewStructs([]string{"lat", "lon"}, lat, lon)
+	data.MarkNull(1)
+
+	// the nulls of structs are independent of the nulls of their fields
+	require.Equal(t, []string{"{lat:1.2 lon:3.4}", "", "{lat: lon:-1}", "{lat:1.2 lon:0.5}"}, data.Strings())
+	require.Equal(t, []bool{false, true, false, false}, data.Nulls())
+	require.Equal(t, []bool{false, false, true, false}, data.Field("lat").Nulls())
+	require.Nil(t, data.Field("alt"))
+
+	// by the first field, then the second, and null structs last
+	sort.Sort(data)
+	require.Equal(t, []string{"{lat:1.2 lon:0.5}", "{lat:1.2 lon:3.4}", "{lat: lon:-1}", ""}, data.Strings())
+	require.Equal(t, []string{"1.2", "1.2", "", "0"}, data.Field("lat").Strings())
+
+	// fields are projected, as other columns
+	sliced := data.Slice(1, 3).(*ep.Structs)
+	require.Equal(t, []string{"3.4", "-1"}, sliced.Field("lon").Strings())
+	appended := sliced.Append(data.Slice(0, 1)).(*ep.Structs)
+	require.Equal(t, []string{"{lat:1.2 lon:3.4}", "{lat: lon:-1}", "{lat:1.2 lon:0.5}"}, appended.Strings())
+
+	data.Copy(data, 3, 0)
+	data.Copy(appended, 2, 3)
+	require.Equal(t, []string{"", "{lat:1.2 lon:3.4}", "{lat: lon:-1}", "{lat:1.2 lon:0.5}"}, data.Strings())
+	taken, err := ep.Take(data, []int{2, 0})
+	require.NoError(t, err)
+	require.Equal(t, []string{"{lat: lon:-1}", ""}, taken.Strings())
+}
+
+func TestStructs_cutAndClone(t *testing.T) {
+	data := ep.NewStructs([]string{"a", "b"}, ep.EncodeDict([]string{"x", "y", "z"}), ep.NewLists(&ep.Int64s{Values: []int64{1, 2}}, 0, 2, 0))
+	data.MarkNull(2)
+
+	clone := ep.Clone(data)
+	require.Equal(t, data.Type(), clone.Type())
+	require.Equal(t, data.Strings(), clone.Strings())
+	require.Equal(t, data.Nulls(), clone.Nulls())
+	require.True(t, ep.Same(data, data))
+	require.False(t, ep.Same(data, clone))
+	require.True(t, data.Equal(clone))
+
+	// the clone is independent of the data
+	clone.Swap(0, 1)
+	require.Equal(t, []string{"{a:x b:[]}", "{a:y b:[1 2]}", ""}, data.Strings())
+	require.Equal(t, []string{"{a:y b:[1 2]}", "{a:x b:[]}", ""}, clone.Strings())
+
+	cut := ep.Cut(data, 1).(ep.Dataset)
+	require.Equal(t, 2, cut.Width())
+	require.Equal(t, []string{"{a:x b:[]}"}, cut.At(0).Strings())
+	require.Equal(t, []string{"{a:y b:[1 2]}", ""}, cut.At(1).Strings())
+	require.Equal(t, []string{"z"}, cut.At(1).(*ep.Structs).Field("a").Slice(1, 2).Strings())
+}
+
+// Clones own the values of all of the fields, as with Lists
+func TestStructs_cloneNested(t *testing.T) {
+	data := ep.NewStructs([]string{"b", "s"}, &ep.Blobs{Values: [][]byte{[]byte("ab"), []byte("cd")}}, ep.EncodeDict([]string{"x", "y"}))
+	clone := ep.Clone(data).(*ep.Structs)
+	clone.Field("b").(*ep.Blobs).Values[0][0] = 'x'
+	clone.Field("s").Copy(ep.EncodeDict([]string{"z"}), 0, 1)
+	clone.MarkNull(0)
+	require.Equal(t, []string{"{b:6162 s:x}", "{b:6364 s:y}"}, data.Strings())
+	require.Equal(t, []string{"x", "y"}, data.Field("s").(*ep.DictStrings).Dict.Values)
+	require.Equal(t, []string{"", "{b:6364 s:z}"}, clone.Strings())
+	require.Equal(t, []string{"7862", "6364"}, clone.Field("b").Strings())
+}
+
+func TestStructs_json(t *testing.T) {
+	data := ep.NewStructs([]string{"lat", "lon"}, &ep.Float64s{Values: []float64{1.2, 0, 5}, Null: ep.NullMask{4}}, &ep.Float64s{Values: []float64{3.4, 0, -1}})
+	data.MarkNull(1)
+
+	b, err := json.Marshal(ep.NewDataset(data))
+	require.NoError(t, err)
+	require.Equal(t, `[[{"lat":1.2,"lon":3.4}],[null],[{"lat":null,"lon":-1}]]`, string(b))
+
+	// missing fields are nulls, and unknown ones are ignored
+	res, err := ep.UnmarshalDatasetJSON([]byte(`[[{"lat":1.2,"lon":3.4}],[null],[{"lon":-1,"alt":7}]]`), []ep.Type{location}, ep.JSONOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"{lat:1.2 lon:3.4}", "", "{lat: lon:-1}"}, res.At(0).Strings())
+
+	_, err = ep.UnmarshalDatasetJSON([]byte(`[[{"lat":"a"}]]`), []ep.Type{location}, ep.JSONOptions{})
+	require.Error(t, err)
+	require.Equal(t, `ep: column 0: row 0: field "lat": row 0: strconv.ParseFloat: parsing "a": invalid syntax`, err.Error())
+}
+
+// Structs of all of the field types are sent by exchanges
+func TestInMemoryCluster_structs(t *testing.T) {
+	cluster := eptest.InMemoryCluster(2)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	data := ep.NewStructs([]string{"key", "values"}, ep.EncodeDict([]string{"a", "b"}), ep.NewLists(&ep.Bools{Values: []bool{true}}, 1, 0))
+	data.MarkNull(1)
+
+	runner := cluster.Distribute(ep.Pipeline(ep.Broadcast(), ep.Gather()))
+	res, err := eptest.Run(runner, ep.NewDataset(data))
+	require.NoError(t, err)
+	require.Equal(t, []string{"{key:a values:[true]}", "", "{key:a values:[true]}", ""}, res.At(0).Strings())
+	require.Equal(t, []string{"a", "b", "a", "b"}, res.At(0).(*ep.Structs).Field("key").Strings())
+	require.Equal(t, "struct(key:dict_string,values:list(bool))", res.At(0).Type().Name())
+}
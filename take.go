@@ -0,0 +1,129 @@
+package ep
+
+import "fmt"
+
+// Taker is an optional interface of Data, taking the values at the provided
+// indices at once, where other Data is taken by copying its rows one by one
+// into a new Data of its Type. It's used by Take and Filter, and implemented by
+// most of the built-in types
+type Taker interface {
+	Data
+
+	// Take returns a new data object containing the values at the provided
+	// indices, in their order, which are all in range [0, Len()). Indices may
+	// repeat
+	Take(indices []int) Data
+}
+
+// Take returns a new Data of the values at the provided indices of the data,
+// in their order, failing when any of them is out of range. Indices may repeat.
+// Datasets are taken column by column, as with TakeDataset
+func Take(data Data, indices []int) (Data, error) {
+	if err := checkLengths(data); err != nil {
+		return nil, err
+	}
+	for _, i := range indices {
+		if i < 0 || i >= data.Len() {
+			return nil, fmt.Errorf("ep: index %d out of range for %d rows", i, data.Len())
+		}
+	}
+	return take(data, indices), nil
+}
+
+// Filter returns a new Data of the values of the data whose booleans in the
+// mask are true, in their order. The mask must have a boolean for every value
+func Filter(data Data, mask []bool) (Data, error) {
+	if err := checkLengths(data); err != nil {
+		return nil, err
+	} else if len(mask) != data.Len() {
+		return nil, fmt.Errorf("ep: mask of %d values for %d rows", len(mask), data.Len())
+	}
+	return take(data, maskIndices(mask)), nil
+}
+
+// TakeDataset returns a new Dataset of the rows at the provided indices of the
+// dataset, as with Take. All of its columns must have the same length
+func TakeDataset(ds Dataset, indices []int) (Dataset, error) {
+	res, err := Take(ds, indices)
+	if err != nil {
+		return nil, err
+	}
+	return res.(Dataset), nil
+}
+
+// FilterDataset returns a new Dataset of the rows of the dataset whose
+// booleans in the mask are true, as with Filter. All of its columns must have
+// the same length
+func FilterDataset(ds Dataset, mask []bool) (Dataset, error) {
+	res, err := Filter(ds, mask)
+	if err != nil {
+		return nil, err
+	}
+	return res.(Dataset), nil
+}
+
+// checkLengths fails when the data is a Dataset whose columns have different
+// lengths, as the same indices can't be taken out of all of them
+func checkLengths(data Data) error {
+	ds, ok := data.(Dataset)
+	if !ok {
+		return nil
+	}
+
+	for i := 0; i < ds.Width(); i++ {
+		if n := ds.At(i).Len(); n != ds.Len() {
+			return fmt.Errorf("ep: column %d has %d rows, expected %d", i, n, ds.Len())
+		}
+		if err := checkLengths(ds.At(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// take returns the values at the indices, which are all in range
+func take(data Data, indices []int) Data {
+	switch d := data.(type) {
+	case Dataset:
+		cols := make([]Data, d.Width())
+		for i := range cols {
+			cols[i] = take(d.At(i), indices)
+		}
+		return NewDataset(cols...)
+	case Taker:
+		return d.Take(indices)
+	}
+
+	res := data.Type().Data(len(indices))
+	for j, i := range indices {
+		res.Copy(data, i, j)
+	}
+	return res
+}
+
+// maskIndices returns the indices of the true booleans of the mask
+func maskIndices(mask []bool) []int {
+	n := 0
+	for _, v := range mask {
+		if v {
+			n++
+		}
+	}
+
+	res := make([]int, 0, n)
+	for i, v := range mask {
+		if v {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// takeValues returns the values at the indices
+func takeValues[T any](values []T, indices []int) []T {
+	res := make([]T, len(indices))
+	for j, i := range indices {
+		res[j] = values[i]
+	}
+	return res
+}
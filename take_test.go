@@ -0,0 +1,104 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTake(t *testing.T) {
+	for name, newFn := range newData {
+		t.Run(name, func(t *testing.T) {
+			data := newFn()
+			if name != "strs" {
+				data.MarkNull(2)
+			}
+
+			res, err := ep.Take(data, []int{2, 0, 2, 4})
+			require.NoError(t, err)
+			require.Equal(t, data.Type(), res.Type())
+
+			strs, nulls := data.Strings(), data.Nulls()
+			require.Equal(t, []string{strs[2], strs[0], strs[2], strs[4]}, res.Strings())
+			require.Equal(t, []bool{nulls[2], nulls[0], nulls[2], nulls[4]}, res.Nulls())
+
+			// the result is independent of the data
+			res.Swap(0, 1)
+			require.Equal(t, strs, data.Strings())
+
+			res, err = ep.Take(data, nil)
+			require.NoError(t, err)
+			require.Equal(t, 0, res.Len())
+		})
+	}
+}
+
+func TestTake_outOfRange(t *testing.T) {
+	data := &ep.Int64s{Values: []int64{1, 2, 3}}
+
+	_, err := ep.Take(data, []int{0, 3})
+	require.Error(t, err)
+	require.Equal(t, "ep: index 3 out of range for 3 rows", err.Error())
+
+	_, err = ep.Take(data, []int{-1})
+	require.Error(t, err)
+	require.Equal(t, "ep: index -1 out of range for 3 rows", err.Error())
+
+	_, err = ep.TakeDataset(ep.NewDataset(data, strs{"a", "b"}), []int{0})
+	require.Error(t, err)
+	require.Equal(t, "ep: column 1 has 2 rows, expected 3", err.Error())
+}
+
+func TestFilter(t *testing.T) {
+	data := &ep.Int64s{Values: []int64{1, 2, 3}, Null: ep.NullMask{4}}
+
+	res, err := ep.Filter(data, []bool{true, false, true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", ""}, res.Strings())
+	require.Equal(t, []bool{false, true}, res.Nulls())
+
+	res, err = ep.Filter(data, []bool{true, true, true})
+	require.NoError(t, err)
+	require.Equal(t, data.Strings(), res.Strings())
+	require.Equal(t, data.Nulls(), res.Nulls())
+
+	res, err = ep.Filter(data, []bool{false, false, false})
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Len())
+
+	res, err = ep.Filter(&ep.Int64s{}, []bool{})
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Len())
+
+	_, err = ep.Filter(data, []bool{true})
+	require.Error(t, err)
+	require.Equal(t, "ep: mask of 1 values for 3 rows", err.Error())
+}
+
+func TestFilterDataset(t *testing.T) {
+	data := ep.NewDataset(strs{"a", "b", "c"}, &ep.Int64s{Values: []int64{1, 2, 3}})
+
+	res, err := ep.FilterDataset(data, []bool{false, true, true})
+	require.NoError(t, err)
+	require.Equal(t, 2, res.Width())
+	require.Equal(t, []string{"b", "c"}, res.At(0).Strings())
+	require.Equal(t, []string{"2", "3"}, res.At(1).Strings())
+
+	res, err = ep.FilterDataset(data, []bool{false, false, false})
+	require.NoError(t, err)
+	require.Equal(t, 2, res.Width())
+	require.Equal(t, 0, res.Len())
+
+	res, err = ep.TakeDataset(data, []int{2, 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c", "c"}, res.At(0).Strings())
+	require.Equal(t, []string{"3", "3"}, res.At(1).Strings())
+
+	_, err = ep.FilterDataset(data, nil)
+	require.Error(t, err)
+	require.Equal(t, "ep: mask of 0 values for 3 rows", err.Error())
+
+	_, err = ep.FilterDataset(ep.NewDataset(strs{"a"}, data), []bool{true})
+	require.Error(t, err)
+	require.Equal(t, "ep: column 1 has 3 rows, expected 1", err.Error())
+}
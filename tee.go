@@ -0,0 +1,114 @@
+package ep
+
+import (
+	"context"
+	"fmt"
+)
+
+var _ = registerGob(&tee{})
+
+// Tee returns a Runner that outputs its input as is, while also running the
+// sink runner concurrently, on clones of all of the datasets of the input,
+// e.g. for writing them to a file. The output of the sink is discarded. Run
+// waits for the sink to complete, and returns its error, such that a sink that
+// fails stops the Tee, which then drains the rest of its input.
+//
+// By default, every dataset is output once the sink received it, thus a slow
+// sink slows down the Tee. TeeBuffer sets a buffer of datasets instead, which
+// fails the Tee once the sink is behind by more than the buffer
+func Tee(sink Runner) Runner {
+	return &tee{Sink: sink}
+}
+
+// TeeBuffer sets the number of datasets buffered for the sink of a Runner
+// returned by Tee, which fails once the buffer is full, rather than waiting
+// for the sink. A non-positive number waits for the sink
+func TeeBuffer(r Runner, datasets int) Runner {
+	t, ok := r.(*tee)
+	if !ok {
+		panic("ep: TeeBuffer expects a Tee")
+	}
+
+	t.Buffer = datasets
+	return t
+}
+
+type tee struct {
+	Sink   Runner
+	Buffer int
+}
+
+func (*tee) Returns() []Type { return []Type{Wildcard} }
+func (r *tee) Run(ctx context.Context, inp, out chan Dataset) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var sinkInp chan Dataset
+	if r.Buffer > 0 {
+		sinkInp = make(chan Dataset, r.Buffer)
+	} else {
+		sinkInp = make(chan Dataset)
+	}
+
+	var sinkErr error
+	sinkReturned, sinkDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(sinkDone)
+		sinkOut := make(chan Dataset)
+		go func() {
+			for range sinkOut {
+			}
+		}()
+
+		sinkErr = runSafe(ctx, r.Sink, sinkInp, sinkOut)
+		close(sinkOut)
+		close(sinkReturned)
+
+		// the sink might have returned before its input was completed
+		for range sinkInp {
+		}
+	}()
+
+	for data := range inp {
+		if err != nil {
+			continue // drain
+		}
+
+		select {
+		case <-sinkReturned:
+			if sinkErr != nil {
+				err = sinkErr
+				continue
+			}
+		default:
+		}
+
+		clone := Clone(data).(Dataset)
+		if r.Buffer > 0 {
+			select {
+			case sinkInp <- clone:
+			default:
+				err = fmt.Errorf("ep: tee sink is behind by more than %d datasets", r.Buffer)
+				cancel()
+				continue
+			}
+		} else {
+			select {
+			case sinkInp <- clone:
+			case <-sinkReturned:
+				if sinkErr != nil {
+					err = sinkErr
+					continue
+				}
+			}
+		}
+		out <- data
+	}
+
+	close(sinkInp)
+	<-sinkDone
+	if err == nil {
+		err = sinkErr
+	}
+	return err
+}
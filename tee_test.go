@@ -0,0 +1,90 @@
+package ep_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a Runner that records all of the datasets of its input, after
+// a delay for each of them, and fails on the failOn-th of them, when positive
+type recorder struct {
+	l        sync.Mutex
+	datasets []ep.Dataset
+	delay    time.Duration
+	failOn   int
+}
+
+func (*recorder) Returns() []ep.Type { return []ep.Type{ep.Wildcard} }
+func (r *recorder) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	for data := range inp {
+		time.Sleep(r.delay)
+
+		r.l.Lock()
+		r.datasets = append(r.datasets, data)
+		n := len(r.datasets)
+		r.l.Unlock()
+
+		if n == r.failOn {
+			return fmt.Errorf("failed on %d", n)
+		}
+		out <- data
+	}
+	return nil
+}
+
+func TestTee(t *testing.T) {
+	sink := &recorder{delay: time.Millisecond}
+	data := ep.NewDataset(strs{"hello", "world"})
+	res, err := eptest.Run(ep.Pipeline(ep.Tee(sink), &upper{}), data, data, data)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[HELLO WORLD HELLO WORLD HELLO WORLD]"}, res.Strings())
+
+	// the sink completed, on clones of the datasets
+	require.Len(t, sink.datasets, 3)
+	for _, recorded := range sink.datasets {
+		require.Equal(t, data.Strings(), recorded.Strings())
+		require.False(t, ep.Same(data, recorded))
+	}
+}
+
+func TestTee_errorMidStream(t *testing.T) {
+	sink := &recorder{failOn: 2}
+	var datasets []ep.Dataset
+	for i := 0; i < 10; i++ {
+		datasets = append(datasets, ep.NewDataset(strs{fmt.Sprintf("%d", i)}))
+	}
+
+	// the rest of the input is drained
+	res, err := eptest.Run(ep.Tee(sink), datasets...)
+	require.EqualError(t, err, "failed on 2")
+	require.True(t, res.Len() < 10)
+	require.Len(t, sink.datasets, 2)
+}
+
+func TestTeeBuffer(t *testing.T) {
+	data := ep.NewDataset(strs{"hello"})
+	var datasets []ep.Dataset
+	for i := 0; i < 10; i++ {
+		datasets = append(datasets, data)
+	}
+
+	// a slow sink falls behind the buffer
+	sink := &recorder{delay: 50 * time.Millisecond}
+	_, err := eptest.Run(ep.TeeBuffer(ep.Tee(sink), 2), datasets...)
+	require.EqualError(t, err, "ep: tee sink is behind by more than 2 datasets")
+
+	// while a buffer large enough doesn't fail
+	sink = &recorder{delay: time.Millisecond}
+	res, err := eptest.Run(ep.TeeBuffer(ep.Tee(sink), 10), datasets...)
+	require.NoError(t, err)
+	require.Equal(t, 10, res.Len())
+	require.Len(t, sink.datasets, 10)
+
+	require.Panics(t, func() { ep.TeeBuffer(ep.PassThrough(), 1) })
+}
@@ -0,0 +1,63 @@
+#!/usr/bin/env python3
+"""Writes the Arrow IPC streams of the golden tests in arrow_internal_test.go,
+with pyarrow, into this directory:
+
+    pip install pyarrow
+    python3 testdata/arrow/generate.py
+
+The batches must match the arrowGolden datasets of the tests, which decode
+the streams with ReadArrow, and compare them to the ones of WriteArrow, such
+that the Arrow codec is tested against an independent implementation, rather
+than only against itself. CI generates the streams before running the tests,
+while without them the golden tests are skipped.
+"""
+
+import os
+
+import pyarrow as pa
+
+
+def batch(**columns):
+    return pa.RecordBatch.from_arrays(list(columns.values()), names=list(columns))
+
+
+BATCHES = {
+    # all of the types of WriteArrow, with a null in the middle of each column
+    "types": batch(
+        null=pa.nulls(3),
+        int64=pa.array([1, None, -3], pa.int64()),
+        double=pa.array([1.5, None, -0.25], pa.float64()),
+        bool=pa.array([True, None, False], pa.bool_()),
+        utf8=pa.array(["a", None, "héllo, wörld"], pa.string()),
+        binary=pa.array([b"\x00\x01\x02", None, b""], pa.binary()),
+        # 2020-01-02T03:04:05.000000006Z, and the epoch
+        timestamp=pa.array([1577934245000000006, None, 0], pa.timestamp("ns", tz="UTC")),
+        # 2020-01-02, and the epoch
+        date32=pa.array([18263, None, 0], pa.date32()),
+    ),
+
+    # without nulls, the validity bitmaps are empty
+    "no_nulls": batch(
+        int64=pa.array([1, 2, 3, 4, 5, 6, 7, 8, 9], pa.int64()),
+        bool=pa.array([True, False, True, True, False, False, True, False, True], pa.bool_()),
+        utf8=pa.array(["", "a", "bc", "", "def", "g", "", "hi", "j"], pa.string()),
+    ),
+
+    # a record batch of no rows
+    "empty": batch(
+        int64=pa.array([], pa.int64()),
+        utf8=pa.array([], pa.string()),
+    ),
+}
+
+
+def main():
+    here = os.path.dirname(os.path.abspath(__file__))
+    for name, b in BATCHES.items():
+        with pa.OSFile(os.path.join(here, name + ".arrows"), "wb") as f:
+            with pa.ipc.new_stream(f, b.schema) as writer:
+                writer.write_batch(b)
+
+
+if __name__ == "__main__":
+    main()
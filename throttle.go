@@ -0,0 +1,105 @@
+package ep
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// RateLimit sets an exchange Runner, returned by Scatter, Gather, Partition,
+// etc., to send at most bytesPerSec bytes per second from this node, over all
+// of its connections combined. It paces the writes to the network, thus it
+// applies to the compressed streams
+func RateLimit(r Runner, bytesPerSec int) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: RateLimit expects an exchange")
+	}
+
+	ex.RateLimit = bytesPerSec
+	return ex
+}
+
+// throttled returns a connection whose writes are paced by the rate limiter
+// shared by all of the connections of the exchange, when set
+func (ex *exchange) throttled(conn net.Conn) net.Conn {
+	if ex.RateLimit <= 0 {
+		return conn
+	}
+
+	if ex.limiter == nil {
+		ex.limiter = newByteLimiter(ex.RateLimit)
+	}
+	return &throttledConn{conn, ex.limiter}
+}
+
+// throttledConn is a connection that waits for the limiter before writing
+type throttledConn struct {
+	net.Conn
+	limiter *byteLimiter
+}
+
+func (c *throttledConn) Write(b []byte) (n int, err error) {
+	// writes larger than the burst are split, such that no write has to wait
+	// for more tokens than the limiter can hold
+	for len(b) > 0 && err == nil {
+		chunk := b
+		if len(chunk) > c.limiter.burst {
+			chunk = chunk[:c.limiter.burst]
+		}
+
+		c.limiter.wait(len(chunk))
+		var written int
+		written, err = c.Conn.Write(chunk)
+		n += written
+		b = b[written:]
+	}
+	return n, err
+}
+
+func (c *throttledConn) CloseWrite() error { return closeWrite(c.Conn) }
+
+// byteLimiter is a token bucket of bytes, refilled at a constant rate up to a
+// burst of a second's worth of bytes
+type byteLimiter struct {
+	rate  float64 // bytes per second
+	burst int
+
+	l      sync.Mutex
+	tokens float64 // might be negative, when reserved by waiting writes
+	last   time.Time
+
+	// the clock, replaceable in tests
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newByteLimiter(bytesPerSec int) *byteLimiter {
+	return &byteLimiter{
+		rate:   float64(bytesPerSec),
+		burst:  bytesPerSec,
+		tokens: float64(bytesPerSec),
+		last:   time.Now(),
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+// wait reserves n bytes, and waits until they're available
+func (lim *byteLimiter) wait(n int) {
+	lim.l.Lock()
+	now := lim.now()
+	lim.tokens += now.Sub(lim.last).Seconds() * lim.rate
+	if lim.tokens > float64(lim.burst) {
+		lim.tokens = float64(lim.burst)
+	}
+	lim.last = now
+
+	lim.tokens -= float64(n)
+	deficit := -lim.tokens
+	lim.l.Unlock()
+
+	if deficit > 0 {
+		lim.sleep(time.Duration(deficit / lim.rate * float64(time.Second)))
+	}
+}
@@ -0,0 +1,96 @@
+package ep
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Timeout sets an exchange Runner, returned by Scatter, Gather, Partition,
+// etc., to fail when any of its connections makes no progress for longer than
+// d: a read that didn't receive anything from its peer, or a write that the
+// peer didn't consume. The deadline is refreshed before every read and write,
+// thus it bounds the time between messages rather than the whole exchange.
+// Peers that legitimately take longer to produce their first dataset should
+// use a longer timeout.
+func Timeout(r Runner, d time.Duration) Runner {
+	ex, ok := r.(*exchange)
+	if !ok {
+		panic("ep: Timeout expects an exchange")
+	}
+
+	ex.Timeout = d
+	return ex
+}
+
+// withTimeout wraps a connection to a peer, such that every read and write to
+// it fails after the Timeout of the exchange, and reads also fail after the
+// HeartbeatTimeout once the peer is known to send heartbeats
+func (ex *exchange) withTimeout(conn net.Conn, addr string) net.Conn {
+	if ex.Timeout <= 0 && ex.HeartbeatTimeout <= 0 {
+		return conn
+	}
+	return &deadlineConn{Conn: conn, addr: addr, timeout: ex.Timeout, idle: ex.HeartbeatTimeout}
+}
+
+// deadlineConn is a connection that sets a new deadline before every read and
+// write, and identifies the peer when the deadline is exceeded
+type deadlineConn struct {
+	net.Conn
+	addr      string
+	timeout   time.Duration // of every read and write, when set
+	idle      time.Duration // of every read, once detecting
+	detecting bool          // is the peer known to send heartbeats
+}
+
+func (c *deadlineConn) detectIdle() {
+	c.detecting = c.idle > 0
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	timeout, idle := c.timeout, false
+	if c.detecting && (timeout <= 0 || c.idle < timeout) {
+		timeout, idle = c.idle, true
+	}
+
+	if timeout > 0 {
+		err := c.Conn.SetReadDeadline(time.Now().Add(timeout))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := c.Conn.Read(b)
+	if idle && isTimeout(err) {
+		return n, &peerDeadError{c.addr, c.idle}
+	}
+	return n, c.wrap("read from", err)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.timeout <= 0 {
+		return c.Conn.Write(b)
+	}
+
+	err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := c.Conn.Write(b)
+	return n, c.wrap("write to", err)
+}
+
+func (c *deadlineConn) CloseWrite() error { return closeWrite(c.Conn) }
+
+func (c *deadlineConn) wrap(op string, err error) error {
+	if isTimeout(err) {
+		return fmt.Errorf("ep: %s %s timed out after %s", op, c.addr, c.timeout)
+	}
+	return err
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
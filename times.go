@@ -0,0 +1,391 @@
+package ep
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"time"
+)
+
+// Timestamp is the built-in Type of columns of points in time, backed by the
+// Timestamps Data implementation. Date is the Type of columns of calendar
+// days, backed by Dates. Their Data is nullable, and nulls sort after all
+// values
+var (
+	Timestamp = &timestampType{}
+	Date      = &dateType{}
+)
+
+var _ = Types.
+	Register("timestamp", Timestamp).
+	Register("date", Date)
+
+// DateLayout is the layout of the Strings of Dates, and of ParseDates when no
+// layout is provided
+const DateLayout = "2006-01-02"
+
+type timestampType struct{}
+
+func (t *timestampType) String() string     { return t.Name() }
+func (*timestampType) Name() string         { return "timestamp" }
+func (*timestampType) Data(n int) Data      { return &Timestamps{Values: make([]time.Time, n)} }
+func (*timestampType) DataEmpty(n int) Data { return &Timestamps{Values: make([]time.Time, 0, n)} }
+
+type dateType struct{}
+
+func (t *dateType) String() string     { return t.Name() }
+func (*dateType) Name() string         { return "date" }
+func (*dateType) Data(n int) Data      { return &Dates{Values: make([]time.Time, n)} }
+func (*dateType) DataEmpty(n int) Data { return &Dates{Values: make([]time.Time, 0, n)} }
+
+// ParseTimestamps parses the values with the layout, as with time.Parse, into
+// Timestamps. Empty values are nulls
+func ParseTimestamps(layout string, values []string) (*Timestamps, error) {
+	vs, nulls, err := parseTimes(layout, values)
+	return &Timestamps{vs, nulls}, err
+}
+
+// ParseDates parses the values with the layout, as with time.Parse, into
+// Dates. An empty layout defaults to DateLayout. Empty values are nulls
+func ParseDates(layout string, values []string) (*Dates, error) {
+	if layout == "" {
+		layout = DateLayout
+	}
+
+	vs, nulls, err := parseTimes(layout, values)
+	return &Dates{vs, nulls}, err
+}
+
+func parseTimes(layout string, values []string) ([]time.Time, NullMask, error) {
+	res := make([]time.Time, len(values))
+	var nulls NullMask
+	for i, v := range values {
+		if v == "" {
+			nulls.Set(i, true)
+			continue
+		}
+
+		t, err := time.Parse(layout, v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ep: row %d: %s", i, err)
+		}
+		res[i] = t
+	}
+	return res, nulls, nil
+}
+
+// Timestamps is the Data of the Timestamp type. Values are compared as
+// instants, regardless of their locations, and their Strings are formatted
+// with RFC3339, in their own locations. Only the offsets of the locations are
+// sent by exchanges, not their names
+type Timestamps struct {
+	Values []time.Time
+	Null   NullMask
+}
+
+// Type returns the Timestamp type
+func (*Timestamps) Type() Type { return Timestamp }
+
+// Len returns the number of values
+func (vs *Timestamps) Len() int { return len(vs.Values) }
+
+// Less reports whether the i-th value sorts before the j-th one
+func (vs *Timestamps) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+
+// Swap swaps the i-th and the j-th values, along with their nulls
+func (vs *Timestamps) Swap(i, j int) {
+	vs.Values[i], vs.Values[j] = vs.Values[j], vs.Values[i]
+	vs.Null.Swap(i, j)
+}
+
+// LessOther reports whether the thisRow-th value sorts before the
+// otherRow-th value of the other data
+func (vs *Timestamps) LessOther(thisRow int, other Data, otherRow int) bool {
+	return vs.Compare(thisRow, other, otherRow) < 0
+}
+
+// Compare compares the thisRow-th value to the otherRow-th value of the
+// other data, see Comparable
+func (vs *Timestamps) Compare(thisRow int, other Data, otherRow int) int {
+	data := other.(*Timestamps)
+	if c, ok := compareNulls(vs.IsNull(thisRow), data.IsNull(otherRow)); ok {
+		return c
+	}
+	return vs.Values[thisRow].Compare(data.Values[otherRow])
+}
+
+// Hash hashes the instants, such that equal instants in different locations
+// have the same hash
+func (vs *Timestamps) Hash(row int, h hash.Hash64) {
+	hashUint64(h, uint64(vs.Values[row].Unix()))
+	hashUint64(h, uint64(vs.Values[row].Nanosecond()))
+}
+
+// Slice returns the values from the start to the end indices
+func (vs *Timestamps) Slice(s, e int) Data {
+	return &Timestamps{vs.Values[s:e], vs.Null.Slice(s, e)}
+}
+
+// Append returns the values followed by the ones of the other data
+func (vs *Timestamps) Append(other Data) Data {
+	data := other.(*Timestamps)
+	return &Timestamps{
+		append(vs.Values[:len(vs.Values):len(vs.Values)], data.Values...),
+		vs.Null.Append(vs.Len(), data.Null),
+	}
+}
+
+// AppendAll returns the values followed by the ones of all of the others,
+// allocated at once, see Concatenator
+func (vs *Timestamps) AppendAll(others ...Data) Data {
+	values, nulls := appendAll(vs, others, func(data Data) ([]time.Time, NullMask) {
+		return data.(*Timestamps).Values, data.(*Timestamps).Null
+	})
+	return &Timestamps{values, nulls}
+}
+
+// Duplicate returns the values repeated t times
+func (vs *Timestamps) Duplicate(t int) Data {
+	return &Timestamps{duplicateTimes(vs.Values, t), vs.Null.Duplicate(vs.Len(), t)}
+}
+
+// IsNull reports whether the i-th value is null
+func (vs *Timestamps) IsNull(i int) bool { return vs.Null.Get(i) }
+
+// MarkNull marks the i-th value as null
+func (vs *Timestamps) MarkNull(i int) { vs.Null.Set(i, true) }
+
+// Nulls reports whether each one of the values is null
+func (vs *Timestamps) Nulls() []bool { return vs.Null.Nulls(vs.Len()) }
+
+// Equal reports whether the other data has the same values, as with
+// DataEqual
+func (vs *Timestamps) Equal(other Data) bool { return DataEqual(vs, other) }
+
+// Same reports whether the other data shares the values, see Sharer
+func (vs *Timestamps) Same(other Data) bool {
+	data, ok := other.(*Timestamps)
+	return ok && (vs == data || vs.Len() > 0 && data.Len() > 0 && &vs.Values[0] == &data.Values[0])
+}
+
+// Copy copies the fromRow-th value of the other data to the toRow-th value
+func (vs *Timestamps) Copy(from Data, fromRow, toRow int) {
+	src := from.(*Timestamps)
+	vs.Values[toRow] = src.Values[fromRow]
+	vs.Null.Copy(src.Null, fromRow, toRow)
+}
+
+// Take returns the values at the indices, in their order, see Taker
+func (vs *Timestamps) Take(indices []int) Data {
+	return &Timestamps{takeValues(vs.Values, indices), vs.Null.Take(indices)}
+}
+
+// Clone returns a copy of the values, see Cloner
+func (vs *Timestamps) Clone() Data {
+	return &Timestamps{append([]time.Time(nil), vs.Values...), vs.Null.Slice(0, vs.Len())}
+}
+
+// Size returns the number of bytes of the values, see Sized
+func (vs *Timestamps) Size() uint64 { return uint64(vs.Len())*timeSize + vs.Null.Size() }
+
+// Strings returns the string representations of the values, which are
+// empty for nulls
+func (vs *Timestamps) Strings() []string {
+	return formatTimes(vs.Values, vs.Null, time.RFC3339Nano)
+}
+
+// AppendStringAt appends the string representation of the row-th value to
+// dst, see StringerAt
+func (vs *Timestamps) AppendStringAt(dst []byte, row int) []byte {
+	if vs.IsNull(row) {
+		return dst
+	}
+	return vs.Values[row].AppendFormat(dst, time.RFC3339Nano)
+}
+
+// MarshalJSONValue returns the JSON encoding of the row-th value, see
+// JSONData
+func (vs *Timestamps) MarshalJSONValue(row int) ([]byte, error) {
+	return vs.Values[row].MarshalJSON()
+}
+
+// UnmarshalJSONValue sets the row-th value to the JSON encoded one, see
+// JSONData
+func (vs *Timestamps) UnmarshalJSONValue(row int, b []byte) error {
+	return vs.Values[row].UnmarshalJSON(b)
+}
+
+// Dates is the Data of the Date type. Values are compared by their calendar
+// days, in their own locations, ignoring the time of day: two values of the
+// same day are equal even when they're different instants. Their Strings are
+// formatted with DateLayout
+type Dates struct {
+	Values []time.Time
+	Null   NullMask
+}
+
+// Type returns the Date type
+func (*Dates) Type() Type { return Date }
+
+// Len returns the number of values
+func (vs *Dates) Len() int { return len(vs.Values) }
+
+// Less reports whether the i-th value sorts before the j-th one
+func (vs *Dates) Less(i, j int) bool { return vs.LessOther(i, vs, j) }
+
+// Swap swaps the i-th and the j-th values, along with their nulls
+func (vs *Dates) Swap(i, j int) {
+	vs.Values[i], vs.Values[j] = vs.Values[j], vs.Values[i]
+	vs.Null.Swap(i, j)
+}
+
+// LessOther reports whether the thisRow-th value sorts before the
+// otherRow-th value of the other data
+func (vs *Dates) LessOther(thisRow int, other Data, otherRow int) bool {
+	return vs.Compare(thisRow, other, otherRow) < 0
+}
+
+// Compare compares the thisRow-th value to the otherRow-th value of the
+// other data, see Comparable
+func (vs *Dates) Compare(thisRow int, other Data, otherRow int) int {
+	data := other.(*Dates)
+	if c, ok := compareNulls(vs.IsNull(thisRow), data.IsNull(otherRow)); ok {
+		return c
+	}
+	y1, m1, d1 := vs.Values[thisRow].Date()
+	y2, m2, d2 := data.Values[otherRow].Date()
+	if c := cmp.Compare(y1, y2); c != 0 {
+		return c
+	} else if c := cmp.Compare(m1, m2); c != 0 {
+		return c
+	}
+	return cmp.Compare(d1, d2)
+}
+
+// Hash hashes the row-th value, see Hashable
+func (vs *Dates) Hash(row int, h hash.Hash64) {
+	y, m, d := vs.Values[row].Date()
+	hashUint64(h, uint64(y))
+	hashUint64(h, uint64(m)<<8|uint64(d))
+}
+
+// Slice returns the values from the start to the end indices
+func (vs *Dates) Slice(s, e int) Data {
+	return &Dates{vs.Values[s:e], vs.Null.Slice(s, e)}
+}
+
+// Append returns the values followed by the ones of the other data
+func (vs *Dates) Append(other Data) Data {
+	data := other.(*Dates)
+	return &Dates{
+		append(vs.Values[:len(vs.Values):len(vs.Values)], data.Values...),
+		vs.Null.Append(vs.Len(), data.Null),
+	}
+}
+
+// AppendAll returns the values followed by the ones of all of the others,
+// allocated at once, see Concatenator
+func (vs *Dates) AppendAll(others ...Data) Data {
+	values, nulls := appendAll(vs, others, func(data Data) ([]time.Time, NullMask) {
+		return data.(*Dates).Values, data.(*Dates).Null
+	})
+	return &Dates{values, nulls}
+}
+
+// Duplicate returns the values repeated t times
+func (vs *Dates) Duplicate(t int) Data {
+	return &Dates{duplicateTimes(vs.Values, t), vs.Null.Duplicate(vs.Len(), t)}
+}
+
+// IsNull reports whether the i-th value is null
+func (vs *Dates) IsNull(i int) bool { return vs.Null.Get(i) }
+
+// MarkNull marks the i-th value as null
+func (vs *Dates) MarkNull(i int) { vs.Null.Set(i, true) }
+
+// Nulls reports whether each one of the values is null
+func (vs *Dates) Nulls() []bool { return vs.Null.Nulls(vs.Len()) }
+
+// Equal reports whether the other data has the same values, as with
+// DataEqual
+func (vs *Dates) Equal(other Data) bool { return DataEqual(vs, other) }
+
+// Same reports whether the other data shares the values, see Sharer
+func (vs *Dates) Same(other Data) bool {
+	data, ok := other.(*Dates)
+	return ok && (vs == data || vs.Len() > 0 && data.Len() > 0 && &vs.Values[0] == &data.Values[0])
+}
+
+// Copy copies the fromRow-th value of the other data to the toRow-th value
+func (vs *Dates) Copy(from Data, fromRow, toRow int) {
+	src := from.(*Dates)
+	vs.Values[toRow] = src.Values[fromRow]
+	vs.Null.Copy(src.Null, fromRow, toRow)
+}
+
+// Take returns the values at the indices, in their order, see Taker
+func (vs *Dates) Take(indices []int) Data {
+	return &Dates{takeValues(vs.Values, indices), vs.Null.Take(indices)}
+}
+
+// Clone returns a copy of the values, see Cloner
+func (vs *Dates) Clone() Data {
+	return &Dates{append([]time.Time(nil), vs.Values...), vs.Null.Slice(0, vs.Len())}
+}
+
+// Size returns the number of bytes of the values, see Sized
+func (vs *Dates) Size() uint64 { return uint64(vs.Len())*timeSize + vs.Null.Size() }
+
+// Strings returns the string representations of the values, which are
+// empty for nulls
+func (vs *Dates) Strings() []string {
+	return formatTimes(vs.Values, vs.Null, DateLayout)
+}
+
+// AppendStringAt appends the string representation of the row-th value to
+// dst, see StringerAt
+func (vs *Dates) AppendStringAt(dst []byte, row int) []byte {
+	if vs.IsNull(row) {
+		return dst
+	}
+	return vs.Values[row].AppendFormat(dst, DateLayout)
+}
+
+// MarshalJSONValue returns the JSON encoding of the row-th value, see
+// JSONData
+func (vs *Dates) MarshalJSONValue(row int) ([]byte, error) {
+	return json.Marshal(vs.Values[row].Format(DateLayout))
+}
+
+// UnmarshalJSONValue sets the row-th value to the JSON encoded one, see
+// JSONData
+func (vs *Dates) UnmarshalJSONValue(row int, b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	t, err := time.Parse(DateLayout, s)
+	vs.Values[row] = t
+	return err
+}
+
+func duplicateTimes(vs []time.Time, t int) []time.Time {
+	res := make([]time.Time, 0, len(vs)*t)
+	for i := 0; i < t; i++ {
+		res = append(res, vs...)
+	}
+	return res
+}
+
+// formatTimes formats the values with the layout, and nulls as empty strings
+func formatTimes(vs []time.Time, nulls NullMask, layout string) []string {
+	res := make([]string, len(vs))
+	for i, v := range vs {
+		if !nulls.Get(i) {
+			res[i] = v.Format(layout)
+		}
+	}
+	return res
+}
@@ -0,0 +1,24 @@
+package ep_test
+
+import (
+	"fmt"
+	"github.com/panoplyio/ep"
+	"sort"
+	"time"
+)
+
+func ExampleParseTimestamps() {
+	times, err := ep.ParseTimestamps(time.RFC3339, []string{
+		"2021-11-07T01:15:00-05:00",
+		"",
+		"2021-11-07T01:45:00-04:00",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sort.Sort(times)
+	fmt.Printf("%q\n", times.Strings())
+
+	// Output: ["2021-11-07T01:45:00-04:00" "2021-11-07T01:15:00-05:00" ""]
+}
@@ -0,0 +1,94 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+	"time"
+)
+
+// the offsets of New York before and after the end of daylight saving time,
+// on 2021-11-07 at 02:00 EDT, when the clocks are turned back to 01:00 EST
+var (
+	edt = time.FixedZone("EDT", -4*60*60)
+	est = time.FixedZone("EST", -5*60*60)
+)
+
+// The wall clock repeats itself once daylight saving time ends, but the
+// instants are still ordered
+func TestTimestamps_dstBoundary(t *testing.T) {
+	data := &ep.Timestamps{Values: []time.Time{
+		time.Date(2021, 11, 7, 1, 15, 0, 0, est), // 06:15Z
+		time.Date(2021, 11, 7, 1, 45, 0, 0, edt), // 05:45Z
+		time.Date(2021, 11, 7, 1, 30, 0, 0, est), // 06:30Z
+		time.Date(2021, 11, 7, 1, 30, 0, 0, edt), // 05:30Z
+	}}
+
+	sort.Sort(data)
+	require.Equal(t, []string{
+		"2021-11-07T01:30:00-04:00",
+		"2021-11-07T01:45:00-04:00",
+		"2021-11-07T01:15:00-05:00",
+		"2021-11-07T01:30:00-05:00",
+	}, data.Strings())
+
+	// the same instant in different locations is equal
+	other := &ep.Timestamps{Values: []time.Time{time.Date(2021, 11, 7, 5, 30, 0, 0, time.UTC)}}
+	require.False(t, data.LessOther(0, other, 0))
+	require.False(t, other.LessOther(0, data, 0))
+	require.True(t, other.LessOther(0, data, 1))
+	require.False(t, data.LessOther(1, other, 0))
+}
+
+// Dates are compared by their calendar days, in their own locations, even
+// when the instants are ordered the other way around
+func TestDates_calendarDays(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	data := &ep.Dates{Values: []time.Time{
+		time.Date(2021, 3, 15, 0, 30, 0, 0, tokyo), // 2021-03-14T15:30Z
+		time.Date(2021, 3, 14, 20, 0, 0, 0, edt),   // 2021-03-15T00:00Z
+		time.Date(2021, 3, 14, 1, 0, 0, 0, est),
+	}}
+
+	require.True(t, data.Less(1, 0))
+	require.False(t, data.Less(0, 1))
+
+	// same day, different times of day
+	require.False(t, data.Less(1, 2))
+	require.False(t, data.Less(2, 1))
+
+	sort.Stable(data)
+	require.Equal(t, []string{"2021-03-14", "2021-03-14", "2021-03-15"}, data.Strings())
+}
+
+func TestParseTimestamps(t *testing.T) {
+	data, err := ep.ParseTimestamps(time.RFC3339, []string{"2021-11-07T01:30:00-05:00", "", "2021-11-07T01:30:00-04:00"})
+	require.NoError(t, err)
+	require.Equal(t, []bool{false, true, false}, data.Nulls())
+	require.Equal(t, []string{"2021-11-07T01:30:00-05:00", "", "2021-11-07T01:30:00-04:00"}, data.Strings())
+
+	// nulls sort last
+	sort.Sort(data)
+	require.Equal(t, []string{"2021-11-07T01:30:00-04:00", "2021-11-07T01:30:00-05:00", ""}, data.Strings())
+
+	_, err = ep.ParseTimestamps(time.RFC3339, []string{"2021-11-07T01:30:00Z", "yesterday"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "ep: row 1: parsing time \"yesterday\"")
+}
+
+func TestParseDates(t *testing.T) {
+	data, err := ep.ParseDates("", []string{"2021-03-15", "", "2021-03-14"})
+	require.NoError(t, err)
+	require.Equal(t, []bool{false, true, false}, data.Nulls())
+
+	sort.Sort(data)
+	require.Equal(t, []string{"2021-03-14", "2021-03-15", ""}, data.Strings())
+
+	data, err = ep.ParseDates("01/02/2006", []string{"03/15/2021"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"2021-03-15"}, data.Strings())
+
+	_, err = ep.ParseDates("", []string{"03/15/2021"})
+	require.Error(t, err)
+}
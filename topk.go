@@ -0,0 +1,167 @@
+package ep
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+)
+
+var _ = registerGob(&topK{})
+
+// TopK returns a Runner that outputs the first k rows of all of its input, as
+// sorted by the sorting columns, without sorting all of it. It retains at most
+// k rows at any time, copied out of the input batches into a heap of its own,
+// and outputs them sorted, in a single dataset, once its input is completed.
+// Rows that are equal by all of the sorting columns are ordered by their
+// arrival, thus the output equals the first k rows of SortDataset of all of
+// the input. A non-positive k outputs nothing.
+//
+// In distributed plans, it's placed before and after a Gather, such that every
+// node sends its own top k rows alone, and the main node selects the top k of
+// these. GatherLimit isn't enough, as it keeps the first rows to arrive rather
+// than the top ones
+func TopK(k int, cols []SortingCol) Runner {
+	return &topK{K: k, SortingCols: cols}
+}
+
+type topK struct {
+	K           int
+	SortingCols []SortingCol
+}
+
+func (*topK) Returns() []Type { return []Type{Wildcard} }
+func (r *topK) Run(_ context.Context, inp, out chan Dataset) error {
+	h := &topKHeap{k: r.K, sortingCols: r.SortingCols}
+	for data := range inp {
+		if err := h.check(data); err != nil {
+			return err
+		}
+		for i := 0; i < data.Len(); i++ {
+			h.offer(data, i)
+		}
+	}
+
+	if res := h.sorted(); res != nil {
+		out <- res
+	}
+	return nil
+}
+
+// topKHeap is a heap of up to k rows, with the worst of them at its root. The
+// rows are stored in their slots of the columns, which are never moved, while
+// the heap itself orders the indices of the slots
+type topKHeap struct {
+	k           int
+	sortingCols []SortingCol
+	rows        Dataset // the retained rows, in their slots
+	seqs        []int   // of the rows in every slot, by their arrival
+	slots       []int   // the heap
+	seq         int     // of the next row
+}
+
+// check verifies that the data is of the same width as the data before, and
+// of the sorting columns
+func (h *topKHeap) check(data Dataset) error {
+	if h.rows != nil && data.Width() != h.rows.Width() {
+		return fmt.Errorf("ep: top k of datasets of %d and %d columns", h.rows.Width(), data.Width())
+	}
+	for _, col := range h.sortingCols {
+		if col.Index < 0 || col.Index >= data.Width() {
+			return fmt.Errorf("ep: sorting column %d out of range for %d columns", col.Index, data.Width())
+		}
+	}
+	return checkLengths(data)
+}
+
+// offer copies the i-th row of the data into the heap, when it's among the top
+// k rows so far, replacing the worst of them once there are k of them
+func (h *topKHeap) offer(data Dataset, i int) {
+	seq := h.seq
+	h.seq++
+	if h.k <= 0 {
+		return
+	}
+
+	if len(h.slots) < h.k {
+		slot := len(h.slots)
+		h.grow(data, slot+1)
+		h.set(slot, seq, data, i)
+		heap.Push(h, slot)
+	} else if root := h.slots[0]; h.less(data, i, seq, root) {
+		h.set(root, seq, data, i)
+		heap.Fix(h, 0)
+	}
+}
+
+// grow makes sure that there are at least n slots, doubling their number up to
+// k, such that every row is copied a constant number of times on average
+func (h *topKHeap) grow(data Dataset, n int) {
+	if len(h.seqs) >= n {
+		return
+	}
+
+	size := 2 * len(h.seqs)
+	if size < n {
+		size = n
+	}
+	if size > h.k {
+		size = h.k
+	}
+
+	cols := make([]Data, data.Width())
+	for j := range cols {
+		cols[j] = data.At(j).Type().Data(size)
+		for slot := range h.slots {
+			cols[j].Copy(h.rows.At(j), slot, slot)
+		}
+	}
+	h.rows = NewDataset(cols...)
+	h.seqs = append(h.seqs, make([]int, size-len(h.seqs))...)
+}
+
+// set copies the i-th row of the data into the slot
+func (h *topKHeap) set(slot, seq int, data Dataset, i int) {
+	for j := 0; j < data.Width(); j++ {
+		h.rows.At(j).Copy(data.At(j), i, slot)
+	}
+	h.seqs[slot] = seq
+}
+
+// less reports whether the i-th row of the data, which arrived as seq, is
+// sorted before the row in the slot
+func (h *topKHeap) less(data Dataset, i, seq int, slot int) bool {
+	for _, col := range h.sortingCols {
+		if c := col.compare(data.At(col.Index), i, h.rows.At(col.Index), slot); c != 0 {
+			return c < 0
+		}
+	}
+	return seq < h.seqs[slot]
+}
+
+// sorted returns the retained rows sorted, or nil when there are none
+func (h *topKHeap) sorted() Dataset {
+	if len(h.slots) == 0 {
+		return nil
+	}
+
+	slots := append([]int(nil), h.slots...)
+	sort.Slice(slots, func(i, j int) bool {
+		return h.less(h.rows, slots[i], h.seqs[slots[i]], slots[j])
+	})
+	return take(h.rows, slots).(Dataset)
+}
+
+// see heap.Interface, with the worst row first
+func (h *topKHeap) Len() int { return len(h.slots) }
+func (h *topKHeap) Less(i, j int) bool {
+	a, b := h.slots[i], h.slots[j]
+	return h.less(h.rows, b, h.seqs[b], a)
+}
+func (h *topKHeap) Swap(i, j int)      { h.slots[i], h.slots[j] = h.slots[j], h.slots[i] }
+func (h *topKHeap) Push(x interface{}) { h.slots = append(h.slots, x.(int)) }
+func (h *topKHeap) Pop() interface{} {
+	slot := h.slots[len(h.slots)-1]
+	h.slots = h.slots[:len(h.slots)-1]
+	return slot
+}
@@ -0,0 +1,90 @@
+package ep_test
+
+import (
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+)
+
+func TestTopK(t *testing.T) {
+	keys := &ep.Int64s{Values: []int64{5, 3, 0, 3, 9, 1, 0, 3, 7, 2}, Null: ep.NullMask{4 | 64}}
+	ids := strs{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	data := ep.NewDataset(keys, ids)
+
+	tests := []struct {
+		name string
+		k    int
+		cols []ep.SortingCol
+	}{
+		{"asc", 4, []ep.SortingCol{{Index: 0}}},
+		{"desc", 4, []ep.SortingCol{{Index: 0, Desc: true}}},
+		{"nulls first", 3, []ep.SortingCol{{Index: 0, Nulls: ep.NullsFirst}}},
+		{"duplicates", 5, []ep.SortingCol{{Index: 0}}},
+		{"one", 1, []ep.SortingCol{{Index: 0, Desc: true}}},
+		{"all", 10, []ep.SortingCol{{Index: 1, Desc: true}}},
+		{"more than all", 100, []ep.SortingCol{{Index: 0}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sorted, err := ep.SortDataset(data, test.cols)
+			require.NoError(t, err)
+			n := test.k
+			if n > data.Len() {
+				n = data.Len()
+			}
+			expected := sorted.Slice(0, n).Strings()
+
+			// in batches of 3 rows
+			res, err := eptest.Run(ep.TopK(test.k, test.cols), data.Slice(0, 3).(ep.Dataset), data.Slice(3, 6).(ep.Dataset), data.Slice(6, 10).(ep.Dataset))
+			require.NoError(t, err)
+			require.Equal(t, expected, res.Strings())
+		})
+	}
+
+	res, err := eptest.Run(ep.TopK(0, []ep.SortingCol{{Index: 0}}), data)
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Len())
+
+	_, err = eptest.Run(ep.TopK(3, []ep.SortingCol{{Index: 2}}), data)
+	require.Error(t, err)
+	require.Equal(t, "ep: sorting column 2 out of range for 2 columns", err.Error())
+}
+
+// The retained rows are copied, thus independent of the input batches
+func TestTopK_copied(t *testing.T) {
+	keys := &ep.Int64s{Values: []int64{2, 1, 3}}
+	res, err := eptest.Run(ep.TopK(2, []ep.SortingCol{{Index: 0}}), ep.NewDataset(keys))
+	require.NoError(t, err)
+	keys.Values[1] = 7
+	require.Equal(t, []string{"[1 2]"}, res.Strings())
+}
+
+func TestTopK_distributed(t *testing.T) {
+	cluster := eptest.InMemoryCluster(3)
+	defer func() { require.NoError(t, cluster.Close()) }()
+
+	// 3000 distinct keys, in 30 batches
+	rnd := rand.New(rand.NewSource(83))
+	perm := rnd.Perm(3000)
+	var datasets []ep.Dataset
+	for i := 0; i < len(perm); i += 100 {
+		keys := &ep.Int64s{Values: make([]int64, 100)}
+		for j := range keys.Values {
+			keys.Values[j] = int64(perm[i+j])
+		}
+		datasets = append(datasets, ep.NewDataset(keys, ep.Clone(keys)))
+	}
+
+	cols := []ep.SortingCol{{Index: 0, Desc: true}}
+	runner := cluster.Distribute(ep.Pipeline(ep.Scatter(), ep.TopK(10, cols), ep.Gather(), ep.TopK(10, cols)))
+	res, err := eptest.Run(runner, datasets...)
+	require.NoError(t, err)
+
+	all := ep.ConcatDatasets(datasets...)
+	sorted, err := ep.SortDataset(all, cols)
+	require.NoError(t, err)
+	require.Equal(t, sorted.Slice(0, 10).Strings(), res.Strings())
+	require.Equal(t, "[2999 2998 2997 2996 2995 2994 2993 2992 2991 2990]", res.Strings()[0])
+}
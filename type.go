@@ -1,6 +1,11 @@
 package ep
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
 
 // Wildcard is a pseudo-type used to denote types that are dependent on their
 // input type. For example, a function returning [Wildcard, Int] effectively
@@ -41,21 +46,174 @@ type Type interface {
 	DataEmpty(n int) Data
 }
 
-// AreEqualTypes compares types and returns true if types arrays are deep equal
+// ParameterizedType is an optional interface of Types of several instances,
+// like the Decimal types of every precision and scale, exposing the arguments
+// of the instance for planners. The TypeFactory registered under the name of
+// the type returns the same instance for the same arguments
+type ParameterizedType interface {
+	Type
+
+	// Args returns the arguments of the type, as passed to its TypeFactory
+	Args() []interface{}
+}
+
+// TypeFactory returns the instance of a parameterized type of the arguments,
+// or fails when they're invalid. Arguments resolved by Types.Resolve are ints,
+// Types, or field names followed by their Types, as in "struct(a:int64)"
+type TypeFactory func(args ...interface{}) (Type, error)
+
+// typeFactories are the TypeFactories registered with Types.RegisterFactory,
+// by their names
+var typeFactories = map[string]TypeFactory{}
+
+// RegisterFactory registers the factory of the parameterized types of the
+// name, for Types.Resolve. Their Data is registered with gob by registering
+// any of their instances with Register, under the same name
+func (reg typesReg) RegisterFactory(name string, fn TypeFactory) typesReg {
+	typeFactories[name] = fn
+	return reg
+}
+
+// Resolve returns the Type of the name, like "int64" or "decimal(10,2)". It's
+// either the registered Type of the name, or an instance of a parameterized
+// type, returned by its factory for the arguments within the parentheses.
+// Arguments are comma-separated ints, Type names, or field names and their Type
+// names, separated by colons. Unknown names fail with the names of all of the
+// registered Types, unlike Get, which returns no Types for unknown keys
+func (reg typesReg) Resolve(name string) (Type, error) {
+	if t := reg.named(name); t != nil {
+		return t, nil
+	}
+
+	open := strings.IndexByte(name, '(')
+	if open < 0 {
+		return nil, reg.unknown(name)
+	} else if !strings.HasSuffix(name, ")") {
+		return nil, fmt.Errorf("ep: malformed type %q", name)
+	}
+
+	fn, ok := typeFactories[name[:open]]
+	if !ok {
+		return nil, reg.unknown(name[:open])
+	}
+
+	args, err := reg.resolveArgs(name[open+1 : len(name)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := fn(args...)
+	if err != nil {
+		return nil, fmt.Errorf("ep: %s: %s", name, err)
+	}
+	return t, nil
+}
+
+// resolveArgs resolves the comma-separated arguments of a parameterized type
+func (reg typesReg) resolveArgs(s string) ([]interface{}, error) {
+	parts, ok := splitTypeArgs(s)
+	if !ok {
+		return nil, fmt.Errorf("ep: malformed type arguments %q", s)
+	}
+
+	var res []interface{}
+	for _, arg := range parts {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			return nil, fmt.Errorf("ep: malformed type arguments %q", s)
+		} else if n, err := strconv.Atoi(arg); err == nil {
+			res = append(res, n)
+			continue
+		}
+
+		// a field name, followed by its type
+		typ := arg
+		if colon := strings.IndexByte(arg, ':'); colon >= 0 && !strings.ContainsRune(arg[:colon], '(') {
+			res = append(res, strings.TrimSpace(arg[:colon]))
+			typ = strings.TrimSpace(arg[colon+1:])
+		}
+
+		t, err := reg.Resolve(typ)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// splitTypeArgs splits the comma-separated arguments at the top level, outside
+// of the parentheses of nested types, and reports whether they're balanced
+func splitTypeArgs(s string) ([]string, bool) {
+	if strings.TrimSpace(s) == "" {
+		return nil, true
+	}
+
+	var res []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth < 0 {
+				return nil, false
+			}
+		case ',':
+			if depth == 0 {
+				res = append(res, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(res, s[start:]), depth == 0
+}
+
+// AreEqualTypes compares types and returns true if types arrays are deep equal:
+// types of the same names, and of equal arguments when they're parameterized,
+// or Any
 func AreEqualTypes(ts1, ts2 []Type) bool {
 	if len(ts1) != len(ts2) {
 		return false // mismatching number of types
 	}
 
 	for i, t1 := range ts1 {
-		if t1.Name() != ts2[i].Name() && !isAny(t1) && !isAny(ts2[i]) {
-			return false // mismatching type name
+		if !isAny(t1) && !isAny(ts2[i]) && !isEqualType(t1, ts2[i]) {
+			return false // mismatching type name, or arguments
 		}
 	}
 
 	return true
 }
 
+func isEqualType(t1, t2 Type) bool {
+	if t1.Name() != t2.Name() {
+		return false
+	}
+
+	p1, ok1 := baseType(t1).(ParameterizedType)
+	p2, ok2 := baseType(t2).(ParameterizedType)
+	if !ok1 || !ok2 {
+		return true
+	}
+
+	args1, args2 := p1.Args(), p2.Args()
+	if len(args1) != len(args2) {
+		return false
+	}
+	for i, arg := range args1 {
+		if t, ok := arg.(Type); ok {
+			other, ok := args2[i].(Type)
+			if !ok || !AreEqualTypes([]Type{t}, []Type{other}) {
+				return false
+			}
+		} else if !reflect.DeepEqual(arg, args2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 // see Wildcard above.
 type wildcardType struct {
 	Idx         *int
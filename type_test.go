@@ -0,0 +1,150 @@
+package ep_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+// varchar is a parameterized type whose Name doesn't include its arguments
+type varchar struct{ Length int }
+
+func (t *varchar) String() string           { return t.Name() }
+func (*varchar) Name() string               { return "varchar" }
+func (*varchar) Data(n int) ep.Data         { return ep.DictString.Data(n) }
+func (*varchar) DataEmpty(n int) ep.Data    { return ep.DictString.DataEmpty(n) }
+func (t *varchar) Args() []interface{}      { return []interface{}{t.Length} }
+func newVarchar(n int) ep.ParameterizedType { return &varchar{n} }
+
+var _ = ep.Types.
+	Register("varchar", newVarchar(1)).
+	RegisterFactory("varchar", func(args ...interface{}) (ep.Type, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected a length, got %d arguments", len(args))
+		}
+		n, ok := args[0].(int)
+		if !ok || n < 1 {
+			return nil, fmt.Errorf("invalid length %v", args[0])
+		}
+		return newVarchar(n), nil
+	})
+
+func TestTypes_Resolve(t *testing.T) {
+	types := []ep.Type{
+		ep.Int64,
+		ep.Null,
+		ep.Decimal(38, 9),
+		ep.Decimal(10, 2),
+		ep.List(ep.Decimal(5, 0)),
+		ep.List(ep.List(ep.DictString)),
+		ep.Struct([]string{"lat", "lon"}, []ep.Type{ep.Float64, ep.List(ep.Int64)}),
+		newVarchar(255),
+	}
+	for _, typ := range types {
+		name := typ.Name()
+		if v, ok := typ.(*varchar); ok {
+			name = fmt.Sprintf("varchar(%d)", v.Length)
+		}
+
+		res, err := ep.Types.Resolve(name)
+		require.NoError(t, err, name)
+		require.Equal(t, typ, res)
+		require.True(t, ep.AreEqualTypes([]ep.Type{typ}, []ep.Type{res}))
+	}
+
+	// with spaces between the arguments
+	res, err := ep.Types.Resolve("struct(a: decimal(10, 2), b :bool)")
+	require.NoError(t, err)
+	require.Equal(t, "struct(a:decimal(10,2),b:bool)", res.Name())
+	require.Equal(t, []interface{}{"a", ep.Decimal(10, 2), "b", ep.Bool}, res.(ep.ParameterizedType).Args())
+}
+
+func TestTypes_Resolve_errors(t *testing.T) {
+	errs := map[string]string{
+		"decimal(10)":            `ep: decimal(10): expected precision and scale, got 1 arguments`,
+		"decimal(2,3)":           `ep: decimal(2,3): invalid decimal(2,3)`,
+		"decimal(int64,2)":       `ep: decimal(int64,2): expected int precision and scale, got [int64 2]`,
+		"list()":                 `ep: list(): expected an element type, got 0 arguments`,
+		"list(int64":             `ep: malformed type "list(int64"`,
+		"list(int64))":           `ep: malformed type arguments "int64)"`,
+		"decimal(10,,2)":         `ep: malformed type arguments "10,,2"`,
+		"struct(a:int64,a:bool)": `ep: struct(a:int64,a:bool): duplicate struct field "a"`,
+		"struct(a:int64,bool)":   `ep: struct(a:int64,bool): expected field names and types, got 3 arguments`,
+		"varchar(0)":             `ep: varchar(0): invalid length 0`,
+	}
+	for name, expected := range errs {
+		_, err := ep.Types.Resolve(name)
+		require.Error(t, err, name)
+		require.Equal(t, expected, err.Error())
+	}
+
+	// with the names of all of the registered types, to spot typos
+	unknown := map[string]string{"nope": "nope", "nope(1)": "nope", "list(nope)": "nope", "decimal(a,2)": "a", "list(decimal(10,2),int)": "int"}
+	for name, typo := range unknown {
+		_, err := ep.Types.Resolve(name)
+		require.Error(t, err, name)
+		require.True(t, strings.HasPrefix(err.Error(), fmt.Sprintf(`ep: unknown type %q; registered types are [NULL `, typo)), err.Error())
+		require.Contains(t, err.Error(), " decimal(38,9) ")
+		require.Contains(t, err.Error(), " int64 ")
+	}
+}
+
+// registeredRuns is the number of the runs of TestTypes_Register_duplicates,
+// which registers types of a name of its own in every run, as the registry is
+// global and its types can't be unregistered
+var registeredRuns int
+
+func TestTypes_Register_duplicates(t *testing.T) {
+	registeredRuns++
+	name := fmt.Sprintf("test_int16_%d", registeredRuns)
+	typ := ep.NewSliceType[int16](name)
+	require.Equal(t, []ep.Type{typ}, ep.Types.Get(name))
+
+	// equal types are registered again under other keys only
+	ep.Types.Register(name, &ep.SliceType[int16]{TypeName: name})
+	ep.Types.Register(name+"_alias", &ep.SliceType[int16]{TypeName: name})
+	require.Equal(t, []ep.Type{typ}, ep.Types.Get(name))
+	require.Len(t, ep.Types.Get(name+"_alias"), 1)
+
+	// other types of the name panic, unless they override it
+	require.PanicsWithValue(t, fmt.Sprintf(`ep: type %q is already registered, as *ep.SliceType[int16], use Override to replace it`, name), func() {
+		ep.Types.Register(name, &ep.SliceType[int8]{TypeName: name})
+	})
+
+	other := &ep.SliceType[int8]{TypeName: name}
+	ep.Types.Register(name, other, ep.Override())
+	require.Equal(t, []ep.Type{other}, ep.Types.Get(name))
+	require.Empty(t, ep.Types.Get(name+"_alias"))
+	res, err := ep.Types.Resolve(name)
+	require.NoError(t, err)
+	require.Equal(t, other, res)
+}
+
+func TestAreEqualTypes_args(t *testing.T) {
+	v10, v255 := newVarchar(10), newVarchar(255)
+	require.Equal(t, v10.Name(), v255.Name())
+	require.False(t, ep.AreEqualTypes([]ep.Type{v10}, []ep.Type{v255}))
+	require.True(t, ep.AreEqualTypes([]ep.Type{v10}, []ep.Type{newVarchar(10)}))
+	require.True(t, ep.AreEqualTypes([]ep.Type{v10}, []ep.Type{ep.Any}))
+
+	// of nested types, and through modifiers
+	require.False(t, ep.AreEqualTypes([]ep.Type{ep.List(v10)}, []ep.Type{ep.List(v255)}))
+	require.True(t, ep.AreEqualTypes([]ep.Type{ep.Modify(v10, "k", "v")}, []ep.Type{v10}))
+	require.False(t, ep.AreEqualTypes([]ep.Type{ep.Modify(v10, "k", "v")}, []ep.Type{v255}))
+}
+
+// Instances of parameterized types are distributed as their own arguments
+func TestTypes_gob(t *testing.T) {
+	types := []ep.Type{ep.Decimal(10, 2), ep.List(ep.Struct([]string{"a"}, []ep.Type{newVarchar(7)})), newVarchar(3)}
+
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(&types))
+	var decoded []ep.Type
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&decoded))
+	require.Equal(t, types, decoded)
+	require.True(t, ep.AreEqualTypes(types, decoded))
+}
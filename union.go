@@ -3,23 +3,66 @@ package ep
 import (
 	"context"
 	"fmt"
+	"sync"
 )
 
-var _ = registerGob(union([]Runner{}))
+var _ = registerGob(&union{})
 
-// Union returns a new composite Runner that dispatches its inputs to all of
-// its internal runners and collects their output into a single unified stream
-// of datasets. It is required the all of the individual runners returns the
-// same data types
+// UnionMode is the input of the runners of UnionAll and Union
+type UnionMode int
+
+const (
+	// UnionTee dispatches all of the input to all of the runners, buffering
+	// the datasets that any of them didn't receive yet in memory, as Project
+	// does
+	UnionTee UnionMode = iota
+
+	// UnionNoInput runs all of the runners without any input, for runners
+	// that produce their own data, like scans. The input is discarded
+	UnionNoInput
+)
+
+// UnionAll returns a new composite Runner that runs all of its internal
+// runners concurrently, and interleaves their output into a single stream of
+// datasets, in the order they're produced. Every runner receives all of the
+// input, or none of it, by the UnionMode set with WithUnionMode. All of the
+// runners must return the same number of columns, of the same types, where
+// nulls and wildcards are compatible with any type. Once any of them fails,
+// the context of all of the others is canceled, and the first error is
+// returned
+func UnionAll(runners ...Runner) (Runner, error) {
+	return newUnion(runners, false)
+}
+
+// Union returns a new composite Runner similar to UnionAll, except that it
+// outputs every distinct row once, as with Distinct of all of the columns.
+//
+// NOTE: This is a breaking change. Union used to output all of the rows,
+// including duplicates, of its runners one after the other, and returned a
+// single runner as is. UnionAll keeps outputting all of the rows, though
+// interleaved in the order they're produced, and always returns a union, such
+// that its UnionMode applies
 func Union(runners ...Runner) (Runner, error) {
+	return newUnion(runners, true)
+}
+
+// WithUnionMode sets the UnionMode of a Runner returned by UnionAll or Union
+func WithUnionMode(r Runner, mode UnionMode) Runner {
+	u, ok := r.(*union)
+	if !ok {
+		panic("ep: WithUnionMode expects a union")
+	}
+
+	u.Mode = mode
+	return u
+}
+
+func newUnion(runners []Runner, distinct bool) (Runner, error) {
 	if len(runners) == 0 {
-		err := fmt.Errorf("at least 1 runner is required for union")
-		return nil, err
-	} else if len(runners) == 1 {
-		return runners[0], nil
+		return nil, fmt.Errorf("ep: union of no runners")
 	}
 
-	u := union(runners)
+	u := &union{Runners: runners, Distinct: distinct}
 	_, err := u.ReturnsErr()
 	if err != nil {
 		return nil, err
@@ -28,11 +71,15 @@ func Union(runners ...Runner) (Runner, error) {
 	return u, nil
 }
 
-type union []Runner
+type union struct {
+	Runners  []Runner
+	Mode     UnionMode
+	Distinct bool
+}
 
 // see Runner. Assumes all runners has the same return types.
-func (rs union) Returns() []Type {
-	types, err := rs.ReturnsErr()
+func (u *union) Returns() []Type {
+	types, err := u.ReturnsErr()
 	if err != nil {
 		panic("Union() should've prevented this error from panicking")
 	}
@@ -40,25 +87,24 @@ func (rs union) Returns() []Type {
 	return types
 }
 
-// determine the return types - skipping NULLS as they don't expose any
-// information about the actual data types.
-func (rs union) ReturnsErr() ([]Type, error) {
-	types := rs[0].Returns()
+// determine the return types - skipping NULLS and wildcards as they don't
+// expose any information about the actual data types.
+func (u *union) ReturnsErr() ([]Type, error) {
+	types := append([]Type{}, u.Runners[0].Returns()...)
 
 	// ensure that the return types are compatible
-	for _, r := range rs {
+	for i, r := range u.Runners {
 		have := r.Returns()
 		if len(have) != len(types) {
-			return nil, fmt.Errorf("mismatch number of columns: %v and %v", types, have)
+			return nil, fmt.Errorf("ep: union of runner 0 of %d columns %v, and runner %d of %d columns %v", len(types), types, i, len(have), have)
 		}
 
-		for i, t := range have {
-
+		for j, t := range have {
 			// choose the first column type that isn't a null
-			if Null.Is(types[i]) {
-				types[i] = have[i]
-			} else if !Null.Is(t) && t.Name() != types[i].Name() {
-				return nil, fmt.Errorf("type mismatch %s and %s", types, have)
+			if isUnknownType(types[j]) {
+				types[j] = have[j]
+			} else if !isUnknownType(t) && !isEqualType(t, types[j]) {
+				return nil, fmt.Errorf("ep: union of column %d of %s, and of %s in runner %d", j, types[j], t, i)
 			}
 		}
 	}
@@ -66,53 +112,77 @@ func (rs union) ReturnsErr() ([]Type, error) {
 	return types, nil
 }
 
-func (rs union) Run(ctx context.Context, inp, out chan Dataset) (err error) {
-	// start all inner runners
-	inputs := make([]chan Dataset, len(rs))
-	outputs := make([]chan Dataset, len(rs))
-	errors := make([]error, len(rs))
-	defer func() {
-		for _, errI := range errors {
-			if errI != nil && err == nil {
-				err = errI
-				break
+// isUnknownType reports whether the type doesn't expose the actual data type,
+// as a null or a wildcard
+func isUnknownType(t Type) bool {
+	_, ok := t.(*wildcardType)
+	return ok || isAny(t) || Null.Is(t)
+}
+
+func (u *union) Run(ctx context.Context, inp, out chan Dataset) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var inputs []chan Dataset
+	if u.Mode == UnionTee {
+		inputs = forkInput(inp, len(u.Runners))
+	} else {
+		go func() {
+			for range inp {
 			}
+		}()
+		for range u.Runners {
+			input := make(chan Dataset)
+			close(input)
+			inputs = append(inputs, input)
 		}
-	}()
-	for i := range rs {
-		inputs[i] = make(chan Dataset)
-		outputs[i] = make(chan Dataset)
-
-		go func(i int) {
-			defer close(outputs[i])
-			errors[i] = rs[i].Run(ctx, inputs[i], outputs[i])
-		}(i)
 	}
 
-	// fork the input to all inner runners
-	go func() {
-		for data := range inp {
-			for _, s := range inputs {
-				s <- data
-			}
+	// the first error of all of the runners, which cancels the others
+	var l sync.Mutex
+	var err error
+	setErr := func(e error) {
+		l.Lock()
+		defer l.Unlock()
+		if e != nil && err == nil {
+			err = e
+			cancel()
 		}
+	}
+	firstErr := func() error {
+		l.Lock()
+		defer l.Unlock()
+		return err
+	}
 
-		// close all inner runners
-		for _, s := range inputs {
-			close(s)
-		}
-	}()
-	defer func() {
-		// in case of error - drain input
-		for range inp {
-		}
+	merged := make(chan Dataset)
+	var wg sync.WaitGroup
+	for i, r := range u.Runners {
+		wg.Add(1)
+		go func(r Runner, input chan Dataset) {
+			defer wg.Done()
+			setErr(runSafe(ctx, r, input, merged))
+
+			// the runner might have returned before its input was completed
+			for range input {
+			}
+		}(r, inputs[i])
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
 	}()
 
-	// collect and union all of the stream into a single output
-	for _, s := range outputs {
-		for data := range s {
+	if u.Distinct {
+		setErr(Distinct().Run(ctx, merged, out))
+	}
+
+	// drain the runners, such that they complete, forwarding their output
+	// unless it was already consumed by Distinct, or any of them failed
+	for data := range merged {
+		if !u.Distinct && firstErr() == nil {
 			out <- data
 		}
 	}
-	return err
+	return firstErr()
 }
@@ -10,6 +10,9 @@ func ExampleUnion() {
 	runner, _ := ep.Union(&upper{}, &question{})
 	data := ep.NewDataset(strs([]string{"hello", "world"}))
 	data, err := eptest.Run(runner, data)
+
+	// the outputs of both runners are interleaved
+	data, _ = ep.SortDataset(data, []ep.SortingCol{{Index: 0}})
 	fmt.Println(data.Strings(), err)
 
 	// Output:
@@ -0,0 +1,137 @@
+package ep_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/panoplyio/ep"
+	"github.com/panoplyio/ep/eptest"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+)
+
+// awaitCancel is a Runner that outputs a single dataset, and then waits for its
+// context to be canceled
+type awaitCancel struct{ canceled chan struct{} }
+
+func (*awaitCancel) Returns() []ep.Type { return []ep.Type{ep.Int64} }
+func (r *awaitCancel) Run(ctx context.Context, inp, out chan ep.Dataset) error {
+	out <- ep.NewDataset(ints(1))
+	<-ctx.Done()
+	close(r.canceled)
+	return nil
+}
+
+// failing is a Runner that fails once its input is completed
+type failing struct{ error }
+
+func (*failing) Returns() []ep.Type { return []ep.Type{ep.Int64} }
+func (r *failing) Run(_ context.Context, inp, out chan ep.Dataset) error {
+	for range inp {
+	}
+	return r.error
+}
+
+func TestUnionAll(t *testing.T) {
+	first := ep.Source(ep.NewDataset(ints(1, 2)), ep.NewDataset(ints(3)))
+	second := ep.Source(ep.NewDataset(ints(2, 4)))
+	runner, err := ep.UnionAll(first, second, first)
+	require.NoError(t, err)
+
+	res, err := eptest.Run(runner, ep.NewDataset(ints(0)))
+	require.NoError(t, err)
+
+	values := res.At(0).Strings()
+	sort.Strings(values)
+	require.Equal(t, []string{"1", "1", "2", "2", "2", "3", "3", "4"}, values)
+}
+
+func TestUnionAll_tee(t *testing.T) {
+	runner, err := ep.UnionAll(&upper{}, &question{}, &upper{})
+	require.NoError(t, err)
+
+	data := ep.NewDataset(strs{"a", "b"})
+	res, err := eptest.Run(runner, data, data)
+	require.NoError(t, err)
+
+	values := res.At(0).Strings()
+	sort.Strings(values)
+	require.Equal(t, []string{
+		"A", "A", "A", "A", "B", "B", "B", "B",
+		"is a?", "is a?", "is b?", "is b?",
+	}, values)
+}
+
+func TestUnionAll_noInput(t *testing.T) {
+	runner, err := ep.UnionAll(&upper{}, &question{})
+	require.NoError(t, err)
+	runner = ep.WithUnionMode(runner, ep.UnionNoInput)
+
+	res, err := eptest.Run(runner, ep.NewDataset(strs{"a", "b"}))
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Len())
+
+	runner, err = ep.UnionAll(ep.Source(ep.NewDataset(ints(1))), ep.Source(ep.NewDataset(ints(2))))
+	require.NoError(t, err)
+	runner = ep.WithUnionMode(runner, ep.UnionNoInput)
+
+	res, err = eptest.Run(runner, ep.NewDataset(strs{"a", "b"}))
+	require.NoError(t, err)
+	values := res.At(0).Strings()
+	sort.Strings(values)
+	require.Equal(t, []string{"1", "2"}, values)
+}
+
+func TestUnion(t *testing.T) {
+	first := ep.Source(ep.NewDataset(ints(1, 2), strs{"a", "b"}), ep.NewDataset(ints(1), strs{"c"}))
+	second := ep.Source(ep.NewDataset(ints(2, 1, 1), strs{"b", "a", "c"}))
+	runner, err := ep.Union(first, second, first)
+	require.NoError(t, err)
+
+	res, err := eptest.Run(runner, ep.NewDataset(ints(0)))
+	require.NoError(t, err)
+
+	res, err = ep.SortDataset(res, []ep.SortingCol{{Index: 0}, {Index: 1}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"[1 1 2]", "[a c b]"}, res.Strings())
+}
+
+func TestUnionAll_errorCancelsSiblings(t *testing.T) {
+	sibling := &awaitCancel{make(chan struct{})}
+	runner, err := ep.UnionAll(sibling, &failing{fmt.Errorf("bad")}, ep.Source(ep.NewDataset(ints(2))))
+	require.NoError(t, err)
+
+	_, err = eptest.Run(runner, ep.NewDataset(ints(0)))
+	require.EqualError(t, err, "bad")
+	<-sibling.canceled
+}
+
+func TestUnion_errorCancelsSiblings(t *testing.T) {
+	sibling := &awaitCancel{make(chan struct{})}
+	runner, err := ep.Union(sibling, &failing{fmt.Errorf("bad")})
+	require.NoError(t, err)
+
+	_, err = eptest.Run(runner, ep.NewDataset(ints(0)))
+	require.EqualError(t, err, "bad")
+	<-sibling.canceled
+}
+
+func TestUnionAll_schema(t *testing.T) {
+	_, err := ep.UnionAll()
+	require.EqualError(t, err, "ep: union of no runners")
+
+	_, err = ep.UnionAll(&upper{}, ep.Source(ep.NewDataset(strs{"a"}, strs{"b"})))
+	require.EqualError(t, err, "ep: union of runner 0 of 1 columns [string], and runner 1 of 2 columns [string string]")
+
+	_, err = ep.Union(&upper{}, &failing{})
+	require.EqualError(t, err, "ep: union of column 0 of string, and of int64 in runner 1")
+
+	// nulls and wildcards are compatible with any type
+	runner, err := ep.UnionAll(ep.Source(ep.NewDataset(ep.Null.Data(1))), ep.PassThrough(), &failing{})
+	require.NoError(t, err)
+	require.Equal(t, []ep.Type{ep.Int64}, runner.Returns())
+}
+
+func TestWithUnionMode_panics(t *testing.T) {
+	require.Panics(t, func() { ep.WithUnionMode(ep.PassThrough(), ep.UnionNoInput) })
+}